@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// activeDirName is the directory of an environment that records who is using
+// it: a file per shell that activated it and per running exec, named after
+// the process ID and holding what the process is.
+const activeDirName = ".active"
+
+// envUser is a live process using an environment.
+type envUser struct {
+	PID  int
+	What string // "shell", or the command an exec runs
+}
+
+func (u envUser) String() string {
+	if u.What == "shell" {
+		return fmt.Sprintf("a shell (pid %d)", u.PID)
+	}
+	return fmt.Sprintf("%s (pid %d)", u.What, u.PID)
+}
+
+// markEnvInUse records this process as running command in an environment
+// and returns a function that removes the record. Failing to record is
+// logged and never stops the command.
+func markEnvInUse(envPath, command string) func() {
+	dir := filepath.Join(envPath, activeDirName)
+	path := filepath.Join(dir, strconv.Itoa(os.Getpid()))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		logger.Warnf("not recording use of %s: %v", envPath, err)
+		return func() {}
+	}
+	if err := os.WriteFile(path, []byte(command+"\n"), 0644); err != nil {
+		logger.Warnf("not recording use of %s: %v", envPath, err)
+		return func() {}
+	}
+	unregister := onInterrupt(func() { os.Remove(path) })
+	return func() {
+		unregister()
+		os.Remove(path)
+	}
+}
+
+// activeEnvUsers returns the processes recorded as using an environment,
+// ordered by process ID. Records of processes that have exited, such as
+// shells closed without deactivating, are removed. The shell tfvenv runs in
+// is left out: it is busy running tfvenv.
+func activeEnvUsers(envPath string) []envUser {
+	dir := filepath.Join(envPath, activeDirName)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var users []envUser
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || pid <= 0 {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		if !processAlive(pid) {
+			os.Remove(path)
+			continue
+		}
+		if pid == os.Getpid() || pid == os.Getppid() {
+			continue
+		}
+		what := "shell"
+		if data, err := os.ReadFile(path); err == nil && strings.TrimSpace(string(data)) != "" {
+			what = strings.TrimSpace(string(data))
+		}
+		users = append(users, envUser{PID: pid, What: what})
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].PID < users[j].PID })
+	return users
+}
+
+// checkEnvNotInUse refuses to change the binaries of an environment that a
+// shell has activated or an exec is running in, unless force is set, in
+// which case it only warns.
+func checkEnvNotInUse(envPath, envName string, force bool) error {
+	users := activeEnvUsers(envPath)
+	if len(users) == 0 {
+		return nil
+	}
+	described := make([]string, len(users))
+	for i, user := range users {
+		described[i] = user.String()
+	}
+	if force {
+		logger.Warnf("environment %s is in use by %s; continuing because of --force", envName, strings.Join(described, ", "))
+		return nil
+	}
+	return fmt.Errorf("environment %s is in use by %s; deactivate it and wait for running commands to finish, or pass --force", envName, strings.Join(described, ", "))
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// artifactIndexFileName maps download URLs to the content they were last
+// downloaded as, inside the artifact cache.
+const artifactIndexFileName = "index.json"
+
+// artifactIndexMu serialises updates from concurrent downloads.
+var artifactIndexMu sync.Mutex
+
+// streamBufferSize is the buffer downloads and extraction write through.
+const streamBufferSize = 1 << 20
+
+// artifactLocksDirName holds one lock file per URL being downloaded, inside
+// the artifact cache.
+const artifactLocksDirName = ".locks"
+
+// artifactIndexEntry records what a URL downloaded.
+type artifactIndexEntry struct {
+	SHA256     string    `json:"sha256"`
+	Size       int64     `json:"size"`
+	Downloaded time.Time `json:"downloaded"`
+}
+
+// artifactCacheDir returns the content-addressed cache of downloaded release
+// archives and binaries, shared by every environment. Files are named by
+// their sha256 digest.
+func artifactCacheDir() string {
+	return filepath.Join(userDirs.CacheDir(), "sha256")
+}
+
+// loadArtifactIndex reads the URL index. A missing or unreadable index is empty.
+func loadArtifactIndex() map[string]artifactIndexEntry {
+	index := make(map[string]artifactIndexEntry)
+	path := filepath.Join(artifactCacheDir(), artifactIndexFileName)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return index
+	}
+	if err := json.Unmarshal(data, &index); err != nil {
+		logger.Warnf("ignoring corrupt artifact index %s: %v", path, err)
+		return make(map[string]artifactIndexEntry)
+	}
+	return index
+}
+
+// recordArtifact adds a downloaded URL to the index.
+func recordArtifact(url string, entry artifactIndexEntry) error {
+	artifactIndexMu.Lock()
+	defer artifactIndexMu.Unlock()
+
+	index := loadArtifactIndex()
+	index[url] = entry
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(artifactCacheDir(), artifactIndexFileName), data, 0644)
+}
+
+// cachedArtifact returns the cached copy of what url downloads, if the cache
+// holds it and its content still matches its digest.
+func cachedArtifact(url string) (string, bool) {
+	entry, ok := loadArtifactIndex()[url]
+	if !ok {
+		return "", false
+	}
+	path := filepath.Join(artifactCacheDir(), entry.SHA256)
+	digest, err := fileSHA256(path)
+	if err != nil {
+		return "", false
+	}
+	if digest != entry.SHA256 {
+		logger.Warnf("removing corrupt cached artifact %s", path)
+		os.Remove(path)
+		return "", false
+	}
+	return path, true
+}
+
+// fetchArtifact copies what url downloads to dest, from the artifact cache
+// when it holds it, and reports whether it did. Downloads are checked with
+// verify, given the sha256 digest computed while downloading, before they are
+// added to the cache; a cache that cannot be written only costs the reuse.
+// Processes fetching the same url at once download it once: the others wait
+// for it and copy it from the cache.
+func fetchArtifact(url, dest string, verify func(digest string) error) (bool, error) {
+	if copyCachedArtifact(url, dest) {
+		return true, nil
+	}
+	if unlock, err := lockArtifact(url); err != nil {
+		logger.Warnf("downloading %s without a lock: %v", url, err)
+	} else {
+		defer unlock()
+		if copyCachedArtifact(url, dest) {
+			return true, nil
+		}
+	}
+
+	digest, size, err := downloadFile(url, dest)
+	if err != nil {
+		return false, err
+	}
+	if verify != nil {
+		if err := verify(digest); err != nil {
+			os.Remove(dest)
+			return false, err
+		}
+	}
+	if err := cacheArtifact(url, dest, digest, size); err != nil {
+		logger.Warnf("failed to cache %s: %v", url, err)
+	}
+	return false, nil
+}
+
+// copyCachedArtifact copies the cached copy of what url downloads to dest, and
+// reports whether there was one.
+func copyCachedArtifact(url, dest string) bool {
+	path, ok := cachedArtifact(url)
+	if !ok {
+		return false
+	}
+	if err := copyFile(path, dest); err != nil {
+		return false
+	}
+	logger.Infof("using cached %s for %s", path, url)
+	summary.cacheHit()
+	return true
+}
+
+// lockArtifact takes the lock that lets one process at a time download url,
+// waiting for others, and returns the function that releases it.
+func lockArtifact(url string) (func(), error) {
+	dir := filepath.Join(artifactCacheDir(), artifactLocksDirName)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	sum := sha256.Sum256([]byte(url))
+	f, err := os.OpenFile(filepath.Join(dir, hex.EncodeToString(sum[:8])+".lock"), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f, true, true); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		unlockFile(f)
+		f.Close()
+	}, nil
+}
+
+// cacheArtifact stores a downloaded file under its digest, already computed
+// while downloading, and indexes it by url.
+func cacheArtifact(url, path, digest string, size int64) error {
+	cacheDir := artifactCacheDir()
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", cacheDir, err)
+	}
+	entry := artifactIndexEntry{SHA256: digest, Size: size, Downloaded: time.Now().UTC()}
+	if fileExists(filepath.Join(cacheDir, digest)) {
+		return recordArtifact(url, entry)
+	}
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	// Copy into a temporary file, then name it by its digest
+	tmp, err := os.CreateTemp(cacheDir, ".download-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	buffered := bufio.NewWriterSize(tmp, streamBufferSize)
+	_, err = io.Copy(buffered, in)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to copy %s into the cache: %w", path, err)
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(cacheDir, digest)); err != nil {
+		return err
+	}
+	return recordArtifact(url, entry)
+}
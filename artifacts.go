@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Forms a tool release is published in.
+const (
+	artifactZip    = "zip"
+	artifactTarGz  = "tar.gz"
+	artifactBinary = "binary"
+)
+
+// Checksum strategies besides the URL of a SHA256SUMS file.
+const (
+	checksumNone    = ""
+	checksumSidecar = "sidecar"
+)
+
+// toolArtifact describes how a tool release is published for this platform.
+type toolArtifact struct {
+	// URL is where the release is downloaded from.
+	URL string
+	// Type is zip, tar.gz or binary.
+	Type string
+	// Member is the executable's file name inside an archive. Defaults to the
+	// tool name, with .exe on Windows.
+	Member string
+	// Checksum is how a download is verified: not at all, against a
+	// "<URL>.sha256" sidecar file, or against the SHA256SUMS file at this URL.
+	Checksum string
+}
+
+// builtinArtifact returns how Terraform, OpenTofu and Terragrunt are published.
+func builtinArtifact(baseURL, version, tool string) (toolArtifact, error) {
+	if err := checkReleasePlatform(tool); err != nil {
+		return toolArtifact{}, err
+	}
+	switch tool {
+	case "terraform":
+		// Terraform is distributed as a zip archive across all OSes
+		// Example: https://releases.hashicorp.com/terraform/1.9.7/terraform_1.9.7_linux_amd64.zip
+		return toolArtifact{
+			URL:      fmt.Sprintf("%s%s/terraform_%s_%s_%s.zip", baseURL, version, version, runtime.GOOS, runtime.GOARCH),
+			Type:     artifactZip,
+			Checksum: checksumURL(tool, version),
+		}, nil
+	case toolTofu:
+		// OpenTofu is distributed as a zip archive like Terraform
+		// Example: https://github.com/opentofu/opentofu/releases/download/v1.6.2/tofu_1.6.2_linux_amd64.zip
+		return toolArtifact{
+			URL:      fmt.Sprintf("%sv%s/tofu_%s_%s_%s.zip", baseURL, version, version, runtime.GOOS, runtime.GOARCH),
+			Type:     artifactZip,
+			Checksum: checksumURL(tool, version),
+		}, nil
+	case "terragrunt":
+		// Terragrunt binaries are direct downloads, with .exe for Windows
+		// Example for Linux: https://github.com/gruntwork-io/terragrunt/releases/download/v0.67.16/terragrunt_linux_amd64
+		// Example for Windows: https://github.com/gruntwork-io/terragrunt/releases/download/v0.67.16/terragrunt_windows_amd64.exe
+		url := fmt.Sprintf("%sv%s/terragrunt_%s_%s", baseURL, version, runtime.GOOS, runtime.GOARCH)
+		if runtime.GOOS == "windows" {
+			url += windowsExecutableSuffix
+		}
+		return toolArtifact{URL: url, Type: artifactBinary, Checksum: checksumURL(tool, version)}, nil
+	}
+	return toolArtifact{}, fmt.Errorf("unknown tool: %s", tool)
+}
+
+// downloadPath returns the file in binDir an artifact is downloaded to before
+// it is installed.
+func (a toolArtifact) downloadPath(binDir string) string {
+	return filepath.Join(binDir, ".download-"+path.Base(a.URL))
+}
+
+// installArtifact installs the executable from a downloaded artifact as
+// binaryPath, and removes the download.
+func installArtifact(a toolArtifact, downloaded, binaryPath string) error {
+	defer os.Remove(downloaded)
+	member := a.Member
+	if member == "" {
+		member = filepath.Base(binaryPath)
+	}
+
+	switch a.Type {
+	case artifactBinary:
+		if err := os.Rename(downloaded, binaryPath); err != nil {
+			return fmt.Errorf("failed to install %s: %w", binaryPath, err)
+		}
+	case artifactTarGz:
+		if err := extractTarGzMember(downloaded, member, binaryPath); err != nil {
+			return err
+		}
+	case artifactZip:
+		// Extract to a scratch directory so an archive's LICENSE and README stay out of bin
+		extractDir, err := os.MkdirTemp(filepath.Dir(binaryPath), ".extract-")
+		if err != nil {
+			return fmt.Errorf("failed to create extraction directory: %w", err)
+		}
+		defer os.RemoveAll(extractDir)
+		if err := unzipStandard(downloaded, extractDir); err != nil {
+			return err
+		}
+		extracted, err := findArchiveMember(extractDir, member)
+		if err != nil {
+			return err
+		}
+		if err := os.Rename(extracted, binaryPath); err != nil {
+			return fmt.Errorf("failed to install %s: %w", binaryPath, err)
+		}
+	default:
+		return fmt.Errorf("unsupported artifact type %q: expected %s, %s or %s", a.Type, artifactZip, artifactTarGz, artifactBinary)
+	}
+
+	if runtime.GOOS != "windows" {
+		if err := os.Chmod(binaryPath, 0755); err != nil {
+			return fmt.Errorf("failed to set execute permissions on %s: %w", binaryPath, err)
+		}
+	}
+	return nil
+}
+
+// findArchiveMember returns the regular file named member in an extracted
+// archive, preferring the shallowest one.
+func findArchiveMember(dir, member string) (string, error) {
+	found := ""
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() && info.Name() == member {
+			if found == "" || strings.Count(p, string(os.PathSeparator)) < strings.Count(found, string(os.PathSeparator)) {
+				found = p
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if found == "" {
+		return "", fmt.Errorf("%s not found in the archive", member)
+	}
+	return found, nil
+}
+
+// verifyArtifact checks the sha256 digest of a downloaded artifact against its
+// published checksum.
+func verifyArtifact(a toolArtifact, actual string) error {
+	if a.Checksum == checksumNone {
+		return nil
+	}
+	sumsURL := a.Checksum
+	if a.Checksum == checksumSidecar {
+		sumsURL = a.URL + ".sha256"
+	}
+	expected, err := publishedChecksum(sumsURL, path.Base(a.URL))
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(actual, expected) {
+		return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", a.URL, expected, actual)
+	}
+	logger.Infof("verified %s against %s", a.URL, sumsURL)
+	return nil
+}
+
+// publishedChecksum returns the sha256 listed for file in a SHA256SUMS file, or
+// the only digest of a sidecar file.
+func publishedChecksum(sumsURL, file string) (string, error) {
+	req, err := http.NewRequestWithContext(rootCtx, http.MethodGet, sumsURL, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch checksums %s: %w", sumsURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch checksums %s: status code %d", sumsURL, resp.StatusCode)
+	}
+
+	var lines [][]string
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, 1<<20))
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) > 0 {
+			lines = append(lines, fields)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read checksums %s: %w", sumsURL, err)
+	}
+	for _, fields := range lines {
+		if len(fields) >= 2 && strings.TrimPrefix(fields[1], "*") == file {
+			return fields[0], nil
+		}
+	}
+	// A sidecar holds just the digest, optionally followed by the file name
+	if len(lines) == 1 && len(lines[0][0]) == 64 {
+		return lines[0][0], nil
+	}
+	return "", fmt.Errorf("no checksum for %s in %s", file, sumsURL)
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"tfvenv/i18n"
+)
+
+// Types identifying the provenance statements written by attest.
+const (
+	inTotoStatementType = "https://in-toto.io/Statement/v1"
+	slsaProvenanceType  = "https://slsa.dev/provenance/v1"
+	attestBuildType     = "https://github.com/rickcollette/tfvenv/attest/v1"
+	attestFileName      = "provenance.intoto.json"
+)
+
+// inTotoStatement is an in-toto attestation whose subjects are the
+// environment's binaries and whose predicate is SLSA provenance.
+type inTotoStatement struct {
+	Type          string           `json:"_type"`
+	Subject       []attestResource `json:"subject"`
+	PredicateType string           `json:"predicateType"`
+	Predicate     slsaProvenance   `json:"predicate"`
+}
+
+// attestResource is an artifact identified by name, location and digest.
+type attestResource struct {
+	Name   string            `json:"name,omitempty"`
+	URI    string            `json:"uri,omitempty"`
+	Digest map[string]string `json:"digest,omitempty"`
+}
+
+// slsaProvenance describes how the environment was assembled.
+type slsaProvenance struct {
+	BuildDefinition struct {
+		BuildType            string            `json:"buildType"`
+		ExternalParameters   map[string]string `json:"externalParameters"`
+		InternalParameters   map[string]string `json:"internalParameters"`
+		ResolvedDependencies []attestResource  `json:"resolvedDependencies"`
+	} `json:"buildDefinition"`
+	RunDetails struct {
+		Builder struct {
+			ID string `json:"id"`
+		} `json:"builder"`
+		Metadata struct {
+			InvocationID string `json:"invocationId,omitempty"`
+			FinishedOn   string `json:"finishedOn"`
+		} `json:"metadata"`
+	} `json:"runDetails"`
+}
+
+// attestCmd writes a provenance statement for an environment.
+func attestCmd() *cobra.Command {
+	var output string
+	var sign bool
+
+	cmd := &cobra.Command{
+		Use:   "attest <env-name>",
+		Short: "Write an in-toto/SLSA provenance statement for an environment",
+		Long: `Write an in-toto statement with a SLSA provenance predicate describing the
+environment: who built it, from which commit of the config directory, and
+the versions, download locations and sha256 digests of its binaries and
+provider lock files. With --sign the statement is signed with cosign keyless
+signing and the Sigstore bundle is written next to it.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envDir := viper.GetString("env-dir")
+			envPath := filepath.Join(envDir, envName)
+			if _, err := os.Stat(envPath); os.IsNotExist(err) {
+				i18n.Println("env.not_found", envName)
+				os.Exit(1)
+			}
+			if output == "" {
+				output = filepath.Join(envPath, attestFileName)
+			}
+			if sign && output == "-" {
+				i18n.Println("error", "--sign needs the statement in a file; use --output <path>")
+				os.Exit(1)
+			}
+
+			statement, err := buildProvenance(envPath, envName)
+			if err != nil {
+				logger.Errorf("error building provenance for %s: %v", envName, err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			data, _ := json.MarshalIndent(statement, "", "  ")
+			if output == "-" {
+				fmt.Println(string(data))
+				return
+			}
+			if err := os.WriteFile(output, append(data, '\n'), 0644); err != nil {
+				logger.Errorf("error writing %s: %v", output, err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Provenance for '%s' written to %s\n", envName, output)
+			logger.Infof("wrote provenance for %s to %s", envName, output)
+
+			if sign {
+				bundle, err := signProvenance(output)
+				if err != nil {
+					logger.Errorf("error signing %s: %v", output, err)
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+				fmt.Printf("Signed with cosign; bundle written to %s\n", bundle)
+				logger.Infof("signed %s, bundle %s", output, bundle)
+			}
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Where to write the statement (default <env>/"+attestFileName+", - for stdout)")
+	cmd.Flags().BoolVar(&sign, "sign", false, "Sign the statement with cosign keyless signing")
+	return cmd
+}
+
+// buildProvenance collects the environment's binaries, configuration and
+// revision into a provenance statement.
+func buildProvenance(envPath, envName string) (inTotoStatement, error) {
+	configEnvDir := filepath.Join(envPath, "config", envName)
+	config, _ := readConfig(filepath.Join(configEnvDir, tfvenvrcFileName))
+	meta, _ := loadEnvMetadata(envPath)
+	tool := resolveTool(config.Tool, meta.Tool)
+
+	statement := inTotoStatement{Type: inTotoStatementType, PredicateType: slsaProvenanceType}
+	build := &statement.Predicate.BuildDefinition
+	build.BuildType = attestBuildType
+	build.ExternalParameters = map[string]string{
+		"environment": envName,
+		"tool":        tool,
+		"tf_version":  config.TfVersion,
+		"tg_version":  config.TgVersion,
+	}
+	build.InternalParameters = map[string]string{
+		"os":       runtime.GOOS,
+		"arch":     runtime.GOARCH,
+		"user":     getUsername(),
+		"hostname": getHostname(),
+	}
+
+	// Subjects: the binaries the environment runs
+	for _, name := range []string{tool, "terragrunt"} {
+		binaryPath := envBinaryPath(envPath, name)
+		if !fileExists(binaryPath) {
+			continue
+		}
+		digest, err := fileSHA256(binaryPath)
+		if err != nil {
+			return statement, err
+		}
+		statement.Subject = append(statement.Subject, attestResource{
+			Name:   filepath.ToSlash(filepath.Join("bin", filepath.Base(binaryPath))),
+			Digest: map[string]string{"sha256": digest},
+		})
+		if version, err := getBinaryVersion(binaryPath, name); err == nil {
+			downloadURL, _, err := binaryDownloadURL(toolDownloadURL(name), version, filepath.Dir(binaryPath), name)
+			if err == nil {
+				build.ResolvedDependencies = append(build.ResolvedDependencies, attestResource{Name: name + "@" + version, URI: downloadURL})
+			}
+		}
+	}
+	if len(statement.Subject) == 0 {
+		return statement, fmt.Errorf("environment '%s' has no installed binaries to attest", envName)
+	}
+
+	// Dependencies: the config revision, its .tfvenvrc and provider lock files
+	if revision := getGitRevision(configEnvDir); revision != nil {
+		dep := attestResource{Name: "config", Digest: map[string]string{"gitCommit": revision.Commit}}
+		if remote, err := gitOutput("-C", configEnvDir, "remote", "get-url", "origin"); err == nil {
+			dep.URI = "git+" + remote
+			if revision.Branch != "" {
+				dep.URI += "@refs/heads/" + revision.Branch
+			}
+		}
+		build.ExternalParameters["config_dirty"] = fmt.Sprintf("%t", revision.Dirty)
+		build.ResolvedDependencies = append(build.ResolvedDependencies, dep)
+	}
+	roots, err := envRoots(envPath, envName)
+	if err != nil {
+		roots = []string{"."}
+	}
+	files := []string{tfvenvrcFileName}
+	for _, root := range roots {
+		files = append(files, filepath.Join(root, ".terraform.lock.hcl"))
+	}
+	for _, rel := range files {
+		path := filepath.Join(configEnvDir, rel)
+		if !fileExists(path) {
+			continue
+		}
+		digest, err := fileSHA256(path)
+		if err != nil {
+			return statement, err
+		}
+		build.ResolvedDependencies = append(build.ResolvedDependencies, attestResource{
+			Name:   filepath.ToSlash(filepath.Join("config", envName, rel)),
+			Digest: map[string]string{"sha256": digest},
+		})
+	}
+
+	run := &statement.Predicate.RunDetails
+	run.Builder.ID, run.Metadata.InvocationID = attestBuilder()
+	run.Metadata.FinishedOn = time.Now().UTC().Format(time.RFC3339)
+	return statement, nil
+}
+
+// attestBuilder identifies who assembled the environment: the CI run when
+// there is one, otherwise the local user and host.
+func attestBuilder() (string, string) {
+	if server, repo, runID := os.Getenv("GITHUB_SERVER_URL"), os.Getenv("GITHUB_REPOSITORY"), os.Getenv("GITHUB_RUN_ID"); repo != "" && runID != "" {
+		run := fmt.Sprintf("%s/%s/actions/runs/%s", server, repo, runID)
+		return run, run
+	}
+	if job := os.Getenv("CI_JOB_URL"); job != "" {
+		return job, job
+	}
+	return fmt.Sprintf("tfvenv://%s@%s", getUsername(), getHostname()), ""
+}
+
+// signProvenance signs the statement with cosign keyless signing and returns
+// the path of the Sigstore bundle.
+func signProvenance(path string) (string, error) {
+	cosign, err := exec.LookPath("cosign")
+	if err != nil {
+		return "", fmt.Errorf("cosign not found on PATH; install it from https://github.com/sigstore/cosign")
+	}
+	bundle := path + ".sigstore.json"
+	cmd := exec.Command(cosign, "sign-blob", "--yes", "--bundle", bundle, path)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Stdin = os.Stdin
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("cosign sign-blob failed: %w", err)
+	}
+	return bundle, nil
+}
+
+// fileSHA256 returns the hex sha256 digest of a file.
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// auditLogFileName is the environment's audit log, one JSON event per line.
+const auditLogFileName = "audit.log"
+
+// unauditedEvents are emitted by nearly every command, and would drown out
+// the changes the audit log is for.
+var unauditedEvents = map[string]bool{
+	eventLockAcquired: true,
+	eventLockReleased: true,
+}
+
+// appendAuditLog records an encoded event line in the audit log of the
+// environment it concerns. Environments whose directory is gone, such as
+// expired ones that were deleted, are not recorded.
+func appendAuditLog(envPath, eventType string, payload []byte) error {
+	if unauditedEvents[eventType] {
+		return nil
+	}
+	if info, err := os.Stat(envPath); err != nil || !info.IsDir() {
+		return nil
+	}
+	logPath := filepath.Join(envPath, auditLogFileName)
+	file, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log %s: %w", logPath, err)
+	}
+	defer file.Close()
+	if _, err := file.Write(payload); err != nil {
+		return fmt.Errorf("failed to write audit log %s: %w", logPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"tfvenv/snaps"
+)
+
+// remoteSnapProfileFlag is the AWS profile given with --profile to a remote
+// snap command.
+var remoteSnapProfileFlag string
+
+// addRemoteSnapProfileFlag registers the --profile flag shared by remote snap commands.
+func addRemoteSnapProfileFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&remoteSnapProfileFlag, "profile", "", "AWS profile for the remote snap bucket (overrides AWS_ACCESS_KEY/AWS_SECRET_KEY and AWS_PROFILE in .tfvenvrc)")
+}
+
+// remoteSnapAWS resolves the credentials, region and profile used by remote
+// snap operations. Static keys are returned only when AWS_ACCESS_KEY and
+// AWS_SECRET_KEY are set and no --profile was given; otherwise the SDK's
+// default credential chain applies, with the profile from remoteSnapProfile
+// selected in it. The region comes from AWS_REGION in the shell, then
+// AWS_REGION or REGION in .tfvenvrc, then the shared AWS configuration of
+// that profile.
+func remoteSnapAWS(envPath, envName string) (string, string, string, string, error) {
+	accessKey := os.Getenv("AWS_ACCESS_KEY")
+	secretKey := os.Getenv("AWS_SECRET_KEY")
+	region := os.Getenv("AWS_REGION")
+	if remoteSnapProfileFlag != "" {
+		accessKey, secretKey = "", ""
+	}
+	if (accessKey == "") != (secretKey == "") {
+		return "", "", "", "", fmt.Errorf("AWS_ACCESS_KEY and AWS_SECRET_KEY must be set together")
+	}
+
+	v := viper.New()
+	if err := readTfvenvrc(v, filepath.Join(envPath, "config", envName, tfvenvrcFileName)); err == nil {
+		if region == "" {
+			region = v.GetString("AWS_REGION")
+		}
+		if region == "" {
+			region = v.GetString("REGION")
+		}
+	}
+
+	profile := remoteSnapProfile(envPath, envName)
+	if region == "" {
+		region = snaps.SharedConfigRegion(profile)
+	}
+	if region == "" {
+		return "", "", "", "", fmt.Errorf("no AWS region configured: set AWS_REGION in the shell or in %s, or a region for the AWS profile", tfvenvrcFileName)
+	}
+	return accessKey, secretKey, region, profile, nil
+}
+
+// remoteSnapProfile returns the AWS profile remote snap operations select:
+// the one given with --profile, then AWS_PROFILE in the environment's
+// .tfvenvrc unless static keys are set. Empty means the default chain, which
+// honours AWS_PROFILE in the shell.
+func remoteSnapProfile(envPath, envName string) string {
+	if remoteSnapProfileFlag != "" {
+		return remoteSnapProfileFlag
+	}
+	if os.Getenv("AWS_ACCESS_KEY") != "" && os.Getenv("AWS_SECRET_KEY") != "" {
+		return ""
+	}
+	v := viper.New()
+	if err := readTfvenvrc(v, filepath.Join(envPath, "config", envName, tfvenvrcFileName)); err != nil {
+		return ""
+	}
+	return v.GetString("AWS_PROFILE")
+}
+
+// remoteSnapReplica returns the bucket the environment's remote snaps are
+// mirrored to, or nil when REMOTE_SNAP_REPLICA_BUCKET is not set. The replica
+// uses the primary's region and credentials unless REMOTE_SNAP_REPLICA_REGION
+// or REMOTE_SNAP_REPLICA_PROFILE, for a bucket in another account, are set.
+func remoteSnapReplica(envPath, envName, accessKey, secretKey, region, profile string) *snaps.Replica {
+	config, _ := readConfig(filepath.Join(envPath, "config", envName, tfvenvrcFileName))
+	if config.SnapReplicaBucket == "" {
+		return nil
+	}
+	replica := &snaps.Replica{Bucket: config.SnapReplicaBucket, Region: region, Profile: config.SnapReplicaProfile}
+	if config.SnapReplicaRegion != "" {
+		replica.Region = config.SnapReplicaRegion
+	}
+	if replica.Profile == "" {
+		replica.AccessKey, replica.SecretKey = accessKey, secretKey
+		if accessKey == "" {
+			replica.Profile = profile
+		}
+	}
+	return replica
+}
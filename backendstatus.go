@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// backendStatusTimeout bounds the S3 and DynamoDB calls status makes.
+const backendStatusTimeout = 30 * time.Second
+
+// stateObjectStatus describes one state file in the S3 backend and whether
+// its DynamoDB lock is held.
+type stateObjectStatus struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+	Lock         *stateLockInfo
+}
+
+// stateLockInfo is the lock record Terraform writes to the Info attribute of
+// the lock table while a plan or apply holds the state.
+type stateLockInfo struct {
+	ID        string    `json:"ID"`
+	Operation string    `json:"Operation"`
+	Who       string    `json:"Who"`
+	Version   string    `json:"Version"`
+	Created   time.Time `json:"Created"`
+	Path      string    `json:"Path"`
+}
+
+// queryStateBackend lists the state files under S3_STATE_PATH in the state
+// bucket and, with DYNAMODB_TABLE set, looks up their locks. Terragrunt
+// layouts keep one state per unit below the path, so every *.tfstate object
+// under it is reported.
+func queryStateBackend(config Config) ([]stateObjectStatus, error) {
+	if config.S3StateBucket == "" || config.S3StateBucket == backendPlaceholders[0] {
+		return nil, fmt.Errorf("S3_STATE_BUCKET is not set")
+	}
+	sess, err := newAWSSession(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize AWS session: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(rootCtx, backendStatusTimeout)
+	defer cancel()
+
+	prefix := strings.Trim(config.S3StatePath, "/")
+	if prefix == backendPlaceholders[1] {
+		prefix = ""
+	}
+	var states []stateObjectStatus
+	err = s3.New(sess).ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(config.S3StateBucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			if key := aws.StringValue(obj.Key); strings.HasSuffix(key, ".tfstate") {
+				states = append(states, stateObjectStatus{
+					Key:          key,
+					Size:         aws.Int64Value(obj.Size),
+					LastModified: aws.TimeValue(obj.LastModified),
+				})
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list s3://%s/%s: %w", config.S3StateBucket, prefix, err)
+	}
+
+	if config.DynamoDBTable == "" {
+		return states, nil
+	}
+	client := dynamodb.New(sess)
+	for i := range states {
+		lock, err := stateLock(ctx, client, config.DynamoDBTable, config.S3StateBucket+"/"+states[i].Key)
+		if err != nil {
+			return nil, err
+		}
+		states[i].Lock = lock
+	}
+	return states, nil
+}
+
+// stateLock returns the lock held on the state at lockID ("bucket/key"), or
+// nil when nobody holds it. The "-md5" digest items the backend keeps next to
+// locks are not locks and are never asked for.
+func stateLock(ctx context.Context, client *dynamodb.DynamoDB, table, lockID string) (*stateLockInfo, error) {
+	out, err := client.GetItemWithContext(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(table),
+		Key:            map[string]*dynamodb.AttributeValue{lockTableHashKey: {S: aws.String(lockID)}},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock %s from %s: %w", lockID, table, err)
+	}
+	if len(out.Item) == 0 {
+		return nil, nil
+	}
+	lock := &stateLockInfo{}
+	if info := out.Item["Info"]; info != nil && info.S != nil {
+		if err := json.Unmarshal([]byte(aws.StringValue(info.S)), lock); err != nil {
+			logger.Warnf("unreadable lock info for %s: %v", lockID, err)
+		}
+	}
+	return lock, nil
+}
+
+// printStateBackendStatus prints the state files of the backend and who, if
+// anyone, is running Terraform against them.
+func printStateBackendStatus(config Config) {
+	fmt.Printf("State backend (s3://%s/%s):\n", config.S3StateBucket, strings.Trim(config.S3StatePath, "/"))
+	states, err := queryStateBackend(config)
+	if err != nil {
+		logger.Warnf("error querying state backend: %v", err)
+		fmt.Printf(" - unavailable: %v\n", err)
+		return
+	}
+	if len(states) == 0 {
+		fmt.Println(" - no state objects found")
+		return
+	}
+	for _, state := range states {
+		fmt.Printf(" - %s: %s, last modified %s\n", state.Key, formatSize(state.Size), state.LastModified.Local().Format(time.RFC3339))
+		switch {
+		case config.DynamoDBTable == "":
+			continue
+		case state.Lock == nil:
+			fmt.Println("   lock: free")
+		default:
+			fmt.Printf("   lock: HELD by %s (%s", unknownIfEmpty(state.Lock.Who), unknownIfEmpty(state.Lock.Operation))
+			if !state.Lock.Created.IsZero() {
+				fmt.Printf(" since %s", state.Lock.Created.Local().Format(time.RFC3339))
+			}
+			fmt.Printf(", lock ID %s)\n", unknownIfEmpty(state.Lock.ID))
+		}
+	}
+	if config.DynamoDBTable == "" {
+		fmt.Println(" - DYNAMODB_TABLE is not set, lock state unknown")
+	}
+}
+
+// unknownIfEmpty stands in for lock fields an older Terraform left empty.
+func unknownIfEmpty(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	return s
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+const (
+	backupsDirName     = ".backups"
+	backupTimestampFmt = "20060102T150405.000000000"
+)
+
+// newBackupSet creates a timestamped backup directory under <env>/.backups and returns its path.
+func newBackupSet(envPath string) (string, error) {
+	backupDir := filepath.Join(envPath, backupsDirName, time.Now().UTC().Format(backupTimestampFmt))
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create backup directory %s: %w", backupDir, err)
+	}
+	return backupDir, nil
+}
+
+// backupFile copies the file at path into backupDir, preserving its location relative to envPath.
+// A symlink, such as a binary linked from the version store, is backed up as a symlink.
+func backupFile(envPath, backupDir, path string) error {
+	relPath, err := filepath.Rel(envPath, path)
+	if err != nil {
+		return fmt.Errorf("failed to compute relative path for %s: %w", path, err)
+	}
+
+	destPath := filepath.Join(backupDir, relPath)
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory %s: %w", filepath.Dir(destPath), err)
+	}
+
+	if err := copyFileOrLink(path, destPath); err != nil {
+		return fmt.Errorf("failed to back up %s: %w", path, err)
+	}
+
+	logger.Infof("Backed up %s to %s", path, destPath)
+	return nil
+}
+
+// backupBinaries backs up the environment's installed tool binaries into a new
+// backup set. It returns an empty path when no binary is installed yet.
+func backupBinaries(envPath string) (string, error) {
+	var backupDir string
+	for _, tool := range []string{toolTerraform, toolTofu, "terragrunt"} {
+		path := envBinaryPath(envPath, tool)
+		if !fileExists(path) {
+			continue
+		}
+		if backupDir == "" {
+			dir, err := newBackupSet(envPath)
+			if err != nil {
+				return "", err
+			}
+			backupDir = dir
+		}
+		if err := backupFile(envPath, backupDir, path); err != nil {
+			return "", err
+		}
+	}
+	return backupDir, nil
+}
+
+// listBackupSets returns the backup directories of an environment, oldest first.
+func listBackupSets(envPath string) ([]string, error) {
+	backupsRoot := filepath.Join(envPath, backupsDirName)
+	entries, err := os.ReadDir(backupsRoot)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backups directory %s: %w", backupsRoot, err)
+	}
+
+	sets := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			sets = append(sets, filepath.Join(backupsRoot, entry.Name()))
+		}
+	}
+	sort.Strings(sets)
+	return sets, nil
+}
+
+// restoreLatestBackup restores every file of the most recent backup set into the environment
+// and removes the set afterwards. It returns the list of restored files.
+func restoreLatestBackup(envPath string) ([]string, error) {
+	sets, err := listBackupSets(envPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(sets) == 0 {
+		return nil, fmt.Errorf("no backups found in %s", filepath.Join(envPath, backupsDirName))
+	}
+	latest := sets[len(sets)-1]
+
+	restored := []string{}
+	err = filepath.Walk(latest, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(latest, path)
+		if err != nil {
+			return err
+		}
+		destPath := filepath.Join(envPath, relPath)
+		if err := restoreFile(path, destPath); err != nil {
+			return fmt.Errorf("failed to restore %s: %w", destPath, err)
+		}
+		restored = append(restored, destPath)
+		logger.Infof("Restored %s from %s", destPath, path)
+		return nil
+	})
+	if err != nil {
+		return restored, err
+	}
+
+	if err := os.RemoveAll(latest); err != nil {
+		return restored, fmt.Errorf("failed to remove backup set %s: %w", latest, err)
+	}
+	return restored, nil
+}
+
+// restoreFile puts a backed-up file or symlink back at dst. It is written
+// beside dst and renamed over it, so a dst that links into the version store
+// is replaced rather than written through, which would change the binary of
+// every environment sharing that version.
+func restoreFile(src, dst string) error {
+	tmp := dst + ".tfvenv-restore"
+	os.Remove(tmp)
+	if err := copyFileOrLink(src, tmp); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := commitStagedBinary(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// copyFileOrLink copies src to dst like copyFile, but recreates a symlink
+// at src as a symlink to the same target. dst must not exist.
+func copyFileOrLink(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return copyFile(src, dst)
+	}
+	target, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+	return os.Symlink(target, dst)
+}
+
+// copyFile copies src to dst, preserving the source file mode.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	// Never write through a symlink left at dst
+	if dstInfo, err := os.Lstat(dst); err == nil && dstInfo.Mode()&os.ModeSymlink != 0 {
+		if err := os.Remove(dst); err != nil {
+			return err
+		}
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"tfvenv/i18n"
+)
+
+// benchRun is one environment created by a benchmark.
+type benchRun struct {
+	Env      string        `json:"env"`
+	Duration time.Duration `json:"duration_ns"`
+	MaxRSS   int64         `json:"max_rss_bytes,omitempty"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// benchReport is the outcome of 'tfvenv bench create'.
+type benchReport struct {
+	Environments int           `json:"environments"`
+	Parallel     int           `json:"parallel"`
+	TfVersion    string        `json:"tf_version"`
+	TgVersion    string        `json:"tg_version"`
+	ColdCache    bool          `json:"cold_cache"`
+	Wall         time.Duration `json:"wall_ns"`
+	Min          time.Duration `json:"min_ns"`
+	Median       time.Duration `json:"median_ns"`
+	Max          time.Duration `json:"max_ns"`
+	PeakRSS      int64         `json:"peak_rss_bytes,omitempty"`
+	Failed       int           `json:"failed"`
+	Runs         []benchRun    `json:"runs"`
+}
+
+// benchCmd groups the internal benchmarks, which make performance
+// regressions measurable. It is hidden from help.
+func benchCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:    "bench",
+		Short:  "Measure how long tfvenv operations take",
+		Hidden: true,
+	}
+
+	cmd.AddCommand(benchCreateCmd())
+	return cmd
+}
+
+// benchCreateCmd creates throwaway environments concurrently, each in a tfvenv
+// process of its own as a CI job would, and reports their durations and
+// memory use.
+func benchCreateCmd() *cobra.Command {
+	var count, parallel int
+	var tfVersion, tgVersion, tool string
+	var cold, keep, jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "create",
+		Short: "Create environments concurrently in a scratch directory and report timings and peak memory",
+		Long: `Create --envs environments in a scratch directory, --parallel at a time, each
+with a separate 'tfvenv create' process. Reports the wall time, the fastest,
+median and slowest creation, and the largest resident set size of any
+process (not measured on Windows). With --cold the processes share an empty
+artifact cache, so the first of them downloads and the others wait for it.
+The scratch directory is removed afterwards unless --keep is given.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if count < 1 {
+				fmt.Println("Error: --envs must be at least 1.")
+				os.Exit(1)
+			}
+			if !cmd.Flags().Changed("parallel") {
+				parallel = count
+			}
+
+			workDir, err := os.MkdirTemp("", "tfvenv-bench-")
+			if err != nil {
+				logger.Errorf("error creating scratch directory: %v", err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			envDir := filepath.Join(workDir, "environments")
+			childEnv := os.Environ()
+			if cold {
+				childEnv = append(childEnv, "TFVENV_CACHE_DIR="+filepath.Join(workDir, "cache"))
+			}
+
+			runs := make([]benchRun, count)
+			jobs := make([]job, count)
+			for i := range jobs {
+				i := i
+				envName := fmt.Sprintf("bench-%02d", i+1)
+				createArgs := []string{"--env-dir", envDir, "create", envName, "--tf-version", tfVersion, "--tg-version", tgVersion}
+				if tool != "" {
+					createArgs = append(createArgs, "--tool", tool)
+				}
+				jobs[i] = job{
+					Name: envName,
+					Run: func() error {
+						run := exec.Command(tfvenvExecutable(), createArgs...)
+						run.Env = childEnv
+						start := time.Now()
+						output, err := run.CombinedOutput()
+						runs[i] = benchRun{Env: envName, Duration: time.Since(start)}
+						if run.ProcessState != nil {
+							runs[i].MaxRSS = processMaxRSS(run.ProcessState)
+						}
+						if err != nil {
+							runs[i].Error = lastLine(string(output))
+							return fmt.Errorf("%v: %s", err, runs[i].Error)
+						}
+						return nil
+					},
+				}
+			}
+
+			start := time.Now()
+			runJobs(jobs, parallel)
+			report := summarizeBench(runs, time.Since(start))
+			report.Parallel = parallel
+			report.TfVersion = tfVersion
+			report.TgVersion = tgVersion
+			report.ColdCache = cold
+
+			if keep {
+				fmt.Fprintf(os.Stderr, "Kept the environments in %s\n", envDir)
+			} else if err := os.RemoveAll(workDir); err != nil {
+				logger.Warnf("failed to remove %s: %v", workDir, err)
+			}
+
+			if jsonOutput {
+				data, _ := json.MarshalIndent(report, "", "  ")
+				fmt.Println(string(data))
+			} else {
+				printBenchReport(report)
+			}
+			if report.Failed > 0 {
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().IntVar(&count, "envs", 10, "Number of environments to create")
+	addParallelFlag(cmd, &parallel)
+	cmd.Flags().Lookup("parallel").Usage = "Maximum number of environments to create at once (defaults to --envs)"
+	cmd.Flags().StringVar(&tfVersion, "tf-version", "latest", "Terraform (or OpenTofu) version to create the environments with")
+	cmd.Flags().StringVar(&tgVersion, "tg-version", "none", "Terragrunt version to create the environments with")
+	cmd.Flags().StringVar(&tool, "tool", "", "Tool family to install: terraform or tofu")
+	cmd.Flags().BoolVar(&cold, "cold", false, "Start from an empty artifact cache instead of the user's")
+	cmd.Flags().BoolVar(&keep, "keep", false, "Keep the scratch directory with the created environments")
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the report as JSON")
+	return cmd
+}
+
+// summarizeBench computes the duration spread, peak memory and failures of
+// the runs.
+func summarizeBench(runs []benchRun, wall time.Duration) benchReport {
+	report := benchReport{Environments: len(runs), Wall: wall, Runs: runs}
+	var durations []time.Duration
+	for _, run := range runs {
+		if run.Error != "" {
+			report.Failed++
+			continue
+		}
+		durations = append(durations, run.Duration)
+		if run.MaxRSS > report.PeakRSS {
+			report.PeakRSS = run.MaxRSS
+		}
+	}
+	if len(durations) > 0 {
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		report.Min = durations[0]
+		report.Median = durations[len(durations)/2]
+		report.Max = durations[len(durations)-1]
+	}
+	return report
+}
+
+// printBenchReport prints a benchmark report for people.
+func printBenchReport(report benchReport) {
+	cache := "warm"
+	if report.ColdCache {
+		cache = "cold"
+	}
+	fmt.Printf("\nCreated %d environment(s), %d at a time, in %s (%s cache).\n", report.Environments-report.Failed, report.Parallel, report.Wall.Round(time.Millisecond), cache)
+	fmt.Printf("  Fastest: %s  Median: %s  Slowest: %s\n", report.Min.Round(time.Millisecond), report.Median.Round(time.Millisecond), report.Max.Round(time.Millisecond))
+	if report.PeakRSS > 0 {
+		fmt.Printf("  Peak memory of one process: %s\n", formatSize(report.PeakRSS))
+	}
+	if report.Failed > 0 {
+		fmt.Printf("  Failed: %d\n", report.Failed)
+		for _, run := range report.Runs {
+			if run.Error != "" {
+				fmt.Printf("    %s: %s\n", run.Env, run.Error)
+			}
+		}
+	}
+}
+
+// lastLine returns the last non-empty line of a command's output.
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
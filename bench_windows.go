@@ -0,0 +1,11 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// processMaxRSS is not measured on Windows, where a finished process reports
+// only its CPU times.
+func processMaxRSS(state *os.ProcessState) int64 {
+	return 0
+}
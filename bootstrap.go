@@ -0,0 +1,250 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"tfvenv/i18n"
+	"tfvenv/netretry"
+)
+
+// lockTableHashKey is the partition key Terraform's S3 backend expects on the lock table.
+const lockTableHashKey = "LockID"
+
+// bootstrapBackendCmd creates or verifies the S3 state bucket and DynamoDB lock table.
+func bootstrapBackendCmd() *cobra.Command {
+	var verifyOnly bool
+
+	cmd := &cobra.Command{
+		Use:   "bootstrap-backend <env-name>",
+		Short: "Create or verify the S3 state bucket and DynamoDB lock table for an environment",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envDir := viper.GetString("env-dir")
+			envPath := filepath.Join(envDir, envName)
+			configPath := filepath.Join(envPath, "config", envName, tfvenvrcFileName)
+
+			config, err := readConfig(configPath)
+			if err != nil {
+				logger.Errorf("error reading %s: %v", configPath, err)
+				i18n.Println("config.read_error", err)
+				os.Exit(1)
+			}
+			if config.S3StateBucket == "" {
+				fmt.Printf("Error: S3_STATE_BUCKET is not set in %s\n", configPath)
+				os.Exit(1)
+			}
+
+			sess, err := newAWSSession(config)
+			if err != nil {
+				logger.Errorf("error initializing AWS session: %v", err)
+				fmt.Printf("Error initializing AWS session: %v\n", err)
+				os.Exit(1)
+			}
+
+			if err := bootstrapStateBucket(s3.New(sess), config.S3StateBucket, aws.StringValue(sess.Config.Region), verifyOnly); err != nil {
+				logger.Errorf("state bucket bootstrap failed: %v", err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+
+			if config.DynamoDBTable == "" {
+				fmt.Println("DYNAMODB_TABLE is not set, skipping the lock table.")
+				return
+			}
+			if err := bootstrapLockTable(dynamodb.New(sess), config.DynamoDBTable, verifyOnly); err != nil {
+				logger.Errorf("lock table bootstrap failed: %v", err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&verifyOnly, "verify-only", false, "Only report problems, do not create or modify resources")
+	return cmd
+}
+
+// newAWSSession builds a session from the .tfvenvrc credentials or AWS_PROFILE,
+// falling back to the SDK's default credential chain and AWS_REGION when they are not set.
+func newAWSSession(config Config) (*session.Session, error) {
+	cfg := aws.Config{}
+	region := config.AWSRegion
+	if region == "" {
+		region = config.Region
+	}
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region != "" {
+		cfg.Region = aws.String(region)
+	}
+	if config.AccessKey != "" && config.SecretKey != "" {
+		cfg.Credentials = credentials.NewStaticCredentials(config.AccessKey, config.SecretKey, "")
+	}
+	// Shared config is required for SSO and assume-role profiles
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            cfg,
+		Profile:           config.AWSProfile,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, err
+	}
+	netretry.ApplyAWS(sess)
+	return sess, nil
+}
+
+// bootstrapStateBucket makes sure the bucket exists with versioning and default
+// encryption enabled and public access blocked.
+func bootstrapStateBucket(client *s3.S3, bucket, region string, verifyOnly bool) error {
+	return bootstrapBucket(client, "state", bucket, region, verifyOnly)
+}
+
+// bootstrapBucket sets up a bucket tfvenv stores state or snaps in. kind names
+// the bucket in messages.
+func bootstrapBucket(client *s3.S3, kind, bucket, region string, verifyOnly bool) error {
+	_, err := client.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		aerr, ok := err.(awserr.Error)
+		if !ok || (aerr.Code() != "NotFound" && aerr.Code() != s3.ErrCodeNoSuchBucket) {
+			return fmt.Errorf("failed to check bucket %s: %w", bucket, err)
+		}
+		if verifyOnly {
+			return fmt.Errorf("%s bucket %s does not exist", kind, bucket)
+		}
+
+		input := &s3.CreateBucketInput{Bucket: aws.String(bucket)}
+		// us-east-1 rejects an explicit location constraint
+		if region != "" && region != "us-east-1" {
+			input.CreateBucketConfiguration = &s3.CreateBucketConfiguration{LocationConstraint: aws.String(region)}
+		}
+		if _, err := client.CreateBucket(input); err != nil {
+			return fmt.Errorf("failed to create bucket %s: %w", bucket, err)
+		}
+		if err := client.WaitUntilBucketExists(&s3.HeadBucketInput{Bucket: aws.String(bucket)}); err != nil {
+			return fmt.Errorf("failed waiting for bucket %s: %w", bucket, err)
+		}
+		fmt.Printf("Created %s bucket %s\n", kind, bucket)
+		logger.Infof("created %s bucket %s in %s", kind, bucket, region)
+	} else {
+		fmt.Printf("%s bucket %s exists\n", strings.ToUpper(kind[:1])+kind[1:], bucket)
+	}
+
+	versioning, err := client.GetBucketVersioning(&s3.GetBucketVersioningInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return fmt.Errorf("failed to read versioning for %s: %w", bucket, err)
+	}
+	if aws.StringValue(versioning.Status) != s3.BucketVersioningStatusEnabled {
+		if verifyOnly {
+			return fmt.Errorf("versioning is not enabled on %s", bucket)
+		}
+		_, err := client.PutBucketVersioning(&s3.PutBucketVersioningInput{
+			Bucket: aws.String(bucket),
+			VersioningConfiguration: &s3.VersioningConfiguration{
+				Status: aws.String(s3.BucketVersioningStatusEnabled),
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to enable versioning on %s: %w", bucket, err)
+		}
+		fmt.Printf("Enabled versioning on %s\n", bucket)
+	}
+
+	_, err = client.GetBucketEncryption(&s3.GetBucketEncryptionInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		aerr, ok := err.(awserr.Error)
+		if !ok || aerr.Code() != "ServerSideEncryptionConfigurationNotFoundError" {
+			return fmt.Errorf("failed to read encryption for %s: %w", bucket, err)
+		}
+		if verifyOnly {
+			return fmt.Errorf("default encryption is not enabled on %s", bucket)
+		}
+		_, err := client.PutBucketEncryption(&s3.PutBucketEncryptionInput{
+			Bucket: aws.String(bucket),
+			ServerSideEncryptionConfiguration: &s3.ServerSideEncryptionConfiguration{
+				Rules: []*s3.ServerSideEncryptionRule{{
+					ApplyServerSideEncryptionByDefault: &s3.ServerSideEncryptionByDefault{
+						SSEAlgorithm: aws.String(s3.ServerSideEncryptionAes256),
+					},
+				}},
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to enable encryption on %s: %w", bucket, err)
+		}
+		fmt.Printf("Enabled default encryption on %s\n", bucket)
+	}
+
+	if !verifyOnly {
+		_, err = client.PutPublicAccessBlock(&s3.PutPublicAccessBlockInput{
+			Bucket: aws.String(bucket),
+			PublicAccessBlockConfiguration: &s3.PublicAccessBlockConfiguration{
+				BlockPublicAcls:       aws.Bool(true),
+				BlockPublicPolicy:     aws.Bool(true),
+				IgnorePublicAcls:      aws.Bool(true),
+				RestrictPublicBuckets: aws.Bool(true),
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to block public access on %s: %w", bucket, err)
+		}
+	}
+	return nil
+}
+
+// bootstrapLockTable makes sure the DynamoDB table exists with the LockID string
+// partition key Terraform uses for state locking.
+func bootstrapLockTable(client *dynamodb.DynamoDB, table string, verifyOnly bool) error {
+	out, err := client.DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(table)})
+	if err == nil {
+		for _, key := range out.Table.KeySchema {
+			if aws.StringValue(key.AttributeName) == lockTableHashKey && aws.StringValue(key.KeyType) == dynamodb.KeyTypeHash {
+				fmt.Printf("Lock table %s exists\n", table)
+				return nil
+			}
+		}
+		return fmt.Errorf("lock table %s exists but its partition key is not %s", table, lockTableHashKey)
+	}
+
+	aerr, ok := err.(awserr.Error)
+	if !ok || aerr.Code() != dynamodb.ErrCodeResourceNotFoundException {
+		return fmt.Errorf("failed to describe table %s: %w", table, err)
+	}
+	if verifyOnly {
+		return fmt.Errorf("lock table %s does not exist", table)
+	}
+
+	_, err = client.CreateTable(&dynamodb.CreateTableInput{
+		TableName:   aws.String(table),
+		BillingMode: aws.String(dynamodb.BillingModePayPerRequest),
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{{
+			AttributeName: aws.String(lockTableHashKey),
+			AttributeType: aws.String(dynamodb.ScalarAttributeTypeS),
+		}},
+		KeySchema: []*dynamodb.KeySchemaElement{{
+			AttributeName: aws.String(lockTableHashKey),
+			KeyType:       aws.String(dynamodb.KeyTypeHash),
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create table %s: %w", table, err)
+	}
+	if err := client.WaitUntilTableExists(&dynamodb.DescribeTableInput{TableName: aws.String(table)}); err != nil {
+		return fmt.Errorf("failed waiting for table %s: %w", table, err)
+	}
+	fmt.Printf("Created lock table %s\n", table)
+	logger.Infof("created lock table %s", table)
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// providerLockFileName is the lock file in each provider directory of the
+// plugin cache (<host>/<namespace>/<type>). Commands that run terraform init,
+// or fill the cache, hold a shared lock on the directories of the providers
+// they use; cleanup takes an exclusive lock before it removes or replaces a
+// file in one, and leaves directories that are in use alone.
+const providerLockFileName = ".tfvenv.lock"
+
+// errLockBusy is returned by a non-blocking lock attempt on a held lock.
+var errLockBusy = errors.New("lock is held by another process")
+
+// providerLock is a held lock on one provider directory.
+type providerLock struct {
+	file *os.File
+}
+
+// lockProviderDir locks a provider directory of the plugin cache, creating it
+// if needed. Shared locks wait for cleanup to finish; exclusive locks do not
+// wait and return errLockBusy while a shared lock is held.
+func lockProviderDir(dir string, exclusive bool) (*providerLock, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	f, err := os.OpenFile(filepath.Join(dir, providerLockFileName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file in %s: %w", dir, err)
+	}
+	if err := lockFile(f, exclusive, !exclusive); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &providerLock{file: f}, nil
+}
+
+// release unlocks the directory.
+func (l *providerLock) release() {
+	unlockFile(l.file)
+	l.file.Close()
+}
+
+// providerDirOf returns the provider directory holding path in the plugin
+// cache, or "" when path is not inside one.
+func providerDirOf(pluginCacheDir, path string) string {
+	rel, err := filepath.Rel(pluginCacheDir, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(parts) < 4 {
+		return ""
+	}
+	return filepath.Join(pluginCacheDir, parts[0], parts[1], parts[2])
+}
+
+// holdProviderLocks takes shared locks on the plugin cache directories of the
+// providers a root module's dependency lock file pins, and returns the
+// function that releases them. A root without a lock file, or a lock that
+// cannot be taken, only loses the protection from cleanup.
+func holdProviderLocks(envPath, envName, root string) func() {
+	lockPath := filepath.Join(envPath, "config", envName, root, dependencyLockFileName)
+	if !fileExists(lockPath) {
+		return func() {}
+	}
+	locked, err := readLockedProviders(lockPath)
+	if err != nil {
+		logger.Warnf("not locking providers of %s: %v", rootLabel(envName, root), err)
+		return func() {}
+	}
+
+	cacheDir := defaultPluginCacheDir()
+	var held []*providerLock
+	for _, provider := range locked {
+		lock, err := lockProviderDir(filepath.Join(cacheDir, provider.Host, provider.Namespace, provider.Type), false)
+		if err != nil {
+			logger.Warnf("failed to lock %s in the plugin cache: %v", provider, err)
+			continue
+		}
+		held = append(held, lock)
+	}
+	return func() {
+		for _, lock := range held {
+			lock.release()
+		}
+	}
+}
+
+// cacheGC holds the exclusive locks a cleanup takes on provider directories,
+// so each directory is locked once and kept until the cleanup is done.
+type cacheGC struct {
+	pluginCacheDir string
+	held           map[string]*providerLock
+	busy           map[string]bool
+}
+
+// newCacheGC prepares to lock provider directories under pluginCacheDir.
+func newCacheGC(pluginCacheDir string) *cacheGC {
+	return &cacheGC{pluginCacheDir: pluginCacheDir, held: make(map[string]*providerLock), busy: make(map[string]bool)}
+}
+
+// acquire reports whether the file at path may be removed or replaced: its
+// provider directory is locked for the cleanup, or it is not in one. The
+// first refusal for a directory is printed.
+func (gc *cacheGC) acquire(path string) bool {
+	dir := providerDirOf(gc.pluginCacheDir, path)
+	if dir == "" || gc.held[dir] != nil {
+		return true
+	}
+	if gc.busy[dir] {
+		return false
+	}
+	lock, err := lockProviderDir(dir, true)
+	if err != nil {
+		gc.busy[dir] = true
+		if err == errLockBusy {
+			fmt.Printf("Skipping %s: in use by a running terraform init.\n", dir)
+		} else {
+			logger.Warnf("skipping %s: %v", dir, err)
+		}
+		return false
+	}
+	gc.held[dir] = lock
+	return true
+}
+
+// release unlocks every directory the cleanup locked.
+func (gc *cacheGC) release() {
+	for dir, lock := range gc.held {
+		lock.release()
+		delete(gc.held, dir)
+	}
+}
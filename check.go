@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"tfvenv/i18n"
+)
+
+// Exit codes of tfvenv check. When several checks fail, the code of the first
+// failing check in this order is used.
+const (
+	checkExitNotFound    = 2
+	checkExitBinaries    = 3
+	checkExitConfig      = 4
+	checkExitLocked      = 5
+	checkExitCredentials = 6
+	checkExitBackend     = 7
+)
+
+// checkResult is a doctor check tagged with the exit code it fails with.
+type checkResult struct {
+	doctorResult
+	ExitCode int `json:"-"`
+}
+
+// checkReport is the JSON form of a check run.
+type checkReport struct {
+	Environment string            `json:"environment"`
+	Passed      bool              `json:"passed"`
+	ExitCode    int               `json:"exit_code"`
+	Checks      []checkReportItem `json:"checks"`
+}
+
+// checkReportItem is one check in a checkReport.
+type checkReportItem struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+	Hint   string `json:"hint,omitempty"`
+}
+
+// checkCmd runs the environment health checks meant to gate CI pipelines.
+func checkCmd() *cobra.Command {
+	var backend, jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "check <env-name>",
+		Short: "Check that an environment is ready to use, exiting non-zero if it is not",
+		Long: `Check an environment's binaries, configuration, lock and cloud credentials,
+and with --backend whether its S3 state bucket and DynamoDB lock table are
+reachable. Warnings do not fail the check. The exit code identifies the
+first failing check:
+
+  0  all checks passed
+  2  the environment does not exist
+  3  a binary is missing or does not run
+  4  the configuration is invalid
+  5  the environment is locked
+  6  cloud credentials are unavailable
+  7  the remote backend is unreachable`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			// stdout carries the JSON report, so logs go elsewhere
+			if jsonOutput && os.Getenv("TFVENV_LOG_FILE") == "" {
+				logger.Out = os.Stderr
+			}
+			envName := args[0]
+			envDir := viper.GetString("env-dir")
+			envPath := filepath.Join(envDir, envName)
+			if _, err := os.Stat(envPath); os.IsNotExist(err) {
+				if jsonOutput {
+					printCheckReport(envName, []checkResult{{
+						doctorResult: doctorResult{Name: "environment", Status: doctorFail, Detail: "does not exist"},
+						ExitCode:     checkExitNotFound,
+					}}, checkExitNotFound)
+				} else {
+					i18n.Println("env.not_found", envName)
+				}
+				os.Exit(checkExitNotFound)
+			}
+
+			results := runEnvChecks(envPath, envName, backend)
+			exitCode := 0
+			for _, result := range results {
+				if result.Status == doctorFail {
+					exitCode = result.ExitCode
+					break
+				}
+			}
+
+			if jsonOutput {
+				printCheckReport(envName, results, exitCode)
+			} else {
+				for _, result := range results {
+					fmt.Printf("[%-4s] %s: %s\n", strings.ToUpper(result.Status), result.Name, result.Detail)
+					if result.Hint != "" {
+						fmt.Printf("       %s\n", result.Hint)
+					}
+				}
+				if exitCode == 0 {
+					fmt.Println("PASS")
+				} else {
+					fmt.Println("FAIL")
+				}
+			}
+
+			if exitCode != 0 {
+				logger.Errorf("check failed for %s with exit code %d", envName, exitCode)
+				os.Exit(exitCode)
+			}
+			logger.Infof("check passed for %s", envName)
+		},
+	}
+
+	cmd.Flags().BoolVar(&backend, "backend", false, "Also check that the S3 state bucket and DynamoDB lock table are reachable")
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the report as JSON")
+	return cmd
+}
+
+// runEnvChecks runs the checks in exit code order.
+func runEnvChecks(envPath, envName string, backend bool) []checkResult {
+	results := []checkResult{
+		{checkDoctorBinary(envPath, envTool(envPath, envName)), checkExitBinaries},
+		{checkDoctorTerragrunt(envPath, envName), checkExitBinaries},
+	}
+
+	configPath := filepath.Join(envPath, "config", envName, tfvenvrcFileName)
+	configResult := doctorResult{Name: "config", Status: doctorOK, Detail: configPath}
+	problems, _, err := validateConfigFile(configPath)
+	switch {
+	case err != nil:
+		configResult.Status = doctorFail
+		configResult.Detail = err.Error()
+	case len(problems) > 0:
+		configResult.Status = doctorFail
+		configResult.Detail = strings.Join(problems, "; ")
+		configResult.Hint = fmt.Sprintf("Run 'tfvenv config validate %s' for details.", envName)
+	}
+	results = append(results, checkResult{configResult, checkExitConfig}, checkResult{checkEnvLock(envPath), checkExitLocked})
+
+	config, err := readConfig(configPath)
+	if err != nil {
+		return results
+	}
+	results = append(results, checkResult{checkPinnedVersions(envPath, envName, config), checkExitBinaries})
+	results = append(results, checkResult{checkDoctorAWS(config), checkExitCredentials})
+	if backend {
+		results = append(results, checkResult{checkBackend(envName, config), checkExitBackend})
+	}
+	return results
+}
+
+// checkPinnedVersions reports binaries that differ from the versions pinned in
+// .tfvenvrc. The drift only fails the check when ENFORCE_VERSIONS is set.
+func checkPinnedVersions(envPath, envName string, config Config) doctorResult {
+	result := doctorResult{Name: "versions", Status: doctorOK, Detail: "installed binaries match the pinned versions"}
+	drift := versionDrift(envPath, envName, config)
+	if len(drift) == 0 {
+		return result
+	}
+	result.Status = doctorWarn
+	if config.EnforceVersions {
+		result.Status = doctorFail
+	}
+	result.Detail = strings.Join(drift, "; ")
+	result.Hint = fmt.Sprintf("Run 'tfvenv --env-dir %s upgrade --sync --group %s' to reinstall the pinned versions.", filepath.Dir(envPath), envName)
+	return result
+}
+
+// checkEnvLock fails when the environment is locked.
+func checkEnvLock(envPath string) doctorResult {
+	result := doctorResult{Name: "lock"}
+	info, err := os.Stat(filepath.Join(envPath, lockFileName))
+	if os.IsNotExist(err) {
+		result.Status = doctorOK
+		result.Detail = "not locked"
+		if meta, err := loadEnvMetadata(envPath); err == nil && meta.ReadOnly != nil {
+			result.Detail = fmt.Sprintf("not locked, read-only since %s", meta.ReadOnly.Since.Format(time.RFC3339))
+		}
+		return result
+	}
+	if err != nil {
+		result.Status = doctorFail
+		result.Detail = fmt.Sprintf("failed to read lock: %v", err)
+		return result
+	}
+	result.Status = doctorFail
+	result.Detail = fmt.Sprintf("locked since %s", info.ModTime().UTC().Format(time.RFC3339))
+	result.Hint = fmt.Sprintf("Run 'tfvenv unlock %s' once the lock holder has finished.", filepath.Base(envPath))
+	return result
+}
+
+// checkBackend verifies that the S3 state bucket, and the DynamoDB lock table
+// when one is configured, can be reached with the environment's credentials.
+func checkBackend(envName string, config Config) doctorResult {
+	result := doctorResult{Name: "backend"}
+	if config.S3StateBucket == "" {
+		result.Status = doctorOK
+		result.Detail = "no S3_STATE_BUCKET configured, skipped"
+		return result
+	}
+
+	sess, err := newAWSSession(config)
+	if err != nil {
+		result.Status = doctorFail
+		result.Detail = fmt.Sprintf("failed to load AWS configuration: %v", err)
+		return result
+	}
+	if _, err := s3.New(sess).HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(config.S3StateBucket)}); err != nil {
+		result.Status = doctorFail
+		result.Detail = fmt.Sprintf("state bucket %s is not reachable: %v", config.S3StateBucket, err)
+		result.Hint = fmt.Sprintf("Run 'tfvenv bootstrap-backend %s --verify-only' to check the backend setup.", envName)
+		return result
+	}
+	result.Detail = "state bucket " + config.S3StateBucket
+	if config.DynamoDBTable != "" {
+		_, err := dynamodb.New(sess).DescribeTable(&dynamodb.DescribeTableInput{TableName: aws.String(config.DynamoDBTable)})
+		if err != nil {
+			result.Status = doctorFail
+			result.Detail = fmt.Sprintf("lock table %s is not reachable: %v", config.DynamoDBTable, err)
+			return result
+		}
+		result.Detail += ", lock table " + config.DynamoDBTable
+	}
+	result.Status = doctorOK
+	result.Detail += " reachable"
+	return result
+}
+
+// printCheckReport prints the results as JSON.
+func printCheckReport(envName string, results []checkResult, exitCode int) {
+	report := checkReport{Environment: envName, Passed: exitCode == 0, ExitCode: exitCode}
+	for _, result := range results {
+		report.Checks = append(report.Checks, checkReportItem{
+			Name:   result.Name,
+			Status: result.Status,
+			Detail: result.Detail,
+			Hint:   result.Hint,
+		})
+	}
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+}
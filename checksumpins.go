@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// anyPlatform is the key of a checksum pin given without a platform.
+const anyPlatform = "*"
+
+// parseChecksumPins parses TF_SHA256 and TG_SHA256 values of the form
+// "linux_amd64=<sha256>,darwin_arm64=<sha256>", by platform. A digest given
+// without a platform applies to every platform.
+func parseChecksumPins(value string) (map[string]string, error) {
+	pins := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		platform, digest := anyPlatform, entry
+		if parts := strings.SplitN(entry, "=", 2); len(parts) == 2 {
+			platform, digest = strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+			if strings.Count(platform, "_") != 1 || strings.HasPrefix(platform, "_") || strings.HasSuffix(platform, "_") {
+				return nil, fmt.Errorf("invalid platform %q in %q, expected <os>_<arch> such as linux_amd64", platform, entry)
+			}
+		}
+		if _, err := hex.DecodeString(digest); err != nil || len(digest) != 64 {
+			return nil, fmt.Errorf("invalid sha256 %q, expected 64 hexadecimal digits", digest)
+		}
+		if _, ok := pins[platform]; ok {
+			return nil, fmt.Errorf("more than one sha256 for %s", platform)
+		}
+		pins[platform] = strings.ToLower(digest)
+	}
+	return pins, nil
+}
+
+// checksumPinKey returns the .tfvenvrc key pinning the downloads of tool, and
+// its value and the version it applies to in config.
+func checksumPinKey(config Config, tool string) (string, string, string) {
+	if tool == "terragrunt" {
+		return "TG_SHA256", config.TgSHA256, config.TgVersion
+	}
+	return "TF_SHA256", config.TfSHA256, config.TfVersion
+}
+
+// pinnedChecksum returns the sha256 the environment's .tfvenvrc expects for
+// the download of tool at version on this platform, or "" when it pins none.
+// Pins apply only to the version TF_VERSION or TG_VERSION names.
+func pinnedChecksum(config Config, tool, version string) (string, error) {
+	key, value, pinned := checksumPinKey(config, tool)
+	if value == "" {
+		return "", nil
+	}
+	if pinned != version {
+		logger.Infof("%s pins %s %s, not %s; verifying against the published checksums only", key, tool, pinned, version)
+		return "", nil
+	}
+	pins, err := parseChecksumPins(value)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", key, err)
+	}
+	platform := runtime.GOOS + "_" + runtime.GOARCH
+	if digest, ok := pins[platform]; ok {
+		return digest, nil
+	}
+	if digest, ok := pins[anyPlatform]; ok {
+		return digest, nil
+	}
+	logger.Warnf("%s pins no sha256 for %s; verifying %s %s against the published checksums only", key, platform, tool, version)
+	return "", nil
+}
+
+// envChecksumPin returns the pinned sha256 for installing tool at version
+// into binDir, from the .tfvenvrc of the environment binDir belongs to. An
+// environment without a readable .tfvenvrc pins nothing.
+func envChecksumPin(binDir, tool, version string) (string, error) {
+	envPath := filepath.Dir(binDir)
+	envName := filepath.Base(envPath)
+	if !fileExists(filepath.Join(envPath, "config", envName, tfvenvrcFileName)) {
+		return "", nil
+	}
+	config, err := loadEnvConfig(envPath, envName)
+	if err != nil {
+		logger.Warnf("not checking pinned checksums: %v", err)
+		return "", nil
+	}
+	return pinnedChecksum(config, tool, version)
+}
+
+// verifyPinnedChecksum checks a download against the sha256 committed in
+// .tfvenvrc, on top of the published checksums, so that a release re-tagged
+// upstream or altered on a mirror is refused.
+func verifyPinnedChecksum(url, pinned, actual string) error {
+	if pinned == "" {
+		return nil
+	}
+	if !strings.EqualFold(actual, pinned) {
+		return fmt.Errorf("checksum mismatch for %s: .tfvenvrc pins %s, got %s", url, pinned, actual)
+	}
+	logger.Infof("verified %s against the pinned sha256", url)
+	return nil
+}
+
+// verifyPinnedFile checks a file, such as a download copied from the artifact
+// cache, against a pinned sha256 and removes it when it does not match.
+func verifyPinnedFile(url, pinned, path string) error {
+	if pinned == "" {
+		return nil
+	}
+	digest, err := fileSHA256(path)
+	if err != nil {
+		return fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	if err := verifyPinnedChecksum(url, pinned, digest); err != nil {
+		os.Remove(path)
+		return err
+	}
+	return nil
+}
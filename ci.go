@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"tfvenv/i18n"
+)
+
+// ciEnvDir is the directory, relative to the repository root, in which pipelines create environments.
+const ciEnvDir = ".tfvenv-envs"
+
+// ciPipeline holds the values rendered into a pipeline template.
+type ciPipeline struct {
+	EnvName           string
+	Tool              string
+	TerraformVersion  string
+	TerragruntVersion string
+	WorkingDir        string
+	SnapName          string
+	EnvDir            string
+}
+
+// ciProviders maps each supported CI system to its template and default output path.
+var ciProviders = map[string]struct {
+	Template string
+	Output   func(envName string) string
+}{
+	"github": {
+		Template: githubPipelineTemplate,
+		Output: func(envName string) string {
+			return filepath.Join(".github", "workflows", fmt.Sprintf("tfvenv-%s.yml", envName))
+		},
+	},
+	"gitlab": {
+		Template: gitlabPipelineTemplate,
+		Output:   func(string) string { return ".gitlab-ci.yml" },
+	},
+	"azure": {
+		Template: azurePipelineTemplate,
+		Output:   func(string) string { return "azure-pipelines.yml" },
+	},
+}
+
+// The setup and plan scripts are shared by every provider: build tfvenv, create
+// the environment with its pinned versions and optionally fetch a snap, then
+// validate and plan with the environment's own binaries. Tool is the CLI the
+// environment runs, terraform or tofu.
+const ciSetupScript = `git clone --depth 1 https://github.com/rickcollette/tfvenv.git /tmp/tfvenv-src
+(cd /tmp/tfvenv-src && go build -o "$HOME/.local/bin/tfvenv" .)
+export PATH="$HOME/.local/bin:$PATH"
+mkdir -p {{.EnvDir}}
+tfvenv --env-dir {{.EnvDir}} create {{.EnvName}} {{.TerraformVersion}} {{.TerragruntVersion}} --tool {{.Tool}}
+{{- if .SnapName}}
+tfvenv --env-dir {{.EnvDir}} snap get {{.EnvName}} {{.SnapName}}
+{{- end}}`
+
+const ciPlanScript = `source {{.EnvDir}}/{{.EnvName}}/bin/activate.sh
+{{.Tool}} -chdir={{.WorkingDir}} init -input=false
+{{.Tool}} -chdir={{.WorkingDir}} validate
+{{.Tool}} -chdir={{.WorkingDir}} plan -input=false -lock-timeout=5m`
+
+const githubPipelineTemplate = `# Generated by tfvenv ci generate github
+name: tfvenv {{.EnvName}}
+
+on:
+  pull_request:
+  push:
+    branches: [main]
+
+jobs:
+  plan:
+    runs-on: ubuntu-latest
+    env:
+      # Store these as repository secrets; GitHub masks them in logs.
+      AWS_ACCESS_KEY_ID: ${{"{{"}} secrets.AWS_ACCESS_KEY_ID {{"}}"}}
+      AWS_SECRET_ACCESS_KEY: ${{"{{"}} secrets.AWS_SECRET_ACCESS_KEY {{"}}"}}
+      AWS_REGION: ${{"{{"}} vars.AWS_REGION {{"}}"}}
+      REMOTE_SNAP_AUTH: ${{"{{"}} secrets.REMOTE_SNAP_AUTH {{"}}"}}
+    steps:
+      - uses: actions/checkout@v4
+      - uses: actions/setup-go@v5
+        with:
+          go-version: stable
+      - name: Cache Terraform plugins
+        uses: actions/cache@v4
+        with:
+          path: ~/.cache/tfvenv/plugin-cache
+          key: tfvenv-plugins-{{.TerraformVersion}}-${{"{{"}} hashFiles('**/.terraform.lock.hcl') {{"}}"}}
+      - name: Create environment
+        run: |
+{{indent 10 .Setup}}
+      - name: Validate and plan
+        shell: bash
+        run: |
+{{indent 10 .Plan}}
+`
+
+const gitlabPipelineTemplate = `# Generated by tfvenv ci generate gitlab
+# Define AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and REMOTE_SNAP_AUTH as
+# masked CI/CD variables in the project settings.
+stages:
+  - plan
+
+tfvenv-{{.EnvName}}-plan:
+  stage: plan
+  image: golang:latest
+  variables:
+    TF_IN_AUTOMATION: "true"
+  cache:
+    key:
+      files:
+        - {{.WorkingDir}}/.terraform.lock.hcl
+      prefix: tfvenv-plugins-{{.TerraformVersion}}
+    paths:
+      - .tfvenv-plugin-cache/
+  before_script:
+    - mkdir -p "$HOME/.cache/tfvenv" .tfvenv-plugin-cache
+    - ln -sfn "$CI_PROJECT_DIR/.tfvenv-plugin-cache" "$HOME/.cache/tfvenv/plugin-cache"
+  script:
+    - |
+{{indent 6 .Setup}}
+{{indent 6 .Plan}}
+`
+
+const azurePipelineTemplate = `# Generated by tfvenv ci generate azure
+# Define AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and REMOTE_SNAP_AUTH as
+# secret pipeline variables; secrets must be mapped into env explicitly.
+trigger:
+  - main
+
+pool:
+  vmImage: ubuntu-latest
+
+steps:
+  - task: Cache@2
+    displayName: Cache Terraform plugins
+    inputs:
+      key: 'tfvenv-plugins | "{{.TerraformVersion}}" | **/.terraform.lock.hcl'
+      path: $(HOME)/.cache/tfvenv/plugin-cache
+  - bash: |
+{{indent 6 .Setup}}
+{{indent 6 .Plan}}
+    displayName: tfvenv {{.EnvName}} plan
+    env:
+      AWS_ACCESS_KEY_ID: $(AWS_ACCESS_KEY_ID)
+      AWS_SECRET_ACCESS_KEY: $(AWS_SECRET_ACCESS_KEY)
+      AWS_REGION: $(AWS_REGION)
+      REMOTE_SNAP_AUTH: $(REMOTE_SNAP_AUTH)
+`
+
+// ciCmd groups the CI integration subcommands.
+func ciCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ci",
+		Short: "Generate CI pipeline definitions for an environment",
+	}
+	cmd.AddCommand(ciGenerateCmd())
+	return cmd
+}
+
+// ciGenerateCmd writes a pipeline file for the given CI system.
+func ciGenerateCmd() *cobra.Command {
+	var outputFile, workingDir, snapName string
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:       "generate <github|gitlab|azure> <env-name>",
+		Short:     "Generate a pipeline that creates the environment, validates and plans",
+		Args:      cobra.ExactArgs(2),
+		ValidArgs: []string{"github", "gitlab", "azure"},
+		Run: func(cmd *cobra.Command, args []string) {
+			provider := strings.ToLower(args[0])
+			envName := args[1]
+			envDir := viper.GetString("env-dir")
+			envPath := filepath.Join(envDir, envName)
+
+			spec, ok := ciProviders[provider]
+			if !ok {
+				fmt.Printf("Unsupported CI system '%s'. Use github, gitlab or azure.\n", provider)
+				os.Exit(1)
+			}
+
+			tfVersion, tgVersion, err := pinnedToolVersions(envPath, envName)
+			if err != nil {
+				logger.Errorf("error resolving versions for %s: %v", envName, err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+
+			content, err := renderPipeline(spec.Template, ciPipeline{
+				EnvName:           envName,
+				Tool:              envTool(envPath, envName),
+				TerraformVersion:  tfVersion,
+				TerragruntVersion: tgVersion,
+				WorkingDir:        workingDir,
+				SnapName:          snapName,
+				EnvDir:            ciEnvDir,
+			})
+			if err != nil {
+				logger.Errorf("error rendering %s pipeline: %v", provider, err)
+				fmt.Printf("Error rendering pipeline: %v\n", err)
+				os.Exit(1)
+			}
+
+			if outputFile == "" {
+				outputFile = spec.Output(envName)
+			}
+			if fileExists(outputFile) && !force {
+				i18n.Println("file.exists_use_force", outputFile)
+				os.Exit(1)
+			}
+			if err := os.MkdirAll(filepath.Dir(outputFile), 0755); err != nil {
+				logger.Errorf("error creating %s: %v", filepath.Dir(outputFile), err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			if err := os.WriteFile(outputFile, content, 0644); err != nil {
+				logger.Errorf("error writing %s: %v", outputFile, err)
+				fmt.Printf("Error writing pipeline: %v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Generated %s pipeline for '%s' at %s\n", provider, envName, outputFile)
+			logger.Infof("generated %s pipeline for %s at %s", provider, envName, outputFile)
+		},
+	}
+
+	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "Pipeline file to write (defaults to the CI system's standard location)")
+	cmd.Flags().StringVar(&workingDir, "working-dir", ".", "Directory containing the Terraform configuration, relative to the repository root")
+	cmd.Flags().StringVar(&snapName, "snap", "", "Snap to fetch after creating the environment")
+	cmd.Flags().BoolVar(&force, "force", false, "Overwrite an existing pipeline file")
+	return cmd
+}
+
+// pinnedToolVersions returns the Terraform (or OpenTofu) and Terragrunt versions
+// installed in the environment, falling back to TF_VERSION and TG_VERSION from .tfvenvrc.
+// Terragrunt resolves to "none" when the environment does not use it.
+func pinnedToolVersions(envPath, envName string) (string, string, error) {
+	configPath := filepath.Join(envPath, "config", envName, tfvenvrcFileName)
+	config, err := readConfig(configPath)
+	if err != nil {
+		logger.Warnf("error reading %s: %v", configPath, err)
+	}
+
+	tool := resolveTool(config.Tool, "")
+	if meta, err := loadEnvMetadata(envPath); err == nil {
+		tool = resolveTool(config.Tool, meta.Tool)
+	}
+	tfVersion, err := getBinaryVersion(envBinaryPath(envPath, tool), tool)
+	if err != nil || tfVersion == "" {
+		tfVersion = config.TfVersion
+	}
+	if tfVersion == "" {
+		return "", "", fmt.Errorf("no %s version installed or configured for %s", toolDisplayName(tool), envName)
+	}
+
+	tgVersion := "none"
+	if fileExists(envBinaryPath(envPath, "terragrunt")) {
+		if v, err := getBinaryVersion(envBinaryPath(envPath, "terragrunt"), "terragrunt"); err == nil && v != "" {
+			tgVersion = v
+		}
+	} else if config.TgVersion != "" {
+		tgVersion = config.TgVersion
+	}
+	return tfVersion, tgVersion, nil
+}
+
+// renderPipeline renders the shared scripts and then the provider template.
+func renderPipeline(pipelineTemplate string, data ciPipeline) ([]byte, error) {
+	setup, err := executeTemplate(ciSetupScript, data, nil)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := executeTemplate(ciPlanScript, data, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	funcs := template.FuncMap{
+		"indent": func(spaces int, text string) string {
+			pad := strings.Repeat(" ", spaces)
+			return pad + strings.ReplaceAll(text, "\n", "\n"+pad)
+		},
+	}
+	out, err := executeTemplate(pipelineTemplate, struct {
+		ciPipeline
+		Setup string
+		Plan  string
+	}{data, setup, plan}, funcs)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(out), nil
+}
+
+// executeTemplate parses and executes a text template.
+func executeTemplate(text string, data interface{}, funcs template.FuncMap) (string, error) {
+	tmpl, err := template.New("pipeline").Funcs(funcs).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to render template: %w", err)
+	}
+	return buf.String(), nil
+}
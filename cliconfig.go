@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// cliConfigFileName is the per-environment Terraform CLI configuration exported as TF_CLI_CONFIG_FILE.
+const cliConfigFileName = ".terraformrc"
+
+// updateCLIConfig parses the environment's CLI configuration, lets edit change it,
+// and writes it back. Settings managed by other commands are preserved, and the
+// file is removed once nothing is left in it.
+func updateCLIConfig(envPath string, edit func(body *hclwrite.Body)) error {
+	path := filepath.Join(envPath, cliConfigFileName)
+
+	file := hclwrite.NewEmptyFile()
+	if data, err := os.ReadFile(path); err == nil {
+		parsed, diags := hclwrite.ParseConfig(data, path, hcl.Pos{Line: 1, Column: 1})
+		if diags.HasErrors() {
+			return fmt.Errorf("failed to parse %s: %s", path, diags.Error())
+		}
+		file = parsed
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	edit(file.Body())
+
+	content := hclwrite.Format(file.Bytes())
+	if strings.TrimSpace(string(content)) == "" {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", path, err)
+		}
+		return nil
+	}
+	if err := writeSecretFile(path, content); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// applyCLIConfig writes the CLI settings declared in .tfvenvrc into the
+// environment's .terraformrc. A mirror or credentials helper .tfvenvrc does
+// not declare is left as 'registry use' or 'credentials set' configured it;
+// disable_checkpoint follows CLI_DISABLE_CHECKPOINT.
+func applyCLIConfig(envPath string, config Config) error {
+	return updateCLIConfig(envPath, func(body *hclwrite.Body) {
+		if config.CLIProviderMirror != "" {
+			mirrorURL := config.CLIProviderMirror
+			if !strings.HasSuffix(mirrorURL, "/") {
+				mirrorURL += "/"
+			}
+			removeCLIConfigBlocks(body, "provider_installation")
+			mirror := body.AppendNewBlock("provider_installation", nil).Body().AppendNewBlock("network_mirror", nil).Body()
+			mirror.SetAttributeValue("url", cty.StringVal(mirrorURL))
+		}
+		if config.CLICredentialsHelper != "" {
+			// Terraform allows a single credentials_helper block
+			removeCLIConfigBlocks(body, "credentials_helper")
+			body.AppendNewBlock("credentials_helper", []string{config.CLICredentialsHelper})
+		}
+		if config.CLIDisableCheckpoint {
+			body.SetAttributeValue("disable_checkpoint", cty.True)
+		} else {
+			body.RemoveAttribute("disable_checkpoint")
+		}
+	})
+}
+
+// declaresCLIConfig reports whether .tfvenvrc sets anything applyCLIConfig writes.
+func declaresCLIConfig(config Config) bool {
+	return config.CLIProviderMirror != "" || config.CLICredentialsHelper != "" || config.CLIDisableCheckpoint
+}
+
+// removeCLIConfigBlocks removes every block of the given type, and labels when provided.
+func removeCLIConfigBlocks(body *hclwrite.Body, blockType string, labels ...string) {
+	for _, block := range body.Blocks() {
+		if block.Type() != blockType {
+			continue
+		}
+		if len(labels) > 0 && strings.Join(block.Labels(), "\x00") != strings.Join(labels, "\x00") {
+			continue
+		}
+		body.RemoveBlock(block)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/spf13/cobra"
+
+	"tfvenv/i18n"
+)
+
+// Markers around the lines completion install adds to a startup file. They
+// differ from those of init so that each block can be updated on its own.
+const (
+	completionBlockBegin = "# >>> tfvenv completion >>>"
+	completionBlockEnd   = "# <<< tfvenv completion <<<"
+)
+
+// completionShells are the shells tfvenv generates completions for.
+var completionShells = []string{"bash", "zsh", "fish", "powershell"}
+
+// completionInstallCmd writes the completion script of a shell to where the
+// shell looks for it, and loads it from the shell's startup file when the
+// shell does not find it by itself.
+func completionInstallCmd(rootCmd *cobra.Command) *cobra.Command {
+	var uninstall, dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "install [bash|zsh|fish|powershell]",
+		Short: "Install the completion script for your shell",
+		Long: `Write the completion script for the shell, detected from $SHELL when it is
+not given, to the shell's per-user completion directory, and add the lines
+that load it to the shell's startup file between tfvenv markers. Running it
+again rewrites the script and replaces the lines. With --uninstall, the
+script and the lines are removed.`,
+		Args: cobra.MatchAll(
+			cobra.MaximumNArgs(1),
+			cobra.OnlyValidArgs,
+		),
+		ValidArgs: completionShells,
+		Run: func(cmd *cobra.Command, args []string) {
+			shell := detectShell()
+			if len(args) == 1 {
+				shell = args[0]
+			}
+			target, err := completionTargetFor(shell)
+			if err != nil {
+				logger.Errorf("error locating %s completions: %v", shell, err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+
+			if uninstall {
+				err = uninstallCompletion(target, dryRun)
+			} else {
+				err = installCompletion(rootCmd, shell, target, dryRun)
+			}
+			if err != nil {
+				logger.Errorf("error updating %s completions: %v", shell, err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	addDryRunFlag(cmd, &dryRun)
+	cmd.Flags().BoolVar(&uninstall, "uninstall", false, "Remove the completion script and the lines that load it")
+	return cmd
+}
+
+// completionTarget is where a shell's completion script goes and, for shells
+// that do not load it from there by themselves, the startup file lines that
+// load it.
+type completionTarget struct {
+	File   string
+	RCFile string
+	Block  string
+}
+
+// completionTargetFor returns where the completion script of shell belongs
+// on this platform.
+func completionTargetFor(shell string) (completionTarget, error) {
+	home := userDirs.Home
+	if home == "" {
+		return completionTarget{}, fmt.Errorf("there is no home directory to install completions in; set HOME")
+	}
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		dataHome = filepath.Join(home, ".local", "share")
+	}
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if configHome == "" {
+		configHome = filepath.Join(home, ".config")
+	}
+
+	switch shell {
+	case "bash":
+		// bash-completion loads this directory on demand; the startup file
+		// sources it for shells without bash-completion
+		file := filepath.Join(dataHome, "bash-completion", "completions", "tfvenv")
+		rc := filepath.Join(home, ".bashrc")
+		if runtime.GOOS == "darwin" {
+			rc = filepath.Join(home, ".bash_profile")
+		}
+		return completionTarget{
+			File:   file,
+			RCFile: rc,
+			Block:  fmt.Sprintf("[ -f %s ] && source %s\n", escapeBash(file), escapeBash(file)),
+		}, nil
+	case "zsh":
+		dir := os.Getenv("ZDOTDIR")
+		if dir == "" {
+			dir = home
+		}
+		funcDir := filepath.Join(dir, ".zfunc")
+		return completionTarget{
+			File:   filepath.Join(funcDir, "_tfvenv"),
+			RCFile: filepath.Join(dir, ".zshrc"),
+			Block:  fmt.Sprintf("fpath=(%s $fpath)\nautoload -U compinit && compinit\n", escapeBash(funcDir)),
+		}, nil
+	case "fish":
+		// fish autoloads its completions directory
+		return completionTarget{File: filepath.Join(configHome, "fish", "completions", "tfvenv.fish")}, nil
+	case "powershell":
+		profileDir := filepath.Join(configHome, "powershell")
+		if runtime.GOOS == "windows" {
+			profileDir = filepath.Join(home, "Documents", "PowerShell")
+		}
+		file := filepath.Join(profileDir, "tfvenv-completion.ps1")
+		return completionTarget{
+			File:   file,
+			RCFile: filepath.Join(profileDir, "Microsoft.PowerShell_profile.ps1"),
+			Block:  fmt.Sprintf(". \"%s\"\n", escapePowerShell(file)),
+		}, nil
+	}
+	return completionTarget{}, fmt.Errorf("unsupported shell %q (use bash, zsh, fish or powershell)", shell)
+}
+
+// writeCompletion writes the completion script of shell to w.
+func writeCompletion(rootCmd *cobra.Command, shell string, w io.Writer) error {
+	switch shell {
+	case "bash":
+		return rootCmd.GenBashCompletion(w)
+	case "zsh":
+		return rootCmd.GenZshCompletion(w)
+	case "fish":
+		return rootCmd.GenFishCompletion(w, true)
+	case "powershell":
+		return rootCmd.GenPowerShellCompletionWithDesc(w)
+	}
+	return fmt.Errorf("unsupported shell %q (use bash, zsh, fish or powershell)", shell)
+}
+
+// installCompletion writes the completion script and the startup file lines
+// of target, replacing earlier ones.
+func installCompletion(rootCmd *cobra.Command, shell string, target completionTarget, dryRun bool) error {
+	var script bytes.Buffer
+	if err := writeCompletion(rootCmd, shell, &script); err != nil {
+		return fmt.Errorf("failed to generate the %s completion script: %w", shell, err)
+	}
+	if dryRun {
+		printDryRun("would write %s", target.File)
+		if target.RCFile != "" {
+			printDryRun("would add the tfvenv completion block to %s", target.RCFile)
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target.File), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(target.File), err)
+	}
+	if err := os.WriteFile(target.File, script.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", target.File, err)
+	}
+	summary.fileWritten(target.File)
+	fmt.Printf("Wrote %s\n", target.File)
+
+	if target.RCFile != "" {
+		if err := writeMarkedBlock(target.RCFile, completionBlockBegin, completionBlockEnd, target.Block); err != nil {
+			return err
+		}
+		summary.fileWritten(target.RCFile)
+		fmt.Printf("Updated %s\n", target.RCFile)
+	}
+	fmt.Println("Open a new shell to use the completions.")
+	return nil
+}
+
+// uninstallCompletion removes the completion script and the startup file
+// lines of target.
+func uninstallCompletion(target completionTarget, dryRun bool) error {
+	if dryRun {
+		printDryRun("would remove %s", target.File)
+		if target.RCFile != "" {
+			printDryRun("would remove the tfvenv completion block from %s", target.RCFile)
+		}
+		return nil
+	}
+
+	removed := false
+	if err := os.Remove(target.File); err == nil {
+		fmt.Printf("Removed %s\n", target.File)
+		removed = true
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove %s: %w", target.File, err)
+	}
+	if target.RCFile != "" {
+		found, err := removeMarkedBlock(target.RCFile, completionBlockBegin, completionBlockEnd)
+		if err != nil {
+			return err
+		}
+		if found {
+			summary.fileWritten(target.RCFile)
+			fmt.Printf("Removed the tfvenv completion block from %s\n", target.RCFile)
+			removed = true
+		}
+	}
+	if !removed {
+		fmt.Println("No tfvenv completions were installed.")
+	}
+	return nil
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	version "github.com/hashicorp/go-version"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"tfvenv/i18n"
+)
+
+// configCmd groups the .tfvenvrc management subcommands.
+func configCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect and validate environment configuration",
+	}
+	cmd.AddCommand(configValidateCmd())
+	cmd.AddCommand(configShowCmd())
+	return cmd
+}
+
+// baseConfigDirName is the config directory under env-dir whose .tfvenvrc
+// every environment there inherits.
+const baseConfigDirName = "_base"
+
+// secretConfigKeys are the .tfvenvrc keys that config show masks.
+var secretConfigKeys = map[string]bool{
+	"ACCESS_KEY":       true,
+	"SECRET_KEY":       true,
+	"REMOTE_SNAP_AUTH": true,
+}
+
+// baseConfigPath returns the base .tfvenvrc inherited by the environment
+// whose .tfvenvrc is at configPath: <env-dir>/config/_base/.tfvenvrc.
+func baseConfigPath(configPath string) string {
+	envPath := filepath.Dir(filepath.Dir(filepath.Dir(configPath)))
+	return filepath.Join(filepath.Dir(envPath), "config", baseConfigDirName, tfvenvrcFileName)
+}
+
+// readTfvenvrc reads a .tfvenvrc into v on top of the base .tfvenvrc, when
+// there is one, so the environment's keys override the inherited ones.
+func readTfvenvrc(v *viper.Viper, configPath string) error {
+	v.SetConfigType("env")
+	base := baseConfigPath(configPath)
+	if base == configPath || !fileExists(base) {
+		v.SetConfigFile(configPath)
+		return v.ReadInConfig()
+	}
+	v.SetConfigFile(base)
+	if err := v.ReadInConfig(); err != nil {
+		return fmt.Errorf("failed to read base config %s: %w", base, err)
+	}
+	v.SetConfigFile(configPath)
+	return v.MergeInConfig()
+}
+
+// configShowCmd prints an environment's .tfvenvrc keys, or with --effective
+// the keys in effect after inheriting from the base config.
+func configShowCmd() *cobra.Command {
+	var effective bool
+
+	cmd := &cobra.Command{
+		Use:   "show <env-name>",
+		Short: "Print the .tfvenvrc keys of the specified environment",
+		Long: `Print the keys of an environment's .tfvenvrc. With --effective, print the
+keys in effect: those of the base config (<env-dir>/config/_base/.tfvenvrc)
+overridden by the environment's own, each marked with the file it comes
+from. Credentials are masked.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envDir := viper.GetString("env-dir")
+			if _, err := os.Stat(filepath.Join(envDir, envName)); os.IsNotExist(err) {
+				i18n.Println("env.not_found", envName)
+				os.Exit(1)
+			}
+			configPath := filepath.Join(envDir, envName, "config", envName, tfvenvrcFileName)
+
+			own, err := readConfigValues(configPath)
+			if err != nil {
+				logger.Errorf("error reading %s: %v", configPath, err)
+				i18n.Println("config.read_error", err)
+				os.Exit(1)
+			}
+			values := own
+			sources := make(map[string]string)
+			for key := range own {
+				sources[key] = configPath
+			}
+			if effective {
+				basePath := baseConfigPath(configPath)
+				if fileExists(basePath) {
+					base, err := readConfigValues(basePath)
+					if err != nil {
+						logger.Errorf("error reading %s: %v", basePath, err)
+						i18n.Println("config.read_error", err)
+						os.Exit(1)
+					}
+					for key, value := range base {
+						if _, overridden := own[key]; !overridden {
+							values[key] = value
+							sources[key] = basePath
+						}
+					}
+				}
+			}
+
+			keys := make([]string, 0, len(values))
+			for key := range values {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				value := values[key]
+				if secretConfigKeys[key] || isSensitiveKey(key) {
+					value = "******"
+				}
+				if effective {
+					fmt.Printf("%s=%s  # %s\n", key, value, sources[key])
+				} else {
+					fmt.Printf("%s=%s\n", key, value)
+				}
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&effective, "effective", false, "Include the keys inherited from the base config and show where each comes from")
+	return cmd
+}
+
+// readConfigValues returns the keys and values of a single .tfvenvrc file,
+// with upper-case keys.
+func readConfigValues(path string) (map[string]string, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("env")
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	values := make(map[string]string)
+	for _, key := range v.AllKeys() {
+		values[strings.ToUpper(key)] = v.GetString(key)
+	}
+	return values, nil
+}
+
+// configValidateCmd checks an environment's .tfvenvrc for invalid values.
+func configValidateCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "validate <env-name>",
+		Short: "Validate the .tfvenvrc of the specified environment",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envDir := viper.GetString("env-dir")
+			configPath := filepath.Join(envDir, envName, "config", envName, tfvenvrcFileName)
+
+			problems, warnings, err := validateConfigFile(configPath)
+			if err != nil {
+				logger.Errorf("error reading %s: %v", configPath, err)
+				i18n.Println("config.read_error", err)
+				os.Exit(1)
+			}
+			for _, warning := range warnings {
+				fmt.Printf("Warning: %s\n", warning)
+				githubAnnotate("warning", configPath, warning)
+			}
+			if len(problems) > 0 {
+				for _, problem := range problems {
+					fmt.Printf("Error: %s\n", problem)
+					githubAnnotate("error", configPath, problem)
+				}
+				logger.Errorf("%s has %d problem(s)", configPath, len(problems))
+				os.Exit(1)
+			}
+
+			fmt.Printf("%s is valid.\n", configPath)
+			logger.Infof("%s is valid", configPath)
+		},
+	}
+}
+
+// validateConfigFile parses a .tfvenvrc and returns the values that would break
+// other commands as problems, and unrecognised keys as warnings.
+func validateConfigFile(configPath string) ([]string, []string, error) {
+	v := viper.New()
+	if err := readTfvenvrc(v, configPath); err != nil {
+		return nil, nil, err
+	}
+
+	var config Config
+	var problems, warnings []string
+	if err := v.Unmarshal(&config); err != nil {
+		problems = append(problems, fmt.Sprintf("failed to parse values: %v", err))
+	}
+
+	known := configKeys()
+	for _, key := range v.AllKeys() {
+		upper := strings.ToUpper(key)
+		if !known[upper] && !strings.HasPrefix(upper, "ENV_VARS") && !isTFCLIArgsKey(upper) {
+			warnings = append(warnings, fmt.Sprintf("unknown key %s", upper))
+		}
+	}
+
+	checkVersion := func(key, value string, allowed ...string) {
+		if value == "" {
+			return
+		}
+		for _, a := range allowed {
+			if value == a {
+				return
+			}
+		}
+		if _, err := version.NewVersion(value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s %q is not a valid version", key, value))
+		}
+	}
+	checkVersion("TF_VERSION", config.TfVersion, "latest")
+	checkVersion("TG_VERSION", config.TgVersion, "latest", "none")
+	checkVersion("INFRACOST_VERSION", config.InfracostVersion)
+
+	if (config.AccessKey == "") != (config.SecretKey == "") {
+		problems = append(problems, "ACCESS_KEY and SECRET_KEY must be set together")
+	}
+	if config.AWSProfile != "" && config.AccessKey != "" {
+		warnings = append(warnings, "ACCESS_KEY and SECRET_KEY take precedence over AWS_PROFILE")
+	}
+	if config.AWSRegion != "" && config.Region != "" && config.AWSRegion != config.Region {
+		warnings = append(warnings, fmt.Sprintf("AWS_REGION %q differs from REGION %q; AWS_REGION is used", config.AWSRegion, config.Region))
+	}
+	if err := validateTool(strings.ToLower(strings.TrimSpace(config.Tool))); err != nil {
+		problems = append(problems, fmt.Sprintf("TOOL: %v", err))
+	}
+	if config.RemoteSnapType != "" && config.RemoteSnapType != "S3" {
+		problems = append(problems, fmt.Sprintf("REMOTE_SNAP_TYPE %q is not supported (only S3)", config.RemoteSnapType))
+	}
+	if config.RemoteSnapKey != "" {
+		if err := validateSnapKeyTemplate(config.RemoteSnapKey); err != nil {
+			problems = append(problems, fmt.Sprintf("REMOTE_SNAP_KEY: %v", err))
+		}
+	}
+	if config.SnapExpireDays < 0 {
+		problems = append(problems, "REMOTE_SNAP_EXPIRE_DAYS cannot be negative")
+	}
+	if config.SnapNoncurrentDays < 0 {
+		problems = append(problems, "REMOTE_SNAP_NONCURRENT_DAYS cannot be negative")
+	}
+	if config.SnapReplicaBucket == "" && (config.SnapReplicaRegion != "" || config.SnapReplicaProfile != "") {
+		problems = append(problems, "REMOTE_SNAP_REPLICA_REGION and REMOTE_SNAP_REPLICA_PROFILE need REMOTE_SNAP_REPLICA_BUCKET")
+	}
+	if config.SnapReplicaBucket != "" && config.SnapReplicaBucket == os.Getenv("REMOTE_SNAP_BUCKET") {
+		warnings = append(warnings, "REMOTE_SNAP_REPLICA_BUCKET is the same bucket as REMOTE_SNAP_BUCKET")
+	}
+	for _, tool := range []string{"terraform", "terragrunt"} {
+		key, value, pinned := checksumPinKey(config, tool)
+		if value == "" {
+			continue
+		}
+		if _, err := parseChecksumPins(value); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", key, err))
+		}
+		if !pinnedVersion(pinned) {
+			problems = append(problems, fmt.Sprintf("%s needs an exact version in %s", key, strings.Replace(key, "SHA256", "VERSION", 1)))
+		}
+	}
+	if config.Parallelism < 0 {
+		problems = append(problems, "PARALLELISM must not be negative")
+	}
+	if config.PluginCacheMaxSize != "" {
+		if _, err := parseSize(config.PluginCacheMaxSize); err != nil {
+			problems = append(problems, fmt.Sprintf("PLUGIN_CACHE_MAX_SIZE: %v", err))
+		}
+	}
+	envName := filepath.Base(filepath.Dir(configPath))
+	sample := envVarTemplateData{EnvName: envName, Parallelism: defaultTerraformParallelism}
+	if _, err := renderEnvVarTemplates(config.EnvVars, sample); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if _, err := renderEnvVarTemplates(tfCLIArgs(v), sample); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if config.CLIProviderMirror != "" {
+		if u, err := url.Parse(config.CLIProviderMirror); err != nil || u.Scheme != "https" || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("CLI_PROVIDER_MIRROR %q must be an https:// URL", config.CLIProviderMirror))
+		}
+	}
+	if config.CostThreshold < 0 {
+		problems = append(problems, "COST_THRESHOLD must not be negative")
+	}
+	if config.DynamoDBTable != "" && config.S3StateBucket == "" {
+		problems = append(problems, "DYNAMODB_TABLE requires S3_STATE_BUCKET")
+	}
+	if _, err := parseProviderPins(config.Providers); err != nil {
+		problems = append(problems, fmt.Sprintf("PROVIDERS: %v", err))
+	}
+
+	return problems, warnings, nil
+}
+
+// configKeys returns the .tfvenvrc keys understood by Config.
+func configKeys() map[string]bool {
+	keys := make(map[string]bool)
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		if tag := t.Field(i).Tag.Get("mapstructure"); tag != "" {
+			keys[tag] = true
+		}
+	}
+	return keys
+}
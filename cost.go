@@ -0,0 +1,218 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	infracostDownloadURL    = "https://github.com/infracost/infracost/releases/download/"
+	defaultInfracostVersion = "0.10.39"
+)
+
+// infracostBreakdown is the subset of `infracost breakdown --format json` output used by tfvenv.
+type infracostBreakdown struct {
+	Currency         string `json:"currency"`
+	TotalMonthlyCost string `json:"totalMonthlyCost"`
+	Projects         []struct {
+		Name      string `json:"name"`
+		Breakdown struct {
+			TotalMonthlyCost string `json:"totalMonthlyCost"`
+		} `json:"breakdown"`
+	} `json:"projects"`
+}
+
+// costCmd runs infracost against the environment's configuration
+func costCmd() *cobra.Command {
+	var infracostVersion string
+	var threshold float64
+
+	cmd := &cobra.Command{
+		Use:   "cost <env-name>",
+		Short: "Show an Infracost cost breakdown for the specified environment",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envDir := viper.GetString("env-dir")
+			envPath := filepath.Join(envDir, envName)
+			configDir := filepath.Join(envPath, "config", envName)
+			configPath := filepath.Join(configDir, tfvenvrcFileName)
+
+			// Pinned version and threshold come from the flags first, then .tfvenvrc
+			config, err := readConfig(configPath)
+			if err != nil {
+				logger.Warnf("error reading %s, using defaults: %v", configPath, err)
+			}
+			if infracostVersion == "" {
+				infracostVersion = config.InfracostVersion
+			}
+			if infracostVersion == "" {
+				infracostVersion = defaultInfracostVersion
+			}
+			if !cmd.Flags().Changed("threshold") {
+				threshold = config.CostThreshold
+			}
+
+			binDir := filepath.Join(envPath, "bin")
+			infracostBinary := envBinaryPath(envPath, "infracost")
+			if !fileExists(infracostBinary) {
+				fmt.Printf("Installing infracost %s...\n", infracostVersion)
+				if err := installInfracost(infracostVersion, binDir); err != nil {
+					logger.Errorf("infracost installation failed: %v", err)
+					fmt.Printf("Error installing infracost: %v\n", err)
+					os.Exit(1)
+				}
+			}
+
+			breakdown, err := runInfracost(infracostBinary, configDir)
+			if err != nil {
+				logger.Errorf("infracost failed: %v", err)
+				fmt.Printf("Error running infracost: %v\n", err)
+				os.Exit(1)
+			}
+
+			total, err := strconv.ParseFloat(breakdown.TotalMonthlyCost, 64)
+			if err != nil && breakdown.TotalMonthlyCost != "" {
+				logger.Warnf("could not parse total monthly cost %q: %v", breakdown.TotalMonthlyCost, err)
+			}
+
+			fmt.Printf("Total monthly cost for environment '%s': %.2f %s\n", envName, total, breakdown.Currency)
+			logger.Infof("infracost total monthly cost for '%s': %.2f %s", envName, total, breakdown.Currency)
+
+			if threshold > 0 && total > threshold {
+				fmt.Printf("Monthly cost %.2f exceeds the threshold of %.2f.\n", total, threshold)
+				logger.Warnf("monthly cost %.2f exceeds threshold %.2f for environment '%s'", total, threshold, envName)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&infracostVersion, "infracost-version", "", "infracost version to install if missing (defaults to INFRACOST_VERSION or "+defaultInfracostVersion+")")
+	cmd.Flags().Float64Var(&threshold, "threshold", 0, "Fail when the total monthly cost exceeds this amount (defaults to COST_THRESHOLD)")
+
+	return cmd
+}
+
+// runInfracost runs `infracost breakdown` against configDir, prints the table output and
+// returns the parsed JSON breakdown.
+func runInfracost(infracostBinary, configDir string) (infracostBreakdown, error) {
+	var breakdown infracostBreakdown
+
+	jsonFile, err := os.CreateTemp("", "tfvenv-infracost-*.json")
+	if err != nil {
+		return breakdown, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	jsonFile.Close()
+	defer os.Remove(jsonFile.Name())
+
+	cmdBreakdown := exec.Command(infracostBinary, "breakdown", "--path", configDir, "--format", "json", "--out-file", jsonFile.Name())
+	if output, err := cmdBreakdown.CombinedOutput(); err != nil {
+		return breakdown, fmt.Errorf("infracost breakdown failed: %v, output: %s", err, string(output))
+	}
+
+	cmdTable := exec.Command(infracostBinary, "output", "--path", jsonFile.Name(), "--format", "table")
+	cmdTable.Stdout = os.Stdout
+	cmdTable.Stderr = os.Stderr
+	if err := cmdTable.Run(); err != nil {
+		logger.Warnf("failed to render infracost table: %v", err)
+	}
+
+	data, err := os.ReadFile(jsonFile.Name())
+	if err != nil {
+		return breakdown, fmt.Errorf("failed to read infracost output: %w", err)
+	}
+	if err := json.Unmarshal(data, &breakdown); err != nil {
+		return breakdown, fmt.Errorf("failed to parse infracost output: %w", err)
+	}
+
+	return breakdown, nil
+}
+
+// installInfracost downloads the given infracost release into binDir.
+func installInfracost(infracostVersion, binDir string) error {
+	if err := os.MkdirAll(binDir, 0755); err != nil {
+		return fmt.Errorf("failed to create bin directory: %w", err)
+	}
+
+	// Example: https://github.com/infracost/infracost/releases/download/v0.10.39/infracost-linux-amd64.tar.gz
+	name := fmt.Sprintf("infracost-%s-%s", runtime.GOOS, runtime.GOARCH)
+	artifact := toolArtifact{
+		URL:    fmt.Sprintf("%sv%s/%s.tar.gz", infracostDownloadURL, strings.TrimPrefix(infracostVersion, "v"), name),
+		Type:   artifactTarGz,
+		Member: executableName(name),
+	}
+	binaryPath := filepath.Join(binDir, executableName("infracost"))
+
+	archivePath := artifact.downloadPath(binDir)
+	if _, err := fetchArtifact(artifact.URL, archivePath, nil); err != nil {
+		return fmt.Errorf("failed to download infracost: %w", err)
+	}
+	if err := installArtifact(artifact, archivePath, binaryPath); err != nil {
+		return fmt.Errorf("failed to extract infracost: %w", err)
+	}
+
+	logger.Infof("infracost %s installed at %s", infracostVersion, binaryPath)
+	return nil
+}
+
+// extractTarGzMember extracts a single named file from a .tar.gz archive to dest.
+func extractTarGzMember(archivePath, member, dest string) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open archive %s: %w", archivePath, err)
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(bufio.NewReaderSize(file, streamBufferSize))
+	if err != nil {
+		return fmt.Errorf("failed to read gzip stream %s: %w", archivePath, err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive %s: %w", archivePath, err)
+		}
+		if header.Typeflag != tar.TypeReg || filepath.Base(header.Name) != member {
+			continue
+		}
+
+		// Never write through a symlink left at dest
+		os.Remove(dest)
+		out, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0755)
+		if err != nil {
+			return fmt.Errorf("failed to create file %s: %w", dest, err)
+		}
+		limit := maxExtractSize()
+		n, err := io.Copy(out, io.LimitReader(tr, limit+1))
+		if err == nil && n > limit {
+			err = fmt.Errorf("expands beyond the %s allowed (TFVENV_MAX_EXTRACT_SIZE)", formatSize(limit))
+		}
+		if err != nil {
+			out.Close()
+			os.Remove(dest)
+			return fmt.Errorf("failed to write file %s: %w", dest, err)
+		}
+		return out.Close()
+	}
+
+	return fmt.Errorf("%s not found in archive %s", member, archivePath)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	keyring "github.com/zalando/go-keyring"
+	"golang.org/x/term"
+)
+
+const (
+	// credentialsHelperName is the helper label used in credentials_helper blocks.
+	credentialsHelperName = "tfvenv"
+	// credentialsKeyringService namespaces the registry tokens in the OS keyring.
+	credentialsKeyringService = "tfvenv-terraform-credentials"
+)
+
+// credentialsCmd groups the commands that manage Terraform registry and TFC/TFE tokens.
+func credentialsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "credentials",
+		Short: "Manage terraform login tokens in the OS keyring",
+	}
+	cmd.AddCommand(credentialsSetCmd())
+	cmd.AddCommand(credentialsRemoveCmd())
+	cmd.AddCommand(credentialsHelperCmd())
+	return cmd
+}
+
+// credentialsSetCmd stores a token and enables the credentials helper in every environment.
+func credentialsSetCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "set <hostname>",
+		Short: "Store a token for a hostname and share it with every environment",
+		Long: `Store an API token for a Terraform registry or Terraform Cloud/Enterprise host in the
+OS keyring. The token is read from standard input, or prompted for on a terminal.
+Every environment is configured with a credentials_helper that reads tokens from the
+keyring, so no plaintext credentials are written to .terraformrc files.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			hostname := strings.ToLower(args[0])
+			envDir := viper.GetString("env-dir")
+
+			token, err := readToken(hostname)
+			if err != nil {
+				logger.Errorf("error reading token: %v", err)
+				fmt.Printf("Error reading token: %v\n", err)
+				os.Exit(1)
+			}
+			if token == "" {
+				fmt.Println("Error: the token is empty.")
+				os.Exit(1)
+			}
+
+			if err := keyring.Set(credentialsKeyringService, hostname, token); err != nil {
+				logger.Errorf("error storing token for %s: %v", hostname, err)
+				fmt.Printf("Error storing token in the keyring: %v\n", err)
+				os.Exit(1)
+			}
+
+			helperPath, err := installCredentialsHelper()
+			if err != nil {
+				logger.Errorf("error installing credentials helper: %v", err)
+				fmt.Printf("Error installing credentials helper: %v\n", err)
+				os.Exit(1)
+			}
+
+			names, err := listEnvironmentDirs(envDir)
+			if err != nil {
+				logger.Warnf("error listing environments: %v", err)
+			}
+			for _, name := range names {
+				if err := enableCredentialsHelper(filepath.Join(envDir, name)); err != nil {
+					logger.Warnf("error enabling credentials helper for %s: %v", name, err)
+					fmt.Printf("Warning: could not configure environment '%s': %v\n", name, err)
+				}
+			}
+
+			fmt.Printf("Token for %s stored in the keyring.\n", hostname)
+			fmt.Printf("Credentials helper installed at %s and enabled for %d environment(s). Re-activate environments to apply the change.\n", helperPath, len(names))
+			logger.Infof("stored token for %s and enabled credentials helper", hostname)
+		},
+	}
+}
+
+// credentialsRemoveCmd deletes a stored token.
+func credentialsRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove <hostname>",
+		Short: "Remove the stored token for a hostname",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			hostname := strings.ToLower(args[0])
+			err := keyring.Delete(credentialsKeyringService, hostname)
+			if errors.Is(err, keyring.ErrNotFound) {
+				fmt.Printf("No token stored for %s.\n", hostname)
+				return
+			}
+			if err != nil {
+				logger.Errorf("error removing token for %s: %v", hostname, err)
+				fmt.Printf("Error removing token: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Token for %s removed.\n", hostname)
+			logger.Infof("removed token for %s", hostname)
+		},
+	}
+}
+
+// credentialsHelperCmd implements Terraform's credentials helper protocol. It is
+// invoked by the terraform-credentials-tfvenv shim, not by users.
+func credentialsHelperCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:    "helper <get|store|forget> <hostname>",
+		Short:  "Terraform credentials helper protocol",
+		Hidden: true,
+		Args:   cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			// stdout carries the protocol response, so logs and errors go elsewhere
+			if os.Getenv("TFVENV_LOG_FILE") == "" {
+				logger.Out = os.Stderr
+			}
+			if err := runCredentialsHelper(args[0], strings.ToLower(args[1])); err != nil {
+				logger.Errorf("credentials helper %s %s: %v", args[0], args[1], err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+}
+
+// runCredentialsHelper answers one credentials helper request.
+func runCredentialsHelper(action, hostname string) error {
+	switch action {
+	case "get":
+		token, err := keyring.Get(credentialsKeyringService, hostname)
+		if errors.Is(err, keyring.ErrNotFound) {
+			fmt.Println("{}")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return json.NewEncoder(os.Stdout).Encode(map[string]string{"token": token})
+	case "store":
+		var credentials struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(os.Stdin).Decode(&credentials); err != nil {
+			return fmt.Errorf("failed to decode credentials: %w", err)
+		}
+		if credentials.Token == "" {
+			return fmt.Errorf("credentials for %s have no token", hostname)
+		}
+		return keyring.Set(credentialsKeyringService, hostname, credentials.Token)
+	case "forget":
+		err := keyring.Delete(credentialsKeyringService, hostname)
+		if errors.Is(err, keyring.ErrNotFound) {
+			return nil
+		}
+		return err
+	default:
+		return fmt.Errorf("unsupported credentials helper command %q", action)
+	}
+}
+
+// readToken reads the token from stdin, prompting without echo on a terminal.
+func readToken(hostname string) (string, error) {
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Printf("Token for %s: ", hostname)
+		data, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Println()
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// credentialsHelperPath returns where Terraform discovers the tfvenv credentials
+// helper: the top level of the user's plugin directory.
+func credentialsHelperPath() string {
+	return filepath.Join(userDirs.Home, ".terraform.d", "plugins", "terraform-credentials-"+credentialsHelperName)
+}
+
+// installCredentialsHelper writes the shim that forwards Terraform's helper
+// requests to this tfvenv binary.
+func installCredentialsHelper() (string, error) {
+	if runtime.GOOS == "windows" {
+		return "", fmt.Errorf("the credentials helper is not supported on Windows")
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate the tfvenv binary: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(self); err == nil {
+		self = resolved
+	}
+
+	if userDirs.Home == "" {
+		return "", fmt.Errorf("there is no home directory for Terraform to find the credentials helper in; set HOME")
+	}
+	path := credentialsHelperPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	shim := fmt.Sprintf("#!/bin/sh\n# Generated by tfvenv credentials set\nexec %s credentials helper \"$@\"\n", escapeBash(self))
+	if err := os.WriteFile(path, []byte(shim), 0755); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return path, nil
+}
+
+// enableCredentialsHelper adds the tfvenv credentials_helper block to the environment's CLI configuration.
+func enableCredentialsHelper(envPath string) error {
+	return updateCLIConfig(envPath, func(body *hclwrite.Body) {
+		// Terraform allows a single credentials_helper block
+		removeCLIConfigBlocks(body, "credentials_helper")
+		body.AppendNewBlock("credentials_helper", []string{credentialsHelperName})
+	})
+}
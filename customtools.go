@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	version "github.com/hashicorp/go-version"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	yaml "gopkg.in/yaml.v3"
+
+	"tfvenv/i18n"
+)
+
+// toolsFileName defines custom tools in the config directory.
+const toolsFileName = "tools.yaml"
+
+// toolRegistry is the content of tools.yaml.
+type toolRegistry struct {
+	Tools []customTool `yaml:"tools"`
+}
+
+// customTool is a tool defined in tools.yaml that tfvenv installs into an
+// environment's bin directory next to Terraform.
+type customTool struct {
+	Name string `yaml:"name"`
+	// URL is a template with {{.Version}}, {{.OS}}, {{.Arch}} and {{.Ext}}
+	// (".exe" on Windows).
+	URL string `yaml:"url"`
+	// Type is zip, tar.gz or binary.
+	Type string `yaml:"type"`
+	// Binary is the executable's file name inside an archive, a template like URL.
+	Binary string `yaml:"binary"`
+	// Version is where "latest" is resolved.
+	Version customToolVersion `yaml:"version"`
+	// Checksum is none, sidecar, or the URL template of a SHA256SUMS file.
+	Checksum string `yaml:"checksum"`
+}
+
+// customToolVersion says how a custom tool's latest version is found: the
+// newest release of a GitHub repository, a URL returning the version as
+// text, or a fixed default.
+type customToolVersion struct {
+	GitHub  string `yaml:"github"`
+	URL     string `yaml:"url"`
+	Default string `yaml:"default"`
+}
+
+// customToolVars are the values a custom tool's templates can refer to.
+type customToolVars struct {
+	Version string
+	OS      string
+	Arch    string
+	Ext     string
+}
+
+// toolsFilePath returns where custom tools are defined.
+func toolsFilePath() string {
+	return filepath.Join(userDirs.ConfigDir(), toolsFileName)
+}
+
+// loadToolRegistry reads and validates tools.yaml. A missing file defines no tools.
+func loadToolRegistry() (toolRegistry, error) {
+	var registry toolRegistry
+	path := toolsFilePath()
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return registry, nil
+	}
+	if err != nil {
+		return registry, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&registry); err != nil && !errors.Is(err, io.EOF) {
+		return registry, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	seen := make(map[string]bool)
+	for i, tool := range registry.Tools {
+		switch {
+		case tool.Name == "":
+			return registry, fmt.Errorf("%s: tool %d has no name", path, i+1)
+		case filepath.Base(tool.Name) != tool.Name || strings.HasPrefix(tool.Name, "."):
+			return registry, fmt.Errorf("%s: tool name %q is not a valid file name", path, tool.Name)
+		case tool.Name == toolTerraform || tool.Name == toolTofu || tool.Name == "terragrunt":
+			return registry, fmt.Errorf("%s: %s is built in and cannot be redefined", path, tool.Name)
+		case seen[tool.Name]:
+			return registry, fmt.Errorf("%s: tool %s is defined twice", path, tool.Name)
+		case tool.URL == "":
+			return registry, fmt.Errorf("%s: tool %s has no url", path, tool.Name)
+		}
+		seen[tool.Name] = true
+		switch tool.Type {
+		case artifactZip, artifactTarGz, artifactBinary:
+		default:
+			return registry, fmt.Errorf("%s: tool %s: unsupported type %q (use %s, %s or %s)", path, tool.Name, tool.Type, artifactZip, artifactTarGz, artifactBinary)
+		}
+		if _, err := tool.artifact("0.0.0"); err != nil {
+			return registry, fmt.Errorf("%s: tool %s: %w", path, tool.Name, err)
+		}
+	}
+	return registry, nil
+}
+
+// lookup returns the custom tool with the given name.
+func (r toolRegistry) lookup(name string) (customTool, error) {
+	for _, tool := range r.Tools {
+		if tool.Name == name {
+			return tool, nil
+		}
+	}
+	return customTool{}, fmt.Errorf("tool %q is not defined in %s", name, toolsFilePath())
+}
+
+// artifact renders the tool's templates for a version.
+func (t customTool) artifact(v string) (toolArtifact, error) {
+	vars := customToolVars{Version: v, OS: runtime.GOOS, Arch: runtime.GOARCH}
+	if runtime.GOOS == "windows" {
+		vars.Ext = windowsExecutableSuffix
+	}
+	artifact := toolArtifact{Type: t.Type}
+	fields := []struct {
+		name   string
+		text   string
+		target *string
+	}{
+		{"url", t.URL, &artifact.URL},
+		{"binary", t.Binary, &artifact.Member},
+		{"checksum", t.Checksum, &artifact.Checksum},
+	}
+	for _, field := range fields {
+		value, err := executeTemplate(field.text, vars, nil)
+		if err != nil {
+			return artifact, fmt.Errorf("%s: %w", field.name, err)
+		}
+		*field.target = value
+	}
+	if artifact.Checksum == "none" {
+		artifact.Checksum = checksumNone
+	}
+	return artifact, nil
+}
+
+// resolveVersion turns "latest" (or no version) into a release of the tool.
+func (t customTool) resolveVersion(v string) (string, error) {
+	if v != "" && v != "latest" {
+		return strings.TrimPrefix(v, "v"), nil
+	}
+	switch {
+	case t.Version.GitHub != "":
+		return getLatestGitHubVersion(t.Version.GitHub, t.Name, false)
+	case t.Version.URL != "":
+		resp, err := httpClient.Get(t.Version.URL)
+		if err != nil {
+			return "", fmt.Errorf("failed to fetch the latest %s version: %w", t.Name, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("failed to fetch the latest %s version: status code %d", t.Name, resp.StatusCode)
+		}
+		data, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+		if err != nil {
+			return "", fmt.Errorf("failed to read the latest %s version: %w", t.Name, err)
+		}
+		latest := strings.TrimPrefix(strings.TrimSpace(string(data)), "v")
+		if _, err := version.NewVersion(latest); err != nil {
+			return "", fmt.Errorf("%s does not return a version: %q", t.Version.URL, latest)
+		}
+		return latest, nil
+	case t.Version.Default != "":
+		return t.Version.Default, nil
+	}
+	return "", fmt.Errorf("tool %s has no version source in %s; give a version", t.Name, toolsFilePath())
+}
+
+// installCustomTool installs a version of a custom tool into the environment.
+func installCustomTool(envPath string, tool customTool, v string) (string, error) {
+	resolved, err := tool.resolveVersion(v)
+	if err != nil {
+		return "", err
+	}
+	artifact, err := tool.artifact(resolved)
+	if err != nil {
+		return "", err
+	}
+
+	binDir := filepath.Join(envPath, "bin")
+	if err := os.MkdirAll(binDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create bin directory: %w", err)
+	}
+	fmt.Printf("Downloading %s version %s...\n", tool.Name, resolved)
+	logger.Infof("Downloading %s from %s", tool.Name, artifact.URL)
+	destPath := artifact.downloadPath(binDir)
+	if _, err := fetchArtifact(artifact.URL, destPath, func(digest string) error { return verifyArtifact(artifact, digest) }); err != nil {
+		return "", fmt.Errorf("failed to download %s: %w", tool.Name, err)
+	}
+	if err := installArtifact(artifact, destPath, envBinaryPath(envPath, tool.Name)); err != nil {
+		return "", fmt.Errorf("failed to install %s: %w", tool.Name, err)
+	}
+	err = updateEnvMetadata(envPath, func(meta *EnvironmentMetadata) {
+		if meta.Tools == nil {
+			meta.Tools = make(map[string]string)
+		}
+		meta.Tools[tool.Name] = resolved
+	})
+	return resolved, err
+}
+
+// toolsCmd installs the custom tools defined in tools.yaml.
+func toolsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tools",
+		Short: "Install custom tools defined in " + toolsFileName + " into environments",
+		Long: `Install tools defined in ` + toolsFileName + ` in the config directory (see 'tfvenv dirs')
+into an environment's bin directory, so internal CLIs and linters travel
+with the environment and are on PATH once it is activated.`,
+	}
+	cmd.AddCommand(toolsListCmd())
+	cmd.AddCommand(toolsInstallCmd())
+	cmd.AddCommand(toolsRemoveCmd())
+	return cmd
+}
+
+// toolsListCmd lists the defined tools, and the versions an environment has installed.
+func toolsListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list [env-name]",
+		Short: "List the custom tools, and the versions installed in an environment",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			registry, err := loadToolRegistry()
+			if err != nil {
+				logger.Errorf("error reading %s: %v", toolsFileName, err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			installed := map[string]string{}
+			if len(args) == 1 {
+				envPath := filepath.Join(viper.GetString("env-dir"), args[0])
+				if _, err := os.Stat(envPath); os.IsNotExist(err) {
+					i18n.Println("env.not_found", args[0])
+					os.Exit(1)
+				}
+				if meta, err := loadEnvMetadata(envPath); err == nil && meta.Tools != nil {
+					installed = meta.Tools
+				}
+			}
+			if len(registry.Tools) == 0 {
+				fmt.Printf("No tools defined in %s.\n", toolsFilePath())
+				return
+			}
+			sort.Slice(registry.Tools, func(i, j int) bool { return registry.Tools[i].Name < registry.Tools[j].Name })
+			for _, tool := range registry.Tools {
+				if v, ok := installed[tool.Name]; ok {
+					fmt.Printf("%-20s %-8s installed %s\n", tool.Name, tool.Type, v)
+				} else {
+					fmt.Printf("%-20s %s\n", tool.Name, tool.Type)
+				}
+			}
+		},
+	}
+}
+
+// toolsInstallCmd installs a custom tool into an environment.
+func toolsInstallCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "install <env-name> <tool> [version]",
+		Short: "Install a custom tool into an environment (default: latest)",
+		Args:  cobra.RangeArgs(2, 3),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName, name := args[0], args[1]
+			envPath := filepath.Join(viper.GetString("env-dir"), envName)
+			if _, err := os.Stat(envPath); os.IsNotExist(err) {
+				i18n.Println("env.not_found", envName)
+				os.Exit(1)
+			}
+			v := "latest"
+			if len(args) == 3 {
+				v = args[2]
+			}
+
+			registry, err := loadToolRegistry()
+			if err != nil {
+				logger.Errorf("error reading %s: %v", toolsFileName, err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			tool, err := registry.lookup(name)
+			if err != nil {
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			installed, err := installCustomTool(envPath, tool, v)
+			if err != nil {
+				logger.Errorf("error installing %s into %s: %v", name, envName, err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Installed %s %s into '%s'.\n", name, installed, envName)
+			logger.Infof("installed %s %s into %s", name, installed, envName)
+		},
+	}
+}
+
+// toolsRemoveCmd removes a custom tool from an environment.
+func toolsRemoveCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "remove <env-name> <tool>",
+		Short: "Remove a custom tool from an environment",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName, name := args[0], args[1]
+			envPath := filepath.Join(viper.GetString("env-dir"), envName)
+			meta, err := loadEnvMetadata(envPath)
+			if err != nil {
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			if _, ok := meta.Tools[name]; !ok {
+				i18n.Println("error", fmt.Sprintf("tool %s is not installed in '%s'", name, envName))
+				os.Exit(1)
+			}
+			if err := os.Remove(envBinaryPath(envPath, name)); err != nil && !os.IsNotExist(err) {
+				logger.Errorf("error removing %s from %s: %v", name, envName, err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			if err := updateEnvMetadata(envPath, func(meta *EnvironmentMetadata) { delete(meta.Tools, name) }); err != nil {
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Removed %s from '%s'.\n", name, envName)
+		},
+	}
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"tfvenv/i18n"
+	"tfvenv/snaps"
+)
+
+// defaultDaemonAddr keeps the API on the loopback interface unless told otherwise.
+const defaultDaemonAddr = "127.0.0.1:8420"
+
+// daemonServer serves the management API for the environments under envDir.
+// Requests are serialized: environment operations share global state such as
+// viper and the process working directory.
+type daemonServer struct {
+	envDir string
+	token  string
+	mu     sync.Mutex
+}
+
+// envStatusResponse describes an environment in API responses.
+type envStatusResponse struct {
+	Name              string     `json:"name"`
+	Path              string     `json:"path"`
+	TerraformVersion  string     `json:"terraform_version,omitempty"`
+	TerragruntVersion string     `json:"terragrunt_version,omitempty"`
+	Workspace         string     `json:"workspace,omitempty"`
+	Locked            bool       `json:"locked"`
+	ExpiresAt         *time.Time `json:"expires_at,omitempty"`
+}
+
+// createEnvRequest is the body of POST /v1/environments.
+type createEnvRequest struct {
+	Name              string `json:"name"`
+	TerraformVersion  string `json:"terraform_version"`
+	TerragruntVersion string `json:"terragrunt_version"`
+	// Expires is a duration such as "72h" after which the environment expires.
+	Expires string `json:"expires,omitempty"`
+}
+
+// saveSnapRequest is the body of POST /v1/environments/{name}/snaps.
+type saveSnapRequest struct {
+	Name string `json:"name"`
+}
+
+// daemonCmd runs the HTTP management API.
+func daemonCmd() *cobra.Command {
+	var addr, tokenFile, tlsCert, tlsKey string
+	var expiredAction string
+	var expiryInterval, expiryWarning time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "Serve an authenticated HTTP API for managing environments and snaps",
+		Run: func(cmd *cobra.Command, args []string) {
+			envDir := viper.GetString("env-dir")
+
+			token := os.Getenv("TFVENV_DAEMON_TOKEN")
+			if tokenFile != "" {
+				data, err := os.ReadFile(tokenFile)
+				if err != nil {
+					logger.Errorf("error reading token file %s: %v", tokenFile, err)
+					fmt.Printf("Error reading token file: %v\n", err)
+					os.Exit(1)
+				}
+				token = strings.TrimSpace(string(data))
+			}
+			if token == "" {
+				fmt.Println("Error: an API token is required. Set TFVENV_DAEMON_TOKEN or use --token-file.")
+				os.Exit(1)
+			}
+			if (tlsCert == "") != (tlsKey == "") {
+				fmt.Println("Error: --tls-cert and --tls-key must be used together.")
+				os.Exit(1)
+			}
+			if err := validateExpiredAction(expiredAction); err != nil {
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			if host, _, err := net.SplitHostPort(addr); err == nil && tlsCert == "" {
+				if ip := net.ParseIP(host); ip == nil || !ip.IsLoopback() {
+					logger.Warnf("daemon listening on %s without TLS", addr)
+					fmt.Printf("Warning: serving on %s without TLS; the API token is sent in clear text.\n", addr)
+				}
+			}
+
+			daemon := newDaemonServer(envDir, token)
+			server := &http.Server{
+				Addr:              addr,
+				Handler:           daemon,
+				ReadHeaderTimeout: 10 * time.Second,
+			}
+
+			// Shut down cleanly when the root context is cancelled by SIGINT/SIGTERM
+			handleInterruptsGracefully()
+			ctx := cmd.Context()
+			go func() {
+				<-ctx.Done()
+				shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				defer cancel()
+				server.Shutdown(shutdownCtx)
+			}()
+			if expiryInterval > 0 {
+				go daemon.expireEnvironments(ctx, expiryInterval, expiredAction, expiryWarning)
+			}
+
+			fmt.Printf("tfvenv daemon serving environments in %s on %s\n", envDir, addr)
+			logger.Infof("daemon listening on %s for %s", addr, envDir)
+
+			var err error
+			if tlsCert != "" {
+				err = server.ListenAndServeTLS(tlsCert, tlsKey)
+			} else {
+				err = server.ListenAndServe()
+			}
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Errorf("daemon failed: %v", err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			logger.Info("daemon stopped")
+		},
+	}
+
+	cmd.Flags().StringVar(&addr, "addr", defaultDaemonAddr, "Address to listen on")
+	cmd.Flags().StringVar(&tokenFile, "token-file", "", "File containing the API bearer token (defaults to TFVENV_DAEMON_TOKEN)")
+	cmd.Flags().StringVar(&tlsCert, "tls-cert", "", "TLS certificate file")
+	cmd.Flags().StringVar(&tlsKey, "tls-key", "", "TLS private key file")
+	cmd.Flags().DurationVar(&expiryInterval, "expiry-interval", time.Hour, "How often to check for expired environments (0 disables the check)")
+	cmd.Flags().StringVar(&expiredAction, "expired-action", expiredWarn, "What to do with expired environments: warn, archive or delete")
+	cmd.Flags().DurationVar(&expiryWarning, "expiry-warning", 24*time.Hour, "Warn about environments that expire within this")
+	return cmd
+}
+
+// newDaemonServer returns the API handler with authentication applied.
+func newDaemonServer(envDir, token string) *daemonServer {
+	metrics.mu.Lock()
+	metrics.daemonStartedUnix = time.Now().Unix()
+	metrics.mu.Unlock()
+	return &daemonServer{envDir: envDir, token: token}
+}
+
+// expireEnvironments applies the expiry policy to the served environments
+// every interval, between API requests, until ctx is cancelled.
+func (s *daemonServer) expireEnvironments(ctx context.Context, interval time.Duration, action string, warnWithin time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		s.mu.Lock()
+		names, err := listEnvironmentDirs(s.envDir)
+		if err != nil {
+			s.mu.Unlock()
+			logger.Warnf("daemon: error listing environments for expiry: %v", err)
+			continue
+		}
+		task := maintainExpiry(s.envDir, names, action, warnWithin, false)
+		s.mu.Unlock()
+		if task.Status == maintainFailed {
+			logger.Errorf("daemon: %s", task.Detail)
+		}
+	}
+}
+
+// ServeHTTP authenticates the request and routes it:
+//
+//	GET    /v1/environments
+//	POST   /v1/environments
+//	GET    /v1/environments/{name}
+//	DELETE /v1/environments/{name}
+//	GET    /v1/environments/{name}/snaps
+//	POST   /v1/environments/{name}/snaps
+//	DELETE /v1/environments/{name}/snaps/{snap}
+//	GET    /metrics
+func (s *daemonServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	s.route(recorder, r)
+	metrics.observeRequest(r.Method, recorder.status)
+}
+
+func (s *daemonServer) route(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(r) {
+		writeJSONError(w, http.StatusUnauthorized, "invalid or missing bearer token")
+		return
+	}
+
+	if r.URL.Path == "/metrics" && r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		metrics.writeMetrics(w, s.envDir)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 2 || parts[0] != "v1" || parts[1] != "environments" {
+		writeJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		s.listEnvironments(w)
+	case len(parts) == 2 && r.Method == http.MethodPost:
+		s.createEnvironment(w, r)
+	case len(parts) == 3 && r.Method == http.MethodGet:
+		s.environmentStatus(w, parts[2])
+	case len(parts) == 3 && r.Method == http.MethodDelete:
+		s.deleteEnvironment(w, r, parts[2])
+	case len(parts) == 4 && parts[3] == "snaps" && r.Method == http.MethodGet:
+		s.listSnaps(w, parts[2])
+	case len(parts) == 4 && parts[3] == "snaps" && r.Method == http.MethodPost:
+		s.saveSnap(w, r, parts[2])
+	case len(parts) == 5 && parts[3] == "snaps" && r.Method == http.MethodDelete:
+		s.removeSnap(w, parts[2], parts[4])
+	default:
+		writeJSONError(w, http.StatusNotFound, "not found")
+	}
+}
+
+// authorized checks the bearer token in constant time.
+func (s *daemonServer) authorized(r *http.Request) bool {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+// envPath validates an environment name from the URL and returns its directory.
+func (s *daemonServer) envPath(w http.ResponseWriter, name string, mustExist bool) (string, bool) {
+	if name == "" || name == "." || name == ".." || filepath.Base(name) != name || strings.ToLower(name) == "previous" {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid environment name %q", name))
+		return "", false
+	}
+	envPath := filepath.Join(s.envDir, name)
+	if mustExist {
+		if info, err := os.Stat(envPath); err != nil || !info.IsDir() {
+			writeJSONError(w, http.StatusNotFound, fmt.Sprintf("environment %q does not exist", name))
+			return "", false
+		}
+	}
+	return envPath, true
+}
+
+func (s *daemonServer) listEnvironments(w http.ResponseWriter) {
+	names, err := listEnvironmentDirs(s.envDir)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	envs := make([]envStatusResponse, 0, len(names))
+	for _, name := range names {
+		envs = append(envs, environmentStatus(filepath.Join(s.envDir, name), name))
+	}
+	writeJSON(w, http.StatusOK, envs)
+}
+
+func (s *daemonServer) createEnvironment(w http.ResponseWriter, r *http.Request) {
+	var req createEnvRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+	envPath, ok := s.envPath(w, req.Name, false)
+	if !ok {
+		return
+	}
+	if _, err := os.Stat(envPath); err == nil {
+		writeJSONError(w, http.StatusConflict, fmt.Sprintf("environment %q already exists", req.Name))
+		return
+	}
+	if err := checkEnvQuota(s.envDir); err != nil {
+		writeJSONError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if req.TerraformVersion == "" {
+		req.TerraformVersion = "latest"
+	}
+	if req.TerragruntVersion == "" {
+		req.TerragruntVersion = "none"
+	}
+	var expires time.Duration
+	if req.Expires != "" {
+		var err error
+		if expires, err = time.ParseDuration(req.Expires); err != nil || expires <= 0 {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid expires %q: use a positive duration such as 72h", req.Expires))
+			return
+		}
+	}
+
+	if err := initEnv(envPath, envTool(envPath, req.Name), req.TerraformVersion, req.TerragruntVersion, req.Name, false); err != nil {
+		logger.Errorf("daemon: error creating environment %s: %v", req.Name, err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if expires > 0 {
+		if _, err := setEnvExpiry(envPath, expires); err != nil {
+			logger.Errorf("daemon: error recording expiry of %s: %v", req.Name, err)
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	status := environmentStatus(envPath, req.Name)
+	emitEvent(envPath, eventEnvCreated, map[string]string{
+		"terraform_version":  status.TerraformVersion,
+		"terragrunt_version": status.TerragruntVersion,
+	})
+	logger.Infof("daemon: created environment %s", req.Name)
+	writeJSON(w, http.StatusCreated, status)
+}
+
+func (s *daemonServer) environmentStatus(w http.ResponseWriter, name string) {
+	envPath, ok := s.envPath(w, name, true)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, environmentStatus(envPath, name))
+}
+
+func (s *daemonServer) deleteEnvironment(w http.ResponseWriter, r *http.Request, name string) {
+	envPath, ok := s.envPath(w, name, true)
+	if !ok {
+		return
+	}
+	if fileExists(filepath.Join(envPath, lockFileName)) {
+		writeJSONError(w, http.StatusConflict, fmt.Sprintf("environment %q is locked", name))
+		return
+	}
+	// Removing the binaries breaks shells and commands using the environment
+	if err := checkEnvNotInUse(envPath, name, r.URL.Query().Get("force") == "true"); err != nil {
+		writeJSONError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if err := os.RemoveAll(envPath); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	logger.Infof("daemon: deleted environment %s", name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *daemonServer) listSnaps(w http.ResponseWriter, name string) {
+	envPath, ok := s.envPath(w, name, true)
+	if !ok {
+		return
+	}
+	matches, err := filepath.Glob(filepath.Join(envPath, "snaps", "*.snap"))
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	names := make([]string, 0, len(matches))
+	for _, match := range matches {
+		names = append(names, strings.TrimSuffix(filepath.Base(match), ".snap"))
+	}
+	sort.Strings(names)
+	writeJSON(w, http.StatusOK, names)
+}
+
+func (s *daemonServer) saveSnap(w http.ResponseWriter, r *http.Request, name string) {
+	envPath, ok := s.envPath(w, name, true)
+	if !ok {
+		return
+	}
+	var req saveSnapRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return
+	}
+	snapName, err := snaps.SanitizeSnapName(req.Name)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := os.MkdirAll(filepath.Join(envPath, "snaps"), 0755); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	filePath, err := saveEnvironmentSnap(envPath, snapName, false)
+	if err != nil {
+		logger.Errorf("daemon: error saving snap %s for %s: %v", snapName, name, err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	emitEvent(envPath, eventSnapSaved, map[string]string{"snap": snapName, "location": filePath})
+	logger.Infof("daemon: saved snap %s for %s", snapName, name)
+	writeJSON(w, http.StatusCreated, map[string]string{"name": snapName, "path": filePath})
+}
+
+func (s *daemonServer) removeSnap(w http.ResponseWriter, name, snapName string) {
+	envPath, ok := s.envPath(w, name, true)
+	if !ok {
+		return
+	}
+	snapName, err := snaps.SanitizeSnapName(snapName)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filePath := snaps.GetSnapFilePath(envPath, snapName)
+	if !fileExists(filePath) {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("snap %q does not exist", snapName))
+		return
+	}
+	if err := snaps.RemoveSnap(filePath); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	logger.Infof("daemon: removed snap %s for %s", snapName, name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// environmentStatus gathers the versions, workspace and lock state of an environment.
+func environmentStatus(envPath, name string) envStatusResponse {
+	status := envStatusResponse{
+		Name:   name,
+		Path:   envPath,
+		Locked: fileExists(filepath.Join(envPath, lockFileName)),
+	}
+	if tf, tg, err := pinnedToolVersions(envPath, name); err == nil {
+		status.TerraformVersion = tf
+		status.TerragruntVersion = tg
+	}
+	if meta, err := loadEnvMetadata(envPath); err == nil {
+		status.Workspace = meta.Workspace
+		status.ExpiresAt = meta.ExpiresAt
+	}
+	return status
+}
+
+// listEnvironmentDirs returns the names of the environments under envDir,
+// recognised by their bin directory.
+func listEnvironmentDirs(envDir string) ([]string, error) {
+	entries, err := os.ReadDir(envDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", envDir, err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if info, err := os.Stat(filepath.Join(envDir, entry.Name(), "bin")); err == nil && info.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// writeJSON writes v as a JSON response.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Warnf("daemon: error writing response: %v", err)
+	}
+}
+
+// writeJSONError writes an {"error": message} response.
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
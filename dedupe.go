@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// dedupedFile is a provider binary replaced, or to be replaced, by a hard link
+// to an identical one.
+type dedupedFile struct {
+	Path   string
+	Target string
+	Size   int64
+}
+
+// dedupeProviders replaces byte-identical provider binaries in the plugin
+// cache with hard links to one copy, and returns the files it replaced.
+// Only files of equal size are hashed, and files that are already links to
+// each other are left alone. A file that cannot be linked, or whose provider
+// directory is in use, is skipped.
+func dedupeProviders(pluginCacheDir string, dryRun bool) ([]dedupedFile, error) {
+	logger.Infof("Deduplicating provider binaries in plugin cache at %s", pluginCacheDir)
+
+	bySize := make(map[int64][]string)
+	err := filepath.Walk(pluginCacheDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() && strings.HasPrefix(info.Name(), "terraform-provider-") && info.Size() > 0 {
+			bySize[info.Size()] = append(bySize[info.Size()], path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error scanning %s: %w", pluginCacheDir, err)
+	}
+
+	sizes := make([]int64, 0, len(bySize))
+	for size := range bySize {
+		sizes = append(sizes, size)
+	}
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i] > sizes[j] })
+
+	var deduped []dedupedFile
+	gc := newCacheGC(pluginCacheDir)
+	defer gc.release()
+	for _, size := range sizes {
+		paths := bySize[size]
+		if len(paths) < 2 {
+			continue
+		}
+		sort.Strings(paths)
+		// The first file of each digest is kept and the others link to it
+		kept := make(map[string]string)
+		for _, path := range paths {
+			digest, err := fileSHA256(path)
+			if err != nil {
+				logger.Warnf("failed to hash %s: %v", path, err)
+				continue
+			}
+			target, ok := kept[digest]
+			if !ok {
+				kept[digest] = path
+				continue
+			}
+			if sameFile(target, path) {
+				continue
+			}
+			if !dryRun {
+				if !gc.acquire(target) || !gc.acquire(path) {
+					continue
+				}
+				if err := replaceWithHardLink(target, path); err != nil {
+					logger.Warnf("failed to link %s to %s: %v", path, target, err)
+					continue
+				}
+				logger.Infof("replaced %s with a hard link to %s", path, target)
+			}
+			deduped = append(deduped, dedupedFile{Path: path, Target: target, Size: size})
+		}
+	}
+	return deduped, nil
+}
+
+// sameFile reports whether two paths are links to the same file.
+func sameFile(a, b string) bool {
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
+
+// replaceWithHardLink swaps path for a hard link to target. The link is made
+// next to path and renamed over it, so path never goes missing.
+func replaceWithHardLink(target, path string) error {
+	tmp := path + ".tfvenv-dedupe"
+	os.Remove(tmp)
+	if err := os.Link(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// printDedupe reports the provider binaries a dedupe linked, or would link,
+// and the space saved.
+func printDedupe(files []dedupedFile, dryRun bool) {
+	var saved int64
+	for _, file := range files {
+		saved += file.Size
+		if dryRun {
+			printDryRun("would replace %s with a hard link to %s", file.Path, file.Target)
+		} else {
+			fmt.Printf("Linked %s to %s\n", file.Path, file.Target)
+		}
+	}
+	if dryRun {
+		fmt.Printf("Deduplicating would save %s in %d file(s).\n", formatSize(saved), len(files))
+		return
+	}
+	fmt.Printf("Deduplicated %d file(s), saving %s.\n", len(files), formatSize(saved))
+}
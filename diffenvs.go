@@ -0,0 +1,357 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"tfvenv/i18n"
+)
+
+// Sections of a diff-envs report.
+const (
+	diffSectionTools     = "tools"
+	diffSectionEnvVars   = "env vars"
+	diffSectionProviders = "providers"
+	diffSectionTemplates = "templates"
+)
+
+// maxTemplateDiffLines bounds the templates whose lines are diffed; larger
+// ones are only reported as changed.
+const maxTemplateDiffLines = 2000
+
+// envDiffEntry is one difference between two environments.
+type envDiffEntry struct {
+	Section string   `json:"section"`
+	Key     string   `json:"key"`
+	Change  string   `json:"change"` // added, removed or changed
+	A       string   `json:"a,omitempty"`
+	B       string   `json:"b,omitempty"`
+	Lines   []string `json:"lines,omitempty"` // line diff of a changed template
+}
+
+// envDiffReport lists what changes going from environment A to B.
+type envDiffReport struct {
+	EnvA        string         `json:"env_a"`
+	EnvB        string         `json:"env_b"`
+	Differences []envDiffEntry `json:"differences"`
+}
+
+// diffEnvsCmd compares the tools, variables, provider locks and templates of two environments.
+func diffEnvsCmd() *cobra.Command {
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "diff-envs <env-a> <env-b>",
+		Short: "Compare the tool versions, environment variables, provider locks and templates of two environments",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			envDir := viper.GetString("env-dir")
+			for _, envName := range args {
+				if _, err := os.Stat(filepath.Join(envDir, envName)); os.IsNotExist(err) {
+					i18n.Println("env.not_found", envName)
+					os.Exit(1)
+				}
+			}
+
+			report, err := diffEnvironments(envDir, args[0], args[1])
+			if err != nil {
+				logger.Errorf("error comparing %s and %s: %v", args[0], args[1], err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+
+			if jsonOutput {
+				out, _ := json.MarshalIndent(report, "", "  ")
+				fmt.Println(string(out))
+				return
+			}
+			printEnvDiff(report)
+		},
+	}
+
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the diff as JSON")
+	return cmd
+}
+
+// diffEnvironments builds the report of what differs going from envA to envB.
+func diffEnvironments(envDir, envA, envB string) (envDiffReport, error) {
+	report := envDiffReport{EnvA: envA, EnvB: envB, Differences: []envDiffEntry{}}
+	pathA, pathB := filepath.Join(envDir, envA), filepath.Join(envDir, envB)
+
+	report.Differences = append(report.Differences, diffStringMaps(diffSectionTools, envToolVersions(pathA, envA), envToolVersions(pathB, envB))...)
+
+	varsA, err := comparableEnvVars(pathA, envA)
+	if err != nil {
+		return report, err
+	}
+	varsB, err := comparableEnvVars(pathB, envB)
+	if err != nil {
+		return report, err
+	}
+	report.Differences = append(report.Differences, diffStringMaps(diffSectionEnvVars, varsA, varsB)...)
+
+	providersA, err := envLockedProviders(pathA, envA)
+	if err != nil {
+		return report, err
+	}
+	providersB, err := envLockedProviders(pathB, envB)
+	if err != nil {
+		return report, err
+	}
+	report.Differences = append(report.Differences, diffStringMaps(diffSectionProviders, providersA, providersB)...)
+
+	templates, err := diffTemplates(pathA, envA, pathB, envB)
+	if err != nil {
+		return report, err
+	}
+	report.Differences = append(report.Differences, templates...)
+	return report, nil
+}
+
+// envToolVersions returns the tool family and the installed or pinned
+// versions of an environment, with the custom tools installed in it.
+func envToolVersions(envPath, envName string) map[string]string {
+	tools := make(map[string]string)
+	meta, _ := loadEnvMetadata(envPath)
+	config, _ := loadEnvConfig(envPath, envName)
+	tool := resolveTool(config.Tool, meta.Tool)
+	tools["tool"] = tool
+
+	tfVersion, tgVersion, err := pinnedToolVersions(envPath, envName)
+	if err != nil {
+		tfVersion = "unknown"
+	}
+	tools[tool] = tfVersion
+	tools["terragrunt"] = tgVersion
+	for name, v := range meta.Tools {
+		tools[name] = v
+	}
+	return tools
+}
+
+// comparableEnvVars returns the variables an activation applies, without the
+// ones derived from the environment's own path and name, which always differ.
+// Sensitive values are masked.
+func comparableEnvVars(envPath, envName string) (map[string]string, error) {
+	vars, err := activationEnv(envPath, envName)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range []string{"TFVENV_PATH", "TFVENV_ENV", "TFVENV_MODULES_DIR", "TF_CLI_CONFIG_FILE"} {
+		delete(vars, key)
+	}
+	for key := range vars {
+		if isSensitiveKey(key) {
+			vars[key] = "******"
+		}
+	}
+	return vars, nil
+}
+
+// envLockedProviders returns the provider versions pinned by the dependency
+// lock files of an environment's roots, keyed by root and source address.
+func envLockedProviders(envPath, envName string) (map[string]string, error) {
+	configEnvDir := filepath.Join(envPath, "config", envName)
+	roots, err := envRoots(envPath, envName)
+	if err != nil {
+		roots = []string{"."}
+	}
+	providers := make(map[string]string)
+	for _, root := range roots {
+		lockPath := filepath.Join(configEnvDir, root, dependencyLockFileName)
+		if !fileExists(lockPath) {
+			continue
+		}
+		locked, err := readLockedProviders(lockPath)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range locked {
+			key := fmt.Sprintf("%s/%s/%s", p.Host, p.Namespace, p.Type)
+			if root != "." {
+				key = filepath.ToSlash(root) + ": " + key
+			}
+			providers[key] = p.Version
+		}
+	}
+	return providers, nil
+}
+
+// diffStringMaps lists removed, added and changed keys going from a to b, in key order.
+func diffStringMaps(section string, a, b map[string]string) []envDiffEntry {
+	keys := make(map[string]bool)
+	for key := range a {
+		keys[key] = true
+	}
+	for key := range b {
+		keys[key] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	var entries []envDiffEntry
+	for _, key := range sorted {
+		before, inA := a[key]
+		after, inB := b[key]
+		switch {
+		case inA && !inB:
+			entries = append(entries, envDiffEntry{Section: section, Key: key, Change: "removed", A: before})
+		case !inA && inB:
+			entries = append(entries, envDiffEntry{Section: section, Key: key, Change: "added", B: after})
+		case before != after:
+			entries = append(entries, envDiffEntry{Section: section, Key: key, Change: "changed", A: before, B: after})
+		}
+	}
+	return entries
+}
+
+// diffTemplates compares the templates directories of two environments.
+// Templates are named after their environment, so names and contents are
+// compared with the environment name replaced by "<env>".
+func diffTemplates(pathA, envA, pathB, envB string) ([]envDiffEntry, error) {
+	templatesA, err := readEnvTemplates(pathA, envA)
+	if err != nil {
+		return nil, err
+	}
+	templatesB, err := readEnvTemplates(pathB, envB)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []envDiffEntry
+	for _, entry := range diffStringMaps(diffSectionTemplates, templatesA, templatesB) {
+		// Template contents are shown as a line diff rather than in full
+		entry.A, entry.B = "", ""
+		if entry.Change == "changed" {
+			entry.Lines = diffLines(templatesA[entry.Key], templatesB[entry.Key])
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// readEnvTemplates returns the normalized contents of an environment's
+// templates, keyed by their normalized path below templates/.
+func readEnvTemplates(envPath, envName string) (map[string]string, error) {
+	dir := filepath.Join(envPath, "templates")
+	templates := make(map[string]string)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name := strings.ReplaceAll(filepath.ToSlash(rel), envName, "<env>")
+		templates[name] = strings.ReplaceAll(string(content), envName, "<env>")
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read templates of %s: %w", envName, err)
+	}
+	return templates, nil
+}
+
+// diffLines returns the lines removed from a (-) and added in b (+), in
+// order, from their longest common subsequence.
+func diffLines(a, b string) []string {
+	linesA := strings.Split(strings.TrimSuffix(a, "\n"), "\n")
+	linesB := strings.Split(strings.TrimSuffix(b, "\n"), "\n")
+	if len(linesA) > maxTemplateDiffLines || len(linesB) > maxTemplateDiffLines {
+		return []string{fmt.Sprintf("(%d lines -> %d lines, too large to diff)", len(linesA), len(linesB))}
+	}
+
+	// common[i][j] is the length of the longest common subsequence of linesA[i:] and linesB[j:]
+	common := make([][]int, len(linesA)+1)
+	for i := range common {
+		common[i] = make([]int, len(linesB)+1)
+	}
+	for i := len(linesA) - 1; i >= 0; i-- {
+		for j := len(linesB) - 1; j >= 0; j-- {
+			switch {
+			case linesA[i] == linesB[j]:
+				common[i][j] = common[i+1][j+1] + 1
+			case common[i+1][j] >= common[i][j+1]:
+				common[i][j] = common[i+1][j]
+			default:
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+
+	var lines []string
+	i, j := 0, 0
+	for i < len(linesA) || j < len(linesB) {
+		switch {
+		case i < len(linesA) && j < len(linesB) && linesA[i] == linesB[j]:
+			i++
+			j++
+		case j == len(linesB) || (i < len(linesA) && common[i+1][j] >= common[i][j+1]):
+			lines = append(lines, "- "+linesA[i])
+			i++
+		default:
+			lines = append(lines, "+ "+linesB[j])
+			j++
+		}
+	}
+	return lines
+}
+
+// printEnvDiff prints the report grouped by section, in the notation of
+// 'tfvenv env diff'.
+func printEnvDiff(report envDiffReport) {
+	if len(report.Differences) == 0 {
+		fmt.Printf("No differences between %s and %s.\n", report.EnvA, report.EnvB)
+		return
+	}
+	fmt.Printf("--- %s\n+++ %s\n", report.EnvA, report.EnvB)
+	section := ""
+	for _, entry := range report.Differences {
+		if entry.Section != section {
+			section = entry.Section
+			fmt.Printf("\n[%s]\n", section)
+		}
+		switch {
+		case entry.Change == "removed":
+			fmt.Printf("- %s", entry.Key)
+		case entry.Change == "added":
+			fmt.Printf("+ %s", entry.Key)
+		default:
+			fmt.Printf("~ %s", entry.Key)
+		}
+		switch {
+		case entry.Section == diffSectionTemplates:
+			fmt.Println()
+			for _, line := range entry.Lines {
+				fmt.Printf("    %s\n", line)
+			}
+		case entry.Change == "removed":
+			fmt.Printf("=%s\n", entry.A)
+		case entry.Change == "added":
+			fmt.Printf("=%s\n", entry.B)
+		default:
+			fmt.Printf(": %s -> %s\n", entry.A, entry.B)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/spf13/cobra"
+
+	"tfvenv/i18n"
+	"tfvenv/paths"
+)
+
+// userDirs resolves tfvenv's per-user data, cache and config directories.
+var userDirs = paths.Default()
+
+// configureUserDirs applies the --data-dir and --system flags. They are
+// exported as TFVENV_DATA_DIR and TFVENV_SYSTEM, so that tfvenv run from
+// hooks and scripts of this command uses the same directories.
+func configureUserDirs(cmd *cobra.Command) {
+	if dir, _ := cmd.Flags().GetString("data-dir"); dir != "" {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			logger.Fatalf("invalid --data-dir %s: %v", dir, err)
+		}
+		os.Setenv("TFVENV_DATA_DIR", abs)
+	}
+	if system, _ := cmd.Flags().GetBool("system"); system {
+		os.Setenv("TFVENV_SYSTEM", "1")
+	}
+
+	if !userDirs.Shared() {
+		return
+	}
+	if userDirs.Home == "" {
+		logger.Warnf("no home directory; using the system-wide directories under %s. Set --data-dir or TFVENV_DATA_DIR to keep tfvenv's files elsewhere", userDirs.DataDir())
+	}
+	prepareSharedDirs()
+}
+
+// prepareSharedDirs readies the machine-wide directories for the users of a
+// shared runner. Files are created group-writable, the directories are
+// created setgid so that everything in them keeps their group, and a
+// directory this user cannot write to is reported up front rather than
+// halfway through a download.
+func prepareSharedDirs() {
+	shareFilesWithGroup()
+	for _, dir := range []string{userDirs.DataDir(), userDirs.CacheDir()} {
+		if err := ensureSharedDir(dir); err != nil {
+			logger.Warnf("%v", err)
+		}
+	}
+}
+
+// ensureSharedDir creates a machine-wide directory, or checks that this user
+// can write to the existing one.
+func ensureSharedDir(dir string) error {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := os.MkdirAll(dir, 0775); err != nil {
+			return fmt.Errorf("cannot create %s: %w. Have an administrator create it for the runner group (e.g. 'install -d -m 2775 -g <group> %s'), or use --data-dir", dir, err, dir)
+		}
+		return os.Chmod(dir, 0775|os.ModeSetgid)
+	}
+
+	probe, err := os.CreateTemp(dir, ".tfvenv-write-check-")
+	if err != nil {
+		return fmt.Errorf("%s is not writable: %w. Commands that download or record anything will fail; join the group that owns it, or use --data-dir", dir, err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
+
+// dirsCmd prints where tfvenv keeps its per-user files.
+func dirsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dirs",
+		Short: "Show the data, cache and config directories tfvenv uses",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			fmt.Printf("Data:         %s\n", userDirs.DataDir())
+			fmt.Printf("Cache:        %s\n", userDirs.CacheDir())
+			fmt.Printf("Config:       %s\n", userDirs.ConfigDir())
+			fmt.Printf("Plugin cache: %s\n", defaultPluginCacheDir())
+			if userDirs.Shared() {
+				fmt.Println("\nThese are the system-wide directories shared by every user of this host.")
+			}
+			if legacy := userDirs.LegacyDir(); hasLegacyEntries(legacy) {
+				fmt.Printf("\n%s has not been migrated yet. Run 'tfvenv dirs migrate' to move it.\n", legacy)
+			}
+		},
+	}
+
+	cmd.AddCommand(dirsMigrateCmd())
+	return cmd
+}
+
+// dirsMigrateCmd moves the contents of ~/.tfvenv into the XDG layout.
+func dirsMigrateCmd() *cobra.Command {
+	var dryRun, noLink bool
+
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Move ~/.tfvenv into the data and cache directories",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			legacy := userDirs.LegacyDir()
+			if legacy == "" {
+				fmt.Println("There is no per-user ~/.tfvenv to migrate.")
+				return
+			}
+			entries, err := os.ReadDir(legacy)
+			if os.IsNotExist(err) {
+				fmt.Printf("%s does not exist, nothing to migrate.\n", legacy)
+				return
+			}
+			if err != nil {
+				logger.Errorf("error reading %s: %v", legacy, err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+
+			// Environments created earlier reference the old paths in their
+			// activation scripts, so a symlink is left behind by default
+			link := !noLink && runtime.GOOS != "windows"
+			moved, skipped := 0, 0
+			for _, entry := range entries {
+				src := filepath.Join(legacy, entry.Name())
+				if entry.Type()&os.ModeSymlink != 0 {
+					continue
+				}
+				dst := migrationTarget(entry.Name())
+				if _, err := os.Lstat(dst); err == nil {
+					fmt.Printf("Skipping %s: %s already exists. Merge them by hand.\n", src, dst)
+					skipped++
+					continue
+				}
+				if dryRun {
+					printDryRun("would move %s to %s", src, dst)
+					if link {
+						printDryRun("would link %s to %s", src, dst)
+					}
+					continue
+				}
+
+				if err := moveTree(src, dst); err != nil {
+					logger.Errorf("error moving %s to %s: %v", src, dst, err)
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+				if link {
+					if err := os.Symlink(dst, src); err != nil {
+						logger.Errorf("error linking %s to %s: %v", src, dst, err)
+						i18n.Println("error", err)
+						os.Exit(1)
+					}
+				}
+				logger.Infof("migrated %s to %s", src, dst)
+				fmt.Printf("Moved %s to %s\n", src, dst)
+				moved++
+			}
+
+			if dryRun {
+				fmt.Println("Dry run complete; nothing was moved.")
+				return
+			}
+			if !link && skipped == 0 {
+				if err := os.Remove(legacy); err == nil {
+					fmt.Printf("Removed %s.\n", legacy)
+				}
+			}
+			if !link && moved > 0 {
+				fmt.Println("Run 'tfvenv create <env-name> --repair' for each environment to point its activation scripts at the new directories.")
+			}
+			fmt.Printf("Migrated %d item(s).\n", moved)
+		},
+	}
+
+	addDryRunFlag(cmd, &dryRun)
+	cmd.Flags().BoolVar(&noLink, "no-link", false, "Do not leave symlinks at the old locations")
+	return cmd
+}
+
+// migrationTarget returns where an entry of ~/.tfvenv belongs in the XDG layout.
+func migrationTarget(name string) string {
+	if name == "plugin-cache" {
+		return filepath.Join(userDirs.CacheDir(), name)
+	}
+	return filepath.Join(userDirs.DataDir(), name)
+}
+
+// hasLegacyEntries reports whether dir holds anything that is not already a
+// symlink into the new layout.
+func hasLegacyEntries(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if entry.Type()&os.ModeSymlink == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// moveTree moves src to dst, copying when they are on different filesystems.
+func moveTree(src, dst string) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(dst), err)
+	}
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, relPath)
+		if info.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm())
+		}
+		return copyFile(path, target)
+	})
+	if err != nil {
+		os.RemoveAll(dst)
+		return fmt.Errorf("failed to copy %s: %w", src, err)
+	}
+	return os.RemoveAll(src)
+}
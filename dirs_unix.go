@@ -0,0 +1,13 @@
+//go:build !windows
+
+package main
+
+import "syscall"
+
+// shareFilesWithGroup clears the group write bit from the umask, so the files
+// and directories this process creates in the machine-wide directories can be
+// updated by the other members of their group.
+func shareFilesWithGroup() {
+	mask := syscall.Umask(0)
+	syscall.Umask(mask &^ 0020)
+}
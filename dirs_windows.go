@@ -0,0 +1,7 @@
+//go:build windows
+
+package main
+
+// shareFilesWithGroup does nothing on Windows, where files in ProgramData
+// inherit the access rules of their directory.
+func shareFilesWithGroup() {}
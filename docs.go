@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// docsCmd generates terraform-docs README sections for the environment's modules
+func docsCmd() *cobra.Command {
+	var check bool
+	var outputFile string
+	var formatter string
+
+	cmd := &cobra.Command{
+		Use:   "docs <env-name>",
+		Short: "Generate or check terraform-docs README sections for the specified environment's modules",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envDir := viper.GetString("env-dir")
+			envPath := filepath.Join(envDir, envName)
+			configDir := filepath.Join(envPath, "config", envName)
+
+			tfDocs, err := resolveToolBinary(envPath, "terraform-docs")
+			if err != nil {
+				logger.Errorf("terraform-docs not found: %v", err)
+				fmt.Println("Error: terraform-docs is not installed in the environment or on PATH.")
+				os.Exit(1)
+			}
+
+			modules, err := findTerraformModules(configDir)
+			if err != nil {
+				logger.Errorf("error finding modules in %s: %v", configDir, err)
+				fmt.Printf("Error finding modules: %v\n", err)
+				os.Exit(1)
+			}
+			if len(modules) == 0 {
+				fmt.Printf("No Terraform modules found in %s.\n", configDir)
+				logger.Warnf("no Terraform modules found in %s", configDir)
+				return
+			}
+
+			stale := 0
+			for _, moduleDir := range modules {
+				upToDate, err := runTerraformDocs(tfDocs, moduleDir, formatter, outputFile, check)
+				if err != nil {
+					logger.Errorf("terraform-docs failed for %s: %v", moduleDir, err)
+					fmt.Printf("Error generating docs for %s: %v\n", moduleDir, err)
+					os.Exit(1)
+				}
+
+				readme := filepath.Join(moduleDir, outputFile)
+				switch {
+				case check && !upToDate:
+					stale++
+					fmt.Printf("Stale documentation: %s\n", readme)
+				case check:
+					fmt.Printf("Up to date: %s\n", readme)
+				default:
+					fmt.Printf("Updated: %s\n", readme)
+				}
+			}
+
+			if check && stale > 0 {
+				logger.Warnf("%d module README(s) are out of date in environment '%s'", stale, envName)
+				fmt.Printf("%d module README(s) are out of date. Run 'tfvenv docs %s' to regenerate them.\n", stale, envName)
+				os.Exit(1)
+			}
+			logger.Infof("docs processed %d module(s) for environment '%s'", len(modules), envName)
+		},
+	}
+
+	cmd.Flags().BoolVar(&check, "check", false, "Fail if any README is out of date instead of rewriting it")
+	cmd.Flags().StringVar(&outputFile, "output-file", "README.md", "README file, relative to each module, to inject documentation into")
+	cmd.Flags().StringVar(&formatter, "formatter", "markdown table", "terraform-docs formatter to use")
+
+	return cmd
+}
+
+// findTerraformModules returns every directory under root that contains .tf files.
+func findTerraformModules(root string) ([]string, error) {
+	dirs := make(map[string]bool)
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".terraform" || info.Name() == ".terragrunt-cache" || info.Name() == backupsDirName {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(info.Name(), ".tf") {
+			dirs[filepath.Dir(path)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk %s: %w", root, err)
+	}
+
+	modules := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		modules = append(modules, dir)
+	}
+	sort.Strings(modules)
+	return modules, nil
+}
+
+// runTerraformDocs injects terraform-docs output into the module's README.
+// In check mode it reports whether the README is already up to date without modifying it.
+func runTerraformDocs(tfDocs, moduleDir, formatter, outputFile string, check bool) (bool, error) {
+	args := strings.Fields(formatter)
+	args = append(args, "--output-file", outputFile, "--output-mode", "inject")
+	if check {
+		args = append(args, "--output-check")
+	}
+	args = append(args, moduleDir)
+
+	cmdDocs := exec.Command(tfDocs, args...)
+	output, err := cmdDocs.CombinedOutput()
+	if err != nil {
+		if _, ok := err.(*exec.ExitError); ok && check {
+			return false, nil
+		}
+		return false, fmt.Errorf("%v, output: %s", err, string(output))
+	}
+	return true, nil
+}
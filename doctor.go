@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"tfvenv/i18n"
+)
+
+// Doctor check outcomes.
+const (
+	doctorOK   = "ok"
+	doctorWarn = "warn"
+	doctorFail = "fail"
+)
+
+// doctorResult is the outcome of a single doctor check.
+type doctorResult struct {
+	Name   string
+	Status string
+	Detail string
+	Hint   string
+}
+
+// doctorCmd diagnoses an environment's binaries, configuration and cloud access.
+func doctorCmd() *cobra.Command {
+	var fixPath bool
+
+	cmd := &cobra.Command{
+		Use:   "doctor [env-name]",
+		Short: "Diagnose common problems with an environment (defaults to the active one)",
+		Args:  cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := os.Getenv("TFVENV_ENV")
+			if len(args) == 1 {
+				envName = args[0]
+			}
+			if envName == "" {
+				fmt.Println("Error: no environment given and none is active.")
+				os.Exit(1)
+			}
+			envDir := viper.GetString("env-dir")
+			envPath := filepath.Join(envDir, envName)
+			if _, err := os.Stat(envPath); os.IsNotExist(err) {
+				i18n.Println("env.not_found", envName)
+				os.Exit(1)
+			}
+
+			if fixPath {
+				if err := fixEnvPath(envPath, envName); err != nil {
+					logger.Errorf("error fixing PATH for %s: %v", envName, err)
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+				fmt.Println()
+			}
+
+			results := runDoctorChecks(envPath, envName)
+			failures := 0
+			for _, result := range results {
+				fmt.Printf("[%-4s] %s: %s\n", strings.ToUpper(result.Status), result.Name, result.Detail)
+				if result.Hint != "" {
+					fmt.Printf("       %s\n", result.Hint)
+				}
+				if result.Status == doctorFail {
+					failures++
+				}
+			}
+
+			if failures > 0 {
+				logger.Errorf("doctor found %d problem(s) in %s", failures, envName)
+				i18n.Println("doctor.problems", failures)
+				os.Exit(1)
+			}
+			i18n.Println("doctor.no_problems")
+			logger.Infof("doctor found no problems in %s", envName)
+		},
+	}
+
+	cmd.Flags().BoolVar(&fixPath, "fix-path", false, "Regenerate the activation scripts and remove activation variables from shell startup files")
+	return cmd
+}
+
+// runDoctorChecks runs every check against the environment.
+func runDoctorChecks(envPath, envName string) []doctorResult {
+	results := []doctorResult{
+		checkDoctorBinary(envPath, envTool(envPath, envName)),
+		checkDoctorTerragrunt(envPath, envName),
+		checkDoctorPermissions(envPath, envName),
+		checkDoctorPath(envPath),
+		checkDoctorRcFiles(),
+	}
+
+	configPath := filepath.Join(envPath, "config", envName, tfvenvrcFileName)
+	problems, _, err := validateConfigFile(configPath)
+	switch {
+	case err != nil:
+		results = append(results, doctorResult{Name: "config", Status: doctorFail, Detail: err.Error()})
+		return results
+	case len(problems) > 0:
+		results = append(results, doctorResult{
+			Name:   "config",
+			Status: doctorFail,
+			Detail: strings.Join(problems, "; "),
+			Hint:   fmt.Sprintf("Run 'tfvenv config validate %s' for details.", envName),
+		})
+	default:
+		results = append(results, doctorResult{Name: "config", Status: doctorOK, Detail: configPath})
+	}
+
+	config, err := readConfig(configPath)
+	if err == nil {
+		results = append(results, checkDoctorAWS(config))
+	}
+	return results
+}
+
+// checkDoctorBinary reports the version of an environment binary.
+func checkDoctorBinary(envPath, tool string) doctorResult {
+	binaryPath := envBinaryPath(envPath, tool)
+	if !fileExists(binaryPath) {
+		status := doctorFail
+		if tool == "terragrunt" {
+			status = doctorWarn
+		}
+		hint := fmt.Sprintf("Run 'tfvenv --env-dir %s install-%s' to install it.", envPath, tool)
+		if tool == toolTofu {
+			hint = fmt.Sprintf("Run 'tfvenv repair %s' to install it.", filepath.Base(envPath))
+		}
+		return doctorResult{Name: tool, Status: status, Detail: "not installed", Hint: hint}
+	}
+	installed, err := getBinaryVersion(binaryPath, tool)
+	if err != nil {
+		return doctorResult{Name: tool, Status: doctorFail, Detail: fmt.Sprintf("%s does not run: %v", binaryPath, err)}
+	}
+	return doctorResult{Name: tool, Status: doctorOK, Detail: installed}
+}
+
+// checkDoctorTerragrunt reports the version of the environment's Terragrunt,
+// which Terraform-only environments do without.
+func checkDoctorTerragrunt(envPath, envName string) doctorResult {
+	if envTerraformOnly(envPath, envName) {
+		return doctorResult{Name: "terragrunt", Status: doctorOK, Detail: "not used (Terraform-only environment)"}
+	}
+	return checkDoctorBinary(envPath, "terragrunt")
+}
+
+// checkDoctorAWS verifies that the environment's AWS credentials work. SSO
+// profiles whose session expired get a hint to log in again.
+func checkDoctorAWS(config Config) doctorResult {
+	result := doctorResult{Name: "aws"}
+	if config.AWSProfile == "" && config.AccessKey == "" && os.Getenv("AWS_PROFILE") == "" {
+		result.Status = doctorOK
+		result.Detail = "no AWS profile or keys configured, skipped"
+		return result
+	}
+
+	sess, err := newAWSSession(config)
+	if err != nil {
+		result.Status = doctorFail
+		result.Detail = fmt.Sprintf("failed to load AWS configuration: %v", err)
+		return result
+	}
+	identity, err := sts.New(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if err != nil {
+		result.Status = doctorFail
+		result.Detail = fmt.Sprintf("credentials rejected: %v", err)
+		if aerr, ok := err.(awserr.Error); ok {
+			result.Detail = fmt.Sprintf("credentials rejected: %s", aerr.Message())
+		}
+		if config.AWSProfile != "" && isSSOProfile(config.AWSProfile) {
+			result.Hint = fmt.Sprintf("The SSO session may have expired. Run 'aws sso login --profile %s'.", config.AWSProfile)
+		}
+		return result
+	}
+
+	result.Status = doctorOK
+	result.Detail = fmt.Sprintf("authenticated as %s", *identity.Arn)
+	if config.AWSProfile != "" {
+		result.Detail += fmt.Sprintf(" (profile %s)", config.AWSProfile)
+	}
+	return result
+}
+
+// isSSOProfile reports whether the named profile in the shared AWS config uses IAM Identity Center.
+func isSSOProfile(profile string) bool {
+	configFile := os.Getenv("AWS_CONFIG_FILE")
+	if configFile == "" {
+		configFile = filepath.Join(os.Getenv("HOME"), ".aws", "config")
+	}
+	f, err := os.Open(configFile)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	section := "profile " + profile
+	if profile == "default" {
+		section = "default"
+	}
+	inSection := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			inSection = strings.TrimSpace(line[1:len(line)-1]) == section
+			continue
+		}
+		if inSection && (strings.HasPrefix(line, "sso_start_url") || strings.HasPrefix(line, "sso_session")) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// driftReport summarizes the changes terraform plan detected for an environment.
+// Environments with several root modules get one report per root in Roots,
+// and the totals across them.
+type driftReport struct {
+	Environment string        `json:"environment"`
+	Root        string        `json:"root,omitempty"`
+	Drifted     bool          `json:"drifted"`
+	Add         int           `json:"add"`
+	Change      int           `json:"change"`
+	Destroy     int           `json:"destroy"`
+	Resources   []string      `json:"resources,omitempty"`
+	Roots       []driftReport `json:"roots,omitempty"`
+}
+
+// terraformPlanJSON is the subset of `terraform show -json <plan>` output used for drift reports.
+type terraformPlanJSON struct {
+	ResourceChanges []struct {
+		Address string `json:"address"`
+		Change  struct {
+			Actions []string `json:"actions"`
+		} `json:"change"`
+	} `json:"resource_changes"`
+}
+
+// driftCmd detects drift between the environment's configuration and its real infrastructure
+func driftCmd() *cobra.Command {
+	var jsonOutput bool
+	var exitCode bool
+
+	cmd := &cobra.Command{
+		Use:   "drift <env-name>",
+		Short: "Detect drift by running terraform plan -detailed-exitcode for the specified environment",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			// stdout carries the JSON report, so logs go elsewhere
+			if jsonOutput && os.Getenv("TFVENV_LOG_FILE") == "" {
+				logger.Out = os.Stderr
+			}
+			envName := args[0]
+			envDir := viper.GetString("env-dir")
+			envPath := filepath.Join(envDir, envName)
+
+			// Hold the environment lock for the whole plan so nothing changes underneath it
+			if err := acquireEnvLock(envPath); err != nil {
+				logger.Errorf("error locking environment '%s': %v", envName, err)
+				fmt.Printf("Error locking environment '%s': %v\n", envName, err)
+				os.Exit(1)
+			}
+
+			removeCleanup := onInterrupt(func() { releaseEnvLock(envPath) })
+
+			report, err := detectDrift(envPath, envName, !jsonOutput)
+			removeCleanup()
+			if releaseErr := releaseEnvLock(envPath); releaseErr != nil {
+				logger.Warnf("failed to release lock for environment '%s': %v", envName, releaseErr)
+			}
+			if err != nil {
+				logger.Errorf("drift detection failed: %v", err)
+				fmt.Printf("Error detecting drift: %v\n", err)
+				os.Exit(1)
+			}
+
+			if !jsonOutput {
+				for _, root := range report.Roots {
+					status := "no drift"
+					if root.Drifted {
+						status = fmt.Sprintf("%d to add, %d to change, %d to destroy", root.Add, root.Change, root.Destroy)
+					}
+					fmt.Printf("Root %s: %s\n", rootLabel(envName, root.Root), status)
+				}
+			}
+			if jsonOutput {
+				out, _ := json.MarshalIndent(report, "", "  ")
+				fmt.Println(string(out))
+			} else if report.Drifted {
+				fmt.Printf("Drift detected in environment '%s': %d to add, %d to change, %d to destroy.\n", envName, report.Add, report.Change, report.Destroy)
+			} else {
+				fmt.Printf("No drift detected in environment '%s'.\n", envName)
+			}
+			logger.Infof("drift check for '%s': add=%d change=%d destroy=%d", envName, report.Add, report.Change, report.Destroy)
+
+			// Mirror terraform's detailed exit codes for scheduled jobs
+			if exitCode && report.Drifted {
+				os.Exit(2)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the drift report as JSON")
+	cmd.Flags().BoolVar(&exitCode, "exit-code", false, "Exit with status 2 when drift is detected (for scheduled jobs)")
+
+	return cmd
+}
+
+// detectDrift initializes the environment, runs a detailed-exitcode plan in each
+// root module, and summarizes the result.
+func detectDrift(envPath, envName string, showPlan bool) (driftReport, error) {
+	report := driftReport{Environment: envName}
+
+	configPath := filepath.Join(envPath, "config", envName, tfvenvrcFileName)
+	config, err := readConfig(configPath)
+	if err != nil {
+		logger.Warnf("error reading %s, continuing without environment variables: %v", configPath, err)
+	}
+	if config.EnvVars, err = renderEnvVars(envPath, envName, config); err != nil {
+		return report, err
+	}
+	if config.EnvVars, err = resolveEnvVars(config.EnvVars); err != nil {
+		return report, err
+	}
+
+	decrypted, cleanupSecrets, err := decryptSopsVarFiles(envPath, envName, filepath.Join(envPath, "config", envName))
+	if err != nil {
+		return report, err
+	}
+	defer cleanupSecrets()
+
+	roots, err := envRoots(envPath, envName)
+	if err != nil {
+		return report, err
+	}
+	if len(roots) == 1 && roots[0] == "." {
+		return detectRootDrift(envPath, envName, ".", config.EnvVars, decrypted, showPlan)
+	}
+
+	var failed []string
+	for _, root := range roots {
+		rootReport, err := detectRootDrift(envPath, envName, root, config.EnvVars, decrypted, showPlan)
+		if err != nil {
+			logger.Errorf("drift detection failed for %s: %v", rootLabel(envName, root), err)
+			failed = append(failed, fmt.Sprintf("%s: %v", rootLabel(envName, root), err))
+			continue
+		}
+		rootReport.Root = root
+		report.Roots = append(report.Roots, rootReport)
+		report.Drifted = report.Drifted || rootReport.Drifted
+		report.Add += rootReport.Add
+		report.Change += rootReport.Change
+		report.Destroy += rootReport.Destroy
+		for _, address := range rootReport.Resources {
+			report.Resources = append(report.Resources, filepath.ToSlash(root)+":"+address)
+		}
+	}
+	if len(failed) > 0 {
+		return report, fmt.Errorf("%d of %d root(s) failed:\n  %s", len(failed), len(roots), strings.Join(failed, "\n  "))
+	}
+	return report, nil
+}
+
+// detectRootDrift runs the detailed-exitcode plan for a single root module.
+func detectRootDrift(envPath, envName, root string, envVars map[string]string, decrypted map[string]string, showPlan bool) (driftReport, error) {
+	report := driftReport{Environment: envName}
+
+	if _, err := runConfiguredTerraform(envPath, envName, root, envVars, false, "init", "-input=false"); err != nil {
+		return report, err
+	}
+
+	planFile := filepath.Join(rootDataDir(absPath(envPath), root), "drift.tfplan")
+	defer os.Remove(planFile)
+
+	planArgs := append([]string{"plan", "-detailed-exitcode", "-input=false", "-out=" + planFile}, sopsVarFileArgs(decrypted)...)
+	code, err := runConfiguredTerraform(envPath, envName, root, envVars, showPlan, planArgs...)
+	if err != nil && code != 2 {
+		return report, err
+	}
+	if code != 2 {
+		return report, nil
+	}
+
+	report.Drifted = true
+	cmdShow, err := envRootCommand(envPath, envName, root, "show", "-json", planFile)
+	if err != nil {
+		return report, err
+	}
+	applyConfigEnv(cmdShow, envVars)
+	output, err := cmdShow.Output()
+	if err != nil {
+		return report, fmt.Errorf("terraform show failed: %w", err)
+	}
+
+	var plan terraformPlanJSON
+	if err := json.Unmarshal(output, &plan); err != nil {
+		return report, fmt.Errorf("failed to parse plan JSON: %w", err)
+	}
+
+	for _, rc := range plan.ResourceChanges {
+		changed := true
+		switch {
+		case len(rc.Change.Actions) == 2:
+			// ["delete","create"] or ["create","delete"] is a replacement
+			report.Add++
+			report.Destroy++
+		case len(rc.Change.Actions) == 1 && rc.Change.Actions[0] == "create":
+			report.Add++
+		case len(rc.Change.Actions) == 1 && rc.Change.Actions[0] == "update":
+			report.Change++
+		case len(rc.Change.Actions) == 1 && rc.Change.Actions[0] == "delete":
+			report.Destroy++
+		default:
+			changed = false
+		}
+		if changed {
+			report.Resources = append(report.Resources, rc.Address)
+		}
+	}
+
+	return report, nil
+}
+
+// runConfiguredTerraform runs the environment's terraform in a root module with the .tfvenvrc
+// variables applied. It returns the process exit code alongside any error.
+func runConfiguredTerraform(envPath, envName, root string, envVars map[string]string, stream bool, args ...string) (int, error) {
+	cmdTf, err := envRootCommand(envPath, envName, root, args...)
+	if err != nil {
+		return -1, err
+	}
+	// Keep cleanup away from the providers init is installing, and once they
+	// are unlocked, record their use and keep the cache within its limit
+	if args[0] == "init" {
+		release := holdProviderLocks(envPath, envName, root)
+		defer func() {
+			release()
+			trackPluginCacheUse(envPath, envName, filepath.Join(envPath, "config", envName, root, dependencyLockFileName))
+		}()
+	}
+	applyConfigEnv(cmdTf, envVars)
+
+	var output []byte
+	if stream {
+		cmdTf.Stdout = os.Stdout
+		cmdTf.Stderr = os.Stderr
+		err = cmdTf.Run()
+	} else {
+		output, err = cmdTf.CombinedOutput()
+	}
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), fmt.Errorf("terraform %s exited with status %d: %s", args[0], exitErr.ExitCode(), string(output))
+	}
+	if err != nil {
+		return -1, fmt.Errorf("failed to run terraform %s: %w", args[0], err)
+	}
+	return 0, nil
+}
+
+// applyConfigEnv adds the environment variables declared in .tfvenvrc to a prepared command,
+// the same variables the activation scripts would export.
+func applyConfigEnv(cmd *exec.Cmd, envVars map[string]string) {
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	for key, value := range envVars {
+		cmd.Env = append(cmd.Env, key+"="+value)
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+)
+
+// addDryRunFlag registers the --dry-run flag shared by mutating commands.
+func addDryRunFlag(cmd *cobra.Command, dryRun *bool) {
+	cmd.Flags().BoolVar(dryRun, "dry-run", false, "Print what would be downloaded, written or removed without changing anything")
+}
+
+// printDryRun prints one action a --dry-run would have taken.
+func printDryRun(format string, args ...interface{}) {
+	fmt.Printf("[dry-run] "+format+"\n", args...)
+}
+
+// formatSize renders a byte count with a binary unit.
+func formatSize(n int64) string {
+	if n < 0 {
+		return "unknown size"
+	}
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// treeSize returns the number of files and their total size under path.
+func treeSize(path string) (int, int64) {
+	files, size := 0, int64(0)
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files++
+			size += info.Size()
+		}
+		return nil
+	})
+	return files, size
+}
+
+// remoteSize returns the size a HEAD request reports for url, or -1 if it is unknown.
+func remoteSize(url string) int64 {
+	req, err := http.NewRequestWithContext(rootCtx, http.MethodHead, url, nil)
+	if err != nil {
+		return -1
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return -1
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return -1
+	}
+	return resp.ContentLength
+}
+
+// planBinaryInstall prints what downloadAndInstallBinary would download and replace.
+func planBinaryInstall(baseURL, version, envPath, tool string) error {
+	if version == "latest" {
+		latest, err := getLatestVersion(tool, false)
+		if err != nil {
+			return fmt.Errorf("failed to fetch latest version for %s: %w", tool, err)
+		}
+		version = latest
+	}
+
+	binaryPath := envBinaryPath(envPath, tool)
+	replacing := ""
+	if fileExists(binaryPath) {
+		if existing, err := getBinaryVersion(binaryPath, tool); err == nil {
+			if existing == version {
+				printDryRun("%s %s is already installed at %s, nothing to download", tool, version, binaryPath)
+				return nil
+			}
+			replacing = fmt.Sprintf(", replacing %s", existing)
+		}
+	}
+
+	downloadURL, _, err := binaryDownloadURL(baseURL, version, filepath.Join(envPath, "bin"), tool)
+	if err != nil {
+		return err
+	}
+	printDryRun("would download %s %s from %s (%s) to %s%s", tool, version, downloadURL, formatSize(remoteSize(downloadURL)), binaryPath, replacing)
+	return nil
+}
+
+// planCreate prints the directories, downloads and files initEnv would create.
+// Existing configuration files are kept; scripts are only rewritten if missing or on repair.
+func planCreate(envPath, envName, tool, tfVersion, tgVersion string, repair bool) error {
+	configEnvDir := filepath.Join(envPath, "config", envName)
+	templatesDir := filepath.Join(envPath, "templates")
+	binDir := filepath.Join(envPath, "bin")
+
+	for _, dir := range []string{defaultPluginCacheDir(), filepath.Join(envPath, "terraform-data"), binDir, configEnvDir, templatesDir} {
+		if _, err := os.Stat(dir); os.IsNotExist(err) {
+			printDryRun("would create directory %s", dir)
+		}
+	}
+
+	if err := planBinaryInstall(toolDownloadURL(tool), tfVersion, envPath, tool); err != nil {
+		return err
+	}
+	if tgVersion != "none" {
+		if err := planBinaryInstall(terragruntDownloadURL, tgVersion, envPath, "terragrunt"); err != nil {
+			return err
+		}
+	}
+
+	templates := []string{filepath.Join(templatesDir, fmt.Sprintf("%s.tfvars.template", envName))}
+	configFiles := []string{filepath.Join(configEnvDir, fmt.Sprintf("%s.tfvars", envName))}
+	if tgVersion != "none" || fileExists(envBinaryPath(envPath, "terragrunt")) {
+		templates = append(templates, filepath.Join(templatesDir, fmt.Sprintf("terragrunt.%s.hcl.template", envName)))
+		configFiles = append(configFiles, filepath.Join(configEnvDir, fmt.Sprintf("terragrunt.%s.hcl", envName)))
+	}
+	for _, template := range templates {
+		if !fileExists(template) {
+			printDryRun("would write %s", template)
+		}
+	}
+	for _, path := range configFiles {
+		if fileExists(path) {
+			printDryRun("would keep existing %s", path)
+		} else {
+			printDryRun("would write %s", path)
+		}
+	}
+	for _, script := range []string{"activate.sh", "activate.fish", "Activate.ps1", "deactivate.sh", "deactivate.fish", "Deactivate.ps1"} {
+		path := filepath.Join(binDir, script)
+		switch {
+		case !fileExists(path):
+			printDryRun("would write %s", path)
+		case repair:
+			printDryRun("would overwrite %s", path)
+		}
+	}
+	return nil
+}
+
+// planMerge prints the backups mergeConfigurations would take, and what it
+// would add from the templates and how it would settle conflicts.
+func planMerge(envPath, envType, strategy string) error {
+	templatesDir := filepath.Join(envPath, "templates")
+	configEnvDir := filepath.Join(envPath, "config", envType)
+	pairs := [][2]string{
+		{filepath.Join(templatesDir, fmt.Sprintf("%s.tfvars.template", envType)), filepath.Join(configEnvDir, fmt.Sprintf("%s.tfvars", envType))},
+		{filepath.Join(templatesDir, fmt.Sprintf("terragrunt.%s.hcl.template", envType)), filepath.Join(configEnvDir, fmt.Sprintf("terragrunt.%s.hcl", envType))},
+	}
+
+	for _, pair := range pairs {
+		templatePath, targetPath := pair[0], pair[1]
+		if !fileExists(targetPath) {
+			continue
+		}
+		printDryRun("would back up %s to %s", targetPath, filepath.Join(envPath, backupsDirName, "<timestamp>"))
+		if !fileExists(templatePath) {
+			continue
+		}
+		templateContent, err := os.ReadFile(templatePath)
+		if err != nil {
+			return fmt.Errorf("failed to read template file %s: %w", templatePath, err)
+		}
+		targetContent, err := os.ReadFile(targetPath)
+		if err != nil {
+			return fmt.Errorf("failed to read environment file %s: %w", targetPath, err)
+		}
+		if parseErr := hclParseError(targetPath, templateContent, targetContent); parseErr != nil {
+			if strategy != mergeOurs {
+				return fmt.Errorf("cannot apply --strategy %s: %w", strategy, parseErr)
+			}
+			missing := missingTemplateLines(templateContent, targetContent)
+			if len(missing) == 0 {
+				printDryRun("%s is up to date with %s", targetPath, templatePath)
+				continue
+			}
+			printDryRun("would append %d line(s) to %s:", len(missing), targetPath)
+			for _, line := range missing {
+				fmt.Printf("    + %s\n", line)
+			}
+			continue
+		}
+
+		var ask []string
+		_, result, err := mergeHCL(filepath.Base(targetPath), templateContent, targetContent, func(conflict mergeConflict) (bool, error) {
+			if strategy == mergeInteractive {
+				ask = append(ask, conflict.Name)
+				return false, nil
+			}
+			return strategy == mergeTheirs, nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(result.Added)+len(result.Ours)+len(result.Theirs)+len(ask) == 0 {
+			printDryRun("%s is up to date with %s", targetPath, templatePath)
+			continue
+		}
+		printDryRun("would merge %s into %s:", templatePath, targetPath)
+		for _, name := range result.Added {
+			fmt.Printf("    + %s\n", name)
+		}
+		for _, name := range result.Theirs {
+			fmt.Printf("    ~ %s (template's definition)\n", name)
+		}
+		if strategy == mergeOurs {
+			for _, name := range result.Ours {
+				fmt.Printf("    = %s (environment's definition kept)\n", name)
+			}
+		}
+		for _, name := range ask {
+			fmt.Printf("    ? %s (would ask)\n", name)
+		}
+	}
+	return nil
+}
+
+// planRestoreLatestBackup prints the files restoreLatestBackup would restore.
+func planRestoreLatestBackup(envPath string) error {
+	sets, err := listBackupSets(envPath)
+	if err != nil {
+		return err
+	}
+	if len(sets) == 0 {
+		return fmt.Errorf("no backups found in %s", filepath.Join(envPath, backupsDirName))
+	}
+	latest := sets[len(sets)-1]
+	return filepath.Walk(latest, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		relPath, err := filepath.Rel(latest, path)
+		if err != nil {
+			return err
+		}
+		printDryRun("would restore %s from %s", filepath.Join(envPath, relPath), path)
+		return nil
+	})
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// pinnedVersion reports whether a .tfvenvrc version names a specific release.
+func pinnedVersion(v string) bool {
+	return v != "" && v != "latest" && v != "none"
+}
+
+// versionDrift compares the environment's installed binaries with the versions
+// pinned in .tfvenvrc and describes every mismatch.
+func versionDrift(envPath, envName string, config Config) []string {
+	tool := envTool(envPath, envName)
+	pins := []struct {
+		tool    string
+		version string
+	}{
+		{tool, config.TfVersion},
+		{"terragrunt", config.TgVersion},
+	}
+
+	var drift []string
+	for _, pin := range pins {
+		if !pinnedVersion(pin.version) {
+			continue
+		}
+		binaryPath := envBinaryPath(envPath, pin.tool)
+		if !fileExists(binaryPath) {
+			drift = append(drift, fmt.Sprintf("%s %s is pinned but not installed", pin.tool, pin.version))
+			continue
+		}
+		installed, err := getBinaryVersion(binaryPath, pin.tool)
+		if err != nil {
+			drift = append(drift, fmt.Sprintf("%s %s is pinned but %s does not run: %v", pin.tool, pin.version, binaryPath, err))
+			continue
+		}
+		if installed != pin.version {
+			drift = append(drift, fmt.Sprintf("%s %s is pinned but %s is installed", pin.tool, pin.version, installed))
+		}
+	}
+	return drift
+}
+
+// enforceVersions fails when ENFORCE_VERSIONS is set and the installed
+// binaries differ from the pinned versions.
+func enforceVersions(envPath, envName string, config Config) error {
+	if !config.EnforceVersions {
+		return nil
+	}
+	drift := versionDrift(envPath, envName, config)
+	if len(drift) == 0 {
+		return nil
+	}
+	return fmt.Errorf("installed binaries do not match %s (ENFORCE_VERSIONS is set): %s; run 'tfvenv --env-dir %s upgrade --sync --group %s' to reinstall the pinned versions",
+		tfvenvrcFileName, strings.Join(drift, "; "), filepath.Dir(envPath), envName)
+}
+
+// syncVersions returns the versions upgrade --sync installs in an environment:
+// the pinned ones, and the installed ones for tools that are not pinned.
+func syncVersions(target upgradeTarget, config Config) (string, string) {
+	versions := []string{config.TfVersion, config.TgVersion}
+	for i, tool := range []string{target.Tool, "terragrunt"} {
+		if pinnedVersion(versions[i]) || versions[i] == "none" {
+			continue
+		}
+		versions[i] = "none"
+		if installed, err := getBinaryVersion(envBinaryPath(target.Path, tool), tool); err == nil && installed != "" {
+			versions[i] = installed
+		}
+	}
+	return versions[0], versions[1]
+}
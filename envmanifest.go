@@ -0,0 +1,336 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	yaml "gopkg.in/yaml.v3"
+
+	"tfvenv/i18n"
+	"tfvenv/schemas"
+)
+
+// envManifestKind marks a file written by 'tfvenv export manifest'.
+const envManifestKind = "tfvenv/environment"
+
+// envManifest is a portable definition of one environment, meant to be
+// tracked in git: what 'tfvenv apply-manifest' needs to recreate it.
+type envManifest struct {
+	Kind      string            `yaml:"kind"`
+	Name      string            `yaml:"name"`
+	Tool      string            `yaml:"tool"`
+	TfVersion string            `yaml:"tf_version"`
+	TgVersion string            `yaml:"tg_version"`
+	Tools     map[string]string `yaml:"tools,omitempty"`
+	Workspace string            `yaml:"workspace,omitempty"`
+	Backend   manifestBackend   `yaml:"backend,omitempty"`
+	EnvVars   map[string]string `yaml:"env_vars,omitempty"`
+	// ProviderLocks holds the dependency lock file of each root module, keyed
+	// by the root's slash-separated path in the config directory.
+	ProviderLocks map[string]string `yaml:"provider_locks,omitempty"`
+}
+
+// exportManifestCmd writes an environment's definition as a single YAML file.
+func exportManifestCmd() *cobra.Command {
+	var output string
+
+	cmd := &cobra.Command{
+		Use:   "manifest <env-name>",
+		Short: "Write the environment's versions, tools, variables, backend and provider locks as portable YAML",
+		Long: `Write one YAML file describing the environment: tool and versions, custom
+tools, selected workspace, backend, environment variables and the provider
+lock file of each root module. Commit it to git and recreate the environment
+anywhere with 'tfvenv apply-manifest'. Variables that look like secrets are
+left out.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envDir := viper.GetString("env-dir")
+			envPath := filepath.Join(envDir, envName)
+			if _, err := os.Stat(envPath); os.IsNotExist(err) {
+				i18n.Println("env.not_found", envName)
+				os.Exit(1)
+			}
+
+			m, omitted, err := buildEnvManifest(envPath, envName)
+			if err != nil {
+				logger.Errorf("error exporting %s: %v", envName, err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			for _, key := range omitted {
+				fmt.Fprintf(os.Stderr, "Left out %s, which looks like a secret; set it on the target environment by hand.\n", key)
+			}
+
+			var buf bytes.Buffer
+			fmt.Fprintf(&buf, "# Environment manifest written by 'tfvenv export manifest %s'.\n# Recreate it with 'tfvenv apply-manifest <file>'.\n", envName)
+			encoder := yaml.NewEncoder(&buf)
+			encoder.SetIndent(2)
+			if err := encoder.Encode(m); err != nil {
+				logger.Errorf("error encoding manifest: %v", err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			encoder.Close()
+
+			if output == "" || output == "-" {
+				fmt.Print(buf.String())
+				return
+			}
+			if err := os.WriteFile(output, buf.Bytes(), 0644); err != nil {
+				logger.Errorf("error writing %s: %v", output, err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			summary.fileWritten(output)
+			fmt.Printf("Wrote %s\n", output)
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "", "File to write the manifest to (defaults to stdout)")
+	return cmd
+}
+
+// buildEnvManifest collects an environment's definition. It returns the
+// variables left out as secrets alongside it.
+func buildEnvManifest(envPath, envName string) (envManifest, []string, error) {
+	tfVersion, tgVersion, err := pinnedToolVersions(envPath, envName)
+	if err != nil {
+		return envManifest{}, nil, err
+	}
+	config, err := loadEnvConfig(envPath, envName)
+	if err != nil {
+		logger.Warnf("error reading %s of %s: %v", tfvenvrcFileName, envName, err)
+	}
+	meta, err := loadEnvMetadata(envPath)
+	if err != nil {
+		logger.Warnf("error reading metadata of %s: %v", envName, err)
+	}
+
+	m := envManifest{
+		Kind:      envManifestKind,
+		Name:      envName,
+		Tool:      resolveTool(config.Tool, meta.Tool),
+		TfVersion: tfVersion,
+		TgVersion: tgVersion,
+		Tools:     meta.Tools,
+		Workspace: meta.Workspace,
+		Backend: manifestBackend{
+			Bucket:        config.S3StateBucket,
+			Path:          config.S3StatePath,
+			Region:        config.Region,
+			DynamoDBTable: config.DynamoDBTable,
+		},
+	}
+	if config.AWSRegion != "" {
+		m.Backend.Region = config.AWSRegion
+	}
+
+	var omitted []string
+	for _, key := range sortedEnvKeys(config.EnvVars) {
+		if isSensitiveKey(key) {
+			omitted = append(omitted, key)
+			continue
+		}
+		if m.EnvVars == nil {
+			m.EnvVars = make(map[string]string)
+		}
+		m.EnvVars[key] = config.EnvVars[key]
+	}
+
+	configEnvDir := filepath.Join(envPath, "config", envName)
+	roots, err := envRoots(envPath, envName)
+	if err != nil {
+		roots = []string{"."}
+	}
+	for _, root := range roots {
+		content, err := os.ReadFile(filepath.Join(configEnvDir, root, dependencyLockFileName))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return m, nil, err
+		}
+		if m.ProviderLocks == nil {
+			m.ProviderLocks = make(map[string]string)
+		}
+		m.ProviderLocks[filepath.ToSlash(root)] = string(content)
+	}
+	return m, omitted, nil
+}
+
+// applyManifestCmd recreates an environment from an exported manifest.
+func applyManifestCmd() *cobra.Command {
+	var name string
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "apply-manifest <file>",
+		Short: "Create or update an environment from a file written by 'tfvenv export manifest'",
+		Long: `Create the environment a manifest describes, or bring an existing one in line
+with it: versions, tool, backend and variables are written to .tfvenvrc and
+synced as 'tfvenv up' does, custom tools are installed from tools.yaml, the
+workspace is selected and the provider lock files are written into the root
+modules.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			m, err := loadEnvManifest(args[0])
+			if err != nil {
+				logger.Errorf("error loading %s: %v", args[0], err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			if name != "" {
+				m.Name = name
+			}
+			envPath := filepath.Join(viper.GetString("env-dir"), m.Name)
+
+			if err := applyEnvManifest(envPath, m, dryRun); err != nil {
+				logger.Errorf("error applying %s to %s: %v", args[0], m.Name, err)
+				fmt.Printf("Error applying manifest to '%s': %v\n", m.Name, err)
+				os.Exit(1)
+			}
+			if !dryRun {
+				fmt.Printf("Environment '%s' matches %s.\n", m.Name, args[0])
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&name, "name", "", "Environment to create or update (defaults to the name in the manifest)")
+	addDryRunFlag(cmd, &dryRun)
+	return cmd
+}
+
+// loadEnvManifest reads and validates an environment manifest. Unknown keys
+// are rejected, as in tfvenv.yaml.
+func loadEnvManifest(path string) (envManifest, error) {
+	var m envManifest
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return m, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if err := schemas.ValidateYAML(schemas.EnvironmentManifest, data); err != nil {
+		return m, fmt.Errorf("%s %w", path, err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&m); err != nil {
+		return m, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if m.Kind != envManifestKind {
+		return m, fmt.Errorf("%s is not an environment manifest (kind %q, expected %q)", path, m.Kind, envManifestKind)
+	}
+	if m.Name == "" {
+		return m, fmt.Errorf("%s has no name", path)
+	}
+	if err := m.env().validate(); err != nil {
+		return m, fmt.Errorf("%s: %w", path, err)
+	}
+	for root := range m.ProviderLocks {
+		clean := filepath.Clean(filepath.FromSlash(root))
+		if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+			return m, fmt.Errorf("%s: provider lock root %q must be inside the config directory", path, root)
+		}
+	}
+	return m, nil
+}
+
+// env returns the part of the manifest tfvenv.yaml can also declare.
+func (m envManifest) env() manifestEnv {
+	return manifestEnv{
+		Name:      m.Name,
+		Tool:      m.Tool,
+		TfVersion: m.TfVersion,
+		TgVersion: m.TgVersion,
+		Backend:   m.Backend,
+		EnvVars:   m.EnvVars,
+	}
+}
+
+// applyEnvManifest brings the environment at envPath in line with m.
+func applyEnvManifest(envPath string, m envManifest, dryRun bool) error {
+	if err := upEnvironment(envPath, m.env(), dryRun); err != nil {
+		return err
+	}
+
+	meta, err := loadEnvMetadata(envPath)
+	if err != nil && !dryRun {
+		return err
+	}
+	if m.Workspace != "" && meta.Workspace != m.Workspace {
+		if dryRun {
+			printDryRun("would select workspace %s", m.Workspace)
+		} else if err := updateEnvMetadata(envPath, func(meta *EnvironmentMetadata) { meta.Workspace = m.Workspace }); err != nil {
+			return err
+		} else {
+			fmt.Printf("  ~ workspace: %s\n", m.Workspace)
+		}
+	}
+
+	if err := applyManifestTools(envPath, m.Tools, meta.Tools, dryRun); err != nil {
+		return err
+	}
+
+	configEnvDir := filepath.Join(envPath, "config", m.Name)
+	roots := make([]string, 0, len(m.ProviderLocks))
+	for root := range m.ProviderLocks {
+		roots = append(roots, root)
+	}
+	sort.Strings(roots)
+	for _, root := range roots {
+		lockPath := filepath.Join(configEnvDir, filepath.FromSlash(root), dependencyLockFileName)
+		current, err := os.ReadFile(lockPath)
+		if err == nil && string(current) == m.ProviderLocks[root] {
+			continue
+		}
+		if dryRun {
+			printDryRun("would write %s", lockPath)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(lockPath), 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %w", filepath.Dir(lockPath), err)
+		}
+		if err := writeFileWithMode(lockPath, []byte(m.ProviderLocks[root]), 0644); err != nil {
+			return err
+		}
+		fmt.Printf("  ~ %s\n", lockPath)
+	}
+	return nil
+}
+
+// applyManifestTools installs the custom tools a manifest lists at the
+// versions it lists, unless the environment already has them.
+func applyManifestTools(envPath string, wanted, installed map[string]string, dryRun bool) error {
+	if len(wanted) == 0 {
+		return nil
+	}
+	registry, err := loadToolRegistry()
+	if err != nil {
+		return err
+	}
+	for _, name := range sortedEnvKeys(wanted) {
+		if installed[name] == wanted[name] {
+			continue
+		}
+		tool, err := registry.lookup(name)
+		if err != nil {
+			return err
+		}
+		if dryRun {
+			printDryRun("would install %s %s", name, wanted[name])
+			continue
+		}
+		resolved, err := installCustomTool(envPath, tool, wanted[name])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("  + %s %s\n", name, resolved)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// envStateFileName is the file in an environment recording what is installed
+// in it. It is rewritten whenever tfvenv installs or activates binaries, so
+// commands that report on the environment need not run them.
+const envStateFileName = "state.json"
+
+// envState is the canonical record of an environment's installation.
+type envState struct {
+	Tool              string `json:"tool"`
+	TerraformVersion  string `json:"terraform_version"`
+	TerragruntVersion string `json:"terragrunt_version,omitempty"`
+	OS                string `json:"os"`
+	Architecture      string `json:"architecture"`
+	// Plugins maps provider source addresses to the versions pinned in the
+	// dependency lock files of the environment's roots.
+	Plugins   map[string]string `json:"plugins,omitempty"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// probeEnvState inspects the environment's own binaries, or their copies in
+// the version store, and its lock files. Binaries that are missing or do not
+// run are recorded with an empty version.
+func probeEnvState(envPath, envName string) envState {
+	tool := envTool(envPath, envName)
+	state := envState{
+		Tool:         tool,
+		OS:           runtime.GOOS,
+		Architecture: runtime.GOARCH,
+		Plugins:      lockedPlugins(envPath, envName),
+		UpdatedAt:    time.Now().UTC(),
+	}
+	if v, err := getTerraformVersion(envPath, envName, tool); err != nil {
+		logger.Warnf("failed to probe %s: %v", toolDisplayName(tool), err)
+	} else {
+		state.TerraformVersion = v
+	}
+	if v, err := getTerragruntVersion(envPath, envName); err != nil {
+		logger.Infof("no Terragrunt version recorded: %v", err)
+	} else {
+		state.TerragruntVersion = v
+	}
+	return state
+}
+
+// lockedPlugins returns the providers pinned in the dependency lock files of
+// the environment's roots, by source address. Where roots pin different
+// versions of a provider, the last root read wins.
+func lockedPlugins(envPath, envName string) map[string]string {
+	roots, err := envRoots(envPath, envName)
+	if err != nil {
+		logger.Warnf("failed to list roots of %s: %v", envName, err)
+		return nil
+	}
+	plugins := make(map[string]string)
+	for _, root := range roots {
+		lockPath := filepath.Join(envPath, "config", envName, root, dependencyLockFileName)
+		if !fileExists(lockPath) {
+			continue
+		}
+		providers, err := readLockedProviders(lockPath)
+		if err != nil {
+			logger.Warnf("skipping %s: %v", lockPath, err)
+			continue
+		}
+		for _, p := range providers {
+			plugins[fmt.Sprintf("%s/%s/%s", p.Host, p.Namespace, p.Type)] = p.Version
+		}
+	}
+	if len(plugins) == 0 {
+		return nil
+	}
+	return plugins
+}
+
+// saveEnvState writes the environment's state file.
+func saveEnvState(envPath string, state envState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal environment state: %w", err)
+	}
+	statePath := filepath.Join(envPath, envStateFileName)
+	if err := os.WriteFile(statePath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write environment state to %s: %w", statePath, err)
+	}
+	summary.fileWritten(statePath)
+	return nil
+}
+
+// refreshEnvState probes the environment and rewrites its state file. It is
+// called after binaries are installed or activated; a failure is only logged,
+// since the next reader probes again.
+func refreshEnvState(envPath, envName string) {
+	state := probeEnvState(envPath, envName)
+	if err := saveEnvState(envPath, state); err != nil {
+		logger.Warnf("failed to record the state of %s: %v", envName, err)
+	}
+
+	// Installing Terragrunt ends Terraform-only mode
+	if meta, err := loadEnvMetadata(envPath); err == nil && meta.TerraformOnly && state.TerragruntVersion != "" {
+		if err := updateEnvMetadata(envPath, func(meta *EnvironmentMetadata) { meta.TerraformOnly = false }); err != nil {
+			logger.Warnf("failed to update the metadata of %s: %v", envName, err)
+		}
+	}
+}
+
+// loadEnvState returns the environment's recorded state. An environment
+// without a state file, or with an unreadable one, is probed and the result
+// recorded.
+func loadEnvState(envPath, envName string) envState {
+	data, err := os.ReadFile(filepath.Join(envPath, envStateFileName))
+	if err == nil {
+		var state envState
+		if err = json.Unmarshal(data, &state); err == nil {
+			return state
+		}
+		logger.Warnf("ignoring unreadable %s in %s: %v", envStateFileName, envPath, err)
+	} else if !os.IsNotExist(err) {
+		logger.Warnf("failed to read %s in %s: %v", envStateFileName, envPath, err)
+	}
+
+	state := probeEnvState(envPath, envName)
+	if info, err := os.Stat(envPath); err == nil && info.IsDir() {
+		if err := saveEnvState(envPath, state); err != nil {
+			logger.Warnf("failed to record the state of %s: %v", envName, err)
+		}
+	}
+	return state
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"tfvenv/i18n"
+	"tfvenv/snaps"
+)
+
+// envCmd groups the commands that inspect the variables an activation applies.
+func envCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "env",
+		Short: "Inspect, diff and export the environment variables an activation applies",
+	}
+	cmd.AddCommand(envShowCmd())
+	cmd.AddCommand(envDiffCmd())
+	cmd.AddCommand(envExportCmd())
+	return cmd
+}
+
+// envShowCmd prints the effective variable set of an environment.
+func envShowCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "show <env-name>",
+		Short: "Show the environment variables an activation would apply",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envPath := filepath.Join(viper.GetString("env-dir"), envName)
+
+			vars, err := activationEnv(envPath, envName)
+			if err != nil {
+				logger.Errorf("error computing environment for %s: %v", envName, err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			fmt.Printf("PATH is prefixed with %s and %s\n", filepath.Join(envPath, "bin"), envScriptsDir(envPath))
+			for _, key := range sortedEnvKeys(vars) {
+				fmt.Printf("%s=%s\n", key, vars[key])
+			}
+		},
+	}
+}
+
+// envDiffCmd compares the variable set of an environment with another environment or a snap.
+func envDiffCmd() *cobra.Command {
+	var snapName string
+
+	cmd := &cobra.Command{
+		Use:   "diff <env-name> [other-env]",
+		Short: "Diff the environment variables of an environment against another environment or a snap",
+		Args:  cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envDir := viper.GetString("env-dir")
+			envPath := filepath.Join(envDir, envName)
+
+			if (len(args) == 2) == (snapName != "") {
+				fmt.Println("Error: specify either another environment or --snap.")
+				os.Exit(1)
+			}
+
+			vars, err := activationEnv(envPath, envName)
+			if err != nil {
+				logger.Errorf("error computing environment for %s: %v", envName, err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+
+			var other map[string]string
+			var otherLabel string
+			if snapName != "" {
+				snap, err := snaps.GetSnap(snaps.GetSnapFilePath(envPath, snapName))
+				if err != nil {
+					logger.Errorf("error reading snap %s: %v", snapName, err)
+					fmt.Printf("Error reading snap: %v\n", err)
+					os.Exit(1)
+				}
+				other = snapEnv(snap)
+				otherLabel = "snap " + snapName
+				// Snaps do not record path-derived variables
+				for key := range vars {
+					if strings.HasPrefix(key, "TFVENV_") || key == "TF_CLI_CONFIG_FILE" {
+						delete(vars, key)
+					}
+				}
+			} else {
+				otherName := args[1]
+				other, err = activationEnv(filepath.Join(envDir, otherName), otherName)
+				if err != nil {
+					logger.Errorf("error computing environment for %s: %v", otherName, err)
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+				otherLabel = otherName
+			}
+
+			lines := diffEnvVars(vars, other)
+			if len(lines) == 0 {
+				fmt.Printf("No differences between %s and %s.\n", envName, otherLabel)
+				return
+			}
+			fmt.Printf("--- %s\n+++ %s\n", envName, otherLabel)
+			for _, line := range lines {
+				fmt.Println(line)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&snapName, "snap", "", "Compare against a local snap of the environment instead of another environment")
+	return cmd
+}
+
+// envExportCmd writes the variable set as dotenv or JSON.
+func envExportCmd() *cobra.Command {
+	var format, output string
+	var resolve bool
+
+	cmd := &cobra.Command{
+		Use:   "export <env-name>",
+		Short: "Export the environment variables an activation would apply as dotenv or JSON",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envPath := filepath.Join(viper.GetString("env-dir"), envName)
+
+			vars, err := activationEnv(envPath, envName)
+			if err != nil {
+				logger.Errorf("error computing environment for %s: %v", envName, err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			if resolve {
+				if vars, err = resolveEnvVars(vars); err != nil {
+					logger.Errorf("error resolving secrets for %s: %v", envName, err)
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+			}
+
+			var content []byte
+			switch format {
+			case "dotenv":
+				content = []byte(renderDotenv(vars))
+			case "json":
+				content, err = json.MarshalIndent(vars, "", "  ")
+				content = append(content, '\n')
+			default:
+				fmt.Printf("Error: unsupported format %q (use dotenv or json)\n", format)
+				os.Exit(1)
+			}
+			if err != nil {
+				logger.Errorf("error encoding environment: %v", err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+
+			if output == "" {
+				os.Stdout.Write(content)
+				return
+			}
+			// Exported files may hold resolved secrets
+			if err := writeSecretFile(output, content); err != nil {
+				logger.Errorf("error writing %s: %v", output, err)
+				fmt.Printf("Error writing %s: %v\n", output, err)
+				os.Exit(1)
+			}
+			fmt.Printf("Environment '%s' exported to %s\n", envName, output)
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", "dotenv", "Output format: dotenv or json")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "Write to a file instead of stdout")
+	cmd.Flags().BoolVar(&resolve, "resolve", false, "Resolve op:// and bw:// secret references")
+	return cmd
+}
+
+// activationEnv returns the variables the activation scripts export for an
+// environment, apart from PATH. Secret references are left unresolved.
+func activationEnv(envPath, envName string) (map[string]string, error) {
+	if _, err := os.Stat(envPath); os.IsNotExist(err) {
+		return nil, fmt.Errorf("environment '%s' does not exist", envName)
+	}
+	config, err := loadEnvConfig(envPath, envName)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := map[string]string{
+		"TFVENV_PATH":        envPath,
+		"TFVENV_ENV":         envName,
+		"TFVENV_MODULES_DIR": filepath.Join(envPath, "modules"),
+	}
+	if meta, err := loadEnvMetadata(envPath); err == nil && meta.Workspace != "" {
+		vars["TF_WORKSPACE"] = meta.Workspace
+	}
+	if cliConfigPath := filepath.Join(envPath, cliConfigFileName); fileExists(cliConfigPath) {
+		vars["TF_CLI_CONFIG_FILE"] = cliConfigPath
+	}
+	if config.AWSProfile != "" {
+		vars["AWS_PROFILE"] = config.AWSProfile
+	}
+	if config.AWSRegion != "" {
+		vars["AWS_REGION"] = config.AWSRegion
+		vars["AWS_DEFAULT_REGION"] = config.AWSRegion
+	}
+	envVars, err := renderEnvVars(envPath, envName, config)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range envVars {
+		vars[key] = value
+	}
+	return vars, nil
+}
+
+// defaultTerraformParallelism is Terraform's own -parallelism default, used
+// for {{ .Parallelism }} when PARALLELISM is not set.
+const defaultTerraformParallelism = 10
+
+// envVarTemplateData is what a templated ENV_VARS value can refer to, so that
+// one shared .tfvenvrc serves many environments, as in
+// TF_VAR_env={{ .EnvName }}.
+type envVarTemplateData struct {
+	EnvName           string
+	EnvPath           string
+	Tool              string
+	TerraformVersion  string
+	TerragruntVersion string
+	Workspace         string
+	Region            string
+	Owner             string
+	Parallelism       int
+}
+
+// envVarTemplateFor returns the template data of an environment. Versions are
+// those pinned in its .tfvenvrc.
+func envVarTemplateFor(envPath, envName string, config Config) envVarTemplateData {
+	meta, err := loadEnvMetadata(envPath)
+	if err != nil {
+		logger.Warnf("error reading environment metadata: %v", err)
+	}
+	data := envVarTemplateData{
+		EnvName:           envName,
+		EnvPath:           envPath,
+		Tool:              resolveTool(config.Tool, meta.Tool),
+		TerraformVersion:  config.TfVersion,
+		TerragruntVersion: config.TgVersion,
+		Workspace:         meta.Workspace,
+		Region:            config.AWSRegion,
+		Owner:             config.Owner,
+		Parallelism:       config.Parallelism,
+	}
+	if data.Region == "" {
+		data.Region = config.Region
+	}
+	if data.Parallelism == 0 {
+		data.Parallelism = defaultTerraformParallelism
+	}
+	return data
+}
+
+// renderEnvVars returns the variables an environment's .tfvenvrc declares:
+// its TF_CLI_ARGS keys and ENV_VARS, which win over them, with their
+// templates resolved. Values without a template are kept as they are.
+func renderEnvVars(envPath, envName string, config Config) (map[string]string, error) {
+	vars := make(map[string]string, len(config.CLIArgs)+len(config.EnvVars))
+	for key, value := range config.CLIArgs {
+		vars[key] = value
+	}
+	for key, value := range config.EnvVars {
+		vars[key] = value
+	}
+	return renderEnvVarTemplates(vars, envVarTemplateFor(envPath, envName, config))
+}
+
+// renderEnvVarTemplates executes each value containing {{ as a text/template
+// against data.
+func renderEnvVarTemplates(envVars map[string]string, data envVarTemplateData) (map[string]string, error) {
+	rendered := make(map[string]string, len(envVars))
+	for key, value := range envVars {
+		if !strings.Contains(value, "{{") {
+			rendered[key] = value
+			continue
+		}
+		tmpl, err := template.New(key).Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template in %s: %w", key, err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return nil, fmt.Errorf("failed to render %s: %w", key, err)
+		}
+		rendered[key] = buf.String()
+	}
+	return rendered, nil
+}
+
+// loadEnvConfig reads an environment's .tfvenvrc without touching the global viper instance.
+func loadEnvConfig(envPath, envName string) (Config, error) {
+	var config Config
+	configPath := filepath.Join(envPath, "config", envName, tfvenvrcFileName)
+	v := viper.New()
+	if err := readTfvenvrc(v, configPath); err != nil {
+		return config, fmt.Errorf("failed to read %s: %w", configPath, err)
+	}
+	if err := v.Unmarshal(&config); err != nil {
+		return config, fmt.Errorf("failed to parse %s: %w", configPath, err)
+	}
+	config.CLIArgs = tfCLIArgs(v)
+	return config, nil
+}
+
+// tfCLIArgs returns the TF_CLI_ARGS and TF_CLI_ARGS_<command> values of a
+// .tfvenvrc, which activation exports like ENV_VARS.
+func tfCLIArgs(v *viper.Viper) map[string]string {
+	args := make(map[string]string)
+	for _, key := range v.AllKeys() {
+		if isTFCLIArgsKey(strings.ToUpper(key)) {
+			args[strings.ToUpper(key)] = v.GetString(key)
+		}
+	}
+	return args
+}
+
+// isTFCLIArgsKey reports whether key is TF_CLI_ARGS or TF_CLI_ARGS_<command>.
+func isTFCLIArgsKey(key string) bool {
+	return key == "TF_CLI_ARGS" || strings.HasPrefix(key, "TF_CLI_ARGS_")
+}
+
+// snapEnv returns the variables recorded in a snap.
+func snapEnv(snap *snaps.Snap) map[string]string {
+	vars := make(map[string]string)
+	for key, value := range snap.EnvVars {
+		vars[key] = value
+	}
+	if snap.Workspace != "" {
+		vars["TF_WORKSPACE"] = snap.Workspace
+	}
+	return vars
+}
+
+// diffEnvVars lists removed (-), added (+) and changed (~) variables going from a to b.
+func diffEnvVars(a, b map[string]string) []string {
+	keys := make(map[string]bool)
+	for key := range a {
+		keys[key] = true
+	}
+	for key := range b {
+		keys[key] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	sort.Strings(sorted)
+
+	var lines []string
+	for _, key := range sorted {
+		before, inA := a[key]
+		after, inB := b[key]
+		switch {
+		case inA && !inB:
+			lines = append(lines, fmt.Sprintf("- %s=%s", key, before))
+		case !inA && inB:
+			lines = append(lines, fmt.Sprintf("+ %s=%s", key, after))
+		case before != after:
+			lines = append(lines, fmt.Sprintf("~ %s: %s -> %s", key, before, after))
+		}
+	}
+	return lines
+}
+
+// renderDotenv renders variables as double-quoted dotenv lines.
+func renderDotenv(vars map[string]string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "$", `\$`)
+	var b strings.Builder
+	for _, key := range sortedEnvKeys(vars) {
+		fmt.Fprintf(&b, "%s=\"%s\"\n", key, replacer.Replace(vars[key]))
+	}
+	return b.String()
+}
+
+// sortedEnvKeys returns the variable names in sorted order.
+func sortedEnvKeys(vars map[string]string) []string {
+	keys := make([]string, 0, len(vars))
+	for key := range vars {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
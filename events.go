@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// Lifecycle event types emitted to the configured sinks.
+const (
+	eventEnvCreated   = "env.created"
+	eventEnvUpgraded  = "env.upgraded"
+	eventEnvExpired   = "env.expired"
+	eventEnvMerged    = "env.merged"
+	eventSnapSaved    = "snap.saved"
+	eventLockAcquired = "lock.acquired"
+	eventLockReleased = "lock.released"
+)
+
+// eventSinkTimeout bounds how long a sink may delay the command that emitted the event.
+const eventSinkTimeout = 10 * time.Second
+
+// Event is a structured lifecycle event, delivered as one JSON line.
+type Event struct {
+	Type        string            `json:"type"`
+	Time        time.Time         `json:"time"`
+	Environment string            `json:"environment"`
+	EnvPath     string            `json:"env_path"`
+	User        string            `json:"user"`
+	Host        string            `json:"host"`
+	Data        map[string]string `json:"data,omitempty"`
+}
+
+// emitEvent records an event in the environment's audit log and delivers it
+// to the Unix socket and/or command configured with EVENT_SOCKET and
+// EVENT_COMMAND in .tfvenvrc (or TFVENV_EVENT_SOCKET and TFVENV_EVENT_COMMAND
+// in the environment). Failures are logged and never fail the command that
+// emitted the event.
+func emitEvent(envPath, eventType string, data map[string]string) {
+	if abs, err := filepath.Abs(envPath); err == nil {
+		envPath = abs
+	}
+	event := Event{
+		Type:        eventType,
+		Time:        time.Now().UTC(),
+		Environment: filepath.Base(envPath),
+		EnvPath:     envPath,
+		User:        getUsername(),
+		Host:        getHostname(),
+		Data:        data,
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		logger.Warnf("error encoding event %s: %v", eventType, err)
+		return
+	}
+	payload = append(payload, '\n')
+
+	if err := appendAuditLog(envPath, eventType, payload); err != nil {
+		logger.Warnf("error recording event %s: %v", eventType, err)
+	}
+	socketPath, command := eventSinks(envPath)
+	if socketPath == "" && command == "" {
+		return
+	}
+
+	if socketPath != "" {
+		if err := sendEventToSocket(socketPath, payload); err != nil {
+			logger.Warnf("error sending event %s to %s: %v", eventType, socketPath, err)
+		}
+	}
+	if command != "" {
+		if err := sendEventToCommand(command, eventType, payload); err != nil {
+			logger.Warnf("error sending event %s to command: %v", eventType, err)
+		}
+	}
+}
+
+// eventSinks resolves the configured sinks. Environment variables take precedence
+// so sinks also work for commands that run before .tfvenvrc exists, like create.
+func eventSinks(envPath string) (string, string) {
+	socketPath := os.Getenv("TFVENV_EVENT_SOCKET")
+	command := os.Getenv("TFVENV_EVENT_COMMAND")
+	if socketPath != "" || command != "" {
+		return socketPath, command
+	}
+
+	envName := filepath.Base(envPath)
+	v := viper.New()
+	if err := readTfvenvrc(v, filepath.Join(envPath, "config", envName, tfvenvrcFileName)); err != nil {
+		return "", ""
+	}
+	return v.GetString("EVENT_SOCKET"), v.GetString("EVENT_COMMAND")
+}
+
+// sendEventToSocket writes the event to a Unix domain socket.
+func sendEventToSocket(socketPath string, payload []byte) error {
+	conn, err := net.DialTimeout("unix", socketPath, eventSinkTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetWriteDeadline(time.Now().Add(eventSinkTimeout)); err != nil {
+		return err
+	}
+	_, err = conn.Write(payload)
+	return err
+}
+
+// sendEventToCommand runs the command through the shell with the event on stdin.
+func sendEventToCommand(command, eventType string, payload []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), eventSinkTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Env = append(os.Environ(), "TFVENV_EVENT_TYPE="+eventType)
+	output, err := cmd.CombinedOutput()
+	if err != nil && len(output) > 0 {
+		logger.Warnf("event command output: %s", output)
+	}
+	return err
+}
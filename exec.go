@@ -0,0 +1,352 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"tfvenv/i18n"
+)
+
+// execCmd runs a command inside an environment without sourcing its
+// activation script.
+func execCmd() *cobra.Command {
+	var printEnv bool
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "exec <env-name> [-- <command> [args...]]",
+		Short: "Run a command with an environment's binaries and variables, or print them",
+		Long: `Run a command with the environment's bin and scripts directories prepended to
+PATH and the variables its activation script exports, without sourcing the
+script. Secret references are resolved. A bin directory of another active
+environment is dropped from PATH first.
+
+As with activation, terraform runs OpenTofu in OpenTofu environments,
+ENFORCE_VERSIONS refuses binaries that drifted from the pinned versions, and
+read-only environments refuse commands that change infrastructure. SIGTERM
+is passed on to the command, and tfvenv waits for it to exit. While the
+command runs, upgrade and delete refuse the environment without --force.
+
+With --print-env nothing is run; the variables the command would get are
+printed instead, as shell exports to eval or as JSON.`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envPath := filepath.Join(viper.GetString("env-dir"), envName)
+
+			vars, err := execEnv(envPath, envName)
+			if err != nil {
+				logger.Errorf("error computing environment for %s: %v", envName, err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+
+			if printEnv {
+				if err := printExecEnv(vars, format); err != nil {
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+				return
+			}
+
+			if len(args) < 2 {
+				fmt.Println("Error: give the command to run after --, or --print-env.")
+				os.Exit(1)
+			}
+			name, err := execGuard(envPath, envName, args[1], args[2:])
+			if err != nil {
+				logger.Errorf("error running %s in %s: %v", args[1], envName, err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			release := markEnvInUse(envPath, strings.Join(args[1:], " "))
+			code := runInEnv(vars, name, args[2:])
+			release()
+			if terraformToolCommand(name) {
+				cwd, _ := os.Getwd()
+				trackPluginCacheUse(envPath, envName,
+					filepath.Join(cwd, dependencyLockFileName),
+					filepath.Join(envPath, "config", envName, dependencyLockFileName))
+			}
+			os.Exit(code)
+		},
+	}
+
+	cmd.Flags().BoolVar(&printEnv, "print-env", false, "Print the variables the command would get instead of running it")
+	cmd.Flags().StringVar(&format, "format", "sh", "Format of --print-env: sh, fish, powershell or json")
+	return cmd
+}
+
+// whichCmd prints the binary an exec in the environment would run for a tool.
+func whichCmd() *cobra.Command {
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "which <env-name> <tool>",
+		Short: "Show which binary a command run in the environment would use for a tool",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName, tool := args[0], args[1]
+			envPath := filepath.Join(viper.GetString("env-dir"), envName)
+
+			if _, err := os.Stat(envPath); os.IsNotExist(err) {
+				i18n.Println("env.not_found", envName)
+				os.Exit(1)
+			}
+			found := whichBinary(envPath, tool, execPath(envPath, os.Getenv("PATH")))
+			if jsonOutput {
+				data, _ := json.MarshalIndent(found, "", "  ")
+				fmt.Println(string(data))
+			} else if found.Path != "" {
+				fmt.Println(found.Path)
+				fmt.Fprintf(os.Stderr, "(%s%s)\n", found.Source, versionSuffix(found.Version))
+			}
+			if found.Path == "" {
+				if !jsonOutput {
+					fmt.Fprintf(os.Stderr, "%s not found in %s or on PATH\n", tool, envName)
+				}
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the binary, where it was found and its version as JSON")
+	return cmd
+}
+
+// execEnv returns the variables tfvenv sets for a command run in an
+// environment: those of its activation, with secret references resolved, and
+// PATH with the environment's directories in front.
+func execEnv(envPath, envName string) (map[string]string, error) {
+	vars, err := activationEnv(envPath, envName)
+	if err != nil {
+		return nil, err
+	}
+	if vars, err = resolveEnvVars(vars); err != nil {
+		return nil, err
+	}
+	tool := envTool(envPath, envName)
+	vars["TFVENV_TOOL"] = tool
+	if tool == toolTofu {
+		vars["TERRAGRUNT_TFPATH"] = envBinaryPath(envPath, toolTofu)
+	}
+	vars["PATH"] = execPath(envPath, os.Getenv("PATH"))
+	return vars, nil
+}
+
+// execGuard applies the checks activation makes before a command runs in an
+// environment, and returns the command to run: terraform becomes tofu in
+// OpenTofu environments, as the activation scripts alias it.
+func execGuard(envPath, envName, name string, args []string) (string, error) {
+	config, err := loadEnvConfig(envPath, envName)
+	if err != nil {
+		return "", err
+	}
+	if err := enforceVersions(envPath, envName, config); err != nil {
+		return "", err
+	}
+
+	if name == toolTerraform && envTool(envPath, envName) == toolTofu {
+		name = toolTofu
+	}
+	if terraformToolCommand(name) {
+		if err := enforceReadOnly(envPath, envName, args); err != nil {
+			return "", err
+		}
+	}
+	return name, nil
+}
+
+// terraformToolCommand reports whether a command runs Terraform, OpenTofu or Terragrunt.
+func terraformToolCommand(name string) bool {
+	base := strings.TrimSuffix(filepath.Base(name), ".exe")
+	return base == toolTerraform || base == toolTofu || base == "terragrunt"
+}
+
+// execPath puts the environment's bin and scripts directories in front of
+// path, after dropping those of the environment active in this shell.
+func execPath(envPath, path string) string {
+	drop := make(map[string]bool)
+	if active := os.Getenv("TFVENV_PATH"); active != "" {
+		drop[filepath.Join(active, "bin")] = true
+		drop[envScriptsDir(active)] = true
+	}
+	binDir := filepath.Join(envPath, "bin")
+	drop[binDir] = true
+	drop[envScriptsDir(envPath)] = true
+
+	dirs := []string{binDir, envScriptsDir(envPath)}
+	for _, dir := range filepath.SplitList(path) {
+		if dir != "" && !drop[filepath.Clean(dir)] {
+			dirs = append(dirs, dir)
+		}
+	}
+	return strings.Join(dirs, string(os.PathListSeparator))
+}
+
+// runInEnv runs a command with vars applied to the current environment and
+// returns its exit code.
+func runInEnv(vars map[string]string, name string, args []string) int {
+	binary, err := lookPathIn(name, vars["PATH"])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 127
+	}
+	run := exec.Command(binary, args...)
+	run.Env = os.Environ()
+	for _, key := range sortedEnvKeys(vars) {
+		run.Env = append(run.Env, key+"="+vars[key])
+	}
+	run.Stdin = os.Stdin
+	run.Stdout = os.Stdout
+	run.Stderr = os.Stderr
+
+	// The command shuts down by itself: a terminal's SIGINT reaches it through
+	// the process group, and SIGTERM, which CI runners send to tfvenv alone,
+	// is passed on, so it can release state locks before exiting.
+	handleInterruptsGracefully()
+	if err := run.Start(); err != nil {
+		logger.Errorf("error running %s: %v", name, err)
+		fmt.Fprintf(os.Stderr, "Error running %s: %v\n", name, err)
+		return 1
+	}
+	terms := make(chan os.Signal, 1)
+	signal.Notify(terms, syscall.SIGTERM)
+	go func() {
+		for sig := range terms {
+			if err := run.Process.Signal(sig); err != nil {
+				logger.Warnf("failed to pass %s on to %s: %v", sig, name, err)
+			}
+		}
+	}()
+	err = run.Wait()
+	signal.Stop(terms)
+	close(terms)
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if code := exitErr.ExitCode(); code >= 0 {
+			return code
+		}
+		// Killed by a signal
+		return interruptExitCode
+	}
+	if err != nil {
+		logger.Errorf("error running %s: %v", name, err)
+		fmt.Fprintf(os.Stderr, "Error running %s: %v\n", name, err)
+		return 1
+	}
+	return 0
+}
+
+// lookPathIn finds an executable like exec.LookPath, but in the directories
+// of path rather than this process's PATH. Names with a directory are used
+// as they are.
+func lookPathIn(name, path string) (string, error) {
+	if strings.ContainsRune(name, filepath.Separator) || strings.Contains(name, "/") {
+		return name, nil
+	}
+	for _, dir := range filepath.SplitList(path) {
+		if dir == "" {
+			continue
+		}
+		candidate := filepath.Join(dir, executableName(name))
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() && (runtime.GOOS == "windows" || info.Mode()&0111 != 0) {
+			return candidate, nil
+		}
+	}
+	return "", fmt.Errorf("%s: command not found", name)
+}
+
+// whichResult is a binary found for a tool, and where it was found.
+type whichResult struct {
+	Tool    string `json:"tool"`
+	Path    string `json:"path,omitempty"`
+	Source  string `json:"source,omitempty"`
+	Version string `json:"version,omitempty"`
+}
+
+// whichBinary finds the binary a command in the environment would run for
+// tool, and reports whether it is the environment's own, one of its scripts,
+// or from the rest of PATH.
+func whichBinary(envPath, tool, path string) whichResult {
+	result := whichResult{Tool: tool}
+	binary, err := lookPathIn(tool, path)
+	if err != nil {
+		return result
+	}
+	result.Path = binary
+	switch filepath.Dir(binary) {
+	case filepath.Join(envPath, "bin"):
+		result.Source = "environment"
+	case envScriptsDir(envPath):
+		result.Source = "environment scripts"
+	default:
+		result.Source = "PATH"
+	}
+	if tool == toolTerraform || tool == toolTofu || tool == "terragrunt" {
+		if v, err := getBinaryVersion(binary, tool); err == nil {
+			result.Version = v
+		}
+	}
+	return result
+}
+
+// versionSuffix formats a version for appending to a description.
+func versionSuffix(v string) string {
+	if v == "" {
+		return ""
+	}
+	return ", version " + v
+}
+
+// printExecEnv prints the variables an exec applies, in a form a shell can
+// evaluate, or as JSON.
+func printExecEnv(vars map[string]string, format string) error {
+	if format == "json" {
+		data, err := json.MarshalIndent(vars, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	for _, key := range sortedEnvKeys(vars) {
+		value := vars[key]
+		switch format {
+		case "sh":
+			fmt.Printf("export %s=%s\n", key, escapeBash(value))
+		case "fish":
+			if key == "PATH" {
+				fmt.Printf("set -gx PATH %s\n", escapeFishList(filepath.SplitList(value)))
+				continue
+			}
+			fmt.Printf("set -gx %s %s\n", key, escapeFish(value))
+		case "powershell":
+			fmt.Printf("$env:%s = %s\n", key, escapePowerShell(value))
+		default:
+			return fmt.Errorf("unsupported format %q (use sh, fish, powershell or json)", format)
+		}
+	}
+	return nil
+}
+
+// escapeFishList quotes each element of a fish list.
+func escapeFishList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = escapeFish(value)
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// What maintain and the daemon do with an environment past its expiry.
+const (
+	expiredWarn    = "warn"
+	expiredArchive = "archive"
+	expiredDelete  = "delete"
+)
+
+// expiryArchiveDir is where expired environments and their final snaps are
+// kept, under the data directory.
+const expiryArchiveDir = "archive"
+
+// validateExpiredAction checks the value of --expired-action.
+func validateExpiredAction(action string) error {
+	switch action {
+	case expiredWarn, expiredArchive, expiredDelete:
+		return nil
+	}
+	return fmt.Errorf("invalid expired action %q: use %s, %s or %s", action, expiredWarn, expiredArchive, expiredDelete)
+}
+
+// setEnvExpiry records that the environment expires after ttl.
+func setEnvExpiry(envPath string, ttl time.Duration) (time.Time, error) {
+	expiresAt := time.Now().UTC().Add(ttl).Truncate(time.Second)
+	err := updateEnvMetadata(envPath, func(meta *EnvironmentMetadata) { meta.ExpiresAt = &expiresAt })
+	return expiresAt, err
+}
+
+// maintainExpiry warns about environments that expire within warnWithin, and
+// applies action to the ones that have expired. Locked environments, and ones
+// a shell or command is using, are left alone until a later run.
+func maintainExpiry(envDir string, envNames []string, action string, warnWithin time.Duration, dryRun bool) maintainTask {
+	task := maintainTask{Name: "expiry", Status: maintainOK}
+	var failures []string
+	expired := 0
+	now := time.Now()
+	for _, name := range envNames {
+		envPath := filepath.Join(envDir, name)
+		meta, err := loadEnvMetadata(envPath)
+		if err != nil || meta.ExpiresAt == nil {
+			continue
+		}
+		expiresAt := meta.ExpiresAt.UTC().Format(time.RFC3339)
+		if remaining := meta.ExpiresAt.Sub(now); remaining > 0 {
+			if remaining <= warnWithin {
+				logger.Warnf("environment %s expires at %s", name, expiresAt)
+				task.Items = append(task.Items, fmt.Sprintf("%s (expires at %s)", name, expiresAt))
+			}
+			continue
+		}
+
+		expired++
+		switch {
+		case action == expiredWarn:
+			logger.Warnf("environment %s expired at %s", name, expiresAt)
+			task.Items = append(task.Items, fmt.Sprintf("%s (expired at %s)", name, expiresAt))
+		case fileExists(filepath.Join(envPath, lockFileName)):
+			logger.Warnf("environment %s expired at %s but is locked; kept", name, expiresAt)
+			task.Items = append(task.Items, fmt.Sprintf("%s (expired at %s, locked, kept)", name, expiresAt))
+		case checkEnvNotInUse(envPath, name, false) != nil:
+			logger.Warnf("environment %s expired at %s but is in use; kept", name, expiresAt)
+			task.Items = append(task.Items, fmt.Sprintf("%s (expired at %s, in use, kept)", name, expiresAt))
+		case dryRun:
+			task.Items = append(task.Items, fmt.Sprintf("%s (expired at %s, would %s)", name, expiresAt, action))
+		default:
+			dest, err := teardownExpiredEnv(envPath, name, action)
+			if err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %v", name, err))
+				continue
+			}
+			logger.Infof("expired environment %s: %sd to %s", name, action, dest)
+			task.Items = append(task.Items, fmt.Sprintf("%s (expired at %s, %sd to %s)", name, expiresAt, action, dest))
+		}
+	}
+	task.Detail = fmt.Sprintf("%d environment(s) expired, action %s", expired, action)
+	if len(failures) > 0 {
+		task.Status = maintainFailed
+		task.Detail = fmt.Sprintf("%d expired environment(s) could not be torn down: %v", len(failures), failures)
+	}
+	return task
+}
+
+// teardownExpiredEnv takes a final full snap of an expired environment, then moves
+// the environment to the archive directory or deletes it, keeping only the
+// final snap. It returns where the environment or its snap was kept.
+func teardownExpiredEnv(envPath, envName, action string) (string, error) {
+	stamp := time.Now().UTC().Format("20060102-150405")
+	if err := os.MkdirAll(filepath.Join(envPath, "snaps"), 0755); err != nil {
+		return "", fmt.Errorf("failed to create snaps directory: %w", err)
+	}
+	snapPath, err := saveEnvironmentSnap(envPath, "final-"+stamp, true)
+	if err != nil {
+		return "", fmt.Errorf("failed to take final snap: %w", err)
+	}
+	emitEvent(envPath, eventEnvExpired, map[string]string{"action": action, "snap": snapPath})
+
+	dest := filepath.Join(userDirs.DataDir(), expiryArchiveDir, envName+"-"+stamp)
+	if action == expiredArchive {
+		if err := moveTree(envPath, dest); err != nil {
+			return "", fmt.Errorf("failed to archive environment: %w", err)
+		}
+		return dest, nil
+	}
+
+	dest += ".snap"
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", filepath.Dir(dest), err)
+	}
+	if err := copyFile(snapPath, dest); err != nil {
+		return "", fmt.Errorf("failed to keep final snap: %w", err)
+	}
+	if err := os.RemoveAll(envPath); err != nil {
+		return "", fmt.Errorf("failed to delete environment: %w", err)
+	}
+	return dest, nil
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"tfvenv/i18n"
+)
+
+// exportCmd groups the environment export subcommands.
+func exportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export an environment for use outside tfvenv",
+	}
+	cmd.AddCommand(exportDockerCmd())
+	cmd.AddCommand(exportCatalogCmd())
+	cmd.AddCommand(exportManifestCmd())
+	return cmd
+}
+
+// exportDockerCmd writes a Dockerfile, and optionally a devcontainer.json, that
+// reproduce the environment inside a container.
+func exportDockerCmd() *cobra.Command {
+	var devcontainer, force bool
+
+	cmd := &cobra.Command{
+		Use:   "docker <env-name>",
+		Short: "Generate a Dockerfile that reproduces the environment",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envDir := viper.GetString("env-dir")
+			envPath := filepath.Join(envDir, envName)
+
+			if _, err := os.Stat(envPath); os.IsNotExist(err) {
+				i18n.Println("env.not_found", envName)
+				os.Exit(1)
+			}
+
+			tfVersion, tgVersion, err := pinnedToolVersions(envPath, envName)
+			if err != nil {
+				logger.Errorf("error resolving versions for %s: %v", envName, err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+
+			configPath := filepath.Join(envPath, "config", envName, tfvenvrcFileName)
+			config, err := readConfig(configPath)
+			if err != nil {
+				logger.Warnf("error reading %s, exporting without custom variables: %v", configPath, err)
+			}
+			meta, err := loadEnvMetadata(envPath)
+			if err != nil {
+				logger.Warnf("error reading environment metadata: %v", err)
+			}
+			if config.EnvVars, err = renderEnvVars(envPath, envName, config); err != nil {
+				logger.Errorf("error rendering ENV_VARS: %v", err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+
+			// Only the config directory is copied, keep binaries and state out of the build context
+			names := []string{"Dockerfile", ".dockerignore"}
+			files := map[string][]byte{
+				"Dockerfile":    renderDockerfile(envName, envTool(envPath, envName), tfVersion, tgVersion, meta.Workspace, config.EnvVars),
+				".dockerignore": []byte("*\n!config/\n"),
+			}
+			// ENV_VARS may hold credentials, so they are passed when the container
+			// runs instead of being written into an image layer
+			if len(config.EnvVars) > 0 {
+				content, err := renderDockerEnvFile(config.EnvVars)
+				if err != nil {
+					logger.Errorf("error rendering %s: %v", dockerEnvFileName, err)
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+				names = append(names, dockerEnvFileName)
+				files[dockerEnvFileName] = content
+			}
+			if devcontainer {
+				content, err := renderDevcontainer(envName, len(config.EnvVars) > 0)
+				if err != nil {
+					logger.Errorf("error rendering devcontainer.json: %v", err)
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+				name := filepath.Join(".devcontainer", "devcontainer.json")
+				names = append(names, name)
+				files[name] = content
+			}
+
+			for _, name := range names {
+				content := files[name]
+				path := filepath.Join(envPath, name)
+				if fileExists(path) && !force {
+					i18n.Println("file.exists_use_force", path)
+					os.Exit(1)
+				}
+				if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+					logger.Errorf("error creating %s: %v", filepath.Dir(path), err)
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+				if err := writeSecretFile(path, content); err != nil {
+					logger.Errorf("error writing %s: %v", path, err)
+					fmt.Printf("Error writing %s: %v\n", path, err)
+					os.Exit(1)
+				}
+				fmt.Printf("Generated %s\n", path)
+			}
+
+			fmt.Printf("Build the image with: docker build -t tfvenv-%s %s\n", envName, envPath)
+			if len(config.EnvVars) > 0 {
+				fmt.Printf("Run it with: docker run -it --env-file %s tfvenv-%s\n", filepath.Join(envPath, dockerEnvFileName), envName)
+			}
+			logger.Infof("exported environment %s to %s", envName, envPath)
+		},
+	}
+
+	cmd.Flags().BoolVar(&devcontainer, "devcontainer", false, "Also generate .devcontainer/devcontainer.json")
+	cmd.Flags().BoolVar(&force, "force", false, "Overwrite existing files")
+	return cmd
+}
+
+// renderDockerfile renders a Dockerfile whose build context is the environment
+// directory. tool selects whether Terraform or OpenTofu is installed.
+func renderDockerfile(envName, tool, tfVersion, tgVersion, workspace string, envVars map[string]string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("# Generated by tfvenv export docker for environment '%s'\n", envName))
+	buf.WriteString("FROM ubuntu:24.04\n\n")
+	buf.WriteString("ENV DEBIAN_FRONTEND=noninteractive\n\n")
+	buf.WriteString("RUN apt-get update && apt-get install -y \\\n")
+	buf.WriteString("    curl \\\n    unzip \\\n    bash \\\n    git \\\n    ca-certificates && \\\n")
+	buf.WriteString("    apt-get clean && \\\n    rm -rf /var/lib/apt/lists/*\n\n")
+
+	buf.WriteString("ARG TARGETARCH=amd64\n\n")
+	if tool == toolTofu {
+		buf.WriteString(fmt.Sprintf("# OpenTofu %s\n", tfVersion))
+		buf.WriteString(fmt.Sprintf("ARG TOFU_VERSION=%s\n", tfVersion))
+		buf.WriteString(fmt.Sprintf("RUN curl -fsSL -o /tmp/tofu.zip %sv${TOFU_VERSION}/tofu_${TOFU_VERSION}_linux_${TARGETARCH}.zip && \\\n", tofuDownloadURL))
+		buf.WriteString("    unzip /tmp/tofu.zip tofu -d /usr/local/bin && \\\n")
+		buf.WriteString("    rm /tmp/tofu.zip\n\n")
+	} else {
+		buf.WriteString(fmt.Sprintf("# Terraform %s\n", tfVersion))
+		buf.WriteString(fmt.Sprintf("ARG TERRAFORM_VERSION=%s\n", tfVersion))
+		buf.WriteString(fmt.Sprintf("RUN curl -fsSL -o /tmp/terraform.zip %s${TERRAFORM_VERSION}/terraform_${TERRAFORM_VERSION}_linux_${TARGETARCH}.zip && \\\n", terraformDownloadURL))
+		buf.WriteString("    unzip /tmp/terraform.zip terraform -d /usr/local/bin && \\\n")
+		buf.WriteString("    rm /tmp/terraform.zip\n\n")
+	}
+
+	if tgVersion != "none" {
+		buf.WriteString(fmt.Sprintf("# Terragrunt %s\n", tgVersion))
+		buf.WriteString(fmt.Sprintf("ARG TERRAGRUNT_VERSION=%s\n", tgVersion))
+		buf.WriteString(fmt.Sprintf("RUN curl -fsSL -o /usr/local/bin/terragrunt %sv${TERRAGRUNT_VERSION}/terragrunt_linux_${TARGETARCH} && \\\n", terragruntDownloadURL))
+		buf.WriteString("    chmod +x /usr/local/bin/terragrunt\n\n")
+	}
+
+	workdir := fmt.Sprintf("/tfvenv/%s/config/%s", envName, envName)
+	buf.WriteString(fmt.Sprintf("ENV TFVENV_ENV=%s\n", dockerQuote(envName)))
+	buf.WriteString("ENV TF_PLUGIN_CACHE_DIR=/root/.cache/tfvenv/plugin-cache\n")
+	buf.WriteString(fmt.Sprintf("ENV TF_DATA_DIR=/tfvenv/%s/terraform-data\n", envName))
+	if workspace != "" {
+		buf.WriteString(fmt.Sprintf("ENV TF_WORKSPACE=%s\n", dockerQuote(workspace)))
+	}
+	if len(envVars) > 0 {
+		buf.WriteString(fmt.Sprintf("# ENV_VARS are not stored in the image; pass them with docker run --env-file %s:\n", dockerEnvFileName))
+		buf.WriteString(fmt.Sprintf("# %s\n", strings.Join(sortedEnvKeys(envVars), ", ")))
+	}
+	buf.WriteString("\n")
+
+	buf.WriteString("RUN mkdir -p /root/.cache/tfvenv/plugin-cache\n")
+	buf.WriteString(fmt.Sprintf("COPY config/%s/ %s/\n", envName, workdir))
+	buf.WriteString(fmt.Sprintf("WORKDIR %s\n\n", workdir))
+	buf.WriteString("CMD [\"/bin/bash\"]\n")
+	return buf.Bytes()
+}
+
+// dockerEnvFileName is the file, next to the Dockerfile, holding the ENV_VARS
+// a container of the environment is run with.
+const dockerEnvFileName = ".tfvenv.env"
+
+// renderDockerEnvFile renders envVars in the format of docker run --env-file,
+// which takes each value literally up to the end of its line.
+func renderDockerEnvFile(envVars map[string]string) ([]byte, error) {
+	var buf bytes.Buffer
+	for _, key := range sortedEnvKeys(envVars) {
+		value := envVars[key]
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("ENV_VARS value of %s spans several lines, which docker --env-file cannot pass", key)
+		}
+		buf.WriteString(fmt.Sprintf("%s=%s\n", key, value))
+	}
+	return buf.Bytes(), nil
+}
+
+// renderDevcontainer renders a devcontainer.json that builds the exported
+// Dockerfile, and runs it with the environment's ENV_VARS when it has any.
+func renderDevcontainer(envName string, withEnvFile bool) ([]byte, error) {
+	devcontainer := map[string]interface{}{
+		"name": fmt.Sprintf("tfvenv %s", envName),
+		"build": map[string]string{
+			"dockerfile": "../Dockerfile",
+			"context":    "..",
+		},
+		"customizations": map[string]interface{}{
+			"vscode": map[string]interface{}{
+				"extensions": []string{"hashicorp.terraform"},
+			},
+		},
+	}
+	if withEnvFile {
+		devcontainer["runArgs"] = []string{"--env-file", "${localWorkspaceFolder}/" + dockerEnvFileName}
+	}
+	data, err := json.MarshalIndent(devcontainer, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// dockerQuote double-quotes a value for a Dockerfile ENV instruction.
+func dockerQuote(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`)
+	return `"` + replacer.Replace(value) + `"`
+}
+
+// catalogEntry describes one environment for service catalogs.
+type catalogEntry struct {
+	Name              string
+	Path              string
+	TerraformVersion  string
+	TerragruntVersion string
+	Workspace         string
+	Owner             string
+	Config            Config
+}
+
+// exportCatalogCmd writes Backstage catalog entities, or a generic manifest,
+// describing every environment under the env dir.
+func exportCatalogCmd() *cobra.Command {
+	var format, outputFile string
+
+	cmd := &cobra.Command{
+		Use:   "catalog-info",
+		Short: "Generate Backstage catalog entities describing each environment",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			envDir := viper.GetString("env-dir")
+
+			names, err := listEnvironmentDirs(envDir)
+			if err != nil {
+				logger.Errorf("error listing environments: %v", err)
+				fmt.Printf("Error listing environments: %v\n", err)
+				os.Exit(1)
+			}
+
+			var entries []catalogEntry
+			for _, name := range names {
+				envPath := filepath.Join(envDir, name)
+				status := environmentStatus(envPath, name)
+				configPath := filepath.Join(envPath, "config", name, tfvenvrcFileName)
+				config, err := readConfig(configPath)
+				if err != nil {
+					logger.Warnf("error reading %s: %v", configPath, err)
+				}
+				owner := config.Owner
+				if owner == "" {
+					owner = "unknown"
+				}
+				entries = append(entries, catalogEntry{
+					Name:              name,
+					Path:              envPath,
+					TerraformVersion:  status.TerraformVersion,
+					TerragruntVersion: status.TerragruntVersion,
+					Workspace:         status.Workspace,
+					Owner:             owner,
+					Config:            config,
+				})
+			}
+
+			var content []byte
+			switch format {
+			case "backstage":
+				content = renderBackstageCatalog(entries)
+			case "manifest":
+				content = renderCatalogManifest(entries)
+			default:
+				fmt.Printf("Unsupported format '%s'. Use backstage or manifest.\n", format)
+				os.Exit(1)
+			}
+
+			if outputFile == "" {
+				fmt.Print(string(content))
+				return
+			}
+			if err := os.WriteFile(outputFile, content, 0644); err != nil {
+				logger.Errorf("error writing %s: %v", outputFile, err)
+				fmt.Printf("Error writing %s: %v\n", outputFile, err)
+				os.Exit(1)
+			}
+			fmt.Printf("Catalog with %d environment(s) written to %s\n", len(entries), outputFile)
+			logger.Infof("catalog with %d environments written to %s", len(entries), outputFile)
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", "backstage", "Output format: backstage or manifest")
+	cmd.Flags().StringVarP(&outputFile, "output", "o", "", "File to write (defaults to stdout)")
+	return cmd
+}
+
+// catalogBackend returns the S3 backend location of an environment, if configured.
+func catalogBackend(entry catalogEntry) string {
+	if entry.Config.S3StateBucket == "" {
+		return ""
+	}
+	return fmt.Sprintf("s3://%s/%s", entry.Config.S3StateBucket, strings.Trim(entry.Config.S3StatePath, "/"))
+}
+
+// renderBackstageCatalog renders one Resource entity per environment.
+func renderBackstageCatalog(entries []catalogEntry) []byte {
+	var buf bytes.Buffer
+	for i, entry := range entries {
+		if i > 0 {
+			buf.WriteString("---\n")
+		}
+		buf.WriteString("apiVersion: backstage.io/v1alpha1\n")
+		buf.WriteString("kind: Resource\n")
+		buf.WriteString("metadata:\n")
+		buf.WriteString(fmt.Sprintf("  name: %s\n", backstageName("tfvenv-"+entry.Name)))
+		buf.WriteString(fmt.Sprintf("  title: %s\n", yamlQuote(entry.Name)))
+		buf.WriteString(fmt.Sprintf("  description: %s\n", yamlQuote(fmt.Sprintf("tfvenv environment %s", entry.Name))))
+		buf.WriteString("  annotations:\n")
+		buf.WriteString(fmt.Sprintf("    tfvenv.io/terraform-version: %s\n", yamlQuote(entry.TerraformVersion)))
+		buf.WriteString(fmt.Sprintf("    tfvenv.io/terragrunt-version: %s\n", yamlQuote(entry.TerragruntVersion)))
+		if entry.Workspace != "" {
+			buf.WriteString(fmt.Sprintf("    tfvenv.io/workspace: %s\n", yamlQuote(entry.Workspace)))
+		}
+		if backend := catalogBackend(entry); backend != "" {
+			buf.WriteString(fmt.Sprintf("    tfvenv.io/backend: %s\n", yamlQuote(backend)))
+		}
+		if entry.Config.DynamoDBTable != "" {
+			buf.WriteString(fmt.Sprintf("    tfvenv.io/lock-table: %s\n", yamlQuote(entry.Config.DynamoDBTable)))
+		}
+		buf.WriteString("  tags:\n    - terraform\n    - tfvenv\n")
+		buf.WriteString("spec:\n")
+		buf.WriteString("  type: terraform-environment\n")
+		buf.WriteString(fmt.Sprintf("  owner: %s\n", yamlQuote(entry.Owner)))
+	}
+	return buf.Bytes()
+}
+
+// renderCatalogManifest renders a tool-agnostic YAML manifest of all environments.
+func renderCatalogManifest(entries []catalogEntry) []byte {
+	var buf bytes.Buffer
+	if len(entries) == 0 {
+		buf.WriteString("environments: []\n")
+		return buf.Bytes()
+	}
+	buf.WriteString("environments:\n")
+	for _, entry := range entries {
+		buf.WriteString(fmt.Sprintf("  - name: %s\n", yamlQuote(entry.Name)))
+		buf.WriteString(fmt.Sprintf("    path: %s\n", yamlQuote(entry.Path)))
+		buf.WriteString(fmt.Sprintf("    owner: %s\n", yamlQuote(entry.Owner)))
+		buf.WriteString(fmt.Sprintf("    terraform_version: %s\n", yamlQuote(entry.TerraformVersion)))
+		buf.WriteString(fmt.Sprintf("    terragrunt_version: %s\n", yamlQuote(entry.TerragruntVersion)))
+		if entry.Workspace != "" {
+			buf.WriteString(fmt.Sprintf("    workspace: %s\n", yamlQuote(entry.Workspace)))
+		}
+		if entry.Config.S3StateBucket != "" {
+			buf.WriteString("    backend:\n")
+			buf.WriteString("      type: s3\n")
+			buf.WriteString(fmt.Sprintf("      bucket: %s\n", yamlQuote(entry.Config.S3StateBucket)))
+			buf.WriteString(fmt.Sprintf("      path: %s\n", yamlQuote(entry.Config.S3StatePath)))
+			buf.WriteString(fmt.Sprintf("      region: %s\n", yamlQuote(entry.Config.Region)))
+			if entry.Config.DynamoDBTable != "" {
+				buf.WriteString(fmt.Sprintf("      lock_table: %s\n", yamlQuote(entry.Config.DynamoDBTable)))
+			}
+		}
+	}
+	return buf.Bytes()
+}
+
+// backstageName converts a string into a valid Backstage entity name:
+// letters, digits, '-', '_' and '.', at most 63 characters.
+func backstageName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' || r == '.' {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('-')
+		}
+	}
+	result := strings.Trim(b.String(), "-_.")
+	if len(result) > 63 {
+		result = strings.TrimRight(result[:63], "-_.")
+	}
+	return result
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"tfvenv/i18n"
+)
+
+// foreachCmd runs a tfvenv command against every environment, several at a time.
+func foreachCmd() *cobra.Command {
+	var envNames []string
+	var parallel int
+
+	cmd := &cobra.Command{
+		Use:   "foreach [--envs a,b] [--parallel N] -- <command> [args...]",
+		Short: "Run a tfvenv command for every environment in parallel",
+		Long: `Run a tfvenv command for every environment under --env-dir.
+
+{env} in the arguments is replaced with the environment name and {path} with
+its directory. Without either placeholder the environment name is appended.
+Output of each run is printed once it finishes.
+
+  tfvenv foreach -- drift
+  tfvenv foreach --parallel 8 -- snap save {env} nightly
+  tfvenv foreach --envs dev,staging -- --env-dir {path} upgrade --tf-version 1.6.6`,
+		Args: cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envDir := viper.GetString("env-dir")
+
+			if len(envNames) == 0 {
+				all, err := listEnvironmentDirs(envDir)
+				if err != nil {
+					logger.Errorf("error listing environments: %v", err)
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+				envNames = all
+			}
+			if len(envNames) == 0 {
+				i18n.Println("env.none_found")
+				return
+			}
+
+			outputs := make([][]byte, len(envNames))
+			jobs := make([]job, len(envNames))
+			for i, envName := range envNames {
+				i, envName := i, envName
+				envPath := filepath.Join(envDir, envName)
+				jobs[i] = job{
+					Name: envName,
+					Run: func() error {
+						if _, err := os.Stat(envPath); os.IsNotExist(err) {
+							return fmt.Errorf("environment '%s' does not exist", envName)
+						}
+						run := exec.Command(tfvenvExecutable(), foreachArgs(envDir, envName, envPath, args)...)
+						output, err := run.CombinedOutput()
+						outputs[i] = output
+						return err
+					},
+				}
+			}
+
+			results := runJobs(jobs, parallel)
+			for i, envName := range envNames {
+				if len(outputs[i]) == 0 {
+					continue
+				}
+				fmt.Printf("\n==> %s\n%s", envName, outputs[i])
+				if !strings.HasSuffix(string(outputs[i]), "\n") {
+					fmt.Println()
+				}
+			}
+
+			if err := jobsError(results); err != nil {
+				logger.Errorf("foreach failed: %v", err)
+				fmt.Printf("\nError: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("\nCompleted for %d environment(s).\n", len(envNames))
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&envNames, "envs", nil, "Environments to run for (defaults to all)")
+	addParallelFlag(cmd, &parallel)
+	return cmd
+}
+
+// foreachArgs builds the tfvenv arguments for one environment. A later --env-dir
+// in args overrides the one passed here.
+func foreachArgs(envDir, envName, envPath string, args []string) []string {
+	expanded := []string{"--env-dir", envDir}
+	substituted := false
+	for _, arg := range args {
+		if strings.Contains(arg, "{env}") || strings.Contains(arg, "{path}") {
+			substituted = true
+			arg = strings.ReplaceAll(arg, "{env}", envName)
+			arg = strings.ReplaceAll(arg, "{path}", envPath)
+		}
+		expanded = append(expanded, arg)
+	}
+	if !substituted {
+		expanded = append(expanded, envName)
+	}
+	return expanded
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// formatOptions controls which files formatEnvironmentFiles visits and whether it rewrites them.
+type formatOptions struct {
+	Check   bool
+	Include []string
+	Exclude []string
+}
+
+// fmtCmd formats Terraform, tfvars, HCL, and JSON files within an environment
+func fmtCmd() *cobra.Command {
+	var opts formatOptions
+
+	cmd := &cobra.Command{
+		Use:   "fmt <env-name>",
+		Short: "Format .tf, .tfvars, .hcl, and .tfvars.json files within the specified environment",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envDir := viper.GetString("env-dir")
+			envPath := filepath.Join(envDir, envName)
+			configRoot := filepath.Join(envPath, "config")
+
+			if _, err := os.Stat(configRoot); os.IsNotExist(err) {
+				logger.Errorf("config directory %s does not exist", configRoot)
+				fmt.Printf("Error: config directory %s does not exist.\n", configRoot)
+				os.Exit(1)
+			}
+
+			changed, err := formatEnvironmentFiles(configRoot, envBinaryPath(envPath, envTool(envPath, envName)), opts)
+			if err != nil {
+				logger.Errorf("fmt failed: %v", err)
+				fmt.Printf("fmt Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			for _, path := range changed {
+				if opts.Check {
+					fmt.Printf("Needs formatting: %s\n", path)
+					githubAnnotate("error", path, "File is not formatted. Run tfvenv fmt to fix it.")
+				} else {
+					fmt.Printf("Formatted: %s\n", path)
+				}
+			}
+			printRootFormatStatus(envPath, envName, changed, opts.Check)
+
+			if opts.Check {
+				if len(changed) > 0 {
+					logger.Warnf("%d file(s) in %s need formatting", len(changed), configRoot)
+					githubStepSummary(fmt.Sprintf("### tfvenv fmt\n\n:x: %d file(s) in environment `%s` need formatting.", len(changed), envName))
+					os.Exit(1)
+				}
+				fmt.Println("fmt check passed successfully.")
+			} else {
+				fmt.Printf("fmt completed successfully (%d file(s) changed).\n", len(changed))
+			}
+			logger.Infof("fmt completed for environment '%s'", envName)
+		},
+	}
+
+	cmd.Flags().BoolVar(&opts.Check, "check", false, "Check formatting without making changes")
+	cmd.Flags().StringSliceVar(&opts.Include, "include", nil, "Glob patterns of files to format (matched against the relative path and file name)")
+	cmd.Flags().StringSliceVar(&opts.Exclude, "exclude", nil, "Glob patterns of files or directories to skip")
+
+	return cmd
+}
+
+// printRootFormatStatus prints how many files of each root module changed, for
+// environments with more than one root.
+func printRootFormatStatus(envPath, envName string, changed []string, check bool) {
+	roots, err := envRoots(envPath, envName)
+	if err != nil || len(roots) < 2 {
+		return
+	}
+	configEnvDir := filepath.Join(envPath, "config", envName)
+	counts := make(map[string]int)
+	for _, path := range changed {
+		counts[rootOf(configEnvDir, roots, path)]++
+	}
+	verb := "formatted"
+	if check {
+		verb = "need formatting"
+	}
+	for _, root := range roots {
+		status := "ok"
+		if counts[root] > 0 {
+			status = fmt.Sprintf("%d file(s) %s", counts[root], verb)
+		}
+		fmt.Printf("Root %s: %s\n", rootLabel(envName, root), status)
+	}
+}
+
+// formatEnvironmentFiles walks root recursively and formats every supported file.
+// It returns the files that were changed (or that would change in check mode).
+func formatEnvironmentFiles(root, tfBinary string, opts formatOptions) ([]string, error) {
+	changed := []string{}
+	tfAvailable := fileExists(tfBinary)
+	warnedMissingTf := false
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			// Never descend into Terraform or Terragrunt working directories
+			if info.Name() == ".terraform" || info.Name() == ".terragrunt-cache" || info.Name() == backupsDirName {
+				return filepath.SkipDir
+			}
+			if path != root && matchesAnyGlob(relPath, opts.Exclude) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if matchesAnyGlob(relPath, opts.Exclude) {
+			return nil
+		}
+		if len(opts.Include) > 0 && !matchesAnyGlob(relPath, opts.Include) {
+			return nil
+		}
+
+		var fileChanged bool
+		name := info.Name()
+		if (strings.HasSuffix(name, ".tfvars") || strings.HasSuffix(name, ".tfvars.json")) && isSopsEncrypted(path) {
+			// Encrypted files are not HCL and their layout belongs to sops
+			return nil
+		}
+		switch {
+		case strings.HasSuffix(name, ".tfvars.json"):
+			fileChanged, err = formatJSONFile(path, opts.Check)
+		case strings.HasSuffix(name, ".tf") || strings.HasSuffix(name, ".tfvars"):
+			if !tfAvailable {
+				if !warnedMissingTf {
+					logger.Warnf("terraform binary not found at %s. Skipping .tf and .tfvars files.", tfBinary)
+					fmt.Printf("Warning: terraform binary not found at %s. Skipping .tf and .tfvars files.\n", tfBinary)
+					warnedMissingTf = true
+				}
+				return nil
+			}
+			fileChanged, err = formatTerraformFile(tfBinary, path, opts.Check)
+		case strings.HasSuffix(name, ".hcl"):
+			fileChanged, err = formatHCLFile(path, opts.Check)
+		default:
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if fileChanged {
+			changed = append(changed, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return changed, fmt.Errorf("error formatting files in %s: %w", root, err)
+	}
+
+	return changed, nil
+}
+
+// matchesAnyGlob reports whether relPath or its base name matches any of the glob patterns.
+func matchesAnyGlob(relPath string, globs []string) bool {
+	relPath = filepath.ToSlash(relPath)
+	for _, glob := range globs {
+		if ok, _ := filepath.Match(glob, relPath); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(glob, filepath.Base(relPath)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// formatTerraformFile runs the environment's terraform fmt against a single .tf or .tfvars file.
+func formatTerraformFile(tfBinary, path string, check bool) (bool, error) {
+	args := []string{"fmt", "-list=true"}
+	if check {
+		args = append(args, "-write=false")
+	}
+	args = append(args, filepath.Base(path))
+
+	// fmt runs in the file's directory, so the binary path must not be relative
+	cmdTf := exec.Command(absPath(tfBinary), args...)
+	cmdTf.Dir = filepath.Dir(path)
+	output, err := cmdTf.CombinedOutput()
+	if err != nil {
+		return false, fmt.Errorf("terraform fmt failed for %s: %v, output: %s", path, err, string(output))
+	}
+
+	return strings.TrimSpace(string(output)) != "", nil
+}
+
+// formatHCLFile formats a Terragrunt/HCL file using hclwrite.
+func formatHCLFile(path string, check bool) (bool, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	// Refuse to format files that do not parse, as hclwrite would only shuffle tokens around
+	if _, diags := hclwrite.ParseConfig(src, path, hcl.InitialPos); diags.HasErrors() {
+		return false, fmt.Errorf("failed to parse %s: %s", path, diags.Error())
+	}
+
+	formatted := hclwrite.Format(src)
+	if bytes.Equal(src, formatted) {
+		return false, nil
+	}
+
+	if !check {
+		if err := writeFilePreservingMode(path, formatted); err != nil {
+			return false, err
+		}
+		logger.Infof("Formatted %s", path)
+	}
+	return true, nil
+}
+
+// formatJSONFile rewrites a .tfvars.json file in canonical two-space indented form.
+func formatJSONFile(path string, check bool) (bool, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, bytes.TrimSpace(src), "", "  "); err != nil {
+		return false, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	buf.WriteString("\n")
+
+	formatted := buf.Bytes()
+	if bytes.Equal(src, formatted) {
+		return false, nil
+	}
+
+	if !check {
+		if err := writeFilePreservingMode(path, formatted); err != nil {
+			return false, err
+		}
+		logger.Infof("Formatted %s", path)
+	}
+	return true, nil
+}
+
+// writeFilePreservingMode overwrites path with data, keeping the existing file mode.
+func writeFilePreservingMode(path string, data []byte) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	if err := os.WriteFile(path, data, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	summary.fileWritten(path)
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// inGitHubActions reports whether tfvenv is running inside a GitHub Actions job.
+func inGitHubActions() bool {
+	return os.Getenv("GITHUB_ACTIONS") == "true"
+}
+
+// githubAnnotate emits an ::error or ::warning workflow command so the problem is
+// shown on the pull request. It is a no-op outside GitHub Actions.
+func githubAnnotate(level, file, message string) {
+	if !inGitHubActions() {
+		return
+	}
+
+	properties := ""
+	if file != "" {
+		// Annotations are matched against paths relative to the checkout
+		if workspace := os.Getenv("GITHUB_WORKSPACE"); workspace != "" {
+			if abs, err := filepath.Abs(file); err == nil {
+				if rel, err := filepath.Rel(workspace, abs); err == nil && !strings.HasPrefix(rel, "..") {
+					file = rel
+				}
+			}
+		}
+		properties = " file=" + escapeGitHubProperty(filepath.ToSlash(file))
+	}
+	fmt.Printf("::%s%s::%s\n", level, properties, escapeGitHubData(message))
+}
+
+// githubStepSummary appends markdown to the job summary. It is a no-op outside GitHub Actions.
+func githubStepSummary(markdown string) {
+	if !inGitHubActions() {
+		return
+	}
+	if err := appendGitHubFile("GITHUB_STEP_SUMMARY", markdown+"\n"); err != nil {
+		logger.Warnf("error writing step summary: %v", err)
+	}
+}
+
+// githubSetOutput exports a step output for downstream steps. It is a no-op outside GitHub Actions.
+func githubSetOutput(name, value string) {
+	if !inGitHubActions() {
+		return
+	}
+	entry := fmt.Sprintf("%s=%s\n", name, value)
+	if strings.Contains(value, "\n") {
+		delimiter := "TFVENV_EOF"
+		entry = fmt.Sprintf("%s<<%s\n%s\n%s\n", name, delimiter, value, delimiter)
+	}
+	if err := appendGitHubFile("GITHUB_OUTPUT", entry); err != nil {
+		logger.Warnf("error writing step output %s: %v", name, err)
+	}
+}
+
+// appendGitHubFile appends content to the file named by a GitHub Actions environment variable.
+func appendGitHubFile(envVar, content string) error {
+	path := os.Getenv(envVar)
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", envVar, err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		return fmt.Errorf("failed to write %s: %w", envVar, err)
+	}
+	return nil
+}
+
+// escapeGitHubData escapes a workflow command message.
+func escapeGitHubData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeGitHubProperty escapes a workflow command property value.
+func escapeGitHubProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
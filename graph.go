@@ -0,0 +1,294 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// terragruntSchema extracts the blocks that declare dependencies between Terragrunt units.
+var terragruntSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{
+		{Type: "dependency", LabelNames: []string{"name"}},
+		{Type: "dependencies"},
+	},
+}
+
+// graphCmd prints the dependency graph of the Terragrunt units in an environment
+func graphCmd() *cobra.Command {
+	var format string
+
+	cmd := &cobra.Command{
+		Use:   "graph <env-name>",
+		Short: "Show the Terragrunt dependency graph of the specified environment",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envDir := viper.GetString("env-dir")
+			envPath := filepath.Join(envDir, envName)
+			configDir := filepath.Join(envPath, "config", envName)
+
+			graph, err := buildTerragruntGraph(configDir)
+			if err != nil {
+				logger.Errorf("error building dependency graph: %v", err)
+				fmt.Printf("Error building dependency graph: %v\n", err)
+				os.Exit(1)
+			}
+
+			switch strings.ToLower(format) {
+			case "dot":
+				fmt.Print(renderGraphDOT(graph))
+			case "mermaid":
+				fmt.Print(renderGraphMermaid(graph))
+			case "tree":
+				fmt.Print(renderGraphTree(graph))
+			default:
+				fmt.Printf("Unsupported format '%s'. Use dot, mermaid, or tree.\n", format)
+				os.Exit(1)
+			}
+			logger.Infof("rendered dependency graph for environment '%s' with %d unit(s)", envName, len(graph))
+		},
+	}
+
+	cmd.Flags().StringVar(&format, "format", "tree", "Output format: dot, mermaid, or tree")
+
+	return cmd
+}
+
+// buildTerragruntGraph maps every Terragrunt unit under root (by relative directory) to the
+// units it depends on.
+func buildTerragruntGraph(root string) (map[string][]string, error) {
+	graph := make(map[string][]string)
+	parser := hclparse.NewParser()
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".terragrunt-cache" || info.Name() == ".terraform" || info.Name() == backupsDirName {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isTerragruntFile(info.Name()) {
+			return nil
+		}
+
+		unitDir := filepath.Dir(path)
+		unit := relativeUnitName(root, unitDir)
+		if _, ok := graph[unit]; !ok {
+			graph[unit] = []string{}
+		}
+
+		file, diags := parser.ParseHCLFile(path)
+		if diags.HasErrors() {
+			logger.Warnf("Failed to parse %s: %s", path, diags.Error())
+			return nil
+		}
+
+		for _, depPath := range terragruntDependencyPaths(file.Body, path) {
+			if !filepath.IsAbs(depPath) {
+				depPath = filepath.Join(unitDir, depPath)
+			}
+			graph[unit] = appendUnique(graph[unit], relativeUnitName(root, depPath))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk %s: %w", root, err)
+	}
+
+	// Make sure every dependency also appears as a node
+	for _, deps := range graph {
+		for _, dep := range deps {
+			if _, ok := graph[dep]; !ok {
+				graph[dep] = []string{}
+			}
+		}
+	}
+	for unit := range graph {
+		sort.Strings(graph[unit])
+	}
+
+	return graph, nil
+}
+
+// isTerragruntFile reports whether name is terragrunt.hcl or terragrunt.<env>.hcl.
+func isTerragruntFile(name string) bool {
+	return strings.HasPrefix(name, "terragrunt.") && strings.HasSuffix(name, ".hcl")
+}
+
+// terragruntDependencyPaths returns the config paths referenced by dependency and dependencies blocks.
+func terragruntDependencyPaths(body hcl.Body, filename string) []string {
+	paths := []string{}
+
+	content, _, diags := body.PartialContent(terragruntSchema)
+	if diags.HasErrors() {
+		logger.Warnf("Failed to read dependency blocks in %s: %s", filename, diags.Error())
+		return paths
+	}
+
+	for _, block := range content.Blocks {
+		switch block.Type {
+		case "dependency":
+			attrs, _, diags := block.Body.PartialContent(&hcl.BodySchema{
+				Attributes: []hcl.AttributeSchema{{Name: "config_path", Required: true}},
+			})
+			if diags.HasErrors() {
+				logger.Warnf("Dependency %q in %s has no usable config_path: %s", block.Labels[0], filename, diags.Error())
+				continue
+			}
+			value, diags := attrs.Attributes["config_path"].Expr.Value(nil)
+			if diags.HasErrors() || value.Type() != cty.String || !value.IsKnown() || value.IsNull() {
+				logger.Warnf("Dependency %q in %s uses a config_path that cannot be evaluated statically", block.Labels[0], filename)
+				continue
+			}
+			paths = append(paths, value.AsString())
+		case "dependencies":
+			attrs, _, diags := block.Body.PartialContent(&hcl.BodySchema{
+				Attributes: []hcl.AttributeSchema{{Name: "paths"}},
+			})
+			if diags.HasErrors() || attrs.Attributes["paths"] == nil {
+				continue
+			}
+			value, diags := attrs.Attributes["paths"].Expr.Value(nil)
+			if diags.HasErrors() || !value.CanIterateElements() {
+				logger.Warnf("dependencies.paths in %s cannot be evaluated statically", filename)
+				continue
+			}
+			for it := value.ElementIterator(); it.Next(); {
+				_, element := it.Element()
+				if element.Type() == cty.String && element.IsKnown() && !element.IsNull() {
+					paths = append(paths, element.AsString())
+				}
+			}
+		}
+	}
+
+	return paths
+}
+
+// relativeUnitName returns dir relative to root, using "." for the root itself.
+func relativeUnitName(root, dir string) string {
+	rel, err := filepath.Rel(root, dir)
+	if err != nil {
+		return filepath.ToSlash(dir)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// appendUnique appends value to list if it is not already present.
+func appendUnique(list []string, value string) []string {
+	for _, existing := range list {
+		if existing == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
+
+// sortedUnits returns the graph's node names in a stable order.
+func sortedUnits(graph map[string][]string) []string {
+	units := make([]string, 0, len(graph))
+	for unit := range graph {
+		units = append(units, unit)
+	}
+	sort.Strings(units)
+	return units
+}
+
+// renderGraphDOT renders the graph in Graphviz DOT format.
+func renderGraphDOT(graph map[string][]string) string {
+	var b strings.Builder
+	b.WriteString("digraph {\n")
+	for _, unit := range sortedUnits(graph) {
+		b.WriteString(fmt.Sprintf("  %q;\n", unit))
+		for _, dep := range graph[unit] {
+			b.WriteString(fmt.Sprintf("  %q -> %q;\n", unit, dep))
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// renderGraphMermaid renders the graph as a mermaid flowchart.
+func renderGraphMermaid(graph map[string][]string) string {
+	ids := make(map[string]string)
+	for i, unit := range sortedUnits(graph) {
+		ids[unit] = fmt.Sprintf("n%d", i)
+	}
+
+	var b strings.Builder
+	b.WriteString("graph TD\n")
+	for _, unit := range sortedUnits(graph) {
+		b.WriteString(fmt.Sprintf("  %s[\"%s\"]\n", ids[unit], unit))
+	}
+	for _, unit := range sortedUnits(graph) {
+		for _, dep := range graph[unit] {
+			b.WriteString(fmt.Sprintf("  %s --> %s\n", ids[unit], ids[dep]))
+		}
+	}
+	return b.String()
+}
+
+// renderGraphTree renders the graph as an ASCII tree rooted at the units nothing else depends on.
+// Units no root reaches, such as those in a cycle nothing outside it depends on, get trees of their own.
+func renderGraphTree(graph map[string][]string) string {
+	dependedOn := make(map[string]bool)
+	for _, deps := range graph {
+		for _, dep := range deps {
+			dependedOn[dep] = true
+		}
+	}
+
+	var b strings.Builder
+	visited := make(map[string]bool)
+	render := func(unit string) {
+		visited[unit] = true
+		b.WriteString(unit + "\n")
+		writeGraphTree(&b, graph, unit, "", map[string]bool{unit: true}, visited)
+	}
+	for _, unit := range sortedUnits(graph) {
+		if !dependedOn[unit] {
+			render(unit)
+		}
+	}
+	for _, unit := range sortedUnits(graph) {
+		if !visited[unit] {
+			render(unit)
+		}
+	}
+	return b.String()
+}
+
+// writeGraphTree writes the dependencies of unit below it, marking cycles instead of recursing into them.
+// Every unit written is added to visited.
+func writeGraphTree(b *strings.Builder, graph map[string][]string, unit, prefix string, seen, visited map[string]bool) {
+	deps := graph[unit]
+	for i, dep := range deps {
+		branch, childPrefix := "├── ", "│   "
+		if i == len(deps)-1 {
+			branch, childPrefix = "└── ", "    "
+		}
+
+		if seen[dep] {
+			b.WriteString(prefix + branch + dep + " (cycle)\n")
+			continue
+		}
+		b.WriteString(prefix + branch + dep + "\n")
+
+		seen[dep] = true
+		visited[dep] = true
+		writeGraphTree(b, graph, dep, prefix+childPrefix, seen, visited)
+		delete(seen, dep)
+	}
+}
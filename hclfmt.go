@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+)
+
+// defaultHclfmtPatterns select the Terragrunt files formatted by hclfmt --recursive.
+var defaultHclfmtPatterns = []string{"terragrunt.hcl", "terragrunt.*.hcl"}
+
+// hclfmtSkipDirs are never searched for .hcl files.
+var hclfmtSkipDirs = map[string]bool{".terragrunt-cache": true, ".terraform": true, ".git": true}
+
+// findHclFiles returns the files under root that match include, defaulting to
+// defaultHclfmtPatterns, and none of exclude. Excluded directories are not
+// descended into.
+func findHclFiles(root string, include, exclude []string) ([]string, error) {
+	if len(include) == 0 {
+		include = defaultHclfmtPatterns
+	}
+
+	var files []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != root && (hclfmtSkipDirs[info.Name()] || matchesAnyGlob(relPath, exclude)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if matchesAnyGlob(relPath, include) && !matchesAnyGlob(relPath, exclude) {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search %s for .hcl files: %w", root, err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// hclfmtFile formats or checks a single file with terragrunt hclfmt.
+func hclfmtFile(tgBinary, path string, check bool) error {
+	args := []string{"hclfmt"}
+	if check {
+		args = append(args, "--terragrunt-check")
+	}
+	// hclfmt runs in the file's directory, so neither path may be relative
+	cmdTg := exec.Command(absPath(tgBinary), append(args, absPath(path))...)
+	cmdTg.Dir = filepath.Dir(path)
+	output, err := cmdTg.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("hclfmt failed: %v, output: %s", err, string(output))
+	}
+	return nil
+}
+
+// runHclfmtTree formats or checks every matching file in the environment's
+// config directory, including nested stack directories, parallel at a time.
+// It returns the number of files processed.
+func runHclfmtTree(envDir, envType string, include, exclude []string, check bool, parallel int) (int, error) {
+	tgBinary := envBinaryPath(envDir, "terragrunt")
+	if !fileExists(tgBinary) {
+		return 0, fmt.Errorf("terragrunt binary not found at %s", tgBinary)
+	}
+
+	configDir := filepath.Join(envDir, "config", envType)
+	files, err := findHclFiles(configDir, include, exclude)
+	if err != nil {
+		return 0, err
+	}
+
+	var jobs []job
+	for _, file := range files {
+		file := file
+		name, _ := filepath.Rel(configDir, file)
+		jobs = append(jobs, job{Name: name, Run: func() error {
+			return hclfmtFile(tgBinary, file, check)
+		}})
+	}
+	if err := jobsError(runJobs(jobs, parallel)); err != nil {
+		return len(files), err
+	}
+	logger.Infof("hclfmt completed for %d file(s) in %s", len(files), configDir)
+	return len(files), nil
+}
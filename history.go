@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"tfvenv/i18n"
+	"tfvenv/snaps"
+)
+
+// historyEntry is one change in an environment's history.
+type historyEntry struct {
+	Time   time.Time         `json:"time"`
+	Type   string            `json:"type"`
+	User   string            `json:"user,omitempty"`
+	Host   string            `json:"host,omitempty"`
+	Detail string            `json:"detail"`
+	Data   map[string]string `json:"data,omitempty"`
+}
+
+// historyCmd lists the snaps, upgrades and merges of an environment in order.
+func historyCmd() *cobra.Command {
+	var since, until string
+	var jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "history <env-name>",
+		Short: "List the snaps, upgrades and merges of an environment in the order they happened",
+		Long: `List what happened to an environment, oldest first: its creation, upgrades,
+merges, snaps and expiry, from the environment's audit log, and the local snaps
+that the audit log does not mention, such as those saved before it existed.
+
+--since and --until take a date (2006-01-02), a time (RFC 3339) or a duration
+that is counted back from now (e.g. 72h). A date given to --until includes
+that whole day.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envPath := filepath.Join(viper.GetString("env-dir"), envName)
+			if _, err := os.Stat(envPath); os.IsNotExist(err) {
+				i18n.Println("env.not_found", envName)
+				os.Exit(1)
+			}
+
+			now := time.Now()
+			var from, to time.Time
+			var err error
+			if since != "" {
+				if from, err = parseHistoryTime(since, now, false); err != nil {
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+			}
+			if until != "" {
+				if to, err = parseHistoryTime(until, now, true); err != nil {
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+			}
+
+			entries, err := environmentHistory(envPath)
+			if err != nil {
+				logger.Errorf("error reading the history of %s: %v", envName, err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			entries = filterHistory(entries, from, to)
+
+			if jsonOutput {
+				if entries == nil {
+					entries = []historyEntry{}
+				}
+				data, err := json.MarshalIndent(entries, "", "  ")
+				if err != nil {
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+				fmt.Println(string(data))
+				return
+			}
+			if len(entries) == 0 {
+				fmt.Printf("No history recorded for %s in that period.\n", envName)
+				return
+			}
+			for _, entry := range entries {
+				who := ""
+				if entry.User != "" {
+					who = entry.User
+					if entry.Host != "" {
+						who += "@" + entry.Host
+					}
+				}
+				fmt.Printf("%s  %-13s %-20s %s\n", entry.Time.Local().Format("2006-01-02 15:04"), entry.Type, who, entry.Detail)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&since, "since", "", "Only list changes at or after this date, time or duration ago")
+	cmd.Flags().StringVar(&until, "until", "", "Only list changes before this date, time or duration ago")
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the history as JSON")
+	return cmd
+}
+
+// environmentHistory returns the audit log events of an environment and its
+// local snaps that no snap.saved event covers, oldest first.
+func environmentHistory(envPath string) ([]historyEntry, error) {
+	events, err := readAuditLog(envPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []historyEntry
+	recorded := make(map[string]bool)
+	for _, event := range events {
+		if event.Type == eventSnapSaved {
+			recorded[strings.TrimSuffix(filepath.Base(event.Data["location"]), ".snap")] = true
+		}
+		entries = append(entries, historyEntry{
+			Time:   event.Time,
+			Type:   event.Type,
+			User:   event.User,
+			Host:   event.Host,
+			Detail: describeEvent(event),
+			Data:   event.Data,
+		})
+	}
+
+	files, err := snaps.ListSnapFiles(envPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if recorded[file.Name] {
+			continue
+		}
+		entries = append(entries, historyEntry{
+			Time:   file.ModTime.UTC(),
+			Type:   eventSnapSaved,
+			Detail: fmt.Sprintf("snap %s in %s (not in the audit log)", file.Name, file.Path),
+			Data:   map[string]string{"snap": file.Name, "location": file.Path},
+		})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	return entries, nil
+}
+
+// readAuditLog reads an environment's audit log. A missing log yields no
+// events, and lines that do not parse are skipped with a warning.
+func readAuditLog(envPath string) ([]Event, error) {
+	logPath := filepath.Join(envPath, auditLogFileName)
+	file, err := os.Open(logPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log %s: %w", logPath, err)
+	}
+	defer file.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			logger.Warnf("skipping line %d of %s: %v", line, logPath, err)
+			continue
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log %s: %w", logPath, err)
+	}
+	return events, nil
+}
+
+// describeEvent summarizes an audit log event in one line.
+func describeEvent(event Event) string {
+	data := event.Data
+	switch event.Type {
+	case eventEnvCreated:
+		return fmt.Sprintf("created with %s", describeVersions(data))
+	case eventEnvUpgraded:
+		return fmt.Sprintf("upgraded to %s", describeVersions(data))
+	case eventEnvMerged:
+		detail := fmt.Sprintf("merged %s templates (strategy %s)", data["env_type"], data["strategy"])
+		if data["added"] != "" {
+			detail += "; added " + data["added"]
+		}
+		if data["ours"] != "" {
+			detail += "; kept the environment's " + data["ours"]
+		}
+		if data["theirs"] != "" {
+			detail += "; took the template's " + data["theirs"]
+		}
+		return detail
+	case eventSnapSaved:
+		return fmt.Sprintf("snap %s saved to %s", data["snap"], data["location"])
+	case eventEnvExpired:
+		return fmt.Sprintf("expired (%s), final snap %s", data["action"], data["snap"])
+	}
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + "=" + data[key]
+	}
+	return strings.Join(pairs, " ")
+}
+
+// describeVersions lists the tool versions in an event's data.
+func describeVersions(data map[string]string) string {
+	tool := data["tool"]
+	if tool == "" {
+		tool = toolTerraform
+	}
+	parts := []string{tool + " " + data["terraform_version"]}
+	if v := data["terragrunt_version"]; v != "" && v != "none" {
+		parts = append(parts, "terragrunt "+v)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// filterHistory keeps the entries at or after from and before to. Zero
+// bounds are ignored.
+func filterHistory(entries []historyEntry, from, to time.Time) []historyEntry {
+	var kept []historyEntry
+	for _, entry := range entries {
+		if !from.IsZero() && entry.Time.Before(from) {
+			continue
+		}
+		if !to.IsZero() && !entry.Time.Before(to) {
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	return kept
+}
+
+// parseHistoryTime parses a --since or --until value: an RFC 3339 time, a
+// local date, or a duration before now. endOfDay moves a date to the start
+// of the following day, so the whole day is included.
+func parseHistoryTime(value string, now time.Time, endOfDay bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		if endOfDay {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q: use a date (2006-01-02), an RFC 3339 time or a duration such as 72h", value)
+}
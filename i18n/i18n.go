@@ -0,0 +1,132 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultLanguage is the source language every message is written in first.
+const DefaultLanguage = "en"
+
+// locales holds one JSON catalog per language, mapping message keys to format strings.
+//
+//go:embed locales/*.json
+var locales embed.FS
+
+var (
+	mu       sync.Mutex
+	language = DefaultLanguage
+	catalogs = make(map[string]map[string]string)
+)
+
+// SetLanguage selects the catalog for a language tag such as de, pt_BR or
+// de_DE.UTF-8. Unknown languages leave English in place and return an error.
+func SetLanguage(tag string) error {
+	lang, err := resolve(tag)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	language = lang
+	return nil
+}
+
+// Language returns the language in effect.
+func Language() string {
+	mu.Lock()
+	defer mu.Unlock()
+	return language
+}
+
+// Languages returns the languages with a catalog, sorted.
+func Languages() []string {
+	entries, _ := locales.ReadDir("locales")
+	var langs []string
+	for _, entry := range entries {
+		langs = append(langs, strings.TrimSuffix(entry.Name(), ".json"))
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// LanguageFromEnv returns the language requested by TFVENV_LANG, LC_ALL,
+// LC_MESSAGES or LANG, in that order.
+func LanguageFromEnv() string {
+	for _, name := range []string{"TFVENV_LANG", "LC_ALL", "LC_MESSAGES", "LANG"} {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return DefaultLanguage
+}
+
+// T formats the message for key in the current language. Messages missing from
+// a translation fall back to English, and unknown keys are returned as is.
+func T(key string, args ...interface{}) string {
+	format, ok := lookup(Language(), key)
+	if !ok {
+		format, ok = lookup(DefaultLanguage, key)
+	}
+	if !ok {
+		format = key
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Println prints the message for key followed by a newline.
+func Println(key string, args ...interface{}) {
+	fmt.Println(T(key, args...))
+}
+
+// resolve maps a language tag to an available catalog, trying the full
+// language_REGION first and then the language alone.
+func resolve(tag string) (string, error) {
+	normalized := strings.ToLower(tag)
+	if i := strings.IndexAny(normalized, ".@"); i >= 0 {
+		normalized = normalized[:i]
+	}
+	normalized = strings.ReplaceAll(normalized, "-", "_")
+	if normalized == "" || normalized == "c" || normalized == "posix" {
+		return DefaultLanguage, nil
+	}
+
+	available := Languages()
+	candidates := []string{normalized}
+	if i := strings.Index(normalized, "_"); i > 0 {
+		candidates = append(candidates, normalized[:i])
+	}
+	for _, candidate := range candidates {
+		for _, lang := range available {
+			if strings.ToLower(lang) == candidate {
+				return lang, nil
+			}
+		}
+	}
+	return DefaultLanguage, fmt.Errorf("no translation for language %q (available: %s)", tag, strings.Join(available, ", "))
+}
+
+// lookup returns the format string for key from a language's catalog.
+func lookup(lang, key string) (string, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	catalog, ok := catalogs[lang]
+	if !ok {
+		catalog = make(map[string]string)
+		if data, err := locales.ReadFile(path.Join("locales", lang+".json")); err == nil {
+			json.Unmarshal(data, &catalog)
+		}
+		catalogs[lang] = catalog
+	}
+	format, ok := catalog[key]
+	return format, ok
+}
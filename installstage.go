@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// installStagePrefix names the directories in an environment's bin directory
+// that installs download, extract and verify a tool in.
+const installStagePrefix = ".install-"
+
+// staleInstallStageAge is how old an install directory must be before a
+// later install removes it as left behind by a killed process.
+const staleInstallStageAge = 24 * time.Hour
+
+// replacedBinarySuffix is appended to a binary Windows would not let an
+// install replace because it was running.
+const replacedBinarySuffix = ".tfvenv-old"
+
+// newInstallStage creates the directory one install works in, and returns it
+// with the function that removes it, which also runs on an interrupt. It is
+// made in binDir so that the verified binary is renamed into place on the
+// same filesystem.
+func newInstallStage(binDir string) (string, func(), error) {
+	if err := os.MkdirAll(binDir, 0755); err != nil {
+		return "", nil, fmt.Errorf("failed to create %s: %w", binDir, err)
+	}
+	removeStaleInstallStages(binDir)
+	dir, err := os.MkdirTemp(binDir, installStagePrefix)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create an install directory in %s: %w", binDir, err)
+	}
+	removeCleanup := onInterrupt(func() { os.RemoveAll(dir) })
+	return dir, func() {
+		removeCleanup()
+		os.RemoveAll(dir)
+	}, nil
+}
+
+// removeStaleInstallStages removes the install directories in binDir that a
+// process killed mid-install left behind.
+func removeStaleInstallStages(binDir string) {
+	stages, _ := filepath.Glob(filepath.Join(binDir, installStagePrefix+"*"))
+	for _, stage := range stages {
+		info, err := os.Stat(stage)
+		if err != nil || !info.IsDir() || time.Since(info.ModTime()) < staleInstallStageAge {
+			continue
+		}
+		if err := os.RemoveAll(stage); err != nil {
+			logger.Warnf("failed to remove %s: %v", stage, err)
+		}
+	}
+}
+
+// commitStagedBinary moves a verified binary over binaryPath with a single
+// rename, so a shell using the environment runs either the old binary or the
+// new one, never a partial or unverified file. Windows refuses to replace an
+// executable that is running; the old one is renamed aside first and removed
+// once it is no longer in use.
+func commitStagedBinary(staged, binaryPath string) error {
+	err := os.Rename(staged, binaryPath)
+	if err == nil {
+		return nil
+	}
+	if runtime.GOOS != "windows" || !fileExists(binaryPath) {
+		return fmt.Errorf("failed to move %s into place: %w", binaryPath, err)
+	}
+	old := binaryPath + replacedBinarySuffix
+	os.Remove(old)
+	if err := os.Rename(binaryPath, old); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", binaryPath, err)
+	}
+	if err := os.Rename(staged, binaryPath); err != nil {
+		os.Rename(old, binaryPath)
+		return fmt.Errorf("failed to move %s into place: %w", binaryPath, err)
+	}
+	os.Remove(old)
+	return nil
+}
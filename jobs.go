@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// defaultParallelism is the number of tasks bulk commands run at once unless --parallel is given.
+const defaultParallelism = 4
+
+// job is one task of a bulk operation.
+type job struct {
+	Name string
+	Run  func() error
+}
+
+// jobResult is the outcome of a job.
+type jobResult struct {
+	Name    string
+	Err     error
+	Elapsed time.Duration
+}
+
+// addParallelFlag registers the --parallel flag shared by bulk commands.
+func addParallelFlag(cmd *cobra.Command, parallel *int) {
+	cmd.Flags().IntVar(parallel, "parallel", defaultParallelism, "Maximum number of tasks to run at once")
+}
+
+// runJobs runs jobs with at most parallel of them at a time and prints a
+// progress line as each one finishes. Results are returned in job order.
+func runJobs(jobs []job, parallel int) []jobResult {
+	if parallel < 1 {
+		parallel = 1
+	}
+	results := make([]jobResult, len(jobs))
+	slots := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	finished := 0
+
+	for i, j := range jobs {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, j job) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			start := time.Now()
+			endPhase := summary.phase(j.Name)
+			err := j.Run()
+			endPhase()
+			results[i] = jobResult{Name: j.Name, Err: err, Elapsed: time.Since(start)}
+
+			mu.Lock()
+			defer mu.Unlock()
+			finished++
+			status := "ok"
+			if err != nil {
+				status = "failed"
+				logger.Errorf("task %s failed: %v", j.Name, err)
+			}
+			fmt.Printf("[%d/%d] %s: %s (%s)\n", finished, len(jobs), j.Name, status, results[i].Elapsed.Round(100*time.Millisecond))
+		}(i, j)
+	}
+	wg.Wait()
+	return results
+}
+
+// jobsError aggregates the failures of a run into a single error, or returns nil if every job succeeded.
+func jobsError(results []jobResult) error {
+	var failed []string
+	for _, result := range results {
+		if result.Err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", result.Name, result.Err))
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of %d task(s) failed:\n  %s", len(failed), len(results), strings.Join(failed, "\n  "))
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// createLink makes link point at target. Creating symlinks on Windows needs
+// Developer Mode or an elevated shell; without them, a directory is linked
+// with an NTFS junction and a file with a hard link, neither of which needs
+// privileges. A hard link only works within one volume and keeps the file
+// alive if target is removed.
+func createLink(target, link string) error {
+	symlinkErr := os.Symlink(target, link)
+	if symlinkErr == nil || runtime.GOOS != "windows" {
+		return symlinkErr
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		return fmt.Errorf("failed to link %s: %w", link, err)
+	}
+	if info.IsDir() {
+		out, err := exec.Command("cmd", "/c", "mklink", "/J", link, target).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("failed to link %s to %s: symlink: %v; junction: %v: %s", link, target, symlinkErr, err, out)
+		}
+		logger.Infof("linked %s to %s with a junction", link, target)
+		return nil
+	}
+	if err := os.Link(target, link); err != nil {
+		return fmt.Errorf("failed to link %s to %s: symlink: %v; hard link: %w", link, target, symlinkErr, err)
+	}
+	logger.Infof("linked %s to %s with a hard link", link, target)
+	return nil
+}
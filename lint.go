@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// linterSpec describes how to invoke an ecosystem linter against a configuration directory.
+type linterSpec struct {
+	Name        string
+	VersionArgs []string
+	Args        func(dir string) []string
+}
+
+// supportedLinters lists the linters tfvenv knows how to run, in execution order.
+var supportedLinters = []linterSpec{
+	{
+		Name:        "tflint",
+		VersionArgs: []string{"--version"},
+		Args:        func(dir string) []string { return []string{"--chdir=" + dir, "--no-color"} },
+	},
+	{
+		Name:        "tfsec",
+		VersionArgs: []string{"--version"},
+		Args:        func(dir string) []string { return []string{dir, "--no-color"} },
+	},
+	{
+		Name:        "checkov",
+		VersionArgs: []string{"--version"},
+		Args:        func(dir string) []string { return []string{"-d", dir, "--compact", "--quiet"} },
+	},
+}
+
+// lintResult holds the outcome of a single linter run.
+type lintResult struct {
+	Linter   string `json:"linter"`
+	Version  string `json:"version,omitempty"`
+	Binary   string `json:"binary,omitempty"`
+	Status   string `json:"status"` // passed, failed, skipped, error
+	ExitCode int    `json:"exit_code"`
+	Duration string `json:"duration"`
+	Output   string `json:"output,omitempty"`
+}
+
+// lintReport is the merged report of every linter run against an environment.
+type lintReport struct {
+	Environment string       `json:"environment"`
+	ConfigDir   string       `json:"config_dir"`
+	Passed      bool         `json:"passed"`
+	Results     []lintResult `json:"results"`
+}
+
+// lintCmd runs tflint, tfsec, and checkov against the environment's configuration
+func lintCmd() *cobra.Command {
+	var linters []string
+	var jsonOutput bool
+	var requireAll bool
+
+	cmd := &cobra.Command{
+		Use:   "lint <env-name>",
+		Short: "Run tflint, tfsec, and checkov against the specified environment's configuration",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			// stdout carries the JSON report, so logs go elsewhere
+			if jsonOutput && os.Getenv("TFVENV_LOG_FILE") == "" {
+				logger.Out = os.Stderr
+			}
+			envName := args[0]
+			envDir := viper.GetString("env-dir")
+			envPath := filepath.Join(envDir, envName)
+			configDir := filepath.Join(envPath, "config", envName)
+
+			if _, err := os.Stat(configDir); os.IsNotExist(err) {
+				logger.Errorf("config directory %s does not exist", configDir)
+				fmt.Printf("Error: config directory %s does not exist.\n", configDir)
+				os.Exit(1)
+			}
+
+			report, err := runLinters(envPath, configDir, linters, requireAll)
+			if err != nil {
+				logger.Errorf("lint failed: %v", err)
+				fmt.Printf("Error running linters: %v\n", err)
+				os.Exit(1)
+			}
+			report.Environment = envName
+
+			if jsonOutput {
+				out, _ := json.MarshalIndent(report, "", "  ")
+				fmt.Println(string(out))
+			} else {
+				printLintReport(report)
+			}
+			githubLintReport(report)
+
+			if !report.Passed {
+				logger.Warnf("lint failed for environment '%s'", envName)
+				os.Exit(1)
+			}
+			logger.Infof("lint passed for environment '%s'", envName)
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&linters, "linters", []string{"tflint", "tfsec", "checkov"}, "Linters to run")
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the merged report as JSON")
+	cmd.Flags().BoolVar(&requireAll, "require", false, "Fail when a requested linter is not installed")
+
+	return cmd
+}
+
+// runLinters runs the requested linters against configDir and merges their results.
+func runLinters(envPath, configDir string, names []string, requireAll bool) (lintReport, error) {
+	report := lintReport{ConfigDir: configDir, Passed: true}
+
+	for _, name := range names {
+		spec, ok := findLinter(name)
+		if !ok {
+			return report, fmt.Errorf("unsupported linter: %s", name)
+		}
+
+		result := runLinter(envPath, configDir, spec)
+		if result.Status == "failed" || result.Status == "error" || (result.Status == "skipped" && requireAll) {
+			report.Passed = false
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	return report, nil
+}
+
+// findLinter looks up a linter by name in supportedLinters.
+func findLinter(name string) (linterSpec, bool) {
+	for _, spec := range supportedLinters {
+		if spec.Name == strings.ToLower(name) {
+			return spec, true
+		}
+	}
+	return linterSpec{}, false
+}
+
+// resolveToolBinary prefers the environment-managed binary and falls back to PATH.
+func resolveToolBinary(envPath, tool string) (string, error) {
+	envBinary := envBinaryPath(envPath, tool)
+	if fileExists(envBinary) {
+		return envBinary, nil
+	}
+	return exec.LookPath(tool)
+}
+
+// runLinter executes a single linter and captures its outcome.
+func runLinter(envPath, configDir string, spec linterSpec) lintResult {
+	result := lintResult{Linter: spec.Name}
+
+	binary, err := resolveToolBinary(envPath, spec.Name)
+	if err != nil {
+		result.Status = "skipped"
+		result.Output = fmt.Sprintf("%s is not installed in the environment or on PATH", spec.Name)
+		logger.Warnf("%s not found, skipping", spec.Name)
+		return result
+	}
+	result.Binary = binary
+
+	if out, err := exec.Command(binary, spec.VersionArgs...).CombinedOutput(); err == nil {
+		result.Version = firstLine(string(out))
+	}
+
+	// The linter runs in the config directory, so the paths it gets must be absolute
+	start := time.Now()
+	cmdLint := exec.Command(absPath(binary), spec.Args(absPath(configDir))...)
+	cmdLint.Dir = configDir
+	output, err := cmdLint.CombinedOutput()
+	result.Duration = time.Since(start).Round(time.Millisecond).String()
+	result.Output = strings.TrimSpace(string(output))
+
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+		result.Status = "passed"
+	case errors.As(err, &exitErr):
+		result.Status = "failed"
+		result.ExitCode = exitErr.ExitCode()
+	default:
+		result.Status = "error"
+		result.ExitCode = -1
+		result.Output = err.Error()
+	}
+
+	logger.Infof("%s finished with status %s in %s", spec.Name, result.Status, result.Duration)
+	return result
+}
+
+// printLintReport prints a human readable summary of a lint report.
+func printLintReport(report lintReport) {
+	fmt.Printf("Lint report for environment '%s' (%s):\n", report.Environment, report.ConfigDir)
+	for _, result := range report.Results {
+		version := result.Version
+		if version == "" {
+			version = "unknown version"
+		}
+		fmt.Printf("\n== %s (%s): %s\n", result.Linter, version, strings.ToUpper(result.Status))
+		if result.Output != "" && result.Status != "passed" {
+			fmt.Println(result.Output)
+		}
+	}
+
+	if report.Passed {
+		fmt.Println("\nAll linters passed.")
+	} else {
+		fmt.Println("\nOne or more linters reported problems.")
+	}
+}
+
+// githubLintReport annotates failing linters and writes a summary table when
+// running inside GitHub Actions.
+func githubLintReport(report lintReport) {
+	if !inGitHubActions() {
+		return
+	}
+
+	var summary strings.Builder
+	summary.WriteString(fmt.Sprintf("### tfvenv lint: %s\n\n", report.Environment))
+	summary.WriteString("| Linter | Version | Status |\n|---|---|---|\n")
+	for _, result := range report.Results {
+		summary.WriteString(fmt.Sprintf("| %s | %s | %s |\n", result.Linter, result.Version, result.Status))
+		switch result.Status {
+		case "failed", "error":
+			githubAnnotate("error", "", fmt.Sprintf("%s: %s", result.Linter, firstLine(result.Output)))
+		case "skipped":
+			githubAnnotate("warning", "", fmt.Sprintf("%s was skipped: %s", result.Linter, firstLine(result.Output)))
+		}
+	}
+	githubStepSummary(summary.String())
+}
+
+// firstLine returns the first non-empty line of s.
+func firstLine(s string) string {
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
@@ -1,10 +1,11 @@
 package main
 
 import (
-	"archive/zip"
 	"bufio"
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,7 +14,6 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"runtime"
 	"sort"
 	"strings"
 	"time"
@@ -25,6 +25,8 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 
+	"tfvenv/i18n"
+	"tfvenv/netretry"
 	"tfvenv/snaps"
 )
 
@@ -33,11 +35,16 @@ const (
 	terragruntDownloadURL = "https://github.com/gruntwork-io/terragrunt/releases/download/"
 	tfvenvrcFileName      = ".tfvenvrc"
 	lockFileName          = ".lock"
+	incompleteMarkerName  = ".tfvenv-incomplete"
 )
 
 // Global logger
 var logger = logrus.New()
 
+// httpClient is used for every request to releases.hashicorp.com, GitHub and
+// the registry; it retries and circuit-breaks according to the netretry policy.
+var httpClient = netretry.NewClient(0)
+
 // Config structure parsed from tfvenvrc
 type Config struct {
 	TfVersion          string            `mapstructure:"TF_VERSION"`
@@ -53,17 +60,51 @@ type Config struct {
 	RemoteSnapAuth     string            `mapstructure:"REMOTE_SNAP_AUTH"`
 	RemoteSnapType     string            `mapstructure:"REMOTE_SNAP_TYPE"`
 	EnvVars            map[string]string `mapstructure:"ENV_VARS"`
+	InfracostVersion   string            `mapstructure:"INFRACOST_VERSION"`
+	CostThreshold      float64           `mapstructure:"COST_THRESHOLD"`
+	DynamoDBTable      string            `mapstructure:"DYNAMODB_TABLE"`
+	Providers          string            `mapstructure:"PROVIDERS"`
+	EventSocket        string            `mapstructure:"EVENT_SOCKET"`
+	EventCommand       string            `mapstructure:"EVENT_COMMAND"`
+	Owner              string            `mapstructure:"OWNER"`
+	AWSProfile         string            `mapstructure:"AWS_PROFILE"`
+	AWSRegion          string            `mapstructure:"AWS_REGION"`
+	SopsKMSArn         string            `mapstructure:"SOPS_KMS_ARN"`
+	SopsAgeRecipients  string            `mapstructure:"SOPS_AGE_RECIPIENTS"`
+	SopsAgeKeyFile     string            `mapstructure:"SOPS_AGE_KEY_FILE"`
+	Tool               string            `mapstructure:"TOOL"`
+	Roots              string            `mapstructure:"ROOTS"`
+	EnforceVersions    bool              `mapstructure:"ENFORCE_VERSIONS"`
+	RemoteSnapKey      string            `mapstructure:"REMOTE_SNAP_KEY"`
+	SnapExpireDays     int               `mapstructure:"REMOTE_SNAP_EXPIRE_DAYS"`
+	SnapNoncurrentDays int               `mapstructure:"REMOTE_SNAP_NONCURRENT_DAYS"`
+	SnapReplicaBucket  string            `mapstructure:"REMOTE_SNAP_REPLICA_BUCKET"`
+	SnapReplicaRegion  string            `mapstructure:"REMOTE_SNAP_REPLICA_REGION"`
+	SnapReplicaProfile string            `mapstructure:"REMOTE_SNAP_REPLICA_PROFILE"`
+	Parallelism        int               `mapstructure:"PARALLELISM"`
+	PluginCacheMaxSize string            `mapstructure:"PLUGIN_CACHE_MAX_SIZE"`
+	TfSHA256           string            `mapstructure:"TF_SHA256"`
+	TgSHA256           string            `mapstructure:"TG_SHA256"`
+	// Terraform CLI configuration written to the environment's .terraformrc
+	CLIProviderMirror    string `mapstructure:"CLI_PROVIDER_MIRROR"`
+	CLICredentialsHelper string `mapstructure:"CLI_CREDENTIALS_HELPER"`
+	CLIDisableCheckpoint bool   `mapstructure:"CLI_DISABLE_CHECKPOINT"`
+	// CLIArgs holds the TF_CLI_ARGS and TF_CLI_ARGS_<command> keys, which
+	// have no fixed names and are collected by tfCLIArgs
+	CLIArgs map[string]string
 }
 
 // EnvironmentState holds the structure of the environment's state.
 type EnvironmentState struct {
-	TerraformVersion   string            `json:"terraform_version"`
-	TerragruntVersion  string            `json:"terragrunt_version"`
-	OS                 string            `json:"os"`
-	Architecture       string            `json:"architecture"`
-	EnvironmentVars    map[string]string `json:"environment_vars"`
-	Plugins            map[string]string `json:"plugins"`
-	AdditionalMetadata map[string]string `json:"additional_metadata"`
+	TerraformVersion   string             `json:"terraform_version"`
+	TerragruntVersion  string             `json:"terragrunt_version"`
+	OS                 string             `json:"os"`
+	Architecture       string             `json:"architecture"`
+	EnvironmentVars    map[string]string  `json:"environment_vars"`
+	Plugins            map[string]string  `json:"plugins"`
+	AdditionalMetadata map[string]string  `json:"additional_metadata"`
+	Tool               string             `json:"tool,omitempty"`
+	Git                *snaps.GitRevision `json:"git,omitempty"`
 }
 
 // TerraformRelease represents a specific version release of Terraform.
@@ -94,19 +135,75 @@ func main() {
 		Use:   "tfvenv",
 		Short: "tfvenv manages virtual environments for Terraform and Terragrunt",
 		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			showSummary, _ := cmd.Flags().GetBool("summary")
+			summary.start(cmd.CommandPath(), showSummary)
+
+			// Where tfvenv keeps its own files, for service accounts without
+			// a home directory and shared runners
+			configureUserDirs(cmd)
+
 			// Validate env-dir exists
 			envDir := viper.GetString("env-dir")
 			if _, err := os.Stat(envDir); os.IsNotExist(err) {
 				logger.Fatalf("Environment directory %s does not exist", envDir)
 			}
+
+			// Shared retry/backoff policy for all network calls
+			policy, err := netretry.PolicyFromEnv()
+			if err != nil {
+				logger.Warnf("%v; using the default retry policy", err)
+			}
+			netretry.Configure(policy)
+			netretry.SetUserAgent(userAgentFor(cmd.CommandPath()))
+
+			// Bandwidth cap for downloads and uploads on shared uplinks
+			limitRate, _ := cmd.Flags().GetString("limit-rate")
+			if limitRate == "" {
+				limitRate = os.Getenv("TFVENV_LIMIT_RATE")
+			}
+			if limitRate != "" {
+				if rate, err := parseSize(limitRate); err != nil {
+					logger.Warnf("invalid transfer rate limit: %v; not limiting transfers", err)
+				} else {
+					netretry.SetRateLimit(rate)
+				}
+			}
+
+			// Modes for generated scripts and files that carry environment variables
+			perms, err := permissionPolicyFromEnv()
+			if err != nil {
+				logger.Warnf("%v; using the default permission policy", err)
+			}
+			permissions = perms
+
+			// Language of user-facing messages; locale variables that have no
+			// catalog fall back to English silently
+			lang, _ := cmd.Flags().GetString("lang")
+			explicit := lang != "" || os.Getenv("TFVENV_LANG") != ""
+			if lang == "" {
+				lang = i18n.LanguageFromEnv()
+			}
+			if err := i18n.SetLanguage(lang); err != nil && explicit {
+				logger.Warnf("%v; using English", err)
+			}
+		},
+		PersistentPostRun: func(cmd *cobra.Command, args []string) {
+			summary.report()
 		},
 	}
 
 	// Define persistent flags
 	rootCmd.PersistentFlags().StringP("env-dir", "e", ".", "Base directory for environments")
 	viper.BindPFlag("env-dir", rootCmd.PersistentFlags().Lookup("env-dir"))
+	rootCmd.PersistentFlags().String("data-dir", "", "Directory for tfvenv's data, such as snaps and the version store (defaults to TFVENV_DATA_DIR, then the per-user data directory)")
+	rootCmd.PersistentFlags().Bool("system", false, "Use the system-wide data, cache and config directories shared by every user of the host (also TFVENV_SYSTEM=1)")
+	rootCmd.PersistentFlags().BoolVar(&refreshLatest, "refresh", false, "Look up \"latest\" versions again instead of reusing one resolved within TFVENV_LATEST_TTL")
+	rootCmd.PersistentFlags().String("limit-rate", "", "Maximum transfer rate per second for all downloads and uploads, e.g. 500K or 2M (defaults to TFVENV_LIMIT_RATE)")
+	rootCmd.PersistentFlags().String("lang", "", "Language for messages, such as en or de (defaults to TFVENV_LANG, then the locale)")
+	rootCmd.PersistentFlags().Bool("summary", false, "Print the files written, bytes downloaded and time per phase when the command finishes, and log them as JSON")
 
 	// Add all subcommands to rootCmd
+	rootCmd.AddCommand(initCmd())
 	rootCmd.AddCommand(createCmd())
 	rootCmd.AddCommand(deleteCmd())
 	rootCmd.AddCommand(listCmd())
@@ -116,9 +213,51 @@ func main() {
 	rootCmd.AddCommand(statusCmd())
 	rootCmd.AddCommand(upgradeCmd())
 	rootCmd.AddCommand(mergeCmd())
+	rootCmd.AddCommand(historyCmd())
+	rootCmd.AddCommand(templatesCmd())
 	rootCmd.AddCommand(lockCmd())
 	rootCmd.AddCommand(unlockCmd())
 	rootCmd.AddCommand(hclfmtCmd())
+	rootCmd.AddCommand(fmtCmd())
+	rootCmd.AddCommand(watchCmd())
+	rootCmd.AddCommand(lintCmd())
+	rootCmd.AddCommand(docsCmd())
+	rootCmd.AddCommand(costCmd())
+	rootCmd.AddCommand(workspaceCmd())
+	rootCmd.AddCommand(stateCmd())
+	rootCmd.AddCommand(driftCmd())
+	rootCmd.AddCommand(graphCmd())
+	rootCmd.AddCommand(modulesCmd())
+	rootCmd.AddCommand(bootstrapBackendCmd())
+	rootCmd.AddCommand(ciCmd())
+	rootCmd.AddCommand(precommitCmd())
+	rootCmd.AddCommand(configCmd())
+	rootCmd.AddCommand(schemaCmd())
+	rootCmd.AddCommand(exportCmd())
+	rootCmd.AddCommand(daemonCmd())
+	rootCmd.AddCommand(registryCmd())
+	rootCmd.AddCommand(credentialsCmd())
+	rootCmd.AddCommand(doctorCmd())
+	rootCmd.AddCommand(repairCmd())
+	rootCmd.AddCommand(checkCmd())
+	rootCmd.AddCommand(syncCmd())
+	rootCmd.AddCommand(upCmd())
+	rootCmd.AddCommand(restoreAllCmd())
+	rootCmd.AddCommand(applyManifestCmd())
+	rootCmd.AddCommand(attestCmd())
+	rootCmd.AddCommand(guardCmd())
+	rootCmd.AddCommand(maintainCmd())
+	rootCmd.AddCommand(toolsCmd())
+	rootCmd.AddCommand(secretsCmd())
+	rootCmd.AddCommand(envCmd())
+	rootCmd.AddCommand(execCmd())
+	rootCmd.AddCommand(whichCmd())
+	rootCmd.AddCommand(diffEnvsCmd())
+	rootCmd.AddCommand(foreachCmd())
+	rootCmd.AddCommand(benchCmd())
+	rootCmd.AddCommand(prefetchCmd())
+	rootCmd.AddCommand(dirsCmd())
+	rootCmd.AddCommand(migrateCmd())
 	rootCmd.AddCommand(completionCmd(rootCmd))
 	rootCmd.AddCommand(listVersionsCmd())
 	rootCmd.AddCommand(switchCmd())
@@ -127,38 +266,38 @@ func main() {
 	rootCmd.AddCommand(cleanupCmd())
 	rootCmd.AddCommand(snapCmd()) // Only add once
 
-	// Execute the root command
-	if err := rootCmd.Execute(); err != nil {
+	// Expose tfvenv-<name> executables on PATH as subcommands
+	registerPlugins(rootCmd)
+
+	// Execute the root command; the context is cancelled on SIGINT/SIGTERM
+	if err := rootCmd.ExecuteContext(newRootContext()); err != nil {
 		logger.Fatalf("Error executing command: %v", err)
 	}
 }
 // fetchEnvironmentState gathers and returns the current state of the environment.
-func fetchEnvironmentState() []byte {
-	// Initialize the environment state structure
+// Tool, versions and plugins come from its state.json; the shell variables,
+// host and git revision are read as they are now.
+func fetchEnvironmentState(envPath, envName string) []byte {
+	recorded := loadEnvState(envPath, envName)
 	envState := EnvironmentState{
-		OS:                 runtime.GOOS,
-		Architecture:       runtime.GOARCH,
+		TerraformVersion:   recorded.TerraformVersion,
+		TerragruntVersion:  recorded.TerragruntVersion,
+		OS:                 recorded.OS,
+		Architecture:       recorded.Architecture,
 		EnvironmentVars:    getRelevantEnvVars(),
-		Plugins:            getPlugins(),
+		Plugins:            recorded.Plugins,
 		AdditionalMetadata: getAdditionalMetadata(),
+		Tool:               recorded.Tool,
+		Git:                getGitRevision(filepath.Join(envPath, "config", envName)),
 	}
-
-	// Fetch Terraform version
-	tfVersion, err := getTerraformVersion()
-	if err != nil {
-		fmt.Printf("Error fetching Terraform version: %v\n", err)
+	if envState.TerraformVersion == "" {
 		envState.TerraformVersion = "unknown"
-	} else {
-		envState.TerraformVersion = tfVersion
 	}
-
-	// Fetch Terragrunt version
-	tgVersion, err := getTerragruntVersion()
-	if err != nil {
-		fmt.Printf("Error fetching Terragrunt version: %v\n", err)
+	if envState.TerragruntVersion == "" {
 		envState.TerragruntVersion = "unknown"
-	} else {
-		envState.TerragruntVersion = tgVersion
+		if envTerraformOnly(envPath, envName) {
+			envState.TerragruntVersion = "none"
+		}
 	}
 
 	// Convert the state to JSON format
@@ -166,6 +305,23 @@ func fetchEnvironmentState() []byte {
 	return stateJSON
 }
 
+// currentSnap returns a snap of the environment as it is now, with its
+// selected workspace.
+func currentSnap(envPath, envName string) (snaps.Snap, error) {
+	var snap snaps.Snap
+	if err := json.Unmarshal(fetchEnvironmentState(envPath, envName), &snap); err != nil {
+		return snap, fmt.Errorf("failed to parse snap data: %w", err)
+	}
+
+	// Record the environment's selected workspace with the snap
+	if meta, err := loadEnvMetadata(envPath); err != nil {
+		logger.Warnf("error reading environment metadata: %v", err)
+	} else {
+		snap.Workspace = meta.Workspace
+	}
+	return snap, nil
+}
+
 // getRelevantEnvVars fetches environment variables that are relevant to the environment state.
 func getRelevantEnvVars() map[string]string {
 	relevantVars := []string{"TF_VAR_region", "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "GOOS", "GOARCH"}
@@ -187,6 +343,31 @@ func getAdditionalMetadata() map[string]string {
 	}
 }
 
+// getGitRevision returns the branch, commit and dirty flag of the git checkout
+// holding dir, or nil when dir is not under version control. CI systems check
+// out detached commits, so their branch variables fill in the branch name.
+func getGitRevision(dir string) *snaps.GitRevision {
+	commit, err := gitOutput("-C", dir, "rev-parse", "HEAD")
+	if err != nil {
+		return nil
+	}
+	revision := &snaps.GitRevision{Commit: commit}
+	if branch, err := gitOutput("-C", dir, "rev-parse", "--abbrev-ref", "HEAD"); err == nil && branch != "HEAD" {
+		revision.Branch = branch
+	} else {
+		for _, name := range []string{"GITHUB_HEAD_REF", "GITHUB_REF_NAME", "CI_COMMIT_REF_NAME", "BUILD_SOURCEBRANCHNAME"} {
+			if branch := os.Getenv(name); branch != "" {
+				revision.Branch = branch
+				break
+			}
+		}
+	}
+	if status, err := gitOutput("-C", dir, "status", "--porcelain", "--", "."); err == nil {
+		revision.Dirty = status != ""
+	}
+	return revision
+}
+
 // getHostname returns the system's hostname.
 func getHostname() string {
 	hostname, err := os.Hostname()
@@ -216,63 +397,41 @@ func snapCmd() *cobra.Command {
 	snapCmd.AddCommand(getSnapCmd())
 	snapCmd.AddCommand(updateSnapCmd())
 	snapCmd.AddCommand(removeSnapCmd())
+	snapCmd.AddCommand(pruneSnapCmd())
+	snapCmd.AddCommand(snapVerifyCmd())
 	snapCmd.AddCommand(snapRemoteConfigCmd())
+	snapCmd.AddCommand(snapInitCmd())
 	snapCmd.AddCommand(snapRemoteGetCmd())
 	snapCmd.AddCommand(snapRemoteSaveCmd())
 	snapCmd.AddCommand(snapRemoteListCmd())
 	snapCmd.AddCommand(snapRemoteRemoveCmd())
+	snapCmd.AddCommand(snapRemoteSyncCmd())
 
 	return snapCmd
 }
 
-// getTerraformVersion dynamically fetches the Terraform version installed.
-func getTerraformVersion() (string, error) {
-	out, err := exec.Command("terraform", "-version").Output()
+// getTerraformVersion returns the version of the environment's terraform or
+// tofu binary, never the one on PATH.
+func getTerraformVersion(envPath, envName, tool string) (string, error) {
+	binary, err := envToolBinary(envPath, envName, tool)
 	if err != nil {
 		return "", err
 	}
-	return parseVersion(string(out), "Terraform")
+	return getBinaryVersion(binary, tool)
 }
 
-// getTerragruntVersion dynamically fetches the Terragrunt version installed.
-func getTerragruntVersion() (string, error) {
-	out, err := exec.Command("terragrunt", "-version").Output()
+// getTerragruntVersion returns the version of the environment's Terragrunt binary.
+func getTerragruntVersion(envPath, envName string) (string, error) {
+	binary, err := envToolBinary(envPath, envName, "terragrunt")
 	if err != nil {
 		return "", err
 	}
-	return parseVersion(string(out), "Terragrunt")
+	return getBinaryVersion(binary, "terragrunt")
 }
 
-// parseVersion extracts the version from the output string.
-func parseVersion(output, toolName string) (string, error) {
-	lines := strings.Split(output, "\n")
-	for _, line := range lines {
-		if strings.Contains(line, toolName) {
-			parts := strings.Fields(line)
-			if len(parts) > 1 {
-				return parts[1], nil
-			}
-		}
-	}
-	return "", fmt.Errorf("failed to parse version for %s", toolName)
-}
-
-// getEnvVars retrieves the relevant environment variables.
-func getEnvVars() map[string]string {
-	return map[string]string{
-		"TF_VAR_region": os.Getenv("TF_VAR_region"),
-	}
-}
-
-// getPlugins retrieves the list of plugins and their versions.
-func getPlugins() map[string]string {
-	return map[string]string{
-		"aws":   "3.46.0",
-		"azure": "2.29.0",
-	}
-}
 func saveSnapCmd() *cobra.Command {
-	return &cobra.Command{
+	var full bool
+	cmd := &cobra.Command{
 		Use:   "save <env-name> <filename>",
 		Short: "Save the specified environment to a snap file",
 		Args:  cobra.ExactArgs(2),
@@ -283,23 +442,8 @@ func saveSnapCmd() *cobra.Command {
 			envDir := viper.GetString("env-dir")
 			envPath := filepath.Join(envDir, envName)
 
-			// Fetch the current environment state
-			snapData := fetchEnvironmentState()
-
-			// Convert snapData to the required snap object
-			var snap snaps.Snap
-			err := json.Unmarshal(snapData, &snap)
-			if err != nil {
-				logger.Errorf("error parsing snap data: %v", err)
-				fmt.Printf("Error parsing snap data: %v\n", err)
-				os.Exit(1)
-			}
-
-			// Pass envPath and filename to GetSnapFilePath
-			filePath := snaps.GetSnapFilePath(envPath, filename)
-
-			// Save the snap using the SaveSnap function
-			err = snaps.SaveSnap(filePath, &snap)
+			warnPathBinaries(envPath, envName, loadEnvState(envPath, envName))
+			filePath, err := saveEnvironmentSnap(envPath, filename, full)
 			if err != nil {
 				logger.Errorf("error saving snap: %v", err)
 				fmt.Printf("Error saving snap: %v\n", err)
@@ -308,11 +452,41 @@ func saveSnapCmd() *cobra.Command {
 
 			fmt.Printf("Snap saved successfully to %s\n", filePath)
 			logger.Infof("Snap saved successfully to %s", filePath)
+			emitEvent(envPath, eventSnapSaved, map[string]string{"snap": filename, "location": filePath})
 		},
 	}
+
+	cmd.Flags().BoolVar(&full, "full", false, "Also capture the environment's scripts directory")
+	return cmd
+}
+
+// saveEnvironmentSnap captures the environment state into the named snap and returns its path.
+// A full snap also embeds the scripts directory.
+func saveEnvironmentSnap(envPath, filename string, full bool) (string, error) {
+	// Fetch the current environment state
+	snap, err := currentSnap(envPath, filepath.Base(envPath))
+	if err != nil {
+		return "", err
+	}
+
+	if full {
+		scripts, err := captureScripts(envPath)
+		if err != nil {
+			return "", err
+		}
+		snap.Scripts = scripts
+	}
+
+	filePath := snaps.GetSnapFilePath(envPath, filename)
+	if err := snaps.SaveSnap(filePath, &snap); err != nil {
+		return "", err
+	}
+	summary.fileWritten(filePath)
+	return filePath, nil
 }
 func getSnapCmd() *cobra.Command {
-	return &cobra.Command{
+	var restoreScriptsFlag bool
+	cmd := &cobra.Command{
 		Use:   "get <env-name> <snap-name>",
 		Short: "Get a snap from the specified environment's local storage",
 		Args:  cobra.ExactArgs(2),
@@ -339,11 +513,32 @@ func getSnapCmd() *cobra.Command {
 				return
 			}
 
-			// Use the retrieved snap (e.g., print it)
+			// Use the retrieved snap (e.g., print it), listing scripts by name
+			scripts := snap.Scripts
+			snap.Scripts = nil
 			fmt.Printf("Snap '%s' retrieved successfully: %+v\n", snapName, snap)
+			for _, script := range scripts {
+				fmt.Printf("  script: %s (%s)\n", script.Name, formatSize(int64(len(script.Content))))
+			}
 			logger.Infof("Snap '%s' retrieved successfully.", snapName)
+
+			if restoreScriptsFlag {
+				if len(scripts) == 0 {
+					fmt.Printf("Snap '%s' holds no scripts; save it with 'tfvenv snap save --full' to capture them.\n", snapName)
+					return
+				}
+				if err := restoreScripts(envPath, scripts); err != nil {
+					logger.Errorf("error restoring scripts: %v", err)
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+				fmt.Printf("Restored %d script(s) to %s\n", len(scripts), envScriptsDir(envPath))
+			}
 		},
 	}
+
+	cmd.Flags().BoolVar(&restoreScriptsFlag, "restore-scripts", false, "Write the scripts of a full snap into the environment's scripts directory")
+	return cmd
 }
 
 func updateSnapCmd() *cobra.Command {
@@ -360,26 +555,20 @@ func updateSnapCmd() *cobra.Command {
 
 			filePath := snaps.GetSnapFilePath(envPath, snapName)
 
-			terraformVersion, err := getTerraformVersion()
+			warnPathBinaries(envPath, envName, loadEnvState(envPath, envName))
+			updatedSnap, err := currentSnap(envPath, envName)
 			if err != nil {
-				fmt.Printf("Error getting Terraform version: %v\n", err)
-				logger.Errorf("error getting Terraform version: %v", err)
+				fmt.Printf("Error reading environment state: %v\n", err)
+				logger.Errorf("error reading environment state: %v", err)
 				return
 			}
-			terragruntVersion, err := getTerragruntVersion()
-			if err != nil {
-				fmt.Printf("Error getting Terragrunt version: %v\n", err)
-				logger.Errorf("error getting Terragrunt version: %v", err)
-				return
-			}
-			plugins := getPlugins()
-			envVars := getEnvVars()
-
-			updatedSnap := snaps.Snap{
-				TerraformVersion:  terraformVersion,
-				TerragruntVersion: terragruntVersion,
-				Plugins:           plugins,
-				EnvVars:           envVars,
+			// A full snap stays full, with the current scripts
+			if existing, err := snaps.GetSnap(filePath); err == nil && len(existing.Scripts) > 0 {
+				if updatedSnap.Scripts, err = captureScripts(envPath); err != nil {
+					fmt.Printf("Error capturing scripts: %v\n", err)
+					logger.Errorf("error capturing scripts: %v", err)
+					return
+				}
 			}
 
 			err = snaps.UpdateSnap(filePath, &updatedSnap)
@@ -417,6 +606,59 @@ func removeSnapCmd() *cobra.Command {
 		},
 	}
 }
+// pruneSnapCmd removes old local snaps according to a retention policy.
+func pruneSnapCmd() *cobra.Command {
+	var keep int
+	var olderThan time.Duration
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "prune <env-name>",
+		Short: "Remove old local snaps, keeping the newest --keep and anything newer than --older-than",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envDir := viper.GetString("env-dir")
+			envPath := filepath.Join(envDir, envName)
+
+			if keep <= 0 && olderThan <= 0 {
+				fmt.Println("Error: specify --keep, --older-than or both.")
+				os.Exit(1)
+			}
+
+			files, err := snaps.ListSnapFiles(envPath)
+			if err != nil {
+				fmt.Printf("Error listing snaps: %v\n", err)
+				logger.Errorf("error listing snaps: %v", err)
+				os.Exit(1)
+			}
+
+			prune := snaps.PruneCandidates(files, keep, olderThan, time.Now())
+			if len(prune) == 0 {
+				fmt.Println("No snaps to prune.")
+				return
+			}
+			for _, file := range prune {
+				if dryRun {
+					printDryRun("would remove snap %s (%s, %s)", file.Path, formatSize(file.Size), file.ModTime.Format(time.RFC3339))
+					continue
+				}
+				if err := snaps.RemoveSnap(file.Path); err != nil {
+					fmt.Printf("Error removing snap: %v\n", err)
+					logger.Errorf("error removing snap: %v", err)
+					os.Exit(1)
+				}
+				fmt.Printf("Removed snap '%s'.\n", file.Name)
+				logger.Infof("Pruned snap '%s' from '%s'.", file.Name, file.Path)
+			}
+		},
+	}
+
+	cmd.Flags().IntVar(&keep, "keep", 0, "Number of newest snaps to keep")
+	cmd.Flags().DurationVar(&olderThan, "older-than", 0, "Only remove snaps older than this (e.g. 720h)")
+	addDryRunFlag(cmd, &dryRun)
+	return cmd
+}
 func snapRemoteConfigCmd() *cobra.Command {
 	return &cobra.Command{
 		Use:   "config",
@@ -444,7 +686,7 @@ func snapRemoteConfigCmd() *cobra.Command {
 	}
 }
 func snapRemoteGetCmd() *cobra.Command {
-    return &cobra.Command{
+    cmd := &cobra.Command{
         Use:   "get <env-name> <snap-name>",
         Short: "Get a snap from the specified environment's remote S3 storage",
         Args:  cobra.ExactArgs(2),
@@ -454,7 +696,6 @@ func snapRemoteGetCmd() *cobra.Command {
 
             envDir := viper.GetString("env-dir")
             envPath := filepath.Join(envDir, envName)
-            filePath := snaps.GetSnapFilePath(envPath, snapName)
 
             auth := os.Getenv("REMOTE_SNAP_AUTH")
             if auth == "" {
@@ -463,27 +704,25 @@ func snapRemoteGetCmd() *cobra.Command {
                 os.Exit(1)
             }
 
-            accessKey := os.Getenv("AWS_ACCESS_KEY")
-            secretKey := os.Getenv("AWS_SECRET_KEY")
-            region := os.Getenv("AWS_REGION")
-
-            if accessKey == "" || secretKey == "" || region == "" {
-                logger.Error("AWS_ACCESS_KEY, AWS_SECRET_KEY, and AWS_REGION must be set")
-                fmt.Println("Error: AWS_ACCESS_KEY, AWS_SECRET_KEY, and AWS_REGION must be set.")
+            accessKey, secretKey, region, profile, err := remoteSnapAWS(envPath, envName)
+            if err != nil {
+                logger.Errorf("error resolving AWS settings: %v", err)
+                i18n.Println("error", err)
                 os.Exit(1)
             }
 
             ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
             defer cancel()
 
-            sanitizedSnapName, err := snaps.SanitizeSnapName(snapName)
+            sanitizedSnapName, localName, err := remoteSnapTarget(snapName)
             if err != nil {
                 logger.Errorf("invalid snap name '%s': %v", snapName, err)
-                fmt.Printf("Error: %v\n", err)
+                i18n.Println("error", err)
                 os.Exit(1)
             }
+            filePath := snaps.GetSnapFilePath(envPath, localName)
 
-            encryptedSnap, err := snaps.GetRemoteSnap(ctx, sanitizedSnapName, accessKey, secretKey, region)
+            encryptedSnap, err := snaps.GetRemoteSnap(ctx, sanitizedSnapName, accessKey, secretKey, region, profile)
             if err != nil {
                 logger.Errorf("error retrieving snap '%s': %v", sanitizedSnapName, err)
                 fmt.Printf("Error retrieving snap: %v\n", err)
@@ -498,7 +737,7 @@ func snapRemoteGetCmd() *cobra.Command {
             }
 
             // Use filePath to save the decrypted snap
-            err = os.WriteFile(filePath, snapData, 0644)
+            err = writeSecretFile(filePath, snapData)
             if err != nil {
                 logger.Errorf("error saving snap file '%s': %v", filePath, err)
                 fmt.Printf("Error saving snap file: %v\n", err)
@@ -509,10 +748,12 @@ func snapRemoteGetCmd() *cobra.Command {
             logger.Infof("Snap '%s' retrieved and saved to '%s'.", sanitizedSnapName, filePath)
         },
     }
+    addRemoteSnapProfileFlag(cmd)
+    return cmd
 }
 
 func snapRemoteSaveCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "save <env-name> <snap-name>",
 		Short: "Save a snap to the specified environment's remote S3 storage",
 		Args:  cobra.ExactArgs(2),
@@ -522,7 +763,6 @@ func snapRemoteSaveCmd() *cobra.Command {
 
 			envDir := viper.GetString("env-dir")
 			envPath := filepath.Join(envDir, envName)
-			filePath := snaps.GetSnapFilePath(envPath, snapName)
 
 			auth := os.Getenv("REMOTE_SNAP_AUTH")
 			if auth == "" {
@@ -531,13 +771,10 @@ func snapRemoteSaveCmd() *cobra.Command {
 				return
 			}
 
-			accessKey := os.Getenv("AWS_ACCESS_KEY")
-			secretKey := os.Getenv("AWS_SECRET_KEY")
-			region := os.Getenv("AWS_REGION")
-
-			if accessKey == "" || secretKey == "" || region == "" {
-				fmt.Println("AWS_ACCESS_KEY, AWS_SECRET_KEY, and AWS_REGION must be set.")
-				logger.Warn("AWS_ACCESS_KEY, AWS_SECRET_KEY, or AWS_REGION not set")
+			accessKey, secretKey, region, profile, err := remoteSnapAWS(envPath, envName)
+			if err != nil {
+				i18n.Println("error", err)
+				logger.Warnf("error resolving AWS settings: %v", err)
 				return
 			}
 
@@ -560,20 +797,41 @@ func snapRemoteSaveCmd() *cobra.Command {
 			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 			defer cancel()
 
-			err = snaps.SaveRemoteSnap(ctx, snapName, []byte(encryptedSnap), accessKey, secretKey, region)
+			key, err := remoteSnapKey(envPath, envName, snapName, time.Now())
+			if err != nil {
+				i18n.Println("error", err)
+				logger.Errorf("error building snap key: %v", err)
+				return
+			}
+
+			err = snaps.SaveRemoteSnap(ctx, key, []byte(encryptedSnap), accessKey, secretKey, region, profile)
 			if err != nil {
 				fmt.Printf("Error uploading snap: %v\n", err)
 				logger.Errorf("error uploading snap: %v", err)
 				return
 			}
 
-			fmt.Printf("Snap '%s' encrypted and uploaded successfully to S3.\n", snapName)
-			logger.Infof("Snap '%s' encrypted and uploaded successfully to S3 at %s.", snapName, filePath)
+			fmt.Printf("Snap '%s' encrypted and uploaded successfully to S3 as '%s'.\n", snapName, key)
+			emitEvent(envPath, eventSnapSaved, map[string]string{"snap": snapName, "location": "s3", "key": key})
+			logger.Infof("Snap '%s' encrypted and uploaded successfully to S3 at %s.", snapName, key)
+
+			if replica := remoteSnapReplica(envPath, envName, accessKey, secretKey, region, profile); replica != nil {
+				if err := snaps.SaveReplicaSnap(ctx, *replica, key, []byte(encryptedSnap)); err != nil {
+					fmt.Printf("Error mirroring snap to replica bucket %s: %v\nRun 'tfvenv snap sync %s' to retry.\n", replica.Bucket, err, envName)
+					logger.Errorf("error mirroring snap %s to replica: %v", key, err)
+					os.Exit(1)
+				}
+				fmt.Printf("Snap '%s' mirrored to replica bucket %s.\n", snapName, replica.Bucket)
+				emitEvent(envPath, eventSnapSaved, map[string]string{"snap": snapName, "location": "s3-replica", "key": key})
+				logger.Infof("Snap '%s' mirrored to replica bucket %s at %s.", snapName, replica.Bucket, key)
+			}
 		},
 	}
+	addRemoteSnapProfileFlag(cmd)
+	return cmd
 }
 func snapRemoteListCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "list <env-name>",
 		Short: "List all snaps from the specified environment's remote S3 storage",
 		Args:  cobra.ExactArgs(1),
@@ -582,20 +840,24 @@ func snapRemoteListCmd() *cobra.Command {
 			envDir := viper.GetString("env-dir")
 			envPath := filepath.Join(envDir, envName)
 
-			accessKey := os.Getenv("AWS_ACCESS_KEY")
-			secretKey := os.Getenv("AWS_SECRET_KEY")
-			region := os.Getenv("AWS_REGION")
+			accessKey, secretKey, region, profile, err := remoteSnapAWS(envPath, envName)
+			if err != nil {
+				i18n.Println("error", err)
+				logger.Warnf("error resolving AWS settings: %v", err)
+				return
+			}
 
-			if accessKey == "" || secretKey == "" || region == "" {
-				fmt.Println("AWS_ACCESS_KEY, AWS_SECRET_KEY, and AWS_REGION must be set.")
-				logger.Warn("AWS_ACCESS_KEY, AWS_SECRET_KEY, or AWS_REGION not set")
+			prefix, err := remoteSnapPrefix(envPath, envName)
+			if err != nil {
+				i18n.Println("error", err)
+				logger.Warnf("error building snap key prefix: %v", err)
 				return
 			}
 
 			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 			defer cancel()
 
-			snapsList, err := snaps.ListRemoteSnaps(ctx, accessKey, secretKey, region)
+			snapsList, err := snaps.ListRemoteSnaps(ctx, prefix, accessKey, secretKey, region, profile)
 			if err != nil {
 				fmt.Printf("Error listing snaps: %v\n", err)
 				logger.Errorf("error listing snaps: %v", err)
@@ -607,16 +869,22 @@ func snapRemoteListCmd() *cobra.Command {
 				return
 			}
 
-			fmt.Println("Snaps found in the remote S3 bucket:")
+			if prefix != "" {
+				fmt.Printf("Snaps found in the remote S3 bucket under '%s':\n", prefix)
+			} else {
+				fmt.Println("Snaps found in the remote S3 bucket:")
+			}
 			for _, snap := range snapsList {
 				fmt.Println(" -", snap)
 			}
 			logger.Infof("Listed %d snaps from remote S3 at %s.", len(snapsList), envPath)
 		},
 	}
+	addRemoteSnapProfileFlag(cmd)
+	return cmd
 }
 func snapRemoteRemoveCmd() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "remove <env-name> <snap-name>",
 		Short: "Remove a snap from the specified environment's remote S3 storage",
 		Args:  cobra.ExactArgs(2),
@@ -627,20 +895,24 @@ func snapRemoteRemoveCmd() *cobra.Command {
 			envDir := viper.GetString("env-dir")
 			envPath := filepath.Join(envDir, envName)
 
-			accessKey := os.Getenv("AWS_ACCESS_KEY")
-			secretKey := os.Getenv("AWS_SECRET_KEY")
-			region := os.Getenv("AWS_REGION")
+			accessKey, secretKey, region, profile, err := remoteSnapAWS(envPath, envName)
+			if err != nil {
+				i18n.Println("error", err)
+				logger.Warnf("error resolving AWS settings: %v", err)
+				return
+			}
 
-			if accessKey == "" || secretKey == "" || region == "" {
-				fmt.Println("AWS_ACCESS_KEY, AWS_SECRET_KEY, and AWS_REGION must be set.")
-				logger.Warn("AWS_ACCESS_KEY, AWS_SECRET_KEY, or AWS_REGION not set")
+			snapName, _, err = remoteSnapTarget(snapName)
+			if err != nil {
+				i18n.Println("error", err)
+				logger.Warnf("invalid snap name '%s': %v", args[1], err)
 				return
 			}
 
 			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 			defer cancel()
 
-			err := snaps.RemoveRemoteSnap(ctx, snapName, accessKey, secretKey, region)
+			err = snaps.RemoveRemoteSnap(ctx, snapName, accessKey, secretKey, region, profile)
 			if err != nil {
 				fmt.Printf("Error removing snap: %v\n", err)
 				logger.Errorf("error removing snap: %v", err)
@@ -651,8 +923,135 @@ func snapRemoteRemoveCmd() *cobra.Command {
 			logger.Infof("Snap '%s' removed successfully from remote S3 storage at %s.", snapName, envPath)
 		},
 	}
+	addRemoteSnapProfileFlag(cmd)
+	return cmd
+}
+// snapRemoteSyncCmd uploads the environment's local snaps that are missing from remote storage.
+func snapRemoteSyncCmd() *cobra.Command {
+	var parallel int
+
+	cmd := &cobra.Command{
+		Use:   "sync <env-name>",
+		Short: "Upload the environment's local snaps that are missing from remote S3 storage",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envDir := viper.GetString("env-dir")
+			envPath := filepath.Join(envDir, envName)
+
+			auth := os.Getenv("REMOTE_SNAP_AUTH")
+			if auth == "" {
+				fmt.Println("REMOTE_SNAP_AUTH must be set.")
+				logger.Warn("REMOTE_SNAP_AUTH not set")
+				return
+			}
+
+			accessKey, secretKey, region, profile, err := remoteSnapAWS(envPath, envName)
+			if err != nil {
+				i18n.Println("error", err)
+				logger.Warnf("error resolving AWS settings: %v", err)
+				return
+			}
+
+			localSnaps, err := filepath.Glob(filepath.Join(envPath, "snaps", "*.snap"))
+			if err != nil {
+				fmt.Printf("Error listing local snaps: %v\n", err)
+				logger.Errorf("error listing local snaps: %v", err)
+				return
+			}
+
+			prefix, err := remoteSnapPrefix(envPath, envName)
+			if err != nil {
+				i18n.Println("error", err)
+				logger.Warnf("error building snap key prefix: %v", err)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			remoteList, err := snaps.ListRemoteSnaps(ctx, prefix, accessKey, secretKey, region, profile)
+			cancel()
+			if err != nil {
+				fmt.Printf("Error listing snaps: %v\n", err)
+				logger.Errorf("error listing snaps: %v", err)
+				return
+			}
+			remote := make(map[string]bool, len(remoteList))
+			for _, name := range remoteList {
+				remote[name] = true
+			}
+
+			// Keys are rendered with the time each snap was taken, so a snap
+			// already uploaded under the same template is recognised
+			var jobs []job
+			for _, snapPath := range localSnaps {
+				snapName := strings.TrimSuffix(filepath.Base(snapPath), ".snap")
+				info, err := os.Stat(snapPath)
+				if err != nil {
+					continue
+				}
+				key, err := remoteSnapKey(envPath, envName, snapName, info.ModTime())
+				if err != nil {
+					i18n.Println("error", err)
+					logger.Errorf("error building snap key: %v", err)
+					os.Exit(1)
+				}
+				if remote[key] {
+					continue
+				}
+				remoteList = append(remoteList, key)
+				snapPath := snapPath
+				jobs = append(jobs, job{
+					Name: snapName,
+					Run: func() error {
+						snapData, err := os.ReadFile(snapPath)
+						if err != nil {
+							return fmt.Errorf("error reading snap: %w", err)
+						}
+						encryptedSnap, err := snaps.Encrypt(snapData)
+						if err != nil {
+							return fmt.Errorf("error encrypting snap: %w", err)
+						}
+						ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+						defer cancel()
+						if err := snaps.SaveRemoteSnap(ctx, key, []byte(encryptedSnap), accessKey, secretKey, region, profile); err != nil {
+							return err
+						}
+						emitEvent(envPath, eventSnapSaved, map[string]string{"snap": snapName, "location": "s3", "key": key})
+						return nil
+					},
+				})
+			}
+			if len(jobs) == 0 {
+				fmt.Println("Remote storage already has every local snap.")
+			} else {
+				results := runJobs(jobs, parallel)
+				if err := jobsError(results); err != nil {
+					i18n.Println("error", err)
+					logger.Errorf("snap sync failed: %v", err)
+					os.Exit(1)
+				}
+				fmt.Printf("Uploaded %d snap(s) to remote S3 storage.\n", len(jobs))
+				logger.Infof("Synced %d snaps from %s to remote S3 storage.", len(jobs), envPath)
+			}
+
+			if replica := remoteSnapReplica(envPath, envName, accessKey, secretKey, region, profile); replica != nil {
+				if err := syncSnapReplica(envPath, prefix, remoteList, *replica, accessKey, secretKey, region, profile, parallel); err != nil {
+					i18n.Println("error", err)
+					logger.Errorf("snap replica sync failed: %v", err)
+					os.Exit(1)
+				}
+			}
+		},
+	}
+
+	addParallelFlag(cmd, &parallel)
+	addRemoteSnapProfileFlag(cmd)
+	return cmd
 }
 func cleanupCmd() *cobra.Command {
+	var dryRun, dedupe bool
+	var parallel int
+
 	cmd := &cobra.Command{
 		Use:   "cleanup <env-name>",
 		Short: "Clean up duplicate or unused provider plugins from the specified environment's plugin cache",
@@ -662,15 +1061,16 @@ func cleanupCmd() *cobra.Command {
 			envDir := viper.GetString("env-dir")
 			envPath := filepath.Join(envDir, envName)
 
-			pluginCacheDir := filepath.Join(os.Getenv("HOME"), ".tfvenv", "plugin-cache")
-			if !fileExists(pluginCacheDir) {
+			pluginCacheDir := defaultPluginCacheDir()
+			if _, err := os.Stat(pluginCacheDir); os.IsNotExist(err) {
 				fmt.Printf("Plugin cache directory %s does not exist.\n", pluginCacheDir)
 				logger.Warnf("plugin cache directory %s does not exist", pluginCacheDir)
 				return
 			}
 
 			// Remove duplicates
-			err := cleanDuplicateProviders(pluginCacheDir)
+			removed, err := cleanDuplicateProviders(pluginCacheDir, dryRun)
+			printProviderCleanup("duplicate", removed, dryRun)
 			if err != nil {
 				logger.Errorf("error cleaning duplicate providers: %v", err)
 				fmt.Printf("Error cleaning duplicate providers: %v\n", err)
@@ -678,50 +1078,92 @@ func cleanupCmd() *cobra.Command {
 			}
 
 			// Remove unused providers
-			err = cleanUnusedProviders(pluginCacheDir, envPath)
+			used, err := usedProviders(parallel, envPath)
+			if err == nil {
+				removed, err = cleanUnusedProviders(pluginCacheDir, used, dryRun)
+				printProviderCleanup("unused", removed, dryRun)
+			}
 			if err != nil {
 				logger.Errorf("error cleaning unused providers: %v", err)
 				fmt.Printf("Error cleaning unused providers: %v\n", err)
 			}
 
+			// Replace identical provider binaries with hard links
+			if dedupe {
+				deduped, err := dedupeProviders(pluginCacheDir, dryRun)
+				if err != nil {
+					logger.Errorf("error deduplicating providers: %v", err)
+					fmt.Printf("Error deduplicating providers: %v\n", err)
+					os.Exit(1)
+				}
+				printDedupe(deduped, dryRun)
+			}
+
+			if dryRun {
+				fmt.Println("Dry run complete; nothing was removed.")
+				return
+			}
 			fmt.Println("Cleanup completed successfully.")
 			logger.Infof("Cleanup completed successfully for environment '%s' at %s.", envName, envPath)
 		},
 	}
 
+	addDryRunFlag(cmd, &dryRun)
+	cmd.Flags().BoolVar(&dedupe, "dedupe", false, "Also replace byte-identical provider binaries in the cache with hard links")
+	addParallelFlag(cmd, &parallel)
+	cmd.Flags().Lookup("parallel").Usage = "Maximum number of providers to look up in the registry at once"
 	return cmd
 }
 
-// cleanUnusedProviders scans the plugin cache and removes providers not used by any existing environment
-func cleanUnusedProviders(pluginCacheDir string, baseEnvDir string) error {
-	logger.Infof("Cleaning unused providers from plugin cache at %s", pluginCacheDir)
-
-	// List all existing environments
-	envs, err := getEnvironments(baseEnvDir)
-	if err != nil {
-		return fmt.Errorf("failed to list environments: %w", err)
+// printProviderCleanup reports the provider plugins a cleanup removed, or would remove.
+func printProviderCleanup(kind string, paths []string, dryRun bool) {
+	for _, path := range paths {
+		if dryRun {
+			printDryRun("would remove %s provider plugin %s", kind, path)
+		} else {
+			fmt.Printf("Removed %s provider plugin: %s\n", kind, path)
+		}
 	}
+}
 
-	if len(envs) == 0 {
-		logger.Warn("No environments found. Skipping cleanup.")
-		return nil
+// usedProviders collects the providers (name and version) used by the
+// configurations of the given environments, resolving up to parallel
+// providers at once.
+func usedProviders(parallel int, envPaths ...string) (map[string]bool, error) {
+	used := make(map[string]bool)
+	for _, baseEnvDir := range envPaths {
+		envs, err := getEnvironments(baseEnvDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list environments: %w", err)
+		}
+		envUsed, err := collectUsedProviders(envs, baseEnvDir, parallel)
+		if err != nil {
+			return nil, fmt.Errorf("failed to collect used providers: %w", err)
+		}
+		for key := range envUsed {
+			used[key] = true
+		}
 	}
+	return used, nil
+}
 
-	// Collect all used providers (source and version)
-	usedProviders, err := collectUsedProviders(envs, baseEnvDir)
-	if err != nil {
-		return fmt.Errorf("failed to collect used providers: %w", err)
-	}
+// cleanUnusedProviders scans the plugin cache and removes providers missing from
+// usedProviders. It returns the removed paths; with dryRun nothing is removed.
+func cleanUnusedProviders(pluginCacheDir string, usedProviders map[string]bool, dryRun bool) ([]string, error) {
+	logger.Infof("Cleaning unused providers from plugin cache at %s", pluginCacheDir)
 
 	if len(usedProviders) == 0 {
 		logger.Warn("No providers found in any environment. Skipping cleanup.")
-		return nil
+		return nil, nil
 	}
 
 	logger.Infof("Total used providers found: %d", len(usedProviders))
 
 	// Iterate through the plugin cache and remove unused providers
-	err = filepath.Walk(pluginCacheDir, func(path string, info os.FileInfo, err error) error {
+	var removed []string
+	gc := newCacheGC(pluginCacheDir)
+	defer gc.release()
+	err := filepath.Walk(pluginCacheDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -758,13 +1200,20 @@ func cleanUnusedProviders(pluginCacheDir string, baseEnvDir string) error {
 			// Check if this provider and version is in the usedProviders map
 			key := fmt.Sprintf("%s_%s", providerName, providerVersion)
 			if !usedProviders[key] {
+				if dryRun {
+					removed = append(removed, path)
+					return nil
+				}
+				if !gc.acquire(path) {
+					return nil
+				}
 				// Remove the unused provider plugin
 				logger.Infof("Removing unused provider plugin: %s", path)
 				err := os.Remove(path)
 				if err != nil {
 					logger.Warnf("Failed to remove %s: %v", path, err)
 				} else {
-					fmt.Printf("Removed unused provider plugin: %s\n", path)
+					removed = append(removed, path)
 				}
 			}
 		}
@@ -773,17 +1222,19 @@ func cleanUnusedProviders(pluginCacheDir string, baseEnvDir string) error {
 	})
 
 	if err != nil {
-		return fmt.Errorf("error cleaning plugin cache: %w", err)
+		return removed, fmt.Errorf("error cleaning plugin cache: %w", err)
 	}
 
 	logger.Info("Cleanup of unused providers completed successfully.")
-	return nil
+	return removed, nil
 }
 
-// collectUsedProviders parses Terraform configuration files in all environments to collect used providers
-func collectUsedProviders(envs []string, baseEnvDir string) (map[string]bool, error) {
+// collectUsedProviders parses Terraform configuration files in all environments to collect used providers.
+// The constraints are resolved against the registry afterwards, parallel providers at a time.
+func collectUsedProviders(envs []string, baseEnvDir string, parallel int) (map[string]bool, error) {
 	usedProviders := make(map[string]bool)
 	parser := hclparse.NewParser()
+	var requirements []providerRequirement
 
 	for _, env := range envs {
 		envConfigDir := filepath.Join(baseEnvDir, env, "config", env)
@@ -884,60 +1335,36 @@ func collectUsedProviders(envs []string, baseEnvDir string) (map[string]bool, er
 						}
 						versionStr := versionVal.AsString()
 
-						// Resolve the exact version using version constraints
-						exactVersion, err := resolveProviderVersion(sourceStr, versionStr)
-						if err != nil {
-							logger.Warnf("Failed to resolve version for provider %s: %v", providerName, err)
-							continue
-						}
-
-						// Add to usedProviders map
-						key := fmt.Sprintf("%s_%s", extractProviderShortName(sourceStr), exactVersion)
-						usedProviders[key] = true
-						logger.Debugf("Environment '%s' uses provider '%s' version '%s'", env, extractProviderShortName(sourceStr), exactVersion)
+						requirements = append(requirements, providerRequirement{Env: env, Source: sourceStr, Constraint: versionStr})
 					}
 				}
 			}
 		}
 	}
 
+	// Resolve the exact versions using version constraints
+	resolved := newProviderResolver().resolveAll(requirements, parallel)
+	for _, req := range requirements {
+		exactVersion, ok := resolved[req.key()]
+		if !ok {
+			continue
+		}
+		key := fmt.Sprintf("%s_%s", extractProviderShortName(req.Source), exactVersion)
+		usedProviders[key] = true
+		logger.Debugf("Environment '%s' uses provider '%s' version '%s'", req.Env, extractProviderShortName(req.Source), exactVersion)
+	}
+
 	return usedProviders, nil
 }
 
 // extractProviderShortName extracts the provider name from the source string
 // For example, "hashicorp/aws" -> "aws"
 func extractProviderShortName(source string) string {
-	parts := strings.Split(source, "/")
-	if len(parts) != 2 {
-		return source // Fallback to the whole source if unexpected format
-	}
-	return parts[1]
-}
-
-// resolveProviderVersion resolves the exact provider version based on the version constraint
-// This is a simplified resolver that assumes the latest version satisfying the constraint is used
-func resolveProviderVersion(source, constraint string) (string, error) {
-	// Fetch available versions for the provider
-	availableVersions, err := getProviderAvailableVersions(source)
-	if err != nil {
-		return "", fmt.Errorf("failed to fetch available versions for provider %s: %w", source, err)
-	}
-
-	// Parse the constraint
-	vConstraint, err := version.NewConstraint(constraint)
-	if err != nil {
-		return "", fmt.Errorf("invalid version constraint '%s' for provider %s: %w", constraint, source, err)
-	}
-
-	// Find the latest version that satisfies the constraint
-	sort.Sort(sort.Reverse(version.Collection(availableVersions)))
-	for _, v := range availableVersions {
-		if vConstraint.Check(v) {
-			return v.Original(), nil
-		}
+	parts := strings.Split(source, "/")
+	if len(parts) != 2 {
+		return source // Fallback to the whole source if unexpected format
 	}
-
-	return "", fmt.Errorf("no versions found for provider %s matching constraint '%s'", source, constraint)
+	return parts[1]
 }
 
 // getProviderAvailableVersions fetches all available versions for a given provider source
@@ -962,7 +1389,7 @@ func getProviderAvailableVersions(source string) ([]*version.Version, error) {
 	apiURL := fmt.Sprintf("https://registry.terraform.io/v1/providers/%s/%s/versions", publisher, provider)
 
 	// Fetch the provider versions from the API
-	resp, err := http.Get(apiURL)
+	resp, err := httpClient.Get(apiURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch provider versions from %s: %w", apiURL, err)
 	}
@@ -999,12 +1426,16 @@ func getProviderAvailableVersions(source string) ([]*version.Version, error) {
 	return versions, nil
 }
 
-// cleanDuplicateProviders removes duplicate provider versions from the plugin cache
-func cleanDuplicateProviders(pluginCacheDir string) error {
+// cleanDuplicateProviders removes duplicate provider versions from the plugin cache.
+// It returns the removed paths; with dryRun nothing is removed.
+func cleanDuplicateProviders(pluginCacheDir string, dryRun bool) ([]string, error) {
 	logger.Infof("Cleaning duplicate providers in plugin cache at %s", pluginCacheDir)
 
 	// Map to track unique providers
 	uniqueProviders := make(map[string]bool)
+	var removed []string
+	gc := newCacheGC(pluginCacheDir)
+	defer gc.release()
 
 	err := filepath.Walk(pluginCacheDir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -1027,13 +1458,20 @@ func cleanDuplicateProviders(pluginCacheDir string) error {
 
 			key := fmt.Sprintf("%s_%s", provider, version)
 			if uniqueProviders[key] {
+				if dryRun {
+					removed = append(removed, path)
+					return nil
+				}
+				if !gc.acquire(path) {
+					return nil
+				}
 				// Duplicate found, remove the file
 				logger.Infof("Removing duplicate provider plugin: %s", path)
 				err := os.Remove(path)
 				if err != nil {
 					logger.Warnf("Failed to remove %s: %v", path, err)
 				} else {
-					fmt.Printf("Removed duplicate provider plugin: %s\n", path)
+					removed = append(removed, path)
 				}
 			} else {
 				uniqueProviders[key] = true
@@ -1043,10 +1481,10 @@ func cleanDuplicateProviders(pluginCacheDir string) error {
 	})
 
 	if err != nil {
-		return fmt.Errorf("error cleaning duplicate providers: %w", err)
+		return removed, fmt.Errorf("error cleaning duplicate providers: %w", err)
 	}
 
-	return nil
+	return removed, nil
 }
 
 // initializeLogger sets up the logger with Logrus and ensures sensitive data is not logged
@@ -1123,42 +1561,92 @@ func isSensitiveKey(key string) bool {
     return false
 }
 
-// downloadFile downloads a file from a URL and saves it to the specified destination path
-func downloadFile(url, dest string) error {
+// downloadFile downloads a file from a URL and saves it to the specified destination path.
+// The download is streamed to disk through a fixed-size buffer and hashed on
+// the way, so neither memory use nor a second read grows with its size. It
+// returns the sha256 digest and size of what it wrote.
+func downloadFile(url, dest string) (string, int64, error) {
 	logger.Infof("Downloading from %s", url)
-	resp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(rootCtx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to initiate download: %w", err)
+	}
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to initiate download: %w", err)
+		return "", 0, fmt.Errorf("failed to initiate download: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to download file: status code %d", resp.StatusCode)
+		return "", 0, &downloadStatusError{Code: resp.StatusCode}
 	}
 
 	out, err := os.Create(dest)
 	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
+		return "", 0, fmt.Errorf("failed to create file: %w", err)
 	}
 	defer out.Close()
 
-	_, err = io.Copy(out, resp.Body)
+	// Never leave a truncated download behind
+	removeCleanup := onInterrupt(func() { os.Remove(dest) })
+	defer removeCleanup()
+
+	buffered := bufio.NewWriterSize(out, streamBufferSize)
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(buffered, h), resp.Body)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err == nil {
+		err = out.Close()
+	}
 	if err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+		out.Close()
+		os.Remove(dest)
+		return "", n, fmt.Errorf("failed to write file: %w", err)
 	}
+	summary.downloaded(n)
 
-	return nil
+	return hex.EncodeToString(h.Sum(nil)), n, nil
 }
 
 // getLatestVersion fetches the latest version for the specified tool
 // tool: "terraform" or "terragrunt"
 // includePreReleases: applicable only for Terragrunt
+// Stable versions are cached and reused for TFVENV_LATEST_TTL, and the cached
+// version is used when the lookup fails.
 func getLatestVersion(tool string, includePreReleases bool) (string, error) {
+	if !includePreReleases {
+		if cached, ok := freshLatestVersion(strings.ToLower(tool)); ok {
+			return cached, nil
+		}
+	}
+	latest, err := fetchLatestVersion(tool, includePreReleases)
+	if includePreReleases {
+		return latest, err
+	}
+	if err != nil {
+		if entry, ok := cachedLatestVersion(strings.ToLower(tool)); ok {
+			logger.Warnf("%v; using cached %s %s from %s", err, tool, entry.Version, entry.FetchedAt.Format(time.RFC3339))
+			return entry.Version, nil
+		}
+		return "", err
+	}
+	if err := recordLatestVersion(strings.ToLower(tool), latest); err != nil {
+		logger.Warnf("failed to cache latest %s version: %v", tool, err)
+	}
+	return latest, nil
+}
+
+// fetchLatestVersion looks up the latest version of a tool from its releases.
+func fetchLatestVersion(tool string, includePreReleases bool) (string, error) {
 	switch strings.ToLower(tool) {
 	case "terraform":
 		return getLatestTerraformVersion()
 	case "terragrunt":
 		return getLatestTerragruntVersion(includePreReleases)
+	case toolTofu:
+		return getLatestGitHubVersion("opentofu/opentofu", "OpenTofu", includePreReleases)
 	default:
 		return "", fmt.Errorf("unsupported tool: %s", tool)
 	}
@@ -1167,22 +1655,27 @@ func getLatestVersion(tool string, includePreReleases bool) (string, error) {
 // getLatestTerragruntVersion fetches the latest Terragrunt version from GitHub Releases
 // If includePreReleases is true, it includes pre-releases in the search
 func getLatestTerragruntVersion(includePreReleases bool) (string, error) {
-	apiURL := "https://api.github.com/repos/gruntwork-io/terragrunt/releases"
+	return getLatestGitHubVersion("gruntwork-io/terragrunt", "Terragrunt", includePreReleases)
+}
+
+// getLatestGitHubVersion fetches the latest release version of a GitHub repository
+func getLatestGitHubVersion(repo, name string, includePreReleases bool) (string, error) {
+	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/releases", repo)
 
-	resp, err := http.Get(apiURL)
+	resp, err := httpClient.Get(apiURL)
 	if err != nil {
-		return "", fmt.Errorf("failed to fetch Terragrunt releases: %w", err)
+		return "", fmt.Errorf("failed to fetch %s releases: %w", name, err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("failed to fetch Terragrunt releases: status code %d", resp.StatusCode)
+		return "", fmt.Errorf("failed to fetch %s releases: status code %d", name, resp.StatusCode)
 	}
 
 	var releases []GitHubRelease
 	decoder := json.NewDecoder(resp.Body)
 	if err := decoder.Decode(&releases); err != nil {
-		return "", fmt.Errorf("failed to decode Terragrunt releases: %w", err)
+		return "", fmt.Errorf("failed to decode %s releases: %w", name, err)
 	}
 
 	versions := make([]*version.Version, 0)
@@ -1194,14 +1687,14 @@ func getLatestTerragruntVersion(includePreReleases bool) (string, error) {
 		cleanVerStr := strings.TrimPrefix(release.TagName, "v")
 		ver, err := version.NewVersion(cleanVerStr)
 		if err != nil {
-			logger.Warnf("invalid Terragrunt version format: %s", release.TagName)
+			logger.Warnf("invalid %s version format: %s", name, release.TagName)
 			continue
 		}
 		versions = append(versions, ver)
 	}
 
 	if len(versions) == 0 {
-		return "", errors.New("no valid Terragrunt versions found")
+		return "", fmt.Errorf("no valid %s versions found", name)
 	}
 
 	// Sort versions in descending order
@@ -1214,7 +1707,7 @@ func getLatestTerragruntVersion(includePreReleases bool) (string, error) {
 func getLatestTerraformVersion() (string, error) {
 	indexURL := "https://releases.hashicorp.com/terraform/index.json"
 
-	resp, err := http.Get(indexURL)
+	resp, err := httpClient.Get(indexURL)
 	if err != nil {
 		return "", fmt.Errorf("failed to fetch Terraform release index: %w", err)
 	}
@@ -1252,59 +1745,6 @@ func getLatestTerraformVersion() (string, error) {
 	return latestVersion, nil
 }
 
-// unzipStandard extracts a zip file to the specified destination using the standard library
-func unzipStandard(src, dest string) error {
-	r, err := zip.OpenReader(src)
-	if err != nil {
-		return fmt.Errorf("failed to open zip file %s: %w", src, err)
-	}
-	defer r.Close()
-
-	for _, f := range r.File {
-		fpath := filepath.Join(dest, f.Name)
-
-		// Check for ZipSlip vulnerability
-		if !strings.HasPrefix(fpath, filepath.Clean(dest)+string(os.PathSeparator)) {
-			return fmt.Errorf("illegal file path: %s", fpath)
-		}
-
-		if f.FileInfo().IsDir() {
-			// Create directory
-			os.MkdirAll(fpath, os.ModePerm)
-			continue
-		}
-
-		// Create necessary directories
-		if err := os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
-			return fmt.Errorf("failed to create directory %s: %w", filepath.Dir(fpath), err)
-		}
-
-		// Create the file
-		outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
-		if err != nil {
-			return fmt.Errorf("failed to create file %s: %w", fpath, err)
-		}
-
-		rc, err := f.Open()
-		if err != nil {
-			outFile.Close()
-			return fmt.Errorf("failed to open file %s in zip: %w", f.Name, err)
-		}
-
-		// Copy contents
-		_, err = io.Copy(outFile, rc)
-
-		// Close files
-		outFile.Close()
-		rc.Close()
-
-		if err != nil {
-			return fmt.Errorf("failed to copy contents to file %s: %w", fpath, err)
-		}
-	}
-	return nil
-}
-
 // copyAndCustomizeConfig copies the template config and replaces placeholders with actual values
 func copyAndCustomizeConfig(templatePath, destPath, tfVersion, tgVersion, environment string) error {
 	content, err := os.ReadFile(templatePath)
@@ -1318,7 +1758,7 @@ func copyAndCustomizeConfig(templatePath, destPath, tfVersion, tgVersion, enviro
 	contentStr = strings.ReplaceAll(contentStr, "{{TG_VERSION}}", tgVersion)
 	contentStr = strings.ReplaceAll(contentStr, "{{ENVIRONMENT}}", environment)
 
-	err = os.WriteFile(destPath, []byte(contentStr), 0644)
+	err = writeSecretFile(destPath, []byte(contentStr))
 	if err != nil {
 		return fmt.Errorf("failed to write customized config to %s: %w", destPath, err)
 	}
@@ -1340,7 +1780,7 @@ func customizeTerragruntHcl(templatePath, destPath string, config Config) error
 	contentStr = strings.ReplaceAll(contentStr, "{{S3_STATE_PATH}}", config.S3StatePath)
 	contentStr = strings.ReplaceAll(contentStr, "{{REGION}}", config.Region)
 
-	err = os.WriteFile(destPath, []byte(contentStr), 0644)
+	err = writeSecretFile(destPath, []byte(contentStr))
 	if err != nil {
 		return fmt.Errorf("failed to write customized terragrunt.hcl to %s: %w", destPath, err)
 	}
@@ -1359,7 +1799,7 @@ func getEnvironments(envDir string) ([]string, error) {
 
 	envs := []string{}
 	for _, entry := range entries {
-		if entry.IsDir() {
+		if entry.IsDir() && entry.Name() != baseConfigDirName {
 			envs = append(envs, entry.Name())
 		}
 	}
@@ -1369,13 +1809,17 @@ func getEnvironments(envDir string) ([]string, error) {
 
 // runHclfmt runs hclfmt on terragrunt.hcl
 func runHclfmt(envDir, envType string, check bool) error {
+	if envTerraformOnly(envDir, envType) {
+		logger.Infof("%s runs without Terragrunt. Skipping hclfmt.", envDir)
+		return nil
+	}
 	terragruntPath := filepath.Join(envDir, "config", envType, fmt.Sprintf("terragrunt.%s.hcl", envType))
 	if !fileExists(terragruntPath) {
 		logger.Warnf("terragrunt.hcl file %s not found. Skipping hclfmt.", terragruntPath)
 		return nil
 	}
 
-	tgBinary := filepath.Join(envDir, "bin", "terragrunt")
+	tgBinary := envBinaryPath(envDir, "terragrunt")
 
 	// Check if the terragrunt binary exists
 	if !fileExists(tgBinary) {
@@ -1385,55 +1829,102 @@ func runHclfmt(envDir, envType string, check bool) error {
 		return nil
 	}
 
-	// Prepare the hclfmt command
-	var cmdTg *exec.Cmd
-	if check {
-		cmdTg = exec.Command(tgBinary, "hclfmt", "--terragrunt-check", terragruntPath)
-	} else {
-		cmdTg = exec.Command(tgBinary, "hclfmt", terragruntPath)
+	if err := hclfmtFile(tgBinary, terragruntPath, check); err != nil {
+		return err
 	}
 
-	cmdTg.Dir = filepath.Dir(terragruntPath)
-	output, err := cmdTg.CombinedOutput()
+	logger.Infof("hclfmt completed successfully for %s", terragruntPath)
+	return nil
+}
+// errEnvLocked is returned by acquireEnvLock when the environment is already locked.
+var errEnvLocked = errors.New("environment is locked")
+
+// acquireEnvLock atomically creates the environment's lock file.
+func acquireEnvLock(envPath string) error {
+	lockPath := filepath.Join(envPath, lockFileName)
+	file, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		metrics.observeLock(true)
+		return errEnvLocked
+	}
 	if err != nil {
-		return fmt.Errorf("hclfmt failed: %v, output: %s", err, string(output))
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
 	}
+	metrics.observeLock(false)
+	emitEvent(envPath, eventLockAcquired, nil)
+	return nil
+}
 
-	logger.Infof("hclfmt completed successfully for %s", terragruntPath)
+// releaseEnvLock removes the environment's lock file.
+func releaseEnvLock(envPath string) error {
+	if err := os.Remove(filepath.Join(envPath, lockFileName)); err != nil {
+		return err
+	}
+	emitEvent(envPath, eventLockReleased, nil)
 	return nil
 }
+
 // lockCmd locks the environment to prevent concurrent modifications
 func lockCmd() *cobra.Command {
+	var readOnly bool
+	var reason string
+
 	cmd := &cobra.Command{
 		Use:   "lock <env-name>",
 		Short: "Lock the specified environment to prevent concurrent operations",
-		Args:  cobra.ExactArgs(1),
+		Long: `Lock the specified environment to prevent concurrent operations.
+
+With --read-only the environment is instead marked read-only, e.g. for a change
+freeze: terraform, tofu and terragrunt only run plan, validate, show and other
+commands that do not change infrastructure, both from tfvenv and from shells
+that activate the environment. Lift it with 'tfvenv unlock <env> --read-only'.`,
+		Args: cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			envName := args[0]
 			envDir := viper.GetString("env-dir")
 			envPath := filepath.Join(envDir, envName)
 
-			lockPath := filepath.Join(envPath, lockFileName)
-			if fileExists(lockPath) {
+			if readOnly {
+				if _, err := os.Stat(envPath); os.IsNotExist(err) {
+					i18n.Println("env.not_found", envName)
+					os.Exit(1)
+				}
+				lock := &readOnlyLock{Since: time.Now().UTC(), By: getUsername(), Reason: reason}
+				if err := setReadOnly(envPath, envName, lock); err != nil {
+					logger.Errorf("error marking %s read-only: %v", envName, err)
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+				logger.Infof("environment %s marked read-only by %s", envName, lock.By)
+				fmt.Printf("Environment '%s' is now read-only. Re-activate it in open shells.\n", envName)
+				return
+			}
+
+			err := acquireEnvLock(envPath)
+			if errors.Is(err, errEnvLocked) {
 				fmt.Println("Environment is already locked.")
 				os.Exit(1)
 			}
-
-			file, err := os.Create(lockPath)
 			if err != nil {
 				logger.Errorf("Failed to create lock file: %v", err)
 				fmt.Printf("Error locking environment: %v\n", err)
 				os.Exit(1)
 			}
-			file.Close()
 			fmt.Println("Environment locked successfully.")
 		},
 	}
 
+	cmd.Flags().BoolVar(&readOnly, "read-only", false, "Mark the environment read-only instead: only plan, validate, show and similar commands run")
+	cmd.Flags().StringVar(&reason, "reason", "", "Why the environment is read-only (e.g. change freeze), shown when a command is blocked")
 	return cmd
 }
 // unlockCmd unlocks the environment
 func unlockCmd() *cobra.Command {
+	var readOnly bool
+
 	cmd := &cobra.Command{
 		Use:   "unlock <env-name>",
 		Short: "Unlock the specified environment to allow operations",
@@ -1443,6 +1934,26 @@ func unlockCmd() *cobra.Command {
 			envDir := viper.GetString("env-dir")
 			envPath := filepath.Join(envDir, envName)
 
+			if readOnly {
+				meta, err := loadEnvMetadata(envPath)
+				if err != nil {
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+				if meta.ReadOnly == nil {
+					fmt.Println("Environment is not read-only.")
+					os.Exit(1)
+				}
+				if err := setReadOnly(envPath, envName, nil); err != nil {
+					logger.Errorf("error clearing read-only on %s: %v", envName, err)
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+				logger.Infof("environment %s is no longer read-only", envName)
+				fmt.Printf("Environment '%s' is no longer read-only. Re-activate it in open shells.\n", envName)
+				return
+			}
+
 			lockPath := filepath.Join(envPath, lockFileName)
 			if !fileExists(lockPath) {
 				fmt.Println("Environment is not locked.")
@@ -1459,6 +1970,7 @@ func unlockCmd() *cobra.Command {
 		},
 	}
 
+	cmd.Flags().BoolVar(&readOnly, "read-only", false, "Lift the read-only mark set by 'lock --read-only'")
 	return cmd
 }
 // completionCmd generates shell completion scripts
@@ -1497,31 +2009,34 @@ PowerShell:
   # To load completions for every new session, run:
   PS> tfvenv completion powershell > tfvenv.ps1
   # and source this file from your PowerShell profile.
+
+Or let tfvenv put the script in place and load it from your startup file:
+
+  $ tfvenv completion install
 `,
 		Args: cobra.MatchAll(
 			cobra.ExactArgs(1),
 			cobra.OnlyValidArgs,
 		),
-		ValidArgs: []string{"bash", "zsh", "fish", "powershell"},
+		ValidArgs: completionShells,
 		Run: func(cmd *cobra.Command, args []string) {
-			switch args[0] {
-			case "bash":
-				rootCmd.GenBashCompletion(os.Stdout)
-			case "zsh":
-				rootCmd.GenZshCompletion(os.Stdout)
-			case "fish":
-				rootCmd.GenFishCompletion(os.Stdout, true)
-			case "powershell":
-				rootCmd.GenPowerShellCompletionWithDesc(os.Stdout)
-			}
+			writeCompletion(rootCmd, args[0], os.Stdout)
 		},
 	}
+
+	cmd.AddCommand(completionInstallCmd(rootCmd))
 	return cmd
 }
 
 // createCmd handles the creation of a new environment
 func createCmd() *cobra.Command {
 	var tfVersion, tgVersion string
+	var scaffold bool
+	var configFile string
+	var dryRun bool
+	var repair bool
+	var tool string
+	var expires time.Duration
 
 	cmd := &cobra.Command{
 		Use:   "create <env-name> [tf-version] [tg-version]",
@@ -1552,15 +2067,144 @@ func createCmd() *cobra.Command {
 				logger.Error("attempted to use 'previous' as environment name")
 				os.Exit(1)
 			}
+
+			// An existing environment is only touched to resume an interrupted create or with --repair
+			if _, err := os.Stat(envDirPath); err == nil {
+				switch {
+				case repair:
+					// Keep the installed versions unless others were asked for
+					if pinnedTf, pinnedTg, err := pinnedToolVersions(envDirPath, envName); err == nil {
+						if len(args) < 2 {
+							tfVersion = pinnedTf
+						}
+						if len(args) < 3 {
+							tgVersion = pinnedTg
+						}
+					}
+					i18n.Println("env.repairing", envName)
+				case fileExists(filepath.Join(envDirPath, incompleteMarkerName)):
+					i18n.Println("env.resuming", envName)
+				default:
+					i18n.Println("env.exists_use_repair", envName)
+					os.Exit(1)
+				}
+			}
+
+			// The tool family defaults to what the environment already uses
+			if err := validateTool(tool); err != nil {
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			if tool == "" {
+				tool = envTool(envDirPath, envName)
+			}
+			if expires < 0 {
+				i18n.Println("error", "--expires must be a positive duration")
+				os.Exit(1)
+			}
+			if _, err := os.Stat(envDirPath); os.IsNotExist(err) {
+				if err := checkEnvQuota(envDir); err != nil {
+					logger.Errorf("refusing to create environment %s: %v", envName, err)
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+			}
+
+			// Read the scaffolding configuration before building anything, so a
+			// bad --config fails early. Without --config the environment's own
+			// .tfvenvrc is used when it has one, and an empty one otherwise
+			var scaffoldConfig Config
+			if scaffold {
+				if configFile == "" {
+					configFile = filepath.Join(envDirPath, "config", envName, tfvenvrcFileName)
+					if !fileExists(configFile) {
+						configFile = ""
+					}
+				}
+				if configFile != "" {
+					config, err := readConfig(configFile)
+					if err != nil {
+						logger.Errorf("error reading %s: %v", configFile, err)
+						fmt.Printf("Error reading configuration '%s': %v\n", configFile, err)
+						os.Exit(1)
+					}
+					scaffoldConfig = config
+				}
+			}
+
+			if dryRun {
+				if err := planCreate(envDirPath, envName, tool, tfVersion, tgVersion, repair); err != nil {
+					logger.Errorf("error planning environment %s: %v", envName, err)
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+				if scaffold {
+					printDryRun("would generate backend.tf, provider.tf and versions.tf in %s where missing", filepath.Join(envDirPath, "config", envName))
+				}
+				if expires > 0 {
+					printDryRun("would expire the environment at %s", time.Now().UTC().Add(expires).Format(time.RFC3339))
+				}
+				return
+			}
+			// Remove a half-built environment if creation is interrupted; after an
+			// error it is kept so that rerunning create can resume it
+			removePartial := func() {}
+			if _, err := os.Stat(envDirPath); os.IsNotExist(err) {
+				removePartial = func() {
+					if err := os.RemoveAll(envDirPath); err == nil {
+						fmt.Printf("Removed partially created environment '%s'.\n", envName)
+					}
+				}
+			}
+			removeCleanup := onInterrupt(removePartial)
+
 			// Initialize the environment
-			err := initEnv(envDirPath, tfVersion, tgVersion, envName)
+			err := initEnv(envDirPath, tool, tfVersion, tgVersion, envName, repair)
+			removeCleanup()
 			if err != nil {
 				logger.Errorf("error creating environment %s: %v", envName, err) // Lowercase and use logger
 				fmt.Printf("Error creating environment '%s': %v\n", envName, err)
+				i18n.Println("env.create_resume_hint", strings.Join(args, " "))
 				os.Exit(1)
 			}
 
-			fmt.Printf("Environment '%s' created successfully with Terraform %s and Terragrunt %s.\n", envName, tfVersion, tgVersion)
+			// Resolve "latest" to the versions that were actually installed
+			installedTfVersion, installedTgVersion, err := pinnedToolVersions(envDirPath, envName)
+			if err != nil {
+				installedTfVersion, installedTgVersion = tfVersion, tgVersion
+			}
+			if expires > 0 {
+				expiresAt, err := setEnvExpiry(envDirPath, expires)
+				if err != nil {
+					logger.Errorf("error recording expiry of %s: %v", envName, err)
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+				fmt.Printf("Environment '%s' expires at %s.\n", envName, expiresAt.Format(time.RFC3339))
+			}
+			githubSetOutput("terraform_version", installedTfVersion)
+			githubSetOutput("terragrunt_version", installedTgVersion)
+			githubSetOutput("env_path", envDirPath)
+			githubStepSummary(fmt.Sprintf("### tfvenv create\n\nEnvironment `%s`: Terraform `%s`, Terragrunt `%s`.", envName, installedTfVersion, installedTgVersion))
+			emitEvent(envDirPath, eventEnvCreated, map[string]string{
+				"terraform_version":  installedTfVersion,
+				"terragrunt_version": installedTgVersion,
+			})
+
+			if scaffold {
+				configEnvDir := filepath.Join(envDirPath, "config", envName)
+				written, err := generateScaffolding(configEnvDir, envName, installedTfVersion, scaffoldConfig)
+				if err != nil {
+					logger.Errorf("error generating scaffolding for %s: %v", envName, err)
+					fmt.Printf("Error generating scaffolding: %v\n", err)
+					os.Exit(1)
+				}
+				for _, path := range written {
+					fmt.Printf("Generated %s\n", path)
+				}
+			}
+
+			i18n.Println("env.created", envName, toolDisplayName(tool), tfVersion, tgVersion)
 			logger.Infof("Environment '%s' created successfully with Terraform %s and Terragrunt %s.", envName, tfVersion, tgVersion) // Log success
 		},
 	}
@@ -1568,11 +2212,30 @@ func createCmd() *cobra.Command {
 	// Define specific flags for the create command
 	cmd.Flags().StringVar(&tfVersion, "tf-version", "latest", "Terraform version to create the environment with")
 	cmd.Flags().StringVar(&tgVersion, "tg-version", "none", "Terragrunt version to create the environment with")
+	cmd.Flags().BoolVar(&scaffold, "scaffold", false, "Generate backend.tf, provider.tf and versions.tf from .tfvenvrc")
+	cmd.Flags().StringVar(&configFile, "config", "", "Path to the .tfvenvrc used for scaffolding (defaults to the environment's config directory)")
+	cmd.Flags().BoolVar(&repair, "repair", false, "Check an existing environment, reinstall broken binaries and regenerate activation scripts")
+	cmd.Flags().StringVar(&tool, "tool", "", "Tool family to install: terraform or tofu (defaults to TOOL in .tfvenvrc, then terraform)")
+	cmd.Flags().DurationVar(&expires, "expires", 0, "Mark the environment ephemeral: it expires after this (e.g. 72h) and 'maintain' tears it down")
+	addDryRunFlag(cmd, &dryRun)
+	cmd.RegisterFlagCompletionFunc("tf-version", completeCachedVersions(nil, toolTerraform, toolTofu))
+	cmd.RegisterFlagCompletionFunc("tg-version", completeCachedVersions([]string{"none"}, "terragrunt"))
+	cmd.ValidArgsFunction = func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		switch len(args) {
+		case 1:
+			return completeCachedVersions(nil, toolTerraform, toolTofu)(cmd, args, toComplete)
+		case 2:
+			return completeCachedVersions([]string{"none"}, "terragrunt")(cmd, args, toComplete)
+		}
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
 
 	return cmd
 }
 // deleteCmd handles the deletion of an environment
 func deleteCmd() *cobra.Command {
+	var dryRun, force bool
+
 	cmd := &cobra.Command{
 		Use:   "delete <env-name>",
 		Short: "Delete an existing virtual environment",
@@ -1586,6 +2249,23 @@ func deleteCmd() *cobra.Command {
 			// Construct full path to the environment
 			envPath := filepath.Join(envDir, envName)
 
+			if dryRun {
+				if _, err := os.Stat(envPath); os.IsNotExist(err) {
+					i18n.Println("env.not_found", envName)
+					return
+				}
+				files, size := treeSize(envPath)
+				printDryRun("would remove %s (%d files, %s)", envPath, files, formatSize(size))
+				return
+			}
+
+			// Refuse to pull the binaries out from under an active shell or exec
+			if err := checkEnvNotInUse(envPath, envName, force); err != nil {
+				logger.Errorf("refusing to delete %s: %v", envName, err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+
 			// Delete environment
 			err := os.RemoveAll(envPath)
 			if err != nil {
@@ -1593,11 +2273,13 @@ func deleteCmd() *cobra.Command {
 				fmt.Printf("Error deleting environment '%s': %v\n", envName, err)
 				os.Exit(1)
 			}
-			fmt.Printf("Environment '%s' deleted successfully.\n", envName)
+			i18n.Println("env.deleted", envName)
 			logger.Infof("Environment '%s' deleted successfully.", envName) // Log success
 		},
 	}
 
+	cmd.Flags().BoolVar(&force, "force", false, "Delete the environment even if a shell has it active or a command runs in it")
+	addDryRunFlag(cmd, &dryRun)
 	return cmd
 }
 // listCmd lists all managed environments
@@ -1617,7 +2299,7 @@ func listCmd() *cobra.Command {
 			}
 
 			if len(envs) == 0 {
-				fmt.Println("No environments found.")
+				i18n.Println("env.none_found")
 				logger.Info("no environments found") // Log info
 				return
 			}
@@ -1651,7 +2333,7 @@ func activateCmd() *cobra.Command {
 			config, err := readConfig(configPath)
 			if err != nil {
 				logger.Errorf("error reading %s: %v", configPath, err) // Lowercase and use logger
-				fmt.Printf("Error reading configuration: %v\n", err)
+				i18n.Println("config.read_error", err)
 				os.Exit(1)
 			}
 
@@ -1670,6 +2352,13 @@ func activateCmd() *cobra.Command {
 				}
 			}
 
+			// Refuse to activate binaries that drifted from the pinned versions
+			if err := enforceVersions(envPath, envName, config); err != nil {
+				logger.Errorf("error activating %s: %v", envName, err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+
 			// Generate activate scripts for all supported shells
 			err = generateActivateScript(envPath, envName, config)
 			if err != nil {
@@ -1685,6 +2374,7 @@ func activateCmd() *cobra.Command {
 				fmt.Printf("Error generating deactivate scripts: %v\n", err)
 				os.Exit(1)
 			}
+			refreshEnvState(envPath, envName)
 
 			fmt.Printf("Environment '%s' activated successfully.\n", envName)
 			logger.Infof("environment '%s' activated successfully", envName) // Log success
@@ -1719,7 +2409,7 @@ func deactivateCmd() *cobra.Command {
 			config, err := readConfig(configPath)
 			if err != nil {
 				logger.Errorf("error reading %s: %v", configPath, err) // Lowercase and use logger
-				fmt.Printf("Error reading configuration: %v\n", err)
+				i18n.Println("config.read_error", err)
 				os.Exit(1)
 			}
 
@@ -1761,35 +2451,83 @@ func validateCmd() *cobra.Command {
 			config, err := readConfig(configPath)
 			if err != nil {
 				logger.Errorf("error reading %s: %v", configPath, err) // Lowercase and use logger
-				fmt.Printf("Error reading configuration: %v\n", err)
+				i18n.Println("config.read_error", err)
 				os.Exit(1)
 			}
 
 			// Apply environment variables from the configuration
-			applyEnvVars(config.EnvVars)
+			envVars, err := renderEnvVars(envDir, envType, config)
+			if err != nil {
+				logger.Errorf("error rendering ENV_VARS: %v", err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			applyEnvVars(envVars)
 
 			// Paths to the .tfvars and terragrunt.hcl files
 			tfvarsPath := filepath.Join(envDir, "config", envType, fmt.Sprintf("%s.tfvars", envType))
 			terragruntPath := filepath.Join(envDir, "config", envType, fmt.Sprintf("terragrunt.%s.hcl", envType))
 
-			// Validate .tfvars file using Terraform
+			// Decrypt sops-encrypted variables files to tmpfs for the duration of the run
+			decrypted, cleanupSecrets, err := decryptSopsVarFiles(envDir, envType, filepath.Dir(tfvarsPath))
+			if err != nil {
+				logger.Errorf("error decrypting secrets: %v", err)
+				fmt.Printf("Error decrypting secrets: %v\n", err)
+				os.Exit(1)
+			}
+			defer cleanupSecrets()
+
+			// Validate .tfvars file using Terraform, or OpenTofu when TOOL=tofu
 			if fileExists(tfvarsPath) {
-				tfBinary := filepath.Join(envDir, "bin", "terraform")
+				tool := envTool(envDir, envType)
+				tfBinary := envBinaryPath(envDir, tool)
 
-				// Check if Terraform binary exists
+				// Check if the binary exists
 				if !fileExists(tfBinary) {
-					logger.Errorf("terraform binary not found at %s", tfBinary) // Lowercase and use logger
-					fmt.Printf("Terraform binary not found at %s\n", tfBinary)
+					cleanupSecrets()
+					logger.Errorf("%s binary not found at %s", tool, tfBinary) // Lowercase and use logger
+					fmt.Printf("%s binary not found at %s\n", toolDisplayName(tool), tfBinary)
 					os.Exit(1)
 				}
 
-				cmdTf := exec.Command(tfBinary, "validate", "-var-file", tfvarsPath)
-				cmdTf.Env = append(os.Environ(), "TF_DATA_DIR="+filepath.Join(envDir, "terraform-data"))
-
-				output, err := cmdTf.CombinedOutput()
+				varFile := tfvarsPath
+				if plain, ok := decrypted[tfvarsPath]; ok {
+					varFile = plain
+				}
+				// Validate every root module against the environment's variables
+				roots, err := envRoots(envDir, envType)
 				if err != nil {
-					logger.Errorf("validation failed for %s: %v", tfvarsPath, err) // Lowercase and use logger
-					fmt.Println("Validation Error:", string(output))
+					cleanupSecrets()
+					logger.Errorf("error finding root modules: %v", err)
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+				// Each root runs in its own directory, so the paths it gets must be absolute
+				var failed []string
+				for _, root := range roots {
+					cmdTf := exec.Command(absPath(tfBinary), "validate", "-var-file", absPath(varFile))
+					cmdTf.Dir = filepath.Join(envDir, "config", envType, root)
+					cmdTf.Env = append(os.Environ(), "TF_DATA_DIR="+rootDataDir(absPath(envDir), root))
+
+					output, err := cmdTf.CombinedOutput()
+					if err != nil {
+						logger.Errorf("validation failed for %s in %s: %v", tfvarsPath, rootLabel(envType, root), err) // Lowercase and use logger
+						fmt.Printf("Validation Error (%s): %s\n", rootLabel(envType, root), string(output))
+						githubAnnotate("error", tfvarsPath, string(output))
+						failed = append(failed, rootLabel(envType, root))
+						continue
+					}
+					if len(roots) > 1 {
+						fmt.Printf("Root %s is valid.\n", rootLabel(envType, root))
+					}
+				}
+				if len(failed) > 0 {
+					// os.Exit skips deferred calls
+					cleanupSecrets()
+					githubStepSummary(fmt.Sprintf("### tfvenv validate\n\n:x: `%s` failed validation in %s.", tfvarsPath, strings.Join(failed, ", ")))
+					if len(roots) > 1 {
+						fmt.Printf("%d of %d root(s) failed validation: %s\n", len(failed), len(roots), strings.Join(failed, ", "))
+					}
 					os.Exit(1)
 				}
 				fmt.Printf(".tfvars file %s is valid.\n", tfvarsPath)
@@ -1800,23 +2538,29 @@ func validateCmd() *cobra.Command {
 			}
 
 			// Validate terragrunt.hcl file using Terragrunt
-			if fileExists(terragruntPath) {
-				tgBinary := filepath.Join(envDir, "bin", "terragrunt")
+			if envTerraformOnly(envDir, envType) {
+				logger.Infof("%s runs without Terragrunt; skipping terragrunt.hcl validation", envDir)
+			} else if fileExists(terragruntPath) {
+				tgBinary := envBinaryPath(envDir, "terragrunt")
 
 				// Check if Terragrunt binary exists
 				if !fileExists(tgBinary) {
+					cleanupSecrets()
 					logger.Errorf("terragrunt binary not found at %s", tgBinary) // Lowercase and use logger
 					fmt.Printf("Terragrunt binary not found at %s\n", tgBinary)
 					os.Exit(1)
 				}
 
-				cmdTg := exec.Command(tgBinary, "hclfmt", "--terragrunt-check", terragruntPath)
+				cmdTg := exec.Command(absPath(tgBinary), "hclfmt", "--terragrunt-check", absPath(terragruntPath))
 				cmdTg.Dir = filepath.Dir(terragruntPath)
 
 				output, err := cmdTg.CombinedOutput()
 				if err != nil {
+					cleanupSecrets()
 					logger.Errorf("validation failed for %s: %v", terragruntPath, err) // Lowercase and use logger
 					fmt.Println("Validation Error:", string(output))
+					githubAnnotate("error", terragruntPath, string(output))
+					githubStepSummary(fmt.Sprintf("### tfvenv validate\n\n:x: `%s` failed validation.", terragruntPath))
 					os.Exit(1)
 				}
 				fmt.Printf("terragrunt.hcl file %s is valid.\n", terragruntPath)
@@ -1827,6 +2571,7 @@ func validateCmd() *cobra.Command {
 			}
 
 			logger.Info("validation completed successfully") // Log success
+			githubStepSummary(fmt.Sprintf("### tfvenv validate\n\n:white_check_mark: Environment `%s` is valid.", envType))
 		},
 	}
 
@@ -1836,11 +2581,31 @@ func validateCmd() *cobra.Command {
 }
 // statusCmd shows the status of the environment
 func statusCmd() *cobra.Command {
+	var manifestFlag string
+	var backend bool
+
 	cmd := &cobra.Command{
-		Use:   "status <env-name>",
-		Short: "Display the status of the specified environment",
-		Args:  cobra.ExactArgs(1),
+		Use:   "status [env-name]",
+		Short: "Display the status of the specified environment, or of every environment in " + manifestFileName,
+		Args:  cobra.MaximumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
+			// Without an environment name, report on the project manifest
+			if len(args) == 0 {
+				manifestPath, err := resolveManifestPath(manifestFlag)
+				if err != nil {
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+				m, err := loadManifest(manifestPath)
+				if err != nil {
+					logger.Errorf("error loading manifest: %v", err)
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+				printManifestStatus(manifestPath, m)
+				return
+			}
+
 			envName := args[0]
 			envDir := viper.GetString("env-dir")
 			envPath := filepath.Join(envDir, envName)
@@ -1850,15 +2615,15 @@ func statusCmd() *cobra.Command {
 			config, err := readConfig(configPath)
 			if err != nil {
 				logger.Errorf("error reading %s: %v", configPath, err) // Lowercase and use logger
-				fmt.Printf("Error reading configuration: %v\n", err)
+				i18n.Println("config.read_error", err)
 				os.Exit(1)
 			}
 
 			fmt.Printf("Status of environment '%s' (%s):\n", envName, envDir)
 
 			// Check if Terraform and Terragrunt are installed
-			tfPath := filepath.Join(envDir, "bin", "terraform")
-			tgPath := filepath.Join(envDir, "bin", "terragrunt")
+			tfPath := envBinaryPath(envPath, "terraform")
+			tgPath := envBinaryPath(envPath, "terragrunt")
 			if fileExists(tfPath) {
 				fmt.Printf("Terraform installed at %s\n", tfPath)
 				logger.Infof("Terraform installed at %s", tfPath) // Log info
@@ -1869,14 +2634,49 @@ func statusCmd() *cobra.Command {
 			if fileExists(tgPath) {
 				fmt.Printf("Terragrunt installed at %s\n", tgPath)
 				logger.Infof("Terragrunt installed at %s", tgPath) // Log info
+			} else if envTerraformOnly(envPath, envName) {
+				fmt.Println("Terragrunt not used (Terraform-only environment).")
 			} else {
 				fmt.Println("Terragrunt not found in environment.")
 				logger.Warnf("Terragrunt not found in environment at %s", tgPath) // Log warning
 			}
+			state := loadEnvState(envPath, envName)
+			warnPathBinaries(envPath, envName, state)
+			if state.TerraformVersion != "" {
+				fmt.Printf("%s version: %s\n", toolDisplayName(state.Tool), state.TerraformVersion)
+			}
+			if state.TerragruntVersion != "" {
+				fmt.Printf("Terragrunt version: %s\n", state.TerragruntVersion)
+			}
+			if len(state.Plugins) > 0 {
+				fmt.Println("Providers:")
+				for _, source := range sortedEnvKeys(state.Plugins) {
+					fmt.Printf(" - %s %s\n", source, state.Plugins[source])
+				}
+			}
+			if meta, err := loadEnvMetadata(envPath); err == nil && meta.ReadOnly != nil {
+				fmt.Printf("Read-only since %s by %s", meta.ReadOnly.Since.Format(time.RFC3339), meta.ReadOnly.By)
+				if meta.ReadOnly.Reason != "" {
+					fmt.Printf(": %s", meta.ReadOnly.Reason)
+				}
+				fmt.Println()
+			}
+			if meta, err := loadEnvMetadata(envPath); err == nil && meta.ExpiresAt != nil {
+				if meta.ExpiresAt.After(time.Now()) {
+					fmt.Printf("Expires at %s\n", meta.ExpiresAt.Format(time.RFC3339))
+				} else {
+					fmt.Printf("Expired at %s\n", meta.ExpiresAt.Format(time.RFC3339))
+				}
+			}
 
 			// Display active environment variables
+			envVars, err := renderEnvVars(envPath, envName, config)
+			if err != nil {
+				logger.Warnf("error rendering ENV_VARS: %v", err)
+				envVars = config.EnvVars
+			}
 			fmt.Println("Environment Variables:")
-			for key, value := range config.EnvVars {
+			for key, value := range envVars {
 				if isSensitiveKey(key) {
 					fmt.Printf(" - %s=******\n", key) // Masked output
 				} else {
@@ -1886,24 +2686,24 @@ func statusCmd() *cobra.Command {
 				logger.Infof("environment variable set: %s", key)
 			}
 
+			// Ask the S3 backend whether the state exists and whether someone holds its lock
+			if backend {
+				printStateBackendStatus(config)
+			}
+
 			logger.Info("status displayed successfully") // Log success
 		},
 	}
 
+	cmd.Flags().StringVar(&manifestFlag, "manifest", "", "Path to "+manifestFileName+" used when no environment is given (defaults to the nearest one)")
+	cmd.Flags().BoolVar(&backend, "backend", false, "Query the S3 state backend for the state objects and their DynamoDB locks")
 	return cmd
 }
 
 // / downloadAndInstallBinary downloads and installs the specified binary.
 // It handles different OS and package types for Windows, Linux, and macOS.
 func downloadAndInstallBinary(baseURL, version, binDir, tool string) error {
-	binaryName := tool
-	binaryPath := filepath.Join(binDir, binaryName)
-
-	// Append .exe extension for Windows binaries
-	if runtime.GOOS == "windows" {
-		binaryName += ".exe"
-		binaryPath = filepath.Join(binDir, binaryName)
-	}
+	binaryPath := filepath.Join(binDir, executableName(tool))
 
 	// Check if the binary is already installed
 	if fileExists(binaryPath) {
@@ -1918,11 +2718,13 @@ func downloadAndInstallBinary(baseURL, version, binDir, tool string) error {
 					logger.Warnf("Failed to fetch latest version for %s: %v", tool, err)
 				} else if existingVersion == latestVersion {
 					fmt.Printf("`%s version %s` already installed at %s\n", tool, existingVersion, binaryPath)
+					metrics.observeCache(tool, true)
 					return nil
 				}
 			} else {
 				if existingVersion == version {
 					fmt.Printf("`%s version %s` already installed at %s\n", tool, existingVersion, binaryPath)
+					metrics.observeCache(tool, true)
 					return nil
 				}
 			}
@@ -1938,78 +2740,97 @@ func downloadAndInstallBinary(baseURL, version, binDir, tool string) error {
 		version = latest
 		logger.Infof("Using latest version for %s: %s", tool, version)
 	}
+	if err := checkVersionPolicy(tool, version); err != nil {
+		return err
+	}
+	pinned, err := envChecksumPin(binDir, tool, version)
+	if err != nil {
+		return err
+	}
 
-	// Define file paths and URLs
-	var downloadURL, destPath string
-
-	// Construct the download URL based on the tool and OS
-	switch tool {
-	case "terraform":
-		// Terraform is distributed as a zip archive across all OSes
-		// Example: https://releases.hashicorp.com/terraform/1.9.7/terraform_1.9.7_linux_amd64.zip
-		downloadURL = fmt.Sprintf("%s%s/terraform_%s_%s_%s.zip", baseURL, version, version, runtime.GOOS, runtime.GOARCH)
-		destPath = filepath.Join(binDir, "terraform.zip")
-	case "terragrunt":
-		// Terragrunt binaries are direct downloads, with .exe for Windows
-		// Example for Linux: https://github.com/gruntwork-io/terragrunt/releases/download/v0.67.16/terragrunt_linux_amd64
-		// Example for Windows: https://github.com/gruntwork-io/terragrunt/releases/download/v0.67.16/terragrunt_windows_amd64.exe
-		if runtime.GOOS == "windows" {
-			downloadURL = fmt.Sprintf("%sv%s/terragrunt_%s_%s.exe", baseURL, version, runtime.GOOS, runtime.GOARCH)
-			destPath = filepath.Join(binDir, "terragrunt.exe")
-		} else {
-			downloadURL = fmt.Sprintf("%sv%s/terragrunt_%s_%s", baseURL, version, runtime.GOOS, runtime.GOARCH)
-			destPath = filepath.Join(binDir, "terragrunt")
+	// Everything is downloaded, extracted and verified in a directory of its
+	// own, and the binary only replaces the environment's once it runs and
+	// reports the right version
+	stageDir, removeStage, err := newInstallStage(binDir)
+	if err != nil {
+		return err
+	}
+	defer removeStage()
+	stagedPath := filepath.Join(stageDir, executableName(tool))
+
+	// Use the version store, filled by 'tfvenv migrate', before downloading.
+	// It holds binaries rather than the release downloads a pinned checksum
+	// is for, so it is skipped when one is pinned.
+	if pinned != "" {
+		logger.Infof("%s %s has a pinned sha256; not using the version store", tool, version)
+	} else if stored, err := installStoredBinary(tool, version, stagedPath); err != nil {
+		logger.Warnf("failed to install %s %s from the version store: %v", tool, version, err)
+	} else if stored {
+		if installedVersion, err := getBinaryVersion(stagedPath, tool); err == nil && installedVersion == version {
+			if err := commitStagedBinary(stagedPath, binaryPath); err != nil {
+				return err
+			}
+			summary.fileWritten(binaryPath)
+			summary.cacheHit()
+			metrics.observeCache(tool, true)
+			fmt.Printf("Installed: `%s version %s` from %s\n", tool, installedVersion, versionStoreDir())
+			return nil
 		}
-	default:
-		return fmt.Errorf("unknown tool: %s", tool)
+		logger.Warnf("%s does not report version %s; downloading it instead", storedBinaryPath(tool, version), version)
 	}
 
 	fmt.Printf("Downloading %s version %s...\n", tool, version)
-	logger.Infof("Downloading %s from %s", tool, downloadURL)
 
-	// Download the binary
-	err := downloadFile(downloadURL, destPath)
-	if err != nil {
-		return fmt.Errorf("failed to download %s: %w", tool, err)
-	}
-
-	// Post-download processing based on the tool
-	switch tool {
-	case "terraform":
-		// Unzip the Terraform archive
-		err = unzipStandard(destPath, binDir)
+	// Download the binary, or reuse an earlier download from the artifact
+	// cache, from the fastest mirror that has it
+	endPhase := summary.phase(fmt.Sprintf("install %s %s", tool, version))
+	defer endPhase()
+	var artifact toolArtifact
+	var destPath string
+	var cached bool
+	downloadStart := time.Now()
+	mirrors := mirrorOrder(tool, baseURL)
+	for i, mirror := range mirrors {
+		artifact, err = builtinArtifact(mirror, version, tool)
 		if err != nil {
-			return fmt.Errorf("failed to unzip Terraform: %w", err)
-		}
-		// Clean up zip file after extraction
-		os.Remove(destPath)
-
-		// Rename the binary if necessary (e.g., adding .exe for Windows)
-		extractedBinaryName := "terraform"
-		if runtime.GOOS == "windows" {
-			extractedBinaryName += ".exe"
+			return err
 		}
-		extractedBinaryPath := filepath.Join(binDir, extractedBinaryName)
-		if fileExists(extractedBinaryPath) {
-			// Overwrite the existing binaryPath with the extracted binary
-			err = os.Rename(extractedBinaryPath, binaryPath)
-			if err != nil {
-				return fmt.Errorf("failed to rename Terraform binary: %w", err)
+		destPath = artifact.downloadPath(stageDir)
+		logger.Infof("Downloading %s from %s", tool, artifact.URL)
+		cached, err = fetchArtifact(artifact.URL, destPath, func(digest string) error {
+			if err := verifyPinnedChecksum(artifact.URL, pinned, digest); err != nil {
+				return err
 			}
+			return verifyArtifact(artifact, digest)
+		})
+		if err == nil || i == len(mirrors)-1 {
+			break
 		}
-	case "terragrunt":
-		// Ensure Terragrunt binary is executable
-		if runtime.GOOS != "windows" {
-			if err := os.Chmod(destPath, 0755); err != nil {
-				return fmt.Errorf("failed to set execute permissions on %s: %w", destPath, err)
-			}
+		logger.Warnf("failed to download %s from %s: %v; trying %s", tool, mirror, err, mirrors[i+1])
+		demoteMirror(tool, mirror)
+	}
+	if err != nil {
+		if notFound := unpublishedRelease(tool, version, artifact.URL, err); notFound != nil {
+			return notFound
 		}
-	default:
-		// No additional processing for unknown tools
+		return fmt.Errorf("failed to download %s: %w", tool, err)
+	}
+	if cached {
+		if err := verifyPinnedFile(artifact.URL, pinned, destPath); err != nil {
+			return fmt.Errorf("failed to download %s: %w", tool, err)
+		}
+	}
+	metrics.observeCache(tool, cached)
+	if !cached {
+		metrics.observeDownload(tool, time.Since(downloadStart))
+	}
+
+	if err := installArtifact(artifact, destPath, stagedPath); err != nil {
+		return fmt.Errorf("failed to install %s: %w", toolDisplayName(tool), err)
 	}
 
-	// Verify the installed version
-	installedVersion, err := getBinaryVersion(binaryPath, tool)
+	// Verify the version before the binary replaces the environment's
+	installedVersion, err := getBinaryVersion(stagedPath, tool)
 	if err != nil {
 		return fmt.Errorf("failed to verify installed %s version: %w", tool, err)
 	}
@@ -2018,16 +2839,83 @@ func downloadAndInstallBinary(baseURL, version, binDir, tool string) error {
 		return fmt.Errorf("%s version mismatch: expected %s, got %s", tool, version, installedVersion)
 	}
 
+	// Keep the binary in the version store, so environments on the same
+	// version link to it instead of downloading it again. A pinned version
+	// keeps its verified copy.
+	if pinned == "" {
+		if stored, err := addToVersionStore(tool, version, stagedPath); err != nil {
+			logger.Warnf("%v; keeping a copy in the environment", err)
+		} else if err := linkStoredBinary(stored, stagedPath); err != nil {
+			logger.Warnf("%v; keeping a copy in the environment", err)
+		}
+	}
+	if err := commitStagedBinary(stagedPath, binaryPath); err != nil {
+		return err
+	}
+	summary.fileWritten(binaryPath)
+
 	fmt.Printf("Installed: `%s version %s`\n", tool, installedVersion)
 	logger.Infof("%s version %s installed successfully at %s", tool, installedVersion, binaryPath)
 
 	return nil
 }
 
+// binaryDownloadURL returns the release URL of a tool for this platform and the file it is downloaded to.
+func binaryDownloadURL(baseURL, version, binDir, tool string) (downloadURL, destPath string, err error) {
+	artifact, err := builtinArtifact(baseURL, version, tool)
+	if err != nil {
+		return "", "", err
+	}
+	return artifact.URL, artifact.downloadPath(binDir), nil
+}
+
+// envBinaryPath returns the path of a tool binary inside the environment's bin directory.
+func envBinaryPath(envPath, tool string) string {
+	return filepath.Join(envPath, "bin", executableName(tool))
+}
+
+// envTerraformCommand prepares the environment's terraform or tofu binary to run in its config directory
+// with the environment's TF_DATA_DIR. TF_WORKSPACE is dropped so terraform honours the selected workspace.
+func envTerraformCommand(envPath, envName string, args ...string) (*exec.Cmd, error) {
+	return envRootCommand(envPath, envName, ".", args...)
+}
+
+// envRootCommand is envTerraformCommand for one of the environment's root modules.
+func envRootCommand(envPath, envName, root string, args ...string) (*exec.Cmd, error) {
+	if err := enforceReadOnly(envPath, envName, args); err != nil {
+		return nil, err
+	}
+	// The command runs in the root module, so paths into the environment must
+	// not depend on --env-dir being absolute
+	envPath = absPath(envPath)
+	tool := envTool(envPath, envName)
+	tfBinary := envBinaryPath(envPath, tool)
+	if !fileExists(tfBinary) {
+		return nil, fmt.Errorf("%s binary not found at %s", tool, tfBinary)
+	}
+
+	cmdTf := exec.Command(tfBinary, args...)
+	cmdTf.Dir = filepath.Join(envPath, "config", envName, root)
+
+	env := []string{}
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, "TF_WORKSPACE=") && !strings.HasPrefix(kv, "TF_DATA_DIR=") {
+			env = append(env, kv)
+		}
+	}
+	env = append(env, "TF_DATA_DIR="+rootDataDir(envPath, root))
+	if cliConfigPath := filepath.Join(envPath, cliConfigFileName); fileExists(cliConfigPath) {
+		env = append(env, "TF_CLI_CONFIG_FILE="+cliConfigPath)
+	}
+	cmdTf.Env = env
+
+	return cmdTf, nil
+}
+
 // getBinaryVersion retrieves the version of the installed binary.
 func getBinaryVersion(binaryPath, tool string) (string, error) {
 	var cmd *exec.Cmd
-	if tool == "terraform" {
+	if tool == "terraform" || tool == toolTofu {
 		cmd = exec.Command(binaryPath, "version")
 	} else if tool == "terragrunt" {
 		cmd = exec.Command(binaryPath, "--version")
@@ -2043,8 +2931,8 @@ func getBinaryVersion(binaryPath, tool string) (string, error) {
 	outputStr := string(output)
 	// Parse the version from the output
 	var version string
-	if tool == "terraform" {
-		// Example output: Terraform v1.9.7
+	if tool == "terraform" || tool == toolTofu {
+		// Example output: Terraform v1.9.7 or OpenTofu v1.6.2
 		parts := strings.Fields(outputStr)
 		if len(parts) >= 2 {
 			version = strings.TrimPrefix(parts[1], "v")
@@ -2066,39 +2954,78 @@ func getBinaryVersion(binaryPath, tool string) (string, error) {
 
 // upgradeBinaries upgrades Terraform and Terragrunt binaries to specified versions.
 // It provides detailed logging for each step.
-func upgradeBinaries(envDir, tfVersion, tgVersion string) error {
+func upgradeBinaries(envDir, tool, tfVersion, tgVersion string) error {
     logger.Infof("upgrading binaries in environment %s", envDir) // Lowercase log message
 
     // Paths to the bin directory
     binDir := filepath.Join(envDir, "bin")
 
-    // Upgrade Terraform
-    fmt.Printf("Upgrading Terraform to version %s...\n", tfVersion)
-    logger.Infof("upgrading Terraform to version %s", tfVersion) // Lowercase log message
-    err := downloadAndInstallBinary(terraformDownloadURL, tfVersion, binDir, "terraform")
+    // Back up the current binaries so a failed or interrupted upgrade can be rolled back
+    backupDir, err := backupBinaries(envDir)
+    if err != nil {
+        return err
+    }
+    rollback := func() {
+        if backupDir == "" {
+            return
+        }
+        if _, err := restoreLatestBackup(envDir); err != nil {
+            logger.Errorf("failed to restore binaries after upgrade: %v", err)
+            return
+        }
+        fmt.Println("Restored the previous binaries.")
+    }
+    removeCleanup := onInterrupt(rollback)
+    defer removeCleanup()
+
+    // Upgrade Terraform or OpenTofu
+    name := toolDisplayName(tool)
+    fmt.Printf("Upgrading %s to version %s...\n", name, tfVersion)
+    logger.Infof("upgrading %s to version %s", name, tfVersion) // Lowercase log message
+    err = downloadAndInstallBinary(toolDownloadURL(tool), tfVersion, binDir, tool)
     if err != nil {
-        logger.Errorf("error upgrading Terraform: %v", err) // Lowercase and use logger
-        return fmt.Errorf("failed to upgrade Terraform: %w", err)
+        logger.Errorf("error upgrading %s: %v", name, err) // Lowercase and use logger
+        removeCleanup()
+        rollback()
+        return fmt.Errorf("failed to upgrade %s: %w", name, err)
     }
-    fmt.Printf("Terraform upgraded to version %s\n", tfVersion)
-    logger.Infof("Terraform upgraded to version %s", tfVersion) // Log success
+    fmt.Printf("%s upgraded to version %s\n", name, tfVersion)
+    logger.Infof("%s upgraded to version %s", name, tfVersion) // Log success
 
     // Upgrade Terragrunt
+    if tgVersion == "none" {
+        removeCleanup()
+        if backupDir != "" {
+            os.RemoveAll(backupDir)
+        }
+        return nil
+    }
     fmt.Printf("Upgrading Terragrunt to version %s...\n", tgVersion)
     logger.Infof("upgrading Terragrunt to version %s", tgVersion) // Lowercase log message
     err = downloadAndInstallBinary(terragruntDownloadURL, tgVersion, binDir, "terragrunt")
     if err != nil {
         logger.Errorf("error upgrading Terragrunt: %v", err) // Lowercase and use logger
+        removeCleanup()
+        rollback()
         return fmt.Errorf("failed to upgrade Terragrunt: %w", err)
     }
     fmt.Printf("Terragrunt upgraded to version %s\n", tgVersion)
     logger.Infof("Terragrunt upgraded to version %s", tgVersion) // Log success
 
+    if backupDir != "" {
+        removeCleanup()
+        if err := os.RemoveAll(backupDir); err != nil {
+            logger.Warnf("failed to remove binary backup %s: %v", backupDir, err)
+        }
+    }
+
     return nil
 }
 // upgradeCmd upgrades Terraform and Terragrunt binaries to specified versions.
 func upgradeCmd() *cobra.Command {
 	var tfVersion, tgVersion string
+	var group []string
+	var dryRun, jsonOutput, yes, sync, force bool
 
 	cmd := &cobra.Command{
 		Use:   "upgrade",
@@ -2114,27 +3041,129 @@ func upgradeCmd() *cobra.Command {
 				tgVersion = "latest"
 			}
 
-			// Upgrade binaries
-			err := upgradeBinaries(envDir, tfVersion, tgVersion)
+			targets, err := resolveUpgradeTargets(envDir, group)
+			if err != nil {
+				logger.Errorf("error resolving environments to upgrade: %v", err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+
+			// With --sync, each environment goes back to the versions pinned in
+			// its .tfvenvrc; unpinned tools keep their installed version
+			if sync {
+				for i, target := range targets {
+					configPath := filepath.Join(target.Path, "config", target.Name, tfvenvrcFileName)
+					config, err := readConfig(configPath)
+					if err != nil {
+						logger.Errorf("error reading %s: %v", configPath, err)
+						i18n.Println("config.read_error", err)
+						os.Exit(1)
+					}
+					targets[i].TfVersion, targets[i].TgVersion = syncVersions(target, config)
+				}
+			}
+
+			// Terraform-only environments get Terragrunt only when asked for it
+			if !cmd.Flags().Changed("tg-version") {
+				for i, target := range targets {
+					if target.TgVersion == "" && envTerraformOnly(target.Path, target.Name) {
+						targets[i].TgVersion = "none"
+					}
+				}
+			}
+
+			checked := make(map[string]bool)
+			for _, target := range targets {
+				parent := filepath.Dir(target.Path)
+				if checked[parent] {
+					continue
+				}
+				checked[parent] = true
+				if err := checkUpgradeQuota(parent); err != nil {
+					logger.Errorf("refusing to upgrade %s: %v", target.Name, err)
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+			}
+
+			// Print the plan of record before touching anything
+			plan, err := buildUpgradePlan(targets, tfVersion, tgVersion)
 			if err != nil {
-				logger.Errorf("Upgrade failed: %v", err)
-				fmt.Printf("Error upgrading binaries: %v\n", err)
+				logger.Errorf("error planning upgrade: %v", err)
+				i18n.Println("error", err)
 				os.Exit(1)
 			}
+			printUpgradePlan(plan, jsonOutput)
+			if dryRun {
+				return
+			}
+			if !plan.pending() {
+				fmt.Println("Nothing to upgrade.")
+				return
+			}
+
+			// Binaries swapped under a running plan break it, so environments
+			// that are active somewhere need --force
+			for _, target := range targets {
+				if err := checkEnvNotInUse(target.Path, target.Name, force); err != nil {
+					logger.Errorf("refusing to upgrade %s: %v", target.Name, err)
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+			}
+			if !yes {
+				ok, err := confirm("Proceed with the upgrade?")
+				if err != nil {
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+				if !ok {
+					fmt.Println("Upgrade cancelled.")
+					return
+				}
+			}
+
+			// Upgrade binaries to the versions the plan resolved
+			for _, target := range targets {
+				tfTarget := plan.targetVersion(target.Name, target.Tool)
+				tgTarget := plan.targetVersion(target.Name, "terragrunt")
+				err := upgradeBinaries(target.Path, target.Tool, tfTarget, tgTarget)
+				if err != nil {
+					logger.Errorf("Upgrade failed: %v", err)
+					fmt.Printf("Error upgrading binaries in '%s': %v\n", target.Name, err)
+					os.Exit(1)
+				}
+				refreshEnvState(target.Path, target.Name)
+				emitEvent(target.Path, eventEnvUpgraded, map[string]string{
+					"tool":               target.Tool,
+					"terraform_version":  tfTarget,
+					"terragrunt_version": tgTarget,
+				})
+			}
 			fmt.Println("Upgrade completed successfully.")
 		},
 	}
 
 	// Define specific flags for the upgrade command
-	cmd.Flags().StringVar(&tfVersion, "tf-version", "latest", "Terraform version to upgrade to")
+	cmd.Flags().StringVar(&tfVersion, "tf-version", "latest", "Terraform (or OpenTofu, for TOOL=tofu environments) version to upgrade to")
 	cmd.Flags().StringVar(&tgVersion, "tg-version", "latest", "Terragrunt version to upgrade to")
+	cmd.Flags().StringSliceVar(&group, "group", nil, "Upgrade these environments under --env-dir (comma-separated, or all) instead of --env-dir itself")
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the upgrade plan as JSON")
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Upgrade without asking for confirmation")
+	cmd.Flags().BoolVar(&sync, "sync", false, "Reinstall the versions pinned in each environment's .tfvenvrc instead of --tf-version and --tg-version")
+	cmd.Flags().BoolVar(&force, "force", false, "Upgrade environments even if a shell has them active or a command runs in them")
+	addDryRunFlag(cmd, &dryRun)
+	cmd.RegisterFlagCompletionFunc("tf-version", completeCachedVersions(nil, toolTerraform, toolTofu))
+	cmd.RegisterFlagCompletionFunc("tg-version", completeCachedVersions(nil, "terragrunt"))
 
 	return cmd
 }
 // hclfmtCmd formats or checks .hcl files in the environment
 func hclfmtCmd() *cobra.Command {
 	var envType string
-	var check bool
+	var check, recursive bool
+	var include, exclude []string
+	var parallel int
 
 	cmd := &cobra.Command{
 		Use:   "hclfmt <env-name>",
@@ -2150,15 +3179,35 @@ func hclfmtCmd() *cobra.Command {
 			config, err := readConfig(configPath)
 			if err != nil {
 				logger.Errorf("error reading %s: %v", configPath, err)
-				fmt.Printf("Error reading configuration: %v\n", err)
+				i18n.Println("config.read_error", err)
 				os.Exit(1)
 			}
 
-			// Apply environment variables from the configuration
-			applyEnvVars(config.EnvVars)
+			if envTerraformOnly(envPath, envType) {
+				fmt.Printf("Environment '%s' runs without Terragrunt; use 'tfvenv fmt' to format its files.\n", envName)
+				return
+			}
 
-			// Run hclfmt
-			err = runHclfmt(envDir, envType, check)
+			// Apply environment variables from the configuration
+			envVars, err := renderEnvVars(envPath, envType, config)
+			if err != nil {
+				logger.Errorf("error rendering ENV_VARS: %v", err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			applyEnvVars(envVars)
+
+			// Run hclfmt on the environment's terragrunt file, or on every
+			// matching file in nested stack directories
+			if recursive || len(include) > 0 || len(exclude) > 0 {
+				var count int
+				count, err = runHclfmtTree(envPath, envType, include, exclude, check, parallel)
+				if err == nil {
+					fmt.Printf("Processed %d file(s).\n", count)
+				}
+			} else {
+				err = runHclfmt(envPath, envType, check)
+			}
 			if err != nil {
 				logger.Errorf("hclfmt failed: %v", err)
 				fmt.Printf("hclfmt Error: %v\n", err)
@@ -2178,16 +3227,33 @@ func hclfmtCmd() *cobra.Command {
 	// Define command-line flags
 	cmd.Flags().StringVar(&envType, "env-type", "dev", "Environment type (e.g., dev, prod)")
 	cmd.Flags().BoolVar(&check, "check", false, "Check formatting without making changes")
+	cmd.Flags().BoolVar(&recursive, "recursive", false, "Format every terragrunt.hcl under the config directory, including nested stacks")
+	cmd.Flags().StringSliceVar(&include, "include", nil, "Glob patterns of files to format (implies --recursive; default terragrunt.hcl,terragrunt.*.hcl)")
+	cmd.Flags().StringSliceVar(&exclude, "exclude", nil, "Glob patterns of files or directories to skip (implies --recursive)")
+	addParallelFlag(cmd, &parallel)
 
 	return cmd
 }
 
 // initEnv initializes a new environment with detailed logging and ensures plugin cache is centralized.
-func initEnv(envDir, tfVersion, tgVersion, environment string) error {
+// It can be rerun on a partially built environment: installed binaries and
+// existing configuration files are kept, and with repair the activation
+// scripts are regenerated even when present. tfVersion is the version of tool,
+// terraform or tofu.
+func initEnv(envDir, tool, tfVersion, tgVersion, environment string, repair bool) error {
 	logger.Infof("Initializing environment %s/%s", envDir, environment)
 
+	// Mark the environment as incomplete until every step has succeeded
+	if err := os.MkdirAll(envDir, 0755); err != nil {
+		return fmt.Errorf("failed to create environment directory: %w", err)
+	}
+	markerPath := filepath.Join(envDir, incompleteMarkerName)
+	if err := os.WriteFile(markerPath, []byte(time.Now().UTC().Format(time.RFC3339)+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to mark environment as incomplete: %w", err)
+	}
+
 	// Define centralized plugin cache directory and Terraform data directory
-	pluginCacheDir := filepath.Join(os.Getenv("HOME"), ".tfvenv", "plugin-cache")
+	pluginCacheDir := defaultPluginCacheDir()
 	tfDataDir := filepath.Join(envDir, "terraform-data")
 
 	// Create the plugin cache and Terraform data directories
@@ -2202,20 +3268,33 @@ func initEnv(envDir, tfVersion, tgVersion, environment string) error {
 	binDir := filepath.Join(envDir, "bin")
 	configEnvDir := filepath.Join(envDir, "config", environment)
 	templatesDir := filepath.Join(envDir, "templates")
+	scriptsDir := envScriptsDir(envDir)
 
-	directories := []string{binDir, configEnvDir, templatesDir}
+	directories := []string{binDir, configEnvDir, templatesDir, scriptsDir}
 	for _, dir := range directories {
 		if err := os.MkdirAll(dir, 0755); err != nil {
 			return fmt.Errorf("failed to create directory %s: %w", dir, err)
 		}
 	}
 
-	// Download and install Terraform
-	fmt.Printf("Installing Terraform...\n")
-	logger.Infof("Downloading and installing Terraform version %s", tfVersion)
-	err := downloadAndInstallBinary(terraformDownloadURL, tfVersion, binDir, "terraform")
+	// Record the tool family so activation and wrappers pick the right binary
+	terraformOnly := tgVersion == "none" && !fileExists(envBinaryPath(envDir, "terragrunt"))
+	if err := updateEnvMetadata(envDir, func(meta *EnvironmentMetadata) {
+		meta.Tool = tool
+		meta.TerraformOnly = terraformOnly
+		if meta.CreatedBy == "" {
+			meta.CreatedBy = getUsername()
+		}
+	}); err != nil {
+		return err
+	}
+
+	// Download and install Terraform or OpenTofu
+	fmt.Printf("Installing %s...\n", toolDisplayName(tool))
+	logger.Infof("Downloading and installing %s version %s", toolDisplayName(tool), tfVersion)
+	err := downloadAndInstallBinary(toolDownloadURL(tool), tfVersion, binDir, tool)
 	if err != nil {
-		return fmt.Errorf("failed to download Terraform: %w", err)
+		return fmt.Errorf("failed to download %s: %w", toolDisplayName(tool), err)
 	}
 
 	// Download and install Terragrunt if not specified as "none"
@@ -2232,7 +3311,8 @@ func initEnv(envDir, tfVersion, tgVersion, environment string) error {
 	tfvarsTemplatePath := filepath.Join(templatesDir, fmt.Sprintf("%s.tfvars.template", environment))
 	terragruntTemplatePath := filepath.Join(templatesDir, fmt.Sprintf("terragrunt.%s.hcl.template", environment))
 
-	// Create default template files if they don't exist
+	// Create default template files if they don't exist; Terraform-only
+	// environments get no Terragrunt files
 	if !fileExists(tfvarsTemplatePath) {
 		if err := createDefaultTfvarsTemplate(tfvarsTemplatePath); err != nil {
 			return fmt.Errorf("failed to create default .tfvars template: %w", err)
@@ -2240,7 +3320,7 @@ func initEnv(envDir, tfVersion, tgVersion, environment string) error {
 		logger.Infof("Default .tfvars template created at %s", tfvarsTemplatePath)
 	}
 
-	if !fileExists(terragruntTemplatePath) {
+	if !terraformOnly && !fileExists(terragruntTemplatePath) {
 		if err := createDefaultTerragruntTemplate(terragruntTemplatePath); err != nil {
 			return fmt.Errorf("failed to create default terragrunt.hcl template: %w", err)
 		}
@@ -2249,36 +3329,46 @@ func initEnv(envDir, tfVersion, tgVersion, environment string) error {
 
 	// Customize and create .tfvars file
 	tfvarsPath := filepath.Join(configEnvDir, fmt.Sprintf("%s.tfvars", environment))
-	err = copyAndCustomizeConfig(tfvarsTemplatePath, tfvarsPath, tfVersion, tgVersion, environment)
-	if err != nil {
-		return fmt.Errorf("failed to create .tfvars file from template: %w", err)
+	if fileExists(tfvarsPath) {
+		logger.Infof("keeping existing %s", tfvarsPath)
+	} else {
+		err = copyAndCustomizeConfig(tfvarsTemplatePath, tfvarsPath, tfVersion, tgVersion, environment)
+		if err != nil {
+			return fmt.Errorf("failed to create .tfvars file from template: %w", err)
+		}
 	}
 
 	// Customize and create terragrunt.hcl file with EnvVars including TF_PLUGIN_CACHE_DIR and TF_DATA_DIR
 	terragruntPath := filepath.Join(configEnvDir, fmt.Sprintf("terragrunt.%s.hcl", environment))
-	err = customizeTerragruntHcl(terragruntTemplatePath, terragruntPath, Config{
-		S3StateBucket: "your_s3_state_bucket", // Replace with actual values or pass through parameters
-		S3StatePath:   "your_s3_state_path",
-		Region:        "your_aws_region",
-		EnvVars: map[string]string{
-			"TF_PLUGIN_CACHE_DIR": pluginCacheDir,
-			"TF_DATA_DIR":         tfDataDir,
-		},
-	})
-	if err != nil {
-		return fmt.Errorf("failed to create terragrunt.hcl file from template: %w", err)
-	}
+	if terraformOnly {
+		logger.Infof("skipping %s for a Terraform-only environment", terragruntPath)
+	} else if fileExists(terragruntPath) {
+		logger.Infof("keeping existing %s", terragruntPath)
+	} else {
+		err = customizeTerragruntHcl(terragruntTemplatePath, terragruntPath, Config{
+			S3StateBucket: "your_s3_state_bucket", // Replace with actual values or pass through parameters
+			S3StatePath:   "your_s3_state_path",
+			Region:        "your_aws_region",
+			EnvVars: map[string]string{
+				"TF_PLUGIN_CACHE_DIR": pluginCacheDir,
+				"TF_DATA_DIR":         tfDataDir,
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create terragrunt.hcl file from template: %w", err)
+		}
 
-	// Apply hclfmt automatically using runHclfmt
-	fmt.Printf("Formatting terragrunt.hcl...\n")
-	err = runHclfmt(envDir, environment, false)
-	if err != nil {
-		logger.Errorf("hclfmt failed: %v", err)
-		fmt.Printf("hclfmt Error: %v\n", err)
-		return fmt.Errorf("failed to format terragrunt.hcl: %w", err)
+		// Apply hclfmt automatically using runHclfmt
+		fmt.Printf("Formatting terragrunt.hcl...\n")
+		err = runHclfmt(envDir, environment, false)
+		if err != nil {
+			logger.Errorf("hclfmt failed: %v", err)
+			fmt.Printf("hclfmt Error: %v\n", err)
+			return fmt.Errorf("failed to format terragrunt.hcl: %w", err)
+		}
+		logger.Infof("terragrunt.hcl formatted successfully")
+		fmt.Printf("terragrunt.hcl formatted successfully.\n")
 	}
-	logger.Infof("terragrunt.hcl formatted successfully")
-	fmt.Printf("terragrunt.hcl formatted successfully.\n")
 
 	// Read the complete configuration to pass to script generators
 	completeConfig := Config{
@@ -2291,20 +3381,41 @@ func initEnv(envDir, tfVersion, tgVersion, environment string) error {
 		},
 	}
 
-	// Generate activate scripts for all supported shells
-	err = generateActivateScript(envDir, environment, completeConfig)
-	if err != nil {
-		return fmt.Errorf("failed to generate activation scripts: %w", err)
+	// Share registry tokens with the new environment once the credentials helper is set up
+	if fileExists(credentialsHelperPath()) {
+		if err := enableCredentialsHelper(envDir); err != nil {
+			logger.Warnf("failed to enable credentials helper: %v", err)
+		}
 	}
 
-	// Generate deactivate scripts for all supported shells
-	err = generateDeactivateScript(envDir, completeConfig)
-	if err != nil {
-		return fmt.Errorf("failed to generate deactivation scripts: %w", err)
+	// CLI settings declared by an existing .tfvenvrc
+	if config, err := loadEnvConfig(envDir, environment); err == nil {
+		if err := applyCLIConfig(envDir, config); err != nil {
+			logger.Warnf("failed to apply the CLI settings of %s: %v", environment, err)
+		}
 	}
 
+	// Generate activation and deactivation scripts for all supported shells if missing
+	if repair || !fileExists(filepath.Join(binDir, "activate.sh")) {
+		err = generateActivateScript(envDir, environment, completeConfig)
+		if err != nil {
+			return fmt.Errorf("failed to generate activation scripts: %w", err)
+		}
+	}
+	if repair || !fileExists(filepath.Join(binDir, "deactivate.sh")) {
+		err = generateDeactivateScript(envDir, completeConfig)
+		if err != nil {
+			return fmt.Errorf("failed to generate deactivation scripts: %w", err)
+		}
+	}
+
+	if err := os.Remove(markerPath); err != nil {
+		return fmt.Errorf("failed to mark environment as complete: %w", err)
+	}
+	refreshEnvState(envDir, environment)
+
 	logger.Infof("Environment %s/%s initialized successfully", envDir, environment)
-	fmt.Printf("Environment '%s' created successfully with Terraform %s and Terragrunt %s.\n", environment, tfVersion, tgVersion)
+	i18n.Println("env.created", environment, toolDisplayName(tool), tfVersion, tgVersion)
 	fmt.Println(`Run the following to add the environment binaries to your PATH (if not already present):
       source ~/.bashrc
 
@@ -2348,9 +3459,15 @@ inputs = {
 	return nil
 }
 
-// mergeConfigurations merges template configurations into the environment
-func mergeConfigurations(envDir, envType string) error {
-	logger.Infof("Merging configurations for environment %s/%s", envDir, envType)
+// mergeConfigurations merges template configurations into the environment,
+// settling conflicts with the given strategy, and records the merge in the
+// audit log.
+func mergeConfigurations(envDir, envType, strategy string) error {
+	logger.Infof("Merging configurations for environment %s/%s with strategy %s", envDir, envType, strategy)
+	resolve, err := newConflictResolver(strategy)
+	if err != nil {
+		return err
+	}
 
 	templatesDir := filepath.Join(envDir, "templates")
 	configEnvDir := filepath.Join(envDir, "config", envType)
@@ -2363,40 +3480,66 @@ func mergeConfigurations(envDir, envType string) error {
 	tfvarsPath := filepath.Join(configEnvDir, fmt.Sprintf("%s.tfvars", envType))
 	terragruntPath := filepath.Join(configEnvDir, fmt.Sprintf("terragrunt.%s.hcl", envType))
 
+	// Back up every file that is about to be rewritten so the merge can be undone
+	var backupDir string
+	for _, path := range []string{tfvarsPath, terragruntPath} {
+		if !fileExists(path) {
+			continue
+		}
+		if backupDir == "" {
+			dir, err := newBackupSet(envDir)
+			if err != nil {
+				return err
+			}
+			backupDir = dir
+		}
+		if err := backupFile(envDir, backupDir, path); err != nil {
+			return err
+		}
+	}
+
+	var merged mergeResult
+	record := func(result mergeResult) {
+		merged.Added = append(merged.Added, result.Added...)
+		merged.Ours = append(merged.Ours, result.Ours...)
+		merged.Theirs = append(merged.Theirs, result.Theirs...)
+	}
+
 	// Merge .tfvars
 	if fileExists(tfvarsTemplatePath) && fileExists(tfvarsPath) {
-		err := smartMerge(tfvarsTemplatePath, tfvarsPath)
+		result, err := smartMerge(tfvarsTemplatePath, tfvarsPath, strategy, resolve)
 		if err != nil {
 			return fmt.Errorf("failed to merge .tfvars: %w", err)
 		}
+		record(result)
 		fmt.Printf(".tfvars file merged successfully at %s\n", tfvarsPath)
 	}
 
 	// Merge terragrunt.hcl
 	if fileExists(terragruntTemplatePath) && fileExists(terragruntPath) {
-		err := smartMerge(terragruntTemplatePath, terragruntPath)
+		result, err := smartMerge(terragruntTemplatePath, terragruntPath, strategy, resolve)
 		if err != nil {
 			return fmt.Errorf("failed to merge terragrunt.hcl: %w", err)
 		}
+		record(result)
 		fmt.Printf("terragrunt.hcl file merged successfully at %s\n", terragruntPath)
 	}
 
+	if n := len(merged.Ours) + len(merged.Theirs); n > 0 {
+		fmt.Printf("%d conflict(s): kept the environment's %s; took the template's %s\n", n, listOrNone(merged.Ours), listOrNone(merged.Theirs))
+	}
+	emitEvent(envDir, eventEnvMerged, map[string]string{
+		"env_type": envType,
+		"strategy": strategy,
+		"added":    strings.Join(merged.Added, ","),
+		"ours":     strings.Join(merged.Ours, ","),
+		"theirs":   strings.Join(merged.Theirs, ","),
+	})
 	return nil
 }
 
-// smartMerge merges the template file into the environment file without overwriting user modifications
-func smartMerge(templatePath, envPath string) error {
-	templateContent, err := os.ReadFile(templatePath)
-	if err != nil {
-		return fmt.Errorf("failed to read template file %s: %w", templatePath, err)
-	}
-
-	envContent, err := os.ReadFile(envPath)
-	if err != nil {
-		return fmt.Errorf("failed to read environment file %s: %w", envPath, err)
-	}
-
-	// Simple merge: Append any lines from template that are missing in env file
+// missingTemplateLines returns the non-comment template lines that the environment file lacks, in template order.
+func missingTemplateLines(templateContent, envContent []byte) []string {
 	envLines := make(map[string]bool)
 	scanner := bufio.NewScanner(bytes.NewReader(envContent))
 	for scanner.Scan() {
@@ -2406,42 +3549,81 @@ func smartMerge(templatePath, envPath string) error {
 		}
 	}
 
+	var missing []string
 	templateScanner := bufio.NewScanner(bytes.NewReader(templateContent))
-	var mergedContent bytes.Buffer
-	mergedContent.Write(envContent) // Start with existing env content
-
 	for templateScanner.Scan() {
 		line := strings.TrimSpace(templateScanner.Text())
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
 		if !envLines[line] {
-			mergedContent.WriteString("\n" + line)
+			missing = append(missing, line)
+		}
+	}
+	return missing
+}
+
+// smartMerge merges the template file into the environment file. Attributes
+// and blocks the environment lacks are added, and conflicting ones are
+// settled by resolve. Files that are not valid HCL fall back to appending the
+// template lines the environment file lacks, which only the ours strategy allows.
+func smartMerge(templatePath, envPath, strategy string, resolve conflictResolver) (mergeResult, error) {
+	var result mergeResult
+	templateContent, err := os.ReadFile(templatePath)
+	if err != nil {
+		return result, fmt.Errorf("failed to read template file %s: %w", templatePath, err)
+	}
+
+	envContent, err := os.ReadFile(envPath)
+	if err != nil {
+		return result, fmt.Errorf("failed to read environment file %s: %w", envPath, err)
+	}
+
+	var mergedContent []byte
+	if parseErr := hclParseError(envPath, templateContent, envContent); parseErr != nil {
+		if strategy != mergeOurs {
+			return result, fmt.Errorf("cannot apply --strategy %s: %w", strategy, parseErr)
+		}
+		logger.Warnf("%v; appending the missing template lines instead", parseErr)
+		// Simple merge: Append any lines from template that are missing in env file
+		var buf bytes.Buffer
+		buf.Write(envContent) // Start with existing env content
+		for _, line := range missingTemplateLines(templateContent, envContent) {
+			buf.WriteString("\n" + line)
+			result.Added = append(result.Added, line)
+		}
+		mergedContent = buf.Bytes()
+	} else {
+		mergedContent, result, err = mergeHCL(filepath.Base(envPath), templateContent, envContent, resolve)
+		if err != nil {
+			return result, err
 		}
 	}
+	if len(result.Added) == 0 && len(result.Theirs) == 0 {
+		return result, nil
+	}
 
 	// Write the merged content back to the environment file
-	err = os.WriteFile(envPath, mergedContent.Bytes(), 0644)
+	err = writeSecretFile(envPath, mergedContent)
 	if err != nil {
-		return fmt.Errorf("failed to write merged content to %s: %w", envPath, err)
+		return result, fmt.Errorf("failed to write merged content to %s: %w", envPath, err)
 	}
 
-	return nil
+	return result, nil
 }
 
 // readConfig reads the tfvenvrc configuration file
 func readConfig(configPath string) (Config, error) {
 	var config Config
-	viper.SetConfigFile(configPath)
-	viper.SetConfigType("env") // Assuming tfvenvrc is in KEY=VALUE format
-
-	if err := viper.ReadInConfig(); err != nil {
+	// tfvenvrc is in KEY=VALUE format, layered over the base config
+	if err := readTfvenvrc(viper.GetViper(), configPath); err != nil {
 		return config, err
 	}
 
 	if err := viper.Unmarshal(&config); err != nil {
 		return config, err
 	}
+	config.CLIArgs = tfCLIArgs(viper.GetViper())
 
 	return config, nil
 }
@@ -2458,6 +3640,19 @@ func fileExists(path string) bool {
 // applyEnvVars applies custom environment variables from the configuration
 func applyEnvVars(envVars map[string]string) {
 	for key, value := range envVars {
+		if isSecretReference(value) {
+			secret, err := resolveSecretReference(value)
+			if err != nil {
+				logger.Warnf("error resolving %s from %s: %v", key, value, err)
+				fmt.Printf("Warning: could not resolve %s from %s: %v\n", key, value, err)
+				continue
+			}
+			// Never echo the secret itself
+			fmt.Printf("Setting environment variable %s from %s\n", key, value)
+			logger.Infof("Setting environment variable %s from %s", key, value)
+			os.Setenv(key, secret)
+			continue
+		}
 		if currentVal, exists := os.LookupEnv(key); exists {
 			fmt.Printf("Environment variable %s is already set to %s.\n", key, currentVal)
 			fmt.Printf("Do you want to overwrite it with %s? (y/n): ", value)
@@ -2475,6 +3670,9 @@ func applyEnvVars(envVars map[string]string) {
 }
 func mergeCmd() *cobra.Command {
     var envType string
+    var strategy string
+    var undo bool
+    var dryRun bool
 
     cmd := &cobra.Command{
         Use:   "merge <env-name>",
@@ -2484,9 +3682,45 @@ func mergeCmd() *cobra.Command {
             envName := args[0]
             envDir := viper.GetString("env-dir")
             envPath := filepath.Join(envDir, envName)
+            if err := validateMergeStrategy(strategy); err != nil {
+                i18n.Println("error", err)
+                os.Exit(1)
+            }
+
+            // Restore the files saved by the most recent merge
+            if undo {
+                if dryRun {
+                    if err := planRestoreLatestBackup(envPath); err != nil {
+                        logger.Errorf("Merge undo dry run failed: %v", err)
+                        i18n.Println("error", err)
+                        os.Exit(1)
+                    }
+                    return
+                }
+                restored, err := restoreLatestBackup(envPath)
+                if err != nil {
+                    logger.Errorf("Merge undo failed: %v", err)
+                    fmt.Printf("Error undoing merge: %v\n", err)
+                    os.Exit(1)
+                }
+                for _, path := range restored {
+                    fmt.Printf("Restored %s\n", path)
+                }
+                fmt.Println("Previous merge undone successfully.")
+                return
+            }
+
+            if dryRun {
+                if err := planMerge(envPath, envType, strategy); err != nil {
+                    logger.Errorf("Merge dry run failed: %v", err)
+                    i18n.Println("error", err)
+                    os.Exit(1)
+                }
+                return
+            }
 
             // Call mergeConfigurations with envPath and envType
-            err := mergeConfigurations(envPath, envType)
+            err := mergeConfigurations(envPath, envType, strategy)
             if err != nil {
                 logger.Errorf("Merge failed: %v", err)
                 fmt.Printf("Error merging configurations: %v\n", err)
@@ -2498,6 +3732,10 @@ func mergeCmd() *cobra.Command {
 
     // Define command-line flags
     cmd.Flags().StringVar(&envType, "env-type", "dev", "Environment type (e.g., dev, prod)")
+    cmd.Flags().StringVar(&strategy, "strategy", mergeOurs, "How to settle attributes and blocks the template and environment define differently: ours (keep the environment's), theirs (take the template's) or interactive")
+    cmd.Flags().BoolVar(&undo, "undo", false, "Restore the files saved before the most recent merge")
+    cmd.RegisterFlagCompletionFunc("strategy", cobra.FixedCompletions(mergeStrategies, cobra.ShellCompDirectiveNoFileComp))
+    addDryRunFlag(cmd, &dryRun)
 
     return cmd
 }
@@ -2537,85 +3775,16 @@ func listVersionsCmd() *cobra.Command {
 	return cmd
 }
 
+// getLastFiveTerraformVersions returns the five newest stable Terraform
+// releases, refreshing the releases cached for shell completion.
 func getLastFiveTerraformVersions() ([]string, error) {
-	indexURL := "https://releases.hashicorp.com/terraform/index.json"
-
-	resp, err := http.Get(indexURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch Terraform release index: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to fetch Terraform release index: status code %d", resp.StatusCode)
-	}
-
-	var index map[string]TerraformRelease
-	decoder := json.NewDecoder(resp.Body)
-	if err := decoder.Decode(&index); err != nil {
-		return nil, fmt.Errorf("failed to decode Terraform release index: %w", err)
-	}
-
-	versions := make([]*version.Version, 0, len(index))
-	for verStr := range index {
-		cleanVerStr := strings.TrimPrefix(verStr, "v")
-		ver, err := version.NewVersion(cleanVerStr)
-		if err != nil {
-			logger.Warnf("invalid Terraform version format: %s", verStr)
-			continue
-		}
-		versions = append(versions, ver)
-	}
-
-	sort.Sort(sort.Reverse(version.Collection(versions)))
-
-	latestVersions := []string{}
-	for i := 0; i < 5 && i < len(versions); i++ {
-		latestVersions = append(latestVersions, versions[i].Original())
-	}
-	return latestVersions, nil
+	return recentReleases(toolTerraform, 5)
 }
 
+// getLastFiveTerragruntVersions returns the five newest stable Terragrunt
+// releases, refreshing the releases cached for shell completion.
 func getLastFiveTerragruntVersions() ([]string, error) {
-	apiURL := "https://api.github.com/repos/gruntwork-io/terragrunt/releases"
-
-	resp, err := http.Get(apiURL)
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch Terragrunt releases: %w", err)
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to fetch Terragrunt releases: status code %d", resp.StatusCode)
-	}
-
-	var releases []GitHubRelease
-	decoder := json.NewDecoder(resp.Body)
-	if err := decoder.Decode(&releases); err != nil {
-		return nil, fmt.Errorf("failed to decode Terragrunt releases: %w", err)
-	}
-
-	versions := make([]*version.Version, 0)
-	for _, release := range releases {
-		if release.Prerelease {
-			continue
-		}
-		cleanVerStr := strings.TrimPrefix(release.TagName, "v")
-		ver, err := version.NewVersion(cleanVerStr)
-		if err != nil {
-			logger.Warnf("invalid Terragrunt version format: %s", release.TagName)
-			continue
-		}
-		versions = append(versions, ver)
-	}
-
-	sort.Sort(sort.Reverse(version.Collection(versions)))
-
-	latestVersions := []string{}
-	for i := 0; i < 5 && i < len(versions); i++ {
-		latestVersions = append(latestVersions, versions[i].Original())
-	}
-	return latestVersions, nil
+	return recentReleases("terragrunt", 5)
 }
 // switchCmd switches to a different Terraform environment by name or full path
 func switchCmd() *cobra.Command {
@@ -2693,6 +3862,16 @@ func switchCmd() *cobra.Command {
 				os.Exit(1)
 			}
 
+			// Refuse to switch to binaries that drifted from the pinned versions
+			newEnvName := filepath.Base(newEnvPath)
+			if config, err := readConfig(filepath.Join(newEnvPath, "config", newEnvName, tfvenvrcFileName)); err == nil {
+				if err := enforceVersions(newEnvPath, newEnvName, config); err != nil {
+					logger.Errorf("error switching to %s: %v", newEnvName, err)
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+			}
+
 			// Track the previously active environment
 			err := os.Setenv("TFVENV_PREV", filepath.Base(envDir))
 			if err != nil {
@@ -2748,8 +3927,9 @@ func terraformInstallCmd() *cobra.Command {
 				fmt.Printf("Error installing Terraform: %v\n", err)
 				os.Exit(1)
 			}
+			refreshEnvState(envDir, filepath.Base(envDir))
 			fmt.Printf("Terraform version %s installed successfully.\n", tfVersion)
-			logger.Infof("Terraform version %s installed successfully at %s", tfVersion, filepath.Join(binDir, "terraform"))
+			logger.Infof("Terraform version %s installed successfully at %s", tfVersion, filepath.Join(binDir, executableName("terraform")))
 		},
 	}
 
@@ -2794,8 +3974,9 @@ func terragruntInstallCmd() *cobra.Command {
 				fmt.Printf("Error installing Terragrunt: %v\n", err)
 				os.Exit(1)
 			}
+			refreshEnvState(envDir, filepath.Base(envDir))
 			fmt.Printf("Terragrunt version %s installed successfully.\n", tgVersion)
-			logger.Infof("Terragrunt version %s installed successfully at %s", tgVersion, filepath.Join(binDir, "terragrunt"))
+			logger.Infof("Terragrunt version %s installed successfully at %s", tgVersion, filepath.Join(binDir, executableName("terragrunt")))
 		},
 	}
 
@@ -2831,10 +4012,21 @@ func escapePowerShell(value string) string {
 }
 // generateActivateScript generates activation scripts for multiple shells
 func generateActivateScript(envDir, envName string, config Config) error {
+	defer summary.phase("activation scripts")()
+
+	// Templated ENV_VARS values are resolved now, so the scripts hold plain values
+	envVars, err := renderEnvVars(envDir, envName, config)
+	if err != nil {
+		return err
+	}
+	config.EnvVars = envVars
 	binDir := filepath.Join(envDir, "bin")
 	if err := os.MkdirAll(binDir, 0755); err != nil {
 		return fmt.Errorf("failed to create bin directory: %w", err)
 	}
+	// The record of the shell using the environment is kept as an absolute
+	// path, so it is removed again after the shell changes directory
+	activeDir := filepath.Join(absPath(envDir), activeDirName)
 
 	// Generate for Bash and Zsh
 	activateShPath := filepath.Join(binDir, "activate.sh")
@@ -2847,21 +4039,89 @@ func generateActivateScript(envDir, envName string, config Config) error {
 	bufferBash.WriteString("  export INITIAL_PATH=\"$PATH\"\n")
 	bufferBash.WriteString("fi\n\n")
 
-	// Set TFVENV_PATH if not already set
-	bufferBash.WriteString("if [ -z \"$TFVENV_PATH\" ]; then\n")
-	bufferBash.WriteString(fmt.Sprintf("  export TFVENV_PATH=\"%s\"\n", escapeBash(envDir)))
-	bufferBash.WriteString("fi\n\n")
-
-	// Prepend bin directory to PATH if not already in PATH
-	bufferBash.WriteString("if [[ \":$PATH:\" != *\":$TFVENV_PATH/bin:\"* ]]; then\n")
-	bufferBash.WriteString("  export PATH=\"$TFVENV_PATH/bin:$PATH\"\n")
-	bufferBash.WriteString("fi\n\n")
+	// The shell no longer uses the environment that was active before
+	bufferBash.WriteString("if [ -n \"$TFVENV_ACTIVE_RECORD\" ]; then\n")
+	bufferBash.WriteString("  rm -f \"$TFVENV_ACTIVE_RECORD\"\n")
+	bufferBash.WriteString("fi\n")
+
+	// Put bin, then the scripts directory, in front of PATH so the environment's
+	// binaries win, after dropping them and those of a stale activation
+	bufferBash.WriteString(pathDedupeMarker + "\n")
+	bufferBash.WriteString("_tfvenv_path=\":$PATH:\"\n")
+	bufferBash.WriteString(fmt.Sprintf("for _tfvenv_dir in \"$TFVENV_PATH\" %s; do\n", escapeBash(envDir)))
+	bufferBash.WriteString("  [ -n \"$_tfvenv_dir\" ] || continue\n")
+	bufferBash.WriteString("  for _tfvenv_entry in \"$_tfvenv_dir/bin\" \"$_tfvenv_dir/scripts\"; do\n")
+	bufferBash.WriteString("    while [[ \"$_tfvenv_path\" == *\":$_tfvenv_entry:\"* ]]; do\n")
+	bufferBash.WriteString("      _tfvenv_path=\"${_tfvenv_path/\":$_tfvenv_entry:\"/:}\"\n")
+	bufferBash.WriteString("    done\n")
+	bufferBash.WriteString("  done\n")
+	bufferBash.WriteString("done\n")
+	bufferBash.WriteString("_tfvenv_path=\"${_tfvenv_path#:}\"\n")
+	bufferBash.WriteString("_tfvenv_path=\"${_tfvenv_path%:}\"\n")
+	bufferBash.WriteString(fmt.Sprintf("export TFVENV_PATH=%s\n", escapeBash(envDir)))
+	bufferBash.WriteString("export PATH=\"$TFVENV_PATH/bin:$TFVENV_PATH/scripts${_tfvenv_path:+:$_tfvenv_path}\"\n")
+	bufferBash.WriteString("unset _tfvenv_path _tfvenv_dir _tfvenv_entry\n\n")
+
+	// Record this shell as using the environment, so upgrade and delete leave
+	// its binaries alone while it is active
+	bufferBash.WriteString(fmt.Sprintf("export TFVENV_ACTIVE_RECORD=%s\"/$$\"\n", escapeBash(activeDir)))
+	bufferBash.WriteString(fmt.Sprintf("mkdir -p %s 2>/dev/null && echo shell > \"$TFVENV_ACTIVE_RECORD\" 2>/dev/null\n\n", escapeBash(activeDir)))
 
 	// Set TFVENV_ENV to the environment name
 	bufferBash.WriteString(fmt.Sprintf("export TFVENV_ENV=\"%s\"\n", escapeBash(envName)))
 
-	// Set additional environment variables, avoiding duplicates
-	for key, value := range config.EnvVars {
+	// Expose the local module cache for Terragrunt sources (get_env("TFVENV_MODULES_DIR"))
+	bufferBash.WriteString(fmt.Sprintf("export TFVENV_MODULES_DIR=%s\n", escapeBash(filepath.Join(envDir, "modules"))))
+
+	// Export the recorded Terraform workspace so it travels with the environment
+	meta, err := loadEnvMetadata(envDir)
+	if err != nil {
+		logger.Warnf("error reading environment metadata: %v", err)
+	}
+	if meta.Workspace != "" {
+		bufferBash.WriteString(fmt.Sprintf("export TF_WORKSPACE=%s\n", escapeBash(meta.Workspace)))
+	}
+
+	// Run OpenTofu for terraform commands, and from terragrunt, when the environment uses it
+	tool := resolveTool(config.Tool, meta.Tool)
+	bufferBash.WriteString(fmt.Sprintf("export TFVENV_TOOL=%s\n", tool))
+
+	// In a read-only environment, check every command with tfvenv before running it
+	if meta.ReadOnly != nil {
+		bufferBash.WriteString("export TFVENV_READ_ONLY=1\n")
+		for _, binary := range []string{tool, "terragrunt"} {
+			bufferBash.WriteString(fmt.Sprintf("%s() { %s guard %s -- \"$@\" && command %s \"$@\"; }\n", binary, escapeBash(tfvenvExecutable()), escapeBash(envDir), binary))
+		}
+	}
+	if tool == toolTofu {
+		bufferBash.WriteString("alias terraform=tofu\n")
+		bufferBash.WriteString(fmt.Sprintf("export TERRAGRUNT_TFPATH=%s\n", escapeBash(envBinaryPath(envDir, toolTofu))))
+	}
+
+	// Point terraform at the environment's CLI configuration (provider mirrors, credentials helpers)
+	cliConfigPath := filepath.Join(envDir, cliConfigFileName)
+	hasCLIConfig := fileExists(cliConfigPath)
+	if hasCLIConfig {
+		bufferBash.WriteString(fmt.Sprintf("export TF_CLI_CONFIG_FILE=%s\n", escapeBash(cliConfigPath)))
+	}
+
+	// Select the environment's AWS profile and region instead of static keys
+	if config.AWSProfile != "" {
+		bufferBash.WriteString(fmt.Sprintf("export AWS_PROFILE=%s\n", escapeBash(config.AWSProfile)))
+	}
+	if config.AWSRegion != "" {
+		bufferBash.WriteString(fmt.Sprintf("export AWS_REGION=%s\n", escapeBash(config.AWSRegion)))
+		bufferBash.WriteString(fmt.Sprintf("export AWS_DEFAULT_REGION=%s\n", escapeBash(config.AWSRegion)))
+	}
+
+	// Set additional environment variables, avoiding duplicates. Secret references
+	// are resolved when the script is sourced so the values never reach the script.
+	for _, key := range sortedEnvKeys(config.EnvVars) {
+		value := config.EnvVars[key]
+		if isSecretReference(value) {
+			bufferBash.WriteString(fmt.Sprintf("export %s=\"$(%s secrets read %s)\"\n", key, escapeBash(tfvenvExecutable()), escapeBash(value)))
+			continue
+		}
 		bufferBash.WriteString(fmt.Sprintf("export %s=%s\n", key, escapeBash(value)))
 	}
 	bufferBash.WriteString("\n")
@@ -2885,7 +4145,7 @@ func generateActivateScript(envDir, envName string, config Config) error {
 	bufferBash.WriteString("echo \"TF_DATA_DIR is set to $TF_DATA_DIR\"\n")
 
 	// Write the Bash/Zsh activate script
-	err := os.WriteFile(activateShPath, bufferBash.Bytes(), 0755)
+	err = writeScriptFile(activateShPath, bufferBash.Bytes())
 	if err != nil {
 		return fmt.Errorf("failed to write activate.sh: %w", err)
 	}
@@ -2902,21 +4162,66 @@ func generateActivateScript(envDir, envName string, config Config) error {
 	bufferFish.WriteString("  set -gx INITIAL_PATH $PATH\n")
 	bufferFish.WriteString("end\n\n")
 
-	// Set TFVENV_PATH if not already set
-	bufferFish.WriteString("if not set -q TFVENV_PATH\n")
-	bufferFish.WriteString(fmt.Sprintf("  set -gx TFVENV_PATH %s\n", escapeFish(envDir)))
-	bufferFish.WriteString("end\n\n")
-
-	// Prepend bin directory to PATH if not already in PATH
-	bufferFish.WriteString("if not contains \"$TFVENV_PATH/bin\" $PATH\n")
-	bufferFish.WriteString("  set -gx PATH \"$TFVENV_PATH/bin\" $PATH\n")
-	bufferFish.WriteString("end\n\n")
+	// The shell no longer uses the environment that was active before
+	bufferFish.WriteString("if set -q TFVENV_ACTIVE_RECORD\n")
+	bufferFish.WriteString("  rm -f \"$TFVENV_ACTIVE_RECORD\"\n")
+	bufferFish.WriteString("end\n")
+
+	// Put bin, then the scripts directory, in front of PATH so the environment's
+	// binaries win, after dropping them and those of a stale activation
+	bufferFish.WriteString(pathDedupeMarker + "\n")
+	bufferFish.WriteString(fmt.Sprintf("set -l tfvenv_drop %s %s\n", escapeFish(filepath.Join(envDir, "bin")), escapeFish(envScriptsDir(envDir))))
+	bufferFish.WriteString("if set -q TFVENV_PATH\n")
+	bufferFish.WriteString("  set tfvenv_drop $tfvenv_drop \"$TFVENV_PATH/bin\" \"$TFVENV_PATH/scripts\"\n")
+	bufferFish.WriteString("end\n")
+	bufferFish.WriteString("set -l tfvenv_keep\n")
+	bufferFish.WriteString("for tfvenv_entry in $PATH\n")
+	bufferFish.WriteString("  if not contains -- $tfvenv_entry $tfvenv_drop\n")
+	bufferFish.WriteString("    set tfvenv_keep $tfvenv_keep $tfvenv_entry\n")
+	bufferFish.WriteString("  end\n")
+	bufferFish.WriteString("end\n")
+	bufferFish.WriteString(fmt.Sprintf("set -gx TFVENV_PATH %s\n", escapeFish(envDir)))
+	bufferFish.WriteString("set -gx PATH \"$TFVENV_PATH/bin\" \"$TFVENV_PATH/scripts\" $tfvenv_keep\n\n")
+
+	// Record this shell as using the environment
+	bufferFish.WriteString(fmt.Sprintf("set -gx TFVENV_ACTIVE_RECORD %s/$fish_pid\n", escapeFish(activeDir)))
+	bufferFish.WriteString(fmt.Sprintf("mkdir -p %s 2>/dev/null; and echo shell > \"$TFVENV_ACTIVE_RECORD\" 2>/dev/null\n\n", escapeFish(activeDir)))
 
 	// Set TFVENV_ENV to the environment name
 	bufferFish.WriteString(fmt.Sprintf("set -gx TFVENV_ENV \"%s\"\n", escapeFish(envName)))
+	bufferFish.WriteString(fmt.Sprintf("set -gx TFVENV_MODULES_DIR %s\n", escapeFish(filepath.Join(envDir, "modules"))))
+	if meta.Workspace != "" {
+		bufferFish.WriteString(fmt.Sprintf("set -gx TF_WORKSPACE %s\n", escapeFish(meta.Workspace)))
+	}
+	bufferFish.WriteString(fmt.Sprintf("set -gx TFVENV_TOOL %s\n", tool))
+	if meta.ReadOnly != nil {
+		bufferFish.WriteString("set -gx TFVENV_READ_ONLY 1\n")
+		for _, binary := range []string{tool, "terragrunt"} {
+			bufferFish.WriteString(fmt.Sprintf("function %s; %s guard %s -- $argv; and command %s $argv; end\n", binary, escapeFish(tfvenvExecutable()), escapeFish(envDir), binary))
+		}
+	}
+	if tool == toolTofu {
+		bufferFish.WriteString("alias terraform tofu\n")
+		bufferFish.WriteString(fmt.Sprintf("set -gx TERRAGRUNT_TFPATH %s\n", escapeFish(envBinaryPath(envDir, toolTofu))))
+	}
+	if hasCLIConfig {
+		bufferFish.WriteString(fmt.Sprintf("set -gx TF_CLI_CONFIG_FILE %s\n", escapeFish(cliConfigPath)))
+	}
+	if config.AWSProfile != "" {
+		bufferFish.WriteString(fmt.Sprintf("set -gx AWS_PROFILE %s\n", escapeFish(config.AWSProfile)))
+	}
+	if config.AWSRegion != "" {
+		bufferFish.WriteString(fmt.Sprintf("set -gx AWS_REGION %s\n", escapeFish(config.AWSRegion)))
+		bufferFish.WriteString(fmt.Sprintf("set -gx AWS_DEFAULT_REGION %s\n", escapeFish(config.AWSRegion)))
+	}
 
 	// Set additional environment variables, avoiding duplicates
-	for key, value := range config.EnvVars {
+	for _, key := range sortedEnvKeys(config.EnvVars) {
+		value := config.EnvVars[key]
+		if isSecretReference(value) {
+			bufferFish.WriteString(fmt.Sprintf("set -gx %s (%s secrets read %s)\n", key, escapeFish(tfvenvExecutable()), escapeFish(value)))
+			continue
+		}
 		bufferFish.WriteString(fmt.Sprintf("set -gx %s %s\n", key, escapeFish(value)))
 	}
 	bufferFish.WriteString("\n")
@@ -2940,7 +4245,7 @@ func generateActivateScript(envDir, envName string, config Config) error {
 	bufferFish.WriteString("echo \"TF_DATA_DIR is set to $TF_DATA_DIR\"\n")
 
 	// Write the Fish activate script
-	err = os.WriteFile(activateFishPath, bufferFish.Bytes(), 0755)
+	err = writeScriptFile(activateFishPath, bufferFish.Bytes())
 	if err != nil {
 		return fmt.Errorf("failed to write activate.fish: %w", err)
 	}
@@ -2956,22 +4261,66 @@ func generateActivateScript(envDir, envName string, config Config) error {
 	bufferPs1.WriteString("    $env:INITIAL_PATH = $env:PATH\n")
 	bufferPs1.WriteString("}\n\n")
 
-	// Set TFVENV_PATH if not already set
-	bufferPs1.WriteString("if (-not (Test-Path Env:TFVENV_PATH)) {\n")
-	bufferPs1.WriteString(fmt.Sprintf("    $env:TFVENV_PATH = \"%s\"\n", escapePowerShell(envDir)))
-	bufferPs1.WriteString("}\n\n")
-
-	// Prepend bin directory to PATH if not already in PATH
+	// The shell no longer uses the environment that was active before
+	bufferPs1.WriteString("if ($env:TFVENV_ACTIVE_RECORD) {\n")
+	bufferPs1.WriteString("    Remove-Item $env:TFVENV_ACTIVE_RECORD -ErrorAction SilentlyContinue\n")
+	bufferPs1.WriteString("}\n")
+
+	// Put bin, then the scripts directory, in front of PATH so the environment's
+	// binaries win, after dropping them and those of a stale activation
+	bufferPs1.WriteString(pathDedupeMarker + "\n")
+	bufferPs1.WriteString(fmt.Sprintf("$tfvenvDrop = @(\"%s\", \"%s\")\n", escapePowerShell(filepath.Join(envDir, "bin")), escapePowerShell(envScriptsDir(envDir))))
+	bufferPs1.WriteString("if ($env:TFVENV_PATH) {\n")
+	bufferPs1.WriteString("    $tfvenvDrop += (Join-Path $env:TFVENV_PATH 'bin'), (Join-Path $env:TFVENV_PATH 'scripts')\n")
+	bufferPs1.WriteString("}\n")
+	bufferPs1.WriteString("$tfvenvKeep = @($env:PATH -split [IO.Path]::PathSeparator | Where-Object { $_ -and ($tfvenvDrop -notcontains $_) })\n")
+	bufferPs1.WriteString(fmt.Sprintf("$env:TFVENV_PATH = \"%s\"\n", escapePowerShell(envDir)))
 	bufferPs1.WriteString("$tfvenvBin = Join-Path $env:TFVENV_PATH 'bin'\n")
-	bufferPs1.WriteString("if (-not ($env:PATH -split ';' | Where-Object { $_ -ieq $tfvenvBin })) {\n")
-	bufferPs1.WriteString("    $env:PATH = \"$tfvenvBin;$env:PATH\"\n")
-	bufferPs1.WriteString("}\n\n")
+	bufferPs1.WriteString("$tfvenvScripts = Join-Path $env:TFVENV_PATH 'scripts'\n")
+	bufferPs1.WriteString("$env:PATH = (@($tfvenvBin, $tfvenvScripts) + $tfvenvKeep) -join [IO.Path]::PathSeparator\n\n")
+
+	// Record this shell as using the environment
+	bufferPs1.WriteString(fmt.Sprintf("$tfvenvActive = \"%s\"\n", escapePowerShell(activeDir)))
+	bufferPs1.WriteString("$env:TFVENV_ACTIVE_RECORD = Join-Path $tfvenvActive $PID\n")
+	bufferPs1.WriteString("New-Item -ItemType Directory -Force -Path $tfvenvActive -ErrorAction SilentlyContinue | Out-Null\n")
+	bufferPs1.WriteString("Set-Content -Path $env:TFVENV_ACTIVE_RECORD -Value 'shell' -ErrorAction SilentlyContinue\n\n")
 
 	// Set TFVENV_ENV to the environment name
-	bufferPs1.WriteString(fmt.Sprintf("$env:TFVENV_ENV = \"%s\"\n\n", escapePowerShell(envName)))
+	bufferPs1.WriteString(fmt.Sprintf("$env:TFVENV_ENV = \"%s\"\n", escapePowerShell(envName)))
+	bufferPs1.WriteString(fmt.Sprintf("$env:TFVENV_MODULES_DIR = \"%s\"\n", escapePowerShell(filepath.Join(envDir, "modules"))))
+	if meta.Workspace != "" {
+		bufferPs1.WriteString(fmt.Sprintf("$env:TF_WORKSPACE = \"%s\"\n", escapePowerShell(meta.Workspace)))
+	}
+	bufferPs1.WriteString(fmt.Sprintf("$env:TFVENV_TOOL = \"%s\"\n", tool))
+	if meta.ReadOnly != nil {
+		bufferPs1.WriteString("$env:TFVENV_READ_ONLY = \"1\"\n")
+		for _, binary := range []string{tool, "terragrunt"} {
+			bufferPs1.WriteString(fmt.Sprintf("function global:%s { & \"%s\" guard \"%s\" -- @args; if ($LASTEXITCODE -eq 0) { & (Get-Command %s -CommandType Application | Select-Object -First 1) @args } }\n", binary, escapePowerShell(tfvenvExecutable()), escapePowerShell(envDir), binary))
+		}
+	}
+	if tool == toolTofu {
+		bufferPs1.WriteString("Set-Alias -Name terraform -Value tofu -Scope Global\n")
+		bufferPs1.WriteString(fmt.Sprintf("$env:TERRAGRUNT_TFPATH = \"%s\"\n", escapePowerShell(envBinaryPath(envDir, toolTofu))))
+	}
+	if hasCLIConfig {
+		bufferPs1.WriteString(fmt.Sprintf("$env:TF_CLI_CONFIG_FILE = \"%s\"\n", escapePowerShell(cliConfigPath)))
+	}
+	if config.AWSProfile != "" {
+		bufferPs1.WriteString(fmt.Sprintf("$env:AWS_PROFILE = \"%s\"\n", escapePowerShell(config.AWSProfile)))
+	}
+	if config.AWSRegion != "" {
+		bufferPs1.WriteString(fmt.Sprintf("$env:AWS_REGION = \"%s\"\n", escapePowerShell(config.AWSRegion)))
+		bufferPs1.WriteString(fmt.Sprintf("$env:AWS_DEFAULT_REGION = \"%s\"\n", escapePowerShell(config.AWSRegion)))
+	}
+	bufferPs1.WriteString("\n")
 
 	// Set additional environment variables, avoiding duplicates
-	for key, value := range config.EnvVars {
+	for _, key := range sortedEnvKeys(config.EnvVars) {
+		value := config.EnvVars[key]
+		if isSecretReference(value) {
+			bufferPs1.WriteString(fmt.Sprintf("$env:%s = (& \"%s\" secrets read \"%s\")\n", key, escapePowerShell(tfvenvExecutable()), escapePowerShell(value)))
+			continue
+		}
 		bufferPs1.WriteString(fmt.Sprintf("$env:%s = \"%s\"\n", key, escapePowerShell(value)))
 	}
 	bufferPs1.WriteString("\n")
@@ -2995,7 +4344,7 @@ func generateActivateScript(envDir, envName string, config Config) error {
 	bufferPs1.WriteString("Write-Output \"TF_DATA_DIR is set to $env:TF_DATA_DIR\"\n")
 
 	// Write the PowerShell activate script
-	err = os.WriteFile(activatePs1Path, bufferPs1.Bytes(), 0755)
+	err = writeScriptFile(activatePs1Path, bufferPs1.Bytes())
 	if err != nil {
 		return fmt.Errorf("failed to write Activate.ps1: %w", err)
 	}
@@ -3022,14 +4371,36 @@ func generateDeactivateScript(envDir string, config Config) error {
 	bufferBash.WriteString("  unset INITIAL_PATH\n")
 	bufferBash.WriteString("fi\n\n")
 
-	// Unset TFVENV_PATH
-	bufferBash.WriteString("unset TFVENV_PATH\n")
-
-	// Unset TFVENV_ENV
-	bufferBash.WriteString("unset TFVENV_ENV\n\n")
+	// Stop recording this shell as using the environment, then unset TFVENV_PATH
+	bufferBash.WriteString("if [ -n \"$TFVENV_ACTIVE_RECORD\" ]; then\n")
+	bufferBash.WriteString("  rm -f \"$TFVENV_ACTIVE_RECORD\"\n")
+	bufferBash.WriteString("fi\n")
+	bufferBash.WriteString("unset TFVENV_ACTIVE_RECORD TFVENV_PATH\n")
+
+	// Unset TFVENV_ENV and the recorded workspace
+	bufferBash.WriteString("unset TFVENV_ENV\n")
+	bufferBash.WriteString("unset TFVENV_MODULES_DIR\n")
+	bufferBash.WriteString("unset TF_WORKSPACE\n")
+	bufferBash.WriteString("unset TF_CLI_CONFIG_FILE\n")
+	bufferBash.WriteString("if [ \"$TFVENV_TOOL\" = \"tofu\" ]; then\n")
+	bufferBash.WriteString("  unalias terraform 2>/dev/null\n")
+	bufferBash.WriteString("  unset TERRAGRUNT_TFPATH\n")
+	bufferBash.WriteString("fi\n")
+	bufferBash.WriteString("if [ -n \"$TFVENV_READ_ONLY\" ]; then\n")
+	bufferBash.WriteString("  unset -f terraform tofu terragrunt 2>/dev/null\n")
+	bufferBash.WriteString("  unset TFVENV_READ_ONLY\n")
+	bufferBash.WriteString("fi\n")
+	bufferBash.WriteString("unset TFVENV_TOOL\n")
+	if config.AWSProfile != "" {
+		bufferBash.WriteString("unset AWS_PROFILE\n")
+	}
+	if config.AWSRegion != "" {
+		bufferBash.WriteString("unset AWS_REGION AWS_DEFAULT_REGION\n")
+	}
+	bufferBash.WriteString("\n")
 
 	// Unset additional environment variables
-	for key := range config.EnvVars {
+	for _, key := range sortedEnvKeys(config.EnvVars) {
 		bufferBash.WriteString(fmt.Sprintf("unset %s\n", key))
 	}
 	bufferBash.WriteString("\n")
@@ -3044,7 +4415,7 @@ func generateDeactivateScript(envDir string, config Config) error {
 	bufferBash.WriteString("# Environment deactivated.\n")
 
 	// Write the Bash/Zsh deactivate script
-	err := os.WriteFile(deactivateShPath, bufferBash.Bytes(), 0755)
+	err := writeScriptFile(deactivateShPath, bufferBash.Bytes())
 	if err != nil {
 		return fmt.Errorf("failed to write deactivate.sh: %w", err)
 	}
@@ -3062,14 +4433,38 @@ func generateDeactivateScript(envDir string, config Config) error {
 	bufferFish.WriteString("    set -e INITIAL_PATH\n")
 	bufferFish.WriteString("end\n\n")
 
-	// Unset TFVENV_PATH
+	// Stop recording this shell as using the environment, then unset TFVENV_PATH
+	bufferFish.WriteString("if set -q TFVENV_ACTIVE_RECORD\n")
+	bufferFish.WriteString("    rm -f \"$TFVENV_ACTIVE_RECORD\"\n")
+	bufferFish.WriteString("end\n")
+	bufferFish.WriteString("set -e TFVENV_ACTIVE_RECORD\n")
 	bufferFish.WriteString("set -e TFVENV_PATH\n")
 
-	// Unset TFVENV_ENV
-	bufferFish.WriteString("set -e TFVENV_ENV\n\n")
+	// Unset TFVENV_ENV and the recorded workspace
+	bufferFish.WriteString("set -e TFVENV_ENV\n")
+	bufferFish.WriteString("set -e TFVENV_MODULES_DIR\n")
+	bufferFish.WriteString("set -e TF_WORKSPACE\n")
+	bufferFish.WriteString("set -e TF_CLI_CONFIG_FILE\n")
+	bufferFish.WriteString("if test \"$TFVENV_TOOL\" = tofu\n")
+	bufferFish.WriteString("  functions -e terraform\n")
+	bufferFish.WriteString("  set -e TERRAGRUNT_TFPATH\n")
+	bufferFish.WriteString("end\n")
+	bufferFish.WriteString("if set -q TFVENV_READ_ONLY\n")
+	bufferFish.WriteString("  functions -e terraform tofu terragrunt\n")
+	bufferFish.WriteString("  set -e TFVENV_READ_ONLY\n")
+	bufferFish.WriteString("end\n")
+	bufferFish.WriteString("set -e TFVENV_TOOL\n")
+	if config.AWSProfile != "" {
+		bufferFish.WriteString("set -e AWS_PROFILE\n")
+	}
+	if config.AWSRegion != "" {
+		bufferFish.WriteString("set -e AWS_REGION\n")
+		bufferFish.WriteString("set -e AWS_DEFAULT_REGION\n")
+	}
+	bufferFish.WriteString("\n")
 
 	// Unset additional environment variables
-	for key := range config.EnvVars {
+	for _, key := range sortedEnvKeys(config.EnvVars) {
 		bufferFish.WriteString(fmt.Sprintf("set -e %s\n", key))
 	}
 	bufferFish.WriteString("\n")
@@ -3087,7 +4482,7 @@ func generateDeactivateScript(envDir string, config Config) error {
 	bufferFish.WriteString("# Environment deactivated.\n")
 
 	// Write the Fish deactivate script
-	err = os.WriteFile(deactivateFishPath, bufferFish.Bytes(), 0755)
+	err = writeScriptFile(deactivateFishPath, bufferFish.Bytes())
 	if err != nil {
 		return fmt.Errorf("failed to write deactivate.fish: %w", err)
 	}
@@ -3104,14 +4499,38 @@ func generateDeactivateScript(envDir string, config Config) error {
 	bufferPs1.WriteString("    Remove-Item Env:INITIAL_PATH\n")
 	bufferPs1.WriteString("}\n\n")
 
-	// Unset TFVENV_PATH
+	// Stop recording this shell as using the environment, then unset TFVENV_PATH
+	bufferPs1.WriteString("if ($env:TFVENV_ACTIVE_RECORD) {\n")
+	bufferPs1.WriteString("    Remove-Item $env:TFVENV_ACTIVE_RECORD -ErrorAction SilentlyContinue\n")
+	bufferPs1.WriteString("    Remove-Item Env:TFVENV_ACTIVE_RECORD\n")
+	bufferPs1.WriteString("}\n")
 	bufferPs1.WriteString("Remove-Item Env:TFVENV_PATH\n")
 
-	// Unset TFVENV_ENV
-	bufferPs1.WriteString("Remove-Item Env:TFVENV_ENV\n\n")
+	// Unset TFVENV_ENV and the recorded workspace
+	bufferPs1.WriteString("Remove-Item Env:TFVENV_ENV\n")
+	bufferPs1.WriteString("Remove-Item Env:TFVENV_MODULES_DIR -ErrorAction SilentlyContinue\n")
+	bufferPs1.WriteString("Remove-Item Env:TF_WORKSPACE -ErrorAction SilentlyContinue\n")
+	bufferPs1.WriteString("Remove-Item Env:TF_CLI_CONFIG_FILE -ErrorAction SilentlyContinue\n")
+	bufferPs1.WriteString("if ($env:TFVENV_TOOL -eq \"tofu\") {\n")
+	bufferPs1.WriteString("    Remove-Item Alias:terraform -ErrorAction SilentlyContinue\n")
+	bufferPs1.WriteString("    Remove-Item Env:TERRAGRUNT_TFPATH -ErrorAction SilentlyContinue\n")
+	bufferPs1.WriteString("}\n")
+	bufferPs1.WriteString("if (Test-Path Env:TFVENV_READ_ONLY) {\n")
+	bufferPs1.WriteString("    Remove-Item Function:terraform, Function:tofu, Function:terragrunt -ErrorAction SilentlyContinue\n")
+	bufferPs1.WriteString("    Remove-Item Env:TFVENV_READ_ONLY\n")
+	bufferPs1.WriteString("}\n")
+	bufferPs1.WriteString("Remove-Item Env:TFVENV_TOOL -ErrorAction SilentlyContinue\n")
+	if config.AWSProfile != "" {
+		bufferPs1.WriteString("Remove-Item Env:AWS_PROFILE -ErrorAction SilentlyContinue\n")
+	}
+	if config.AWSRegion != "" {
+		bufferPs1.WriteString("Remove-Item Env:AWS_REGION -ErrorAction SilentlyContinue\n")
+		bufferPs1.WriteString("Remove-Item Env:AWS_DEFAULT_REGION -ErrorAction SilentlyContinue\n")
+	}
+	bufferPs1.WriteString("\n")
 
 	// Unset additional environment variables
-	for key := range config.EnvVars {
+	for _, key := range sortedEnvKeys(config.EnvVars) {
 		bufferPs1.WriteString(fmt.Sprintf("Remove-Item Env:%s\n", key))
 	}
 	bufferPs1.WriteString("\n")
@@ -3126,7 +4545,7 @@ func generateDeactivateScript(envDir string, config Config) error {
 	bufferPs1.WriteString("# Environment deactivated.\n")
 
 	// Write the PowerShell deactivate script
-	err = os.WriteFile(deactivatePs1Path, bufferPs1.Bytes(), 0755)
+	err = writeScriptFile(deactivatePs1Path, bufferPs1.Bytes())
 	if err != nil {
 		return fmt.Errorf("failed to write Deactivate.ps1: %w", err)
 	}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"tfvenv/i18n"
+	"tfvenv/snaps"
+)
+
+// maintainReport is the JSON report written by maintain.
+type maintainReport struct {
+	StartedAt  time.Time      `json:"started_at"`
+	FinishedAt time.Time      `json:"finished_at"`
+	DryRun     bool           `json:"dry_run"`
+	Tasks      []maintainTask `json:"tasks"`
+}
+
+// maintainTask is the outcome of one housekeeping task. Items lists what was
+// refreshed or removed, or would be with --dry-run.
+type maintainTask struct {
+	Name   string   `json:"name"`
+	Status string   `json:"status"`
+	Detail string   `json:"detail,omitempty"`
+	Items  []string `json:"items,omitempty"`
+}
+
+// Outcomes of a maintenance task.
+const (
+	maintainOK      = "ok"
+	maintainSkipped = "skipped"
+	maintainFailed  = "failed"
+)
+
+// maintainCmd runs the housekeeping a build host needs, in one cron-friendly command.
+func maintainCmd() *cobra.Command {
+	var dryRun bool
+	var lockTTL, snapOlderThan time.Duration
+	var snapKeep int
+	var reportPath string
+	var expiredAction string
+	var expiryWarning time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "maintain",
+		Short: "Refresh version caches, prune caches, expire stale locks and apply snap retention",
+		Long: `Run the housekeeping of a build host in one command, e.g. from cron:
+
+  versions      look up the latest Terraform, OpenTofu and Terragrunt releases
+                and cache them for offline use of "latest"
+  plugin-cache  remove duplicate provider plugins and plugins no environment uses
+  locks         remove environment locks older than --lock-ttl
+  snaps         remove local snaps per --snap-keep and --snap-older-than
+  expiry        warn about environments created with --expires that expire
+                soon; warn about, archive or delete expired ones per
+                --expired-action, after taking a final snap
+
+A JSON report is printed, or written to --report. The command exits non-zero
+when a task fails; the other tasks still run.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			envDir := viper.GetString("env-dir")
+			if err := validateExpiredAction(expiredAction); err != nil {
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			report := maintainReport{StartedAt: time.Now().UTC(), DryRun: dryRun}
+
+			envNames, err := listEnvironmentDirs(envDir)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				logger.Errorf("error listing environments: %v", err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+
+			report.Tasks = append(report.Tasks,
+				maintainVersions(dryRun),
+				maintainPluginCache(envDir, envNames, dryRun),
+				maintainLocks(envDir, envNames, lockTTL, dryRun),
+				maintainSnaps(envDir, envNames, snapKeep, snapOlderThan, dryRun),
+				maintainExpiry(envDir, envNames, expiredAction, expiryWarning, dryRun),
+			)
+			report.FinishedAt = time.Now().UTC()
+
+			data, _ := json.MarshalIndent(report, "", "  ")
+			if reportPath == "" || reportPath == "-" {
+				fmt.Println(string(data))
+			} else if err := os.WriteFile(reportPath, append(data, '\n'), 0644); err != nil {
+				logger.Errorf("error writing %s: %v", reportPath, err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+
+			failed := 0
+			for _, task := range report.Tasks {
+				if task.Status == maintainFailed {
+					logger.Errorf("maintenance task %s failed: %s", task.Name, task.Detail)
+					failed++
+				}
+			}
+			if failed > 0 {
+				os.Exit(1)
+			}
+			logger.Infof("maintenance completed for %d environment(s)", len(envNames))
+		},
+	}
+
+	addDryRunFlag(cmd, &dryRun)
+	cmd.Flags().DurationVar(&lockTTL, "lock-ttl", 24*time.Hour, "Remove environment locks older than this (0 keeps every lock)")
+	cmd.Flags().IntVar(&snapKeep, "snap-keep", 0, "Number of newest local snaps to keep per environment")
+	cmd.Flags().DurationVar(&snapOlderThan, "snap-older-than", 0, "Only remove local snaps older than this (e.g. 720h)")
+	cmd.Flags().StringVar(&expiredAction, "expired-action", expiredWarn, "What to do with expired environments: warn, archive or delete")
+	cmd.Flags().DurationVar(&expiryWarning, "expiry-warning", 24*time.Hour, "Warn about environments that expire within this")
+	cmd.Flags().StringVar(&reportPath, "report", "", "Write the JSON report to this file instead of stdout")
+	return cmd
+}
+
+// maintainVersions refreshes the cached latest version and recent releases of
+// every tool, which shell completion offers for --tf-version and --tg-version.
+func maintainVersions(dryRun bool) maintainTask {
+	task := maintainTask{Name: "versions", Status: maintainOK}
+	if dryRun {
+		task.Status = maintainSkipped
+		task.Detail = "dry run"
+		return task
+	}
+	var failures []string
+	for _, tool := range []string{toolTerraform, toolTofu, "terragrunt"} {
+		latest, err := fetchLatestVersion(tool, false)
+		if err == nil {
+			err = recordLatestVersion(tool, latest)
+		}
+		if err == nil {
+			_, err = refreshReleases(tool)
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", tool, err))
+			continue
+		}
+		task.Items = append(task.Items, fmt.Sprintf("%s %s", tool, latest))
+	}
+	if len(failures) > 0 {
+		task.Status = maintainFailed
+		task.Detail = fmt.Sprintf("%d lookup(s) failed: %v", len(failures), failures)
+		return task
+	}
+	task.Detail = fmt.Sprintf("cached in %s", versionCachePath())
+	return task
+}
+
+// maintainPluginCache removes duplicate provider plugins, and plugins that no
+// environment under envDir uses.
+func maintainPluginCache(envDir string, envNames []string, dryRun bool) maintainTask {
+	task := maintainTask{Name: "plugin-cache", Status: maintainOK}
+	pluginCacheDir := defaultPluginCacheDir()
+	if _, err := os.Stat(pluginCacheDir); os.IsNotExist(err) {
+		task.Status = maintainSkipped
+		task.Detail = fmt.Sprintf("%s does not exist", pluginCacheDir)
+		return task
+	}
+
+	removed, err := cleanDuplicateProviders(pluginCacheDir, dryRun)
+	task.Items = append(task.Items, removed...)
+	if err != nil {
+		task.Status = maintainFailed
+		task.Detail = err.Error()
+		return task
+	}
+
+	// Without environments every plugin would count as unused
+	if len(envNames) == 0 {
+		task.Detail = fmt.Sprintf("%d duplicate(s); no environments, unused plugins kept", len(removed))
+		return task
+	}
+	var envPaths []string
+	for _, name := range envNames {
+		envPaths = append(envPaths, filepath.Join(envDir, name))
+	}
+	used, err := usedProviders(defaultParallelism, envPaths...)
+	if err == nil {
+		var unused []string
+		unused, err = cleanUnusedProviders(pluginCacheDir, used, dryRun)
+		task.Items = append(task.Items, unused...)
+		task.Detail = fmt.Sprintf("%d duplicate(s), %d unused", len(removed), len(unused))
+	}
+	if err != nil {
+		task.Status = maintainFailed
+		task.Detail = err.Error()
+	}
+	return task
+}
+
+// maintainLocks removes environment locks older than ttl, left behind by
+// crashed or killed runs.
+func maintainLocks(envDir string, envNames []string, ttl time.Duration, dryRun bool) maintainTask {
+	task := maintainTask{Name: "locks", Status: maintainOK}
+	if ttl <= 0 {
+		task.Status = maintainSkipped
+		task.Detail = "--lock-ttl is 0"
+		return task
+	}
+	var failures []string
+	for _, name := range envNames {
+		envPath := filepath.Join(envDir, name)
+		info, err := os.Stat(filepath.Join(envPath, lockFileName))
+		if err != nil || time.Since(info.ModTime()) < ttl {
+			continue
+		}
+		item := fmt.Sprintf("%s (locked since %s)", name, info.ModTime().UTC().Format(time.RFC3339))
+		if !dryRun {
+			if err := releaseEnvLock(envPath); err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %v", name, err))
+				continue
+			}
+			logger.Infof("expired stale lock of %s", name)
+		}
+		task.Items = append(task.Items, item)
+	}
+	task.Detail = fmt.Sprintf("%d lock(s) older than %s", len(task.Items), ttl)
+	if len(failures) > 0 {
+		task.Status = maintainFailed
+		task.Detail = fmt.Sprintf("%d lock(s) could not be removed: %v", len(failures), failures)
+	}
+	return task
+}
+
+// maintainSnaps applies the snap retention policy to every environment.
+func maintainSnaps(envDir string, envNames []string, keep int, olderThan time.Duration, dryRun bool) maintainTask {
+	task := maintainTask{Name: "snaps", Status: maintainOK}
+	if keep <= 0 && olderThan <= 0 {
+		task.Status = maintainSkipped
+		task.Detail = "no retention policy (--snap-keep, --snap-older-than)"
+		return task
+	}
+	var failures []string
+	now := time.Now()
+	for _, name := range envNames {
+		files, err := snaps.ListSnapFiles(filepath.Join(envDir, name))
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", name, err))
+			continue
+		}
+		for _, file := range snaps.PruneCandidates(files, keep, olderThan, now) {
+			if !dryRun {
+				if err := snaps.RemoveSnap(file.Path); err != nil {
+					failures = append(failures, fmt.Sprintf("%s: %v", file.Path, err))
+					continue
+				}
+				logger.Infof("Pruned snap '%s' from '%s'.", file.Name, file.Path)
+			}
+			task.Items = append(task.Items, file.Path)
+		}
+	}
+	task.Detail = fmt.Sprintf("%d snap(s) past retention", len(task.Items))
+	if len(failures) > 0 {
+		task.Status = maintainFailed
+		task.Detail = fmt.Sprintf("%d snap(s) could not be pruned: %v", len(failures), failures)
+	}
+	return task
+}
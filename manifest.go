@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	version "github.com/hashicorp/go-version"
+	yaml "gopkg.in/yaml.v3"
+
+	"tfvenv/schemas"
+)
+
+// manifestFileName is the project-level manifest declaring a repository's environments.
+const manifestFileName = "tfvenv.yaml"
+
+// manifest is the content of tfvenv.yaml.
+type manifest struct {
+	// EnvDir holds the environments without an explicit path, relative to the manifest.
+	EnvDir       string        `yaml:"env_dir"`
+	Environments []manifestEnv `yaml:"environments"`
+}
+
+// manifestEnv declares one environment.
+type manifestEnv struct {
+	Name      string            `yaml:"name"`
+	Path      string            `yaml:"path"`
+	Tool      string            `yaml:"tool"`
+	TfVersion string            `yaml:"tf_version"`
+	TgVersion string            `yaml:"tg_version"`
+	Backend   manifestBackend   `yaml:"backend"`
+	EnvVars   map[string]string `yaml:"env_vars"`
+	// Groups name sets of environments handled together, such as prod
+	Groups []string `yaml:"groups"`
+}
+
+// manifestBackend declares an environment's S3 backend.
+type manifestBackend struct {
+	Bucket        string `yaml:"bucket"`
+	Path          string `yaml:"path"`
+	Region        string `yaml:"region"`
+	DynamoDBTable string `yaml:"dynamodb_table"`
+}
+
+// findManifest looks for tfvenv.yaml in dir and its parents.
+func findManifest(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		path := filepath.Join(dir, manifestFileName)
+		if fileExists(path) {
+			return path, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("no %s found in the current directory or its parents", manifestFileName)
+		}
+		dir = parent
+	}
+}
+
+// resolveManifestPath returns the manifest given by --manifest, or the nearest one.
+func resolveManifestPath(flagValue string) (string, error) {
+	if flagValue != "" {
+		return filepath.Abs(flagValue)
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	return findManifest(cwd)
+}
+
+// loadManifest reads and validates a manifest. Unknown keys are rejected so
+// that typos do not go unnoticed.
+func loadManifest(path string) (manifest, error) {
+	var m manifest
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return m, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if err := schemas.ValidateYAML(schemas.Manifest, data); err != nil {
+		return m, fmt.Errorf("%s %w", path, err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&m); err != nil {
+		return m, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	seen := make(map[string]bool)
+	for i, env := range m.Environments {
+		if env.Name == "" {
+			return m, fmt.Errorf("%s: environment %d has no name", path, i+1)
+		}
+		if seen[env.Name] {
+			return m, fmt.Errorf("%s: environment %s is declared twice", path, env.Name)
+		}
+		seen[env.Name] = true
+		if err := env.validate(); err != nil {
+			return m, fmt.Errorf("%s: environment %s: %w", path, env.Name, err)
+		}
+	}
+	return m, nil
+}
+
+// validate checks the tool and versions an environment declares.
+func (env manifestEnv) validate() error {
+	if err := validateTool(env.Tool); err != nil {
+		return err
+	}
+	for key, value := range map[string]string{"tf_version": env.TfVersion, "tg_version": env.TgVersion} {
+		if value == "" || value == "latest" || (value == "none" && key == "tg_version") {
+			continue
+		}
+		if _, err := version.NewVersion(value); err != nil {
+			return fmt.Errorf("%s %q is not a valid version", key, value)
+		}
+	}
+	return nil
+}
+
+// inGroup reports whether the environment belongs to group. Every
+// environment belongs to "all".
+func (env manifestEnv) inGroup(group string) bool {
+	if group == "all" {
+		return true
+	}
+	for _, g := range env.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// envPath returns where a declared environment lives.
+func (m manifest) envPath(manifestPath string, env manifestEnv) string {
+	base := filepath.Dir(manifestPath)
+	if env.Path != "" {
+		if filepath.IsAbs(env.Path) {
+			return env.Path
+		}
+		return filepath.Join(base, env.Path)
+	}
+	return filepath.Join(base, m.EnvDir, env.Name)
+}
+
+// configValues returns the .tfvenvrc keys the manifest declares for env.
+func (env manifestEnv) configValues() map[string]string {
+	values := map[string]string{
+		"TOOL":            env.Tool,
+		"TF_VERSION":      env.TfVersion,
+		"TG_VERSION":      env.TgVersion,
+		"S3_STATE_BUCKET": env.Backend.Bucket,
+		"S3_STATE_PATH":   env.Backend.Path,
+		"REGION":          env.Backend.Region,
+		"DYNAMODB_TABLE":  env.Backend.DynamoDBTable,
+	}
+	if len(env.EnvVars) > 0 {
+		var pairs []string
+		for _, key := range sortedEnvKeys(env.EnvVars) {
+			pairs = append(pairs, key+"="+env.EnvVars[key])
+		}
+		values["ENV_VARS"] = strings.Join(pairs, ",")
+	}
+	for key, value := range values {
+		if value == "" {
+			delete(values, key)
+		}
+	}
+	return values
+}
+
+// applyTo overrides config with the values the manifest declares for env.
+func (env manifestEnv) applyTo(config Config) Config {
+	set := func(target *string, value string) {
+		if value != "" {
+			*target = value
+		}
+	}
+	set(&config.Tool, env.Tool)
+	set(&config.TfVersion, env.TfVersion)
+	set(&config.TgVersion, env.TgVersion)
+	set(&config.S3StateBucket, env.Backend.Bucket)
+	set(&config.S3StatePath, env.Backend.Path)
+	set(&config.Region, env.Backend.Region)
+	set(&config.DynamoDBTable, env.Backend.DynamoDBTable)
+	if len(env.EnvVars) > 0 {
+		config.EnvVars = env.EnvVars
+	}
+	return config
+}
+
+// writeConfigValues sets keys in a .tfvenvrc, keeping its other lines and
+// comments, and appends the keys it does not have yet. It returns the keys
+// whose value changed.
+func writeConfigValues(configPath string, values map[string]string) ([]string, error) {
+	var lines []string
+	content, err := os.ReadFile(configPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s: %w", configPath, err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	var changed []string
+	written := make(map[string]bool)
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		parts := strings.SplitN(trimmed, "=", 2)
+		key := strings.TrimSpace(parts[0])
+		value, ok := values[key]
+		if !ok {
+			continue
+		}
+		written[key] = true
+		current := ""
+		if len(parts) == 2 {
+			current = strings.Trim(strings.TrimSpace(parts[1]), `"'`)
+		}
+		if current != value {
+			lines[i] = key + "=" + value
+			changed = append(changed, key)
+		}
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		if !written[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		lines = append(lines, key+"="+values[key])
+		changed = append(changed, key)
+	}
+	if len(changed) == 0 {
+		return nil, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", filepath.Dir(configPath), err)
+	}
+	if err := writeSecretFile(configPath, []byte(strings.Join(lines, "\n")+"\n")); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", configPath, err)
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"golang.org/x/term"
+)
+
+// Strategies merge uses for attributes and blocks that the template and the
+// environment file define differently.
+const (
+	mergeOurs        = "ours"        // keep the environment's definition
+	mergeTheirs      = "theirs"      // take the template's definition
+	mergeInteractive = "interactive" // ask for each conflict
+)
+
+// mergeStrategies lists the strategies in the order they are documented.
+var mergeStrategies = []string{mergeOurs, mergeTheirs, mergeInteractive}
+
+// mergeConflict is a top-level attribute or block that the template and the
+// environment file both define, differently.
+type mergeConflict struct {
+	File   string
+	Name   string // attribute name, or block type and labels
+	Ours   string // the environment's definition
+	Theirs string // the template's definition
+}
+
+// mergeResult lists what a merge changed in one file.
+type mergeResult struct {
+	Added  []string // attributes and blocks taken from the template
+	Ours   []string // conflicts resolved to the environment's definition
+	Theirs []string // conflicts resolved to the template's definition
+}
+
+// conflictResolver decides a conflict, returning true to take the template's definition.
+type conflictResolver func(conflict mergeConflict) (bool, error)
+
+// validateMergeStrategy rejects unknown strategies.
+func validateMergeStrategy(strategy string) error {
+	for _, known := range mergeStrategies {
+		if strategy == known {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown merge strategy %q (use %s)", strategy, strings.Join(mergeStrategies, ", "))
+}
+
+// newConflictResolver returns the resolver for a strategy. The interactive
+// one needs a terminal.
+func newConflictResolver(strategy string) (conflictResolver, error) {
+	switch strategy {
+	case mergeOurs:
+		return func(mergeConflict) (bool, error) { return false, nil }, nil
+	case mergeTheirs:
+		return func(mergeConflict) (bool, error) { return true, nil }, nil
+	case mergeInteractive:
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return nil, fmt.Errorf("--strategy %s needs a terminal; use %s or %s", mergeInteractive, mergeOurs, mergeTheirs)
+		}
+		return promptConflictResolver(bufio.NewReader(os.Stdin)), nil
+	}
+	return nil, validateMergeStrategy(strategy)
+}
+
+// promptConflictResolver shows each conflict and asks which side to keep.
+func promptConflictResolver(in *bufio.Reader) conflictResolver {
+	return func(conflict mergeConflict) (bool, error) {
+		fmt.Printf("\nConflict in %s: %s\n", conflict.File, conflict.Name)
+		fmt.Println("  environment (ours):")
+		fmt.Println(indentLines(conflict.Ours, "    "))
+		fmt.Println("  template (theirs):")
+		fmt.Println(indentLines(conflict.Theirs, "    "))
+		for {
+			fmt.Print("Keep [o]urs or take [t]heirs? ")
+			answer, err := in.ReadString('\n')
+			switch strings.ToLower(strings.TrimSpace(answer)) {
+			case "o", "ours":
+				return false, nil
+			case "t", "theirs":
+				return true, nil
+			}
+			if err == io.EOF {
+				return false, fmt.Errorf("no answer for %s in %s", conflict.Name, conflict.File)
+			}
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+}
+
+// indentLines prefixes every line of text.
+func indentLines(text, prefix string) string {
+	return prefix + strings.ReplaceAll(text, "\n", "\n"+prefix)
+}
+
+// mergeHCL merges the top-level attributes and blocks of a template into an
+// environment file. Those the environment lacks are appended, and those both
+// define differently are settled by resolve. Blocks are matched by type and
+// labels; a block taken from the template moves to the end of the file.
+func mergeHCL(name string, templateContent, envContent []byte, resolve conflictResolver) ([]byte, mergeResult, error) {
+	var result mergeResult
+	if err := hclParseError(name, templateContent, envContent); err != nil {
+		return nil, result, err
+	}
+	templateFile, _ := hclwrite.ParseConfig(templateContent, name+".template", hcl.InitialPos)
+	envFile, _ := hclwrite.ParseConfig(envContent, name, hcl.InitialPos)
+	envBody := envFile.Body()
+
+	for _, attrName := range attributeOrder(templateContent, templateFile.Body()) {
+		theirs := templateFile.Body().GetAttribute(attrName).Expr().BuildTokens(nil)
+		ours := envBody.GetAttribute(attrName)
+		if ours == nil {
+			envBody.SetAttributeRaw(attrName, theirs)
+			result.Added = append(result.Added, attrName)
+			continue
+		}
+		oursTokens := ours.Expr().BuildTokens(nil)
+		if normalizedTokens(oursTokens) == normalizedTokens(theirs) {
+			continue
+		}
+		takeTheirs, err := resolve(mergeConflict{
+			File:   name,
+			Name:   attrName,
+			Ours:   attrName + " = " + normalizedTokens(oursTokens),
+			Theirs: attrName + " = " + normalizedTokens(theirs),
+		})
+		if err != nil {
+			return nil, result, err
+		}
+		if takeTheirs {
+			envBody.SetAttributeRaw(attrName, theirs)
+			result.Theirs = append(result.Theirs, attrName)
+		} else {
+			result.Ours = append(result.Ours, attrName)
+		}
+	}
+
+	for _, block := range templateFile.Body().Blocks() {
+		blockName := strings.TrimSpace(block.Type() + " " + strings.Join(quoteLabels(block.Labels()), " "))
+		theirs := block.BuildTokens(nil)
+		ours := envBody.FirstMatchingBlock(block.Type(), block.Labels())
+		if ours == nil {
+			envBody.AppendNewline()
+			envBody.AppendUnstructuredTokens(theirs)
+			result.Added = append(result.Added, blockName)
+			continue
+		}
+		oursTokens := ours.BuildTokens(nil)
+		if normalizedTokens(oursTokens) == normalizedTokens(theirs) {
+			continue
+		}
+		takeTheirs, err := resolve(mergeConflict{
+			File:   name,
+			Name:   blockName,
+			Ours:   normalizedTokens(oursTokens),
+			Theirs: normalizedTokens(theirs),
+		})
+		if err != nil {
+			return nil, result, err
+		}
+		if takeTheirs {
+			envBody.RemoveBlock(ours)
+			envBody.AppendNewline()
+			envBody.AppendUnstructuredTokens(theirs)
+			result.Theirs = append(result.Theirs, blockName)
+		} else {
+			result.Ours = append(result.Ours, blockName)
+		}
+	}
+	return envFile.Bytes(), result, nil
+}
+
+// attributeOrder returns the names of a body's attributes in the order they
+// appear in src.
+func attributeOrder(src []byte, body *hclwrite.Body) []string {
+	attrs := body.Attributes()
+	names := make([]string, 0, len(attrs))
+	for name := range attrs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	parsed, diags := hclsyntax.ParseConfig(src, "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return names
+	}
+	syntaxBody, ok := parsed.Body.(*hclsyntax.Body)
+	if !ok {
+		return names
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		a, b := syntaxBody.Attributes[names[i]], syntaxBody.Attributes[names[j]]
+		if a == nil || b == nil {
+			return false
+		}
+		return a.SrcRange.Start.Byte < b.SrcRange.Start.Byte
+	})
+	return names
+}
+
+// normalizedTokens renders tokens in canonical formatting, so definitions
+// that differ only in whitespace compare equal.
+func normalizedTokens(tokens hclwrite.Tokens) string {
+	return string(bytes.TrimSpace(hclwrite.Format(tokens.Bytes())))
+}
+
+// quoteLabels quotes block labels as they are written in HCL.
+func quoteLabels(labels []string) []string {
+	quoted := make([]string, len(labels))
+	for i, label := range labels {
+		quoted[i] = fmt.Sprintf("%q", label)
+	}
+	return quoted
+}
+
+// hclParseError reports a template or environment file that is not valid
+// HCL, and so cannot be merged attribute by attribute.
+func hclParseError(name string, templateContent, envContent []byte) error {
+	if _, diags := hclwrite.ParseConfig(templateContent, name+".template", hcl.InitialPos); diags.HasErrors() {
+		return fmt.Errorf("template of %s is not valid HCL: %s", name, diags.Error())
+	}
+	if _, diags := hclwrite.ParseConfig(envContent, name, hcl.InitialPos); diags.HasErrors() {
+		return fmt.Errorf("%s is not valid HCL: %s", name, diags.Error())
+	}
+	return nil
+}
+
+// listOrNone joins names for display, or returns "none".
+func listOrNone(names []string) string {
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const metadataFileName = "metadata.json"
+
+// EnvironmentMetadata holds tfvenv-managed settings recorded alongside an environment.
+type EnvironmentMetadata struct {
+	Workspace string                `json:"workspace,omitempty"`
+	Modules   map[string]ModuleLock `json:"modules,omitempty"`
+	Tool      string                `json:"tool,omitempty"`
+	ReadOnly  *readOnlyLock         `json:"read_only,omitempty"`
+	ExpiresAt *time.Time            `json:"expires_at,omitempty"`
+	CreatedBy string                `json:"created_by,omitempty"`
+	// Tools maps the custom tools installed from tools.yaml to their version.
+	Tools map[string]string `json:"tools,omitempty"`
+	// TemplateSource records the repository the templates are synced from.
+	TemplateSource *templateSource `json:"template_source,omitempty"`
+	// TerraformOnly is set for environments created without Terragrunt, and
+	// cleared once Terragrunt is installed.
+	TerraformOnly bool `json:"terraform_only,omitempty"`
+}
+
+// loadEnvMetadata reads the environment's metadata file. A missing file yields empty metadata.
+func loadEnvMetadata(envPath string) (EnvironmentMetadata, error) {
+	var meta EnvironmentMetadata
+
+	data, err := os.ReadFile(filepath.Join(envPath, metadataFileName))
+	if os.IsNotExist(err) {
+		return meta, nil
+	}
+	if err != nil {
+		return meta, fmt.Errorf("failed to read environment metadata: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, fmt.Errorf("failed to parse environment metadata: %w", err)
+	}
+	return meta, nil
+}
+
+// saveEnvMetadata writes the environment's metadata file.
+func saveEnvMetadata(envPath string, meta EnvironmentMetadata) error {
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal environment metadata: %w", err)
+	}
+
+	metaPath := filepath.Join(envPath, metadataFileName)
+	if err := os.WriteFile(metaPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write environment metadata to %s: %w", metaPath, err)
+	}
+	summary.fileWritten(metaPath)
+	return nil
+}
+
+// updateEnvMetadata loads the environment's metadata, applies fn, and saves the result.
+func updateEnvMetadata(envPath string, fn func(meta *EnvironmentMetadata)) error {
+	meta, err := loadEnvMetadata(envPath)
+	if err != nil {
+		return err
+	}
+	fn(&meta)
+	return saveEnvMetadata(envPath, meta)
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// downloadDurationBuckets are the histogram bucket bounds, in seconds, for tool downloads.
+var downloadDurationBuckets = []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+// processMetrics holds the counters collected by this process. They are exposed
+// by the daemon on /metrics; other commands collect them but never publish them.
+type processMetrics struct {
+	mu                sync.Mutex
+	downloadCounts    map[string][]uint64 // per tool, cumulative per bucket plus +Inf
+	downloadSums      map[string]float64
+	cacheHits         map[string]uint64
+	cacheMisses       map[string]uint64
+	lockAcquisitions  uint64
+	lockContentions   uint64
+	daemonRequests    map[string]uint64 // keyed by "method code"
+	daemonStartedUnix int64
+}
+
+var metrics = &processMetrics{
+	downloadCounts: make(map[string][]uint64),
+	downloadSums:   make(map[string]float64),
+	cacheHits:      make(map[string]uint64),
+	cacheMisses:    make(map[string]uint64),
+	daemonRequests: make(map[string]uint64),
+}
+
+// observeDownload records how long a tool download took.
+func (m *processMetrics) observeDownload(tool string, d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counts, ok := m.downloadCounts[tool]
+	if !ok {
+		counts = make([]uint64, len(downloadDurationBuckets)+1)
+		m.downloadCounts[tool] = counts
+	}
+	seconds := d.Seconds()
+	for i, bound := range downloadDurationBuckets {
+		if seconds <= bound {
+			counts[i]++
+		}
+	}
+	counts[len(downloadDurationBuckets)]++
+	m.downloadSums[tool] += seconds
+}
+
+// observeCache records whether a tool binary was already installed (a hit) or had to be downloaded.
+func (m *processMetrics) observeCache(tool string, hit bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if hit {
+		m.cacheHits[tool]++
+	} else {
+		m.cacheMisses[tool]++
+	}
+}
+
+// observeLock records an environment lock attempt and whether it found the environment locked.
+func (m *processMetrics) observeLock(contended bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if contended {
+		m.lockContentions++
+	} else {
+		m.lockAcquisitions++
+	}
+}
+
+// observeRequest records a daemon API request.
+func (m *processMetrics) observeRequest(method string, code int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.daemonRequests[fmt.Sprintf("%s %d", method, code)]++
+}
+
+// writeMetrics renders the process counters and the state of the environments
+// under envDir in the Prometheus text exposition format.
+func (m *processMetrics) writeMetrics(w io.Writer, envDir string) {
+	names, _ := listEnvironmentDirs(envDir)
+	locked := 0
+	snapCounts := make(map[string]int)
+	snapBytes := make(map[string]int64)
+	for _, name := range names {
+		envPath := filepath.Join(envDir, name)
+		if fileExists(filepath.Join(envPath, lockFileName)) {
+			locked++
+		}
+		matches, _ := filepath.Glob(filepath.Join(envPath, "snaps", "*.snap"))
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil {
+				snapCounts[name]++
+				snapBytes[name] += info.Size()
+			}
+		}
+	}
+
+	writeMetricHeader(w, "tfvenv_environments", "gauge", "Number of environments.")
+	fmt.Fprintf(w, "tfvenv_environments %d\n", len(names))
+	writeMetricHeader(w, "tfvenv_environments_locked", "gauge", "Number of environments currently locked.")
+	fmt.Fprintf(w, "tfvenv_environments_locked %d\n", locked)
+
+	writeMetricHeader(w, "tfvenv_snaps", "gauge", "Number of local snaps per environment.")
+	for _, name := range names {
+		fmt.Fprintf(w, "tfvenv_snaps{environment=%q} %d\n", name, snapCounts[name])
+	}
+	writeMetricHeader(w, "tfvenv_snap_bytes", "gauge", "Total size of local snaps per environment in bytes.")
+	for _, name := range names {
+		fmt.Fprintf(w, "tfvenv_snap_bytes{environment=%q} %d\n", name, snapBytes[name])
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	writeMetricHeader(w, "tfvenv_download_duration_seconds", "histogram", "Duration of Terraform and Terragrunt downloads.")
+	tools := make([]string, 0, len(m.downloadCounts))
+	for tool := range m.downloadCounts {
+		tools = append(tools, tool)
+	}
+	sort.Strings(tools)
+	for _, tool := range tools {
+		counts := m.downloadCounts[tool]
+		for i, bound := range downloadDurationBuckets {
+			fmt.Fprintf(w, "tfvenv_download_duration_seconds_bucket{tool=%q,le=\"%g\"} %d\n", tool, bound, counts[i])
+		}
+		total := counts[len(downloadDurationBuckets)]
+		fmt.Fprintf(w, "tfvenv_download_duration_seconds_bucket{tool=%q,le=\"+Inf\"} %d\n", tool, total)
+		fmt.Fprintf(w, "tfvenv_download_duration_seconds_sum{tool=%q} %g\n", tool, m.downloadSums[tool])
+		fmt.Fprintf(w, "tfvenv_download_duration_seconds_count{tool=%q} %d\n", tool, total)
+	}
+
+	writeMetricHeader(w, "tfvenv_binary_cache_hits_total", "counter", "Tool installs satisfied by an already installed binary.")
+	for _, tool := range sortedMetricKeys(m.cacheHits) {
+		fmt.Fprintf(w, "tfvenv_binary_cache_hits_total{tool=%q} %d\n", tool, m.cacheHits[tool])
+	}
+	writeMetricHeader(w, "tfvenv_binary_cache_misses_total", "counter", "Tool installs that required a download.")
+	for _, tool := range sortedMetricKeys(m.cacheMisses) {
+		fmt.Fprintf(w, "tfvenv_binary_cache_misses_total{tool=%q} %d\n", tool, m.cacheMisses[tool])
+	}
+
+	writeMetricHeader(w, "tfvenv_lock_acquisitions_total", "counter", "Environment locks acquired.")
+	fmt.Fprintf(w, "tfvenv_lock_acquisitions_total %d\n", m.lockAcquisitions)
+	writeMetricHeader(w, "tfvenv_lock_contentions_total", "counter", "Lock attempts that found the environment already locked.")
+	fmt.Fprintf(w, "tfvenv_lock_contentions_total %d\n", m.lockContentions)
+
+	writeMetricHeader(w, "tfvenv_daemon_requests_total", "counter", "Daemon API requests by method and status code.")
+	for _, key := range sortedMetricKeys(m.daemonRequests) {
+		parts := strings.SplitN(key, " ", 2)
+		fmt.Fprintf(w, "tfvenv_daemon_requests_total{method=%q,code=%q} %d\n", parts[0], parts[1], m.daemonRequests[key])
+	}
+	if m.daemonStartedUnix != 0 {
+		writeMetricHeader(w, "tfvenv_daemon_start_time_seconds", "gauge", "Start time of the daemon since the Unix epoch.")
+		fmt.Fprintf(w, "tfvenv_daemon_start_time_seconds %d\n", m.daemonStartedUnix)
+	}
+}
+
+// writeMetricHeader writes the HELP and TYPE lines of a metric family.
+func writeMetricHeader(w io.Writer, name, metricType, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// sortedMetricKeys returns the label values of a metric in a stable order.
+func sortedMetricKeys(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	version "github.com/hashicorp/go-version"
+	"github.com/spf13/cobra"
+
+	"tfvenv/i18n"
+)
+
+// Version files read by tfenv and tgenv, naming the version a directory uses.
+const (
+	terraformVersionFileName  = ".terraform-version"
+	terragruntVersionFileName = ".terragrunt-version"
+)
+
+// managedVersion is a binary installed by another version manager.
+type managedVersion struct {
+	Manager string
+	Tool    string
+	Version string
+	Path    string
+}
+
+// migrateCmd groups the imports from other version managers.
+func migrateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Import versions and projects from other version managers",
+	}
+
+	cmd.AddCommand(migrateFromTfenvCmd())
+	return cmd
+}
+
+// migrateFromTfenvCmd imports what tfenv, tgenv and tfswitch installed, and
+// turns .terraform-version files into environment definitions.
+func migrateFromTfenvCmd() *cobra.Command {
+	var tfenvDir, tgenvDir, tfswitchDir, scanDir string
+	var move, force, dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "from-tfenv",
+		Short: "Import versions installed by tfenv, tgenv and tfswitch, and convert .terraform-version files",
+		Long: `Find the Terraform versions installed by tfenv and tfswitch and the Terragrunt
+versions installed by tgenv, and add them to tfvenv's version store, where
+environments are installed from without downloading. Binaries are linked, so
+the other tools keep working; pass --move to take them over.
+
+Directories under --scan holding a .terraform-version or .terragrunt-version
+file are then proposed as environments and written to ` + manifestFileName + `,
+from which 'tfvenv up' creates them.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			if tfenvDir == "" {
+				tfenvDir = filepath.Join(home, ".tfenv")
+			}
+			if tgenvDir == "" {
+				tgenvDir = filepath.Join(home, ".tgenv")
+			}
+			if tfswitchDir == "" {
+				tfswitchDir = filepath.Join(home, ".terraform.versions")
+			}
+
+			found := discoverManagedVersions(tfenvDir, tgenvDir, tfswitchDir)
+			if len(found) == 0 {
+				fmt.Printf("No versions found in %s, %s or %s.\n", tfenvDir, tgenvDir, tfswitchDir)
+			}
+			imported, failed := 0, 0
+			for _, mv := range found {
+				dest := storedBinaryPath(mv.Tool, mv.Version)
+				if _, err := os.Lstat(dest); err == nil {
+					fmt.Printf("  = %s %s (%s) is already in the version store\n", mv.Tool, mv.Version, mv.Manager)
+					continue
+				}
+				if dryRun {
+					if move {
+						printDryRun("would move %s to %s", mv.Path, dest)
+					} else {
+						printDryRun("would link %s to %s", mv.Path, dest)
+					}
+					continue
+				}
+				if err := importManagedVersion(mv, dest, move); err != nil {
+					logger.Errorf("error importing %s: %v", mv.Path, err)
+					fmt.Printf("  ! %s %s (%s): %v\n", mv.Tool, mv.Version, mv.Manager, err)
+					failed++
+					continue
+				}
+				logger.Infof("imported %s into %s", mv.Path, dest)
+				fmt.Printf("  + %s %s (%s)\n", mv.Tool, mv.Version, mv.Manager)
+				imported++
+			}
+			if !dryRun && len(found) > 0 {
+				fmt.Printf("Imported %d version(s) into %s.\n", imported, versionStoreDir())
+			}
+
+			if err := migrateVersionFiles(scanDir, force, dryRun); err != nil {
+				logger.Errorf("error converting version files in %s: %v", scanDir, err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			if failed > 0 {
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&tfenvDir, "tfenv-dir", "", "tfenv's root directory (defaults to ~/.tfenv)")
+	cmd.Flags().StringVar(&tgenvDir, "tgenv-dir", "", "tgenv's root directory (defaults to ~/.tgenv)")
+	cmd.Flags().StringVar(&tfswitchDir, "tfswitch-dir", "", "Where tfswitch keeps its binaries (defaults to ~/.terraform.versions)")
+	cmd.Flags().StringVar(&scanDir, "scan", ".", "Directory to look for .terraform-version files in")
+	cmd.Flags().BoolVar(&move, "move", false, "Move the binaries into the version store instead of linking them")
+	cmd.Flags().BoolVar(&force, "force", false, "Replace an existing "+manifestFileName)
+	addDryRunFlag(cmd, &dryRun)
+	return cmd
+}
+
+// discoverManagedVersions lists the binaries installed by tfenv and tgenv,
+// in <root>/versions/<version>/, and by tfswitch, as <dir>/terraform_<version>.
+// Directories that do not exist are skipped.
+func discoverManagedVersions(tfenvDir, tgenvDir, tfswitchDir string) []managedVersion {
+	var found []managedVersion
+	for _, manager := range []struct{ name, tool, dir string }{
+		{"tfenv", toolTerraform, tfenvDir},
+		{"tgenv", "terragrunt", tgenvDir},
+	} {
+		entries, err := os.ReadDir(filepath.Join(manager.dir, "versions"))
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if _, err := version.NewVersion(entry.Name()); err != nil || !entry.IsDir() {
+				continue
+			}
+			path := filepath.Join(manager.dir, "versions", entry.Name(), executableName(manager.tool))
+			if fileExists(path) {
+				found = append(found, managedVersion{Manager: manager.name, Tool: manager.tool, Version: entry.Name(), Path: path})
+			}
+		}
+	}
+
+	entries, _ := os.ReadDir(tfswitchDir)
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), windowsExecutableSuffix)
+		if entry.IsDir() || !strings.HasPrefix(name, "terraform_") {
+			continue
+		}
+		v := strings.TrimPrefix(name, "terraform_")
+		if _, err := version.NewVersion(v); err != nil {
+			continue
+		}
+		found = append(found, managedVersion{Manager: "tfswitch", Tool: toolTerraform, Version: v, Path: filepath.Join(tfswitchDir, entry.Name())})
+	}
+
+	sort.SliceStable(found, func(i, j int) bool {
+		if found[i].Tool != found[j].Tool {
+			return found[i].Tool < found[j].Tool
+		}
+		vi, _ := version.NewVersion(found[i].Version)
+		vj, _ := version.NewVersion(found[j].Version)
+		return vi.LessThan(vj)
+	})
+	return found
+}
+
+// importManagedVersion adds a binary to the version store at dest, linking it
+// or moving it there.
+func importManagedVersion(mv managedVersion, dest string, move bool) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(dest), err)
+	}
+	if move {
+		return moveTree(mv.Path, dest)
+	}
+	src, err := filepath.Abs(mv.Path)
+	if err != nil {
+		return err
+	}
+	return createLink(src, dest)
+}
+
+// migrateVersionFiles proposes an environment for each directory under dir
+// with a .terraform-version or .terragrunt-version file and writes them to
+// the manifest in dir.
+func migrateVersionFiles(dir string, force, dryRun bool) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	projects, err := scanVersionFiles(absDir)
+	if err != nil {
+		return err
+	}
+	if len(projects) == 0 {
+		fmt.Printf("No %s or %s files found in %s.\n", terraformVersionFileName, terragruntVersionFileName, absDir)
+		return nil
+	}
+
+	fmt.Printf("Found %d project(s) with version files:\n", len(projects))
+	for _, project := range projects {
+		printDetectedProject(project)
+	}
+	if err := checkProjectNames(projects); err != nil {
+		return err
+	}
+
+	manifestPath := filepath.Join(absDir, manifestFileName)
+	content := renderInitManifest(projects, "tfvenv migrate from-tfenv")
+	if fileExists(manifestPath) && !force {
+		fmt.Printf("%s already exists; add the environments to it by hand, or pass --force to replace it:\n", manifestPath)
+		fmt.Print(string(content))
+		return nil
+	}
+	if dryRun {
+		printDryRun("would write %s:", manifestPath)
+		fmt.Print(string(content))
+		return nil
+	}
+	if err := os.WriteFile(manifestPath, content, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", manifestPath, err)
+	}
+	summary.fileWritten(manifestPath)
+	fmt.Printf("Wrote %s. Run 'tfvenv up' to create the environments.\n", manifestPath)
+	return nil
+}
+
+// scanVersionFiles finds the directories under dir holding a version file,
+// skipping the directories project detection skips, and reads the versions
+// they name.
+func scanVersionFiles(dir string) ([]detectedProject, error) {
+	releases := releaseLookup()
+	var projects []detectedProject
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if path != dir && (rootModuleSkipDirs[info.Name()] || hclfmtSkipDirs[info.Name()] || strings.HasPrefix(info.Name(), ".")) {
+			return filepath.SkipDir
+		}
+		tfValue, tfOK := readVersionFile(filepath.Join(path, terraformVersionFileName))
+		tgValue, tgOK := readVersionFile(filepath.Join(path, terragruntVersionFileName))
+		if !tfOK && !tgOK {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		project := detectedProject{Dir: rel, Tool: toolTerraform, TgVersion: "none"}
+		tfFiles, _ := filepath.Glob(filepath.Join(path, "*.tf"))
+		terragrunt := fileExists(filepath.Join(path, "terragrunt.hcl"))
+		project.TfConstraint, project.TgConstraint = projectConstraints(path, tfFiles, terragrunt)
+		project.TfVersion = versionForConstraint(releases(toolTerraform), project.TfConstraint)
+		if tfOK {
+			project.TfVersion = versionFromFile(tfValue, project.TfConstraint, releases(toolTerraform))
+		}
+		if tgOK {
+			project.TgVersion = versionFromFile(tgValue, project.TgConstraint, releases("terragrunt"))
+		} else if terragrunt {
+			project.TgVersion = versionForConstraint(releases("terragrunt"), project.TgConstraint)
+		}
+		projects = append(projects, project)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	nameProjects(dir, projects)
+	return projects, nil
+}
+
+// readVersionFile returns the first line of a version file, without comments.
+func readVersionFile(path string) (string, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+		if line != "" {
+			return line, true
+		}
+	}
+	return "", true
+}
+
+// versionFromFile turns a tfenv or tgenv version file value into a version
+// tfvenv can pin: a version as is, "latest:<regex>" as the newest release
+// matching the regex, and "min-required" or "latest-allowed" as the newest
+// release meeting the project's required version.
+func versionFromFile(value, constraint string, releases func() []string) string {
+	value = strings.TrimPrefix(value, "v")
+	switch {
+	case value == "" || value == "latest":
+		return "latest"
+	case value == "min-required" || value == "latest-allowed":
+		return versionForConstraint(releases, constraint)
+	case strings.HasPrefix(value, "latest:"):
+		pattern, err := regexp.Compile(strings.TrimPrefix(value, "latest:"))
+		if err != nil {
+			logger.Warnf("ignoring invalid version pattern %q: %v", value, err)
+			return "latest"
+		}
+		for _, release := range releases() {
+			if pattern.MatchString(release) {
+				return release
+			}
+		}
+		logger.Warnf("no recent release matches %q", value)
+		return "latest"
+	}
+	if v, err := version.NewVersion(value); err == nil {
+		return v.String()
+	}
+	logger.Warnf("ignoring unrecognised version %q", value)
+	return "latest"
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"tfvenv/netretry"
+)
+
+// mirrorProbeTimeout bounds how long a mirror may take to answer its probe
+// before it is tried only after those that answered.
+const mirrorProbeTimeout = 3 * time.Second
+
+// mirrorProbe is how long a download mirror took to answer, or why it did not.
+type mirrorProbe struct {
+	URL     string
+	Latency time.Duration
+	Err     error
+}
+
+// downloadMirrors holds, per tool, the mirrors in the order downloads try
+// them. They are probed once per session; mirrors that fail a download move
+// to the end.
+var downloadMirrors struct {
+	sync.Mutex
+	order map[string][]string
+}
+
+// mirrorsEnvVar returns the variable that lists a tool's download mirrors,
+// such as TFVENV_TERRAFORM_MIRRORS.
+func mirrorsEnvVar(tool string) string {
+	return "TFVENV_" + strings.ToUpper(tool) + "_MIRRORS"
+}
+
+// configuredMirrors returns the base URLs in a tool's mirror variable. Each
+// must mirror the layout of the tool's release URL, so a trailing slash is added.
+func configuredMirrors(tool string) []string {
+	var mirrors []string
+	for _, mirror := range strings.Split(os.Getenv(mirrorsEnvVar(tool)), ",") {
+		mirror = strings.TrimSpace(mirror)
+		if mirror == "" {
+			continue
+		}
+		if !strings.HasSuffix(mirror, "/") {
+			mirror += "/"
+		}
+		mirrors = append(mirrors, mirror)
+	}
+	return mirrors
+}
+
+// mirrorOrder returns the base URLs to download a tool from, fastest first.
+// baseURL is the tool's release URL; it is always a candidate, and the only
+// one when no mirrors are configured or baseURL is not the tool's usual one.
+func mirrorOrder(tool, baseURL string) []string {
+	mirrors := configuredMirrors(tool)
+	if len(mirrors) == 0 || baseURL != toolDownloadURL(tool) {
+		return []string{baseURL}
+	}
+
+	downloadMirrors.Lock()
+	defer downloadMirrors.Unlock()
+	if order, ok := downloadMirrors.order[tool]; ok {
+		return append([]string(nil), order...)
+	}
+
+	candidates := mirrors
+	upstream := true
+	for _, mirror := range mirrors {
+		if mirror == baseURL {
+			upstream = false
+		}
+	}
+	if upstream {
+		candidates = append(candidates, baseURL)
+	}
+	probes := probeMirrors(candidates)
+	order := make([]string, len(probes))
+	for i, probe := range probes {
+		if probe.Err != nil {
+			logger.Warnf("download mirror %s did not answer: %v", probe.URL, probe.Err)
+		} else {
+			logger.Infof("download mirror %s answered in %s", probe.URL, probe.Latency.Round(time.Millisecond))
+		}
+		order[i] = probe.URL
+	}
+	logger.Infof("downloading %s from %s", tool, order[0])
+	if downloadMirrors.order == nil {
+		downloadMirrors.order = make(map[string][]string)
+	}
+	downloadMirrors.order[tool] = order
+	return append([]string(nil), order...)
+}
+
+// probeMirrors requests every candidate at once and returns them by how
+// quickly they answered. Any HTTP response counts as an answer, since mirrors
+// often refuse to list their root; those that did not answer come last, in
+// the order given.
+func probeMirrors(candidates []string) []mirrorProbe {
+	client := &http.Client{Timeout: mirrorProbeTimeout}
+	probes := make([]mirrorProbe, len(candidates))
+	var wg sync.WaitGroup
+	for i, candidate := range candidates {
+		wg.Add(1)
+		go func(i int, candidate string) {
+			defer wg.Done()
+			probes[i] = probeMirror(client, candidate)
+		}(i, candidate)
+	}
+	wg.Wait()
+
+	sort.SliceStable(probes, func(i, j int) bool {
+		if (probes[i].Err == nil) != (probes[j].Err == nil) {
+			return probes[i].Err == nil
+		}
+		return probes[i].Err == nil && probes[i].Latency < probes[j].Latency
+	})
+	return probes
+}
+
+// probeMirror times a HEAD request for a mirror's base URL.
+func probeMirror(client *http.Client, url string) mirrorProbe {
+	probe := mirrorProbe{URL: url}
+	req, err := http.NewRequestWithContext(rootCtx, http.MethodHead, url, nil)
+	if err != nil {
+		probe.Err = err
+		return probe
+	}
+	req.Header.Set("User-Agent", netretry.UserAgent())
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		probe.Err = err
+		return probe
+	}
+	resp.Body.Close()
+	probe.Latency = time.Since(start)
+	return probe
+}
+
+// demoteMirror moves a mirror that failed a download to the end of a tool's
+// order, so the rest of the session tries the others first.
+func demoteMirror(tool, url string) {
+	downloadMirrors.Lock()
+	defer downloadMirrors.Unlock()
+	order := downloadMirrors.order[tool]
+	for i, candidate := range order {
+		if candidate == url {
+			downloadMirrors.order[tool] = append(append(order[:i:i], order[i+1:]...), url)
+			return
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package modcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// manifestName is the object, stored next to the modules, that describes the remote cache.
+const manifestName = ".tfvenv-modules.json"
+
+// Manifest maps module file paths (relative, slash separated) to their sha256 hashes.
+type Manifest struct {
+	Encrypted bool              `json:"encrypted"`
+	Files     map[string]string `json:"files"`
+}
+
+// BuildManifest hashes every regular file under dir.
+func BuildManifest(dir string) (*Manifest, error) {
+	manifest := &Manifest{Files: make(map[string]string)}
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" || info.Name() == ".terraform" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		hash, err := hashFile(path)
+		if err != nil {
+			return err
+		}
+		manifest.Files[filepath.ToSlash(rel)] = hash
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash modules in %s: %v", dir, err)
+	}
+
+	return manifest, nil
+}
+
+// hashBytes returns the hex encoded sha256 of data.
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// hashFile returns the hex encoded sha256 of the file at path.
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,293 @@
+package modcache
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"tfvenv/netretry"
+	"tfvenv/snaps"
+)
+
+// Remote identifies the S3 location of a module cache.
+type Remote struct {
+	Bucket    string
+	Prefix    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	Profile   string
+}
+
+// SyncResult lists the files transferred by a push or pull.
+type SyncResult struct {
+	Transferred []string
+	Unchanged   int
+}
+
+// initS3Client initializes an S3 client for the remote. Static keys are used when provided,
+// otherwise the SDK's default credential chain applies, using Profile when set.
+func initS3Client(remote Remote) (*s3.S3, error) {
+	cfg := aws.Config{Region: aws.String(remote.Region)}
+	if remote.AccessKey != "" && remote.SecretKey != "" {
+		cfg.Credentials = credentials.NewStaticCredentials(remote.AccessKey, remote.SecretKey, "")
+	}
+
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            cfg,
+		Profile:           remote.Profile,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error initializing AWS session: %v", err)
+	}
+	netretry.ApplyAWS(sess)
+	return s3.New(sess), nil
+}
+
+// objectKey joins the remote prefix and a relative module file path.
+func (r Remote) objectKey(rel string) string {
+	return path.Join(r.Prefix, rel)
+}
+
+// Push uploads every file of localDir whose hash differs from the remote manifest,
+// optionally encrypting it with the snap key, and then uploads the new manifest.
+func Push(ctx context.Context, localDir string, remote Remote, encrypt bool) (SyncResult, error) {
+	var result SyncResult
+
+	client, err := initS3Client(remote)
+	if err != nil {
+		return result, err
+	}
+
+	local, err := BuildManifest(localDir)
+	if err != nil {
+		return result, err
+	}
+	local.Encrypted = encrypt
+
+	existing, err := fetchManifest(ctx, client, remote)
+	if err != nil {
+		return result, err
+	}
+
+	for _, rel := range sortedKeys(local.Files) {
+		if existing.Encrypted == encrypt && existing.Files[rel] == local.Files[rel] {
+			result.Unchanged++
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(localDir, filepath.FromSlash(rel)))
+		if err != nil {
+			return result, fmt.Errorf("failed to read %s: %v", rel, err)
+		}
+		if encrypt {
+			encrypted, err := snaps.Encrypt(data)
+			if err != nil {
+				return result, fmt.Errorf("failed to encrypt %s: %v", rel, err)
+			}
+			data = []byte(encrypted)
+		}
+
+		_, err = client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+			Bucket:   aws.String(remote.Bucket),
+			Key:      aws.String(remote.objectKey(rel)),
+			Body:     bytes.NewReader(data),
+			Metadata: map[string]*string{"sha256": aws.String(local.Files[rel])},
+		})
+		if err != nil {
+			return result, fmt.Errorf("error uploading %s to S3: %v", rel, err)
+		}
+		result.Transferred = append(result.Transferred, rel)
+	}
+
+	manifestData, err := json.MarshalIndent(local, "", "  ")
+	if err != nil {
+		return result, fmt.Errorf("failed to marshal manifest: %v", err)
+	}
+	_, err = client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(remote.Bucket),
+		Key:    aws.String(remote.objectKey(manifestName)),
+		Body:   bytes.NewReader(manifestData),
+	})
+	if err != nil {
+		return result, fmt.Errorf("error uploading module manifest to S3: %v", err)
+	}
+
+	return result, nil
+}
+
+// Pull downloads every remote file whose hash differs from the local copy and verifies
+// each download against the manifest.
+func Pull(ctx context.Context, localDir string, remote Remote) (SyncResult, error) {
+	var result SyncResult
+
+	client, err := initS3Client(remote)
+	if err != nil {
+		return result, err
+	}
+
+	manifest, err := fetchManifest(ctx, client, remote)
+	if err != nil {
+		return result, err
+	}
+	if len(manifest.Files) == 0 {
+		return result, fmt.Errorf("no module manifest found at s3://%s/%s", remote.Bucket, remote.objectKey(manifestName))
+	}
+
+	// Refuse the whole manifest before downloading anything if a key would
+	// be written outside localDir
+	for rel := range manifest.Files {
+		if _, err := localPath(localDir, rel); err != nil {
+			return result, err
+		}
+	}
+
+	local := &Manifest{Files: map[string]string{}}
+	if _, err := os.Stat(localDir); err == nil {
+		if local, err = BuildManifest(localDir); err != nil {
+			return result, err
+		}
+	}
+
+	for _, rel := range sortedKeys(manifest.Files) {
+		if local.Files[rel] == manifest.Files[rel] {
+			result.Unchanged++
+			continue
+		}
+
+		obj, err := client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(remote.Bucket),
+			Key:    aws.String(remote.objectKey(rel)),
+		})
+		if err != nil {
+			return result, fmt.Errorf("error downloading %s from S3: %v", rel, err)
+		}
+		data, err := io.ReadAll(obj.Body)
+		obj.Body.Close()
+		if err != nil {
+			return result, fmt.Errorf("error reading %s: %v", rel, err)
+		}
+
+		if manifest.Encrypted {
+			decoded, err := base64.StdEncoding.DecodeString(string(data))
+			if err != nil {
+				return result, fmt.Errorf("failed to decode %s: %v", rel, err)
+			}
+			if data, err = snaps.Decrypt(decoded); err != nil {
+				return result, fmt.Errorf("failed to decrypt %s: %v", rel, err)
+			}
+		}
+
+		// Verify before writing, so a corrupt download never replaces a good file
+		if hash := hashBytes(data); hash != manifest.Files[rel] {
+			return result, fmt.Errorf("hash mismatch for %s: expected %s, got %s", rel, manifest.Files[rel], hash)
+		}
+		dest, err := localPath(localDir, rel)
+		if err != nil {
+			return result, err
+		}
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return result, fmt.Errorf("failed to create directory for %s: %v", rel, err)
+		}
+		if err := replaceFile(dest, data); err != nil {
+			return result, fmt.Errorf("failed to write %s: %v", dest, err)
+		}
+		result.Transferred = append(result.Transferred, rel)
+	}
+
+	return result, nil
+}
+
+// replaceFile writes data to a temporary file next to dest and renames it
+// into place, so readers never see a partly written file.
+func replaceFile(dest string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, dest); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// localPath returns where a manifest key is written under localDir. Keys come
+// from the remote manifest, so absolute keys and keys that climb out of
+// localDir are refused.
+func localPath(localDir, rel string) (string, error) {
+	name := filepath.FromSlash(rel)
+	if rel == "" || path.IsAbs(rel) || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("illegal file path in module manifest: %s", rel)
+	}
+	root := filepath.Clean(localDir)
+	dest := filepath.Join(root, filepath.Clean(name))
+	if !strings.HasPrefix(dest, root+string(os.PathSeparator)) {
+		return "", fmt.Errorf("illegal file path in module manifest: %s", rel)
+	}
+	return dest, nil
+}
+
+// fetchManifest downloads the remote manifest. A missing manifest yields an empty one.
+func fetchManifest(ctx context.Context, client *s3.S3, remote Remote) (*Manifest, error) {
+	manifest := &Manifest{Files: map[string]string{}}
+
+	obj, err := client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(remote.Bucket),
+		Key:    aws.String(remote.objectKey(manifestName)),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return manifest, nil
+		}
+		return nil, fmt.Errorf("error retrieving module manifest from S3: %v", err)
+	}
+	defer obj.Body.Close()
+
+	if err := json.NewDecoder(obj.Body).Decode(manifest); err != nil {
+		return nil, fmt.Errorf("error parsing module manifest: %v", err)
+	}
+	if manifest.Files == nil {
+		manifest.Files = map[string]string{}
+	}
+	return manifest, nil
+}
+
+// sortedKeys returns the keys of m in sorted order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
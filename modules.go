@@ -0,0 +1,722 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	version "github.com/hashicorp/go-version"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zclconf/go-cty/cty"
+
+	"tfvenv/i18n"
+	"tfvenv/modcache"
+)
+
+// moduleCacheLinkName is the link, inside an environment's config directory, that points to
+// the environment's local module cache so module sources can use "./.tfvenv-modules/<name>".
+const moduleCacheLinkName = ".tfvenv-modules"
+
+// ModuleLock records the pinned source and content hash of an upstream module.
+type ModuleLock struct {
+	Source  string `json:"source"`
+	Version string `json:"version,omitempty"`
+	Hash    string `json:"hash"`
+}
+
+// moduleReference is a module block found in the environment's configuration.
+type moduleReference struct {
+	File    string
+	Name    string
+	Source  string
+	Version string
+}
+
+// modulesCmd defines the "modules" command and its subcommands.
+func modulesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "modules",
+		Short: "Check, pin, and verify module sources used by an environment",
+	}
+
+	cmd.AddCommand(modulesCheckCmd())
+	cmd.AddCommand(modulesPinCmd())
+	cmd.AddCommand(modulesVerifyCmd())
+	cmd.AddCommand(modulesPushCmd())
+	cmd.AddCommand(modulesPullCmd())
+
+	return cmd
+}
+
+// modulesCheckCmd lists module blocks with unpinned sources
+func modulesCheckCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "check <env-name>",
+		Short: "List module blocks whose git or registry sources are not pinned",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envDir := viper.GetString("env-dir")
+			configDir := filepath.Join(envDir, envName, "config", envName)
+
+			refs, err := scanModuleReferences(configDir)
+			if err != nil {
+				logger.Errorf("error scanning modules: %v", err)
+				fmt.Printf("Error scanning modules: %v\n", err)
+				os.Exit(1)
+			}
+
+			unpinned := 0
+			for _, ref := range refs {
+				if reason := moduleUnpinnedReason(ref); reason != "" {
+					unpinned++
+					fmt.Printf("Unpinned: module %q in %s (%s): %s\n", ref.Name, ref.File, ref.Source, reason)
+				}
+			}
+
+			if unpinned > 0 {
+				fmt.Printf("%d unpinned module(s) found. Run 'tfvenv modules pin %s' to pin them.\n", unpinned, envName)
+				os.Exit(1)
+			}
+			fmt.Printf("All %d module source(s) are pinned.\n", len(refs))
+		},
+	}
+}
+
+// modulesPinCmd pins module sources and records their content hashes
+func modulesPinCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "pin <env-name>",
+		Short: "Pin git refs and registry versions, then record module hashes",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envDir := viper.GetString("env-dir")
+			envPath := filepath.Join(envDir, envName)
+			configDir := filepath.Join(envPath, "config", envName)
+
+			refs, err := scanModuleReferences(configDir)
+			if err != nil {
+				logger.Errorf("error scanning modules: %v", err)
+				fmt.Printf("Error scanning modules: %v\n", err)
+				os.Exit(1)
+			}
+
+			for _, ref := range refs {
+				if moduleUnpinnedReason(ref) == "" {
+					continue
+				}
+				source, moduleVersion, err := pinModuleReference(ref)
+				if err != nil {
+					logger.Errorf("error pinning module %q: %v", ref.Name, err)
+					fmt.Printf("Error pinning module %q: %v\n", ref.Name, err)
+					os.Exit(1)
+				}
+				if err := rewriteModuleBlock(ref.File, ref.Name, source, moduleVersion); err != nil {
+					logger.Errorf("error updating module %q: %v", ref.Name, err)
+					fmt.Printf("Error updating module %q: %v\n", ref.Name, err)
+					os.Exit(1)
+				}
+				if moduleVersion != "" {
+					fmt.Printf("Pinned module %q to version %s\n", ref.Name, moduleVersion)
+				} else {
+					fmt.Printf("Pinned module %q to %s\n", ref.Name, source)
+				}
+			}
+
+			locks, err := fetchModuleLocks(envPath, envName, filepath.Join(envPath, "terraform-data"), false)
+			if err != nil {
+				logger.Errorf("error hashing modules: %v", err)
+				fmt.Printf("Error hashing modules: %v\n", err)
+				os.Exit(1)
+			}
+
+			err = updateEnvMetadata(envPath, func(meta *EnvironmentMetadata) {
+				meta.Modules = locks
+			})
+			if err != nil {
+				logger.Errorf("error recording module hashes: %v", err)
+				fmt.Printf("Error recording module hashes: %v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Recorded hashes for %d module(s).\n", len(locks))
+			logger.Infof("recorded %d module hashes for environment '%s'", len(locks), envName)
+		},
+	}
+}
+
+// modulesVerifyCmd re-downloads modules and compares them with the recorded hashes
+func modulesVerifyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "verify <env-name>",
+		Short: "Detect upstream module drift by comparing module contents with recorded hashes",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envDir := viper.GetString("env-dir")
+			envPath := filepath.Join(envDir, envName)
+
+			meta, err := loadEnvMetadata(envPath)
+			if err != nil {
+				logger.Errorf("error reading environment metadata: %v", err)
+				fmt.Printf("Error reading environment metadata: %v\n", err)
+				os.Exit(1)
+			}
+			if len(meta.Modules) == 0 {
+				fmt.Printf("No module hashes recorded. Run 'tfvenv modules pin %s' first.\n", envName)
+				os.Exit(1)
+			}
+
+			// Download into a scratch data directory so the environment's own modules stay untouched
+			scratchDir, err := os.MkdirTemp("", "tfvenv-modules-*")
+			if err != nil {
+				logger.Errorf("error creating temporary directory: %v", err)
+				fmt.Printf("Error creating temporary directory: %v\n", err)
+				os.Exit(1)
+			}
+			removeScratch := func() { os.RemoveAll(scratchDir) }
+			unregister := onInterrupt(removeScratch)
+			defer unregister()
+			defer removeScratch()
+
+			current, err := fetchModuleLocks(envPath, envName, scratchDir, true)
+			if err != nil {
+				// os.Exit skips deferred calls
+				removeScratch()
+				logger.Errorf("error hashing modules: %v", err)
+				fmt.Printf("Error hashing modules: %v\n", err)
+				os.Exit(1)
+			}
+
+			drifted := 0
+			for _, key := range sortedModuleKeys(meta.Modules, current) {
+				recorded, wasRecorded := meta.Modules[key]
+				now, isCurrent := current[key]
+				switch {
+				case !wasRecorded:
+					drifted++
+					fmt.Printf("New module %q (%s) has no recorded hash\n", key, now.Source)
+				case !isCurrent:
+					drifted++
+					fmt.Printf("Recorded module %q (%s) is no longer used\n", key, recorded.Source)
+				case recorded.Source != now.Source || recorded.Version != now.Version:
+					drifted++
+					fmt.Printf("Module %q source changed: %s %s -> %s %s\n", key, recorded.Source, recorded.Version, now.Source, now.Version)
+				case recorded.Hash != now.Hash:
+					drifted++
+					fmt.Printf("Module %q content changed upstream (%s)\n", key, now.Source)
+				}
+			}
+
+			if drifted > 0 {
+				removeScratch()
+				logger.Warnf("%d module(s) drifted in environment '%s'", drifted, envName)
+				os.Exit(1)
+			}
+			fmt.Printf("All %d module(s) match their recorded hashes.\n", len(current))
+			logger.Infof("module verification passed for environment '%s'", envName)
+		},
+	}
+}
+
+// modulesPushCmd uploads the environment's local module cache to S3_MODULES_BUCKET/S3_MODULES_PATH
+func modulesPushCmd() *cobra.Command {
+	var localDir string
+	var encrypt bool
+
+	cmd := &cobra.Command{
+		Use:   "push <env-name>",
+		Short: "Upload the environment's local module cache to the configured S3 modules location",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envDir := viper.GetString("env-dir")
+			envPath := filepath.Join(envDir, envName)
+			if localDir == "" {
+				localDir = filepath.Join(envPath, "modules")
+			}
+
+			remote, err := moduleCacheRemote(envPath, envName)
+			if err != nil {
+				logger.Errorf("error resolving module cache location: %v", err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+			defer cancel()
+
+			result, err := modcache.Push(ctx, localDir, remote, encrypt)
+			if err != nil {
+				logger.Errorf("error pushing modules: %v", err)
+				fmt.Printf("Error pushing modules: %v\n", err)
+				os.Exit(1)
+			}
+
+			for _, rel := range result.Transferred {
+				fmt.Printf("Uploaded %s\n", rel)
+			}
+			fmt.Printf("Module push completed: %d uploaded, %d unchanged.\n", len(result.Transferred), result.Unchanged)
+			logger.Infof("pushed %d module files to s3://%s/%s", len(result.Transferred), remote.Bucket, remote.Prefix)
+		},
+	}
+
+	cmd.Flags().StringVar(&localDir, "dir", "", "Local modules directory (defaults to <env>/modules)")
+	cmd.Flags().BoolVar(&encrypt, "encrypt", false, "Encrypt module files with SNAP_KEY before uploading")
+
+	return cmd
+}
+
+// modulesPullCmd downloads the S3 module cache into the environment and links it into the config directory
+func modulesPullCmd() *cobra.Command {
+	var localDir string
+
+	cmd := &cobra.Command{
+		Use:   "pull <env-name>",
+		Short: "Download the configured S3 modules location into the environment's local module cache",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envDir := viper.GetString("env-dir")
+			envPath := filepath.Join(envDir, envName)
+			if localDir == "" {
+				localDir = filepath.Join(envPath, "modules")
+			}
+
+			remote, err := moduleCacheRemote(envPath, envName)
+			if err != nil {
+				logger.Errorf("error resolving module cache location: %v", err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+			defer cancel()
+
+			result, err := modcache.Pull(ctx, localDir, remote)
+			if err != nil {
+				logger.Errorf("error pulling modules: %v", err)
+				fmt.Printf("Error pulling modules: %v\n", err)
+				os.Exit(1)
+			}
+
+			for _, rel := range result.Transferred {
+				fmt.Printf("Downloaded %s\n", rel)
+			}
+
+			if err := linkModuleCache(envPath, envName, localDir); err != nil {
+				logger.Warnf("failed to link module cache: %v", err)
+				fmt.Printf("Warning: failed to link module cache into the config directory: %v\n", err)
+			}
+
+			fmt.Printf("Module pull completed: %d downloaded, %d unchanged.\n", len(result.Transferred), result.Unchanged)
+			logger.Infof("pulled %d module files from s3://%s/%s", len(result.Transferred), remote.Bucket, remote.Prefix)
+		},
+	}
+
+	cmd.Flags().StringVar(&localDir, "dir", "", "Local modules directory (defaults to <env>/modules)")
+
+	return cmd
+}
+
+// moduleCacheRemote builds the S3 module cache location from the environment's .tfvenvrc,
+// falling back to the AWS_* variables used by remote snaps for credentials and region.
+func moduleCacheRemote(envPath, envName string) (modcache.Remote, error) {
+	configPath := filepath.Join(envPath, "config", envName, tfvenvrcFileName)
+	config, err := readConfig(configPath)
+	if err != nil {
+		return modcache.Remote{}, fmt.Errorf("failed to read %s: %w", configPath, err)
+	}
+	if config.S3ModulesBucket == "" {
+		return modcache.Remote{}, fmt.Errorf("S3_MODULES_BUCKET is not set in %s", configPath)
+	}
+
+	remote := modcache.Remote{
+		Bucket:    config.S3ModulesBucket,
+		Prefix:    config.S3ModulesPath,
+		Region:    config.Region,
+		AccessKey: config.AccessKey,
+		SecretKey: config.SecretKey,
+		Profile:   config.AWSProfile,
+	}
+	if config.AWSRegion != "" {
+		remote.Region = config.AWSRegion
+	}
+	if remote.Region == "" {
+		remote.Region = os.Getenv("AWS_REGION")
+	}
+	if remote.AccessKey == "" {
+		remote.AccessKey = os.Getenv("AWS_ACCESS_KEY")
+		remote.SecretKey = os.Getenv("AWS_SECRET_KEY")
+	}
+	return remote, nil
+}
+
+// linkModuleCache points <config>/.tfvenv-modules at the local module cache.
+func linkModuleCache(envPath, envName, localDir string) error {
+	absDir, err := filepath.Abs(localDir)
+	if err != nil {
+		return err
+	}
+
+	linkPath := filepath.Join(envPath, "config", envName, moduleCacheLinkName)
+	if target, err := os.Readlink(linkPath); err == nil && target == absDir {
+		return nil
+	}
+	if _, err := os.Lstat(linkPath); err == nil {
+		if err := os.Remove(linkPath); err != nil {
+			return err
+		}
+	}
+	return createLink(absDir, linkPath)
+}
+
+// scanModuleReferences returns every module block in the .tf files under configDir.
+func scanModuleReferences(configDir string) ([]moduleReference, error) {
+	dirs, err := findTerraformModules(configDir)
+	if err != nil {
+		return nil, err
+	}
+
+	refs := []moduleReference{}
+	for _, dir := range dirs {
+		tfFiles, err := filepath.Glob(filepath.Join(dir, "*.tf"))
+		if err != nil {
+			return nil, err
+		}
+		for _, tfFile := range tfFiles {
+			src, err := os.ReadFile(tfFile)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", tfFile, err)
+			}
+			file, diags := hclwrite.ParseConfig(src, tfFile, hcl.InitialPos)
+			if diags.HasErrors() {
+				logger.Warnf("Failed to parse %s: %s", tfFile, diags.Error())
+				continue
+			}
+			for _, block := range file.Body().Blocks() {
+				if block.Type() != "module" || len(block.Labels()) != 1 {
+					continue
+				}
+				refs = append(refs, moduleReference{
+					File:    tfFile,
+					Name:    block.Labels()[0],
+					Source:  attributeStringValue(block.Body().GetAttribute("source")),
+					Version: attributeStringValue(block.Body().GetAttribute("version")),
+				})
+			}
+		}
+	}
+	return refs, nil
+}
+
+// attributeStringValue returns the literal string value of an hclwrite attribute, or "".
+func attributeStringValue(attr *hclwrite.Attribute) string {
+	if attr == nil {
+		return ""
+	}
+	raw := strings.TrimSpace(string(attr.Expr().BuildTokens(nil).Bytes()))
+	if len(raw) < 2 || !strings.HasPrefix(raw, `"`) || !strings.HasSuffix(raw, `"`) {
+		return ""
+	}
+	return raw[1 : len(raw)-1]
+}
+
+// isLocalModuleSource reports whether source refers to a path on disk.
+func isLocalModuleSource(source string) bool {
+	return strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../") || filepath.IsAbs(source)
+}
+
+// isGitModuleSource reports whether source is fetched from a git repository.
+func isGitModuleSource(source string) bool {
+	return strings.HasPrefix(source, "git::") || strings.HasPrefix(source, "git@") ||
+		strings.HasPrefix(source, "github.com/") || strings.HasPrefix(source, "bitbucket.org/")
+}
+
+// moduleUnpinnedReason explains why a module reference is not pinned, or returns "" if it is.
+func moduleUnpinnedReason(ref moduleReference) string {
+	switch {
+	case ref.Source == "" || isLocalModuleSource(ref.Source):
+		return ""
+	case isGitModuleSource(ref.Source):
+		if !strings.Contains(ref.Source, "ref=") {
+			return "git source without ?ref="
+		}
+		return ""
+	case strings.Contains(ref.Source, "::") || strings.HasPrefix(ref.Source, "http"):
+		// Archives, buckets, and other go-getter sources cannot be pinned by tfvenv
+		return ""
+	case ref.Version == "":
+		return "registry source without version"
+	}
+
+	if _, err := version.NewVersion(ref.Version); err != nil {
+		return fmt.Sprintf("registry version %q is a constraint, not an exact version", ref.Version)
+	}
+	return ""
+}
+
+// pinModuleReference resolves an unpinned reference to a pinned source and version.
+func pinModuleReference(ref moduleReference) (string, string, error) {
+	if isGitModuleSource(ref.Source) {
+		sha, err := resolveGitHead(ref.Source)
+		if err != nil {
+			return "", "", err
+		}
+		separator := "?"
+		if strings.Contains(ref.Source, "?") {
+			separator = "&"
+		}
+		return ref.Source + separator + "ref=" + sha, "", nil
+	}
+
+	moduleVersion, err := resolveRegistryModuleVersion(ref.Source, ref.Version)
+	if err != nil {
+		return "", "", err
+	}
+	return ref.Source, moduleVersion, nil
+}
+
+// resolveGitHead returns the commit SHA that HEAD points to in the repository behind a module source.
+func resolveGitHead(source string) (string, error) {
+	repo := gitRepositoryURL(source)
+
+	output, err := exec.Command("git", "ls-remote", repo, "HEAD").Output()
+	if err != nil {
+		return "", fmt.Errorf("git ls-remote %s failed: %w", repo, err)
+	}
+	fields := strings.Fields(string(output))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("could not resolve HEAD of %s", repo)
+	}
+	return fields[0], nil
+}
+
+// gitRepositoryURL strips the git:: prefix, query string, and //subdirectory from a module source.
+func gitRepositoryURL(source string) string {
+	repo := strings.TrimPrefix(source, "git::")
+	repo = strings.SplitN(repo, "?", 2)[0]
+
+	offset := 0
+	if i := strings.Index(repo, "://"); i >= 0 {
+		offset = i + len("://")
+	}
+	if i := strings.Index(repo[offset:], "//"); i >= 0 {
+		repo = repo[:offset+i]
+	}
+
+	if strings.HasPrefix(repo, "github.com/") || strings.HasPrefix(repo, "bitbucket.org/") {
+		repo = "https://" + repo
+	}
+	return repo
+}
+
+// resolveRegistryModuleVersion returns the newest registry version of source matching constraint.
+func resolveRegistryModuleVersion(source, constraint string) (string, error) {
+	host := "registry.terraform.io"
+	parts := strings.Split(source, "/")
+	if len(parts) == 4 {
+		host, parts = parts[0], parts[1:]
+	}
+	if len(parts) != 3 {
+		return "", fmt.Errorf("unsupported registry module source: %s", source)
+	}
+
+	apiURL := fmt.Sprintf("https://%s/v1/modules/%s/%s/%s/versions", host, parts[0], parts[1], strings.SplitN(parts[2], "//", 2)[0])
+	resp, err := httpClient.Get(apiURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch module versions from %s: %w", apiURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to fetch module versions from %s: status code %d", apiURL, resp.StatusCode)
+	}
+
+	var payload struct {
+		Modules []struct {
+			Versions []struct {
+				Version string `json:"version"`
+			} `json:"versions"`
+		} `json:"modules"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&payload); err != nil {
+		return "", fmt.Errorf("failed to decode module versions JSON: %w", err)
+	}
+
+	var vConstraint version.Constraints
+	if constraint != "" {
+		vConstraint, err = version.NewConstraint(constraint)
+		if err != nil {
+			return "", fmt.Errorf("invalid version constraint '%s' for module %s: %w", constraint, source, err)
+		}
+	}
+
+	var versions []*version.Version
+	for _, m := range payload.Modules {
+		for _, v := range m.Versions {
+			ver, err := version.NewVersion(v.Version)
+			if err != nil || ver.Prerelease() != "" {
+				continue
+			}
+			if vConstraint == nil || vConstraint.Check(ver) {
+				versions = append(versions, ver)
+			}
+		}
+	}
+	if len(versions) == 0 {
+		return "", fmt.Errorf("no versions found for module %s matching constraint '%s'", source, constraint)
+	}
+
+	sort.Sort(sort.Reverse(version.Collection(versions)))
+	return versions[0].Original(), nil
+}
+
+// rewriteModuleBlock updates the source and version attributes of a named module block in place.
+func rewriteModuleBlock(tfFile, moduleName, source, moduleVersion string) error {
+	src, err := os.ReadFile(tfFile)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", tfFile, err)
+	}
+	file, diags := hclwrite.ParseConfig(src, tfFile, hcl.InitialPos)
+	if diags.HasErrors() {
+		return fmt.Errorf("failed to parse %s: %s", tfFile, diags.Error())
+	}
+
+	block := file.Body().FirstMatchingBlock("module", []string{moduleName})
+	if block == nil {
+		return fmt.Errorf("module %q not found in %s", moduleName, tfFile)
+	}
+	block.Body().SetAttributeValue("source", cty.StringVal(source))
+	if moduleVersion != "" {
+		block.Body().SetAttributeValue("version", cty.StringVal(moduleVersion))
+	}
+
+	return writeFilePreservingMode(tfFile, file.Bytes())
+}
+
+// fetchModuleLocks runs `terraform get` with the given data directory and hashes every
+// downloaded (non-local) module.
+func fetchModuleLocks(envPath, envName, dataDir string, update bool) (map[string]ModuleLock, error) {
+	args := []string{"get"}
+	if update {
+		args = append(args, "-update")
+	}
+	cmdGet, err := envTerraformCommand(envPath, envName, args...)
+	if err != nil {
+		return nil, err
+	}
+	cmdGet.Env = append(cmdGet.Env, "TF_DATA_DIR="+absPath(dataDir))
+	if output, err := cmdGet.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("terraform get failed: %v, output: %s", err, string(output))
+	}
+
+	manifestPath := filepath.Join(dataDir, "modules", "modules.json")
+	data, err := os.ReadFile(manifestPath)
+	if os.IsNotExist(err) {
+		return map[string]ModuleLock{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read module manifest: %w", err)
+	}
+
+	var manifest struct {
+		Modules []struct {
+			Key     string `json:"Key"`
+			Source  string `json:"Source"`
+			Version string `json:"Version"`
+			Dir     string `json:"Dir"`
+		} `json:"Modules"`
+	}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse module manifest: %w", err)
+	}
+
+	locks := make(map[string]ModuleLock)
+	for _, m := range manifest.Modules {
+		if m.Key == "" || isLocalModuleSource(m.Source) {
+			continue
+		}
+		moduleDir := m.Dir
+		if !filepath.IsAbs(moduleDir) {
+			moduleDir = filepath.Join(cmdGet.Dir, moduleDir)
+		}
+		hash, err := hashDirectory(moduleDir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash module %s: %w", m.Key, err)
+		}
+		locks[m.Key] = ModuleLock{Source: m.Source, Version: m.Version, Hash: hash}
+	}
+	return locks, nil
+}
+
+// hashDirectory returns a sha256 over the relative paths and contents of every file in dir,
+// ignoring VCS metadata.
+func hashDirectory(dir string) (string, error) {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if info.Mode().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+
+	h := sha256.New()
+	for _, path := range files {
+		rel, _ := filepath.Rel(dir, path)
+		h.Write([]byte(filepath.ToSlash(rel)))
+		h.Write([]byte{0})
+
+		f, err := os.Open(path)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return "", err
+		}
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// sortedModuleKeys returns the union of the keys of both lock maps in sorted order.
+func sortedModuleKeys(a, b map[string]ModuleLock) []string {
+	seen := make(map[string]bool)
+	for key := range a {
+		seen[key] = true
+	}
+	for key := range b {
+		seen[key] = true
+	}
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,292 @@
+package netretry
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// ErrCircuitOpen is returned without contacting a host while its circuit is open.
+var ErrCircuitOpen = errors.New("circuit open")
+
+// Policy controls retries and circuit breaking for every outgoing request.
+type Policy struct {
+	// MaxAttempts is the total number of attempts per request, including the first.
+	MaxAttempts int
+	// BaseDelay and MaxDelay bound the jittered exponential backoff between attempts.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// BreakerThreshold consecutive failures against a host open its circuit for BreakerCooldown.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+// DefaultPolicy is used unless Configure is called.
+var DefaultPolicy = Policy{
+	MaxAttempts:      4,
+	BaseDelay:        500 * time.Millisecond,
+	MaxDelay:         30 * time.Second,
+	BreakerThreshold: 5,
+	BreakerCooldown:  time.Minute,
+}
+
+var (
+	mu       sync.Mutex
+	policy   = DefaultPolicy
+	breakers = make(map[string]*breaker)
+)
+
+// breaker tracks consecutive failures against one host.
+type breaker struct {
+	failures  int
+	openUntil time.Time
+}
+
+// Configure replaces the policy for all subsequent requests.
+func Configure(p Policy) {
+	mu.Lock()
+	defer mu.Unlock()
+	policy = p
+}
+
+// Current returns the policy in effect.
+func Current() Policy {
+	mu.Lock()
+	defer mu.Unlock()
+	return policy
+}
+
+// PolicyFromEnv returns DefaultPolicy overridden by TFVENV_HTTP_RETRIES,
+// TFVENV_HTTP_RETRY_BASE_DELAY, TFVENV_HTTP_RETRY_MAX_DELAY,
+// TFVENV_HTTP_BREAKER_THRESHOLD and TFVENV_HTTP_BREAKER_COOLDOWN.
+func PolicyFromEnv() (Policy, error) {
+	p := DefaultPolicy
+	ints := map[string]*int{
+		"TFVENV_HTTP_RETRIES":           &p.MaxAttempts,
+		"TFVENV_HTTP_BREAKER_THRESHOLD": &p.BreakerThreshold,
+	}
+	for name, target := range ints {
+		if value := os.Getenv(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return DefaultPolicy, fmt.Errorf("invalid %s %q: expected a non-negative integer", name, value)
+			}
+			*target = n
+		}
+	}
+	durations := map[string]*time.Duration{
+		"TFVENV_HTTP_RETRY_BASE_DELAY": &p.BaseDelay,
+		"TFVENV_HTTP_RETRY_MAX_DELAY":  &p.MaxDelay,
+		"TFVENV_HTTP_BREAKER_COOLDOWN": &p.BreakerCooldown,
+	}
+	for name, target := range durations {
+		if value := os.Getenv(name); value != "" {
+			d, err := time.ParseDuration(value)
+			if err != nil || d < 0 {
+				return DefaultPolicy, fmt.Errorf("invalid %s %q: expected a duration such as 2s", name, value)
+			}
+			*target = d
+		}
+	}
+	if p.MaxAttempts < 1 {
+		p.MaxAttempts = 1
+	}
+	return p, nil
+}
+
+// Transport retries idempotent requests on network errors, 429 and 5xx
+// responses, and fails fast while the target host's circuit is open.
+type Transport struct {
+	Base http.RoundTripper
+}
+
+// NewClient returns an HTTP client that uses Transport on top of http.DefaultTransport,
+// within the rate limit.
+func NewClient(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: &Transport{Base: &limitTransport{Base: http.DefaultTransport}}}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	p := Current()
+	host := req.URL.Host
+	attempts := p.MaxAttempts
+	if !isIdempotent(req.Method) || (req.Body != nil && req.GetBody == nil) {
+		attempts = 1
+	}
+
+	var resp *http.Response
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if err := allow(host, p); err != nil {
+			return nil, err
+		}
+		attemptReq := req
+		if attempt > 0 && req.GetBody != nil {
+			body, bodyErr := req.GetBody()
+			if bodyErr != nil {
+				return nil, bodyErr
+			}
+			attemptReq = req.Clone(req.Context())
+			attemptReq.Body = body
+		}
+
+		resp, err = t.Base.RoundTrip(withUserAgent(attemptReq))
+		if err == nil && !retryableStatus(resp.StatusCode) {
+			record(host, true, p)
+			return resp, nil
+		}
+		record(host, false, p)
+		if attempt == attempts-1 {
+			break
+		}
+
+		delay := backoff(p, attempt)
+		if resp != nil {
+			if retryAfter := parseRetryAfter(resp.Header.Get("Retry-After")); retryAfter > 0 {
+				delay = retryAfter
+				if p.MaxDelay > 0 && delay > p.MaxDelay {
+					delay = p.MaxDelay
+				}
+			}
+			resp.Body.Close()
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+	return resp, err
+}
+
+// ApplyAWS makes an AWS session retry with the shared policy, take part in
+// circuit breaking, keep to the rate limit and identify tfvenv in its
+// User-Agent. Call it before creating service clients from the session.
+func ApplyAWS(sess *session.Session) {
+	p := Current()
+	applyAWSUserAgent(sess)
+	if sess.Config.HTTPClient == nil || sess.Config.HTTPClient == http.DefaultClient {
+		sess.Config.HTTPClient = &http.Client{Transport: &limitTransport{Base: http.DefaultTransport}}
+	}
+	sess.Config.Retryer = client.DefaultRetryer{
+		NumMaxRetries:    p.MaxAttempts - 1,
+		MinRetryDelay:    p.BaseDelay,
+		MaxRetryDelay:    p.MaxDelay,
+		MinThrottleDelay: p.BaseDelay,
+		MaxThrottleDelay: p.MaxDelay,
+	}
+	sess.Handlers.Validate.PushBack(func(r *request.Request) {
+		if err := allow(awsHost(r), Current()); err != nil {
+			r.Error = err
+		}
+	})
+	sess.Handlers.Complete.PushBack(func(r *request.Request) {
+		failed := r.Error != nil && (r.HTTPResponse == nil || retryableStatus(r.HTTPResponse.StatusCode))
+		if errors.Is(r.Error, ErrCircuitOpen) {
+			return
+		}
+		record(awsHost(r), !failed, Current())
+	})
+}
+
+// awsHost identifies the service endpoint of an AWS request.
+func awsHost(r *request.Request) string {
+	if u, err := url.Parse(r.ClientInfo.Endpoint); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return r.ClientInfo.ServiceName
+}
+
+// allow returns ErrCircuitOpen while the host's circuit is open.
+func allow(host string, p Policy) error {
+	if p.BreakerThreshold == 0 {
+		return nil
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	b, ok := breakers[host]
+	if !ok || b.openUntil.IsZero() {
+		return nil
+	}
+	if remaining := time.Until(b.openUntil); remaining > 0 {
+		return fmt.Errorf("%w: %s failed %d times in a row, retry in %s", ErrCircuitOpen, host, b.failures, remaining.Round(time.Second))
+	}
+	// Cooldown over: let requests through, a single failure reopens the circuit
+	return nil
+}
+
+// record updates the host's breaker with the outcome of an attempt.
+func record(host string, ok bool, p Policy) {
+	if p.BreakerThreshold == 0 {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	b, exists := breakers[host]
+	if !exists {
+		b = &breaker{}
+		breakers[host] = b
+	}
+	if ok {
+		b.failures = 0
+		b.openUntil = time.Time{}
+		return
+	}
+	b.failures++
+	if b.failures >= p.BreakerThreshold {
+		b.openUntil = time.Now().Add(p.BreakerCooldown)
+	}
+}
+
+// backoff returns a full-jitter exponential delay for the given retry.
+func backoff(p Policy, attempt int) time.Duration {
+	ceiling := p.BaseDelay << uint(attempt)
+	if ceiling <= 0 || (p.MaxDelay > 0 && ceiling > p.MaxDelay) {
+		ceiling = p.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
+
+// retryableStatus reports whether a response status is worth retrying.
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// isIdempotent reports whether a request with the method can be repeated safely.
+func isIdempotent(method string) bool {
+	switch method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package netretry
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// limiter paces the bodies of every request and response so that together
+// they do not exceed rate bytes per second.
+var limiter struct {
+	sync.Mutex
+	rate int64
+	next time.Time
+}
+
+// SetRateLimit limits the combined transfer rate of all downloads and uploads
+// to bytesPerSecond. Zero removes the limit.
+func SetRateLimit(bytesPerSecond int64) {
+	limiter.Lock()
+	defer limiter.Unlock()
+	limiter.rate = bytesPerSecond
+	limiter.next = time.Time{}
+}
+
+// RateLimit returns the transfer rate limit in bytes per second, or 0.
+func RateLimit() int64 {
+	limiter.Lock()
+	defer limiter.Unlock()
+	return limiter.rate
+}
+
+// limitTransport applies the rate limit to the bodies of requests and responses.
+type limitTransport struct {
+	Base http.RoundTripper
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if RateLimit() > 0 && req.Body != nil && req.Body != http.NoBody {
+		req = req.Clone(req.Context())
+		req.Body = &limitedBody{ReadCloser: req.Body}
+	}
+	resp, err := t.Base.RoundTrip(req)
+	if err == nil && RateLimit() > 0 && resp.Body != nil {
+		resp.Body = &limitedBody{ReadCloser: resp.Body}
+	}
+	return resp, err
+}
+
+// limitedBody is a body read no faster than the rate limit allows.
+type limitedBody struct {
+	io.ReadCloser
+}
+
+// Read reads at most a tenth of a second's worth of data, then waits until
+// the limit allows it.
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if chunk := chunkSize(); len(p) > chunk {
+		p = p[:chunk]
+	}
+	n, err := b.ReadCloser.Read(p)
+	wait(n)
+	return n, err
+}
+
+// chunkSize is how much a limited body reads at once: small enough to keep
+// the rate smooth, large enough not to make many tiny reads.
+func chunkSize() int {
+	chunk := RateLimit() / 10
+	switch {
+	case chunk < 1024:
+		return 1024
+	case chunk > 64*1024:
+		return 64 * 1024
+	}
+	return int(chunk)
+}
+
+// wait blocks until n more bytes may be transferred under the rate limit.
+func wait(n int) {
+	if n <= 0 {
+		return
+	}
+	limiter.Lock()
+	if limiter.rate <= 0 {
+		limiter.Unlock()
+		return
+	}
+	now := time.Now()
+	if limiter.next.Before(now) {
+		limiter.next = now
+	}
+	delay := limiter.next.Sub(now)
+	limiter.next = limiter.next.Add(time.Duration(float64(n) / float64(limiter.rate) * float64(time.Second)))
+	limiter.Unlock()
+	time.Sleep(delay)
+}
@@ -0,0 +1,57 @@
+package netretry
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+var (
+	userAgentMu sync.Mutex
+	userAgent   string
+)
+
+// SetUserAgent sets the User-Agent sent with every HTTP request that does not
+// set its own, and appended to the SDK's on AWS requests. Control characters
+// are dropped so a configured value cannot add header lines.
+func SetUserAgent(ua string) {
+	ua = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, ua)
+	userAgentMu.Lock()
+	defer userAgentMu.Unlock()
+	userAgent = strings.TrimSpace(ua)
+}
+
+// UserAgent returns the User-Agent set with SetUserAgent.
+func UserAgent() string {
+	userAgentMu.Lock()
+	defer userAgentMu.Unlock()
+	return userAgent
+}
+
+// withUserAgent returns req with the User-Agent set, unless it has one.
+func withUserAgent(req *http.Request) *http.Request {
+	ua := UserAgent()
+	if ua == "" || req.Header.Get("User-Agent") != "" {
+		return req
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", ua)
+	return req
+}
+
+// applyAWSUserAgent appends the User-Agent to that of the session's requests.
+func applyAWSUserAgent(sess *session.Session) {
+	sess.Handlers.Build.PushBack(func(r *request.Request) {
+		if ua := UserAgent(); ua != "" {
+			request.AddToUserAgent(r, ua)
+		}
+	})
+}
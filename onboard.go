@@ -0,0 +1,553 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	version "github.com/hashicorp/go-version"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zclconf/go-cty/cty"
+	"golang.org/x/term"
+
+	"tfvenv/i18n"
+)
+
+// Markers around the block init adds to bash and zsh startup files, so that
+// rerunning it replaces the block instead of adding another.
+const (
+	shellSetupBegin = "# >>> tfvenv >>>"
+	shellSetupEnd   = "# <<< tfvenv <<<"
+)
+
+// requiredVersionSchema extracts the version constraints of a Terraform
+// configuration or a Terragrunt unit.
+var requiredVersionSchema = &hcl.BodySchema{
+	Blocks: []hcl.BlockHeaderSchema{{Type: "terraform"}},
+	Attributes: []hcl.AttributeSchema{
+		{Name: "terraform_version_constraint"},
+		{Name: "terragrunt_version_constraint"},
+	},
+}
+
+// terraformBlockSchema extracts required_version from a terraform block.
+var terraformBlockSchema = &hcl.BodySchema{
+	Attributes: []hcl.AttributeSchema{{Name: "required_version"}},
+}
+
+// envNameUnsafe matches the characters that are replaced in proposed environment names.
+var envNameUnsafe = regexp.MustCompile(`[^a-z0-9_-]+`)
+
+// detectedProject is a Terraform or Terragrunt project found by init, and the
+// environment proposed for it.
+type detectedProject struct {
+	Dir       string // relative to the working directory
+	Name      string
+	Tool      string
+	TfVersion string
+	TgVersion string
+	// Constraints the versions were chosen from, for display
+	TfConstraint string
+	TgConstraint string
+}
+
+// initCmd sets up tfvenv for the projects in the working directory.
+func initCmd() *cobra.Command {
+	var yes, dryRun, force, noShell bool
+	var shell string
+
+	cmd := &cobra.Command{
+		Use:   "init",
+		Short: "Detect the Terraform projects in the current directory and write a " + manifestFileName + " for them",
+		Long: `Look for Terraform and Terragrunt projects in the current directory and
+propose an environment for each, with versions chosen from the projects'
+required_version and version constraints. The accepted proposals are written
+to ` + manifestFileName + `, from which 'tfvenv up' creates the environments.
+init then offers to add shell completions and a tfvenv_activate function to
+the shell's startup files.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			cwd, err := os.Getwd()
+			if err != nil {
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			manifestPath := filepath.Join(cwd, manifestFileName)
+			if fileExists(manifestPath) && !force {
+				fmt.Printf("%s already exists; run 'tfvenv up' to create its environments, or pass --force to replace it.\n", manifestPath)
+				os.Exit(1)
+			}
+
+			projects, err := detectProjects(cwd)
+			if err != nil {
+				logger.Errorf("error scanning %s: %v", cwd, err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			if len(projects) == 0 {
+				fmt.Printf("No Terraform or Terragrunt projects found in %s.\n", cwd)
+				fmt.Println("Run 'tfvenv create <env-name>' to create an environment by hand.")
+				return
+			}
+
+			interactive := !yes && term.IsTerminal(int(os.Stdin.Fd()))
+			fmt.Printf("Found %d project(s):\n", len(projects))
+			for i := range projects {
+				printDetectedProject(projects[i])
+				if interactive {
+					reviewProject(&projects[i])
+				}
+			}
+			if err := checkProjectNames(projects); err != nil {
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+
+			content := renderInitManifest(projects, "tfvenv init")
+			if dryRun {
+				printDryRun("would write %s:", manifestPath)
+				fmt.Print(string(content))
+			} else {
+				if err := os.WriteFile(manifestPath, content, 0644); err != nil {
+					logger.Errorf("error writing %s: %v", manifestPath, err)
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+				summary.fileWritten(manifestPath)
+				fmt.Printf("Wrote %s.\n", manifestPath)
+			}
+
+			if !noShell {
+				if shell == "" {
+					shell = detectShell()
+				}
+				setup := yes
+				if interactive {
+					setup, _ = confirm(fmt.Sprintf("Add tfvenv completions and the tfvenv_activate function to your %s startup file?", shell))
+				}
+				if setup {
+					if err := installShellSetup(shell, viper.GetString("env-dir"), dryRun); err != nil {
+						logger.Errorf("error setting up %s: %v", shell, err)
+						i18n.Println("error", err)
+						os.Exit(1)
+					}
+				}
+			}
+
+			if !dryRun {
+				fmt.Println("Next: run 'tfvenv up' to create the environments, then copy or link each project into its environment's config directory.")
+			}
+		},
+	}
+
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Accept the proposals and set up the shell without asking")
+	cmd.Flags().BoolVar(&force, "force", false, "Replace an existing "+manifestFileName)
+	cmd.Flags().BoolVar(&noShell, "no-shell-setup", false, "Do not offer to change the shell's startup files")
+	cmd.Flags().StringVar(&shell, "shell", "", "Shell to set up: bash, zsh, fish or powershell (defaults to $SHELL)")
+	addDryRunFlag(cmd, &dryRun)
+	cmd.RegisterFlagCompletionFunc("shell", cobra.FixedCompletions([]string{"bash", "zsh", "fish", "powershell"}, cobra.ShellCompDirectiveNoFileComp))
+	return cmd
+}
+
+// detectProjects finds the directories under dir holding .tf or .tofu files
+// or a terragrunt.hcl, outermost first, and proposes an environment for each.
+// Like root module discovery, it does not look inside a project it found or
+// inside directories named modules.
+func detectProjects(dir string) ([]detectedProject, error) {
+	releases := releaseLookup()
+	var projects []detectedProject
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if path != dir && (rootModuleSkipDirs[info.Name()] || hclfmtSkipDirs[info.Name()] || strings.HasPrefix(info.Name(), ".")) {
+			return filepath.SkipDir
+		}
+		tfFiles, _ := filepath.Glob(filepath.Join(path, "*.tf"))
+		tofuFiles, _ := filepath.Glob(filepath.Join(path, "*.tofu"))
+		terragrunt := fileExists(filepath.Join(path, "terragrunt.hcl"))
+		if len(tfFiles) == 0 && len(tofuFiles) == 0 && !terragrunt {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		project := detectedProject{Dir: rel, Tool: toolTerraform, TgVersion: "none"}
+		if len(tofuFiles) > 0 {
+			project.Tool = toolTofu
+		}
+		project.TfConstraint, project.TgConstraint = projectConstraints(path, append(tfFiles, tofuFiles...), terragrunt)
+		project.TfVersion = versionForConstraint(releases(project.Tool), project.TfConstraint)
+		if terragrunt {
+			project.TgVersion = versionForConstraint(releases("terragrunt"), project.TgConstraint)
+		}
+		projects = append(projects, project)
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return nil, err
+	}
+	nameProjects(dir, projects)
+	return projects, nil
+}
+
+// releaseLookup returns a lookup of each tool's recent releases, newest
+// first. Each tool's releases are fetched once, and only if asked for.
+func releaseLookup() func(tool string) func() []string {
+	fetched := make(map[string][]string)
+	return func(tool string) func() []string {
+		return func() []string {
+			if list, ok := fetched[tool]; ok {
+				return list
+			}
+			list, err := recentReleases(tool, maxCachedReleases)
+			if err != nil {
+				logger.Warnf("failed to look up %s releases: %v", tool, err)
+			}
+			fetched[tool] = list
+			return list
+		}
+	}
+}
+
+// nameProjects names each project after its directory. Names that clash fall
+// back to the project's whole path.
+func nameProjects(dir string, projects []detectedProject) {
+	counts := make(map[string]int)
+	for _, project := range projects {
+		counts[proposedEnvName(dir, project.Dir, false)]++
+	}
+	for i := range projects {
+		name := proposedEnvName(dir, projects[i].Dir, false)
+		if counts[name] > 1 {
+			name = proposedEnvName(dir, projects[i].Dir, true)
+		}
+		projects[i].Name = name
+	}
+}
+
+// proposedEnvName turns a project directory into an environment name.
+func proposedEnvName(base, rel string, fullPath bool) string {
+	name := filepath.Base(rel)
+	switch {
+	case rel == ".":
+		name = filepath.Base(base)
+	case fullPath:
+		name = strings.ReplaceAll(filepath.ToSlash(rel), "/", "-")
+	}
+	name = strings.Trim(envNameUnsafe.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if name == "" || name == "previous" {
+		name = "default"
+	}
+	return name
+}
+
+// projectConstraints returns the Terraform and Terragrunt version constraints
+// of a project: required_version from its .tf files, and the
+// terraform_version_constraint and terragrunt_version_constraint of its
+// terragrunt.hcl. Files that do not parse are skipped.
+func projectConstraints(dir string, tfFiles []string, terragrunt bool) (string, string) {
+	parser := hclparse.NewParser()
+	var tfConstraints []string
+	for _, path := range tfFiles {
+		file, diags := parser.ParseHCLFile(path)
+		if diags.HasErrors() {
+			logger.Warnf("failed to parse %s: %s", path, diags.Error())
+			continue
+		}
+		content, _, _ := file.Body.PartialContent(requiredVersionSchema)
+		for _, block := range content.Blocks {
+			blockContent, _, _ := block.Body.PartialContent(terraformBlockSchema)
+			if c := stringAttribute(blockContent, "required_version"); c != "" {
+				tfConstraints = append(tfConstraints, c)
+			}
+		}
+	}
+
+	var tgConstraint string
+	if terragrunt {
+		path := filepath.Join(dir, "terragrunt.hcl")
+		file, diags := parser.ParseHCLFile(path)
+		if diags.HasErrors() {
+			logger.Warnf("failed to parse %s: %s", path, diags.Error())
+		} else {
+			content, _, _ := file.Body.PartialContent(requiredVersionSchema)
+			if c := stringAttribute(content, "terraform_version_constraint"); c != "" {
+				tfConstraints = append(tfConstraints, c)
+			}
+			tgConstraint = stringAttribute(content, "terragrunt_version_constraint")
+		}
+	}
+	return strings.Join(tfConstraints, ", "), tgConstraint
+}
+
+// stringAttribute returns the value of a literal string attribute, or "".
+func stringAttribute(content *hcl.BodyContent, name string) string {
+	attr, ok := content.Attributes[name]
+	if !ok {
+		return ""
+	}
+	value, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() || value.IsNull() || !value.IsKnown() || value.Type() != cty.String {
+		return ""
+	}
+	return value.AsString()
+}
+
+// versionForConstraint returns the newest of the releases, newest first, that
+// meets constraint, or "latest" when there is no constraint or no release
+// meets it. A constraint that names one exact version yields that version
+// even when it is not among the releases.
+func versionForConstraint(releases func() []string, constraint string) string {
+	if strings.TrimSpace(constraint) == "" {
+		return "latest"
+	}
+	constraints, err := version.NewConstraint(constraint)
+	if err != nil {
+		logger.Warnf("ignoring invalid version constraint %q: %v", constraint, err)
+		return "latest"
+	}
+	for _, release := range releases() {
+		if v, err := version.NewVersion(release); err == nil && constraints.Check(v) {
+			return release
+		}
+	}
+	exact := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(constraint), "="))
+	if v, err := version.NewVersion(exact); err == nil {
+		return v.String()
+	}
+	logger.Warnf("no recent release meets %q", constraint)
+	return "latest"
+}
+
+// printDetectedProject prints a proposal.
+func printDetectedProject(project detectedProject) {
+	fmt.Printf("  %s -> environment '%s': %s %s", project.Dir, project.Name, toolDisplayName(project.Tool), project.TfVersion)
+	if project.TfConstraint != "" {
+		fmt.Printf(" (required %s)", project.TfConstraint)
+	}
+	if project.TgVersion != "none" {
+		fmt.Printf(", Terragrunt %s", project.TgVersion)
+		if project.TgConstraint != "" {
+			fmt.Printf(" (required %s)", project.TgConstraint)
+		}
+	}
+	fmt.Println()
+}
+
+// reviewProject lets the user change a proposal's name and versions.
+func reviewProject(project *detectedProject) {
+	project.Name = prompt("    Environment name", project.Name)
+	project.TfVersion = prompt(fmt.Sprintf("    %s version", toolDisplayName(project.Tool)), project.TfVersion)
+	project.TgVersion = prompt("    Terragrunt version (none to skip)", project.TgVersion)
+}
+
+// prompt asks for a value on the terminal, returning def for an empty answer.
+func prompt(question, def string) string {
+	fmt.Fprintf(os.Stderr, "%s [%s]: ", question, def)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.TrimSpace(answer)
+	if err != nil || answer == "" {
+		return def
+	}
+	return answer
+}
+
+// checkProjectNames rejects names and versions the manifest would not accept.
+func checkProjectNames(projects []detectedProject) error {
+	seen := make(map[string]bool)
+	for _, project := range projects {
+		if project.Name == "" || strings.ToLower(project.Name) == "previous" || strings.ContainsAny(project.Name, `/\`) {
+			return fmt.Errorf("'%s' cannot be used as an environment name", project.Name)
+		}
+		if seen[project.Name] {
+			return fmt.Errorf("environment '%s' is proposed twice", project.Name)
+		}
+		seen[project.Name] = true
+		for _, v := range []string{project.TfVersion, project.TgVersion} {
+			if v == "latest" || v == "none" {
+				continue
+			}
+			if _, err := version.NewVersion(v); err != nil {
+				return fmt.Errorf("%q is not a valid version", v)
+			}
+		}
+	}
+	return nil
+}
+
+// renderInitManifest writes the proposals as a manifest, noting the command
+// that wrote it and the project each environment was proposed for.
+func renderInitManifest(projects []detectedProject, command string) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "# Written by '%s'. Run 'tfvenv up' to create the environments.\n", command)
+	fmt.Fprintf(&buf, "env_dir: environments\n")
+	fmt.Fprintf(&buf, "environments:\n")
+	sorted := append([]detectedProject(nil), projects...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	for _, project := range sorted {
+		fmt.Fprintf(&buf, "  # project: %s\n", filepath.ToSlash(project.Dir))
+		fmt.Fprintf(&buf, "  - name: %s\n", project.Name)
+		if project.Tool != toolTerraform {
+			fmt.Fprintf(&buf, "    tool: %s\n", project.Tool)
+		}
+		fmt.Fprintf(&buf, "    tf_version: %s\n", project.TfVersion)
+		fmt.Fprintf(&buf, "    tg_version: %s\n", project.TgVersion)
+	}
+	return buf.Bytes()
+}
+
+// detectShell returns the user's shell from $SHELL, or powershell on Windows.
+func detectShell() string {
+	switch filepath.Base(os.Getenv("SHELL")) {
+	case "zsh":
+		return "zsh"
+	case "fish":
+		return "fish"
+	case "bash":
+		return "bash"
+	}
+	if os.Getenv("PSModulePath") != "" && os.Getenv("SHELL") == "" {
+		return "powershell"
+	}
+	return "bash"
+}
+
+// installShellSetup loads tfvenv's completions and defines tfvenv_activate,
+// which sources an environment's activation script by name. Bash and zsh get
+// a marked block in their rc file, fish a file of its own in conf.d.
+// PowerShell profiles are left to the user.
+func installShellSetup(shell, envDir string, dryRun bool) error {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return err
+	}
+	if abs, err := filepath.Abs(envDir); err == nil {
+		envDir = abs
+	}
+
+	var path, block string
+	switch shell {
+	case "bash":
+		path = filepath.Join(home, ".bashrc")
+		block = fmt.Sprintf("source <(tfvenv completion bash)\ntfvenv_activate() { source %s/\"$1\"/bin/activate.sh; }\n", escapeBash(envDir))
+	case "zsh":
+		dir := os.Getenv("ZDOTDIR")
+		if dir == "" {
+			dir = home
+		}
+		path = filepath.Join(dir, ".zshrc")
+		block = fmt.Sprintf("(( $+functions[compdef] )) || { autoload -U compinit && compinit; }\nsource <(tfvenv completion zsh)\ntfvenv_activate() { source %s/\"$1\"/bin/activate.sh; }\n", escapeBash(envDir))
+	case "fish":
+		path = filepath.Join(home, ".config", "fish", "conf.d", "tfvenv.fish")
+		content := fmt.Sprintf("tfvenv completion fish | source\nfunction tfvenv_activate\n    source %s/$argv[1]/bin/activate.fish\nend\n", escapeFish(envDir))
+		if dryRun {
+			printDryRun("would write %s", path)
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			return err
+		}
+		summary.fileWritten(path)
+		fmt.Printf("Wrote %s; open a new shell to use it.\n", path)
+		return nil
+	case "powershell":
+		fmt.Println("Add this to your PowerShell profile ($PROFILE):")
+		fmt.Println("  tfvenv completion powershell | Out-String | Invoke-Expression")
+		fmt.Printf("  function tfvenv_activate($name) { . \"%s\\$name\\bin\\Activate.ps1\" }\n", envDir)
+		return nil
+	default:
+		return fmt.Errorf("unsupported shell %q (use bash, zsh, fish or powershell)", shell)
+	}
+
+	if dryRun {
+		printDryRun("would add the tfvenv block to %s", path)
+		return nil
+	}
+	if err := writeShellBlock(path, block); err != nil {
+		return err
+	}
+	summary.fileWritten(path)
+	fmt.Printf("Updated %s; open a new shell to use it.\n", path)
+	return nil
+}
+
+// writeShellBlock puts block between the tfvenv markers in an rc file,
+// replacing an earlier block and keeping everything else.
+func writeShellBlock(path, block string) error {
+	return writeMarkedBlock(path, shellSetupBegin, shellSetupEnd, block)
+}
+
+// writeMarkedBlock puts block between the begin and end markers in a file,
+// replacing an earlier block and keeping everything else.
+func writeMarkedBlock(path, beginMarker, endMarker, block string) error {
+	content, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	wrapped := beginMarker + "\n" + block + endMarker + "\n"
+
+	text := string(content)
+	begin := strings.Index(text, beginMarker)
+	end := strings.Index(text, endMarker)
+	switch {
+	case begin >= 0 && end > begin:
+		text = text[:begin] + wrapped + strings.TrimPrefix(text[end+len(endMarker):], "\n")
+	case text == "" || strings.HasSuffix(text, "\n"):
+		text += wrapped
+	default:
+		text += "\n" + wrapped
+	}
+	return writeKeepingMode(path, text)
+}
+
+// removeMarkedBlock deletes the block between the begin and end markers from
+// a file, and reports whether there was one.
+func removeMarkedBlock(path, beginMarker, endMarker string) (bool, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	text := string(content)
+	begin := strings.Index(text, beginMarker)
+	end := strings.Index(text, endMarker)
+	if begin < 0 || end < begin {
+		return false, nil
+	}
+	text = text[:begin] + strings.TrimPrefix(text[end+len(endMarker):], "\n")
+	return true, writeKeepingMode(path, text)
+}
+
+// writeKeepingMode writes a startup file, keeping the mode of an existing one.
+func writeKeepingMode(path, text string) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	if err := os.WriteFile(path, []byte(text), mode); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// pathDedupeMarker is written into activation scripts that drop stale
+// environment directories from PATH, so doctor can tell older scripts apart.
+const pathDedupeMarker = "# tfvenv: de-duplicate PATH"
+
+// rcFileBackupSuffix is appended to an rc file doctor --fix-path changes.
+const rcFileBackupSuffix = ".tfvenv-bak"
+
+// staleRcAssignment matches rc file lines that set a variable only the
+// activation scripts should set, in bash/zsh, fish or PowerShell syntax.
+// Settings such as TFVENV_LIMIT_RATE are left alone.
+var staleRcAssignment = regexp.MustCompile(`^\s*(?:(?:export\s+)?(?:TFVENV_(?:PATH|ENV|TOOL|MODULES_DIR|READ_ONLY)|INITIAL_(?:PATH|PS1|PROMPT))=|set\s+(?:-\w+\s+)*(?:TFVENV_(?:PATH|ENV|TOOL|MODULES_DIR|READ_ONLY)|INITIAL_(?:PATH|PROMPT))\b|(?i:\$env:(?:TFVENV_(?:PATH|ENV|TOOL|MODULES_DIR|READ_ONLY)|INITIAL_PATH))\s*=)`)
+
+// staleRcLine is a line of an rc file that sets an activation variable.
+type staleRcLine struct {
+	Number int
+	Text   string
+}
+
+// checkDoctorPath reports environment bin directories that are on PATH more
+// than once or left over from another environment, and activation scripts
+// written before they de-duplicated PATH.
+func checkDoctorPath(envPath string) doctorResult {
+	result := doctorResult{Name: "path"}
+	var problems []string
+
+	activate, err := os.ReadFile(filepath.Join(envPath, "bin", "activate.sh"))
+	if err == nil && !bytes.Contains(activate, []byte(pathDedupeMarker)) {
+		problems = append(problems, "activation scripts do not de-duplicate PATH")
+	}
+
+	envBin := filepath.Join(envPath, "bin")
+	if n := pathEntryCount(envBin); n > 1 {
+		problems = append(problems, fmt.Sprintf("%s is on PATH %d times", envBin, n))
+	}
+	for _, dir := range foreignEnvBinDirs(envBin) {
+		problems = append(problems, fmt.Sprintf("%s of another environment is on PATH", dir))
+	}
+
+	if len(problems) == 0 {
+		result.Status = doctorOK
+		result.Detail = "no duplicate or stale environment entries"
+		return result
+	}
+	result.Status = doctorWarn
+	result.Detail = strings.Join(problems, "; ")
+	result.Hint = "Run 'tfvenv doctor --fix-path' and activate the environment again in a new shell."
+	return result
+}
+
+// checkDoctorRcFiles reports lines of the shell startup files that set the
+// activation variables, which make later activations think one is still active.
+func checkDoctorRcFiles() doctorResult {
+	result := doctorResult{Name: "rc files"}
+	var found []string
+	for _, path := range shellRcFiles() {
+		lines, err := staleRcLines(path)
+		if err != nil {
+			logger.Warnf("failed to read %s: %v", path, err)
+			continue
+		}
+		for _, line := range lines {
+			found = append(found, fmt.Sprintf("%s:%d", path, line.Number))
+		}
+	}
+	if len(found) == 0 {
+		result.Status = doctorOK
+		result.Detail = "no activation variables set at startup"
+		return result
+	}
+	result.Status = doctorWarn
+	result.Detail = "activation variables set at " + strings.Join(found, ", ")
+	result.Hint = "Run 'tfvenv doctor --fix-path' to remove them."
+	return result
+}
+
+// pathEntryCount counts how often dir appears on PATH.
+func pathEntryCount(dir string) int {
+	count := 0
+	for _, entry := range filepath.SplitList(os.Getenv("PATH")) {
+		if samePathEntry(entry, dir) {
+			count++
+		}
+	}
+	return count
+}
+
+// foreignEnvBinDirs returns the PATH entries that are the bin directory of an
+// environment other than the one whose bin directory is envBin.
+func foreignEnvBinDirs(envBin string) []string {
+	var dirs []string
+	for _, entry := range filepath.SplitList(os.Getenv("PATH")) {
+		if entry == "" || samePathEntry(entry, envBin) || filepath.Base(filepath.Clean(entry)) != "bin" {
+			continue
+		}
+		if fileExists(filepath.Join(entry, "activate.sh")) && fileExists(filepath.Join(entry, "deactivate.sh")) {
+			dirs = append(dirs, entry)
+		}
+	}
+	return dirs
+}
+
+// samePathEntry reports whether a PATH entry names dir, ignoring case on Windows.
+func samePathEntry(entry, dir string) bool {
+	entry, dir = filepath.Clean(entry), filepath.Clean(dir)
+	if runtime.GOOS == "windows" {
+		return strings.EqualFold(entry, dir)
+	}
+	return entry == dir
+}
+
+// shellRcFiles returns the startup files of bash, zsh, fish and PowerShell
+// that exist for the current user.
+func shellRcFiles() []string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil
+	}
+	zdotdir := os.Getenv("ZDOTDIR")
+	if zdotdir == "" {
+		zdotdir = home
+	}
+	candidates := []string{
+		filepath.Join(home, ".bashrc"),
+		filepath.Join(home, ".bash_profile"),
+		filepath.Join(home, ".profile"),
+		filepath.Join(zdotdir, ".zshrc"),
+		filepath.Join(zdotdir, ".zprofile"),
+		filepath.Join(home, ".config", "fish", "config.fish"),
+		filepath.Join(home, ".config", "fish", "conf.d", "tfvenv.fish"),
+	}
+	if runtime.GOOS == "windows" {
+		candidates = append(candidates,
+			filepath.Join(home, "Documents", "PowerShell", "Microsoft.PowerShell_profile.ps1"),
+			filepath.Join(home, "Documents", "WindowsPowerShell", "Microsoft.PowerShell_profile.ps1"))
+	} else {
+		candidates = append(candidates, filepath.Join(home, ".config", "powershell", "Microsoft.PowerShell_profile.ps1"))
+	}
+
+	var files []string
+	for _, path := range candidates {
+		if fileExists(path) {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// staleRcLines returns the lines of an rc file that set an activation
+// variable. Lines inside the blocks tfvenv manages are skipped.
+func staleRcLines(path string) ([]staleRcLine, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []staleRcLine
+	inBlock := false
+	scanner := bufio.NewScanner(file)
+	for number := 1; scanner.Scan(); number++ {
+		text := scanner.Text()
+		trimmed := strings.TrimSpace(text)
+		switch {
+		case strings.HasPrefix(trimmed, "# >>> tfvenv"):
+			inBlock = true
+		case strings.HasPrefix(trimmed, "# <<< tfvenv"):
+			inBlock = false
+		case !inBlock && staleRcAssignment.MatchString(text):
+			lines = append(lines, staleRcLine{Number: number, Text: trimmed})
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// removeStaleRcLines drops the lines that set an activation variable from an
+// rc file, after copying it to a backup beside it. It returns the lines removed.
+func removeStaleRcLines(path string) ([]staleRcLine, error) {
+	lines, err := staleRcLines(path)
+	if err != nil || len(lines) == 0 {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if err := writeKeepingMode(path+rcFileBackupSuffix, string(content)); err != nil {
+		return nil, err
+	}
+
+	drop := make(map[int]bool, len(lines))
+	for _, line := range lines {
+		drop[line.Number] = true
+	}
+	var kept []string
+	for i, text := range strings.SplitAfter(string(content), "\n") {
+		if !drop[i+1] {
+			kept = append(kept, text)
+		}
+	}
+	if err := writeKeepingMode(path, strings.Join(kept, "")); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// fixEnvPath regenerates an environment's activation scripts so they
+// de-duplicate PATH, and removes activation variables from the rc files.
+func fixEnvPath(envPath, envName string) error {
+	if err := regenerateActivationScripts(envPath, envName); err != nil {
+		return fmt.Errorf("failed to regenerate the activation scripts: %w", err)
+	}
+	summary.fileWritten(filepath.Join(envPath, "bin", "activate.sh"))
+	fmt.Printf("Regenerated the activation scripts of %s.\n", envName)
+
+	for _, path := range shellRcFiles() {
+		removed, err := removeStaleRcLines(path)
+		if err != nil {
+			return err
+		}
+		if len(removed) == 0 {
+			continue
+		}
+		summary.fileWritten(path)
+		fmt.Printf("Removed from %s (backup in %s):\n", path, path+rcFileBackupSuffix)
+		for _, line := range removed {
+			fmt.Printf("  %d: %s\n", line.Number, line.Text)
+		}
+	}
+	fmt.Println("Open a new shell, or deactivate, before activating the environment again.")
+	return nil
+}
@@ -0,0 +1,165 @@
+package paths
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+)
+
+// appName is the directory name used inside each base directory.
+const appName = "tfvenv"
+
+// Resolver locates tfvenv's per-user data, cache and config directories
+// following the XDG base directory specification on Linux and the platform
+// conventions on macOS and Windows. TFVENV_DATA_DIR, TFVENV_CACHE_DIR and
+// TFVENV_CONFIG_DIR override the result on every platform.
+//
+// With TFVENV_SYSTEM set, or when there is no home directory and no data
+// directory was given, the machine-wide directories shared by every user of
+// the host are used instead.
+type Resolver struct {
+	Home   string
+	GOOS   string
+	Getenv func(string) string
+}
+
+// Default returns a resolver for the current user and platform.
+func Default() Resolver {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		home = os.Getenv("HOME")
+	}
+	return Resolver{Home: home, GOOS: runtime.GOOS, Getenv: os.Getenv}
+}
+
+// Shared reports whether the machine-wide directories are in use, because
+// TFVENV_SYSTEM asks for them or because there is no home directory to put
+// per-user ones in.
+func (r Resolver) Shared() bool {
+	if system, _ := strconv.ParseBool(r.Getenv("TFVENV_SYSTEM")); system {
+		return true
+	}
+	return r.Home == "" && r.Getenv("TFVENV_DATA_DIR") == ""
+}
+
+// DataDir holds state tfvenv cannot recreate.
+func (r Resolver) DataDir() string {
+	if dir := r.Getenv("TFVENV_DATA_DIR"); dir != "" {
+		return dir
+	}
+	if r.Shared() {
+		return r.systemDir("data")
+	}
+	if dir := r.Getenv("XDG_DATA_HOME"); dir != "" && r.GOOS != "windows" {
+		return filepath.Join(dir, appName)
+	}
+	switch r.GOOS {
+	case "windows":
+		return filepath.Join(r.windowsDir("LOCALAPPDATA", "Local"), appName)
+	case "darwin":
+		return filepath.Join(r.Home, "Library", "Application Support", appName)
+	}
+	return filepath.Join(r.Home, ".local", "share", appName)
+}
+
+// CacheDir holds downloads that can be fetched again, such as provider plugins.
+func (r Resolver) CacheDir() string {
+	if dir := r.Getenv("TFVENV_CACHE_DIR"); dir != "" {
+		return dir
+	}
+	if r.Shared() {
+		return r.systemDir("cache")
+	}
+	if dir := r.Getenv("XDG_CACHE_HOME"); dir != "" && r.GOOS != "windows" {
+		return filepath.Join(dir, appName)
+	}
+	if r.Home == "" {
+		return filepath.Join(r.DataDir(), "cache")
+	}
+	switch r.GOOS {
+	case "windows":
+		return filepath.Join(r.windowsDir("LOCALAPPDATA", "Local"), appName, "cache")
+	case "darwin":
+		return filepath.Join(r.Home, "Library", "Caches", appName)
+	}
+	return filepath.Join(r.Home, ".cache", appName)
+}
+
+// ConfigDir holds user settings.
+func (r Resolver) ConfigDir() string {
+	if dir := r.Getenv("TFVENV_CONFIG_DIR"); dir != "" {
+		return dir
+	}
+	if r.Shared() {
+		return r.systemDir("config")
+	}
+	if dir := r.Getenv("XDG_CONFIG_HOME"); dir != "" && r.GOOS != "windows" {
+		return filepath.Join(dir, appName)
+	}
+	if r.Home == "" {
+		return filepath.Join(r.DataDir(), "config")
+	}
+	switch r.GOOS {
+	case "windows":
+		return filepath.Join(r.windowsDir("APPDATA", "Roaming"), appName)
+	case "darwin":
+		return filepath.Join(r.Home, "Library", "Application Support", appName)
+	}
+	return filepath.Join(r.Home, ".config", appName)
+}
+
+// LegacyDir is the single ~/.tfvenv directory used before the XDG layout. It
+// is empty when there is no per-user directory to look in.
+func (r Resolver) LegacyDir() string {
+	if r.Home == "" || r.Shared() {
+		return ""
+	}
+	return filepath.Join(r.Home, ".tfvenv")
+}
+
+// PluginCacheDir is the provider plugin cache shared by every environment. An
+// existing ~/.tfvenv/plugin-cache keeps being used until it has been migrated.
+func (r Resolver) PluginCacheDir() string {
+	dir := filepath.Join(r.CacheDir(), "plugin-cache")
+	if _, err := os.Stat(dir); err == nil || r.LegacyDir() == "" {
+		return dir
+	}
+	legacy := filepath.Join(r.LegacyDir(), "plugin-cache")
+	if info, err := os.Lstat(legacy); err == nil && info.IsDir() {
+		return legacy
+	}
+	return dir
+}
+
+// systemDir returns one of the machine-wide directories: the FHS locations
+// /var/lib/tfvenv, /var/cache/tfvenv and /etc/tfvenv, or tfvenv under
+// ProgramData on Windows.
+func (r Resolver) systemDir(kind string) string {
+	if r.GOOS == "windows" {
+		root := r.Getenv("ProgramData")
+		if root == "" {
+			root = `C:\ProgramData`
+		}
+		if kind == "data" {
+			return filepath.Join(root, appName)
+		}
+		return filepath.Join(root, appName, kind)
+	}
+	switch kind {
+	case "cache":
+		return filepath.Join("/var/cache", appName)
+	case "config":
+		return filepath.Join("/etc", appName)
+	}
+	return filepath.Join("/var/lib", appName)
+}
+
+// windowsDir returns a Windows known folder from the environment, falling back
+// to its usual location under AppData.
+func (r Resolver) windowsDir(name, fallback string) string {
+	if dir := r.Getenv(name); dir != "" {
+		return dir
+	}
+	return filepath.Join(r.Home, "AppData", fallback)
+}
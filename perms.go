@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// permissionPolicy holds the modes tfvenv gives the files it generates.
+type permissionPolicy struct {
+	// Secret applies to files that carry environment variables or credentials.
+	Secret os.FileMode
+	// Script applies to generated scripts such as bin/activate.sh.
+	Script os.FileMode
+}
+
+// defaultPermissionPolicy keeps generated files private to their owner.
+var defaultPermissionPolicy = permissionPolicy{Secret: 0600, Script: 0700}
+
+// permissions is the policy in effect, set from the environment at startup.
+var permissions = defaultPermissionPolicy
+
+// permissionPolicyFromEnv returns defaultPermissionPolicy overridden by the
+// octal modes in TFVENV_SECRET_FILE_MODE and TFVENV_SCRIPT_MODE.
+func permissionPolicyFromEnv() (permissionPolicy, error) {
+	p := defaultPermissionPolicy
+	modes := []struct {
+		name   string
+		target *os.FileMode
+	}{
+		{"TFVENV_SECRET_FILE_MODE", &p.Secret},
+		{"TFVENV_SCRIPT_MODE", &p.Script},
+	}
+	for _, mode := range modes {
+		value := os.Getenv(mode.name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.ParseUint(value, 8, 32)
+		if err != nil || n > 0777 {
+			return defaultPermissionPolicy, fmt.Errorf("invalid %s %q: expected an octal mode such as 0600", mode.name, value)
+		}
+		*mode.target = os.FileMode(n)
+	}
+	if p.Secret&0600 != 0600 {
+		return defaultPermissionPolicy, fmt.Errorf("invalid TFVENV_SECRET_FILE_MODE %04o: the owner must be able to read and write", p.Secret)
+	}
+	if p.Script&0700 != 0700 {
+		return defaultPermissionPolicy, fmt.Errorf("invalid TFVENV_SCRIPT_MODE %04o: the owner must be able to read, write and execute", p.Script)
+	}
+	return p, nil
+}
+
+// writeSecretFile writes a file that may contain environment variables or credentials.
+func writeSecretFile(path string, data []byte) error {
+	return writeFileWithMode(path, data, permissions.Secret)
+}
+
+// writeScriptFile writes a generated script.
+func writeScriptFile(path string, data []byte) error {
+	return writeFileWithMode(path, data, permissions.Script)
+}
+
+// writeFileWithMode writes data to path and sets its mode explicitly, since
+// os.WriteFile applies the umask and keeps the mode of an existing file.
+func writeFileWithMode(path string, data []byte, mode os.FileMode) error {
+	if err := os.WriteFile(path, data, mode); err != nil {
+		return err
+	}
+	summary.fileWritten(path)
+	return os.Chmod(path, mode)
+}
+
+// secretFilePatterns match the environment files that carry environment variables.
+var secretFilePatterns = []string{tfvenvrcFileName, "*.tfvars", "terragrunt.*.hcl", cliConfigFileName, "*.env"}
+
+// isSecretFile reports whether a file name matches secretFilePatterns.
+func isSecretFile(name string) bool {
+	for _, pattern := range secretFilePatterns {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// permissiveFiles returns the environment's generated files whose mode grants
+// more than the policy allows, mapped to the mode they should have.
+func permissiveFiles(envPath, envName string) (map[string]os.FileMode, error) {
+	found := make(map[string]os.FileMode)
+	check := func(path string, allowed os.FileMode) error {
+		info, err := os.Stat(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if info.Mode().Perm()&^allowed != 0 {
+			found[path] = allowed
+		}
+		return nil
+	}
+
+	for _, script := range []string{"activate.sh", "activate.fish", "Activate.ps1", "deactivate.sh", "deactivate.fish", "Deactivate.ps1"} {
+		if err := check(filepath.Join(envPath, "bin", script), permissions.Script); err != nil {
+			return nil, err
+		}
+	}
+	if err := check(filepath.Join(envPath, cliConfigFileName), permissions.Secret); err != nil {
+		return nil, err
+	}
+
+	configEnvDir := filepath.Join(envPath, "config", envName)
+	entries, err := os.ReadDir(configEnvDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read %s: %w", configEnvDir, err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !isSecretFile(entry.Name()) {
+			continue
+		}
+		if err := check(filepath.Join(configEnvDir, entry.Name()), permissions.Secret); err != nil {
+			return nil, err
+		}
+	}
+	return found, nil
+}
+
+// checkDoctorPermissions reports generated files that other users can read or execute.
+func checkDoctorPermissions(envPath, envName string) doctorResult {
+	result := doctorResult{Name: "permissions"}
+	if runtime.GOOS == "windows" {
+		result.Status = doctorOK
+		result.Detail = "file modes are not enforced on Windows, skipped"
+		return result
+	}
+
+	found, err := permissiveFiles(envPath, envName)
+	if err != nil {
+		result.Status = doctorFail
+		result.Detail = fmt.Sprintf("failed to check file modes: %v", err)
+		return result
+	}
+	if len(found) == 0 {
+		result.Status = doctorOK
+		result.Detail = fmt.Sprintf("generated files are at most %04o (scripts %04o)", permissions.Secret, permissions.Script)
+		return result
+	}
+
+	paths := make([]string, 0, len(found))
+	for path := range found {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	var fixes []string
+	for _, path := range paths {
+		fixes = append(fixes, fmt.Sprintf("chmod %04o %s", found[path], path))
+	}
+	result.Status = doctorWarn
+	result.Detail = fmt.Sprintf("%d file(s) are more permissive than the policy: %s", len(paths), strings.Join(paths, ", "))
+	result.Hint = "Run: " + strings.Join(fixes, " && ")
+	return result
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strings"
+)
+
+// releasePlatforms are the os_arch pairs each built-in tool publishes release
+// builds for. Linux builds are statically linked and also run on musl
+// distributions such as Alpine.
+var releasePlatforms = map[string][]string{
+	toolTerraform: {
+		"darwin_amd64", "darwin_arm64", "freebsd_386", "freebsd_amd64", "freebsd_arm",
+		"linux_386", "linux_amd64", "linux_arm", "linux_arm64", "openbsd_386", "openbsd_amd64",
+		"solaris_amd64", "windows_386", "windows_amd64",
+	},
+	toolTofu: {
+		"darwin_amd64", "darwin_arm64", "freebsd_386", "freebsd_amd64", "freebsd_arm",
+		"linux_386", "linux_amd64", "linux_arm", "linux_arm64", "openbsd_386", "openbsd_amd64",
+		"solaris_amd64", "windows_386", "windows_amd64",
+	},
+	"terragrunt": {
+		"darwin_amd64", "darwin_arm64", "linux_386", "linux_amd64", "linux_arm64",
+		"windows_386", "windows_amd64",
+	},
+}
+
+// downloadStatusError is a download the server answered with a status other
+// than 200.
+type downloadStatusError struct {
+	Code int
+}
+
+func (e *downloadStatusError) Error() string {
+	return fmt.Sprintf("failed to download file: status code %d", e.Code)
+}
+
+// checkReleasePlatform returns an error naming the platforms tool is
+// published for when this platform is not one of them.
+func checkReleasePlatform(tool string) error {
+	platforms, ok := releasePlatforms[tool]
+	if !ok {
+		return nil
+	}
+	platform := runtime.GOOS + "_" + runtime.GOARCH
+	for _, p := range platforms {
+		if p == platform {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not published for %s/%s; releases exist for %s",
+		toolDisplayName(tool), runtime.GOOS, runtime.GOARCH, strings.ReplaceAll(strings.Join(platforms, ", "), "_", "/"))
+}
+
+// unpublishedRelease explains a download that was not found: platforms such as
+// darwin/arm64 or linux/arm64 were only added in later releases, so an older
+// version can be missing for this platform while it exists for others.
+func unpublishedRelease(tool, version, url string, err error) error {
+	var statusErr *downloadStatusError
+	if !errors.As(err, &statusErr) || statusErr.Code != http.StatusNotFound {
+		return nil
+	}
+	return fmt.Errorf("%s %s is not published for %s/%s, or the version does not exist (%s was not found); use a newer version on this platform",
+		toolDisplayName(tool), version, runtime.GOOS, runtime.GOARCH, url)
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// pluginCacheAccessFileName records, at the root of the plugin cache, when
+// each provider version was last used by an init or exec.
+const pluginCacheAccessFileName = ".tfvenv-access.json"
+
+// cachedProviderVersion is a <host>/<namespace>/<type>/<version> directory of
+// the plugin cache.
+type cachedProviderVersion struct {
+	Key      string // slash-separated path relative to the cache
+	Path     string
+	Size     int64
+	LastUsed time.Time
+}
+
+// pluginCacheLimit returns the plugin cache size an environment allows, from
+// TFVENV_PLUGIN_CACHE_MAX_SIZE or PLUGIN_CACHE_MAX_SIZE in its .tfvenvrc.
+// Zero means no limit.
+func pluginCacheLimit(envPath, envName string) (int64, error) {
+	value := os.Getenv("TFVENV_PLUGIN_CACHE_MAX_SIZE")
+	if value == "" {
+		config, err := loadEnvConfig(envPath, envName)
+		if err != nil {
+			return 0, nil
+		}
+		value = config.PluginCacheMaxSize
+	}
+	if value == "" {
+		return 0, nil
+	}
+	return parseSize(value)
+}
+
+// trackPluginCacheUse records the provider versions pinned by the given
+// dependency lock files as used now, then evicts the least recently used
+// versions while the cache is over the environment's limit. Failures are
+// logged and never fail the command that used the providers.
+func trackPluginCacheUse(envPath, envName string, lockPaths ...string) {
+	cacheDir := defaultPluginCacheDir()
+	used := make(map[string]bool)
+	for _, lockPath := range lockPaths {
+		if !fileExists(lockPath) {
+			continue
+		}
+		locked, err := readLockedProviders(lockPath)
+		if err != nil {
+			logger.Warnf("not tracking providers of %s: %v", lockPath, err)
+			continue
+		}
+		for _, provider := range locked {
+			used[strings.Join([]string{provider.Host, provider.Namespace, provider.Type, provider.Version}, "/")] = true
+		}
+	}
+	if len(used) > 0 {
+		if err := touchCachedProviders(cacheDir, used, time.Now()); err != nil {
+			logger.Warnf("failed to record plugin cache use: %v", err)
+		}
+	}
+
+	limit, err := pluginCacheLimit(envPath, envName)
+	if err != nil {
+		logger.Warnf("ignoring the plugin cache limit of %s: %v", envName, err)
+		return
+	}
+	if limit == 0 {
+		return
+	}
+	evicted, err := evictPluginCache(cacheDir, limit, used)
+	for _, version := range evicted {
+		fmt.Fprintf(os.Stderr, "Evicted %s (%s) from the plugin cache, last used %s\n", version.Key, formatSize(version.Size), describeLastUse(version.LastUsed))
+	}
+	if err != nil {
+		logger.Warnf("failed to limit the plugin cache to %s: %v", formatSize(limit), err)
+	}
+}
+
+// touchCachedProviders sets the last use of the given provider versions in
+// the access file, which is locked while it is rewritten.
+func touchCachedProviders(cacheDir string, keys map[string]bool, now time.Time) error {
+	return updatePluginCacheAccess(cacheDir, func(access map[string]time.Time) {
+		for key := range keys {
+			access[key] = now.UTC()
+		}
+	})
+}
+
+// updatePluginCacheAccess applies fn to the access times of the plugin cache
+// under an exclusive lock, and writes them back.
+func updatePluginCacheAccess(cacheDir string, fn func(access map[string]time.Time)) error {
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", cacheDir, err)
+	}
+	path := filepath.Join(cacheDir, pluginCacheAccessFileName)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+	if err := lockFile(f, true, true); err != nil {
+		return fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+	defer unlockFile(f)
+
+	access := make(map[string]time.Time)
+	if data, err := io.ReadAll(f); err == nil && len(data) > 0 {
+		if err := json.Unmarshal(data, &access); err != nil {
+			logger.Warnf("resetting %s: %v", path, err)
+			access = make(map[string]time.Time)
+		}
+	}
+	fn(access)
+
+	data, err := json.MarshalIndent(access, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(0); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if _, err := f.WriteAt(data, 0); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// readPluginCacheAccess returns the recorded last use of each provider version.
+func readPluginCacheAccess(cacheDir string) map[string]time.Time {
+	access := make(map[string]time.Time)
+	data, err := os.ReadFile(filepath.Join(cacheDir, pluginCacheAccessFileName))
+	if err == nil {
+		json.Unmarshal(data, &access)
+	}
+	return access
+}
+
+// listCachedProviderVersions returns the provider versions in the plugin
+// cache, least recently used first. Versions never recorded as used count
+// from their directory's modification time.
+func listCachedProviderVersions(cacheDir string) ([]cachedProviderVersion, error) {
+	access := readPluginCacheAccess(cacheDir)
+	dirs, err := filepath.Glob(filepath.Join(cacheDir, "*", "*", "*", "*"))
+	if err != nil {
+		return nil, err
+	}
+	var versions []cachedProviderVersion
+	for _, dir := range dirs {
+		info, err := os.Stat(dir)
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		rel, err := filepath.Rel(cacheDir, dir)
+		if err != nil {
+			continue
+		}
+		key := filepath.ToSlash(rel)
+		lastUsed, ok := access[key]
+		if !ok {
+			lastUsed = info.ModTime()
+		}
+		_, size := treeSize(dir)
+		versions = append(versions, cachedProviderVersion{Key: key, Path: dir, Size: size, LastUsed: lastUsed})
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].LastUsed.Before(versions[j].LastUsed) })
+	return versions, nil
+}
+
+// evictPluginCache removes the least recently used provider versions until
+// the plugin cache fits in limit. Versions in keep, and providers a running
+// terraform init holds, are left alone. It returns the versions removed.
+func evictPluginCache(cacheDir string, limit int64, keep map[string]bool) ([]cachedProviderVersion, error) {
+	versions, err := listCachedProviderVersions(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	var total int64
+	for _, version := range versions {
+		total += version.Size
+	}
+	if total <= limit {
+		return nil, nil
+	}
+
+	gc := newCacheGC(cacheDir)
+	defer gc.release()
+	var evicted []cachedProviderVersion
+	for _, version := range versions {
+		if total <= limit {
+			break
+		}
+		if keep[version.Key] || !gc.acquire(version.Path) {
+			continue
+		}
+		if err := os.RemoveAll(version.Path); err != nil {
+			return evicted, fmt.Errorf("failed to remove %s: %w", version.Path, err)
+		}
+		total -= version.Size
+		evicted = append(evicted, version)
+	}
+
+	if len(evicted) > 0 {
+		err = updatePluginCacheAccess(cacheDir, func(access map[string]time.Time) {
+			for _, version := range evicted {
+				delete(access, version.Key)
+			}
+		})
+	}
+	if err == nil && total > limit {
+		err = fmt.Errorf("still %s after evicting every provider version not in use", formatSize(total))
+	}
+	return evicted, err
+}
+
+// describeLastUse renders a last-use time for eviction messages.
+func describeLastUse(t time.Time) string {
+	return t.Local().Format("2006-01-02")
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	// pluginPrefix is the executable name prefix that marks a tfvenv plugin.
+	pluginPrefix = "tfvenv-"
+	// pluginProtocolVersion is bumped whenever the plugin context changes incompatibly.
+	pluginProtocolVersion = 1
+)
+
+// PluginContext is the JSON handshake written for every plugin invocation and
+// referenced by TFVENV_PLUGIN_CONTEXT.
+type PluginContext struct {
+	ProtocolVersion   int               `json:"protocol_version"`
+	TfvenvBinary      string            `json:"tfvenv_binary"`
+	EnvDir            string            `json:"env_dir"`
+	Environment       string            `json:"environment,omitempty"`
+	EnvPath           string            `json:"env_path,omitempty"`
+	TerraformVersion  string            `json:"terraform_version,omitempty"`
+	TerragruntVersion string            `json:"terragrunt_version,omitempty"`
+	Workspace         string            `json:"workspace,omitempty"`
+	Config            map[string]string `json:"config,omitempty"`
+	Args              []string          `json:"args"`
+}
+
+// discoverPlugins returns the tfvenv-<name> executables on PATH keyed by name.
+// The first match on PATH wins, mirroring how the shell resolves commands.
+func discoverPlugins() map[string]string {
+	plugins := make(map[string]string)
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || !strings.HasPrefix(name, pluginPrefix) {
+				continue
+			}
+			if runtime.GOOS == "windows" {
+				if !strings.HasSuffix(strings.ToLower(name), windowsExecutableSuffix) {
+					continue
+				}
+				name = name[:len(name)-len(windowsExecutableSuffix)]
+			}
+			path := filepath.Join(dir, entry.Name())
+			info, err := os.Stat(path)
+			if err != nil || (runtime.GOOS != "windows" && info.Mode()&0111 == 0) {
+				continue
+			}
+			pluginName := strings.TrimPrefix(name, pluginPrefix)
+			if _, exists := plugins[pluginName]; !exists && pluginName != "" {
+				plugins[pluginName] = path
+			}
+		}
+	}
+	return plugins
+}
+
+// registerPlugins adds a subcommand for every discovered plugin. Built-in
+// commands always take precedence over plugins with the same name.
+func registerPlugins(rootCmd *cobra.Command) {
+	plugins := discoverPlugins()
+	names := make([]string, 0, len(plugins))
+	for name := range plugins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if cmd, _, err := rootCmd.Find([]string{name}); err == nil && cmd != rootCmd {
+			logger.Warnf("plugin %s is shadowed by a built-in command", plugins[name])
+			continue
+		}
+		rootCmd.AddCommand(pluginCmd(name, plugins[name]))
+	}
+}
+
+// pluginCmd wraps a plugin executable as a subcommand. Flag parsing is left to
+// the plugin; only --env-dir is picked out so the context points at the right place.
+func pluginCmd(name, path string) *cobra.Command {
+	return &cobra.Command{
+		Use:                name,
+		Short:              fmt.Sprintf("Plugin provided by %s", path),
+		DisableFlagParsing: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			envDir, pluginArgs := splitPluginArgs(args, viper.GetString("env-dir"))
+
+			handshake := buildPluginContext(envDir, pluginArgs)
+			contextFile, err := writePluginContext(handshake)
+			if err != nil {
+				logger.Errorf("error writing plugin context: %v", err)
+				fmt.Printf("Error preparing plugin %s: %v\n", name, err)
+				os.Exit(1)
+			}
+			defer os.Remove(contextFile)
+
+			pluginExec := exec.Command(path, pluginArgs...)
+			pluginExec.Stdin = os.Stdin
+			pluginExec.Stdout = os.Stdout
+			pluginExec.Stderr = os.Stderr
+			pluginExec.Env = append(os.Environ(), pluginEnv(handshake, contextFile)...)
+
+			logger.Infof("running plugin %s (%s) with args %v", name, path, pluginArgs)
+			if err := pluginExec.Run(); err != nil {
+				// os.Exit skips deferred calls
+				os.Remove(contextFile)
+				var exitErr *exec.ExitError
+				if errors.As(err, &exitErr) {
+					os.Exit(exitErr.ExitCode())
+				}
+				logger.Errorf("error running plugin %s: %v", name, err)
+				fmt.Printf("Error running plugin %s: %v\n", name, err)
+				os.Exit(1)
+			}
+		},
+	}
+}
+
+// splitPluginArgs removes --env-dir/-e from the plugin arguments and returns its value.
+func splitPluginArgs(args []string, envDir string) (string, []string) {
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case (arg == "--env-dir" || arg == "-e") && i+1 < len(args):
+			envDir = args[i+1]
+			i++
+		case strings.HasPrefix(arg, "--env-dir="):
+			envDir = strings.TrimPrefix(arg, "--env-dir=")
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return envDir, rest
+}
+
+// buildPluginContext resolves the environment the plugin runs against: the
+// first argument when it names an environment, otherwise the active one.
+func buildPluginContext(envDir string, args []string) PluginContext {
+	handshake := PluginContext{
+		ProtocolVersion: pluginProtocolVersion,
+		EnvDir:          envDir,
+		Args:            args,
+	}
+	if self, err := os.Executable(); err == nil {
+		handshake.TfvenvBinary = self
+	}
+	if abs, err := filepath.Abs(envDir); err == nil {
+		handshake.EnvDir = abs
+	}
+
+	envName := os.Getenv("TFVENV_ENV")
+	if len(args) > 0 {
+		if info, err := os.Stat(filepath.Join(envDir, args[0], "bin")); err == nil && info.IsDir() {
+			envName = args[0]
+		}
+	}
+	if envName == "" {
+		return handshake
+	}
+
+	envPath := filepath.Join(handshake.EnvDir, envName)
+	handshake.Environment = envName
+	handshake.EnvPath = envPath
+	if tf, tg, err := pinnedToolVersions(envPath, envName); err == nil {
+		handshake.TerraformVersion = tf
+		handshake.TerragruntVersion = tg
+	}
+	if meta, err := loadEnvMetadata(envPath); err == nil {
+		handshake.Workspace = meta.Workspace
+	}
+
+	// Pass the raw .tfvenvrc values; credentials are left out of the handshake
+	configPath := filepath.Join(envPath, "config", envName, tfvenvrcFileName)
+	v := viper.New()
+	if err := readTfvenvrc(v, configPath); err == nil {
+		handshake.Config = make(map[string]string)
+		for _, key := range v.AllKeys() {
+			upper := strings.ToUpper(key)
+			if upper == "ACCESS_KEY" || upper == "SECRET_KEY" || upper == "REMOTE_SNAP_AUTH" {
+				continue
+			}
+			handshake.Config[upper] = v.GetString(key)
+		}
+	}
+	return handshake
+}
+
+// writePluginContext writes the handshake to a private temporary file.
+func writePluginContext(handshake PluginContext) (string, error) {
+	data, err := json.MarshalIndent(handshake, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode plugin context: %w", err)
+	}
+	f, err := os.CreateTemp("", "tfvenv-plugin-*.json")
+	if err != nil {
+		return "", fmt.Errorf("failed to create plugin context file: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to write plugin context file: %w", err)
+	}
+	return f.Name(), nil
+}
+
+// pluginEnv returns the environment variables describing the plugin context.
+func pluginEnv(handshake PluginContext, contextFile string) []string {
+	env := []string{
+		fmt.Sprintf("TFVENV_PLUGIN_PROTOCOL=%d", handshake.ProtocolVersion),
+		"TFVENV_PLUGIN_CONTEXT=" + contextFile,
+		"TFVENV_BIN=" + handshake.TfvenvBinary,
+		"TFVENV_ENV_DIR=" + handshake.EnvDir,
+	}
+	if handshake.Environment != "" {
+		env = append(env,
+			"TFVENV_ENV="+handshake.Environment,
+			"TFVENV_ENV_PATH="+handshake.EnvPath,
+			"TFVENV_TERRAFORM_VERSION="+handshake.TerraformVersion,
+			"TFVENV_TERRAGRUNT_VERSION="+handshake.TerragruntVersion,
+		)
+	}
+	return env
+}
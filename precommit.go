@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"tfvenv/i18n"
+)
+
+// precommitConfigFileName is the configuration file read by the pre-commit framework.
+const precommitConfigFileName = ".pre-commit-config.yaml"
+
+// precommitHook is a single check run before each commit.
+type precommitHook struct {
+	ID    string
+	Name  string
+	Args  []string
+	Files string
+}
+
+// precommitCmd groups the pre-commit integration subcommands.
+func precommitCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "precommit",
+		Short: "Manage pre-commit hooks for an environment",
+	}
+	cmd.AddCommand(precommitInstallCmd())
+	return cmd
+}
+
+// precommitInstallCmd writes a .pre-commit-config.yaml or a native git hook.
+func precommitInstallCmd() *cobra.Command {
+	var native, force bool
+
+	cmd := &cobra.Command{
+		Use:   "install <env-name>",
+		Short: "Install pre-commit hooks running fmt, validate and config validate for the environment",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envDir := viper.GetString("env-dir")
+			envPath := filepath.Join(envDir, envName)
+
+			if _, err := os.Stat(envPath); os.IsNotExist(err) {
+				i18n.Println("env.not_found", envName)
+				os.Exit(1)
+			}
+
+			repoRoot, err := gitOutput("rev-parse", "--show-toplevel")
+			if err != nil {
+				logger.Errorf("error locating git repository: %v", err)
+				fmt.Printf("Error: not inside a git repository: %v\n", err)
+				os.Exit(1)
+			}
+
+			// Hooks run from the repository root, so refer to the environments relative to it when possible
+			hookEnvDir, err := filepath.Abs(envDir)
+			if err != nil {
+				logger.Errorf("error resolving %s: %v", envDir, err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			if rel, err := filepath.Rel(repoRoot, hookEnvDir); err == nil && !strings.HasPrefix(rel, "..") {
+				hookEnvDir = filepath.ToSlash(rel)
+			}
+			hooks := precommitHooks(hookEnvDir, envName)
+
+			var target string
+			var content []byte
+			var mode os.FileMode = 0644
+			if native {
+				hooksDir, err := gitOutput("rev-parse", "--git-path", "hooks")
+				if err != nil {
+					logger.Errorf("error locating git hooks directory: %v", err)
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+				if !filepath.IsAbs(hooksDir) {
+					hooksDir = filepath.Join(repoRoot, hooksDir)
+				}
+				target = filepath.Join(hooksDir, "pre-commit")
+				content = renderNativeHook(filepath.Join(hookEnvDir, envName, "bin"), hooks)
+				mode = 0755
+			} else {
+				target = filepath.Join(repoRoot, precommitConfigFileName)
+				content = renderPrecommitConfig(hooks)
+			}
+
+			if fileExists(target) && !force {
+				i18n.Println("file.exists_use_force", target)
+				os.Exit(1)
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				logger.Errorf("error creating %s: %v", filepath.Dir(target), err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			if err := os.WriteFile(target, content, mode); err != nil {
+				logger.Errorf("error writing %s: %v", target, err)
+				fmt.Printf("Error writing hook: %v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Pre-commit hooks for '%s' written to %s\n", envName, target)
+			if !native {
+				fmt.Println("Run 'pre-commit install' to activate them.")
+			}
+			logger.Infof("pre-commit hooks for %s written to %s", envName, target)
+		},
+	}
+
+	cmd.Flags().BoolVar(&native, "native", false, "Write a native .git/hooks/pre-commit script instead of .pre-commit-config.yaml")
+	cmd.Flags().BoolVar(&force, "force", false, "Overwrite an existing hook configuration")
+	return cmd
+}
+
+// precommitHooks returns the tfvenv checks for an environment. validate reads its
+// configuration relative to --env-dir, so it is pointed at the environment itself.
+func precommitHooks(envDir, envName string) []precommitHook {
+	envPath := filepath.ToSlash(filepath.Join(envDir, envName))
+	return []precommitHook{
+		{
+			ID:    "tfvenv-fmt",
+			Name:  "tfvenv fmt --check",
+			Args:  []string{"tfvenv", "--env-dir", envDir, "fmt", "--check", envName},
+			Files: `\.(tf|tfvars|hcl|tfvars\.json)$`,
+		},
+		{
+			ID:    "tfvenv-validate",
+			Name:  "tfvenv validate",
+			Args:  []string{"tfvenv", "--env-dir", envPath, "validate", "--env-type", envName},
+			Files: `\.(tf|tfvars|hcl)$`,
+		},
+		{
+			ID:   "tfvenv-config-validate",
+			Name: "tfvenv config validate",
+			Args: []string{"tfvenv", "--env-dir", envDir, "config", "validate", envName},
+		},
+	}
+}
+
+// renderPrecommitConfig renders the hooks as a local repository for the pre-commit framework.
+func renderPrecommitConfig(hooks []precommitHook) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("# Generated by tfvenv precommit install\n")
+	buf.WriteString("repos:\n")
+	buf.WriteString("  - repo: local\n")
+	buf.WriteString("    hooks:\n")
+	for _, hook := range hooks {
+		buf.WriteString(fmt.Sprintf("      - id: %s\n", hook.ID))
+		buf.WriteString(fmt.Sprintf("        name: %s\n", yamlQuote(hook.Name)))
+		buf.WriteString(fmt.Sprintf("        entry: %s\n", yamlQuote(strings.Join(hook.Args, " "))))
+		buf.WriteString("        language: system\n")
+		buf.WriteString("        pass_filenames: false\n")
+		if hook.Files != "" {
+			buf.WriteString(fmt.Sprintf("        files: %s\n", yamlQuote(hook.Files)))
+		}
+	}
+	return buf.Bytes()
+}
+
+// renderNativeHook renders the hooks as a POSIX shell git hook with the
+// environment's bin directory first on PATH.
+func renderNativeHook(binDir string, hooks []precommitHook) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("#!/bin/sh\n")
+	buf.WriteString("# Generated by tfvenv precommit install\n")
+	buf.WriteString("set -e\n\n")
+	buf.WriteString(fmt.Sprintf("PATH=%s:\"$PATH\"\n", escapeBash(binDir)))
+	buf.WriteString("export PATH\n\n")
+	for _, hook := range hooks {
+		quoted := make([]string, len(hook.Args))
+		for i, arg := range hook.Args {
+			quoted[i] = escapeBash(arg)
+		}
+		buf.WriteString(fmt.Sprintf("echo %s\n", escapeBash(hook.Name)))
+		buf.WriteString(strings.Join(quoted, " ") + "\n")
+	}
+	return buf.Bytes()
+}
+
+// yamlQuote single-quotes a YAML scalar.
+func yamlQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// gitOutput runs git and returns its trimmed stdout.
+func gitOutput(args ...string) (string, error) {
+	out, err := exec.Command("git", args...).Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"tfvenv/i18n"
+	"tfvenv/netretry"
+)
+
+// dependencyLockFileName is the dependency lock file terraform writes next to the configuration.
+const dependencyLockFileName = ".terraform.lock.hcl"
+
+// lockedProvider is a provider pinned by a dependency lock file.
+type lockedProvider struct {
+	Host      string
+	Namespace string
+	Type      string
+	Version   string
+}
+
+// prefetchCmd downloads the providers pinned by the environments' lock files into the plugin cache.
+func prefetchCmd() *cobra.Command {
+	var platforms []string
+	var cacheDir string
+	var parallel int
+
+	cmd := &cobra.Command{
+		Use:   "prefetch [env-name...]",
+		Short: "Download the providers pinned in .terraform.lock.hcl into the plugin cache (defaults to all environments)",
+		Run: func(cmd *cobra.Command, args []string) {
+			envDir := viper.GetString("env-dir")
+			if cacheDir == "" {
+				cacheDir = defaultPluginCacheDir()
+			}
+
+			envNames := args
+			if len(envNames) == 0 {
+				all, err := listEnvironmentDirs(envDir)
+				if err != nil {
+					logger.Errorf("error listing environments: %v", err)
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+				envNames = all
+			}
+
+			providers := make(map[string]lockedProvider)
+			for _, envName := range envNames {
+				envPath := filepath.Join(envDir, envName)
+				roots, err := envRoots(envPath, envName)
+				if err != nil {
+					logger.Errorf("error finding root modules of %s: %v", envName, err)
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+				// Each root module has its own dependency lock file
+				for _, root := range roots {
+					lockPath := filepath.Join(envPath, "config", envName, root, dependencyLockFileName)
+					if !fileExists(lockPath) {
+						fmt.Printf("Skipping %s: no %s (run terraform init first).\n", rootLabel(envName, root), dependencyLockFileName)
+						continue
+					}
+					locked, err := readLockedProviders(lockPath)
+					if err != nil {
+						logger.Errorf("error reading %s: %v", lockPath, err)
+						i18n.Println("error", err)
+						os.Exit(1)
+					}
+					for _, provider := range locked {
+						providers[provider.String()] = provider
+					}
+					if len(roots) > 1 {
+						fmt.Printf("Root %s: %d locked provider(s).\n", rootLabel(envName, root), len(locked))
+					}
+				}
+			}
+
+			// One job per provider package; no two jobs write the same cache directory
+			var jobs []job
+			for _, key := range sortedProviderKeys(providers) {
+				provider := providers[key]
+				for _, platform := range platforms {
+					provider, platform := provider, platform
+					dir := filepath.Join(cacheDir, provider.Host, provider.Namespace, provider.Type, provider.Version, platform)
+					if _, err := os.Stat(dir); err == nil {
+						continue
+					}
+					jobs = append(jobs, job{
+						Name: fmt.Sprintf("%s (%s)", provider, platform),
+						Run: func() error {
+							lock, err := lockProviderDir(filepath.Join(cacheDir, provider.Host, provider.Namespace, provider.Type), false)
+							if err != nil {
+								return err
+							}
+							defer lock.release()
+							mirror := &providerMirror{cacheDir: cacheDir, client: netretry.NewClient(5 * time.Minute)}
+							return mirror.fetchIntoCache(provider.Host, provider.Namespace, provider.Type, provider.Version, platform, dir)
+						},
+					})
+				}
+			}
+			if len(jobs) == 0 {
+				fmt.Println("All locked providers are already cached.")
+				return
+			}
+
+			results := runJobs(jobs, parallel)
+			if err := jobsError(results); err != nil {
+				logger.Errorf("prefetch failed: %v", err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Prefetched %d provider package(s) into %s.\n", len(jobs), cacheDir)
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&platforms, "platform", []string{runtime.GOOS + "_" + runtime.GOARCH}, "Platforms to fetch, as os_arch")
+	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "Plugin cache directory (defaults to the plugin-cache directory under the cache directory)")
+	addParallelFlag(cmd, &parallel)
+	return cmd
+}
+
+// String returns the provider's source address and version.
+func (p lockedProvider) String() string {
+	return fmt.Sprintf("%s/%s/%s %s", p.Host, p.Namespace, p.Type, p.Version)
+}
+
+// readLockedProviders returns the providers pinned in a dependency lock file.
+func readLockedProviders(lockPath string) ([]lockedProvider, error) {
+	file, diags := hclparse.NewParser().ParseHCLFile(lockPath)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to parse %s: %s", lockPath, diags.Error())
+	}
+	content, _, diags := file.Body.PartialContent(&hcl.BodySchema{
+		Blocks: []hcl.BlockHeaderSchema{{Type: "provider", LabelNames: []string{"source"}}},
+	})
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to parse %s: %s", lockPath, diags.Error())
+	}
+
+	var providers []lockedProvider
+	for _, block := range content.Blocks {
+		parts := strings.Split(block.Labels[0], "/")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("unexpected provider address %q in %s", block.Labels[0], lockPath)
+		}
+		attrs, _ := block.Body.JustAttributes()
+		versionAttr, ok := attrs["version"]
+		if !ok {
+			return nil, fmt.Errorf("provider %s in %s has no version", block.Labels[0], lockPath)
+		}
+		value, diags := versionAttr.Expr.Value(nil)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("invalid version for %s in %s: %s", block.Labels[0], lockPath, diags.Error())
+		}
+		providers = append(providers, lockedProvider{Host: parts[0], Namespace: parts[1], Type: parts[2], Version: value.AsString()})
+	}
+	return providers, nil
+}
+
+// sortedProviderKeys returns the keys of a provider set in sorted order.
+func sortedProviderKeys(providers map[string]lockedProvider) []string {
+	keys := make([]string, 0, len(providers))
+	for key := range providers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
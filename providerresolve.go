@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	version "github.com/hashicorp/go-version"
+)
+
+// providerResolutionsFileName caches, in the cache directory, the version
+// each provider source and constraint resolved to, so repeated cleanups of a
+// fleet do not query the registry again.
+const providerResolutionsFileName = "provider-resolutions.json"
+
+// providerResolutionTTL is how long a cached resolution is trusted before
+// the registry is asked again.
+const providerResolutionTTL = time.Hour
+
+// providerResolutionsMu serialises updates of the resolution cache file.
+var providerResolutionsMu sync.Mutex
+
+// providerRequirement is a provider required by an environment's configuration.
+type providerRequirement struct {
+	Env        string
+	Source     string
+	Constraint string
+}
+
+// key identifies the resolution of a requirement: its source and constraint.
+func (r providerRequirement) key() string {
+	return r.Source + " " + r.Constraint
+}
+
+// providerResolution is a resolved requirement and when it was resolved.
+type providerResolution struct {
+	Version    string    `json:"version"`
+	ResolvedAt time.Time `json:"resolved_at"`
+}
+
+// providerVersionList is the registry's version list of one provider,
+// fetched at most once per run however many requirements name it.
+type providerVersionList struct {
+	once     sync.Once
+	versions []*version.Version
+	err      error
+}
+
+// providerResolver resolves provider constraints against the registry. Each
+// source's version list is fetched once, up to parallel sources at a time,
+// and every resolution is cached by source and constraint.
+type providerResolver struct {
+	mu       sync.Mutex
+	lists    map[string]*providerVersionList
+	resolved map[string]providerResolution
+}
+
+// newProviderResolver returns a resolver primed with the unexpired entries of
+// the resolution cache.
+func newProviderResolver() *providerResolver {
+	r := &providerResolver{lists: make(map[string]*providerVersionList), resolved: make(map[string]providerResolution)}
+	for key, resolution := range loadProviderResolutions() {
+		if time.Since(resolution.ResolvedAt) < providerResolutionTTL {
+			r.resolved[key] = resolution
+		}
+	}
+	return r
+}
+
+// resolveAll resolves every distinct requirement, querying the registry for
+// up to parallel providers at once, and returns the versions by requirement
+// key. Requirements that cannot be resolved are logged and left out.
+func (r *providerResolver) resolveAll(reqs []providerRequirement, parallel int) map[string]string {
+	pending := make(map[string]providerRequirement)
+	for _, req := range reqs {
+		if _, ok := r.resolved[req.key()]; !ok {
+			pending[req.key()] = req
+		}
+	}
+	keys := make([]string, 0, len(pending))
+	for key := range pending {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if len(keys) > 0 {
+		logger.Infof("resolving %d provider constraint(s) (%d cached)", len(keys), len(r.resolved))
+	}
+
+	if parallel < 1 {
+		parallel = 1
+	}
+	slots := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+	for _, key := range keys {
+		req := pending[key]
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			v, err := r.resolve(req.Source, req.Constraint)
+			if err != nil {
+				logger.Warnf("Failed to resolve version for provider %s in %s: %v", req.Source, req.Env, err)
+				return
+			}
+			r.mu.Lock()
+			r.resolved[req.key()] = providerResolution{Version: v, ResolvedAt: time.Now().UTC()}
+			r.mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if len(keys) > 0 {
+		if err := saveProviderResolutions(r.resolved); err != nil {
+			logger.Warnf("failed to cache provider resolutions: %v", err)
+		}
+	}
+	versions := make(map[string]string, len(r.resolved))
+	for key, resolution := range r.resolved {
+		versions[key] = resolution.Version
+	}
+	return versions
+}
+
+// resolve returns the newest version of source that meets constraint.
+func (r *providerResolver) resolve(source, constraint string) (string, error) {
+	vConstraint, err := version.NewConstraint(constraint)
+	if err != nil {
+		return "", fmt.Errorf("invalid version constraint '%s' for provider %s: %w", constraint, source, err)
+	}
+	available, err := r.available(source)
+	if err != nil {
+		return "", err
+	}
+	for _, v := range available {
+		if vConstraint.Check(v) {
+			return v.Original(), nil
+		}
+	}
+	return "", fmt.Errorf("no versions found for provider %s matching constraint '%s'", source, constraint)
+}
+
+// available returns the versions of source, newest first, fetching them from
+// the registry on first use.
+func (r *providerResolver) available(source string) ([]*version.Version, error) {
+	r.mu.Lock()
+	list, ok := r.lists[source]
+	if !ok {
+		list = &providerVersionList{}
+		r.lists[source] = list
+	}
+	r.mu.Unlock()
+
+	list.once.Do(func() {
+		list.versions, list.err = getProviderAvailableVersions(source)
+		if list.err != nil {
+			list.err = fmt.Errorf("failed to fetch available versions for provider %s: %w", source, list.err)
+			return
+		}
+		sort.Sort(sort.Reverse(version.Collection(list.versions)))
+	})
+	return list.versions, list.err
+}
+
+// providerResolutionsPath returns where provider resolutions are cached.
+func providerResolutionsPath() string {
+	return filepath.Join(userDirs.CacheDir(), providerResolutionsFileName)
+}
+
+// loadProviderResolutions reads the cached resolutions. A missing or
+// unreadable cache is empty.
+func loadProviderResolutions() map[string]providerResolution {
+	cache := make(map[string]providerResolution)
+	data, err := os.ReadFile(providerResolutionsPath())
+	if err != nil {
+		return cache
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		logger.Warnf("ignoring corrupt provider resolution cache %s: %v", providerResolutionsPath(), err)
+		return make(map[string]providerResolution)
+	}
+	return cache
+}
+
+// saveProviderResolutions merges resolutions into the cache file.
+func saveProviderResolutions(resolutions map[string]providerResolution) error {
+	providerResolutionsMu.Lock()
+	defer providerResolutionsMu.Unlock()
+
+	cache := loadProviderResolutions()
+	for key, resolution := range resolutions {
+		cache[key] = resolution
+	}
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(providerResolutionsPath()), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(providerResolutionsPath(), data, 0644)
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	version "github.com/hashicorp/go-version"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// quotaPolicy limits what may be created on a shared host such as a bastion.
+// Zero values mean no limit.
+type quotaPolicy struct {
+	MaxEnvironmentsPerUser int    `yaml:"max_environments_per_user"`
+	MaxEnvironmentsPerHost int    `yaml:"max_environments_per_host"`
+	MaxTotalDisk           string `yaml:"max_total_disk"`
+	// AllowedVersions maps terraform, tofu and terragrunt to a version
+	// constraint such as ">= 1.5.0, < 2.0.0".
+	AllowedVersions map[string]string `yaml:"allowed_versions"`
+
+	path              string
+	maxTotalDiskBytes int64
+}
+
+// quotaFilePath returns the policy file: TFVENV_QUOTA_FILE, or the host-wide
+// quotas.yaml an administrator installs.
+func quotaFilePath() string {
+	if path := os.Getenv("TFVENV_QUOTA_FILE"); path != "" {
+		return path
+	}
+	if runtime.GOOS == "windows" {
+		return filepath.Join(os.Getenv("ProgramData"), "tfvenv", "quotas.yaml")
+	}
+	return "/etc/tfvenv/quotas.yaml"
+}
+
+// loadQuotaPolicy reads and validates the policy file. Without one, nothing is limited.
+func loadQuotaPolicy() (quotaPolicy, error) {
+	policy := quotaPolicy{path: quotaFilePath()}
+	data, err := os.ReadFile(policy.path)
+	if os.IsNotExist(err) {
+		return policy, nil
+	}
+	if err != nil {
+		return policy, fmt.Errorf("failed to read %s: %w", policy.path, err)
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&policy); err != nil && !errors.Is(err, io.EOF) {
+		return policy, fmt.Errorf("failed to parse %s: %w", policy.path, err)
+	}
+
+	if policy.MaxTotalDisk != "" {
+		if policy.maxTotalDiskBytes, err = parseSize(policy.MaxTotalDisk); err != nil {
+			return policy, fmt.Errorf("%s: max_total_disk: %w", policy.path, err)
+		}
+	}
+	for tool, constraint := range policy.AllowedVersions {
+		if tool != toolTerraform && tool != toolTofu && tool != "terragrunt" {
+			return policy, fmt.Errorf("%s: allowed_versions: unknown tool %q (use terraform, tofu or terragrunt)", policy.path, tool)
+		}
+		if _, err := version.NewConstraint(constraint); err != nil {
+			return policy, fmt.Errorf("%s: allowed_versions: %s: %w", policy.path, tool, err)
+		}
+	}
+	return policy, nil
+}
+
+// checkEnvQuota fails when creating another environment under envDir would
+// exceed the environment count or disk limits.
+func checkEnvQuota(envDir string) error {
+	policy, err := loadQuotaPolicy()
+	if err != nil {
+		return err
+	}
+	if policy.MaxEnvironmentsPerUser <= 0 && policy.MaxEnvironmentsPerHost <= 0 && policy.maxTotalDiskBytes <= 0 {
+		return nil
+	}
+	names, err := listEnvironmentDirs(envDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if limit := policy.MaxEnvironmentsPerHost; limit > 0 && len(names) >= limit {
+		return fmt.Errorf("quota exceeded: %s already holds %d environment(s), the limit is %d (max_environments_per_host in %s); delete unused environments with 'tfvenv delete <env-name>'",
+			envDir, len(names), limit, policy.path)
+	}
+	if limit := policy.MaxEnvironmentsPerUser; limit > 0 {
+		user, owned := getUsername(), 0
+		for _, name := range names {
+			if meta, err := loadEnvMetadata(filepath.Join(envDir, name)); err == nil && meta.CreatedBy == user {
+				owned++
+			}
+		}
+		if owned >= limit {
+			return fmt.Errorf("quota exceeded: %s already created %d environment(s) in %s, the limit is %d (max_environments_per_user in %s); delete unused environments with 'tfvenv delete <env-name>'",
+				user, owned, envDir, limit, policy.path)
+		}
+	}
+	return checkDiskQuota(policy, envDir, names)
+}
+
+// checkUpgradeQuota fails when the environments under envDir already use the
+// disk space the policy allows, before an upgrade downloads more binaries.
+func checkUpgradeQuota(envDir string) error {
+	policy, err := loadQuotaPolicy()
+	if err != nil || policy.maxTotalDiskBytes <= 0 {
+		return err
+	}
+	names, err := listEnvironmentDirs(envDir)
+	if err != nil {
+		return nil
+	}
+	return checkDiskQuota(policy, envDir, names)
+}
+
+// checkDiskQuota compares the size of the named environments with max_total_disk.
+func checkDiskQuota(policy quotaPolicy, envDir string, names []string) error {
+	if policy.maxTotalDiskBytes <= 0 {
+		return nil
+	}
+	var used int64
+	for _, name := range names {
+		_, size := treeSize(filepath.Join(envDir, name))
+		used += size
+	}
+	if used >= policy.maxTotalDiskBytes {
+		return fmt.Errorf("quota exceeded: the environments in %s use %s, the limit is %s (max_total_disk in %s); free space with 'tfvenv delete <env-name>' or 'tfvenv cleanup'",
+			envDir, formatSize(used), formatSize(policy.maxTotalDiskBytes), policy.path)
+	}
+	return nil
+}
+
+// checkVersionPolicy fails when the policy does not allow installing this
+// version of tool.
+func checkVersionPolicy(tool, v string) error {
+	policy, err := loadQuotaPolicy()
+	if err != nil {
+		return err
+	}
+	constraint, ok := policy.AllowedVersions[tool]
+	if !ok {
+		return nil
+	}
+	parsed, err := version.NewVersion(v)
+	if err != nil {
+		return fmt.Errorf("%s %s is not a valid version: %w", tool, v, err)
+	}
+	c, _ := version.NewConstraint(constraint)
+	if !c.Check(parsed) {
+		return fmt.Errorf("%s %s is not allowed on this host: allowed versions are %q (allowed_versions in %s)", tool, v, constraint, policy.path)
+	}
+	return nil
+}
+
+// parseSize parses a size such as 500MB, 20GiB or 1048576 (bytes). Units are
+// powers of 1024, as formatSize prints them.
+func parseSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{
+		{"TIB", 1 << 40}, {"GIB", 1 << 30}, {"MIB", 1 << 20}, {"KIB", 1 << 10},
+		{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+		{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1},
+	} {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q: use e.g. 500MB or 20GB", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// readOnlyLock marks an environment read-only, e.g. for production during a
+// change freeze.
+type readOnlyLock struct {
+	Since  time.Time `json:"since"`
+	By     string    `json:"by"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// readOnlyCommands are the terraform and terragrunt commands a read-only
+// environment still runs. Commands listed with subcommands only allow those.
+var readOnlyCommands = map[string][]string{
+	"init":      nil,
+	"get":       nil,
+	"plan":      nil,
+	"validate":  nil,
+	"show":      nil,
+	"output":    nil,
+	"providers": nil,
+	"graph":     nil,
+	"fmt":       nil,
+	"version":   nil,
+	"console":   nil,
+	"state":     {"list", "show", "pull"},
+	"workspace": {"list", "show", "select"},
+	// Terragrunt's own commands that do not touch infrastructure
+	"hclfmt":               nil,
+	"render-json":          nil,
+	"validate-inputs":      nil,
+	"graph-dependencies":   nil,
+	"output-module-groups": nil,
+}
+
+// readOnlyBlocked returns the command in args a read-only environment refuses,
+// or "" when it is allowed. Leading flags are skipped, and terragrunt's
+// run-all and run prefixes are looked through.
+func readOnlyBlocked(args []string) string {
+	var words []string
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			words = append(words, arg)
+		}
+	}
+	if len(words) > 0 && (words[0] == "run-all" || words[0] == "run") {
+		words = words[1:]
+	}
+	if len(words) == 0 {
+		return ""
+	}
+
+	subcommands, ok := readOnlyCommands[words[0]]
+	if !ok {
+		return words[0]
+	}
+	if subcommands == nil {
+		return ""
+	}
+	if len(words) < 2 {
+		return ""
+	}
+	for _, sub := range subcommands {
+		if words[1] == sub {
+			return ""
+		}
+	}
+	return words[0] + " " + words[1]
+}
+
+// enforceReadOnly refuses args when the environment is read-only.
+func enforceReadOnly(envPath, envName string, args []string) error {
+	meta, err := loadEnvMetadata(envPath)
+	if err != nil || meta.ReadOnly == nil {
+		return err
+	}
+	blocked := readOnlyBlocked(args)
+	if blocked == "" {
+		return nil
+	}
+	reason := ""
+	if meta.ReadOnly.Reason != "" {
+		reason = fmt.Sprintf(" (%s)", meta.ReadOnly.Reason)
+	}
+	return fmt.Errorf("environment '%s' is read-only%s; '%s' is blocked. Run 'tfvenv unlock %s --read-only' to lift it", envName, reason, blocked, envName)
+}
+
+// setReadOnly marks or clears the read-only flag and regenerates the
+// activation scripts, which wrap the binaries while the flag is set.
+func setReadOnly(envPath, envName string, lock *readOnlyLock) error {
+	if err := updateEnvMetadata(envPath, func(meta *EnvironmentMetadata) { meta.ReadOnly = lock }); err != nil {
+		return err
+	}
+	config, err := readConfig(filepath.Join(envPath, "config", envName, tfvenvrcFileName))
+	if err != nil {
+		logger.Warnf("error reading %s, activation scripts not regenerated: %v", tfvenvrcFileName, err)
+		return nil
+	}
+	config.EnvVars = withEnvPaths(config.EnvVars, envPath)
+	if err := generateActivateScript(envPath, envName, config); err != nil {
+		return err
+	}
+	return generateDeactivateScript(envPath, config)
+}
+
+// guardCmd is called by the shell functions the activation scripts define for
+// a read-only environment, before they run the real binary. It takes the
+// environment's path, since --env-dir is not parsed.
+func guardCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:                "guard <env-path> -- <args...>",
+		Short:              "Check a terraform or terragrunt command against a read-only environment",
+		Hidden:             true,
+		Args:               cobra.MinimumNArgs(1),
+		DisableFlagParsing: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			envPath := args[0]
+			envName := filepath.Base(envPath)
+			rest := args[1:]
+			if len(rest) > 0 && rest[0] == "--" {
+				rest = rest[1:]
+			}
+			if err := enforceReadOnly(envPath, envName, rest); err != nil {
+				fmt.Fprintf(os.Stderr, "tfvenv: %v\n", err)
+				os.Exit(1)
+			}
+		},
+	}
+}
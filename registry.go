@@ -0,0 +1,550 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zclconf/go-cty/cty"
+
+	"tfvenv/i18n"
+	"tfvenv/netretry"
+)
+
+const (
+	// defaultMirrorAddr is where registry serve listens by default.
+	defaultMirrorAddr = "127.0.0.1:8421"
+)
+
+// mirrorPlatformPattern matches the os_arch directories of the unpacked plugin cache layout.
+var mirrorPlatformPattern = regexp.MustCompile(`^[a-z0-9]+_[a-z0-9]+$`)
+
+// defaultPluginCacheDir returns the shared provider plugin cache used by every environment.
+func defaultPluginCacheDir() string {
+	return userDirs.PluginCacheDir()
+}
+
+// providerMirror implements Terraform's provider network mirror protocol on top
+// of the plugin cache, fetching providers from their origin registry on a miss.
+type providerMirror struct {
+	cacheDir string
+	offline  bool
+	client   *http.Client
+	mu       sync.Mutex
+}
+
+// registryProviderVersions is the origin registry's list of versions for a provider.
+type registryProviderVersions struct {
+	Versions []struct {
+		Version   string `json:"version"`
+		Platforms []struct {
+			OS   string `json:"os"`
+			Arch string `json:"arch"`
+		} `json:"platforms"`
+	} `json:"versions"`
+}
+
+// registryDownload is the origin registry's download metadata for one platform.
+type registryDownload struct {
+	DownloadURL string `json:"download_url"`
+	Shasum      string `json:"shasum"`
+}
+
+// registryCmd groups the provider mirror subcommands.
+func registryCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "registry",
+		Short: "Run and use a local provider network mirror backed by the plugin cache",
+	}
+	cmd.AddCommand(registryServeCmd())
+	cmd.AddCommand(registryUseCmd())
+	return cmd
+}
+
+// registryServeCmd serves the provider network mirror.
+func registryServeCmd() *cobra.Command {
+	var addr, cacheDir, tlsCert, tlsKey string
+	var offline bool
+
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Serve the plugin cache as a Terraform provider network mirror",
+		Run: func(cmd *cobra.Command, args []string) {
+			if cacheDir == "" {
+				cacheDir = defaultPluginCacheDir()
+			}
+			if err := os.MkdirAll(cacheDir, 0755); err != nil {
+				logger.Errorf("error creating plugin cache %s: %v", cacheDir, err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			if (tlsCert == "") != (tlsKey == "") {
+				fmt.Println("Error: --tls-cert and --tls-key must be used together.")
+				os.Exit(1)
+			}
+			if tlsCert == "" {
+				fmt.Println("Warning: Terraform only accepts https:// network mirrors. Serve behind a TLS proxy or pass --tls-cert and --tls-key.")
+			}
+
+			mirror := &providerMirror{
+				cacheDir: cacheDir,
+				offline:  offline,
+				client:   netretry.NewClient(5 * time.Minute),
+			}
+			server := &http.Server{Addr: addr, Handler: mirror, ReadHeaderTimeout: 10 * time.Second}
+
+			// Shut down cleanly when the root context is cancelled by SIGINT/SIGTERM
+			handleInterruptsGracefully()
+			ctx := cmd.Context()
+			go func() {
+				<-ctx.Done()
+				shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				defer cancel()
+				server.Shutdown(shutdownCtx)
+			}()
+
+			fmt.Printf("Serving provider mirror from %s on %s\n", cacheDir, addr)
+			logger.Infof("provider mirror serving %s on %s (offline=%t)", cacheDir, addr, offline)
+
+			var err error
+			if tlsCert != "" {
+				err = server.ListenAndServeTLS(tlsCert, tlsKey)
+			} else {
+				err = server.ListenAndServe()
+			}
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				logger.Errorf("provider mirror failed: %v", err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&addr, "addr", defaultMirrorAddr, "Address to listen on")
+	cmd.Flags().StringVar(&cacheDir, "cache-dir", "", "Plugin cache directory (defaults to the plugin-cache directory under the cache directory)")
+	cmd.Flags().BoolVar(&offline, "offline", false, "Serve only cached providers, never contact origin registries")
+	cmd.Flags().StringVar(&tlsCert, "tls-cert", "", "TLS certificate file")
+	cmd.Flags().StringVar(&tlsKey, "tls-key", "", "TLS private key file")
+	return cmd
+}
+
+// registryUseCmd points an environment's CLI configuration at a network mirror.
+func registryUseCmd() *cobra.Command {
+	var mirrorURL string
+	var remove bool
+
+	cmd := &cobra.Command{
+		Use:   "use <env-name>",
+		Short: "Configure the environment's terraform CLI to install providers through the mirror",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envDir := viper.GetString("env-dir")
+			envPath := filepath.Join(envDir, envName)
+
+			if _, err := os.Stat(envPath); os.IsNotExist(err) {
+				i18n.Println("env.not_found", envName)
+				os.Exit(1)
+			}
+
+			if !strings.HasSuffix(mirrorURL, "/") {
+				mirrorURL += "/"
+			}
+			err := updateCLIConfig(envPath, func(body *hclwrite.Body) {
+				removeCLIConfigBlocks(body, "provider_installation")
+				if remove {
+					return
+				}
+				mirror := body.AppendNewBlock("provider_installation", nil).Body().AppendNewBlock("network_mirror", nil).Body()
+				mirror.SetAttributeValue("url", cty.StringVal(mirrorURL))
+			})
+			if err != nil {
+				logger.Errorf("error updating CLI config for %s: %v", envName, err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+
+			if remove {
+				fmt.Printf("Environment '%s' no longer uses a provider mirror. Re-activate it to apply the change.\n", envName)
+				return
+			}
+			fmt.Printf("Environment '%s' now installs providers from %s. Re-activate it to apply the change.\n", envName, mirrorURL)
+			logger.Infof("environment %s configured to use provider mirror %s", envName, mirrorURL)
+		},
+	}
+
+	cmd.Flags().StringVar(&mirrorURL, "url", "https://localhost:8421/", "Base URL of the provider network mirror")
+	cmd.Flags().BoolVar(&remove, "remove", false, "Stop using the mirror")
+	return cmd
+}
+
+// ServeHTTP handles the three network mirror requests:
+//
+//	/:hostname/:namespace/:type/index.json
+//	/:hostname/:namespace/:type/:version.json
+//	/:hostname/:namespace/:type/:version/:os_:arch.zip (archive URLs handed out by this mirror)
+func (m *providerMirror) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	for _, part := range parts {
+		if part == "" || part == "." || part == ".." {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	if len(parts) < 4 {
+		http.NotFound(w, r)
+		return
+	}
+	host, namespace, providerType := strings.ToLower(parts[0]), strings.ToLower(parts[1]), strings.ToLower(parts[2])
+
+	var err error
+	switch {
+	case len(parts) == 4 && parts[3] == "index.json":
+		err = m.serveIndex(w, host, namespace, providerType)
+	case len(parts) == 4 && strings.HasSuffix(parts[3], ".json"):
+		err = m.serveVersion(w, host, namespace, providerType, strings.TrimSuffix(parts[3], ".json"))
+	case len(parts) == 5 && strings.HasSuffix(parts[4], ".zip"):
+		err = m.serveArchive(w, host, namespace, providerType, parts[3], strings.TrimSuffix(parts[4], ".zip"))
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		logger.Warnf("provider mirror: %s: %v", r.URL.Path, err)
+		http.Error(w, err.Error(), http.StatusNotFound)
+	}
+}
+
+// serveIndex lists the versions available from the cache and the origin registry.
+func (m *providerMirror) serveIndex(w http.ResponseWriter, host, namespace, providerType string) error {
+	versions := make(map[string]struct{})
+	for version := range m.cachedPlatforms(host, namespace, providerType) {
+		versions[version] = struct{}{}
+	}
+	if upstream, err := m.upstreamVersions(host, namespace, providerType); err == nil {
+		for version := range upstream {
+			versions[version] = struct{}{}
+		}
+	} else if len(versions) == 0 {
+		return err
+	} else {
+		logger.Warnf("provider mirror: origin unavailable, serving cached versions of %s/%s/%s: %v", host, namespace, providerType, err)
+	}
+
+	index := map[string]map[string]struct{}{"versions": versions}
+	return writeMirrorJSON(w, index)
+}
+
+// serveVersion lists the platform archives of one version.
+func (m *providerMirror) serveVersion(w http.ResponseWriter, host, namespace, providerType, version string) error {
+	platforms := make(map[string]struct{})
+	for _, platform := range m.cachedPlatforms(host, namespace, providerType)[version] {
+		platforms[platform] = struct{}{}
+	}
+	if upstream, err := m.upstreamVersions(host, namespace, providerType); err == nil {
+		for _, platform := range upstream[version] {
+			platforms[platform] = struct{}{}
+		}
+	}
+	if len(platforms) == 0 {
+		return fmt.Errorf("version %s of %s/%s/%s is not available", version, host, namespace, providerType)
+	}
+
+	archives := make(map[string]map[string]string)
+	for platform := range platforms {
+		// Relative URLs resolve against this document's URL
+		archives[platform] = map[string]string{"url": fmt.Sprintf("%s/%s.zip", version, platform)}
+	}
+	return writeMirrorJSON(w, map[string]interface{}{"archives": archives})
+}
+
+// serveArchive zips a cached provider, fetching it into the cache first if needed.
+func (m *providerMirror) serveArchive(w http.ResponseWriter, host, namespace, providerType, version, platform string) error {
+	if !mirrorPlatformPattern.MatchString(platform) {
+		return fmt.Errorf("invalid platform %q", platform)
+	}
+	dir := filepath.Join(m.cacheDir, host, namespace, providerType, version, platform)
+
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if m.offline {
+			return fmt.Errorf("%s/%s/%s %s (%s) is not cached", host, namespace, providerType, version, platform)
+		}
+		if err := m.fetchIntoCache(host, namespace, providerType, version, platform, dir); err != nil {
+			return err
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := zipDirectory(dir, &buf); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// cachedPlatforms returns the cached platforms per version of a provider.
+func (m *providerMirror) cachedPlatforms(host, namespace, providerType string) map[string][]string {
+	result := make(map[string][]string)
+	providerDir := filepath.Join(m.cacheDir, host, namespace, providerType)
+	versions, err := os.ReadDir(providerDir)
+	if err != nil {
+		return result
+	}
+	for _, version := range versions {
+		if !version.IsDir() {
+			continue
+		}
+		platforms, err := os.ReadDir(filepath.Join(providerDir, version.Name()))
+		if err != nil {
+			continue
+		}
+		for _, platform := range platforms {
+			if platform.IsDir() && mirrorPlatformPattern.MatchString(platform.Name()) {
+				result[version.Name()] = append(result[version.Name()], platform.Name())
+			}
+		}
+	}
+	return result
+}
+
+// upstreamVersions queries the origin registry for the platforms of every version.
+func (m *providerMirror) upstreamVersions(host, namespace, providerType string) (map[string][]string, error) {
+	if m.offline {
+		return nil, fmt.Errorf("offline mode")
+	}
+	base, err := m.providersAPI(host)
+	if err != nil {
+		return nil, err
+	}
+
+	var list registryProviderVersions
+	if err := m.getJSON(fmt.Sprintf("%s%s/%s/versions", base, namespace, providerType), &list); err != nil {
+		return nil, err
+	}
+	result := make(map[string][]string)
+	for _, v := range list.Versions {
+		for _, p := range v.Platforms {
+			result[v.Version] = append(result[v.Version], p.OS+"_"+p.Arch)
+		}
+	}
+	return result, nil
+}
+
+// registryEndpoints caches the providers.v1 endpoint of each registry host for
+// the life of the process, so concurrent prefetch jobs discover it only once.
+var registryEndpoints sync.Map
+
+// providersAPI resolves the providers.v1 endpoint of a registry host through service discovery.
+func (m *providerMirror) providersAPI(host string) (string, error) {
+	if base, ok := registryEndpoints.Load(host); ok {
+		return base.(string), nil
+	}
+	var discovery struct {
+		ProvidersV1 string `json:"providers.v1"`
+	}
+	if err := m.getJSON(fmt.Sprintf("https://%s/.well-known/terraform.json", host), &discovery); err != nil {
+		return "", err
+	}
+	if discovery.ProvidersV1 == "" {
+		return "", fmt.Errorf("%s does not provide a provider registry", host)
+	}
+	base := discovery.ProvidersV1
+	if strings.HasPrefix(base, "/") {
+		base = "https://" + host + base
+	}
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	registryEndpoints.Store(host, base)
+	return base, nil
+}
+
+// fetchIntoCache downloads a provider package from the origin registry, verifies
+// its checksum, and unpacks it into the plugin cache layout.
+func (m *providerMirror) fetchIntoCache(host, namespace, providerType, version, platform, dir string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, err := os.Stat(dir); err == nil {
+		return nil // fetched by a concurrent request
+	}
+
+	base, err := m.providersAPI(host)
+	if err != nil {
+		return err
+	}
+	osArch := strings.SplitN(platform, "_", 2)
+	var download registryDownload
+	downloadURL := fmt.Sprintf("%s%s/%s/%s/download/%s/%s", base, namespace, providerType, version, osArch[0], osArch[1])
+	if err := m.getJSON(downloadURL, &download); err != nil {
+		return err
+	}
+
+	resp, err := m.client.Get(download.DownloadURL)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", download.DownloadURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download %s: %s", download.DownloadURL, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", download.DownloadURL, err)
+	}
+	sum := sha256.Sum256(data)
+	if !strings.EqualFold(hex.EncodeToString(sum[:]), download.Shasum) {
+		return fmt.Errorf("checksum mismatch for %s", download.DownloadURL)
+	}
+
+	// Unpack next to the final location, then move it into place atomically
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	tmpDir, err := os.MkdirTemp(filepath.Dir(dir), ".fetch-")
+	if err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	if err := unzipBytes(data, tmpDir); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpDir, dir); err != nil {
+		return fmt.Errorf("failed to move provider into cache: %w", err)
+	}
+	logger.Infof("provider mirror: cached %s/%s/%s %s (%s)", host, namespace, providerType, version, platform)
+	return nil
+}
+
+// getJSON fetches and decodes a JSON document.
+func (m *providerMirror) getJSON(url string, v interface{}) error {
+	resp, err := m.client.Get(url)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch %s: %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", url, err)
+	}
+	return nil
+}
+
+// writeMirrorJSON writes a mirror protocol JSON document.
+func writeMirrorJSON(w http.ResponseWriter, v interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(v)
+}
+
+// zipDirectory writes the files of dir, in a stable order, as a zip archive.
+func zipDirectory(dir string, out io.Writer) error {
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	zw := zip.NewWriter(out)
+	for _, path := range files {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		header.Method = zip.Deflate
+		writer, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(writer, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// unzipBytes extracts a zip archive held in memory into dest.
+func unzipBytes(data []byte, dest string) error {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	for _, file := range zr.File {
+		target := filepath.Join(dest, filepath.FromSlash(file.Name))
+		if !strings.HasPrefix(target, filepath.Clean(dest)+string(os.PathSeparator)) {
+			return fmt.Errorf("archive entry %s escapes the destination", file.Name)
+		}
+		if file.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return err
+		}
+		f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.Mode()|0600)
+		if err != nil {
+			rc.Close()
+			return err
+		}
+		_, err = io.Copy(f, rc)
+		rc.Close()
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
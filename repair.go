@@ -0,0 +1,446 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	version "github.com/hashicorp/go-version"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"tfvenv/i18n"
+	"tfvenv/snaps"
+)
+
+// repairStep is a problem found in an environment and how it is fixed. Steps
+// without a fix can only be reported.
+type repairStep struct {
+	Problem string
+	Action  string
+	fix     func() error
+}
+
+// activationScriptNames are the scripts generateActivateScript and
+// generateDeactivateScript write to bin/.
+var activationScriptNames = []string{"activate.sh", "activate.fish", "Activate.ps1", "deactivate.sh", "deactivate.fish", "Deactivate.ps1"}
+
+// repairCmd detects and reconstructs the broken parts of an environment.
+func repairCmd() *cobra.Command {
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "repair <env-name>",
+		Short: "Detect and rebuild missing directories, broken binaries, corrupted scripts and invalid configuration",
+		Long: `Check an environment for missing directories, broken or missing binaries,
+dangling symlinks in bin/, corrupted activation scripts, unparsable
+configuration and metadata, and rebuild what it can: binaries from the
+artifact cache or the release servers, configuration files from the
+environment's templates, and versions, tool family and scripts from the
+latest snap. Damaged files are backed up before they are replaced. Problems
+that need a decision, such as invalid values in .tfvenvrc, are only reported.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envDir := viper.GetString("env-dir")
+			envPath := filepath.Join(envDir, envName)
+			if _, err := os.Stat(envPath); os.IsNotExist(err) {
+				i18n.Println("env.not_found", envName)
+				os.Exit(1)
+			}
+
+			// Without a snap there is nothing to fall back on beyond the templates
+			snap, snapName := latestSnap(envPath)
+			if snap != nil {
+				logger.Infof("using snap %s of %s for repair", snapName, envName)
+			} else {
+				snap = &snaps.Snap{}
+			}
+			steps := diagnoseEnv(envPath, envName, snap)
+			interrupted := fileExists(filepath.Join(envPath, incompleteMarkerName))
+			if interrupted {
+				fmt.Printf("- creating '%s' was interrupted\n", envName)
+			}
+			if len(steps) == 0 && !interrupted {
+				fmt.Printf("Environment '%s' looks healthy; nothing to repair.\n", envName)
+				return
+			}
+
+			if !dryRun {
+				i18n.Println("env.repairing", envName)
+			}
+			unresolved := 0
+			for _, step := range steps {
+				fmt.Printf("- %s\n", step.Problem)
+				switch {
+				case step.fix == nil:
+					unresolved++
+					fmt.Printf("  not repaired: %s\n", step.Action)
+				case dryRun:
+					printDryRun("would %s", step.Action)
+				default:
+					if err := step.fix(); err != nil {
+						unresolved++
+						logger.Errorf("error repairing %s: %v", envName, err)
+						fmt.Printf("  failed to %s: %v\n", step.Action, err)
+						continue
+					}
+					fmt.Printf("  %s: done\n", step.Action)
+				}
+			}
+
+			if dryRun {
+				return
+			}
+			if unresolved > 0 {
+				fmt.Printf("%d problem(s) in '%s' remain; see above.\n", unresolved, envName)
+				os.Exit(1)
+			}
+			// A create that was interrupted is complete once everything is rebuilt
+			if err := os.Remove(filepath.Join(envPath, incompleteMarkerName)); err != nil && !os.IsNotExist(err) {
+				logger.Warnf("error removing the incomplete marker of %s: %v", envName, err)
+			}
+			fmt.Printf("Environment '%s' repaired.\n", envName)
+			logger.Infof("environment %s repaired (%d step(s))", envName, len(steps))
+		},
+	}
+
+	addDryRunFlag(cmd, &dryRun)
+	return cmd
+}
+
+// latestSnap returns the newest local snap that can be read, and its name.
+func latestSnap(envPath string) (*snaps.Snap, string) {
+	files, err := snaps.ListSnapFiles(envPath)
+	if err != nil {
+		logger.Warnf("error listing snaps of %s: %v", envPath, err)
+		return nil, ""
+	}
+	for _, file := range files {
+		snap, err := snaps.GetSnap(file.Path)
+		if err != nil {
+			logger.Warnf("skipping unreadable snap %s: %v", file.Path, err)
+			continue
+		}
+		return snap, file.Name
+	}
+	return nil, ""
+}
+
+// diagnoseEnv lists the problems of an environment in the order they must be
+// fixed: directories and metadata first, then templates and the files made
+// from them, then binaries and finally the scripts that refer to them.
+func diagnoseEnv(envPath, envName string, snap *snaps.Snap) []repairStep {
+	var steps []repairStep
+	binDir := filepath.Join(envPath, "bin")
+	configEnvDir := filepath.Join(envPath, "config", envName)
+	templatesDir := filepath.Join(envPath, "templates")
+
+	for _, dir := range []string{binDir, configEnvDir, templatesDir, envScriptsDir(envPath), filepath.Join(envPath, "terraform-data")} {
+		dir := dir
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			continue
+		}
+		steps = append(steps, repairStep{
+			Problem: fmt.Sprintf("directory %s is missing", dir),
+			Action:  "recreate it",
+			fix:     func() error { return os.MkdirAll(dir, 0755) },
+		})
+	}
+
+	steps = append(steps, diagnoseMetadata(envPath, envName, snap)...)
+	steps = append(steps, diagnoseConfig(envPath, envName, snap)...)
+
+	// Symlinks whose target is gone, such as binaries linked from a removed
+	// location, are dropped; tool binaries among them are reinstalled below
+	entries, _ := os.ReadDir(binDir)
+	for _, entry := range entries {
+		path := filepath.Join(binDir, entry.Name())
+		if entry.Type()&os.ModeSymlink == 0 {
+			continue
+		}
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		target, _ := os.Readlink(path)
+		steps = append(steps, repairStep{
+			Problem: fmt.Sprintf("%s is a broken symlink to %s", path, target),
+			Action:  "remove it",
+			fix:     func() error { return os.Remove(path) },
+		})
+	}
+
+	steps = append(steps, diagnoseBinaries(envPath, envName, snap)...)
+
+	if len(snap.Scripts) > 0 {
+		scriptEntries, err := os.ReadDir(envScriptsDir(envPath))
+		if err != nil || len(scriptEntries) == 0 {
+			steps = append(steps, repairStep{
+				Problem: fmt.Sprintf("scripts directory is empty but the latest snap holds %d script(s)", len(snap.Scripts)),
+				Action:  "restore the scripts from the snap",
+				fix:     func() error { return restoreScripts(envPath, snap.Scripts) },
+			})
+		}
+	}
+
+	var damaged []string
+	for _, name := range activationScriptNames {
+		content, err := os.ReadFile(filepath.Join(binDir, name))
+		if err != nil || !strings.Contains(string(content), "TFVENV_PATH") {
+			damaged = append(damaged, name)
+		}
+	}
+	if len(damaged) > 0 {
+		steps = append(steps, repairStep{
+			Problem: fmt.Sprintf("activation scripts are missing or corrupted: %s", strings.Join(damaged, ", ")),
+			Action:  "regenerate the activation scripts",
+			fix:     func() error { return regenerateActivationScripts(envPath, envName) },
+		})
+	}
+	return steps
+}
+
+// diagnoseMetadata checks that metadata.json parses. An unreadable file is
+// backed up and rebuilt with the tool family of the configuration or snap;
+// other settings recorded in it are lost.
+func diagnoseMetadata(envPath, envName string, snap *snaps.Snap) []repairStep {
+	metaPath := filepath.Join(envPath, metadataFileName)
+	_, err := loadEnvMetadata(envPath)
+	if err == nil {
+		return nil
+	}
+	return []repairStep{{
+		Problem: fmt.Sprintf("%s is invalid: %v", metaPath, err),
+		Action:  "back it up and rebuild it",
+		fix: func() error {
+			if err := backupAndRemove(envPath, metaPath); err != nil {
+				return err
+			}
+			config, _ := readConfig(filepath.Join(envPath, "config", envName, tfvenvrcFileName))
+			meta := EnvironmentMetadata{Tool: resolveTool(config.Tool, snap.Tool), CreatedBy: getUsername()}
+			return saveEnvMetadata(envPath, meta)
+		},
+	}}
+}
+
+// diagnoseConfig checks the templates, the .tfvars and terragrunt.hcl files
+// made from them, and .tfvenvrc.
+func diagnoseConfig(envPath, envName string, snap *snaps.Snap) []repairStep {
+	var steps []repairStep
+	configEnvDir := filepath.Join(envPath, "config", envName)
+	tfvarsTemplatePath := filepath.Join(envPath, "templates", fmt.Sprintf("%s.tfvars.template", envName))
+	terragruntTemplatePath := filepath.Join(envPath, "templates", fmt.Sprintf("terragrunt.%s.hcl.template", envName))
+
+	if !fileExists(tfvarsTemplatePath) {
+		steps = append(steps, repairStep{
+			Problem: fmt.Sprintf("template %s is missing", tfvarsTemplatePath),
+			Action:  "write the default template",
+			fix:     func() error { return createDefaultTfvarsTemplate(tfvarsTemplatePath) },
+		})
+	}
+	terraformOnly := envTerraformOnly(envPath, envName)
+	if !terraformOnly && !fileExists(terragruntTemplatePath) {
+		steps = append(steps, repairStep{
+			Problem: fmt.Sprintf("template %s is missing", terragruntTemplatePath),
+			Action:  "write the default template",
+			fix:     func() error { return createDefaultTerragruntTemplate(terragruntTemplatePath) },
+		})
+	}
+
+	tfvarsPath := filepath.Join(configEnvDir, fmt.Sprintf("%s.tfvars", envName))
+	if problem := configFileProblem(tfvarsPath); problem != "" {
+		steps = append(steps, repairStep{
+			Problem: problem,
+			Action:  "rebuild it from " + filepath.Base(tfvarsTemplatePath),
+			fix: func() error {
+				if err := backupAndRemove(envPath, tfvarsPath); err != nil {
+					return err
+				}
+				tfVersion, tgVersion := repairVersions(envPath, envName, snap)
+				return copyAndCustomizeConfig(tfvarsTemplatePath, tfvarsPath, tfVersion, tgVersion, envName)
+			},
+		})
+	}
+
+	terragruntPath := filepath.Join(configEnvDir, fmt.Sprintf("terragrunt.%s.hcl", envName))
+	if problem := configFileProblem(terragruntPath); problem != "" && !terraformOnly {
+		steps = append(steps, repairStep{
+			Problem: problem,
+			Action:  "rebuild it from " + filepath.Base(terragruntTemplatePath),
+			fix: func() error {
+				if err := backupAndRemove(envPath, terragruntPath); err != nil {
+					return err
+				}
+				return customizeTerragruntHcl(terragruntTemplatePath, terragruntPath, Config{
+					S3StateBucket: "your_s3_state_bucket",
+					S3StatePath:   "your_s3_state_path",
+					Region:        "your_aws_region",
+					EnvVars:       withEnvPaths(nil, envPath),
+				})
+			},
+		})
+	}
+
+	configPath := filepath.Join(configEnvDir, tfvenvrcFileName)
+	if !fileExists(configPath) {
+		return steps
+	}
+	problems, _, err := validateConfigFile(configPath)
+	switch {
+	case err != nil:
+		steps = append(steps, repairStep{
+			Problem: fmt.Sprintf("%s cannot be read: %v", configPath, err),
+			Action:  "back it up and write one with the tool and versions only",
+			fix: func() error {
+				tfVersion, tgVersion := repairVersions(envPath, envName, snap)
+				meta, _ := loadEnvMetadata(envPath)
+				tool := meta.Tool
+				if tool == "" {
+					tool = snap.Tool
+				}
+				if err := backupAndRemove(envPath, configPath); err != nil {
+					return err
+				}
+				content := fmt.Sprintf("TOOL=%s\nTF_VERSION=%s\nTG_VERSION=%s\n", resolveTool("", tool), tfVersion, tgVersion)
+				return writeSecretFile(configPath, []byte(content))
+			},
+		})
+	case len(problems) > 0:
+		steps = append(steps, repairStep{
+			Problem: fmt.Sprintf("%s is invalid: %s", configPath, strings.Join(problems, "; ")),
+			Action:  fmt.Sprintf("fix the values by hand ('tfvenv config validate %s' explains them)", envName),
+		})
+	}
+	return steps
+}
+
+// configFileProblem describes why a generated configuration file needs to be
+// rebuilt, or returns "" when it is fine. SOPS-encrypted files are not parsed.
+func configFileProblem(path string) string {
+	if !fileExists(path) {
+		return fmt.Sprintf("%s is missing", path)
+	}
+	if isSopsEncrypted(path) {
+		return ""
+	}
+	if _, err := formatHCLFile(path, true); err != nil {
+		return fmt.Sprintf("%s does not parse: %v", path, err)
+	}
+	return ""
+}
+
+// diagnoseBinaries checks that the tool and Terragrunt binaries run, and
+// reinstalls the pinned versions of those that do not.
+func diagnoseBinaries(envPath, envName string, snap *snaps.Snap) []repairStep {
+	var steps []repairStep
+	binDir := filepath.Join(envPath, "bin")
+	config, _ := readConfig(filepath.Join(envPath, "config", envName, tfvenvrcFileName))
+	tool := envTool(envPath, envName)
+	if meta, err := loadEnvMetadata(envPath); (err != nil || meta.Tool == "") && snap.Tool != "" {
+		tool = resolveTool(config.Tool, snap.Tool)
+	}
+	tfVersion, tgVersion := repairVersions(envPath, envName, snap)
+
+	// A binary that is present but broken is always reinstalled; a missing
+	// Terragrunt only when .tfvenvrc asks for it
+	check := func(name, wanted string, required bool) {
+		path := envBinaryPath(envPath, name)
+		problem := ""
+		if _, err := os.Lstat(path); err != nil {
+			if !required {
+				return
+			}
+			problem = fmt.Sprintf("%s is missing", path)
+		} else if _, err := getBinaryVersion(path, name); err != nil {
+			problem = fmt.Sprintf("%s does not run: %v", path, err)
+		}
+		if problem == "" {
+			return
+		}
+		if wanted == "" || wanted == "none" {
+			steps = append(steps, repairStep{
+				Problem: problem,
+				Action:  fmt.Sprintf("no %s version is pinned in %s or recorded in a snap; reinstall with 'tfvenv create %s <version> --repair'", toolDisplayName(name), tfvenvrcFileName, envName),
+			})
+			return
+		}
+		steps = append(steps, repairStep{
+			Problem: problem,
+			Action:  fmt.Sprintf("reinstall %s %s", toolDisplayName(name), wanted),
+			fix: func() error {
+				if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+					return err
+				}
+				if err := downloadAndInstallBinary(toolDownloadURL(name), wanted, binDir, name); err != nil {
+					return err
+				}
+				refreshEnvState(envPath, envName)
+				return nil
+			},
+		})
+	}
+
+	check(tool, tfVersion, true)
+	check("terragrunt", tgVersion, config.TgVersion != "" && config.TgVersion != "none")
+	return steps
+}
+
+// repairVersions returns the versions to rebuild an environment with: those
+// installed when they still run, then those in .tfvenvrc, then those of the
+// latest snap.
+func repairVersions(envPath, envName string, snap *snaps.Snap) (string, string) {
+	tfVersion, tgVersion, err := pinnedToolVersions(envPath, envName)
+	if err != nil || tfVersion == "latest" {
+		if v := snapVersion(snap.TerraformVersion); v != "" {
+			tfVersion = v
+		}
+	}
+	if tgVersion == "none" || tgVersion == "latest" {
+		if v := snapVersion(snap.TerragruntVersion); v != "" {
+			tgVersion = v
+		}
+	}
+	return tfVersion, tgVersion
+}
+
+// regenerateActivationScripts rewrites the activation and deactivation
+// scripts from .tfvenvrc, or from the defaults create uses when it cannot be read.
+func regenerateActivationScripts(envPath, envName string) error {
+	config, err := readConfig(filepath.Join(envPath, "config", envName, tfvenvrcFileName))
+	if err != nil {
+		logger.Warnf("error reading %s, using defaults for the activation scripts: %v", tfvenvrcFileName, err)
+		config = Config{}
+	}
+	config.EnvVars = withEnvPaths(config.EnvVars, envPath)
+	if err := generateActivateScript(envPath, envName, config); err != nil {
+		return err
+	}
+	return generateDeactivateScript(envPath, config)
+}
+
+// backupAndRemove moves a damaged file into a new backup set.
+func backupAndRemove(envPath, path string) error {
+	if !fileExists(path) {
+		return nil
+	}
+	backupDir, err := newBackupSet(envPath)
+	if err != nil {
+		return err
+	}
+	if err := backupFile(envPath, backupDir, path); err != nil {
+		return err
+	}
+	fmt.Printf("  backed up %s to %s\n", path, backupDir)
+	return os.Remove(path)
+}
+
+// snapVersion returns a version recorded in a snap ("v1.6.6") without its
+// prefix, or "" when the snap could not determine it.
+func snapVersion(v string) string {
+	v = strings.TrimPrefix(v, "v")
+	if _, err := version.NewVersion(v); err != nil {
+		return ""
+	}
+	return v
+}
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"tfvenv/i18n"
+	"tfvenv/snaps"
+)
+
+// restoreStateFileName records, in the data directory, which snap each
+// environment was last restored from, so an interrupted restore-all resumes
+// where it stopped.
+const restoreStateFileName = "restore-all.json"
+
+// restoreStateMu serialises updates from concurrent restores.
+var restoreStateMu sync.Mutex
+
+// restoreRecord is a completed restore of one environment.
+type restoreRecord struct {
+	Snap     string    `json:"snap"`
+	Restored time.Time `json:"restored"`
+}
+
+// restoreTarget is an environment restore-all rebuilds. Env carries what the
+// manifest declares, or only the name for environments given by --envs.
+type restoreTarget struct {
+	Env      manifestEnv
+	Path     string
+	Declared bool
+}
+
+// restoreOutcome is how the restore of one environment ended.
+type restoreOutcome struct {
+	Snap     string
+	Attempts int
+	Skipped  bool
+}
+
+// restoreAllCmd rebuilds a group of environments from their latest snaps.
+func restoreAllCmd() *cobra.Command {
+	var fromRemote, force bool
+	var group, manifestFlag, keyTemplate string
+	var envNames []string
+	var parallel, retries int
+
+	cmd := &cobra.Command{
+		Use:   "restore-all",
+		Short: "Rebuild a group of environments from their latest snaps, in parallel",
+		Long: `Rebuild every environment of a group from its latest snap, for recovering a
+build host. With --from-remote the latest snap of each environment is pulled
+from remote S3 storage and kept as a local snap; otherwise the newest local
+snap is used. Each environment is created if it is missing, and otherwise
+rebuilt, with the snap's tool and versions, workspace and scripts. Settings
+the project manifest declares are written to .tfvenvrc as 'tfvenv up' does.
+
+Groups come from the groups key of the environments in ` + manifestFileName + `;
+--group all selects every declared environment. Without a manifest, name the
+environments with --envs. A failed environment is retried, and environments
+already restored from their latest snap are skipped when the command is run
+again, unless --force is given.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			targets, err := resolveRestoreTargets(manifestFlag, group, envNames)
+			if err != nil {
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			if len(targets) == 0 {
+				fmt.Printf("No environments in group '%s'.\n", group)
+				return
+			}
+			if fromRemote && os.Getenv("REMOTE_SNAP_AUTH") == "" {
+				fmt.Println("Error: REMOTE_SNAP_AUTH must be set.")
+				os.Exit(1)
+			}
+			if keyTemplate != "" {
+				if err := validateSnapKeyTemplate(keyTemplate); err != nil {
+					fmt.Printf("Error: --key-template: %v\n", err)
+					os.Exit(1)
+				}
+				if !strings.Contains(keyTemplate, "{{env}}") {
+					fmt.Println("Error: --key-template must contain {{env}}, or every environment would restore the same snap.")
+					os.Exit(1)
+				}
+			}
+
+			handleInterruptsGracefully()
+			progress := newRestoreProgress()
+			outcomes := make([]restoreOutcome, len(targets))
+			jobs := make([]job, len(targets))
+			for i, target := range targets {
+				i, target := i, target
+				jobs[i] = job{
+					Name: target.Env.Name,
+					Run: func() error {
+						outcome, err := restoreWithRetries(target, fromRemote, keyTemplate, force, retries, progress)
+						outcomes[i] = outcome
+						return err
+					},
+				}
+			}
+
+			fmt.Printf("Restoring %d environment(s), %d at a time.\n", len(targets), parallel)
+			results := runJobs(jobs, parallel)
+			printRestoreSummary(targets, outcomes, results)
+			if err := jobsError(results); err != nil {
+				logger.Errorf("restore-all failed: %v", err)
+				fmt.Println("Run the same command again to retry the failed environments; restored ones are skipped.")
+				os.Exit(1)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&fromRemote, "from-remote", false, "Pull each environment's latest snap from remote S3 storage")
+	cmd.Flags().StringVar(&group, "group", "", "Group of environments in "+manifestFileName+" to restore, or all")
+	cmd.Flags().StringSliceVar(&envNames, "envs", nil, "Environments under --env-dir to restore (comma-separated), instead of a group")
+	cmd.Flags().StringVar(&manifestFlag, "manifest", "", "Path to "+manifestFileName+" (defaults to the nearest one)")
+	cmd.Flags().StringVar(&keyTemplate, "key-template", "", "REMOTE_SNAP_KEY template to find the snaps of environments whose .tfvenvrc is gone")
+	cmd.Flags().IntVar(&retries, "retries", 2, "How often to retry an environment that failed")
+	cmd.Flags().BoolVar(&force, "force", false, "Restore environments already restored from their latest snap")
+	addParallelFlag(cmd, &parallel)
+	return cmd
+}
+
+// resolveRestoreTargets returns the environments of group in the manifest, or
+// the environments named by envNames under --env-dir.
+func resolveRestoreTargets(manifestFlag, group string, envNames []string) ([]restoreTarget, error) {
+	if (group == "") == (len(envNames) == 0) {
+		return nil, fmt.Errorf("give either --group or --envs")
+	}
+
+	var targets []restoreTarget
+	if len(envNames) > 0 {
+		envDir := viper.GetString("env-dir")
+		for _, name := range envNames {
+			targets = append(targets, restoreTarget{Env: manifestEnv{Name: name}, Path: filepath.Join(envDir, name)})
+		}
+		return targets, nil
+	}
+
+	manifestPath, err := resolveManifestPath(manifestFlag)
+	if err != nil {
+		return nil, err
+	}
+	m, err := loadManifest(manifestPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, env := range m.Environments {
+		if env.inGroup(group) {
+			targets = append(targets, restoreTarget{Env: env, Path: m.envPath(manifestPath, env), Declared: true})
+		}
+	}
+	return targets, nil
+}
+
+// restoreWithRetries restores one environment, retrying with a growing pause
+// until it succeeds or retries run out.
+func restoreWithRetries(target restoreTarget, fromRemote bool, keyTemplate string, force bool, retries int, progress *restoreProgress) (restoreOutcome, error) {
+	var outcome restoreOutcome
+	var err error
+	for attempt := 1; attempt <= retries+1; attempt++ {
+		outcome.Attempts = attempt
+		outcome.Snap, outcome.Skipped, err = restoreEnvironment(target, fromRemote, keyTemplate, force, progress)
+		if err == nil {
+			return outcome, nil
+		}
+		if rootCtx.Err() != nil || attempt > retries {
+			break
+		}
+		pause := time.Duration(attempt) * 5 * time.Second
+		progress.set(target.Env.Name, fmt.Sprintf("failed (%v); retrying in %s", err, pause))
+		select {
+		case <-rootCtx.Done():
+			return outcome, rootCtx.Err()
+		case <-time.After(pause):
+		}
+	}
+	progress.set(target.Env.Name, "failed")
+	return outcome, err
+}
+
+// restoreEnvironment finds the latest snap of an environment and rebuilds the
+// environment from it. It returns the snap and whether the environment was
+// already restored from it.
+func restoreEnvironment(target restoreTarget, fromRemote bool, keyTemplate string, force bool, progress *restoreProgress) (string, bool, error) {
+	env := target.Env
+	progress.set(env.Name, "locating latest snap")
+
+	var snap snaps.Snap
+	var snapName, localName string
+	var snapData []byte
+	if fromRemote {
+		accessKey, secretKey, region, profile, err := remoteSnapAWS(target.Path, env.Name)
+		if err != nil {
+			return "", false, err
+		}
+		prefix, err := restoreSnapPrefix(target, keyTemplate)
+		if err != nil {
+			return "", false, err
+		}
+		ctx, cancel := context.WithTimeout(rootCtx, 5*time.Minute)
+		defer cancel()
+		snapName, err = snaps.LatestRemoteSnap(ctx, prefix, accessKey, secretKey, region, profile)
+		if err != nil {
+			return "", false, err
+		}
+		if snapName == "" {
+			return "", false, fmt.Errorf("no remote snaps under '%s'", prefix)
+		}
+		if !force && restoredFrom(target.Path, snapName) {
+			progress.set(env.Name, "already restored from "+snapName)
+			return snapName, true, nil
+		}
+
+		progress.set(env.Name, "downloading "+snapName)
+		encrypted, err := snaps.GetRemoteSnap(ctx, snapName, accessKey, secretKey, region, profile)
+		if err != nil {
+			return snapName, false, err
+		}
+		if snapData, err = snaps.Decrypt(encrypted); err != nil {
+			return snapName, false, fmt.Errorf("error decrypting snap '%s': %w", snapName, err)
+		}
+		parsed, err := snaps.ParseSnap(snapData)
+		if err != nil {
+			return snapName, false, fmt.Errorf("snap '%s' is not readable: %w", snapName, err)
+		}
+		snap = *parsed
+		if _, localName, err = remoteSnapTarget(snapName); err != nil {
+			return snapName, false, err
+		}
+	} else {
+		latest, name := latestSnap(target.Path)
+		if latest == nil {
+			return "", false, fmt.Errorf("no local snaps in %s", filepath.Join(target.Path, "snaps"))
+		}
+		snap, snapName = *latest, name
+		if !force && restoredFrom(target.Path, snapName) {
+			progress.set(env.Name, "already restored from "+snapName)
+			return snapName, true, nil
+		}
+	}
+
+	tool := resolveTool(snap.Tool, env.Tool)
+	tfVersion := snapVersion(snap.TerraformVersion)
+	if tfVersion == "" {
+		tfVersion = defaultString(env.TfVersion, "latest")
+	}
+	tgVersion := snapVersion(snap.TerragruntVersion)
+	if tgVersion == "" {
+		tgVersion = defaultString(env.TgVersion, "none")
+	}
+
+	_, statErr := os.Stat(target.Path)
+	missing := os.IsNotExist(statErr)
+	if missing {
+		if err := checkEnvQuota(filepath.Dir(target.Path)); err != nil {
+			return snapName, false, err
+		}
+	}
+	progress.set(env.Name, fmt.Sprintf("rebuilding with %s %s, Terragrunt %s", toolDisplayName(tool), tfVersion, tgVersion))
+	if err := initEnv(target.Path, tool, tfVersion, tgVersion, env.Name, !missing); err != nil {
+		return snapName, false, err
+	}
+
+	if target.Declared {
+		configPath := filepath.Join(target.Path, "config", env.Name, tfvenvrcFileName)
+		if _, err := writeConfigValues(configPath, env.configValues()); err != nil {
+			return snapName, false, err
+		}
+	}
+	if snapData != nil {
+		if err := os.MkdirAll(filepath.Join(target.Path, "snaps"), 0755); err != nil {
+			return snapName, false, err
+		}
+		if err := writeSecretFile(snaps.GetSnapFilePath(target.Path, localName), snapData); err != nil {
+			return snapName, false, err
+		}
+	}
+	if snap.Workspace != "" {
+		if err := updateEnvMetadata(target.Path, func(meta *EnvironmentMetadata) { meta.Workspace = snap.Workspace }); err != nil {
+			return snapName, false, err
+		}
+	}
+	if len(snap.Scripts) > 0 {
+		if err := restoreScripts(target.Path, snap.Scripts); err != nil {
+			return snapName, false, err
+		}
+	}
+
+	if err := recordRestore(target.Path, snapName); err != nil {
+		logger.Warnf("failed to record the restore of %s: %v", env.Name, err)
+	}
+	progress.set(env.Name, "restored from "+snapName)
+	return snapName, false, nil
+}
+
+// restoreSnapPrefix returns the key prefix of an environment's remote snaps:
+// from --key-template when given, else from its .tfvenvrc. Without either,
+// the snaps of one environment cannot be told from another's.
+func restoreSnapPrefix(target restoreTarget, keyTemplate string) (string, error) {
+	var prefix string
+	var err error
+	if keyTemplate != "" {
+		prefix, err = snapKeyPrefix(keyTemplate, snapKeyVars{Env: target.Env.Name, EnvPath: target.Path, Tool: resolveTool(target.Env.Tool, "")})
+	} else {
+		prefix, err = remoteSnapPrefix(target.Path, target.Env.Name)
+	}
+	if err != nil {
+		return "", err
+	}
+	if prefix == "" {
+		return "", fmt.Errorf("no REMOTE_SNAP_KEY template to find the snaps of '%s' with; pass --key-template", target.Env.Name)
+	}
+	return prefix, nil
+}
+
+// defaultString returns value, or def when value is empty.
+func defaultString(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
+
+// restoreStatePath returns the file recording completed restores.
+func restoreStatePath() string {
+	return filepath.Join(userDirs.DataDir(), restoreStateFileName)
+}
+
+// loadRestoreState reads the completed restores, keyed by environment path.
+func loadRestoreState() map[string]restoreRecord {
+	state := make(map[string]restoreRecord)
+	data, err := os.ReadFile(restoreStatePath())
+	if err != nil {
+		return state
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		logger.Warnf("ignoring corrupt %s: %v", restoreStatePath(), err)
+		return make(map[string]restoreRecord)
+	}
+	return state
+}
+
+// restoredFrom reports whether the environment was restored from snap and
+// has not been left incomplete since.
+func restoredFrom(envPath, snap string) bool {
+	if fileExists(filepath.Join(envPath, incompleteMarkerName)) {
+		return false
+	}
+	restoreStateMu.Lock()
+	defer restoreStateMu.Unlock()
+	record, ok := loadRestoreState()[absPath(envPath)]
+	if !ok || record.Snap != snap {
+		return false
+	}
+	info, err := os.Stat(envPath)
+	return err == nil && info.IsDir()
+}
+
+// recordRestore notes that the environment was restored from snap.
+func recordRestore(envPath, snap string) error {
+	restoreStateMu.Lock()
+	defer restoreStateMu.Unlock()
+	state := loadRestoreState()
+	state[absPath(envPath)] = restoreRecord{Snap: snap, Restored: time.Now().UTC()}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(restoreStatePath()), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(restoreStatePath(), data, 0644)
+}
+
+// absPath returns path made absolute, or path itself if that fails.
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// restoreProgress prints what each environment's restore is doing as it
+// changes, so a long parallel restore shows where every environment stands.
+type restoreProgress struct {
+	mu      sync.Mutex
+	started time.Time
+}
+
+// newRestoreProgress starts the clock of a restore.
+func newRestoreProgress() *restoreProgress {
+	return &restoreProgress{started: time.Now()}
+}
+
+// set reports the current step of an environment's restore.
+func (p *restoreProgress) set(envName, status string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Printf("[%s] %-20s %s\n", formatElapsed(time.Since(p.started)), envName, status)
+	logger.Infof("restore-all %s: %s", envName, status)
+}
+
+// formatElapsed formats a duration as minutes and seconds.
+func formatElapsed(d time.Duration) string {
+	d = d.Round(time.Second)
+	return fmt.Sprintf("%02d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
+
+// printRestoreSummary prints one line per environment with the snap it was
+// restored from, the attempts it took and how it ended.
+func printRestoreSummary(targets []restoreTarget, outcomes []restoreOutcome, results []jobResult) {
+	fmt.Printf("\n%-20s %-10s %-8s %-9s %s\n", "ENVIRONMENT", "STATUS", "ATTEMPTS", "TIME", "SNAP")
+	for i, target := range targets {
+		status := "restored"
+		switch {
+		case results[i].Err != nil:
+			status = "FAILED"
+		case outcomes[i].Skipped:
+			status = "skipped"
+		}
+		snap := outcomes[i].Snap
+		if snap == "" {
+			snap = "-"
+		}
+		fmt.Printf("%-20s %-10s %-8d %-9s %s\n", target.Env.Name, status, outcomes[i].Attempts, results[i].Elapsed.Round(time.Second), snap)
+	}
+	var failed []string
+	for i, result := range results {
+		if result.Err != nil {
+			failed = append(failed, targets[i].Env.Name)
+		}
+	}
+	if len(failed) == 0 {
+		fmt.Printf("All %d environment(s) restored.\n", len(targets))
+		return
+	}
+	fmt.Printf("%d environment(s) failed: %s\n", len(failed), strings.Join(failed, ", "))
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// rootModuleSkipDirs are never searched for root modules.
+var rootModuleSkipDirs = map[string]bool{".terraform": true, ".terragrunt-cache": true, ".git": true, "modules": true, backupsDirName: true}
+
+// envRoots returns the Terraform root modules of an environment as paths
+// relative to its config directory, "." being the config directory itself.
+// ROOTS in .tfvenvrc lists them explicitly; otherwise every directory holding
+// .tf files that is not inside another root is one. Directories named
+// modules are taken to hold child modules and are not searched.
+func envRoots(envPath, envName string) ([]string, error) {
+	configEnvDir := filepath.Join(envPath, "config", envName)
+	config, _ := readConfig(filepath.Join(configEnvDir, tfvenvrcFileName))
+	if strings.TrimSpace(config.Roots) != "" {
+		var roots []string
+		for _, root := range strings.Split(config.Roots, ",") {
+			root = filepath.Clean(strings.TrimSpace(root))
+			if root == "" {
+				continue
+			}
+			if filepath.IsAbs(root) || strings.HasPrefix(root, "..") {
+				return nil, fmt.Errorf("root %q in ROOTS must be inside %s", root, configEnvDir)
+			}
+			if info, err := os.Stat(filepath.Join(configEnvDir, root)); err != nil || !info.IsDir() {
+				return nil, fmt.Errorf("root %q in ROOTS is not a directory under %s", root, configEnvDir)
+			}
+			roots = append(roots, root)
+		}
+		return roots, nil
+	}
+
+	var roots []string
+	err := filepath.Walk(configEnvDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if path != configEnvDir && rootModuleSkipDirs[info.Name()] {
+			return filepath.SkipDir
+		}
+		tfFiles, _ := filepath.Glob(filepath.Join(path, "*.tf"))
+		if len(tfFiles) == 0 {
+			return nil
+		}
+		relPath, err := filepath.Rel(configEnvDir, path)
+		if err != nil {
+			return err
+		}
+		roots = append(roots, relPath)
+		return filepath.SkipDir
+	})
+	if os.IsNotExist(err) {
+		return []string{"."}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to search %s for root modules: %w", configEnvDir, err)
+	}
+	if len(roots) == 0 {
+		roots = []string{"."}
+	}
+	sort.Strings(roots)
+	return roots, nil
+}
+
+// rootDataDir returns the TF_DATA_DIR of a root module. Roots below the config
+// directory get their own directory so their backends and providers do not mix.
+func rootDataDir(envPath, root string) string {
+	if root == "." {
+		return filepath.Join(envPath, "terraform-data")
+	}
+	return filepath.Join(envPath, "terraform-data", "roots", root)
+}
+
+// rootLabel names a root module in status output.
+func rootLabel(envName, root string) string {
+	if root == "." {
+		return envName
+	}
+	return envName + "/" + filepath.ToSlash(root)
+}
+
+// rootOf returns the root module containing path, or "" when path is outside
+// every root.
+func rootOf(configEnvDir string, roots []string, path string) string {
+	best := ""
+	for _, root := range roots {
+		dir := filepath.Join(configEnvDir, root)
+		relPath, err := filepath.Rel(dir, path)
+		if err != nil || strings.HasPrefix(relPath, "..") {
+			continue
+		}
+		if best == "" || len(root) > len(best) {
+			best = root
+		}
+	}
+	return best
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// providerPin describes a provider entry from the PROVIDERS key in .tfvenvrc.
+type providerPin struct {
+	Name    string
+	Source  string
+	Version string
+}
+
+// parseProviderPins parses PROVIDERS values of the form
+// "aws=5.31.0,integrations/github=6.0.0". Providers without a namespace
+// default to the hashicorp namespace.
+func parseProviderPins(value string) ([]providerPin, error) {
+	var pins []providerPin
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("invalid provider pin %q, expected <provider>=<version>", entry)
+		}
+		source := strings.TrimSpace(parts[0])
+		if !strings.Contains(source, "/") {
+			source = "hashicorp/" + source
+		}
+		pins = append(pins, providerPin{
+			Name:    source[strings.LastIndex(source, "/")+1:],
+			Source:  source,
+			Version: strings.TrimSpace(parts[1]),
+		})
+	}
+	sort.Slice(pins, func(i, j int) bool { return pins[i].Name < pins[j].Name })
+	return pins, nil
+}
+
+// generateScaffolding writes backend.tf, provider.tf and versions.tf into the
+// environment's config directory. Existing files are left untouched so that
+// re-running create never clobbers hand-edited configuration.
+func generateScaffolding(configEnvDir, environment, tfVersion string, config Config) ([]string, error) {
+	pins, err := parseProviderPins(config.Providers)
+	if err != nil {
+		return nil, err
+	}
+
+	files := map[string]*hclwrite.File{
+		"versions.tf": buildVersionsFile(tfVersion, pins),
+		"provider.tf": buildProviderFile(config, pins),
+	}
+	if config.S3StateBucket != "" {
+		files["backend.tf"] = buildBackendFile(environment, config)
+	} else {
+		logger.Warnf("S3_STATE_BUCKET not set, skipping backend.tf for %s", environment)
+	}
+
+	var written []string
+	for _, name := range []string{"backend.tf", "provider.tf", "versions.tf"} {
+		file, ok := files[name]
+		if !ok {
+			continue
+		}
+		path := filepath.Join(configEnvDir, name)
+		if fileExists(path) {
+			logger.Infof("%s already exists, leaving it unchanged", path)
+			continue
+		}
+		if err := os.WriteFile(path, hclwrite.Format(file.Bytes()), 0644); err != nil {
+			return written, fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		written = append(written, path)
+	}
+	return written, nil
+}
+
+// buildBackendFile renders an S3 backend with DynamoDB state locking.
+func buildBackendFile(environment string, config Config) *hclwrite.File {
+	file := hclwrite.NewEmptyFile()
+	backend := file.Body().AppendNewBlock("terraform", nil).Body().AppendNewBlock("backend", []string{"s3"}).Body()
+
+	key := fmt.Sprintf("%s/terraform.tfstate", environment)
+	if config.S3StatePath != "" {
+		key = fmt.Sprintf("%s/%s", strings.Trim(config.S3StatePath, "/"), key)
+	}
+	backend.SetAttributeValue("bucket", cty.StringVal(config.S3StateBucket))
+	backend.SetAttributeValue("key", cty.StringVal(key))
+	if config.Region != "" {
+		backend.SetAttributeValue("region", cty.StringVal(config.Region))
+	}
+	if config.DynamoDBTable != "" {
+		backend.SetAttributeValue("dynamodb_table", cty.StringVal(config.DynamoDBTable))
+	}
+	backend.SetAttributeValue("encrypt", cty.True)
+	return file
+}
+
+// buildProviderFile renders one provider block per pinned provider. The AWS
+// provider receives the configured region.
+func buildProviderFile(config Config, pins []providerPin) *hclwrite.File {
+	file := hclwrite.NewEmptyFile()
+	body := file.Body()
+	for i, pin := range pins {
+		if i > 0 {
+			body.AppendNewline()
+		}
+		provider := body.AppendNewBlock("provider", []string{pin.Name}).Body()
+		if pin.Name == "aws" && config.Region != "" {
+			provider.SetAttributeValue("region", cty.StringVal(config.Region))
+		}
+	}
+	return file
+}
+
+// buildVersionsFile renders the terraform block pinning the Terraform version
+// and the required providers.
+func buildVersionsFile(tfVersion string, pins []providerPin) *hclwrite.File {
+	file := hclwrite.NewEmptyFile()
+	terraform := file.Body().AppendNewBlock("terraform", nil).Body()
+	if tfVersion != "" && tfVersion != "latest" {
+		terraform.SetAttributeValue("required_version", cty.StringVal("= "+tfVersion))
+	}
+	if len(pins) > 0 {
+		required := terraform.AppendNewBlock("required_providers", nil).Body()
+		for _, pin := range pins {
+			required.SetAttributeValue(pin.Name, cty.ObjectVal(map[string]cty.Value{
+				"source":  cty.StringVal(pin.Source),
+				"version": cty.StringVal("= " + pin.Version),
+			}))
+		}
+	}
+	return file
+}
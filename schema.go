@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"tfvenv/i18n"
+	"tfvenv/schemas"
+)
+
+// schemaCmd groups the commands that publish the JSON Schemas of tfvenv's file formats.
+func schemaCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "schema",
+		Short: "Print the JSON Schemas of snaps, environment state and manifests",
+	}
+	cmd.AddCommand(schemaPrintCmd())
+	return cmd
+}
+
+// schemaPrintCmd prints one embedded schema.
+func schemaPrintCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "print <" + strings.Join(schemas.Names(), "|") + ">",
+		Short: "Print the JSON Schema of a file format",
+		Long: `Print the JSON Schema (draft 2020-12) of one of tfvenv's file formats:
+
+  snap                  the decrypted content of a .snap file
+  environment-state     the environment state a snap is taken from
+  manifest              tfvenv.yaml
+  environment-manifest  files written by 'tfvenv export manifest'
+
+Snaps are checked against their schema when they are restored or verified,
+and manifests when they are read, so editors and CI can use the same schemas
+to catch mistakes before tfvenv does.`,
+		Args:      cobra.ExactArgs(1),
+		ValidArgs: schemas.Names(),
+		Run: func(cmd *cobra.Command, args []string) {
+			data, err := schemas.Source(args[0])
+			if err != nil {
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			fmt.Print(string(data))
+		},
+	}
+}
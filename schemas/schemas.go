@@ -0,0 +1,348 @@
+package schemas
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Names of the published schemas.
+const (
+	Snap                = "snap"
+	EnvironmentState    = "environment-state"
+	Manifest            = "manifest"
+	EnvironmentManifest = "environment-manifest"
+)
+
+// files holds one JSON Schema per format, named <name>.schema.json.
+//
+//go:embed *.schema.json
+var files embed.FS
+
+// Names returns the names of the published schemas, sorted.
+func Names() []string {
+	return []string{EnvironmentManifest, EnvironmentState, Manifest, Snap}
+}
+
+// Source returns the JSON Schema document of a format.
+func Source(name string) ([]byte, error) {
+	data, err := files.ReadFile(name + ".schema.json")
+	if err != nil {
+		return nil, fmt.Errorf("unknown schema %q: expected one of %s", name, strings.Join(Names(), ", "))
+	}
+	return data, nil
+}
+
+// Problem is a value that does not match its schema. Path is a JSON pointer
+// to the value, "/" for the document itself.
+type Problem struct {
+	Path    string
+	Message string
+}
+
+// ValidationError lists every problem found in a document.
+type ValidationError struct {
+	Schema   string
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		parts[i] = problem.Path + ": " + problem.Message
+	}
+	return fmt.Sprintf("does not match the %s schema: %s", e.Schema, strings.Join(parts, "; "))
+}
+
+// ValidateJSON checks a JSON document against a schema.
+func ValidateJSON(name string, data []byte) error {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("not valid JSON: %w", err)
+	}
+	return validate(name, doc)
+}
+
+// ValidateYAML checks a YAML document against a schema. The manifests hold
+// only strings, and yaml.v3 reads any scalar into a string field, so scalars
+// are compared as strings: tf_version: 1.6 is as valid as tf_version: "1.6".
+func ValidateYAML(name string, data []byte) error {
+	var node yaml.Node
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&node); err != nil {
+		return fmt.Errorf("not valid YAML: %w", err)
+	}
+	return validate(name, yamlValue(&node))
+}
+
+// yamlValue converts a YAML node to the values encoding/json decodes to,
+// keeping scalars as strings.
+func yamlValue(node *yaml.Node) interface{} {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return nil
+		}
+		return yamlValue(node.Content[0])
+	case yaml.AliasNode:
+		return yamlValue(node.Alias)
+	case yaml.MappingNode:
+		m := make(map[string]interface{}, len(node.Content)/2)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			m[node.Content[i].Value] = yamlValue(node.Content[i+1])
+		}
+		return m
+	case yaml.SequenceNode:
+		items := make([]interface{}, len(node.Content))
+		for i, item := range node.Content {
+			items[i] = yamlValue(item)
+		}
+		return items
+	}
+	if node.Tag == "!!null" {
+		return nil
+	}
+	return node.Value
+}
+
+// validate checks a decoded document against a schema and reports every
+// problem, ordered by path.
+func validate(name string, doc interface{}) error {
+	source, err := Source(name)
+	if err != nil {
+		return err
+	}
+	var s schema
+	if err := json.Unmarshal(source, &s); err != nil {
+		return fmt.Errorf("schema %s is invalid: %w", name, err)
+	}
+	var problems []Problem
+	s.check(doc, "", &problems)
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Path < problems[j].Path })
+	return &ValidationError{Schema: name, Problems: problems}
+}
+
+// schema is the part of JSON Schema the published schemas use. Annotations
+// such as description are ignored.
+type schema struct {
+	Type                 typeList           `json:"type"`
+	Enum                 []interface{}      `json:"enum"`
+	Properties           map[string]*schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties *additional        `json:"additionalProperties"`
+	Items                *schema            `json:"items"`
+	MinLength            *int               `json:"minLength"`
+	Pattern              string             `json:"pattern"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+}
+
+// typeList is the type keyword, a name or a list of names.
+type typeList []string
+
+func (t *typeList) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*t = typeList{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*t = many
+	return nil
+}
+
+// additional is the additionalProperties keyword: false, or the schema of
+// properties not listed in properties.
+type additional struct {
+	Forbidden bool
+	Schema    *schema
+}
+
+func (a *additional) UnmarshalJSON(data []byte) error {
+	var allowed bool
+	if err := json.Unmarshal(data, &allowed); err == nil {
+		a.Forbidden = !allowed
+		return nil
+	}
+	return json.Unmarshal(data, &a.Schema)
+}
+
+// check appends the ways value does not match s to problems.
+func (s *schema) check(value interface{}, path string, problems *[]Problem) {
+	at := path
+	if at == "" {
+		at = "/"
+	}
+	report := func(format string, args ...interface{}) {
+		*problems = append(*problems, Problem{Path: at, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(s.Type) > 0 && !s.Type.matches(value) {
+		report("expected %s, got %s", strings.Join(s.Type, " or "), typeName(value))
+		return
+	}
+	if len(s.Enum) > 0 && !s.inEnum(value) {
+		report("%s is not one of %s", describe(value), describeAll(s.Enum))
+		return
+	}
+
+	switch v := value.(type) {
+	case string:
+		if s.MinLength != nil && len([]rune(v)) < *s.MinLength {
+			if *s.MinLength == 1 {
+				report("must not be empty")
+			} else {
+				report("must be at least %d characters", *s.MinLength)
+			}
+		}
+		if s.Pattern != "" {
+			if re, err := regexp.Compile(s.Pattern); err == nil && !re.MatchString(v) {
+				report("%q does not match %s", v, s.Pattern)
+			}
+		}
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			report("%v is less than the minimum %v", v, *s.Minimum)
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			report("%v is greater than the maximum %v", v, *s.Maximum)
+		}
+	case map[string]interface{}:
+		for _, key := range s.Required {
+			if _, ok := v[key]; !ok {
+				report("missing required property %q", key)
+			}
+		}
+		for key, item := range v {
+			itemPath := path + "/" + escapePointer(key)
+			if property, ok := s.Properties[key]; ok {
+				property.check(item, itemPath, problems)
+				continue
+			}
+			if s.AdditionalProperties == nil {
+				continue
+			}
+			if s.AdditionalProperties.Forbidden {
+				*problems = append(*problems, Problem{Path: itemPath, Message: "unknown property"})
+			} else if s.AdditionalProperties.Schema != nil {
+				s.AdditionalProperties.Schema.check(item, itemPath, problems)
+			}
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.check(item, fmt.Sprintf("%s/%d", path, i), problems)
+			}
+		}
+	}
+}
+
+// matches reports whether value has one of the listed types.
+func (t typeList) matches(value interface{}) bool {
+	for _, name := range t {
+		switch name {
+		case "null":
+			if value == nil {
+				return true
+			}
+		case "boolean":
+			if _, ok := value.(bool); ok {
+				return true
+			}
+		case "string":
+			if _, ok := value.(string); ok {
+				return true
+			}
+		case "number":
+			if _, ok := value.(float64); ok {
+				return true
+			}
+		case "integer":
+			if f, ok := value.(float64); ok && f == math.Trunc(f) {
+				return true
+			}
+		case "object":
+			if _, ok := value.(map[string]interface{}); ok {
+				return true
+			}
+		case "array":
+			if _, ok := value.([]interface{}); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// inEnum reports whether value is one of the enum's values.
+func (s *schema) inEnum(value interface{}) bool {
+	for _, allowed := range s.Enum {
+		if allowed == value {
+			return true
+		}
+	}
+	return false
+}
+
+// typeName names the JSON type of a decoded value.
+func typeName(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// describe renders a scalar value for messages.
+func describe(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return fmt.Sprintf("%q", v)
+	case map[string]interface{}, []interface{}:
+		return "an " + typeName(value)
+	}
+	return fmt.Sprint(value)
+}
+
+// describeAll renders an enum's values for messages, leaving out null.
+func describeAll(values []interface{}) string {
+	var parts []string
+	for _, value := range values {
+		if value != nil {
+			parts = append(parts, describe(value))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// escapePointer escapes a property name for a JSON pointer.
+func escapePointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"tfvenv/snaps"
+)
+
+// scriptsDirName is the environment directory for team helpers (wrapper
+// scripts, small binaries) that activation adds to PATH after bin.
+const scriptsDirName = "scripts"
+
+// maxSnapScriptsSize bounds how much of the scripts directory a full snap
+// embeds, since snaps are encrypted and read whole.
+const maxSnapScriptsSize = 50 << 20
+
+// envScriptsDir returns the scripts directory of an environment.
+func envScriptsDir(envPath string) string {
+	return filepath.Join(envPath, scriptsDirName)
+}
+
+// captureScripts reads the regular files of an environment's scripts
+// directory for a full snap. Symlinks are skipped, since their targets would
+// not exist where the snap is restored.
+func captureScripts(envPath string) ([]snaps.ScriptFile, error) {
+	dir := envScriptsDir(envPath)
+	var files []snaps.ScriptFile
+	var total int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			if info.Mode()&os.ModeSymlink != 0 {
+				logger.Warnf("not capturing symlink %s in snap", path)
+			}
+			return nil
+		}
+		total += info.Size()
+		if total > maxSnapScriptsSize {
+			return fmt.Errorf("%s holds more than the %s a snap can embed", dir, formatSize(maxSnapScriptsSize))
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, snaps.ScriptFile{Name: filepath.ToSlash(rel), Mode: uint32(info.Mode().Perm()), Content: content})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to capture scripts: %w", err)
+	}
+	return files, nil
+}
+
+// restoreScripts writes the scripts of a full snap into an environment's
+// scripts directory, replacing files of the same name. Names that would land
+// outside the directory are refused.
+func restoreScripts(envPath string, files []snaps.ScriptFile) error {
+	dir := envScriptsDir(envPath)
+	for _, file := range files {
+		name := filepath.FromSlash(file.Name)
+		target := filepath.Join(dir, name)
+		if filepath.IsAbs(name) || !strings.HasPrefix(target, dir+string(os.PathSeparator)) {
+			return fmt.Errorf("refusing to restore script %q outside %s", file.Name, dir)
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to create directory %s: %w", filepath.Dir(target), err)
+		}
+		// Never write through a symlink left at the same path
+		if info, err := os.Lstat(target); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			if err := os.Remove(target); err != nil {
+				return fmt.Errorf("failed to replace %s: %w", target, err)
+			}
+		}
+		// Keep the recorded execute bits, without write access for group and others
+		mode := os.FileMode(file.Mode).Perm()&^0022 | 0600
+		if err := writeFileWithMode(target, file.Content, mode); err != nil {
+			return fmt.Errorf("failed to restore script %s: %w", target, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// Secret reference schemes accepted as ENV_VARS values.
+const (
+	onePasswordScheme = "op://"
+	bitwardenScheme   = "bw://"
+)
+
+// isSecretReference reports whether an ENV_VARS value refers to a password manager item.
+func isSecretReference(value string) bool {
+	return strings.HasPrefix(value, onePasswordScheme) || strings.HasPrefix(value, bitwardenScheme)
+}
+
+// secretsReadCmd resolves a single secret reference. Activation scripts call it
+// so the secret is fetched when the script is sourced and never written to disk.
+func secretsReadCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "read <op://vault/item/field|bw://item/field>",
+		Short: "Resolve a 1Password or Bitwarden secret reference and print the value",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			// stdout is captured by the calling script, so logs go elsewhere
+			if os.Getenv("TFVENV_LOG_FILE") == "" {
+				logger.Out = os.Stderr
+			}
+			value, err := resolveSecretReference(args[0])
+			if err != nil {
+				logger.Errorf("error resolving %s: %v", args[0], err)
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Print(value)
+		},
+	}
+}
+
+// resolveSecretReference fetches the value behind an op:// or bw:// reference with
+// the respective CLI. Both CLIs must already be signed in (op signin, BW_SESSION).
+func resolveSecretReference(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, onePasswordScheme):
+		output, err := runSecretCLI("op", "read", "--no-newline", ref)
+		if err != nil {
+			return "", err
+		}
+		return string(output), nil
+	case strings.HasPrefix(ref, bitwardenScheme):
+		return resolveBitwardenReference(strings.TrimPrefix(ref, bitwardenScheme))
+	default:
+		return "", fmt.Errorf("unsupported secret reference %q", ref)
+	}
+}
+
+// resolveBitwardenReference resolves "item/field", where field is username,
+// password (the default), notes, totp or the name of a custom field.
+func resolveBitwardenReference(path string) (string, error) {
+	item, field := path, "password"
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		item, field = path[:i], path[i+1:]
+	}
+	if item == "" || field == "" {
+		return "", fmt.Errorf("invalid Bitwarden reference %q, expected bw://item/field", bitwardenScheme+path)
+	}
+
+	if field == "totp" {
+		output, err := runSecretCLI("bw", "get", "totp", item)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(output)), nil
+	}
+
+	output, err := runSecretCLI("bw", "get", "item", item)
+	if err != nil {
+		return "", err
+	}
+	var entry struct {
+		Notes string `json:"notes"`
+		Login struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+		} `json:"login"`
+		Fields []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"fields"`
+	}
+	if err := json.Unmarshal(output, &entry); err != nil {
+		return "", fmt.Errorf("failed to parse Bitwarden item %s: %w", item, err)
+	}
+
+	switch field {
+	case "username":
+		return entry.Login.Username, nil
+	case "password":
+		return entry.Login.Password, nil
+	case "notes":
+		return entry.Notes, nil
+	}
+	for _, f := range entry.Fields {
+		if f.Name == field {
+			return f.Value, nil
+		}
+	}
+	return "", fmt.Errorf("Bitwarden item %s has no field %q", item, field)
+}
+
+// runSecretCLI runs a password manager CLI and returns its stdout.
+func runSecretCLI(name string, args ...string) ([]byte, error) {
+	binary, err := exec.LookPath(name)
+	if err != nil {
+		return nil, fmt.Errorf("%s CLI not found on PATH", name)
+	}
+	var stderr bytes.Buffer
+	cmd := exec.Command(binary, args...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s %s failed: %v: %s", name, args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return output, nil
+}
+
+// resolveEnvVars returns a copy of envVars with secret references replaced by
+// their values, for commands that run terraform directly.
+func resolveEnvVars(envVars map[string]string) (map[string]string, error) {
+	resolved := make(map[string]string, len(envVars))
+	for key, value := range envVars {
+		if isSecretReference(value) {
+			secret, err := resolveSecretReference(value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve %s: %w", key, err)
+			}
+			value = secret
+		}
+		resolved[key] = value
+	}
+	return resolved, nil
+}
+
+// tfvenvExecutable returns the path of the running tfvenv binary, which activation
+// scripts call to resolve secret references when they are sourced.
+func tfvenvExecutable() string {
+	self, err := os.Executable()
+	if err != nil {
+		return "tfvenv"
+	}
+	return self
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"tfvenv/i18n"
+)
+
+// defaultSecretsFileName is the sops-encrypted variables file edited by secrets edit.
+// It is not auto-loaded by terraform; tfvenv passes it explicitly after decrypting it.
+const defaultSecretsFileName = "secrets.sops.tfvars"
+
+// secretsCmd groups the commands that manage sops-encrypted variables files.
+func secretsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "secrets",
+		Short: "Manage sops-encrypted .tfvars files and password manager references",
+	}
+	cmd.AddCommand(secretsEditCmd())
+	cmd.AddCommand(secretsReadCmd())
+	return cmd
+}
+
+// secretsEditCmd opens an encrypted variables file with sops.
+func secretsEditCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "edit <env-name> [file]",
+		Short: "Create or edit a sops-encrypted .tfvars file with the environment's KMS/age settings",
+		Args:  cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envDir := viper.GetString("env-dir")
+			envPath := filepath.Join(envDir, envName)
+			configDir := filepath.Join(envPath, "config", envName)
+
+			if _, err := os.Stat(configDir); os.IsNotExist(err) {
+				i18n.Println("env.not_found", envName)
+				os.Exit(1)
+			}
+
+			fileName := defaultSecretsFileName
+			if len(args) == 2 {
+				fileName = args[1]
+			}
+			if filepath.Base(fileName) != fileName {
+				fmt.Println("Error: the file must be inside the environment's config directory; pass a file name only.")
+				os.Exit(1)
+			}
+			secretsPath := filepath.Join(configDir, fileName)
+
+			sopsCmd, err := sopsCommand(envPath, envName, secretsPath)
+			if err != nil {
+				logger.Errorf("error preparing sops: %v", err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			sopsCmd.Stdin = os.Stdin
+			sopsCmd.Stdout = os.Stdout
+			sopsCmd.Stderr = os.Stderr
+
+			logger.Infof("editing %s with sops", secretsPath)
+			if err := sopsCmd.Run(); err != nil {
+				// sops exits 200 when the file was left unchanged
+				if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 200 {
+					fmt.Printf("%s unchanged.\n", secretsPath)
+					return
+				}
+				logger.Errorf("sops failed for %s: %v", secretsPath, err)
+				fmt.Printf("Error: sops failed: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("%s saved (encrypted).\n", secretsPath)
+		},
+	}
+}
+
+// sopsCommand prepares sops with the environment's key settings. SOPS_KMS_ARN,
+// SOPS_AGE_RECIPIENTS, SOPS_AGE_KEY_FILE and AWS_PROFILE from .tfvenvrc are passed
+// through the environment variables sops reads natively.
+func sopsCommand(envPath, envName string, args ...string) (*exec.Cmd, error) {
+	sopsBinary, err := exec.LookPath("sops")
+	if err != nil {
+		return nil, fmt.Errorf("sops not found on PATH; install it from https://github.com/getsops/sops")
+	}
+
+	cmd := exec.Command(sopsBinary, args...)
+	cmd.Env = os.Environ()
+
+	configPath := filepath.Join(envPath, "config", envName, tfvenvrcFileName)
+	v := viper.New()
+	if err := readTfvenvrc(v, configPath); err == nil {
+		for _, key := range []string{"SOPS_KMS_ARN", "SOPS_AGE_RECIPIENTS", "SOPS_AGE_KEY_FILE", "AWS_PROFILE"} {
+			if value := v.GetString(key); value != "" {
+				cmd.Env = append(cmd.Env, key+"="+value)
+			}
+		}
+	}
+	return cmd, nil
+}
+
+// isSopsEncrypted reports whether a variables file was encrypted by sops, in
+// either JSON/binary form (a top-level "sops" object) or dotenv/ini form.
+func isSopsEncrypted(path string) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		var doc map[string]json.RawMessage
+		if err := json.Unmarshal(trimmed, &doc); err != nil {
+			return false
+		}
+		_, ok := doc["sops"]
+		return ok
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "sops_mac") {
+			return true
+		}
+	}
+	return false
+}
+
+// decryptSopsVarFiles decrypts every sops-encrypted .tfvars and .tfvars.json file
+// in configDir into a private directory on tmpfs. It returns the decrypted paths
+// keyed by the encrypted file and a cleanup function that removes the plaintext.
+func decryptSopsVarFiles(envPath, envName, configDir string) (map[string]string, func(), error) {
+	noop := func() {}
+
+	var encrypted []string
+	entries, err := os.ReadDir(configDir)
+	if err != nil {
+		return nil, noop, fmt.Errorf("failed to read %s: %w", configDir, err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !(strings.HasSuffix(name, ".tfvars") || strings.HasSuffix(name, ".tfvars.json")) {
+			continue
+		}
+		if path := filepath.Join(configDir, name); isSopsEncrypted(path) {
+			encrypted = append(encrypted, path)
+		}
+	}
+	if len(encrypted) == 0 {
+		return map[string]string{}, noop, nil
+	}
+	sort.Strings(encrypted)
+
+	base, err := secretsTmpfsDir()
+	if err != nil {
+		return nil, noop, err
+	}
+	dir, err := os.MkdirTemp(base, "tfvenv-secrets-")
+	if err != nil {
+		return nil, noop, fmt.Errorf("failed to create secrets directory: %w", err)
+	}
+	removeCleanup := onInterrupt(func() { os.RemoveAll(dir) })
+	cleanup := func() {
+		removeCleanup()
+		os.RemoveAll(dir)
+	}
+
+	decrypted := make(map[string]string)
+	for _, path := range encrypted {
+		sopsCmd, err := sopsCommand(envPath, envName, "--decrypt", path)
+		if err != nil {
+			cleanup()
+			return nil, noop, err
+		}
+		var stderr bytes.Buffer
+		sopsCmd.Stderr = &stderr
+		plaintext, err := sopsCmd.Output()
+		if err != nil {
+			cleanup()
+			return nil, noop, fmt.Errorf("failed to decrypt %s: %v: %s", path, err, strings.TrimSpace(stderr.String()))
+		}
+		// Keep the file name so terraform still recognises .tfvars.json by its suffix
+		target := filepath.Join(dir, filepath.Base(path))
+		if err := os.WriteFile(target, plaintext, 0600); err != nil {
+			cleanup()
+			return nil, noop, fmt.Errorf("failed to write decrypted %s: %w", path, err)
+		}
+		decrypted[path] = target
+		logger.Infof("decrypted %s for this run", path)
+	}
+	return decrypted, cleanup, nil
+}
+
+// sopsVarFileArgs returns -var-file arguments for the decrypted files, in file name order.
+func sopsVarFileArgs(decrypted map[string]string) []string {
+	encrypted := make([]string, 0, len(decrypted))
+	for path := range decrypted {
+		encrypted = append(encrypted, path)
+	}
+	sort.Strings(encrypted)
+
+	args := make([]string, 0, len(encrypted))
+	for _, path := range encrypted {
+		args = append(args, "-var-file="+decrypted[path])
+	}
+	return args
+}
+
+// secretsTmpfsDir returns a memory-backed directory for decrypted variables:
+// TFVENV_SECRETS_DIR, then XDG_RUNTIME_DIR, then /dev/shm. Plaintext is never
+// written to a disk-backed temporary directory.
+func secretsTmpfsDir() (string, error) {
+	for _, dir := range []string{os.Getenv("TFVENV_SECRETS_DIR"), os.Getenv("XDG_RUNTIME_DIR")} {
+		if dir != "" {
+			return dir, nil
+		}
+	}
+	if runtime.GOOS == "linux" {
+		if info, err := os.Stat("/dev/shm"); err == nil && info.IsDir() {
+			return "/dev/shm", nil
+		}
+	}
+	return "", fmt.Errorf("no memory-backed directory for decrypted secrets; set TFVENV_SECRETS_DIR to a tmpfs mount")
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"tfvenv/i18n"
+)
+
+// interruptExitCode is the conventional exit status after SIGINT.
+const interruptExitCode = 130
+
+// rootCtx is cancelled when tfvenv receives SIGINT or SIGTERM. Commands read it
+// through cmd.Context(); helpers without access to the command use it directly.
+var rootCtx = context.Background()
+
+// interrupts tracks the cleanup functions to run when tfvenv is interrupted.
+var interrupts struct {
+	sync.Mutex
+	nextID   int
+	cleanups []interruptCleanup
+	graceful bool
+}
+
+// interruptCleanup is a registered cleanup function.
+type interruptCleanup struct {
+	id int
+	fn func()
+}
+
+// newRootContext installs the signal handler and returns the root context. On
+// the first signal the context is cancelled and, unless the running command
+// shuts down by itself, the registered cleanups run newest first before tfvenv
+// exits. A second signal always exits immediately.
+func newRootContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	rootCtx = ctx
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		logger.Warnf("received %s", sig)
+		cancel()
+
+		interrupts.Lock()
+		graceful := interrupts.graceful
+		interrupts.Unlock()
+		if graceful {
+			<-signals
+			os.Exit(interruptExitCode)
+		}
+
+		fmt.Fprintln(os.Stderr, "\n"+i18n.T("interrupted"))
+		runInterruptCleanups()
+		os.Exit(interruptExitCode)
+	}()
+	return ctx
+}
+
+// handleInterruptsGracefully is called by long-running commands that stop on
+// their own once cmd.Context() is cancelled, such as servers.
+func handleInterruptsGracefully() {
+	interrupts.Lock()
+	defer interrupts.Unlock()
+	interrupts.graceful = true
+}
+
+// onInterrupt registers fn to run if tfvenv is interrupted and returns a
+// function that unregisters it once the guarded work has finished.
+func onInterrupt(fn func()) func() {
+	interrupts.Lock()
+	defer interrupts.Unlock()
+	id := interrupts.nextID
+	interrupts.nextID++
+	interrupts.cleanups = append(interrupts.cleanups, interruptCleanup{id: id, fn: fn})
+
+	return func() {
+		interrupts.Lock()
+		defer interrupts.Unlock()
+		for i, cleanup := range interrupts.cleanups {
+			if cleanup.id == id {
+				interrupts.cleanups = append(interrupts.cleanups[:i], interrupts.cleanups[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// runInterruptCleanups runs the registered cleanups, newest first. The lock is
+// kept so the interrupted work cannot unregister them halfway through.
+func runInterruptCleanups() {
+	interrupts.Lock()
+	for i := len(interrupts.cleanups) - 1; i >= 0; i-- {
+		interrupts.cleanups[i].fn()
+	}
+	interrupts.cleanups = nil
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"tfvenv/i18n"
+	"tfvenv/snaps"
+)
+
+// snapLifecycleRulePrefix starts the ID of the lifecycle rule 'snap init'
+// manages for an environment. Rules with other IDs are left alone, so several
+// environments can share a bucket.
+const snapLifecycleRulePrefix = "tfvenv-snaps-"
+
+// abortUploadDays is how long an interrupted multipart upload of a snap is
+// kept before S3 discards its parts.
+const abortUploadDays = 7
+
+// iamPolicy is an IAM policy document.
+type iamPolicy struct {
+	Version   string         `json:"Version"`
+	Statement []iamStatement `json:"Statement"`
+}
+
+// iamStatement is one statement of an IAM policy document.
+type iamStatement struct {
+	Sid       string                       `json:"Sid"`
+	Effect    string                       `json:"Effect"`
+	Action    []string                     `json:"Action"`
+	Resource  string                       `json:"Resource"`
+	Condition map[string]map[string]string `json:"Condition,omitempty"`
+}
+
+// snapInitCmd creates or verifies the bucket remote snaps are stored in.
+func snapInitCmd() *cobra.Command {
+	var verifyOnly, policyOnly bool
+	var expireDays, noncurrentDays int
+
+	cmd := &cobra.Command{
+		Use:   "init <env-name>",
+		Short: "Create or verify the S3 bucket for an environment's remote snaps and print its IAM policy",
+		Long: `Create the REMOTE_SNAP_BUCKET bucket if it does not exist, enable versioning
+and default encryption, block public access, and set a lifecycle rule on the
+environment's snaps from REMOTE_SNAP_EXPIRE_DAYS and REMOTE_SNAP_NONCURRENT_DAYS.
+The rule covers the keys under the environment's REMOTE_SNAP_KEY prefix, or the
+whole bucket without a template. A REMOTE_SNAP_REPLICA_BUCKET is set up the
+same way. Then print a least-privilege IAM policy that allows the snap
+commands, and nothing else, on those keys.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envDir := viper.GetString("env-dir")
+			envPath := filepath.Join(envDir, envName)
+			configPath := filepath.Join(envPath, "config", envName, tfvenvrcFileName)
+
+			if _, err := os.Stat(envPath); os.IsNotExist(err) {
+				i18n.Println("env.not_found", envName)
+				os.Exit(1)
+			}
+			bucket, err := snaps.GetS3Bucket()
+			if err != nil {
+				fmt.Println("Error: REMOTE_SNAP_BUCKET must be set.")
+				logger.Error("REMOTE_SNAP_BUCKET not set")
+				os.Exit(1)
+			}
+			prefix, err := remoteSnapPrefix(envPath, envName)
+			if err != nil {
+				logger.Errorf("error building snap key prefix: %v", err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			policy := snapIAMPolicy(bucket, prefix)
+
+			if policyOnly {
+				printIAMPolicy(policy)
+				return
+			}
+
+			if os.Getenv("REMOTE_SNAP_AUTH") == "" {
+				logger.Error("REMOTE_SNAP_AUTH must be set")
+				fmt.Println("Error: REMOTE_SNAP_AUTH must be set.")
+				os.Exit(1)
+			}
+			config, _ := readConfig(configPath)
+			if !cmd.Flags().Changed("expire-days") {
+				expireDays = config.SnapExpireDays
+			}
+			if !cmd.Flags().Changed("noncurrent-days") {
+				noncurrentDays = config.SnapNoncurrentDays
+			}
+			if expireDays < 0 || noncurrentDays < 0 {
+				fmt.Println("Error: retention days cannot be negative.")
+				os.Exit(1)
+			}
+
+			accessKey, secretKey, region, profile, err := remoteSnapAWS(envPath, envName)
+			if err != nil {
+				logger.Errorf("error resolving AWS settings: %v", err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			sess, err := newAWSSession(Config{AccessKey: accessKey, SecretKey: secretKey, AWSRegion: region, AWSProfile: profile})
+			if err != nil {
+				logger.Errorf("error initializing AWS session: %v", err)
+				fmt.Printf("Error initializing AWS session: %v\n", err)
+				os.Exit(1)
+			}
+			rule := snapLifecycleRule(envName, prefix, expireDays, noncurrentDays)
+			if err := initSnapBucket(s3.New(sess), "snap", bucket, region, rule, verifyOnly); err != nil {
+				logger.Errorf("snap bucket bootstrap failed: %v", err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			if rule == nil {
+				fmt.Println("No snap retention configured (REMOTE_SNAP_EXPIRE_DAYS, REMOTE_SNAP_NONCURRENT_DAYS), skipping the lifecycle rule.")
+			}
+
+			replica := remoteSnapReplica(envPath, envName, accessKey, secretKey, region, profile)
+			if replica != nil {
+				replicaSess, err := newAWSSession(Config{AccessKey: replica.AccessKey, SecretKey: replica.SecretKey, AWSRegion: replica.Region, AWSProfile: replica.Profile})
+				if err != nil {
+					logger.Errorf("error initializing AWS session for the replica: %v", err)
+					fmt.Printf("Error initializing AWS session for the replica: %v\n", err)
+					os.Exit(1)
+				}
+				if err := initSnapBucket(s3.New(replicaSess), "snap replica", replica.Bucket, replica.Region, rule, verifyOnly); err != nil {
+					logger.Errorf("snap replica bucket bootstrap failed: %v", err)
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+			}
+
+			fmt.Println()
+			fmt.Println("Least-privilege IAM policy for the snap commands of this environment:")
+			printIAMPolicy(policy)
+			if replica != nil {
+				fmt.Printf("\nLeast-privilege IAM policy for the replica bucket %s:\n", replica.Bucket)
+				printIAMPolicy(snapIAMPolicy(replica.Bucket, prefix))
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&verifyOnly, "verify-only", false, "Only report problems, do not create or modify resources")
+	cmd.Flags().BoolVar(&policyOnly, "policy-only", false, "Only print the IAM policy document, without contacting AWS")
+	cmd.Flags().IntVar(&expireDays, "expire-days", 0, "Days after which snaps expire (default REMOTE_SNAP_EXPIRE_DAYS)")
+	cmd.Flags().IntVar(&noncurrentDays, "noncurrent-days", 0, "Days overwritten or removed snap versions are kept (default REMOTE_SNAP_NONCURRENT_DAYS)")
+	addRemoteSnapProfileFlag(cmd)
+	return cmd
+}
+
+// initSnapBucket sets up a bucket remote snaps are stored in and, when rule is
+// not nil, its lifecycle rule for the environment's snaps.
+func initSnapBucket(client *s3.S3, kind, bucket, region string, rule *s3.LifecycleRule, verifyOnly bool) error {
+	if err := bootstrapBucket(client, kind, bucket, region, verifyOnly); err != nil {
+		return err
+	}
+	if rule == nil {
+		return nil
+	}
+	return applySnapLifecycleRule(client, bucket, rule, verifyOnly)
+}
+
+// snapIAMPolicy returns a policy that allows listing, reading, writing and
+// removing the snaps under prefix in bucket.
+func snapIAMPolicy(bucket, prefix string) iamPolicy {
+	list := iamStatement{
+		Sid:      "ListSnaps",
+		Effect:   "Allow",
+		Action:   []string{"s3:ListBucket"},
+		Resource: "arn:aws:s3:::" + bucket,
+	}
+	if prefix != "" {
+		list.Condition = map[string]map[string]string{"StringLike": {"s3:prefix": prefix + "*"}}
+	}
+	return iamPolicy{
+		Version: "2012-10-17",
+		Statement: []iamStatement{
+			list,
+			{
+				Sid:      "ReadWriteSnaps",
+				Effect:   "Allow",
+				Action:   []string{"s3:GetObject", "s3:PutObject", "s3:DeleteObject"},
+				Resource: "arn:aws:s3:::" + bucket + "/" + prefix + "*",
+			},
+		},
+	}
+}
+
+// printIAMPolicy prints a policy document as indented JSON.
+func printIAMPolicy(policy iamPolicy) {
+	data, _ := json.MarshalIndent(policy, "", "  ")
+	fmt.Println(string(data))
+}
+
+// snapLifecycleRule returns the lifecycle rule for an environment's snaps, or
+// nil when no retention is configured.
+func snapLifecycleRule(envName, prefix string, expireDays, noncurrentDays int) *s3.LifecycleRule {
+	if expireDays == 0 && noncurrentDays == 0 {
+		return nil
+	}
+	rule := &s3.LifecycleRule{
+		ID:     aws.String(snapLifecycleRulePrefix + envName),
+		Status: aws.String(s3.ExpirationStatusEnabled),
+		Filter: &s3.LifecycleRuleFilter{Prefix: aws.String(prefix)},
+		AbortIncompleteMultipartUpload: &s3.AbortIncompleteMultipartUpload{
+			DaysAfterInitiation: aws.Int64(abortUploadDays),
+		},
+	}
+	if expireDays > 0 {
+		rule.Expiration = &s3.LifecycleExpiration{Days: aws.Int64(int64(expireDays))}
+	}
+	if noncurrentDays > 0 {
+		rule.NoncurrentVersionExpiration = &s3.NoncurrentVersionExpiration{NoncurrentDays: aws.Int64(int64(noncurrentDays))}
+	}
+	return rule
+}
+
+// applySnapLifecycleRule adds rule to the bucket's lifecycle configuration, or
+// replaces the rule with the same ID, keeping every other rule.
+func applySnapLifecycleRule(client *s3.S3, bucket string, rule *s3.LifecycleRule, verifyOnly bool) error {
+	var rules []*s3.LifecycleRule
+	out, err := client.GetBucketLifecycleConfiguration(&s3.GetBucketLifecycleConfigurationInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		aerr, ok := err.(awserr.Error)
+		if !ok || aerr.Code() != "NoSuchLifecycleConfiguration" {
+			return fmt.Errorf("failed to read lifecycle rules of %s: %w", bucket, err)
+		}
+	} else {
+		rules = out.Rules
+	}
+
+	id := aws.StringValue(rule.ID)
+	kept := make([]*s3.LifecycleRule, 0, len(rules)+1)
+	for _, existing := range rules {
+		if aws.StringValue(existing.ID) != id {
+			kept = append(kept, existing)
+			continue
+		}
+		if sameLifecycleRule(existing, rule) {
+			fmt.Printf("Lifecycle rule %s is up to date\n", id)
+			return nil
+		}
+	}
+	if verifyOnly {
+		return fmt.Errorf("lifecycle rule %s on %s is missing or differs from the configured retention", id, bucket)
+	}
+
+	_, err = client.PutBucketLifecycleConfiguration(&s3.PutBucketLifecycleConfigurationInput{
+		Bucket:                 aws.String(bucket),
+		LifecycleConfiguration: &s3.BucketLifecycleConfiguration{Rules: append(kept, rule)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set lifecycle rule %s on %s: %w", id, bucket, err)
+	}
+	fmt.Printf("Set lifecycle rule %s on %s\n", id, bucket)
+	logger.Infof("set lifecycle rule %s on %s", id, bucket)
+	return nil
+}
+
+// sameLifecycleRule reports whether an existing rule applies the retention of
+// the wanted one to the same keys.
+func sameLifecycleRule(existing, wanted *s3.LifecycleRule) bool {
+	days := func(e *s3.LifecycleExpiration) int64 {
+		if e == nil {
+			return 0
+		}
+		return aws.Int64Value(e.Days)
+	}
+	noncurrent := func(e *s3.NoncurrentVersionExpiration) int64 {
+		if e == nil {
+			return 0
+		}
+		return aws.Int64Value(e.NoncurrentDays)
+	}
+	prefix := func(r *s3.LifecycleRule) string {
+		if r.Filter != nil {
+			return aws.StringValue(r.Filter.Prefix)
+		}
+		return aws.StringValue(r.Prefix)
+	}
+	return aws.StringValue(existing.Status) == aws.StringValue(wanted.Status) &&
+		prefix(existing) == prefix(wanted) &&
+		days(existing.Expiration) == days(wanted.Expiration) &&
+		noncurrent(existing.NoncurrentVersionExpiration) == noncurrent(wanted.NoncurrentVersionExpiration)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"tfvenv/snaps"
+)
+
+// snapKeyCut stands in for the placeholders that vary between snaps of the
+// same environment when the shared key prefix is rendered.
+const snapKeyCut = "\x00"
+
+// snapKeyVars are the values a REMOTE_SNAP_KEY template can refer to.
+type snapKeyVars struct {
+	Env     string
+	EnvPath string
+	Tool    string
+	Name    string
+	Taken   time.Time
+}
+
+// remoteSnapKey renders the environment's REMOTE_SNAP_KEY template for a snap
+// taken at the given time. Without a template the key is the snap name.
+func remoteSnapKey(envPath, envName, snapName string, taken time.Time) (string, error) {
+	config, _ := readConfig(filepath.Join(envPath, "config", envName, tfvenvrcFileName))
+	if config.RemoteSnapKey == "" {
+		return snapName, nil
+	}
+	vars := snapKeyVars{Env: envName, EnvPath: envPath, Tool: resolveTool(config.Tool, ""), Name: snapName, Taken: taken}
+	key, err := executeTemplate(config.RemoteSnapKey, nil, snapKeyFuncs(vars, false))
+	if err != nil {
+		return "", fmt.Errorf("REMOTE_SNAP_KEY: %w", err)
+	}
+	return snaps.SanitizeSnapKey(key)
+}
+
+// remoteSnapPrefix returns the part of the REMOTE_SNAP_KEY template that every
+// snap of the environment shares, up to the first placeholder that varies
+// between snaps. Listing under it finds the environment's snaps by convention.
+func remoteSnapPrefix(envPath, envName string) (string, error) {
+	config, _ := readConfig(filepath.Join(envPath, "config", envName, tfvenvrcFileName))
+	if config.RemoteSnapKey == "" {
+		return "", nil
+	}
+	return snapKeyPrefix(config.RemoteSnapKey, snapKeyVars{Env: envName, EnvPath: envPath, Tool: resolveTool(config.Tool, "")})
+}
+
+// snapKeyPrefix renders a REMOTE_SNAP_KEY template up to the first
+// placeholder that varies between snaps.
+func snapKeyPrefix(text string, vars snapKeyVars) (string, error) {
+	key, err := executeTemplate(text, nil, snapKeyFuncs(vars, true))
+	if err != nil {
+		return "", fmt.Errorf("REMOTE_SNAP_KEY: %w", err)
+	}
+	if i := strings.Index(key, snapKeyCut); i >= 0 {
+		key = key[:i]
+	}
+	return key, nil
+}
+
+// remoteSnapTarget validates a snap given to 'snap get' or 'snap remove' and
+// returns its object key and the local snap name it is saved under. Names
+// containing "/" are keys produced by a REMOTE_SNAP_KEY template.
+func remoteSnapTarget(arg string) (string, string, error) {
+	if !strings.Contains(arg, "/") {
+		name, err := snaps.SanitizeSnapName(arg)
+		return name, name, err
+	}
+	key, err := snaps.SanitizeSnapKey(arg)
+	if err != nil {
+		return "", "", err
+	}
+	return key, strings.TrimSuffix(path.Base(key), ".snap"), nil
+}
+
+// validateSnapKeyTemplate renders a REMOTE_SNAP_KEY template with sample
+// values and checks the result is a usable object key.
+func validateSnapKeyTemplate(text string) error {
+	vars := snapKeyVars{Env: "env", Tool: toolTerraform, Name: "snap", Taken: time.Now()}
+	funcs := snapKeyFuncs(vars, false)
+	funcs["git_sha"] = func() string { return "0000000" }
+	key, err := executeTemplate(text, nil, funcs)
+	if err != nil {
+		return err
+	}
+	_, err = snaps.SanitizeSnapKey(key)
+	return err
+}
+
+// snapKeyFuncs returns the placeholders of a REMOTE_SNAP_KEY template. With
+// cut set, the placeholders that vary between snaps render as snapKeyCut.
+func snapKeyFuncs(vars snapKeyVars, cut bool) template.FuncMap {
+	funcs := template.FuncMap{
+		"env":       func() string { return vars.Env },
+		"tool":      func() string { return vars.Tool },
+		"workspace": func() string { return snapWorkspace(vars.EnvPath) },
+		"name":      func() string { return vars.Name },
+		"date":      func() string { return vars.Taken.UTC().Format("2006-01-02") },
+		"time":      func() string { return vars.Taken.UTC().Format("150405") },
+		"git_sha":   func() (string, error) { return snapGitSHA(filepath.Join(vars.EnvPath, "config", vars.Env)) },
+	}
+	if cut {
+		for _, name := range []string{"name", "date", "time", "git_sha"} {
+			funcs[name] = func() string { return snapKeyCut }
+		}
+	}
+	return funcs
+}
+
+// snapWorkspace returns the workspace snaps are filed under: TF_WORKSPACE from
+// the shell, then the one recorded by 'tfvenv workspace select'.
+func snapWorkspace(envPath string) string {
+	if workspace := os.Getenv("TF_WORKSPACE"); workspace != "" {
+		return workspace
+	}
+	if meta, err := loadEnvMetadata(envPath); err == nil && meta.Workspace != "" {
+		return meta.Workspace
+	}
+	return "default"
+}
+
+// snapGitSHA returns the abbreviated commit being deployed. CI systems check
+// out detached commits, so their variables are preferred over asking git.
+func snapGitSHA(dir string) (string, error) {
+	for _, name := range []string{"GITHUB_SHA", "CI_COMMIT_SHA", "BUILD_SOURCEVERSION", "GIT_COMMIT"} {
+		if sha := os.Getenv(name); sha != "" {
+			if len(sha) > 7 {
+				sha = sha[:7]
+			}
+			return sha, nil
+		}
+	}
+	sha, err := gitOutput("-C", dir, "rev-parse", "--short", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("git_sha: %s is not in a git repository", dir)
+	}
+	return sha, nil
+}
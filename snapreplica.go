@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"tfvenv/snaps"
+)
+
+// syncSnapReplica copies the snaps of the primary bucket, given by their keys
+// under prefix, that the replica lacks. Snaps are copied as stored, still
+// encrypted, so the replica can be restored from with the same SNAP_KEY.
+func syncSnapReplica(envPath, prefix string, primaryKeys []string, replica snaps.Replica, accessKey, secretKey, region, profile string, parallel int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	replicaKeys, err := snaps.ListReplicaSnaps(ctx, replica, prefix)
+	cancel()
+	if err != nil {
+		return err
+	}
+	mirrored := make(map[string]bool, len(replicaKeys))
+	for _, key := range replicaKeys {
+		mirrored[key] = true
+	}
+
+	var jobs []job
+	for _, key := range primaryKeys {
+		if mirrored[key] {
+			continue
+		}
+		key := key
+		jobs = append(jobs, job{
+			Name: key,
+			Run: func() error {
+				ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+				defer cancel()
+				data, err := snaps.GetRemoteSnap(ctx, key, accessKey, secretKey, region, profile)
+				if err != nil {
+					return err
+				}
+				if err := snaps.SaveReplicaSnap(ctx, replica, key, data); err != nil {
+					return err
+				}
+				emitEvent(envPath, eventSnapSaved, map[string]string{"snap": key, "location": "s3-replica", "key": key})
+				return nil
+			},
+		})
+	}
+	if len(jobs) == 0 {
+		fmt.Printf("Replica bucket %s already has every remote snap.\n", replica.Bucket)
+		return nil
+	}
+
+	if err := jobsError(runJobs(jobs, parallel)); err != nil {
+		return fmt.Errorf("failed to mirror snaps to replica bucket %s: %w", replica.Bucket, err)
+	}
+	fmt.Printf("Mirrored %d snap(s) to replica bucket %s.\n", len(jobs), replica.Bucket)
+	logger.Infof("mirrored %d snaps of %s to replica bucket %s", len(jobs), envPath, replica.Bucket)
+	return nil
+}
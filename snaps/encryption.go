@@ -13,6 +13,10 @@ import (
     "os"
 )
 
+// ErrInvalidMAC is returned by Decrypt when the HMAC of the data does not
+// match: the data was modified, or encrypted with another SNAP_KEY.
+var ErrInvalidMAC = errors.New("invalid MAC")
+
 // getSnapKey retrieves the SNAP_KEY from environment variables and ensures it is the correct length.
 func getSnapKey() ([]byte, error) {
     snapKey := os.Getenv("SNAP_KEY")
@@ -85,7 +89,7 @@ func Decrypt(encrypted []byte) ([]byte, error) {
 	h.Write(ciphertext)
 	expectedMac := h.Sum(nil)
 	if !hmac.Equal(mac, expectedMac) {
-		return nil, errors.New("invalid MAC")
+		return nil, ErrInvalidMAC
 	}
 
 	// Decrypt using AES-CTR
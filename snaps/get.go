@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+
+	"tfvenv/schemas"
 )
 
 // GetSnap retrieves a Snap by its filePath.
@@ -35,12 +37,24 @@ func GetSnap(filePath string) (*Snap, error) {
 		return nil, fmt.Errorf("failed to decrypt snap data: %v", err)
 	}
 
-	// Decode the JSON into Snap struct
-	var snap Snap
-	err = json.Unmarshal(decryptedData, &snap)
+	snap, err := ParseSnap(decryptedData)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode snap data: %v", err)
 	}
 
+	return snap, nil
+}
+
+// ParseSnap decodes the decrypted content of a snap, after checking it
+// against the published snap schema so that a malformed snap is rejected
+// before anything is restored from it.
+func ParseSnap(data []byte) (*Snap, error) {
+	if err := schemas.ValidateJSON(schemas.Snap, data); err != nil {
+		return nil, err
+	}
+	var snap Snap
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, err
+	}
 	return &snap, nil
 }
@@ -0,0 +1,66 @@
+package snaps
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SnapFile describes a local snap file.
+type SnapFile struct {
+	Name    string
+	Path    string
+	Size    int64
+	ModTime time.Time
+}
+
+// ListSnapFiles returns the local snaps of an environment, newest first.
+func ListSnapFiles(envPath string) ([]SnapFile, error) {
+	dir := filepath.Join(envPath, "snaps")
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snap directory: %v", err)
+	}
+
+	var files []SnapFile
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".snap") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat snap %s: %v", entry.Name(), err)
+		}
+		files = append(files, SnapFile{
+			Name:    strings.TrimSuffix(entry.Name(), ".snap"),
+			Path:    filepath.Join(dir, entry.Name()),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].ModTime.After(files[j].ModTime) })
+	return files, nil
+}
+
+// PruneCandidates returns the snaps a retention policy removes: everything past
+// the newest keep snaps that is also older than olderThan. A zero keep or
+// olderThan disables that part of the policy. files must be sorted newest first.
+func PruneCandidates(files []SnapFile, keep int, olderThan time.Duration, now time.Time) []SnapFile {
+	var prune []SnapFile
+	for i, file := range files {
+		if keep > 0 && i < keep {
+			continue
+		}
+		if olderThan > 0 && now.Sub(file.ModTime) < olderThan {
+			continue
+		}
+		prune = append(prune, file)
+	}
+	return prune
+}
@@ -8,11 +8,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
+
+	"tfvenv/netretry"
 )
 
 // RemoteSnapConfig stores the configuration for remote snap handling.
@@ -22,15 +25,58 @@ type RemoteSnapConfig struct {
 	Type     string
 }
 
+// Replica is a second bucket remote snaps are mirrored to, so that backups
+// survive the loss of the primary bucket's region or account.
+type Replica struct {
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	Profile   string
+}
+
+// SharedConfigRegion returns the region the shared AWS configuration and
+// AWS_REGION or AWS_DEFAULT_REGION give a profile, or an empty string.
+func SharedConfigRegion(p string) string {
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Profile:           p,
+		SharedConfigState: session.SharedConfigEnable,
+	})
+	if err != nil {
+		return ""
+	}
+	return aws.StringValue(sess.Config.Region)
+}
+
 // initS3Client initializes an S3 client using the provided credentials and region.
-func initS3Client(accessKey, secretKey, region string) (*s3.S3, error) {
-	sess, err := session.NewSession(&aws.Config{
-		Region:      aws.String(region),
-		Credentials: credentials.NewStaticCredentials(accessKey, secretKey, ""),
+// Without static keys the SDK's default credential chain applies: environment
+// variables, the shared config and credentials files (including SSO and
+// assume-role profiles), web identity tokens such as IRSA's, and ECS or EC2
+// instance roles. profile selects a profile from the shared AWS configuration
+// in it; empty leaves the choice to the chain, which honours AWS_PROFILE.
+func initS3Client(accessKey, secretKey, region, profile string) (*s3.S3, error) {
+	if accessKey != "" && secretKey != "" {
+		return newS3Client(accessKey, secretKey, region, "")
+	}
+	return newS3Client(accessKey, secretKey, region, profile)
+}
+
+// newS3Client initializes an S3 client like initS3Client, selecting profile
+// from the shared AWS configuration when it is set.
+func newS3Client(accessKey, secretKey, region, profile string) (*s3.S3, error) {
+	cfg := aws.Config{Region: aws.String(region)}
+	if accessKey != "" && secretKey != "" {
+		cfg.Credentials = credentials.NewStaticCredentials(accessKey, secretKey, "")
+	}
+	sess, err := session.NewSessionWithOptions(session.Options{
+		Config:            cfg,
+		Profile:           profile,
+		SharedConfigState: session.SharedConfigEnable,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("error initializing AWS session: %v", err)
 	}
+	netretry.ApplyAWS(sess)
 	return s3.New(sess), nil
 }
 
@@ -53,9 +99,23 @@ func SanitizeSnapName(snapName string) (string, error) {
 	return cleanName, nil
 }
 
+// SanitizeSnapKey validates an object key produced by a REMOTE_SNAP_KEY template.
+// Keys may contain "/" separators but no empty, "." or ".." segments.
+func SanitizeSnapKey(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return "", fmt.Errorf("invalid snap key %q", key)
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return "", fmt.Errorf("invalid snap key %q: contains empty or relative path segments", key)
+		}
+	}
+	return key, nil
+}
+
 // GetRemoteSnap fetches a snap from the remote S3 storage using context for cancellation and timeouts.
-func GetRemoteSnap(ctx context.Context, snapName, accessKey, secretKey, region string) ([]byte, error) {
-	s3Client, err := initS3Client(accessKey, secretKey, region)
+func GetRemoteSnap(ctx context.Context, snapName, accessKey, secretKey, region, profile string) ([]byte, error) {
+	s3Client, err := initS3Client(accessKey, secretKey, region, profile)
 	if err != nil {
 		return nil, fmt.Errorf("error initializing S3 client: %v", err)
 	}
@@ -85,8 +145,8 @@ func GetRemoteSnap(ctx context.Context, snapName, accessKey, secretKey, region s
 }
 
 // SaveRemoteSnap uploads a snap to the remote S3 storage using context for cancellation and timeouts.
-func SaveRemoteSnap(ctx context.Context, snapName string, snapData []byte, accessKey, secretKey, region string) error {
-	s3Client, err := initS3Client(accessKey, secretKey, region)
+func SaveRemoteSnap(ctx context.Context, snapName string, snapData []byte, accessKey, secretKey, region, profile string) error {
+	s3Client, err := initS3Client(accessKey, secretKey, region, profile)
 	if err != nil {
 		return fmt.Errorf("error initializing S3 client: %v", err)
 	}
@@ -96,10 +156,27 @@ func SaveRemoteSnap(ctx context.Context, snapName string, snapData []byte, acces
 		return fmt.Errorf("error retrieving S3 bucket name: %v", err)
 	}
 
+	return putSnap(ctx, s3Client, bucketName, snapName, snapData)
+}
+
+// SaveReplicaSnap uploads a snap, as stored in the primary bucket, to the replica.
+func SaveReplicaSnap(ctx context.Context, replica Replica, key string, snapData []byte) error {
+	s3Client, err := newS3Client(replica.AccessKey, replica.SecretKey, replica.Region, replica.Profile)
+	if err != nil {
+		return fmt.Errorf("error initializing S3 client for replica: %v", err)
+	}
+	if err := putSnap(ctx, s3Client, replica.Bucket, key, snapData); err != nil {
+		return fmt.Errorf("replica %s: %v", replica.Bucket, err)
+	}
+	return nil
+}
+
+// putSnap uploads snap data under key.
+func putSnap(ctx context.Context, s3Client *s3.S3, bucketName, key string, snapData []byte) error {
 	// Use PutObjectWithContext to pass the context
-	_, err = s3Client.PutObjectWithContext(ctx, &s3.PutObjectInput{
+	_, err := s3Client.PutObjectWithContext(ctx, &s3.PutObjectInput{
 		Bucket: aws.String(bucketName),
-		Key:    aws.String(snapName),
+		Key:    aws.String(key),
 		Body:   bytes.NewReader(snapData),
 	})
 	if err != nil {
@@ -108,11 +185,10 @@ func SaveRemoteSnap(ctx context.Context, snapName string, snapData []byte, acces
 	return nil
 }
 
-// ListRemoteSnaps lists all snaps stored in the remote S3 bucket.
-// It returns a slice of snap names or an error if the operation fails.
-// ListRemoteSnaps lists all snaps stored in the remote S3 bucket.
-func ListRemoteSnaps(ctx context.Context, accessKey, secretKey, region string) ([]string, error) {
-	s3Client, err := initS3Client(accessKey, secretKey, region)
+// ListRemoteSnaps lists the snaps stored in the remote S3 bucket under prefix.
+// It returns a slice of snap keys or an error if the operation fails.
+func ListRemoteSnaps(ctx context.Context, prefix, accessKey, secretKey, region, profile string) ([]string, error) {
+	s3Client, err := initS3Client(accessKey, secretKey, region, profile)
 	if err != nil {
 		return nil, fmt.Errorf("error initializing S3 client: %v", err)
 	}
@@ -122,23 +198,81 @@ func ListRemoteSnaps(ctx context.Context, accessKey, secretKey, region string) (
 		return nil, fmt.Errorf("error retrieving S3 bucket name: %v", err)
 	}
 
-	result, err := s3Client.ListObjectsV2WithContext(ctx, &s3.ListObjectsV2Input{
+	return listSnaps(ctx, s3Client, bucketName, prefix)
+}
+
+// ListReplicaSnaps lists the snaps stored in the replica under prefix.
+func ListReplicaSnaps(ctx context.Context, replica Replica, prefix string) ([]string, error) {
+	s3Client, err := newS3Client(replica.AccessKey, replica.SecretKey, replica.Region, replica.Profile)
+	if err != nil {
+		return nil, fmt.Errorf("error initializing S3 client for replica: %v", err)
+	}
+	snapsList, err := listSnaps(ctx, s3Client, replica.Bucket, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("replica %s: %v", replica.Bucket, err)
+	}
+	return snapsList, nil
+}
+
+// listSnaps returns the keys stored in bucketName under prefix.
+func listSnaps(ctx context.Context, s3Client *s3.S3, bucketName, prefix string) ([]string, error) {
+	var snapsList []string
+	err := s3Client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
 		Bucket: aws.String(bucketName),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, item := range page.Contents {
+			snapsList = append(snapsList, *item.Key)
+		}
+		return true
 	})
 	if err != nil {
 		return nil, fmt.Errorf("error listing snaps in S3 bucket: %v", err)
 	}
+	return snapsList, nil
+}
 
-	var snapsList []string
-	for _, item := range result.Contents {
-		snapsList = append(snapsList, *item.Key)
+// LatestRemoteSnap returns the key of the most recently stored snap under
+// prefix, or "" when there is none.
+func LatestRemoteSnap(ctx context.Context, prefix, accessKey, secretKey, region, profile string) (string, error) {
+	s3Client, err := initS3Client(accessKey, secretKey, region, profile)
+	if err != nil {
+		return "", fmt.Errorf("error initializing S3 client: %v", err)
 	}
-	return snapsList, nil
+
+	bucketName, err := GetS3Bucket()
+	if err != nil {
+		return "", fmt.Errorf("error retrieving S3 bucket name: %v", err)
+	}
+
+	var latest *s3.Object
+	err = s3Client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucketName),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, item := range page.Contents {
+			if item.LastModified == nil {
+				continue
+			}
+			if latest == nil || item.LastModified.After(*latest.LastModified) {
+				latest = item
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return "", fmt.Errorf("error listing snaps in S3 bucket: %v", err)
+	}
+	if latest == nil {
+		return "", nil
+	}
+	return *latest.Key, nil
 }
+
 // RemoveRemoteSnap deletes a snap from the remote S3 storage using context for cancellation and timeouts.
 // It removes the snap identified by snapName using the provided AWS credentials and region.
-func RemoveRemoteSnap(ctx context.Context, snapName, accessKey, secretKey, region string) error {
-	s3Client, err := initS3Client(accessKey, secretKey, region)
+func RemoveRemoteSnap(ctx context.Context, snapName, accessKey, secretKey, region, profile string) error {
+	s3Client, err := initS3Client(accessKey, secretKey, region, profile)
 	if err != nil {
 		return fmt.Errorf("error initializing S3 client: %v", err)
 	}
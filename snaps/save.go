@@ -9,8 +9,10 @@ import (
 // SaveSnap saves the provided Snap to a file with the given filePath.
 // It marshals the Snap into JSON, encrypts the data, and writes it to the snap file.
 func SaveSnap(filePath string, snap *Snap) error {
-	// Convert snap data to JSON
-	snapData, err := json.Marshal(snap)
+	// Convert snap data to JSON, stamped with the format it is written in
+	stamped := *snap
+	stamped.SchemaVersion = SchemaVersion
+	snapData, err := json.Marshal(&stamped)
 	if err != nil {
 		return fmt.Errorf("failed to marshal snap: %v", err)
 	}
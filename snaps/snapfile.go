@@ -4,12 +4,50 @@ import (
 	"path/filepath"
 )
 
+// SchemaVersion is the version of the snap format SaveSnap writes. Snaps
+// written before it was recorded have no version.
+const SchemaVersion = 1
+
 // Snap represents the environment information to be saved in a .snap file.
 type Snap struct {
+	SchemaVersion     int               `json:"schema_version,omitempty"`
 	TerraformVersion  string            `json:"terraform_version"`
 	TerragruntVersion string            `json:"terragrunt_version"`
 	Plugins           map[string]string `json:"plugins"`  // provider: version
 	EnvVars           map[string]string `json:"env_vars"` // optional environment variables
+	Workspace         string            `json:"workspace,omitempty"`
+	Tool              string            `json:"tool,omitempty"`    // terraform or tofu
+	Git               *GitRevision      `json:"git,omitempty"`     // revision of the config directory
+	Scripts           []ScriptFile      `json:"scripts,omitempty"` // contents of scripts/, in full snaps
+}
+
+// ScriptFile is a file of an environment's scripts directory captured in a full snap.
+type ScriptFile struct {
+	Name    string `json:"name"` // slash-separated path relative to scripts/
+	Mode    uint32 `json:"mode"`
+	Content []byte `json:"content"`
+}
+
+// GitRevision identifies the IaC revision a snap was taken from.
+type GitRevision struct {
+	Branch string `json:"branch,omitempty"`
+	Commit string `json:"commit"`
+	Dirty  bool   `json:"dirty"`
+}
+
+// String formats the revision as "branch@commit", marking uncommitted changes.
+func (g *GitRevision) String() string {
+	if g == nil {
+		return "none"
+	}
+	s := g.Commit
+	if g.Branch != "" {
+		s = g.Branch + "@" + s
+	}
+	if g.Dirty {
+		s += " (dirty)"
+	}
+	return s
 }
 // GetSnapFilePath constructs the file path for a snap within a specific environment
 func GetSnapFilePath(envPath, filename string) string {
@@ -0,0 +1,73 @@
+package snaps
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const stateBackupExt = ".tfstate.snap"
+
+// GetStateBackupFilePath constructs the file path for a Terraform state backup within a specific environment.
+func GetStateBackupFilePath(envPath, name string) string {
+	return filepath.Join(envPath, "snaps", "state", name+stateBackupExt)
+}
+
+// SaveStateBackup encrypts the raw Terraform state and writes it to filePath.
+func SaveStateBackup(filePath string, state []byte) error {
+	encryptedData, err := Encrypt(state)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt state backup: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return fmt.Errorf("failed to create state backup directory: %v", err)
+	}
+
+	if err := os.WriteFile(filePath, []byte(encryptedData), 0600); err != nil {
+		return fmt.Errorf("failed to write state backup: %v", err)
+	}
+	return nil
+}
+
+// GetStateBackup reads and decrypts the Terraform state backup at filePath.
+func GetStateBackup(filePath string) ([]byte, error) {
+	encryptedData, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state backup: %v", err)
+	}
+
+	decodedData, err := base64.StdEncoding.DecodeString(string(encryptedData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode state backup: %v", err)
+	}
+
+	state, err := Decrypt(decodedData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt state backup: %v", err)
+	}
+	return state, nil
+}
+
+// ListStateBackups returns the names of the state backups stored in an environment, oldest first.
+func ListStateBackups(envPath string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(envPath, "snaps", "state"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state backup directory: %v", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), stateBackupExt) {
+			names = append(names, strings.TrimSuffix(entry.Name(), stateBackupExt))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
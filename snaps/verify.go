@@ -0,0 +1,120 @@
+package snaps
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"tfvenv/schemas"
+)
+
+// VerifyStep is the outcome of one stage of verifying a snap.
+type VerifyStep struct {
+	Name   string `json:"name"`
+	OK     bool   `json:"ok"`
+	Detail string `json:"detail"`
+}
+
+// Verify checks that data, the content of a snap file, is a snap that can be
+// restored: it decodes, its HMAC matches SNAP_KEY, it decrypts to a snap of a
+// schema version this build reads that matches the snap schema, and it names the versions and files a
+// restore needs. Nothing is written. The steps are returned in order up to
+// the first that fails, and the snap when every step passed.
+func Verify(data []byte) ([]VerifyStep, *Snap) {
+	var steps []VerifyStep
+	pass := func(name, detail string) {
+		steps = append(steps, VerifyStep{Name: name, OK: true, Detail: detail})
+	}
+	fail := func(name, detail string) ([]VerifyStep, *Snap) {
+		return append(steps, VerifyStep{Name: name, Detail: detail}), nil
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil {
+		return fail("encoding", fmt.Sprintf("not base64: %v", err))
+	}
+	pass("encoding", fmt.Sprintf("%d bytes", len(decoded)))
+
+	if _, err := getSnapKey(); err != nil {
+		return fail("key", err.Error())
+	}
+	plaintext, err := Decrypt(decoded)
+	if errors.Is(err, ErrInvalidMAC) {
+		return fail("hmac", "does not match: the snap was modified or encrypted with another SNAP_KEY")
+	}
+	if err != nil {
+		return fail("hmac", err.Error())
+	}
+	pass("hmac", "matches SNAP_KEY")
+
+	var snap Snap
+	if err := json.Unmarshal(plaintext, &snap); err != nil {
+		return fail("payload", fmt.Sprintf("decrypted data is not a snap: %v", err))
+	}
+	pass("payload", fmt.Sprintf("%d bytes decrypted", len(plaintext)))
+
+	if snap.SchemaVersion > SchemaVersion {
+		return fail("schema", fmt.Sprintf("version %d is newer than this tfvenv reads (%d); upgrade tfvenv", snap.SchemaVersion, SchemaVersion))
+	}
+	if err := schemas.ValidateJSON(schemas.Snap, plaintext); err != nil {
+		return fail("schema", err.Error())
+	}
+	if snap.SchemaVersion == 0 {
+		pass("schema", "unversioned (written before schema versions were recorded)")
+	} else {
+		pass("schema", fmt.Sprintf("version %d", snap.SchemaVersion))
+	}
+
+	if problems := checkContents(&snap); len(problems) > 0 {
+		return fail("contents", strings.Join(problems, "; "))
+	}
+	pass("contents", fmt.Sprintf("%s %s, Terragrunt %s, %d provider(s), %d script(s)", toolName(snap.Tool), snap.TerraformVersion, snap.TerragruntVersion, len(snap.Plugins), len(snap.Scripts)))
+	return steps, &snap
+}
+
+// UnwrapRemote removes the layer of encryption a snap gets when it is
+// uploaded, returning the content of the snap file.
+func UnwrapRemote(data []byte) ([]byte, error) {
+	if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data))); err == nil {
+		data = decoded
+	}
+	inner, err := Decrypt(data)
+	if errors.Is(err, ErrInvalidMAC) {
+		return nil, fmt.Errorf("the uploaded snap was modified or encrypted with another SNAP_KEY: %w", err)
+	}
+	return inner, err
+}
+
+// checkContents lists what would keep a snap from being restored.
+func checkContents(snap *Snap) []string {
+	var problems []string
+	if snap.TerraformVersion == "" {
+		problems = append(problems, "no Terraform version")
+	}
+	if snap.Tool != "" && snap.Tool != "terraform" && snap.Tool != "tofu" {
+		problems = append(problems, fmt.Sprintf("unknown tool %q", snap.Tool))
+	}
+	for source, version := range snap.Plugins {
+		if version == "" {
+			problems = append(problems, fmt.Sprintf("no version for provider %s", source))
+		}
+	}
+	for _, script := range snap.Scripts {
+		clean := path.Clean(script.Name)
+		if script.Name == "" || path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+			problems = append(problems, fmt.Sprintf("script %q would be restored outside scripts/", script.Name))
+		}
+	}
+	return problems
+}
+
+// toolName returns how a snap's tool is shown.
+func toolName(tool string) string {
+	if tool == "tofu" {
+		return "OpenTofu"
+	}
+	return "Terraform"
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"tfvenv/i18n"
+	"tfvenv/snaps"
+)
+
+// snapVerifyReport is the JSON form of a snap verification.
+type snapVerifyReport struct {
+	Environment string             `json:"environment"`
+	Snap        string             `json:"snap"`
+	Location    string             `json:"location"`
+	Valid       bool               `json:"valid"`
+	Steps       []snaps.VerifyStep `json:"steps"`
+}
+
+// snapVerifyCmd checks that a snap can be restored without restoring it.
+func snapVerifyCmd() *cobra.Command {
+	var remote, jsonOutput bool
+
+	cmd := &cobra.Command{
+		Use:   "verify <env-name> <snap-name>",
+		Short: "Check that a snap decodes, decrypts and is complete, without writing anything",
+		Long: `Check a snap's encoding, its HMAC against SNAP_KEY, its schema version and
+that it names the versions and files a restore needs. The snap is decrypted
+in memory only; nothing is written. With --remote, the snap is downloaded from
+the environment's S3 storage, as 'snap remote get' would, instead of read
+from the environment's snaps directory. Exits non-zero when a check fails,
+so CI can prove backups are restorable before they are needed.`,
+		Args: cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName, snapName := args[0], args[1]
+			envPath := filepath.Join(viper.GetString("env-dir"), envName)
+
+			if _, err := os.Stat(envPath); os.IsNotExist(err) {
+				i18n.Println("env.not_found", envName)
+				os.Exit(1)
+			}
+
+			report := snapVerifyReport{Environment: envName, Snap: snapName}
+			var data []byte
+			var err error
+			if remote {
+				report.Location = "s3"
+				data, err = fetchRemoteSnapFile(envPath, envName, snapName)
+			} else {
+				report.Location = snaps.GetSnapFilePath(envPath, snapName)
+				data, err = os.ReadFile(report.Location)
+			}
+			if err != nil {
+				report.Steps = []snaps.VerifyStep{{Name: "read", Detail: err.Error()}}
+			} else {
+				readStep := snaps.VerifyStep{Name: "read", OK: true, Detail: report.Location}
+				steps, _ := snaps.Verify(data)
+				report.Steps = append([]snaps.VerifyStep{readStep}, steps...)
+			}
+			report.Valid = len(report.Steps) > 1
+			for _, step := range report.Steps {
+				report.Valid = report.Valid && step.OK
+			}
+
+			if jsonOutput {
+				out, _ := json.MarshalIndent(report, "", "  ")
+				fmt.Println(string(out))
+			} else {
+				for _, step := range report.Steps {
+					status := doctorOK
+					if !step.OK {
+						status = doctorFail
+					}
+					fmt.Printf("[%-4s] %s: %s\n", strings.ToUpper(status), step.Name, step.Detail)
+				}
+			}
+
+			if !report.Valid {
+				logger.Errorf("snap %s of %s failed verification", snapName, envName)
+				if !jsonOutput {
+					fmt.Printf("Snap '%s' cannot be restored.\n", snapName)
+				}
+				os.Exit(1)
+			}
+			logger.Infof("snap %s of %s verified", snapName, envName)
+			if !jsonOutput {
+				fmt.Printf("Snap '%s' can be restored.\n", snapName)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&remote, "remote", false, "Verify the snap in the environment's remote S3 storage")
+	cmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the result of each check as JSON")
+	addRemoteSnapProfileFlag(cmd)
+	return cmd
+}
+
+// fetchRemoteSnapFile downloads a remote snap and removes the encryption it
+// was uploaded with, returning the content of the snap file.
+func fetchRemoteSnapFile(envPath, envName, snapName string) ([]byte, error) {
+	if os.Getenv("REMOTE_SNAP_AUTH") == "" {
+		return nil, fmt.Errorf("REMOTE_SNAP_AUTH must be set")
+	}
+	accessKey, secretKey, region, profile, err := remoteSnapAWS(envPath, envName)
+	if err != nil {
+		return nil, err
+	}
+	key, _, err := remoteSnapTarget(snapName)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	encrypted, err := snaps.GetRemoteSnap(ctx, key, accessKey, secretKey, region, profile)
+	if err != nil {
+		return nil, err
+	}
+	return snaps.UnwrapRemote(encrypted)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"tfvenv/i18n"
+	"tfvenv/snaps"
+)
+
+// stateCmd defines the "state" command and its subcommands.
+func stateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "state",
+		Short: "Back up and restore an environment's Terraform state",
+	}
+
+	cmd.AddCommand(stateBackupCmd())
+	cmd.AddCommand(stateRestoreCmd())
+	cmd.AddCommand(stateListCmd())
+
+	return cmd
+}
+
+// stateBackupCmd pulls the current state and stores it encrypted alongside the environment's snaps
+func stateBackupCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "backup <env-name> [backup-name]",
+		Short: "Pull the current Terraform state into the encrypted snap store",
+		Args:  cobra.RangeArgs(1, 2),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envDir := viper.GetString("env-dir")
+			envPath := filepath.Join(envDir, envName)
+
+			backupName := stateBackupName(envPath)
+			if len(args) > 1 {
+				name, err := snaps.SanitizeSnapName(args[1])
+				if err != nil {
+					logger.Errorf("invalid backup name '%s': %v", args[1], err)
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+				backupName = name
+			}
+
+			// Only stdout carries the state; warnings on stderr must not end up in the backup
+			cmdPull, err := envTerraformCommand(envPath, envName, "state", "pull")
+			if err != nil {
+				logger.Errorf("error pulling state: %v", err)
+				fmt.Printf("Error pulling state: %v\n", err)
+				os.Exit(1)
+			}
+			cmdPull.Stderr = os.Stderr
+			state, err := cmdPull.Output()
+			if err != nil {
+				logger.Errorf("error pulling state: %v", err)
+				fmt.Printf("Error pulling state: %v\n", err)
+				os.Exit(1)
+			}
+			if strings.TrimSpace(string(state)) == "" {
+				fmt.Println("No state found for the environment. Nothing to back up.")
+				logger.Warnf("no state found for environment '%s'", envName)
+				return
+			}
+
+			filePath := snaps.GetStateBackupFilePath(envPath, backupName)
+			if err := snaps.SaveStateBackup(filePath, state); err != nil {
+				logger.Errorf("error saving state backup: %v", err)
+				fmt.Printf("Error saving state backup: %v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("State backup '%s' saved to %s\n", backupName, filePath)
+			logger.Infof("State backup '%s' saved to %s", backupName, filePath)
+		},
+	}
+}
+
+// stateRestoreCmd pushes a stored state backup back to the environment's backend
+func stateRestoreCmd() *cobra.Command {
+	var force bool
+
+	cmd := &cobra.Command{
+		Use:   "restore <env-name> <backup-name>",
+		Short: "Push a state backup from the encrypted snap store back to the backend",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envDir := viper.GetString("env-dir")
+			envPath := filepath.Join(envDir, envName)
+
+			backupName, err := snaps.SanitizeSnapName(args[1])
+			if err != nil {
+				logger.Errorf("invalid backup name '%s': %v", args[1], err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+
+			filePath := snaps.GetStateBackupFilePath(envPath, backupName)
+			if !fileExists(filePath) {
+				fmt.Printf("State backup '%s' does not exist in environment '%s'.\n", backupName, envName)
+				logger.Warnf("state backup '%s' does not exist in environment '%s'", backupName, envName)
+				os.Exit(1)
+			}
+
+			state, err := snaps.GetStateBackup(filePath)
+			if err != nil {
+				logger.Errorf("error reading state backup: %v", err)
+				fmt.Printf("Error reading state backup: %v\n", err)
+				os.Exit(1)
+			}
+
+			if err := pushState(envPath, envName, state, force); err != nil {
+				logger.Errorf("error pushing state: %v", err)
+				fmt.Printf("Error pushing state: %v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("State backup '%s' restored to environment '%s'.\n", backupName, envName)
+			logger.Infof("State backup '%s' restored to environment '%s'", backupName, envName)
+		},
+	}
+
+	cmd.Flags().BoolVar(&force, "force", false, "Push the state even if lineage or serial checks fail")
+
+	return cmd
+}
+
+// pushState pushes state to the environment's backend with terraform state
+// push, which reads from a file. The decrypted state is staged in a private
+// temporary file that is removed afterwards, also when tfvenv is interrupted.
+func pushState(envPath, envName string, state []byte, force bool) error {
+	tmpFile, err := os.CreateTemp("", "tfvenv-state-*.tfstate")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary state file: %w", err)
+	}
+	tmpPath := tmpFile.Name()
+	removeCleanup := onInterrupt(func() { os.Remove(tmpPath) })
+	defer func() {
+		removeCleanup()
+		os.Remove(tmpPath)
+	}()
+	if _, err := tmpFile.Write(state); err != nil {
+		tmpFile.Close()
+		return fmt.Errorf("failed to write temporary state file: %w", err)
+	}
+	if err := tmpFile.Close(); err != nil {
+		return fmt.Errorf("failed to write temporary state file: %w", err)
+	}
+
+	pushArgs := []string{"state", "push"}
+	if force {
+		pushArgs = append(pushArgs, "-force")
+	}
+	pushArgs = append(pushArgs, tmpPath)
+	_, err = runEnvTerraform(envPath, envName, pushArgs...)
+	return err
+}
+
+// stateListCmd lists the stored state backups of an environment
+func stateListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list <env-name>",
+		Short: "List state backups stored for the specified environment",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envDir := viper.GetString("env-dir")
+			envPath := filepath.Join(envDir, envName)
+
+			backups, err := snaps.ListStateBackups(envPath)
+			if err != nil {
+				logger.Errorf("error listing state backups: %v", err)
+				fmt.Printf("Error listing state backups: %v\n", err)
+				os.Exit(1)
+			}
+
+			if len(backups) == 0 {
+				fmt.Printf("No state backups found for environment '%s'.\n", envName)
+				return
+			}
+
+			fmt.Printf("State backups for environment '%s':\n", envName)
+			for _, name := range backups {
+				fmt.Println(" -", name)
+			}
+		},
+	}
+}
+
+// stateBackupName builds the default backup name from the recorded workspace and the current time.
+func stateBackupName(envPath string) string {
+	workspace := "default"
+	if meta, err := loadEnvMetadata(envPath); err == nil && meta.Workspace != "" {
+		workspace = meta.Workspace
+	}
+	return fmt.Sprintf("%s-%s", workspace, time.Now().UTC().Format("20060102T150405Z"))
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// commandSummary collects what the running command did, for --summary.
+// Nothing is collected without the flag, so long-running commands such as the
+// daemon do not accumulate records.
+type commandSummary struct {
+	mu              sync.Mutex
+	enabled         bool
+	command         string
+	started         time.Time
+	filesWritten    []string
+	downloads       int
+	bytesDownloaded int64
+	cacheHits       int
+	phases          []summaryPhase
+}
+
+// summaryPhase is a timed step of a command, such as installing one tool.
+type summaryPhase struct {
+	Name     string        `json:"name"`
+	Duration time.Duration `json:"duration_ns"`
+}
+
+var summary = &commandSummary{started: time.Now()}
+
+// start begins collecting for the command about to run, if enabled.
+func (s *commandSummary) start(command string, enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.enabled = enabled
+	s.command = command
+	s.started = time.Now()
+}
+
+// fileWritten records a file the command created or rewrote.
+func (s *commandSummary) fileWritten(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.enabled {
+		return
+	}
+	s.filesWritten = append(s.filesWritten, path)
+}
+
+// downloaded records a completed download of n bytes.
+func (s *commandSummary) downloaded(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.enabled {
+		return
+	}
+	s.downloads++
+	s.bytesDownloaded += n
+}
+
+// cacheHit records a download that the artifact cache made unnecessary.
+func (s *commandSummary) cacheHit() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.enabled {
+		return
+	}
+	s.cacheHits++
+}
+
+// phase starts timing a named step and returns the function that ends it:
+//
+//	defer summary.phase("install terraform")()
+func (s *commandSummary) phase(name string) func() {
+	started := time.Now()
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if !s.enabled {
+			return
+		}
+		s.phases = append(s.phases, summaryPhase{Name: name, Duration: time.Since(started)})
+	}
+}
+
+// report prints the summary to stderr, so it never mixes with output other
+// tools parse, and logs it as one structured entry.
+func (s *commandSummary) report() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.enabled {
+		return
+	}
+	total := time.Since(s.started)
+	files := append([]string(nil), s.filesWritten...)
+	sort.Strings(files)
+
+	fmt.Fprintf(os.Stderr, "\nSummary of '%s':\n", s.command)
+	fmt.Fprintf(os.Stderr, "  Duration:    %s\n", total.Round(time.Millisecond))
+	fmt.Fprintf(os.Stderr, "  Downloads:   %d (%s), %d from cache\n", s.downloads, formatSize(s.bytesDownloaded), s.cacheHits)
+	fmt.Fprintf(os.Stderr, "  Files written: %d\n", len(files))
+	for _, path := range files {
+		fmt.Fprintf(os.Stderr, "    %s\n", path)
+	}
+	if len(s.phases) > 0 {
+		fmt.Fprintln(os.Stderr, "  Phases:")
+		for _, p := range s.phases {
+			fmt.Fprintf(os.Stderr, "    %-30s %s\n", p.Name, p.Duration.Round(time.Millisecond))
+		}
+	}
+
+	logger.WithFields(logrus.Fields{
+		"command":          s.command,
+		"duration_ms":      total.Milliseconds(),
+		"downloads":        s.downloads,
+		"bytes_downloaded": s.bytesDownloaded,
+		"cache_hits":       s.cacheHits,
+		"files_written":    files,
+		"phases":           s.phases,
+	}).Info("command summary")
+}
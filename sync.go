@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"tfvenv/i18n"
+)
+
+// syncChange is one step that brings an environment in line with its .tfvenvrc.
+type syncChange struct {
+	// Action is "+" for something created and "~" for something changed.
+	Action string
+	Target string
+	Detail string
+	// Binary marks changes that replace an installed binary.
+	Binary bool
+	Apply  func() error
+}
+
+// backendPlaceholders are the values create writes into terragrunt.<env>.hcl
+// before the backend is configured.
+var backendPlaceholders = []string{"your_s3_state_bucket", "your_s3_state_path", "your_aws_region"}
+
+// syncCmd converges an environment with its declared configuration.
+func syncCmd() *cobra.Command {
+	var dryRun, yes bool
+
+	cmd := &cobra.Command{
+		Use:   "sync <env-name>",
+		Short: "Install, regenerate and update whatever the environment's .tfvenvrc declares",
+		Long: `Read the environment's .tfvenvrc and converge the environment with it: install
+the pinned Terraform, OpenTofu and Terragrunt versions, record the tool, fill
+in backend settings left as placeholders in terragrunt.<env>.hcl, generate
+missing scaffolding files and regenerate the activation scripts. The changes
+are printed as a plan and confirmed before anything is modified.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envDir := viper.GetString("env-dir")
+			envPath := filepath.Join(envDir, envName)
+			if _, err := os.Stat(envPath); os.IsNotExist(err) {
+				i18n.Println("env.not_found", envName)
+				os.Exit(1)
+			}
+			configPath := filepath.Join(envPath, "config", envName, tfvenvrcFileName)
+			config, err := readConfig(configPath)
+			if err != nil {
+				logger.Errorf("error reading %s: %v", configPath, err)
+				i18n.Println("config.read_error", err)
+				os.Exit(1)
+			}
+			if problems, _, err := validateConfigFile(configPath); err == nil && len(problems) > 0 {
+				i18n.Println("error", strings.Join(problems, "; "))
+				os.Exit(1)
+			}
+
+			changes, err := planSync(envPath, envName, config)
+			if err != nil {
+				logger.Errorf("error planning sync of %s: %v", envName, err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+
+			printSyncPlan(envName, changes)
+			if dryRun {
+				return
+			}
+			if !yes {
+				ok, err := confirm("Apply these changes?")
+				if err != nil {
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+				if !ok {
+					fmt.Println("Sync cancelled.")
+					return
+				}
+			}
+
+			if err := applySync(envPath, changes); err != nil {
+				logger.Errorf("error syncing %s: %v", envName, err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			logger.Infof("synced environment %s", envName)
+			fmt.Printf("Environment '%s' is in sync with %s.\n", envName, tfvenvrcFileName)
+		},
+	}
+
+	addDryRunFlag(cmd, &dryRun)
+	cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Apply the changes without asking for confirmation")
+	return cmd
+}
+
+// planSync lists the changes that bring the environment in line with config.
+// The activation scripts are always regenerated, since they are derived from
+// every setting in .tfvenvrc.
+func planSync(envPath, envName string, config Config) ([]syncChange, error) {
+	var changes []syncChange
+
+	// Tool family
+	meta, _ := loadEnvMetadata(envPath)
+	tool := resolveTool(config.Tool, meta.Tool)
+	if meta.Tool != tool {
+		from := meta.Tool
+		if from == "" {
+			from = "unrecorded"
+		}
+		changes = append(changes, syncChange{
+			Action: "~",
+			Target: "tool",
+			Detail: fmt.Sprintf("%s -> %s", from, tool),
+			Apply: func() error {
+				return updateEnvMetadata(envPath, func(meta *EnvironmentMetadata) { meta.Tool = tool })
+			},
+		})
+	}
+
+	// Binaries
+	binDir := filepath.Join(envPath, "bin")
+	tfVersion := config.TfVersion
+	for _, pin := range []struct{ tool, version string }{{tool, config.TfVersion}, {"terragrunt", config.TgVersion}} {
+		pin := pin
+		if pin.version == "none" {
+			continue
+		}
+		installed := ""
+		binaryPath := envBinaryPath(envPath, pin.tool)
+		if fileExists(binaryPath) {
+			installed, _ = getBinaryVersion(binaryPath, pin.tool)
+		}
+		if pin.tool == tool && installed != "" && !pinnedVersion(tfVersion) {
+			tfVersion = installed
+		}
+		if installed != "" && (!pinnedVersion(pin.version) || installed == pin.version) {
+			continue
+		}
+
+		target := pin.version
+		if !pinnedVersion(target) {
+			latest, err := getLatestVersion(pin.tool, false)
+			if err != nil {
+				return nil, fmt.Errorf("failed to fetch latest version for %s: %w", pin.tool, err)
+			}
+			target = latest
+		}
+		if pin.tool == tool {
+			tfVersion = target
+		}
+		change := syncChange{Action: "+", Target: pin.tool, Detail: fmt.Sprintf("install %s", target), Binary: true}
+		if installed != "" {
+			change.Action = "~"
+			change.Detail = fmt.Sprintf("%s -> %s", installed, target)
+		}
+		change.Apply = func() error {
+			if err := downloadAndInstallBinary(toolDownloadURL(pin.tool), target, binDir, pin.tool); err != nil {
+				return err
+			}
+			refreshEnvState(envPath, envName)
+			return nil
+		}
+		changes = append(changes, change)
+	}
+
+	// Backend settings still left as placeholders by create
+	configEnvDir := filepath.Join(envPath, "config", envName)
+	terragruntPath := filepath.Join(configEnvDir, fmt.Sprintf("terragrunt.%s.hcl", envName))
+	region := config.AWSRegion
+	if region == "" {
+		region = config.Region
+	}
+	if content, err := os.ReadFile(terragruntPath); err == nil {
+		replacer, filled := backendReplacer(content, []string{config.S3StateBucket, config.S3StatePath, region})
+		if len(filled) > 0 {
+			changes = append(changes, syncChange{
+				Action: "~",
+				Target: filepath.Join("config", envName, filepath.Base(terragruntPath)),
+				Detail: fmt.Sprintf("fill in %s", strings.Join(filled, ", ")),
+				Apply: func() error {
+					return writeSecretFile(terragruntPath, []byte(replacer.Replace(string(content))))
+				},
+			})
+		}
+	}
+
+	// Scaffolding, for environments created with --scaffold
+	var present, missing []string
+	for _, name := range []string{"backend.tf", "provider.tf", "versions.tf"} {
+		if fileExists(filepath.Join(configEnvDir, name)) {
+			present = append(present, name)
+		} else if name != "backend.tf" || config.S3StateBucket != "" {
+			missing = append(missing, name)
+		}
+	}
+	if len(present) > 0 && len(missing) > 0 {
+		changes = append(changes, syncChange{
+			Action: "+",
+			Target: filepath.Join("config", envName),
+			Detail: strings.Join(missing, ", "),
+			Apply: func() error {
+				_, err := generateScaffolding(configEnvDir, envName, tfVersion, config)
+				return err
+			},
+		})
+	}
+
+	// Terraform CLI configuration, before the scripts that point at it
+	if declaresCLIConfig(config) || fileExists(filepath.Join(envPath, cliConfigFileName)) {
+		changes = append(changes, syncChange{
+			Action: "~",
+			Target: cliConfigFileName,
+			Detail: "apply the CLI_* settings",
+			Apply: func() error {
+				return applyCLIConfig(envPath, config)
+			},
+		})
+	}
+
+	// Activation scripts, regenerated last so they see the recorded tool
+	config.EnvVars = withEnvPaths(config.EnvVars, envPath)
+	changes = append(changes, syncChange{
+		Action: "~",
+		Target: "bin",
+		Detail: "regenerate activation and deactivation scripts",
+		Apply: func() error {
+			if err := generateActivateScript(envPath, envName, config); err != nil {
+				return err
+			}
+			return generateDeactivateScript(envPath, config)
+		},
+	})
+	return changes, nil
+}
+
+// printSyncPlan prints the changes planSync returned.
+func printSyncPlan(envName string, changes []syncChange) {
+	fmt.Printf("Sync plan for '%s':\n", envName)
+	for _, change := range changes {
+		fmt.Printf("  %s %s: %s\n", change.Action, change.Target, change.Detail)
+	}
+}
+
+// backendReplacer returns a replacer for the backend placeholders found in
+// content that have a configured value, and the names of the settings it fills.
+func backendReplacer(content []byte, values []string) (*strings.Replacer, []string) {
+	names := []string{"S3_STATE_BUCKET", "S3_STATE_PATH", "REGION"}
+	var pairs, filled []string
+	for i, placeholder := range backendPlaceholders {
+		if values[i] == "" || !bytes.Contains(content, []byte(placeholder)) {
+			continue
+		}
+		pairs = append(pairs, placeholder, values[i])
+		filled = append(filled, names[i])
+	}
+	return strings.NewReplacer(pairs...), filled
+}
+
+// withEnvPaths adds the plugin cache and data directory variables create puts
+// into every environment, unless .tfvenvrc overrides them.
+func withEnvPaths(envVars map[string]string, envPath string) map[string]string {
+	vars := map[string]string{
+		"TF_PLUGIN_CACHE_DIR": defaultPluginCacheDir(),
+		"TF_DATA_DIR":         filepath.Join(envPath, "terraform-data"),
+	}
+	for key, value := range envVars {
+		vars[key] = value
+	}
+	return vars
+}
+
+// applySync applies the changes in order and reports each one. Binaries are
+// backed up first and restored if a change fails.
+func applySync(envPath string, changes []syncChange) error {
+	var backupDir string
+	for _, change := range changes {
+		if change.Binary {
+			dir, err := backupBinaries(envPath)
+			if err != nil {
+				return err
+			}
+			backupDir = dir
+			break
+		}
+	}
+	rollback := func() {
+		if backupDir == "" {
+			return
+		}
+		if _, err := restoreLatestBackup(envPath); err != nil {
+			logger.Errorf("failed to restore binaries after sync: %v", err)
+			return
+		}
+		fmt.Println("Restored the previous binaries.")
+	}
+	removeCleanup := onInterrupt(rollback)
+	defer removeCleanup()
+
+	scripts := []string{"activate.sh", "activate.fish", "Activate.ps1", "deactivate.sh", "deactivate.fish", "Deactivate.ps1"}
+	before := make(map[string][]byte)
+	for _, script := range scripts {
+		before[script], _ = os.ReadFile(filepath.Join(envPath, "bin", script))
+	}
+
+	for _, change := range changes {
+		if err := change.Apply(); err != nil {
+			if change.Binary {
+				removeCleanup()
+				rollback()
+			}
+			return fmt.Errorf("failed to sync %s: %w", change.Target, err)
+		}
+		if change.Target != "bin" {
+			fmt.Printf("  %s %s: %s ... done\n", change.Action, change.Target, change.Detail)
+			logger.Infof("sync %s %s: %s", change.Action, change.Target, change.Detail)
+		}
+	}
+
+	// Report only the scripts whose content actually changed
+	changed := 0
+	for _, script := range scripts {
+		after, _ := os.ReadFile(filepath.Join(envPath, "bin", script))
+		if !bytes.Equal(before[script], after) {
+			fmt.Printf("  ~ bin/%s: regenerated\n", script)
+			changed++
+		}
+	}
+	if changed == 0 {
+		fmt.Println("  activation scripts unchanged")
+	}
+
+	if backupDir != "" {
+		removeCleanup()
+		if err := os.RemoveAll(backupDir); err != nil {
+			logger.Warnf("failed to remove binary backup %s: %v", backupDir, err)
+		}
+	}
+	return nil
+}
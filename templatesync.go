@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"tfvenv/i18n"
+)
+
+// templateEnvPlaceholder is replaced by the environment name in the file
+// names of an upstream template set.
+const templateEnvPlaceholder = "{{ENV}}"
+
+// templateSource records where an environment's templates are synced from.
+type templateSource struct {
+	URL    string    `json:"url"`
+	Ref    string    `json:"ref,omitempty"`
+	Path   string    `json:"path,omitempty"`
+	Commit string    `json:"commit"`
+	Synced time.Time `json:"synced"`
+}
+
+// templatesCmd groups the commands that keep environments' templates in line
+// with an organisation-wide template repository.
+func templatesCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "templates",
+		Short: "Sync environment templates from a shared git repository",
+		Long: `Pull a curated template set from a git repository into environments'
+templates directories, and report environments whose templates have fallen
+behind it. Run 'tfvenv merge' afterwards to bring the standards into the
+environment's configuration.`,
+	}
+	cmd.AddCommand(templatesSyncCmd())
+	cmd.AddCommand(templatesOutdatedCmd())
+	return cmd
+}
+
+// templatesSyncCmd copies the upstream template set into environments.
+func templatesSyncCmd() *cobra.Command {
+	var ref, subdir string
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "sync <git-url> [env-name...]",
+		Short: "Pull the templates of a git repository into environments (defaults to all environments)",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			url := args[0]
+			envDir := viper.GetString("env-dir")
+			envNames, err := templateEnvNames(envDir, args[1:])
+			if err != nil {
+				logger.Errorf("error listing environments: %v", err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+
+			repoDir, commit, err := fetchTemplateRepo(url, ref)
+			if err != nil {
+				logger.Errorf("error fetching templates from %s: %v", url, err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Fetched %s at %s\n", url, shortCommit(commit))
+
+			source := templateSource{URL: url, Ref: ref, Path: subdir, Commit: commit, Synced: time.Now().UTC()}
+			for _, envName := range envNames {
+				envPath := filepath.Join(envDir, envName)
+				files, err := upstreamTemplates(filepath.Join(repoDir, subdir), envName)
+				if err != nil {
+					logger.Errorf("error reading templates from %s: %v", url, err)
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+				changed, err := outdatedTemplates(envPath, files)
+				if err != nil {
+					logger.Errorf("error comparing templates of %s: %v", envName, err)
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+				if len(changed) == 0 {
+					fmt.Printf("%s: templates are up to date\n", envName)
+				}
+				for _, name := range changed {
+					path := filepath.Join(envPath, "templates", filepath.FromSlash(name))
+					if dryRun {
+						printDryRun("write %s", path)
+						continue
+					}
+					if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+						logger.Errorf("error creating %s: %v", filepath.Dir(path), err)
+						i18n.Println("error", err)
+						os.Exit(1)
+					}
+					if err := os.WriteFile(path, files[name], 0644); err != nil {
+						logger.Errorf("error writing %s: %v", path, err)
+						i18n.Println("error", err)
+						os.Exit(1)
+					}
+					fmt.Printf("%s: updated %s\n", envName, name)
+				}
+				if dryRun {
+					continue
+				}
+				if err := updateEnvMetadata(envPath, func(meta *EnvironmentMetadata) {
+					meta.TemplateSource = &source
+				}); err != nil {
+					logger.Errorf("error recording template source for %s: %v", envName, err)
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+				if len(changed) > 0 {
+					fmt.Printf("Run 'tfvenv merge %s --env-type %s' to apply the updated templates.\n", envName, envName)
+				}
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&ref, "ref", "", "Branch or tag to sync (defaults to the repository's default branch)")
+	cmd.Flags().StringVar(&subdir, "path", "", "Directory of the repository holding the templates")
+	addDryRunFlag(cmd, &dryRun)
+	return cmd
+}
+
+// templatesOutdatedCmd reports environments whose templates differ from their upstream.
+func templatesOutdatedCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "outdated [env-name...]",
+		Short: "List environments whose templates differ from the repository they were synced from",
+		Run: func(cmd *cobra.Command, args []string) {
+			envDir := viper.GetString("env-dir")
+			envNames, err := templateEnvNames(envDir, args)
+			if err != nil {
+				logger.Errorf("error listing environments: %v", err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+
+			// Environments synced from the same source share one fetch
+			fetched := make(map[string]string)
+			outdated := 0
+			for _, envName := range envNames {
+				envPath := filepath.Join(envDir, envName)
+				meta, err := loadEnvMetadata(envPath)
+				if err != nil {
+					logger.Warnf("error reading metadata of %s: %v", envName, err)
+				}
+				source := meta.TemplateSource
+				if source == nil {
+					fmt.Printf("%s: no template source (run 'tfvenv templates sync <git-url> %s')\n", envName, envName)
+					continue
+				}
+
+				key := source.URL + "@" + source.Ref
+				repoDir, ok := fetched[key]
+				if !ok {
+					var commit string
+					repoDir, commit, err = fetchTemplateRepo(source.URL, source.Ref)
+					if err != nil {
+						logger.Errorf("error fetching templates from %s: %v", source.URL, err)
+						i18n.Println("error", err)
+						os.Exit(1)
+					}
+					fetched[key] = repoDir
+					logger.Infof("fetched %s at %s", source.URL, commit)
+				}
+				files, err := upstreamTemplates(filepath.Join(repoDir, source.Path), envName)
+				if err != nil {
+					logger.Errorf("error reading templates from %s: %v", source.URL, err)
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+				changed, err := outdatedTemplates(envPath, files)
+				if err != nil {
+					logger.Errorf("error comparing templates of %s: %v", envName, err)
+					i18n.Println("error", err)
+					os.Exit(1)
+				}
+				if len(changed) == 0 {
+					fmt.Printf("%s: up to date with %s (synced at %s)\n", envName, source.URL, shortCommit(source.Commit))
+					continue
+				}
+				outdated++
+				fmt.Printf("%s: %d template(s) differ from %s: %s\n", envName, len(changed), source.URL, strings.Join(changed, ", "))
+			}
+
+			if outdated > 0 {
+				fmt.Printf("%d environment(s) have outdated templates; run 'tfvenv templates sync' to update them.\n", outdated)
+				os.Exit(1)
+			}
+		},
+	}
+}
+
+// templateEnvNames returns the named environments, or all of them.
+func templateEnvNames(envDir string, names []string) ([]string, error) {
+	if len(names) > 0 {
+		for _, name := range names {
+			if _, err := os.Stat(filepath.Join(envDir, name)); os.IsNotExist(err) {
+				return nil, fmt.Errorf("environment '%s' does not exist", name)
+			}
+		}
+		return names, nil
+	}
+	return listEnvironmentDirs(envDir)
+}
+
+// fetchTemplateRepo brings a shallow checkout of url at ref into the cache
+// directory and returns it with the commit it is at.
+func fetchTemplateRepo(url, ref string) (string, string, error) {
+	sum := sha256.Sum256([]byte(url))
+	dir := filepath.Join(userDirs.CacheDir(), "templates", hex.EncodeToString(sum[:8]))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", "", fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	if ref == "" {
+		ref = "HEAD"
+	}
+	// fileExists is false for directories, so check .git itself
+	if info, err := os.Stat(filepath.Join(dir, ".git")); err != nil || !info.IsDir() {
+		if err := runGit("init", "-q", dir); err != nil {
+			return "", "", err
+		}
+	}
+	if err := runGit("-C", dir, "fetch", "-q", "--depth", "1", url, ref); err != nil {
+		return "", "", err
+	}
+	if err := runGit("-C", dir, "checkout", "-q", "--force", "FETCH_HEAD"); err != nil {
+		return "", "", err
+	}
+	if err := runGit("-C", dir, "clean", "-q", "-fdx"); err != nil {
+		return "", "", err
+	}
+	commit, err := gitOutput("-C", dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read the commit of %s: %w", dir, err)
+	}
+	return dir, commit, nil
+}
+
+// runGit runs git, returning its output with the error when it fails.
+func runGit(args ...string) error {
+	out, err := exec.CommandContext(rootCtx, "git", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git %s failed: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// upstreamTemplates returns the *.template files under dir as they are
+// written to envName's templates directory. tfvars.template and
+// terragrunt.hcl.template become <env>.tfvars.template and
+// terragrunt.<env>.hcl.template, the names create and merge use, and {{ENV}}
+// in other names is replaced by the environment name.
+func upstreamTemplates(dir, envName string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !info.Mode().IsRegular() || !strings.HasSuffix(info.Name(), ".template") {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		switch name {
+		case "tfvars.template":
+			name = envName + ".tfvars.template"
+		case "terragrunt.hcl.template":
+			name = "terragrunt." + envName + ".hcl.template"
+		default:
+			name = strings.ReplaceAll(name, templateEnvPlaceholder, envName)
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files[name] = content
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no *.template files found in %s", dir)
+	}
+	return files, nil
+}
+
+// outdatedTemplates returns the names of the upstream templates that are
+// missing from, or differ in, the environment's templates directory.
+func outdatedTemplates(envPath string, files map[string][]byte) ([]string, error) {
+	var changed []string
+	for name, content := range files {
+		current, err := os.ReadFile(filepath.Join(envPath, "templates", filepath.FromSlash(name)))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if err != nil || !bytes.Equal(current, content) {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// shortCommit abbreviates a commit hash for display.
+func shortCommit(commit string) string {
+	if len(commit) > 12 {
+		return commit[:12]
+	}
+	return commit
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Tool families an environment can run its configuration with.
+const (
+	toolTerraform = "terraform"
+	toolTofu      = "tofu"
+)
+
+// tofuDownloadURL is where OpenTofu release archives are published.
+const tofuDownloadURL = "https://github.com/opentofu/opentofu/releases/download/"
+
+// validateTool rejects TOOL values other than terraform and tofu.
+func validateTool(tool string) error {
+	switch tool {
+	case "", toolTerraform, toolTofu:
+		return nil
+	}
+	return fmt.Errorf("unsupported tool %q: expected %s or %s", tool, toolTerraform, toolTofu)
+}
+
+// resolveTool returns the tool family set by TOOL in .tfvenvrc, then the one
+// recorded when the environment was created, defaulting to terraform.
+func resolveTool(configured, recorded string) string {
+	for _, tool := range []string{configured, recorded} {
+		tool = strings.ToLower(strings.TrimSpace(tool))
+		if tool == toolTerraform || tool == toolTofu {
+			return tool
+		}
+	}
+	return toolTerraform
+}
+
+// envTool returns the tool family of an environment.
+func envTool(envPath, envName string) string {
+	config, _ := readConfig(filepath.Join(envPath, "config", envName, tfvenvrcFileName))
+	meta, _ := loadEnvMetadata(envPath)
+	return resolveTool(config.Tool, meta.Tool)
+}
+
+// windowsExecutableSuffix is the extension executables need on Windows.
+const windowsExecutableSuffix = ".exe"
+
+// executableName returns the file name of an executable on this platform:
+// name itself, or name.exe on Windows. Every path to an installed binary is
+// built with it, so lookups never miss the suffix.
+func executableName(name string) string {
+	if runtime.GOOS == "windows" && !strings.HasSuffix(strings.ToLower(name), windowsExecutableSuffix) {
+		return name + windowsExecutableSuffix
+	}
+	return name
+}
+
+// toolDownloadURL returns the release base URL of a tool.
+func toolDownloadURL(tool string) string {
+	switch tool {
+	case toolTofu:
+		return tofuDownloadURL
+	case "terragrunt":
+		return terragruntDownloadURL
+	}
+	return terraformDownloadURL
+}
+
+// toolDisplayName returns the product name of a tool for messages.
+func toolDisplayName(tool string) string {
+	switch tool {
+	case toolTofu:
+		return "OpenTofu"
+	case "terragrunt":
+		return "Terragrunt"
+	}
+	return "Terraform"
+}
+
+// envToolBinary returns the binary of a tool an environment runs: the one in
+// its bin directory, or, when that is missing, the version store's copy of
+// the version pinned in .tfvenvrc.
+func envToolBinary(envPath, envName, tool string) (string, error) {
+	binary := envBinaryPath(envPath, tool)
+	if fileExists(binary) {
+		return binary, nil
+	}
+	config, _ := readConfig(filepath.Join(envPath, "config", envName, tfvenvrcFileName))
+	pinned := config.TfVersion
+	if tool == "terragrunt" {
+		pinned = config.TgVersion
+	}
+	if pinnedVersion(pinned) {
+		if stored := storedBinaryPath(tool, pinned); fileExists(stored) {
+			return stored, nil
+		}
+	}
+	return "", fmt.Errorf("%s is not installed in %s", toolDisplayName(tool), envName)
+}
+
+// pathBinaryMismatches compares the tools found on PATH with the
+// environment's own and describes each one that is a different version, as
+// when another environment is active or a system install shadows it.
+func pathBinaryMismatches(envPath, envName string, state envState) []string {
+	var mismatches []string
+	check := func(tool, envVersion string) {
+		if envVersion == "" {
+			return
+		}
+		onPath, err := exec.LookPath(executableName(tool))
+		if err != nil || sameFile(onPath, envBinaryPath(envPath, tool)) {
+			return
+		}
+		pathVersion, err := getBinaryVersion(onPath, tool)
+		if err != nil || pathVersion == envVersion {
+			return
+		}
+		mismatches = append(mismatches, fmt.Sprintf("%s on PATH (%s) is version %s, but %s has %s", tool, onPath, pathVersion, envName, envVersion))
+	}
+	check(state.Tool, state.TerraformVersion)
+	check("terragrunt", state.TerragruntVersion)
+	return mismatches
+}
+
+// warnPathBinaries prints a warning for each tool on PATH that differs from
+// the environment's own. tfvenv itself always runs the environment's binaries.
+func warnPathBinaries(envPath, envName string, state envState) {
+	for _, mismatch := range pathBinaryMismatches(envPath, envName, state) {
+		logger.Warn(mismatch)
+		fmt.Fprintf(os.Stderr, "Warning: %s; activate the environment to use its binaries.\n", mismatch)
+	}
+}
+
+// envTerraformOnly reports whether an environment runs without Terragrunt.
+// Environments created before this was recorded count as Terraform-only when
+// .tfvenvrc pins no Terragrunt and none is installed.
+func envTerraformOnly(envPath, envName string) bool {
+	if meta, err := loadEnvMetadata(envPath); err == nil && meta.TerraformOnly {
+		return true
+	}
+	if fileExists(envBinaryPath(envPath, "terragrunt")) {
+		return false
+	}
+	config, _ := readConfig(filepath.Join(envPath, "config", envName, tfvenvrcFileName))
+	return config.TgVersion == "" || config.TgVersion == "none"
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// Limits that guard extraction against decompression bombs. The total can be
+// raised with TFVENV_MAX_EXTRACT_SIZE (e.g. 4GB).
+const (
+	defaultMaxExtractSize int64 = 2 << 30
+	maxExtractEntries           = 10000
+)
+
+// Creator systems of zip entries whose modes are Unix permissions.
+const (
+	zipCreatorUnix   = 3
+	zipCreatorMacOSX = 19
+)
+
+// extractProgressThreshold is the archive size above which extraction
+// progress is shown on a terminal.
+const extractProgressThreshold = 64 << 20
+
+// maxExtractSize returns the most an archive may expand to.
+func maxExtractSize() int64 {
+	if value := os.Getenv("TFVENV_MAX_EXTRACT_SIZE"); value != "" {
+		size, err := parseSize(value)
+		if err == nil && size > 0 {
+			return size
+		}
+		logger.Warnf("invalid TFVENV_MAX_EXTRACT_SIZE %q; using %s", value, formatSize(defaultMaxExtractSize))
+	}
+	return defaultMaxExtractSize
+}
+
+// unzipStandard extracts a zip file to the specified destination using the standard library.
+// Files keep the permission bits recorded in the archive, without write access
+// for group and others. Symlinks are created after everything else and must
+// resolve to an existing path inside dest.
+// Extraction stops once the archive expands beyond maxExtractSize, whatever
+// sizes its headers claim.
+func unzipStandard(src, dest string) error {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return fmt.Errorf("failed to open zip file %s: %w", src, err)
+	}
+	defer r.Close()
+
+	if len(r.File) > maxExtractEntries {
+		return fmt.Errorf("zip file %s has %d entries, more than the %d allowed", src, len(r.File), maxExtractEntries)
+	}
+	dest = filepath.Clean(dest)
+	limit := maxExtractSize()
+
+	var declared uint64
+	for _, f := range r.File {
+		declared += f.UncompressedSize64
+	}
+	if declared > uint64(limit) {
+		return fmt.Errorf("zip file %s expands to %s, more than the %s allowed (TFVENV_MAX_EXTRACT_SIZE)", src, formatSize(int64(declared)), formatSize(limit))
+	}
+	progress := newExtractProgress(filepath.Base(src), int64(declared))
+	defer progress.done()
+
+	var symlinks []*zip.File
+	var written int64
+	for _, f := range r.File {
+		fpath := filepath.Join(dest, f.Name)
+
+		// Check for ZipSlip vulnerability
+		if !strings.HasPrefix(fpath, dest+string(os.PathSeparator)) {
+			return fmt.Errorf("illegal file path: %s", fpath)
+		}
+
+		switch mode := f.Mode(); {
+		case mode.IsDir():
+			if err := os.MkdirAll(fpath, 0755); err != nil {
+				return fmt.Errorf("failed to create directory %s: %w", fpath, err)
+			}
+		case mode&os.ModeSymlink != 0:
+			symlinks = append(symlinks, f)
+		case mode.IsRegular():
+			n, err := extractZipFile(f, fpath, limit-written, progress)
+			written += n
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unsupported file type %s for %s in zip", mode.Type(), f.Name)
+		}
+	}
+
+	var links []string
+	for _, f := range symlinks {
+		linkPath, err := extractZipSymlink(f, dest)
+		if err != nil {
+			return err
+		}
+		links = append(links, linkPath)
+	}
+	return checkExtractedSymlinks(dest, links)
+}
+
+// extractZipFile writes one regular file of an archive, reading at most
+// remaining bytes, and returns how many it wrote.
+func extractZipFile(f *zip.File, fpath string, remaining int64, progress *extractProgress) (int64, error) {
+	if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create directory %s: %w", filepath.Dir(fpath), err)
+	}
+	// Never write through a symlink or over a directory left at the same path
+	if info, err := os.Lstat(fpath); err == nil {
+		if info.IsDir() {
+			return 0, fmt.Errorf("zip entry %s would replace a directory", f.Name)
+		}
+		if err := os.Remove(fpath); err != nil {
+			return 0, fmt.Errorf("failed to replace %s: %w", fpath, err)
+		}
+	}
+
+	// Only archives built on Unix or macOS carry Unix permissions
+	perm := f.Mode().Perm() &^ 0022
+	if creator := f.CreatorVersion >> 8; (creator != zipCreatorUnix && creator != zipCreatorMacOSX) || perm == 0 {
+		perm = 0644
+	}
+	outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create file %s: %w", fpath, err)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		outFile.Close()
+		return 0, fmt.Errorf("failed to open file %s in zip: %w", f.Name, err)
+	}
+	defer rc.Close()
+
+	buffered := bufio.NewWriterSize(outFile, streamBufferSize)
+	n, err := io.Copy(io.MultiWriter(buffered, progress), io.LimitReader(rc, remaining+1))
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if closeErr := outFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(fpath)
+		return n, fmt.Errorf("failed to copy contents to file %s: %w", fpath, err)
+	}
+	if n > remaining {
+		os.Remove(fpath)
+		return n, fmt.Errorf("zip entry %s expands beyond the %s allowed (TFVENV_MAX_EXTRACT_SIZE)", f.Name, formatSize(maxExtractSize()))
+	}
+	// The umask may have removed bits the archive records
+	if err := os.Chmod(fpath, perm); err != nil {
+		return n, fmt.Errorf("failed to set mode of %s: %w", fpath, err)
+	}
+	return n, nil
+}
+
+// extractZipSymlink creates a symlink entry of an archive and returns its
+// path. Absolute targets and targets outside dest are refused.
+func extractZipSymlink(f *zip.File, dest string) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", fmt.Errorf("failed to open file %s in zip: %w", f.Name, err)
+	}
+	data, err := io.ReadAll(io.LimitReader(rc, 4096))
+	rc.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to read symlink %s in zip: %w", f.Name, err)
+	}
+
+	target := string(data)
+	linkPath := filepath.Join(dest, f.Name)
+	if filepath.IsAbs(target) || strings.HasPrefix(target, "/") {
+		return "", fmt.Errorf("zip symlink %s points to the absolute path %s", f.Name, target)
+	}
+	if resolved := filepath.Join(filepath.Dir(linkPath), target); resolved != dest && !strings.HasPrefix(resolved, dest+string(os.PathSeparator)) {
+		return "", fmt.Errorf("zip symlink %s points outside the extraction directory: %s", f.Name, target)
+	}
+	if err := os.MkdirAll(filepath.Dir(linkPath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create directory %s: %w", filepath.Dir(linkPath), err)
+	}
+	if err := os.Symlink(target, linkPath); err != nil {
+		return "", fmt.Errorf("failed to create symlink %s: %w", linkPath, err)
+	}
+	return linkPath, nil
+}
+
+// checkExtractedSymlinks removes the extracted symlinks if any of them leads
+// outside dest or to nothing. Symlinks to other symlinks can combine into a
+// path outside dest that no single target shows.
+func checkExtractedSymlinks(dest string, links []string) error {
+	if len(links) == 0 {
+		return nil
+	}
+	realDest, err := filepath.EvalSymlinks(dest)
+	if err != nil {
+		return err
+	}
+	for _, link := range links {
+		resolved, err := filepath.EvalSymlinks(link)
+		if err == nil && resolved != realDest && !strings.HasPrefix(resolved, realDest+string(os.PathSeparator)) {
+			err = fmt.Errorf("it resolves to %s", resolved)
+		}
+		if err != nil {
+			for _, l := range links {
+				os.Remove(l)
+			}
+			return fmt.Errorf("zip symlink %s is unsafe: %v", link, err)
+		}
+	}
+	return nil
+}
+
+// extractProgress prints how much of a large archive has been extracted, in
+// steps of 10%, when stderr is a terminal.
+type extractProgress struct {
+	name    string
+	total   int64
+	written int64
+	shown   int64
+}
+
+// newExtractProgress returns a progress reporter, or nil when there is
+// nothing worth reporting.
+func newExtractProgress(name string, total int64) *extractProgress {
+	if total < extractProgressThreshold || !term.IsTerminal(int(os.Stderr.Fd())) {
+		return nil
+	}
+	return &extractProgress{name: name, total: total}
+}
+
+// Write counts extracted bytes. A nil reporter discards them.
+func (p *extractProgress) Write(b []byte) (int, error) {
+	if p == nil {
+		return len(b), nil
+	}
+	p.written += int64(len(b))
+	if percent := p.written * 100 / p.total; percent >= p.shown+10 {
+		p.shown = percent - percent%10
+		fmt.Fprintf(os.Stderr, "\rExtracting %s: %d%%", p.name, p.shown)
+	}
+	return len(b), nil
+}
+
+// done ends the progress line.
+func (p *extractProgress) done() {
+	if p != nil && p.shown > 0 {
+		fmt.Fprintln(os.Stderr)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"tfvenv/i18n"
+)
+
+// upCmd creates and syncs every environment declared in tfvenv.yaml.
+func upCmd() *cobra.Command {
+	var manifestFlag string
+	var only []string
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "up",
+		Short: "Create or sync every environment declared in " + manifestFileName,
+		Long: `Read the project manifest (` + manifestFileName + ` in the current directory or a parent)
+and bring every environment it declares up to date: missing environments are
+created, the declared versions, tool, backend and variables are written to each
+environment's .tfvenvrc, and the environment is synced with it.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			manifestPath, err := resolveManifestPath(manifestFlag)
+			if err != nil {
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			m, err := loadManifest(manifestPath)
+			if err != nil {
+				logger.Errorf("error loading manifest: %v", err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+
+			selected := make(map[string]bool)
+			for _, name := range only {
+				selected[name] = true
+			}
+
+			var failed []string
+			for _, env := range m.Environments {
+				if len(selected) > 0 && !selected[env.Name] {
+					continue
+				}
+				fmt.Printf("==> %s\n", env.Name)
+				if err := upEnvironment(m.envPath(manifestPath, env), env, dryRun); err != nil {
+					logger.Errorf("error bringing up %s: %v", env.Name, err)
+					fmt.Printf("Error bringing up '%s': %v\n", env.Name, err)
+					failed = append(failed, env.Name)
+				}
+			}
+
+			if len(failed) > 0 {
+				fmt.Printf("%d environment(s) failed: %s\n", len(failed), strings.Join(failed, ", "))
+				os.Exit(1)
+			}
+			if !dryRun {
+				fmt.Printf("All environments in %s are up to date.\n", manifestPath)
+			}
+		},
+	}
+
+	cmd.Flags().StringVar(&manifestFlag, "manifest", "", "Path to "+manifestFileName+" (defaults to the nearest one)")
+	cmd.Flags().StringSliceVar(&only, "only", nil, "Only bring up these environments (comma-separated)")
+	addDryRunFlag(cmd, &dryRun)
+	return cmd
+}
+
+// upEnvironment creates a declared environment if needed, writes its declared
+// settings to .tfvenvrc and syncs it.
+func upEnvironment(envPath string, env manifestEnv, dryRun bool) error {
+	tool := resolveTool(env.Tool, "")
+	tfVersion, tgVersion := env.TfVersion, env.TgVersion
+	if tfVersion == "" {
+		tfVersion = "latest"
+	}
+	if tgVersion == "" {
+		tgVersion = "none"
+	}
+
+	_, statErr := os.Stat(envPath)
+	missing := os.IsNotExist(statErr)
+	incomplete := fileExists(filepath.Join(envPath, incompleteMarkerName))
+	configPath := filepath.Join(envPath, "config", env.Name, tfvenvrcFileName)
+
+	if dryRun {
+		if missing || incomplete {
+			return planCreate(envPath, env.Name, tool, tfVersion, tgVersion, false)
+		}
+		config, _ := readConfig(configPath)
+		changes, err := planSync(envPath, env.Name, env.applyTo(config))
+		if err != nil {
+			return err
+		}
+		printSyncPlan(env.Name, changes)
+		return nil
+	}
+
+	if missing {
+		if err := checkEnvQuota(filepath.Dir(envPath)); err != nil {
+			return err
+		}
+	}
+	if missing || incomplete {
+		if err := initEnv(envPath, tool, tfVersion, tgVersion, env.Name, false); err != nil {
+			return err
+		}
+		emitEvent(envPath, eventEnvCreated, map[string]string{
+			"terraform_version":  tfVersion,
+			"terragrunt_version": tgVersion,
+		})
+	}
+
+	changed, err := writeConfigValues(configPath, env.configValues())
+	if err != nil {
+		return err
+	}
+	if len(changed) > 0 {
+		fmt.Printf("  ~ %s: %s\n", tfvenvrcFileName, strings.Join(changed, ", "))
+	}
+
+	config, err := readConfig(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", configPath, err)
+	}
+	changes, err := planSync(envPath, env.Name, config)
+	if err != nil {
+		return err
+	}
+	return applySync(envPath, changes)
+}
+
+// printManifestStatus prints the state of every environment in the manifest.
+func printManifestStatus(manifestPath string, m manifest) {
+	fmt.Printf("Environments in %s:\n", manifestPath)
+	fmt.Printf("  %-16s %-10s %-28s %s\n", "NAME", "TOOL", "VERSIONS", "STATUS")
+	for _, env := range m.Environments {
+		envPath := m.envPath(manifestPath, env)
+		tool := resolveTool(env.Tool, "")
+		declared := fmt.Sprintf("%s %s", env.TfVersion, env.TgVersion)
+
+		status := "in sync"
+		switch _, err := os.Stat(envPath); {
+		case os.IsNotExist(err):
+			status = "missing (run 'tfvenv up')"
+		case fileExists(filepath.Join(envPath, incompleteMarkerName)):
+			status = "incomplete (run 'tfvenv up')"
+		default:
+			config, err := readConfig(filepath.Join(envPath, "config", env.Name, tfvenvrcFileName))
+			if err != nil {
+				status = "no " + tfvenvrcFileName + " (run 'tfvenv up')"
+				break
+			}
+			declaredConfig := env.applyTo(config)
+			tool = envTool(envPath, env.Name)
+			if tool != resolveTool(declaredConfig.Tool, "") {
+				status = fmt.Sprintf("uses %s, declared %s", tool, resolveTool(declaredConfig.Tool, ""))
+			} else if drift := versionDrift(envPath, env.Name, declaredConfig); len(drift) > 0 {
+				status = strings.Join(drift, "; ")
+			}
+		}
+		fmt.Printf("  %-16s %-10s %-28s %s\n", env.Name, tool, strings.TrimSpace(declared), status)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// upgradeTarget is an environment an upgrade applies to. TfVersion and
+// TgVersion, when set, override the versions requested for every target.
+type upgradeTarget struct {
+	Name      string
+	Path      string
+	Tool      string
+	TfVersion string
+	TgVersion string
+}
+
+// upgradeStep is one binary an upgrade would install or replace.
+type upgradeStep struct {
+	Environment    string `json:"environment"`
+	Tool           string `json:"tool"`
+	CurrentVersion string `json:"current_version,omitempty"`
+	TargetVersion  string `json:"target_version"`
+	UpToDate       bool   `json:"up_to_date"`
+	DownloadURL    string `json:"download_url,omitempty"`
+	DownloadSize   int64  `json:"download_size,omitempty"`
+	ChecksumURL    string `json:"checksum_url,omitempty"`
+}
+
+// upgradePlan is the plan of record printed before an upgrade. --tf-version
+// applies to OpenTofu in environments that run with TOOL=tofu.
+type upgradePlan struct {
+	TerraformVersion  string        `json:"terraform_version,omitempty"`
+	TofuVersion       string        `json:"tofu_version,omitempty"`
+	TerragruntVersion string        `json:"terragrunt_version,omitempty"`
+	Steps             []upgradeStep `json:"steps"`
+}
+
+// targetVersion returns the version the plan installs for a tool in an
+// environment, or "none" when the plan has no step for it.
+func (p upgradePlan) targetVersion(env, tool string) string {
+	for _, step := range p.Steps {
+		if step.Environment == env && step.Tool == tool {
+			return step.TargetVersion
+		}
+	}
+	return "none"
+}
+
+// pending reports whether any step still needs a download.
+func (p upgradePlan) pending() bool {
+	for _, step := range p.Steps {
+		if !step.UpToDate {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveUpgradeTargets returns the environments named by --group, or envDir
+// itself when no group is given. "all" selects every environment in envDir.
+func resolveUpgradeTargets(envDir string, group []string) ([]upgradeTarget, error) {
+	if len(group) == 0 {
+		name := filepath.Base(envDir)
+		return []upgradeTarget{{Name: name, Path: envDir, Tool: envTool(envDir, name)}}, nil
+	}
+	if len(group) == 1 && group[0] == "all" {
+		names, err := listEnvironmentDirs(envDir)
+		if err != nil {
+			return nil, err
+		}
+		group = names
+	}
+
+	var targets []upgradeTarget
+	for _, name := range group {
+		envPath := filepath.Join(envDir, name)
+		if _, err := os.Stat(envPath); os.IsNotExist(err) {
+			return nil, fmt.Errorf("environment '%s' does not exist", name)
+		}
+		targets = append(targets, upgradeTarget{Name: name, Path: envPath, Tool: envTool(envPath, name)})
+	}
+	return targets, nil
+}
+
+// buildUpgradePlan compares each target's installed binaries with the requested
+// versions. "latest" is resolved once per tool, and each download is sized once.
+// Tools whose version is "none" are left alone.
+func buildUpgradePlan(targets []upgradeTarget, tfVersion, tgVersion string) (upgradePlan, error) {
+	plan := upgradePlan{}
+	latest := make(map[string]string)
+	resolve := func(tool, version string) (string, error) {
+		if version != "latest" {
+			return version, nil
+		}
+		if _, ok := latest[tool]; !ok {
+			v, err := getLatestVersion(tool, false)
+			if err != nil {
+				return "", fmt.Errorf("failed to fetch latest version for %s: %w", tool, err)
+			}
+			latest[tool] = v
+		}
+		return latest[tool], nil
+	}
+
+	sizes := make(map[string]int64)
+	for _, target := range targets {
+		requested := map[string]string{target.Tool: tfVersion, "terragrunt": tgVersion}
+		if target.TfVersion != "" {
+			requested[target.Tool] = target.TfVersion
+		}
+		if target.TgVersion != "" {
+			requested["terragrunt"] = target.TgVersion
+		}
+
+		for _, tool := range []string{target.Tool, "terragrunt"} {
+			if requested[tool] == "none" || requested[tool] == "" {
+				continue
+			}
+			targetVersion, err := resolve(tool, requested[tool])
+			if err != nil {
+				return plan, err
+			}
+			step := upgradeStep{Environment: target.Name, Tool: tool, TargetVersion: targetVersion}
+			binaryPath := envBinaryPath(target.Path, tool)
+			if fileExists(binaryPath) {
+				if current, err := getBinaryVersion(binaryPath, tool); err == nil {
+					step.CurrentVersion = current
+					step.UpToDate = current == step.TargetVersion
+				}
+			}
+			if !step.UpToDate {
+				if err := checkVersionPolicy(tool, step.TargetVersion); err != nil {
+					return plan, fmt.Errorf("%s: %w", target.Name, err)
+				}
+				downloadURL, _, err := binaryDownloadURL(toolDownloadURL(tool), step.TargetVersion, filepath.Join(target.Path, "bin"), tool)
+				if err != nil {
+					return plan, err
+				}
+				if _, ok := sizes[downloadURL]; !ok {
+					sizes[downloadURL] = remoteSize(downloadURL)
+				}
+				step.DownloadURL = downloadURL
+				step.DownloadSize = sizes[downloadURL]
+				step.ChecksumURL = checksumURL(tool, step.TargetVersion)
+			}
+			plan.Steps = append(plan.Steps, step)
+		}
+	}
+
+	// Summarise the versions; "mixed" when environments get different ones
+	for _, step := range plan.Steps {
+		summary := map[string]*string{toolTerraform: &plan.TerraformVersion, toolTofu: &plan.TofuVersion, "terragrunt": &plan.TerragruntVersion}[step.Tool]
+		switch *summary {
+		case "":
+			*summary = step.TargetVersion
+		case step.TargetVersion, "mixed":
+		default:
+			*summary = "mixed"
+		}
+	}
+	return plan, nil
+}
+
+// checksumURL returns where the release checksums for a tool version are published.
+func checksumURL(tool, version string) string {
+	switch tool {
+	case "terragrunt":
+		return fmt.Sprintf("%sv%s/SHA256SUMS", terragruntDownloadURL, version)
+	case toolTofu:
+		return fmt.Sprintf("%sv%s/tofu_%s_SHA256SUMS", tofuDownloadURL, version, version)
+	}
+	return fmt.Sprintf("%s%s/terraform_%s_SHA256SUMS", terraformDownloadURL, version, version)
+}
+
+// printUpgradePlan prints the plan as a table, or as JSON.
+func printUpgradePlan(plan upgradePlan, jsonOutput bool) {
+	if jsonOutput {
+		out, _ := json.MarshalIndent(plan, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+
+	fmt.Println("Upgrade plan:")
+	fmt.Printf("  %-20s %-11s %-12s %-12s %s\n", "ENVIRONMENT", "TOOL", "CURRENT", "TARGET", "DOWNLOAD")
+	var total int64
+	for _, step := range plan.Steps {
+		current := step.CurrentVersion
+		if current == "" {
+			current = "-"
+		}
+		download := "up to date"
+		if !step.UpToDate {
+			download = formatSize(step.DownloadSize)
+			if step.DownloadSize > 0 {
+				total += step.DownloadSize
+			}
+		}
+		fmt.Printf("  %-20s %-11s %-12s %-12s %s\n", step.Environment, step.Tool, current, step.TargetVersion, download)
+	}
+
+	var sources []string
+	seen := make(map[string]bool)
+	for _, step := range plan.Steps {
+		if step.ChecksumURL != "" && !seen[step.ChecksumURL] {
+			seen[step.ChecksumURL] = true
+			sources = append(sources, step.ChecksumURL)
+		}
+	}
+	if len(sources) > 0 {
+		fmt.Println("Checksums:")
+		for _, source := range sources {
+			fmt.Printf("  %s\n", source)
+		}
+	}
+	fmt.Printf("Total download: %s\n", formatSize(total))
+}
+
+// confirm asks a yes/no question on the terminal. Without a terminal it
+// returns an error so unattended runs have to pass --yes.
+func confirm(question string) (bool, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return false, fmt.Errorf("confirmation required; rerun with --yes")
+	}
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false, nil
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// tfvenvVersion is the version of this build, set with
+// -ldflags "-X main.tfvenvVersion=1.2.3". Without it the module version Go
+// recorded is used, or "dev".
+var tfvenvVersion string
+
+// buildVersion returns the version tfvenv reports about itself.
+func buildVersion() string {
+	if tfvenvVersion != "" {
+		return tfvenvVersion
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return strings.TrimPrefix(info.Main.Version, "v")
+	}
+	return "dev"
+}
+
+// userAgentFor returns the User-Agent sent by a run of the command with the
+// given path, such as "tfvenv snap save", followed by TFVENV_USER_AGENT_ORG so
+// proxies and registries can allow-list and attribute an organisation's
+// requests.
+func userAgentFor(commandPath string) string {
+	command := strings.TrimSpace(strings.TrimPrefix(commandPath, "tfvenv"))
+	if command == "" {
+		command = "root"
+	}
+	ua := fmt.Sprintf("tfvenv/%s (%s/%s; command=%s)", buildVersion(), runtime.GOOS, runtime.GOARCH, command)
+	if org := strings.TrimSpace(os.Getenv("TFVENV_USER_AGENT_ORG")); org != "" {
+		ua += " " + org
+	}
+	return ua
+}
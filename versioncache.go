@@ -0,0 +1,283 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	version "github.com/hashicorp/go-version"
+	"github.com/spf13/cobra"
+)
+
+// versionCacheFileName records the latest release of each tool in the cache
+// directory, so hosts without network access can still resolve "latest".
+const versionCacheFileName = "latest-versions.json"
+
+// maxCachedReleases is how many recent stable releases of each tool are
+// cached for shell completion.
+const maxCachedReleases = 50
+
+// defaultLatestTTL is how long a resolved "latest" version is used without
+// asking again, unless TFVENV_LATEST_TTL says otherwise.
+const defaultLatestTTL = time.Hour
+
+// versionCacheMu serialises updates from concurrent lookups.
+var versionCacheMu sync.Mutex
+
+// refreshLatest is set by --refresh to look up "latest" even when the cached
+// version is still fresh.
+var refreshLatest bool
+
+// latestNotices records the tools whose cached "latest" was already reported
+// in this run.
+var latestNotices sync.Map
+
+// versionCacheEntry is the latest release of a tool and when it was looked up.
+type versionCacheEntry struct {
+	Version   string    `json:"version"`
+	FetchedAt time.Time `json:"fetched_at"`
+	// Releases are the recent stable releases, newest first.
+	Releases []string `json:"releases,omitempty"`
+}
+
+// versionCachePath returns where the latest versions are cached.
+func versionCachePath() string {
+	return filepath.Join(userDirs.CacheDir(), versionCacheFileName)
+}
+
+// loadVersionCache reads the cached latest versions. A missing or unreadable
+// cache is empty.
+func loadVersionCache() map[string]versionCacheEntry {
+	cache := make(map[string]versionCacheEntry)
+	data, err := os.ReadFile(versionCachePath())
+	if err != nil {
+		return cache
+	}
+	if err := json.Unmarshal(data, &cache); err != nil {
+		logger.Warnf("ignoring corrupt version cache %s: %v", versionCachePath(), err)
+		return make(map[string]versionCacheEntry)
+	}
+	return cache
+}
+
+// recordLatestVersion stores the latest version of a tool in the cache.
+func recordLatestVersion(tool, version string) error {
+	versionCacheMu.Lock()
+	defer versionCacheMu.Unlock()
+
+	cache := loadVersionCache()
+	entry := cache[tool]
+	entry.Version, entry.FetchedAt = version, time.Now().UTC()
+	cache[tool] = entry
+	return saveVersionCache(cache)
+}
+
+// recordReleases stores the recent releases of a tool in the cache.
+func recordReleases(tool string, releases []string) error {
+	versionCacheMu.Lock()
+	defer versionCacheMu.Unlock()
+
+	cache := loadVersionCache()
+	entry := cache[tool]
+	entry.Releases = releases
+	if entry.Version == "" && len(releases) > 0 {
+		entry.Version, entry.FetchedAt = releases[0], time.Now().UTC()
+	}
+	cache[tool] = entry
+	return saveVersionCache(cache)
+}
+
+// saveVersionCache writes the cache. Callers hold versionCacheMu.
+func saveVersionCache(cache map[string]versionCacheEntry) error {
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(userDirs.CacheDir(), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", userDirs.CacheDir(), err)
+	}
+	return os.WriteFile(versionCachePath(), data, 0644)
+}
+
+// cachedLatestVersion returns the cached latest version of a tool, if any.
+func cachedLatestVersion(tool string) (versionCacheEntry, bool) {
+	entry, ok := loadVersionCache()[tool]
+	return entry, ok && entry.Version != ""
+}
+
+// latestVersionTTL returns how long a resolved "latest" version is reused:
+// TFVENV_LATEST_TTL, such as 30m, or defaultLatestTTL. Zero disables reuse.
+func latestVersionTTL() time.Duration {
+	value := os.Getenv("TFVENV_LATEST_TTL")
+	if value == "" {
+		return defaultLatestTTL
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil || ttl < 0 {
+		logger.Warnf("invalid TFVENV_LATEST_TTL %q: expected a duration such as 30m; using %s", value, defaultLatestTTL)
+		return defaultLatestTTL
+	}
+	return ttl
+}
+
+// freshLatestVersion returns the cached latest version of a tool when it was
+// resolved within latestVersionTTL and --refresh was not given, and says so
+// on stderr once per run.
+func freshLatestVersion(tool string) (string, bool) {
+	if refreshLatest {
+		return "", false
+	}
+	entry, ok := cachedLatestVersion(tool)
+	if !ok {
+		return "", false
+	}
+	age := time.Since(entry.FetchedAt)
+	if age < 0 || age >= latestVersionTTL() {
+		return "", false
+	}
+	if _, reported := latestNotices.LoadOrStore(tool, true); !reported {
+		fmt.Fprintf(os.Stderr, "Latest %s is %s (resolved %s ago, use --refresh to re-check)\n", toolDisplayName(tool), entry.Version, formatAge(age))
+	}
+	logger.Infof("using %s %s cached as latest at %s", tool, entry.Version, entry.FetchedAt.Format(time.RFC3339))
+	return entry.Version, true
+}
+
+// formatAge renders a duration coarsely, as in "2h" or "3d".
+func formatAge(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
+
+// recentReleases returns the n newest stable releases of a tool and refreshes
+// the cached list, falling back to the cached list when the lookup fails.
+func recentReleases(tool string, n int) ([]string, error) {
+	releases, err := refreshReleases(tool)
+	if err != nil {
+		cached := loadVersionCache()[tool].Releases
+		if len(cached) == 0 {
+			return nil, err
+		}
+		logger.Warnf("%v; using cached %s releases", err, tool)
+		releases = cached
+	}
+	if len(releases) > n {
+		releases = releases[:n]
+	}
+	return releases, nil
+}
+
+// refreshReleases looks up the recent stable releases of a tool and caches them.
+func refreshReleases(tool string) ([]string, error) {
+	releases, err := fetchReleases(tool)
+	if err != nil {
+		return nil, err
+	}
+	if err := recordReleases(tool, releases); err != nil {
+		logger.Warnf("failed to cache %s releases: %v", tool, err)
+	}
+	return releases, nil
+}
+
+// fetchReleases returns the newest stable releases of a tool, newest first:
+// Terraform from the HashiCorp release index, OpenTofu and Terragrunt from
+// GitHub.
+func fetchReleases(tool string) ([]string, error) {
+	var tags []string
+	switch tool {
+	case toolTerraform:
+		var index map[string]TerraformRelease
+		if err := fetchReleaseJSON("https://releases.hashicorp.com/terraform/index.json", "Terraform release index", &index); err != nil {
+			return nil, err
+		}
+		for tag := range index {
+			tags = append(tags, tag)
+		}
+	case toolTofu, "terragrunt":
+		repo, name := "opentofu/opentofu", "OpenTofu"
+		if tool == "terragrunt" {
+			repo, name = "gruntwork-io/terragrunt", "Terragrunt"
+		}
+		var releases []GitHubRelease
+		if err := fetchReleaseJSON(fmt.Sprintf("https://api.github.com/repos/%s/releases?per_page=100", repo), name+" releases", &releases); err != nil {
+			return nil, err
+		}
+		for _, release := range releases {
+			if !release.Prerelease {
+				tags = append(tags, release.TagName)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported tool: %s", tool)
+	}
+
+	versions := make([]*version.Version, 0, len(tags))
+	for _, tag := range tags {
+		ver, err := version.NewVersion(strings.TrimPrefix(tag, "v"))
+		if err != nil {
+			logger.Warnf("invalid %s version format: %s", tool, tag)
+			continue
+		}
+		if ver.Prerelease() == "" {
+			versions = append(versions, ver)
+		}
+	}
+	sort.Sort(sort.Reverse(version.Collection(versions)))
+
+	var releases []string
+	for i := 0; i < maxCachedReleases && i < len(versions); i++ {
+		releases = append(releases, versions[i].Original())
+	}
+	return releases, nil
+}
+
+// fetchReleaseJSON decodes the JSON document at url into v.
+func fetchReleaseJSON(url, what string, v interface{}) error {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", what, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch %s: status code %d", what, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", what, err)
+	}
+	return nil
+}
+
+// completeCachedVersions completes a version from the cached releases of the
+// tools, without network access, after "latest" and any extra values.
+// The list is as fresh as the last 'tfvenv list-versions' or 'tfvenv maintain'.
+func completeCachedVersions(extra []string, tools ...string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		candidates := append([]string{"latest"}, extra...)
+		cache := loadVersionCache()
+		for _, tool := range tools {
+			candidates = append(candidates, cache[tool].Releases...)
+		}
+		var matches []string
+		seen := make(map[string]bool)
+		for _, candidate := range candidates {
+			if !seen[candidate] && strings.HasPrefix(candidate, toComplete) {
+				seen[candidate] = true
+				matches = append(matches, candidate)
+			}
+		}
+		return matches, cobra.ShellCompDirectiveNoFileComp
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+)
+
+// versionStoreDirName holds tool binaries by version inside the data directory,
+// as versions/<tool>/<version>/<binary>. Installs add the binaries they
+// download, and use a binary found there instead of downloading it.
+const versionStoreDirName = "versions"
+
+// sharedVersions reports whether environments link to the version store's
+// binaries rather than holding copies. TFVENV_SHARED_VERSIONS=false turns it
+// off, e.g. for environments that are copied to hosts without the store.
+func sharedVersions() bool {
+	value := os.Getenv("TFVENV_SHARED_VERSIONS")
+	if value == "" {
+		return true
+	}
+	shared, err := strconv.ParseBool(value)
+	if err != nil {
+		logger.Warnf("invalid TFVENV_SHARED_VERSIONS %q; linking binaries from the version store", value)
+		return true
+	}
+	return shared
+}
+
+// versionStoreDir returns the root of the version store.
+func versionStoreDir() string {
+	return filepath.Join(userDirs.DataDir(), versionStoreDirName)
+}
+
+// storedBinaryPath returns where the version store keeps a tool's binary.
+func storedBinaryPath(tool, v string) string {
+	return filepath.Join(versionStoreDir(), tool, v, executableName(tool))
+}
+
+// installStoredBinary links, or copies, a tool's binary from the version
+// store to binaryPath, and reports whether the store held it.
+func installStoredBinary(tool, v, binaryPath string) (bool, error) {
+	stored := storedBinaryPath(tool, v)
+	if !fileExists(stored) {
+		return false, nil
+	}
+	return true, linkStoredBinary(stored, binaryPath)
+}
+
+// linkStoredBinary makes binaryPath a symlink to a binary in the version
+// store. On Windows, where symlinks need privileges and a hard link would
+// keep a running binary locked, and with shared versions turned off, the
+// binary is copied instead. The link or copy is made beside binaryPath and
+// renamed over it, so binaryPath is left as it was when this fails.
+func linkStoredBinary(stored, binaryPath string) error {
+	tmp := binaryPath + ".tfvenv-link"
+	os.Remove(tmp)
+	if runtime.GOOS != "windows" && sharedVersions() {
+		target, err := filepath.Abs(stored)
+		if err != nil {
+			return err
+		}
+		if err := os.Symlink(target, tmp); err != nil {
+			return fmt.Errorf("failed to link %s to %s: %w", binaryPath, target, err)
+		}
+	} else {
+		if err := copyFile(stored, tmp); err != nil {
+			os.Remove(tmp)
+			return fmt.Errorf("failed to copy %s: %w", stored, err)
+		}
+		if err := os.Chmod(tmp, 0755); err != nil {
+			os.Remove(tmp)
+			return fmt.Errorf("failed to make %s executable: %w", binaryPath, err)
+		}
+	}
+	if err := os.Rename(tmp, binaryPath); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to install %s: %w", binaryPath, err)
+	}
+	return nil
+}
+
+// addToVersionStore copies a verified binary into the version store, unless
+// it already holds that version, and returns the stored path. The copy is
+// written beside its final name and renamed, so concurrent installs of the
+// same version never see a partial binary.
+func addToVersionStore(tool, v, binaryPath string) (string, error) {
+	stored := storedBinaryPath(tool, v)
+	if fileExists(stored) {
+		return stored, nil
+	}
+	dir := filepath.Dir(stored)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	tmp, err := os.CreateTemp(dir, ".store-")
+	if err != nil {
+		return "", fmt.Errorf("failed to add %s %s to the version store: %w", tool, v, err)
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err := copyFile(binaryPath, tmp.Name()); err != nil {
+		return "", fmt.Errorf("failed to add %s %s to the version store: %w", tool, v, err)
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return "", fmt.Errorf("failed to make %s executable: %w", tmp.Name(), err)
+	}
+	if err := os.Rename(tmp.Name(), stored); err != nil {
+		return "", fmt.Errorf("failed to add %s %s to the version store: %w", tool, v, err)
+	}
+	summary.fileWritten(stored)
+	return stored, nil
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"tfvenv/i18n"
+)
+
+// watchedFile is what the watcher remembers of a file between scans.
+type watchedFile struct {
+	modTime time.Time
+	size    int64
+}
+
+// watchCmd re-checks an environment's configuration whenever a file changes.
+func watchCmd() *cobra.Command {
+	var interval time.Duration
+	var fix, noValidate bool
+
+	cmd := &cobra.Command{
+		Use:   "watch <env-name>",
+		Short: "Watch an environment's config directory and run fmt and validate on changed files",
+		Long: `Watch the environment's config directory and check each file as it is saved:
+formatting of .tf, .tfvars, .hcl and .tfvars.json files, and terraform validate
+of the root modules the changed files belong to. Errors are printed as soon as
+they appear, without an IDE plugin. Stop with Ctrl-C.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envDir := viper.GetString("env-dir")
+			envPath := filepath.Join(envDir, envName)
+			configEnvDir := filepath.Join(envPath, "config", envName)
+			if _, err := os.Stat(configEnvDir); os.IsNotExist(err) {
+				i18n.Println("env.not_found", envName)
+				os.Exit(1)
+			}
+			if interval <= 0 {
+				fmt.Println("Error: --interval must be positive.")
+				os.Exit(1)
+			}
+
+			handleInterruptsGracefully()
+			ctx := cmd.Context()
+
+			files, err := scanWatchedFiles(configEnvDir)
+			if err != nil {
+				logger.Errorf("error scanning %s: %v", configEnvDir, err)
+				i18n.Println("error", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Watching %s (%d file(s)); press Ctrl-C to stop.\n", configEnvDir, len(files))
+
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					fmt.Println("Stopped watching.")
+					return
+				case <-ticker.C:
+				}
+
+				current, err := scanWatchedFiles(configEnvDir)
+				if err != nil {
+					logger.Warnf("error scanning %s: %v", configEnvDir, err)
+					continue
+				}
+				changed := changedWatchedFiles(files, current)
+				files = current
+				if len(changed) == 0 {
+					continue
+				}
+				checkWatchedFiles(envPath, envName, changed, fix, !noValidate)
+				// Files rewritten by --fix must not trigger another round
+				if fix {
+					if rescanned, err := scanWatchedFiles(configEnvDir); err == nil {
+						files = rescanned
+					}
+				}
+			}
+		},
+	}
+
+	cmd.Flags().DurationVar(&interval, "interval", time.Second, "How often to look for changed files")
+	cmd.Flags().BoolVar(&fix, "fix", false, "Rewrite changed files that are not formatted instead of only reporting them")
+	cmd.Flags().BoolVar(&noValidate, "no-validate", false, "Only check formatting, without running terraform validate")
+	return cmd
+}
+
+// scanWatchedFiles records the modification time and size of the files fmt
+// handles under dir, skipping Terraform and Terragrunt working directories.
+func scanWatchedFiles(dir string) (map[string]watchedFile, error) {
+	files := make(map[string]watchedFile)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// Editors replace files while saving; a file gone mid-scan is seen next time
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() {
+			if path != dir && (hclfmtSkipDirs[info.Name()] || info.Name() == backupsDirName) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if isWatchedFile(info.Name()) {
+			files[path] = watchedFile{modTime: info.ModTime(), size: info.Size()}
+		}
+		return nil
+	})
+	return files, err
+}
+
+// isWatchedFile reports whether fmt and validate care about a file.
+func isWatchedFile(name string) bool {
+	for _, suffix := range []string{".tf", ".tfvars", ".hcl", ".tfvars.json"} {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// changedWatchedFiles returns the files that are new or differ between two
+// scans, in sorted order. Removed files have nothing left to check.
+func changedWatchedFiles(before, after map[string]watchedFile) []string {
+	var changed []string
+	for path, file := range after {
+		if previous, ok := before[path]; !ok || previous != file {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// checkWatchedFiles formats or checks the changed files and validates the
+// root modules they belong to, printing one line per result.
+func checkWatchedFiles(envPath, envName string, changed []string, fix, validate bool) {
+	configEnvDir := filepath.Join(envPath, "config", envName)
+	tfBinary := envBinaryPath(envPath, envTool(envPath, envName))
+	stamp := time.Now().Format("15:04:05")
+
+	failed := false
+	for _, path := range changed {
+		rel, _ := filepath.Rel(configEnvDir, path)
+		if (strings.HasSuffix(path, ".tfvars") || strings.HasSuffix(path, ".tfvars.json")) && isSopsEncrypted(path) {
+			continue
+		}
+		var needsFormat bool
+		var err error
+		switch {
+		case strings.HasSuffix(path, ".tfvars.json"):
+			needsFormat, err = formatJSONFile(path, !fix)
+		case strings.HasSuffix(path, ".tf") || strings.HasSuffix(path, ".tfvars"):
+			if !fileExists(tfBinary) {
+				continue
+			}
+			needsFormat, err = formatTerraformFile(tfBinary, path, !fix)
+		default:
+			needsFormat, err = formatHCLFile(path, !fix)
+		}
+		switch {
+		case err != nil:
+			failed = true
+			fmt.Printf("[%s] ERROR %s: %v\n", stamp, rel, err)
+		case needsFormat && fix:
+			fmt.Printf("[%s] formatted %s\n", stamp, rel)
+		case needsFormat:
+			failed = true
+			fmt.Printf("[%s] needs formatting: %s\n", stamp, rel)
+		}
+	}
+
+	if validate && fileExists(tfBinary) {
+		for _, root := range changedRoots(envPath, envName, changed) {
+			output, err := validateRoot(envPath, envName, tfBinary, root)
+			if err != nil {
+				failed = true
+				fmt.Printf("[%s] validate %s failed:\n%s\n", stamp, rootLabel(envName, root), strings.TrimSpace(output))
+				continue
+			}
+			fmt.Printf("[%s] validate %s: ok\n", stamp, rootLabel(envName, root))
+		}
+	}
+	if !failed {
+		fmt.Printf("[%s] %d changed file(s) ok\n", stamp, len(changed))
+	}
+}
+
+// changedRoots returns the root modules holding changed .tf or .tfvars files.
+// A changed .tfvars file in the config directory affects every root.
+func changedRoots(envPath, envName string, changed []string) []string {
+	configEnvDir := filepath.Join(envPath, "config", envName)
+	roots, err := envRoots(envPath, envName)
+	if err != nil {
+		roots = []string{"."}
+	}
+	seen := make(map[string]bool)
+	for _, path := range changed {
+		if strings.HasSuffix(path, ".tfvars") && filepath.Dir(path) == configEnvDir {
+			for _, root := range roots {
+				seen[root] = true
+			}
+			continue
+		}
+		if !strings.HasSuffix(path, ".tf") {
+			continue
+		}
+		if root := rootOf(configEnvDir, roots, path); root != "" {
+			seen[root] = true
+		}
+	}
+	var result []string
+	for _, root := range roots {
+		if seen[root] {
+			result = append(result, root)
+		}
+	}
+	return result
+}
+
+// validateRoot runs terraform validate in a root module and returns its
+// output. Roots that were never initialized cannot be validated.
+func validateRoot(envPath, envName, tfBinary, root string) (string, error) {
+	// validate runs in the root module, so paths into the environment must be absolute
+	envPath = absPath(envPath)
+	dataDir := rootDataDir(envPath, root)
+	initialized := false
+	for _, name := range []string{"providers", "modules", "terraform.tfstate"} {
+		if _, err := os.Stat(filepath.Join(dataDir, name)); err == nil {
+			initialized = true
+		}
+	}
+	if !initialized {
+		return fmt.Sprintf("%s is not initialized; run terraform init there first", rootLabel(envName, root)), fmt.Errorf("not initialized")
+	}
+	cmdTf := exec.CommandContext(rootCtx, absPath(tfBinary), "validate", "-no-color")
+	cmdTf.Dir = filepath.Join(envPath, "config", envName, root)
+	cmdTf.Env = append(os.Environ(), "TF_DATA_DIR="+dataDir)
+	output, err := cmdTf.CombinedOutput()
+	return string(output), err
+}
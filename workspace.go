@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// workspaceCmd defines the "workspace" command and its subcommands.
+func workspaceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "workspace",
+		Short: "Manage Terraform workspaces for an environment",
+	}
+
+	cmd.AddCommand(workspaceListCmd())
+	cmd.AddCommand(workspaceSelectCmd())
+	cmd.AddCommand(workspaceNewCmd())
+
+	return cmd
+}
+
+// workspaceListCmd lists the Terraform workspaces of an environment
+func workspaceListCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list <env-name>",
+		Short: "List Terraform workspaces for the specified environment",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			envName := args[0]
+			envDir := viper.GetString("env-dir")
+			envPath := filepath.Join(envDir, envName)
+
+			output, err := runEnvTerraform(envPath, envName, "workspace", "list")
+			if err != nil {
+				logger.Errorf("error listing workspaces: %v", err)
+				fmt.Printf("Error listing workspaces: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Print(output)
+
+			meta, err := loadEnvMetadata(envPath)
+			if err != nil {
+				logger.Warnf("error reading environment metadata: %v", err)
+			} else if meta.Workspace != "" {
+				fmt.Printf("Recorded workspace for environment '%s': %s\n", envName, meta.Workspace)
+			}
+		},
+	}
+}
+
+// workspaceSelectCmd selects a Terraform workspace and records it in the environment metadata
+func workspaceSelectCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "select <env-name> <workspace>",
+		Short: "Select a Terraform workspace for the specified environment",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			switchWorkspace(args[0], args[1], "select")
+		},
+	}
+}
+
+// workspaceNewCmd creates a Terraform workspace and records it in the environment metadata
+func workspaceNewCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "new <env-name> <workspace>",
+		Short: "Create and select a new Terraform workspace for the specified environment",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			switchWorkspace(args[0], args[1], "new")
+		},
+	}
+}
+
+// switchWorkspace runs `terraform workspace <action> <workspace>` and records the result.
+func switchWorkspace(envName, workspace, action string) {
+	envDir := viper.GetString("env-dir")
+	envPath := filepath.Join(envDir, envName)
+
+	output, err := runEnvTerraform(envPath, envName, "workspace", action, workspace)
+	if err != nil {
+		logger.Errorf("error running workspace %s: %v", action, err)
+		fmt.Printf("Error running workspace %s: %v\n", action, err)
+		os.Exit(1)
+	}
+	fmt.Print(output)
+
+	err = updateEnvMetadata(envPath, func(meta *EnvironmentMetadata) {
+		meta.Workspace = workspace
+	})
+	if err != nil {
+		logger.Errorf("error recording workspace: %v", err)
+		fmt.Printf("Error recording workspace: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Workspace '%s' recorded for environment '%s'.\n", workspace, envName)
+	fmt.Printf("Run 'tfvenv activate %s' to export TF_WORKSPACE in the activation scripts.\n", envName)
+	logger.Infof("workspace '%s' recorded for environment '%s'", workspace, envName)
+}
+
+// runEnvTerraform runs the environment's terraform binary in its config directory and returns the output.
+func runEnvTerraform(envPath, envName string, args ...string) (string, error) {
+	cmdTf, err := envTerraformCommand(envPath, envName, args...)
+	if err != nil {
+		return "", err
+	}
+
+	output, err := cmdTf.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("terraform %s failed: %v, output: %s", strings.Join(args, " "), err, string(output))
+	}
+	return string(output), nil
+}